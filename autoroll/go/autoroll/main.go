@@ -54,6 +54,7 @@ var (
 	port            = flag.String("port", ":8000", "HTTP service port (e.g., ':8000')")
 	promPort        = flag.String("prom_port", ":20000", "Metrics service address (e.g., ':10110')")
 	resourcesDir    = flag.String("resources_dir", "", "The directory to find templates, JS, and CSS files. If blank the current directory will be used.")
+	rolesConfig     = flag.String("roles_config", "", "JSON file which assigns roles to users and groups, see go/login/roles.go. If blank, only logged in Googlers may change the mode of the roller.")
 	sheriff         = flag.String("sheriff", "", "Email address to CC on rolls, or URL from which to obtain such an email address.")
 	strategy        = flag.String("strategy", repo_manager.ROLL_STRATEGY_BATCH, "DEPS roll strategy; how many commits should be rolled at once.")
 	useMetadata     = flag.Bool("use_metadata", true, "Load sensitive values from metadata not from flags.")
@@ -127,11 +128,6 @@ func Init() {
 }
 
 func modeJsonHandler(w http.ResponseWriter, r *http.Request) {
-	if !login.IsGoogler(r) {
-		httputils.ReportError(w, r, fmt.Errorf("User does not have edit rights."), "You must be logged in with an @google.com account to do that.")
-		return
-	}
-
 	var mode struct {
 		Message string `json:"message"`
 		Mode    string `json:"mode"`
@@ -184,7 +180,7 @@ func runServer() {
 	r := mux.NewRouter()
 	r.PathPrefix("/res/").HandlerFunc(httputils.MakeResourceHandler(*resourcesDir))
 	r.HandleFunc("/", mainHandler)
-	r.HandleFunc("/json/mode", modeJsonHandler).Methods("POST")
+	r.HandleFunc("/json/mode", login.RequireRole(login.ROLE_EDITOR, modeJsonHandler)).Methods("POST")
 	r.HandleFunc("/json/status", httputils.CorsHandler(statusJsonHandler))
 	r.HandleFunc("/json/version", skiaversion.JsonHandler)
 	r.HandleFunc("/oauth2callback/", login.OAuth2CallbackHandler)
@@ -313,6 +309,9 @@ func main() {
 	}()
 
 	login.SimpleInitMust(*port, *local)
+	if err := login.InitRoles(*rolesConfig, login.GOOGLER_ROLES); err != nil {
+		sklog.Fatal(err)
+	}
 
 	runServer()
 }
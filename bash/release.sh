@@ -57,6 +57,14 @@
 # ---------------
 # If defined the post-install script will reload the udev rules and
 # call ldconfig to index added libraries.
+#
+# RELEASE_SIGNING_KEY
+# -------------------
+# If defined it should be the path to the PEM encoded RSA private key that
+# signs the provenance of the package, i.e. its name, SHA-256, git hash, user,
+# date, build host, dirty flag and Go version. Servers that are marked
+# production only install packages that are signed with the release key and
+# were built from a clean tree. See ../go/packages/provenance.go.
 
 set -x
 
@@ -188,6 +196,22 @@ then
   else
     DIRTY=false
   fi
+  NAME=${APPNAME}/${APPNAME}:${USERID}:${DATETIME}:${HASH}.deb
+  SHA256=`sha256sum ${OUT}/${APPNAME}.deb | cut -d' ' -f1`
+  BUILDHOST=`hostname -f`
+  GOVERSION=`go version | cut -d' ' -f3`
+  SIGNATURE=""
+  if [ -v RELEASE_SIGNING_KEY ]; then
+    # The provenance must match Package.Provenance() in
+    # ../go/packages/provenance.go byte for byte.
+    SIGNATURE=`printf "name:%s\nsha256:%s\nhash:%s\nuserid:%s\ndatetime:%s\nbuildhost:%s\ndirty:%s\ngoversion:%s\n" \
+      "${NAME}" "${SHA256}" "${HASH}" "${USERID}" "${DATETIME}" "${BUILDHOST}" "${DIRTY}" "${GOVERSION}" \
+      | openssl dgst -sha256 -sign ${RELEASE_SIGNING_KEY} | base64 -w 0`
+    if [ -z "${SIGNATURE}" ]; then
+      echo "Failed to sign the package with ${RELEASE_SIGNING_KEY}."
+      exit 1
+    fi
+  fi
   gsutil \
     -h x-goog-meta-appname:${APPNAME} \
     -h x-goog-meta-userid:${USERID} \
@@ -196,8 +220,12 @@ then
     -h x-goog-meta-dirty:${DIRTY} \
     -h "x-goog-meta-note:$1" \
     -h "x-goog-meta-services:$SYSTEMD" \
+    -h "x-goog-meta-buildhost:${BUILDHOST}" \
+    -h "x-goog-meta-goversion:${GOVERSION}" \
+    -h x-goog-meta-sha256:${SHA256} \
+    -h x-goog-meta-signature:${SIGNATURE} \
     cp ${OUT}/${APPNAME}.deb \
-    gs://skia-push/debs/${APPNAME}/${APPNAME}:${USERID}:${DATETIME}:${HASH}.deb
+    gs://skia-push/debs/${NAME}
 else
   echo "Upload bypassed."
 fi
@@ -55,6 +55,7 @@ type DBTask struct {
 	ChromiumPatch        string         `db:"chromium_patch"`
 	BlinkPatch           string         `db:"blink_patch"`
 	SkiaPatch            string         `db:"skia_patch"`
+	V8Patch              string         `db:"v8_patch"`
 	CatapultPatch        string         `db:"catapult_patch"`
 	BenchmarkPatch       string         `db:"benchmark_patch"`
 	Results              sql.NullString `db:"results"`
@@ -84,6 +85,7 @@ func (dbTask DBTask) GetPopulatedAddTaskVars() task_common.AddTaskVars {
 	taskVars.ChromiumPatch = dbTask.ChromiumPatch
 	taskVars.BlinkPatch = dbTask.BlinkPatch
 	taskVars.SkiaPatch = dbTask.SkiaPatch
+	taskVars.V8Patch = dbTask.V8Patch
 	taskVars.CatapultPatch = dbTask.CatapultPatch
 	taskVars.BenchmarkPatch = dbTask.BenchmarkPatch
 	return taskVars
@@ -131,6 +133,7 @@ type AddTaskVars struct {
 	ChromiumPatch        string `json:"chromium_patch"`
 	BlinkPatch           string `json:"blink_patch"`
 	SkiaPatch            string `json:"skia_patch"`
+	V8Patch              string `json:"v8_patch"`
 	CatapultPatch        string `json:"catapult_patch"`
 	BenchmarkPatch       string `json:"benchmark_patch"`
 }
@@ -160,6 +163,7 @@ func (task *AddTaskVars) GetInsertQueryAndBinds() (string, []interface{}, error)
 		{Name: "chromium_patch", Value: task.ChromiumPatch, Limit: db.LONG_TEXT_MAX_LENGTH},
 		{Name: "blink_patch", Value: task.BlinkPatch, Limit: db.LONG_TEXT_MAX_LENGTH},
 		{Name: "skia_patch", Value: task.SkiaPatch, Limit: db.LONG_TEXT_MAX_LENGTH},
+		{Name: "v8_patch", Value: task.V8Patch, Limit: db.LONG_TEXT_MAX_LENGTH},
 		{Name: "catapult_patch", Value: task.CatapultPatch, Limit: db.LONG_TEXT_MAX_LENGTH},
 		{Name: "benchmark_patch", Value: task.BenchmarkPatch, Limit: db.LONG_TEXT_MAX_LENGTH},
 	}); err != nil {
@@ -169,7 +173,7 @@ func (task *AddTaskVars) GetInsertQueryAndBinds() (string, []interface{}, error)
 	if strings.EqualFold(task.RunInParallel, "True") {
 		runInParallel = 1
 	}
-	return fmt.Sprintf("INSERT INTO %s (username,benchmark,platform,page_sets,custom_webpages,repeat_runs,run_in_parallel, benchmark_args,browser_args_nopatch,browser_args_withpatch,description,chromium_patch,blink_patch,skia_patch,catapult_patch,benchmark_patch,ts_added,repeat_after_days) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?);",
+	return fmt.Sprintf("INSERT INTO %s (username,benchmark,platform,page_sets,custom_webpages,repeat_runs,run_in_parallel, benchmark_args,browser_args_nopatch,browser_args_withpatch,description,chromium_patch,blink_patch,skia_patch,v8_patch,catapult_patch,benchmark_patch,ts_added,repeat_after_days) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?);",
 			db.TABLE_CHROMIUM_PERF_TASKS),
 		[]interface{}{
 			task.Username,
@@ -186,6 +190,7 @@ func (task *AddTaskVars) GetInsertQueryAndBinds() (string, []interface{}, error)
 			task.ChromiumPatch,
 			task.BlinkPatch,
 			task.SkiaPatch,
+			task.V8Patch,
 			task.CatapultPatch,
 			task.BenchmarkPatch,
 			task.TsAdded,
@@ -560,7 +560,13 @@ func pageSetsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 var rietveldURLRegexp = regexp.MustCompile("^(https?://codereview\\.chromium\\.org)/(\\d{3,})/?$")
-var gerritURLRegexp = regexp.MustCompile("^(https?://(?:[a-z]+)-review\\.googlesource\\.com)/c/(\\d{3,})/?$")
+
+// gerritURLRegexp matches the forms Gerrit change URLs come in, e.g.
+// https://chromium-review.googlesource.com/c/123456/,
+// https://chromium-review.googlesource.com/#/c/123456/3 and
+// https://skia-review.googlesource.com/c/skia/+/123456/3.  \1 is the Gerrit instance, \2 is the
+// change number and \3 is the optional patchset.
+var gerritURLRegexp = regexp.MustCompile("^(https?://[a-z0-9-]+-review\\.googlesource\\.com)/(?:#/)?(?:c/)?(?:[\\w./-]+/\\+/)?(\\d{3,})(?:/(\\d+))?/?$")
 
 type clDetail struct {
 	Issue         int64  `json:"issue"`
@@ -637,11 +643,88 @@ func getRietveldCLPatch(detail clDetail, patchsetID int) (string, error) {
 	return string(patchBytes), nil
 }
 
+// getGerritCLDetail returns the detail of the Gerrit change at clURLString and the Gerrit
+// instance it lives on.  If the URL specifies a patchset, it is the only one in the detail's
+// Patchsets, otherwise they are all listed, oldest first.
+func getGerritCLDetail(clURLString string) (clDetail, *gerrit.Gerrit, error) {
+	if clURLString == "" {
+		return clDetail{}, nil, fmt.Errorf("No CL specified")
+	}
+
+	matches := gerritURLRegexp.FindStringSubmatch(clURLString)
+	if len(matches) < 4 || matches[1] == "" || matches[2] == "" {
+		// Don't return error, since user could still be typing.
+		return clDetail{}, nil, nil
+	}
+	crURL := matches[1]
+	cl, err := strconv.ParseInt(matches[2], 10, 64)
+	if err != nil {
+		return clDetail{}, nil, fmt.Errorf("Invalid Gerrit CL number %s: %s", matches[2], err)
+	}
+	g, err := gerrit.NewGerrit(crURL, "", httpClient)
+	if err != nil {
+		return clDetail{}, nil, fmt.Errorf("Unable to talk to Gerrit at %s: %s", crURL, err)
+	}
+	sklog.Infof("Reading CL detail for %d from %s", cl, crURL)
+	change, err := g.GetIssueProperties(cl)
+	if err != nil {
+		// Don't return error, since user could still be typing.
+		sklog.Infof("Unable to retrieve CL detail: %s", err)
+		return clDetail{}, nil, nil
+	}
+	detail := clDetail{
+		Issue:    cl,
+		Subject:  change.Subject,
+		Modified: change.UpdatedString,
+		Project:  change.Project,
+	}
+	for _, id := range change.GetPatchsetIDs() {
+		detail.Patchsets = append(detail.Patchsets, int(id))
+	}
+	if matches[3] != "" {
+		patchsetID := 0
+		for _, id := range detail.Patchsets {
+			if strconv.Itoa(id) == matches[3] {
+				patchsetID = id
+			}
+		}
+		if patchsetID == 0 {
+			return clDetail{}, nil, fmt.Errorf("CL %d has no patchset %s", cl, matches[3])
+		}
+		detail.Patchsets = []int{patchsetID}
+	}
+	if len(detail.Patchsets) == 0 {
+		return clDetail{}, nil, fmt.Errorf("CL has no patchsets")
+	}
+	detail.CodereviewURL = fmt.Sprintf("%s/c/%d/%d", crURL, cl, detail.Patchsets[len(detail.Patchsets)-1])
+	return detail, g, nil
+}
+
+func getGerritCLPatch(g *gerrit.Gerrit, detail clDetail, patchsetID int) (string, error) {
+	if len(detail.Patchsets) == 0 {
+		return "", fmt.Errorf("CL has no patchsets")
+	}
+	if patchsetID <= 0 {
+		// If no valid patchsetID has been specified then use the last patchset.
+		patchsetID = detail.Patchsets[len(detail.Patchsets)-1]
+	}
+	sklog.Infof("Downloading patchset %d of CL %d from %s", patchsetID, detail.Issue, g.Url(0))
+	patch, err := g.GetPatch(detail.Issue, strconv.Itoa(patchsetID))
+	if err != nil {
+		return "", fmt.Errorf("Unable to retrieve CL patch: %v", err)
+	}
+	if int64(len(patch)) > db.LONG_TEXT_MAX_LENGTH {
+		return "", fmt.Errorf("Patch is too large; length is %d bytes.", len(patch))
+	}
+	return patch, nil
+}
+
 func gatherCLData(detail clDetail, patch string) (map[string]string, error) {
 	clData := map[string]string{}
 	clData["cl"] = strconv.FormatInt(detail.Issue, 10)
 	clData["subject"] = detail.Subject
 	clData["url"] = detail.CodereviewURL
+	// Rietveld and Gerrit both use this format, though Gerrit has nanoseconds.
 	modifiedTime, err := time.Parse("2006-01-02 15:04:05.999999", detail.Modified)
 	if err != nil {
 		sklog.Errorf("Unable to parse modified time for CL %d; input '%s', got %v", detail.Issue, detail.Modified, err)
@@ -651,16 +734,19 @@ func gatherCLData(detail clDetail, patch string) (map[string]string, error) {
 	}
 	clData["chromium_patch"] = ""
 	clData["skia_patch"] = ""
+	clData["v8_patch"] = ""
 	clData["catapult_patch"] = ""
 	switch detail.Project {
 	case "chromium", "chromium/src":
 		clData["chromium_patch"] = patch
 	case "skia":
 		clData["skia_patch"] = patch
-	case "catapult":
+	case "v8", "v8/v8":
+		clData["v8_patch"] = patch
+	case "catapult", "catapult-project/catapult":
 		clData["catapult_patch"] = patch
 	default:
-		sklog.Errorf("CL project is %s; only chromium, skia, catapult are supported.", detail.Project)
+		sklog.Errorf("CL project is %s; only chromium, skia, v8, catapult are supported.", detail.Project)
 	}
 	return clData, nil
 }
@@ -692,42 +778,22 @@ func getCLHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	} else {
 		// If it is not Rietveld then assume it is Gerrit.
-		matches := gerritURLRegexp.FindStringSubmatch(clURLString)
-		if len(matches) < 3 || matches[1] == "" || matches[2] == "" {
+		var g *gerrit.Gerrit
+		detail, g, err = getGerritCLDetail(clURLString)
+		if err != nil {
+			httputils.ReportError(w, r, err, "Failed to get CL details")
+			return
+		}
+		if detail.Issue == 0 {
 			// Return successful empty response, since the user could still be typing.
 			if err := json.NewEncoder(w).Encode(map[string]interface{}{}); err != nil {
 				httputils.ReportError(w, r, err, "Failed to encode JSON")
 			}
 			return
 		}
-		crURL := matches[1]
-		clString := matches[2]
-		g, err := gerrit.NewGerrit(crURL, "", httpClient)
-		if err != nil {
-			httputils.ReportError(w, r, err, "Failed to talk to Gerrit")
-			return
-		}
-		cl, err := strconv.ParseInt(clString, 10, 32)
-		if err != nil {
-			httputils.ReportError(w, r, err, "Invalid Gerrit CL number")
-			return
-		}
-		change, err := g.GetIssueProperties(cl)
-		if err != nil {
-			httputils.ReportError(w, r, err, "Failed to get issue properties from Gerrit")
-			return
-		}
-		latestPatchsetID := strconv.Itoa(len(change.Patchsets))
-		detail = clDetail{
-			Issue:         cl,
-			Subject:       change.Subject,
-			Modified:      change.UpdatedString,
-			Project:       change.Project,
-			CodereviewURL: fmt.Sprintf("%s/c/%d/%s", crURL, cl, latestPatchsetID),
-		}
-		patch, err = g.GetPatch(cl, latestPatchsetID)
+		patch, err = getGerritCLPatch(g, detail, 0)
 		if err != nil {
-			httputils.ReportError(w, r, err, "Failed to download patch from Gerrit")
+			httputils.ReportError(w, r, err, "Failed to get CL patch")
 			return
 		}
 	}
@@ -0,0 +1,111 @@
+package task_common
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"go.skia.org/infra/go/mockhttpclient"
+	"go.skia.org/infra/go/testutils"
+
+	expect "github.com/stretchr/testify/assert"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestGerritURLRegexp(t *testing.T) {
+	testutils.SmallTest(t)
+	test := func(url, expectedInstance, expectedCL, expectedPatchset string) {
+		matches := gerritURLRegexp.FindStringSubmatch(url)
+		assert.Len(t, matches, 4, url)
+		expect.Equal(t, expectedInstance, matches[1], url)
+		expect.Equal(t, expectedCL, matches[2], url)
+		expect.Equal(t, expectedPatchset, matches[3], url)
+	}
+	test("https://chromium-review.googlesource.com/c/123456", "https://chromium-review.googlesource.com", "123456", "")
+	test("https://chromium-review.googlesource.com/c/123456/", "https://chromium-review.googlesource.com", "123456", "")
+	test("https://chromium-review.googlesource.com/c/123456/3", "https://chromium-review.googlesource.com", "123456", "3")
+	test("https://chromium-review.googlesource.com/#/c/123456/3/", "https://chromium-review.googlesource.com", "123456", "3")
+	test("https://chromium-review.googlesource.com/123456", "https://chromium-review.googlesource.com", "123456", "")
+	test("https://chromium-review.googlesource.com/c/v8/v8/+/123456/3", "https://chromium-review.googlesource.com", "123456", "3")
+	test("https://skia-review.googlesource.com/c/skia/+/123456", "https://skia-review.googlesource.com", "123456", "")
+
+	for _, url := range []string{
+		"",
+		"https://chromium-review.googlesource.com/c/12",
+		"https://codereview.chromium.org/123456",
+		"https://chromium.googlesource.com/c/123456",
+		"https://chromium-review.googlesource.com/q/123456",
+	} {
+		expect.Nil(t, gerritURLRegexp.FindStringSubmatch(url), url)
+	}
+}
+
+const testChangeDetail = `)]}'
+{
+  "project": "v8/v8",
+  "subject": "Make V8 faster",
+  "updated": "2017-04-20 15:30:45.000000000",
+  "_number": 123456,
+  "revisions": {
+    "abc": {"_number": 1, "created": "2017-04-19 10:00:00.000000000"},
+    "def": {"_number": 2, "created": "2017-04-20 15:30:45.000000000"}
+  }
+}`
+
+const testPatch = `From abc Mon Sep 17 00:00:00 2001
+Subject: [PATCH] Make V8 faster
+---
+diff --git a/src/v8.cc b/src/v8.cc
+`
+
+// mockGerrit makes httpClient talk to a fake Gerrit that knows about CL 123456.
+func mockGerrit() {
+	urlMock := mockhttpclient.NewURLMock()
+	urlMock.Mock("https://chromium-review.googlesource.com/changes/123456/detail?o=ALL_REVISIONS", mockhttpclient.MockGetDialogue([]byte(testChangeDetail)))
+	urlMock.Mock("https://chromium-review.googlesource.com/changes/123456/revisions/1/patch", mockhttpclient.MockGetDialogue([]byte(base64.StdEncoding.EncodeToString([]byte(testPatch)))))
+	urlMock.Mock("https://chromium-review.googlesource.com/changes/123456/revisions/2/patch", mockhttpclient.MockGetDialogue([]byte(base64.StdEncoding.EncodeToString([]byte(testPatch)))))
+	httpClient = urlMock.Client()
+}
+
+func TestGerritCLData(t *testing.T) {
+	testutils.SmallTest(t)
+	oldClient := httpClient
+	defer func() { httpClient = oldClient }()
+	mockGerrit()
+
+	detail, g, err := getGerritCLDetail("https://chromium-review.googlesource.com/c/123456/")
+	assert.NoError(t, err)
+	expect.Equal(t, int64(123456), detail.Issue)
+	expect.Equal(t, []int{1, 2}, detail.Patchsets)
+	expect.Equal(t, "https://chromium-review.googlesource.com/c/123456/2", detail.CodereviewURL)
+
+	patch, err := getGerritCLPatch(g, detail, 0)
+	assert.NoError(t, err)
+	expect.Equal(t, "\ndiff --git a/src/v8.cc b/src/v8.cc\n", patch)
+
+	clData, err := gatherCLData(detail, patch)
+	assert.NoError(t, err)
+	expect.Equal(t, map[string]string{
+		"cl":             "123456",
+		"subject":        "Make V8 faster",
+		"url":            "https://chromium-review.googlesource.com/c/123456/2",
+		"modified":       "20170420153045",
+		"chromium_patch": "",
+		"skia_patch":     "",
+		"v8_patch":       patch,
+		"catapult_patch": "",
+	}, clData)
+
+	// A specific patchset.
+	detail, _, err = getGerritCLDetail("https://chromium-review.googlesource.com/c/v8/v8/+/123456/1")
+	assert.NoError(t, err)
+	expect.Equal(t, []int{1}, detail.Patchsets)
+	expect.Equal(t, "https://chromium-review.googlesource.com/c/123456/1", detail.CodereviewURL)
+
+	_, _, err = getGerritCLDetail("https://chromium-review.googlesource.com/c/123456/3")
+	expect.Error(t, err)
+
+	// The user could still be typing.
+	detail, _, err = getGerritCLDetail("https://chromium-review.googlesource.com/c/12")
+	assert.NoError(t, err)
+	expect.Equal(t, int64(0), detail.Issue)
+}
@@ -15,6 +15,8 @@ import (
 var (
 	Local         = flag.Bool("local", false, "Running locally if true. As opposed to in production.")
 	localFrontend = flag.String("local_frontend", "http://localhost:8000/", "When local is true, base URL where CTFE is running.")
+	localGCSDir   = flag.String("local_gcs_dir", "", "If set, worker scripts are run as local subprocesses instead of on swarming, and this local directory is used instead of Google Storage.")
+	localMaxPages = flag.Int("local_max_pages", 10, "When local_gcs_dir is set, the maximum number of pages to process. 0 means all pages.")
 )
 
 func Init(appName string) {
@@ -35,4 +37,7 @@ func initRest() {
 		frontend.MustInit()
 		util.MailInit()
 	}
+	if *localGCSDir != "" {
+		util.SetVarsForLocalWorkers(*localGCSDir, *localMaxPages)
+	}
 }
@@ -16,6 +16,7 @@ import (
 	"go.skia.org/infra/ct/go/ctfe/chromium_perf"
 	"go.skia.org/infra/ct/go/frontend"
 	"go.skia.org/infra/ct/go/master_scripts/master_common"
+	"go.skia.org/infra/ct/go/perf_report"
 	"go.skia.org/infra/ct/go/util"
 	"go.skia.org/infra/go/common"
 	"go.skia.org/infra/go/email"
@@ -48,6 +49,7 @@ var (
 	htmlOutputLink      = util.MASTER_LOGSERVER_LINK
 	skiaPatchLink       = util.MASTER_LOGSERVER_LINK
 	chromiumPatchLink   = util.MASTER_LOGSERVER_LINK
+	v8PatchLink         = util.MASTER_LOGSERVER_LINK
 	catapultPatchLink   = util.MASTER_LOGSERVER_LINK
 	benchmarkPatchLink  = util.MASTER_LOGSERVER_LINK
 	customWebpagesLink  = util.MASTER_LOGSERVER_LINK
@@ -81,7 +83,7 @@ func sendEmail(recipients []string) {
 	%s
 	The HTML output with differences between the base run and the patch run is <a href='%s'>here</a>.<br/>
 	The patch(es) you specified are here:
-	<a href='%s'>chromium</a>/<a href='%s'>skia</a>/<a href='%s'>catapult</a>
+	<a href='%s'>chromium</a>/<a href='%s'>skia</a>/<a href='%s'>v8</a>/<a href='%s'>catapult</a>
 	<br/>
 	Custom webpages (if specified) are <a href='%s'>here</a>.
 	<br/><br/>
@@ -89,7 +91,7 @@ func sendEmail(recipients []string) {
 	<br/><br/>
 	Thanks!
 	`
-	emailBody := fmt.Sprintf(bodyTemplate, *benchmarkName, *pagesetType, util.GetSwarmingLogsLink(*runID), *description, failureHtml, htmlOutputLink, chromiumPatchLink, skiaPatchLink, catapultPatchLink, customWebpagesLink, frontend.ChromiumPerfTasksWebapp)
+	emailBody := fmt.Sprintf(bodyTemplate, *benchmarkName, *pagesetType, util.GetSwarmingLogsLink(*runID), *description, failureHtml, htmlOutputLink, chromiumPatchLink, skiaPatchLink, v8PatchLink, catapultPatchLink, customWebpagesLink, frontend.ChromiumPerfTasksWebapp)
 	if err := util.SendEmailWithMarkup(recipients, emailSubject, emailBody, viewActionMarkup); err != nil {
 		sklog.Errorf("Error while sending email: %s", err)
 		return
@@ -156,10 +158,11 @@ func main() {
 	// Copy the patches and custom webpages to Google Storage.
 	skiaPatchName := *runID + ".skia.patch"
 	chromiumPatchName := *runID + ".chromium.patch"
+	v8PatchName := *runID + ".v8.patch"
 	catapultPatchName := *runID + ".catapult.patch"
 	benchmarkPatchName := *runID + ".benchmark.patch"
 	customWebpagesName := *runID + ".custom_webpages.csv"
-	for _, patchName := range []string{skiaPatchName, chromiumPatchName, catapultPatchName, benchmarkPatchName, customWebpagesName} {
+	for _, patchName := range []string{skiaPatchName, chromiumPatchName, v8PatchName, catapultPatchName, benchmarkPatchName, customWebpagesName} {
 		if err := gs.UploadFile(patchName, os.TempDir(), remoteOutputDir); err != nil {
 			sklog.Errorf("Could not upload %s to %s: %s", patchName, remoteOutputDir, err)
 			return
@@ -167,13 +170,14 @@ func main() {
 	}
 	skiaPatchLink = util.GCS_HTTP_LINK + filepath.Join(util.GCSBucketName, remoteOutputDir, skiaPatchName)
 	chromiumPatchLink = util.GCS_HTTP_LINK + filepath.Join(util.GCSBucketName, remoteOutputDir, chromiumPatchName)
+	v8PatchLink = util.GCS_HTTP_LINK + filepath.Join(util.GCSBucketName, remoteOutputDir, v8PatchName)
 	catapultPatchLink = util.GCS_HTTP_LINK + filepath.Join(util.GCSBucketName, remoteOutputDir, catapultPatchName)
 	benchmarkPatchLink = util.GCS_HTTP_LINK + filepath.Join(util.GCSBucketName, remoteOutputDir, benchmarkPatchName)
 	customWebpagesLink = util.GCS_HTTP_LINK + filepath.Join(util.GCSBucketName, remoteOutputDir, customWebpagesName)
 
 	// Check if the patches have any content to decide if we need one or two chromium builds.
-	localPatches := []string{filepath.Join(os.TempDir(), chromiumPatchName), filepath.Join(os.TempDir(), skiaPatchName)}
-	remotePatches := []string{filepath.Join(remoteOutputDir, chromiumPatchName), filepath.Join(remoteOutputDir, skiaPatchName)}
+	localPatches := []string{filepath.Join(os.TempDir(), chromiumPatchName), filepath.Join(os.TempDir(), skiaPatchName), filepath.Join(os.TempDir(), v8PatchName)}
+	remotePatches := []string{filepath.Join(remoteOutputDir, chromiumPatchName), filepath.Join(remoteOutputDir, skiaPatchName), filepath.Join(remoteOutputDir, v8PatchName)}
 	var chromiumBuildNoPatch, chromiumBuildWithPatch string
 	if util.PatchesAreEmpty(localPatches) {
 		// Create only one chromium build.
@@ -311,6 +315,15 @@ func main() {
 		return
 	}
 
+	// Compare the repeated runs of both patches. The results link to the comparison report, which
+	// links to the detailed results from csv_comparer.py. Without the report they link to the
+	// detailed results directly.
+	if err := writeComparisonReport(runIDNoPatch, runIDWithPatch, htmlOutputDir, htmlOutputLink); err != nil {
+		sklog.Errorf("Could not write the comparison report: %s", err)
+	} else {
+		htmlOutputLink = htmlOutputLinkBase + perf_report.REPORT_HTML
+	}
+
 	// Copy the HTML files to Google Storage.
 	if err := gs.UploadDir(htmlOutputDir, htmlRemoteDir, true); err != nil {
 		sklog.Errorf("Could not upload %s to %s: %s", htmlOutputDir, htmlRemoteDir, err)
@@ -319,3 +332,24 @@ func main() {
 
 	taskCompletedSuccessfully = true
 }
+
+// writeComparisonReport compares the repeated runs merged by util.MergeUploadCSVFiles and writes
+// the report into outputDir.
+func writeComparisonReport(runIDNoPatch, runIDWithPatch, outputDir, detailsLink string) error {
+	samples := []perf_report.Samples{}
+	for _, run := range []string{runIDNoPatch, runIDWithPatch} {
+		s, err := perf_report.ReadSamples(filepath.Join(util.StorageDir, util.BenchmarkRunsDir, run, run+util.REPEATS_OUTPUT_EXT))
+		if err != nil {
+			return err
+		}
+		samples = append(samples, s)
+	}
+	report := perf_report.Compare(samples[0], samples[1], *varianceThreshold)
+	report.RunID = *runID
+	report.Description = *description
+	report.RepeatRuns = util.GetRepeatValue(*benchmarkExtraArgs, *repeatBenchmark)
+	report.DetailsLink = detailsLink
+	report.NoPatchOutputLink = noPatchOutputLink
+	report.WithPatchOutputLink = withPatchOutputLink
+	return report.WriteFiles(outputDir)
+}
@@ -0,0 +1,524 @@
+/*
+	Compares the nopatch and withpatch runs of a chromium_perf task.
+
+	The comparison uses the value of every repeated run of every page, as written by
+	util.MergeUploadCSVFilesOnWorkers, so that it can tell real changes from noise.
+*/
+
+package perf_report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.skia.org/infra/go/util"
+)
+
+const (
+	// Names of the files written by Report.WriteFiles.
+	REPORT_HTML = "comparison.html"
+	REPORT_JSON = "comparison.json"
+
+	// CONFIDENCE is the confidence level of all confidence intervals in the report.
+	CONFIDENCE = 0.95
+
+	// OUTLIER_THRESHOLD is the modified z-score above which a page's percent change is considered
+	// an outlier among the pages of a metric. 3.5 is the usual cutoff for modified z-scores.
+	OUTLIER_THRESHOLD = 3.5
+
+	// MIN_PAGES_FOR_OUTLIERS is the smallest number of pages a metric needs for its outliers to be
+	// detected.
+	MIN_PAGES_FOR_OUTLIERS = 3
+)
+
+// _HIGHER_IS_BETTER_UNITS are the units of metrics for which an increase is an improvement. For
+// all other units, e.g. times and sizes, an increase is a regression. Units ending in
+// "_biggerIsBetter" or "_smallerIsBetter" say so themselves.
+var _HIGHER_IS_BETTER_UNITS = []string{"fps", "frames/s", "runs/s", "score"}
+
+// _T_CRITICAL_VALUES maps degrees of freedom to the two-sided 95% critical value of Student's
+// t-distribution. Degrees of freedom that are not listed use the next smaller entry, which is
+// slightly conservative.
+var _T_CRITICAL_VALUES = []struct {
+	df float64
+	t  float64
+}{
+	{1, 12.706}, {2, 4.303}, {3, 3.182}, {4, 2.776}, {5, 2.571}, {6, 2.447}, {7, 2.365},
+	{8, 2.306}, {9, 2.262}, {10, 2.228}, {11, 2.201}, {12, 2.179}, {13, 2.160}, {14, 2.145},
+	{15, 2.131}, {16, 2.120}, {17, 2.110}, {18, 2.101}, {19, 2.093}, {20, 2.086}, {25, 2.060},
+	{30, 2.042}, {40, 2.021}, {60, 2.000}, {120, 1.980}, {1000, 1.962},
+}
+
+// Samples maps a metric, e.g. "rasterize_time (ms)", to a page to the values of all repeated runs
+// of that page.
+type Samples map[string]map[string][]float64
+
+// ReadSamples reads a file written by util.MergeUploadCSVFilesOnWorkers or
+// util.MergeUploadCSVFiles.
+func ReadSamples(path string) (Samples, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open %s: %s", path, err)
+	}
+	defer util.Close(f)
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Could not read %s: %s", path, err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("No headers in %s", path)
+	}
+	cols := map[string]int{}
+	for i, h := range rows[0] {
+		cols[h] = i
+	}
+	for _, h := range []string{"page_name", "name", "value"} {
+		if _, ok := cols[h]; !ok {
+			return nil, fmt.Errorf("No %q column in %s", h, path)
+		}
+	}
+	samples := Samples{}
+	for _, row := range rows[1:] {
+		if len(row) != len(rows[0]) {
+			continue
+		}
+		v, err := strconv.ParseFloat(row[cols["value"]], 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		metric, page := row[cols["name"]], row[cols["page_name"]]
+		if _, ok := samples[metric]; !ok {
+			samples[metric] = map[string][]float64{}
+		}
+		samples[metric][page] = append(samples[metric][page], v)
+	}
+	return samples, nil
+}
+
+// Stats summarizes the repeated runs of a page.
+type Stats struct {
+	N      int     `json:"n"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stdDev"`
+}
+
+// PageComparison compares the runs of a single page for a metric. The confidence interval is of
+// the percent change and is only available if both runs were repeated at least twice.
+type PageComparison struct {
+	Page          string  `json:"page"`
+	NoPatch       Stats   `json:"noPatch"`
+	WithPatch     Stats   `json:"withPatch"`
+	PercentChange float64 `json:"percentChange"`
+	HasCI         bool    `json:"hasCI"`
+	CILow         float64 `json:"ciLow"`
+	CIHigh        float64 `json:"ciHigh"`
+	Significant   bool    `json:"significant"`
+	Regression    bool    `json:"regression"`
+	Outlier       bool    `json:"outlier"`
+}
+
+// MetricComparison compares all pages of a metric. Its means and percent change are the averages
+// over the pages that are not outliers, and its confidence interval is across those pages.
+type MetricComparison struct {
+	Name           string            `json:"name"`
+	HigherIsBetter bool              `json:"higherIsBetter"`
+	NumPages       int               `json:"numPages"`
+	NoPatchMean    float64           `json:"noPatchMean"`
+	WithPatchMean  float64           `json:"withPatchMean"`
+	PercentChange  float64           `json:"percentChange"`
+	HasCI          bool              `json:"hasCI"`
+	CILow          float64           `json:"ciLow"`
+	CIHigh         float64           `json:"ciHigh"`
+	Significant    bool              `json:"significant"`
+	Regression     bool              `json:"regression"`
+	Outliers       []string          `json:"outliers"`
+	Pages          []*PageComparison `json:"pages"`
+}
+
+// Regression is a significant change for the worse of a metric, or of a single page if Page is
+// not empty.
+type Regression struct {
+	Metric        string  `json:"metric"`
+	Page          string  `json:"page"`
+	PercentChange float64 `json:"percentChange"`
+	CILow         float64 `json:"ciLow"`
+	CIHigh        float64 `json:"ciHigh"`
+}
+
+// Report is the comparison of a chromium_perf task's runs. The links are filled in by the caller
+// and are only used in the HTML.
+type Report struct {
+	RunID               string              `json:"runID"`
+	Description         string              `json:"description"`
+	RepeatRuns          int                 `json:"repeatRuns"`
+	Confidence          float64             `json:"confidence"`
+	Threshold           float64             `json:"threshold"`
+	Metrics             []*MetricComparison `json:"metrics"`
+	Regressions         []Regression        `json:"regressions"`
+	DetailsLink         string              `json:"-"`
+	NoPatchOutputLink   string              `json:"-"`
+	WithPatchOutputLink string              `json:"-"`
+}
+
+// Compare compares the runs without and with the patch. Only metrics and pages that are in both
+// runs are compared. A change is significant if its confidence interval does not contain zero and
+// it is at least threshold percent.
+func Compare(noPatch, withPatch Samples, threshold float64) *Report {
+	r := &Report{
+		Confidence:  CONFIDENCE,
+		Threshold:   threshold,
+		Metrics:     []*MetricComparison{},
+		Regressions: []Regression{},
+	}
+	for metric, noPatchPages := range noPatch {
+		withPatchPages, ok := withPatch[metric]
+		if !ok {
+			continue
+		}
+		m := compareMetric(metric, noPatchPages, withPatchPages, threshold)
+		if m.NumPages == 0 {
+			continue
+		}
+		r.Metrics = append(r.Metrics, m)
+	}
+	sort.Sort(metricSlice(r.Metrics))
+
+	pageRegressions := []Regression{}
+	for _, m := range r.Metrics {
+		if m.Regression {
+			r.Regressions = append(r.Regressions, Regression{Metric: m.Name, PercentChange: m.PercentChange, CILow: m.CILow, CIHigh: m.CIHigh})
+		}
+		for _, p := range m.Pages {
+			if p.Regression {
+				pageRegressions = append(pageRegressions, Regression{Metric: m.Name, Page: p.Page, PercentChange: p.PercentChange, CILow: p.CILow, CIHigh: p.CIHigh})
+			}
+		}
+	}
+	sort.Sort(regressionSlice(r.Regressions))
+	sort.Sort(regressionSlice(pageRegressions))
+	r.Regressions = append(r.Regressions, pageRegressions...)
+	return r
+}
+
+func compareMetric(metric string, noPatchPages, withPatchPages map[string][]float64, threshold float64) *MetricComparison {
+	m := &MetricComparison{
+		Name:           metric,
+		HigherIsBetter: higherIsBetter(metric),
+		Outliers:       []string{},
+		Pages:          []*PageComparison{},
+	}
+	for page, noPatchValues := range noPatchPages {
+		withPatchValues, ok := withPatchPages[page]
+		if !ok || len(noPatchValues) == 0 || len(withPatchValues) == 0 {
+			continue
+		}
+		p := &PageComparison{
+			Page:      page,
+			NoPatch:   getStats(noPatchValues),
+			WithPatch: getStats(withPatchValues),
+		}
+		p.PercentChange = percentChange(p.NoPatch.Mean, p.WithPatch.Mean)
+		p.HasCI, p.CILow, p.CIHigh = welchInterval(p.NoPatch, p.WithPatch)
+		p.Significant = p.HasCI && isSignificant(p.PercentChange, p.CILow, p.CIHigh, threshold)
+		p.Regression = p.Significant && isWorse(p.PercentChange, m.HigherIsBetter)
+		m.Pages = append(m.Pages, p)
+	}
+	sort.Sort(pageSlice(m.Pages))
+	m.NumPages = len(m.Pages)
+	markOutliers(m.Pages)
+
+	changes := []float64{}
+	for _, p := range m.Pages {
+		if p.Outlier {
+			m.Outliers = append(m.Outliers, p.Page)
+			continue
+		}
+		m.NoPatchMean += p.NoPatch.Mean
+		m.WithPatchMean += p.WithPatch.Mean
+		changes = append(changes, p.PercentChange)
+	}
+	if len(changes) == 0 {
+		return m
+	}
+	m.NoPatchMean /= float64(len(changes))
+	m.WithPatchMean /= float64(len(changes))
+	s := getStats(changes)
+	m.PercentChange = s.Mean
+	if s.N >= 2 {
+		halfWidth := tCritical(float64(s.N-1)) * s.StdDev / math.Sqrt(float64(s.N))
+		m.HasCI, m.CILow, m.CIHigh = true, s.Mean-halfWidth, s.Mean+halfWidth
+		m.Significant = isSignificant(m.PercentChange, m.CILow, m.CIHigh, threshold)
+		m.Regression = m.Significant && isWorse(m.PercentChange, m.HigherIsBetter)
+	}
+	return m
+}
+
+// getStats returns the number, mean and sample standard deviation of the values.
+func getStats(values []float64) Stats {
+	s := Stats{N: len(values)}
+	if s.N == 0 {
+		return s
+	}
+	for _, v := range values {
+		s.Mean += v
+	}
+	s.Mean /= float64(s.N)
+	if s.N < 2 {
+		return s
+	}
+	sumSquares := 0.0
+	for _, v := range values {
+		sumSquares += (v - s.Mean) * (v - s.Mean)
+	}
+	s.StdDev = math.Sqrt(sumSquares / float64(s.N-1))
+	return s
+}
+
+// percentChange returns the change from a to b in percent of a, or 0 if a is 0. This matches
+// csv_comparer.py.
+func percentChange(a, b float64) float64 {
+	if a == 0 {
+		return 0
+	}
+	return (b - a) / a * 100
+}
+
+// welchInterval returns the confidence interval of the difference between the means of b and a,
+// in percent of the mean of a, using Welch's t-test since the runs need not have the same
+// variance. ok is false if there are not enough runs or the mean of a is 0.
+func welchInterval(a, b Stats) (ok bool, low, high float64) {
+	if a.N < 2 || b.N < 2 || a.Mean == 0 {
+		return false, 0, 0
+	}
+	va, vb := a.StdDev*a.StdDev/float64(a.N), b.StdDev*b.StdDev/float64(b.N)
+	diff := b.Mean - a.Mean
+	halfWidth := 0.0
+	if va+vb > 0 {
+		df := (va + vb) * (va + vb) / (va*va/float64(a.N-1) + vb*vb/float64(b.N-1))
+		halfWidth = tCritical(df) * math.Sqrt(va+vb)
+	}
+	scale := 100 / math.Abs(a.Mean)
+	return true, (diff - halfWidth) * scale, (diff + halfWidth) * scale
+}
+
+// tCritical returns the two-sided CONFIDENCE critical value of Student's t-distribution with df
+// degrees of freedom.
+func tCritical(df float64) float64 {
+	t := _T_CRITICAL_VALUES[0].t
+	for _, c := range _T_CRITICAL_VALUES {
+		if c.df > df {
+			break
+		}
+		t = c.t
+	}
+	return t
+}
+
+func isSignificant(change, low, high, threshold float64) bool {
+	return (low > 0 || high < 0) && math.Abs(change) >= threshold
+}
+
+func isWorse(change float64, higherIsBetter bool) bool {
+	return (change < 0) == higherIsBetter
+}
+
+// higherIsBetter looks at the units of the metric, which csv_pivot_table_merger.py puts in
+// parentheses after its name.
+func higherIsBetter(metric string) bool {
+	start, end := strings.LastIndex(metric, "("), strings.LastIndex(metric, ")")
+	if start == -1 || end < start {
+		return false
+	}
+	units := metric[start+1 : end]
+	if strings.HasSuffix(units, "_biggerIsBetter") {
+		return true
+	}
+	if strings.HasSuffix(units, "_smallerIsBetter") {
+		return false
+	}
+	return util.In(units, _HIGHER_IS_BETTER_UNITS)
+}
+
+// markOutliers marks the pages whose percent change is far from that of the other pages, using
+// the modified z-score, which is based on the median absolute deviation and so is not skewed by
+// the outliers themselves.
+func markOutliers(pages []*PageComparison) {
+	if len(pages) < MIN_PAGES_FOR_OUTLIERS {
+		return
+	}
+	changes := make([]float64, 0, len(pages))
+	for _, p := range pages {
+		changes = append(changes, p.PercentChange)
+	}
+	med := median(changes)
+	deviations := make([]float64, 0, len(pages))
+	for _, c := range changes {
+		deviations = append(deviations, math.Abs(c-med))
+	}
+	mad := median(deviations)
+	if mad == 0 {
+		return
+	}
+	for _, p := range pages {
+		p.Outlier = 0.6745*math.Abs(p.PercentChange-med)/mad > OUTLIER_THRESHOLD
+	}
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+type metricSlice []*MetricComparison
+
+func (s metricSlice) Len() int           { return len(s) }
+func (s metricSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s metricSlice) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+type pageSlice []*PageComparison
+
+func (s pageSlice) Len() int           { return len(s) }
+func (s pageSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s pageSlice) Less(i, j int) bool { return s[i].Page < s[j].Page }
+
+// regressionSlice sorts the largest regressions first.
+type regressionSlice []Regression
+
+func (s regressionSlice) Len() int      { return len(s) }
+func (s regressionSlice) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s regressionSlice) Less(i, j int) bool {
+	if a, b := math.Abs(s[i].PercentChange), math.Abs(s[j].PercentChange); a != b {
+		return a > b
+	}
+	if s[i].Metric != s[j].Metric {
+		return s[i].Metric < s[j].Metric
+	}
+	return s[i].Page < s[j].Page
+}
+
+// WriteFiles writes the report as REPORT_HTML and REPORT_JSON into dir.
+func (r *Report) WriteFiles(dir string) error {
+	jsonFile, err := os.Create(filepath.Join(dir, REPORT_JSON))
+	if err != nil {
+		return fmt.Errorf("Could not create %s: %s", REPORT_JSON, err)
+	}
+	defer util.Close(jsonFile)
+	if err := json.NewEncoder(jsonFile).Encode(r); err != nil {
+		return fmt.Errorf("Could not write %s: %s", REPORT_JSON, err)
+	}
+
+	htmlFile, err := os.Create(filepath.Join(dir, REPORT_HTML))
+	if err != nil {
+		return fmt.Errorf("Could not create %s: %s", REPORT_HTML, err)
+	}
+	defer util.Close(htmlFile)
+	if err := reportTemplate.Execute(htmlFile, r); err != nil {
+		return fmt.Errorf("Could not write %s: %s", REPORT_HTML, err)
+	}
+	return nil
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"percent": func(v float64) string { return fmt.Sprintf("%+.2f%%", v) },
+	"value":   func(v float64) string { return strconv.FormatFloat(v, 'g', 6, 64) },
+	"confidence": func(v float64) string {
+		return fmt.Sprintf("%g%%", v*100)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Cluster Telemetry comparison {{.RunID}}</title>
+  <style>
+    body { font-family: Arial, sans-serif; font-size: 13px; }
+    table { border-collapse: collapse; margin-bottom: 2em; }
+    th, td { border: 1px solid #ccc; padding: 3px 6px; text-align: right; }
+    th:first-child, td:first-child { text-align: left; }
+    tr.regression td { background-color: #f4cccc; }
+    tr.improvement td { background-color: #d9ead3; }
+    tr.outlier td { color: #999; }
+  </style>
+</head>
+<body>
+  <h2>Cluster Telemetry comparison {{.RunID}}</h2>
+  <p>{{.Description}}</p>
+  <p>
+    Changes are significant if their {{confidence .Confidence}} confidence interval does not contain
+    zero and they are at least {{.Threshold}}%. Page intervals are across the {{.RepeatRuns}}
+    repeated runs of the page, metric intervals are across the pages that are not outliers.
+  </p>
+  <p>
+    {{if .DetailsLink}}<a href="{{.DetailsLink}}">Detailed results</a>{{end}}
+    {{if .NoPatchOutputLink}}<a href="{{.NoPatchOutputLink}}">Raw nopatch output</a>{{end}}
+    {{if .WithPatchOutputLink}}<a href="{{.WithPatchOutputLink}}">Raw withpatch output</a>{{end}}
+    <a href="` + REPORT_JSON + `">JSON</a>
+  </p>
+
+  <h3>Significant regressions</h3>
+  {{if .Regressions}}
+  <table>
+    <tr><th>Metric</th><th>Page</th><th>Change</th><th>Confidence interval</th></tr>
+    {{range .Regressions}}
+    <tr class="regression">
+      <td>{{.Metric}}</td><td>{{if .Page}}{{.Page}}{{else}}All pages{{end}}</td>
+      <td>{{percent .PercentChange}}</td><td>{{percent .CILow}} to {{percent .CIHigh}}</td>
+    </tr>
+    {{end}}
+  </table>
+  {{else}}
+  <p>None.</p>
+  {{end}}
+
+  <h3>Metrics</h3>
+  <table>
+    <tr>
+      <th>Metric</th><th>Pages</th><th>Outliers</th><th>NoPatch</th><th>WithPatch</th>
+      <th>Change</th><th>Confidence interval</th>
+    </tr>
+    {{range .Metrics}}
+    <tr class="{{if .Regression}}regression{{else if .Significant}}improvement{{end}}">
+      <td><a href="#{{.Name}}">{{.Name}}</a></td><td>{{.NumPages}}</td><td>{{len .Outliers}}</td>
+      <td>{{value .NoPatchMean}}</td><td>{{value .WithPatchMean}}</td><td>{{percent .PercentChange}}</td>
+      <td>{{if .HasCI}}{{percent .CILow}} to {{percent .CIHigh}}{{else}}-{{end}}</td>
+    </tr>
+    {{end}}
+  </table>
+
+  {{range .Metrics}}
+  <h4 id="{{.Name}}">{{.Name}}</h4>
+  <p>Significant changes and outliers only; all pages are in the JSON.</p>
+  <table>
+    <tr>
+      <th>Page</th><th>NoPatch</th><th>WithPatch</th><th>Change</th><th>Confidence interval</th>
+    </tr>
+    {{range .Pages}}
+    {{if or .Significant .Outlier}}
+    <tr class="{{if .Outlier}}outlier{{else if .Regression}}regression{{else}}improvement{{end}}">
+      <td>{{.Page}}{{if .Outlier}} (outlier){{end}}</td>
+      <td>{{value .NoPatch.Mean}} &plusmn; {{value .NoPatch.StdDev}}</td>
+      <td>{{value .WithPatch.Mean}} &plusmn; {{value .WithPatch.StdDev}}</td>
+      <td>{{percent .PercentChange}}</td>
+      <td>{{if .HasCI}}{{percent .CILow}} to {{percent .CIHigh}}{{else}}-{{end}}</td>
+    </tr>
+    {{end}}
+    {{end}}
+  </table>
+  {{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,188 @@
+package perf_report
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.skia.org/infra/go/testutils"
+
+	expect "github.com/stretchr/testify/assert"
+	assert "github.com/stretchr/testify/require"
+)
+
+func TestReadSamples(t *testing.T) {
+	testutils.SmallTest(t)
+	dir, err := ioutil.TempDir("", "perf_report")
+	assert.NoError(t, err)
+	defer testutils.RemoveAll(t, dir)
+
+	path := filepath.Join(dir, "run.repeats")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`page_name,name,value,run_index
+http://www.google.com (#1),rasterize_time (ms),2.5,0
+http://www.google.com (#1),rasterize_time (ms),3.5,1
+http://www.google.com (#1),pixels (pixels),100,0
+http://www.youtube.com (#2),rasterize_time (ms),1,0
+http://www.youtube.com (#2),rasterize_time (ms),abc,1
+`), 0644))
+	samples, err := ReadSamples(path)
+	assert.NoError(t, err)
+	expect.Equal(t, Samples{
+		"rasterize_time (ms)": {
+			"http://www.google.com (#1)":  {2.5, 3.5},
+			"http://www.youtube.com (#2)": {1},
+		},
+		"pixels (pixels)": {
+			"http://www.google.com (#1)": {100},
+		},
+	}, samples)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("page,value\n"), 0644))
+	_, err = ReadSamples(path)
+	expect.Error(t, err)
+	_, err = ReadSamples(filepath.Join(dir, "missing"))
+	expect.Error(t, err)
+}
+
+// testSamples returns runs of six pages which all take about 10ms without the patch and about 11ms
+// with the patch, except for the last page, which takes 30ms with the patch. Their scores stay the
+// same.
+func testSamples() (Samples, Samples) {
+	noPatch, withPatch := Samples{"time (ms)": {}, "score (score)": {}}, Samples{"time (ms)": {}, "score (score)": {}}
+	for i, page := range []string{"a", "b", "c", "d", "e", "f"} {
+		d := float64(i) / 100
+		noPatch["time (ms)"][page] = []float64{9.9 + d, 10 + d, 10.1 + d}
+		withPatch["time (ms)"][page] = []float64{10.9 + d, 11 + d, 11.1 + d}
+		noPatch["score (score)"][page] = []float64{50 - d, 51, 49 + d}
+		withPatch["score (score)"][page] = []float64{49 + d, 50 - d, 51}
+	}
+	withPatch["time (ms)"]["f"] = []float64{29.9, 30, 30.1}
+	// Pages and metrics that are missing from one of the runs are not compared.
+	noPatch["time (ms)"]["g"] = []float64{10}
+	withPatch["other (ms)"] = map[string][]float64{"a": {1}}
+	return noPatch, withPatch
+}
+
+func TestCompare(t *testing.T) {
+	testutils.SmallTest(t)
+	noPatch, withPatch := testSamples()
+	r := Compare(noPatch, withPatch, 5)
+	expect.Equal(t, 0.95, r.Confidence)
+	expect.Equal(t, 5.0, r.Threshold)
+	assert.Len(t, r.Metrics, 2)
+
+	score := r.Metrics[0]
+	expect.Equal(t, "score (score)", score.Name)
+	expect.True(t, score.HigherIsBetter)
+	expect.Equal(t, 6, score.NumPages)
+	expect.False(t, score.Significant)
+	expect.False(t, score.Regression)
+	for _, p := range score.Pages {
+		expect.True(t, p.HasCI)
+		expect.False(t, p.Significant, p.Page)
+	}
+
+	time := r.Metrics[1]
+	expect.Equal(t, "time (ms)", time.Name)
+	expect.False(t, time.HigherIsBetter)
+	expect.Equal(t, 6, time.NumPages)
+	expect.Equal(t, []string{"f"}, time.Outliers)
+	expect.InDelta(t, 10.02, time.NoPatchMean, 0.0001)
+	expect.InDelta(t, 11.02, time.WithPatchMean, 0.0001)
+	expect.InDelta(t, 9.975, time.PercentChange, 0.01)
+	expect.True(t, time.HasCI)
+	expect.True(t, time.CILow > 9.8 && time.CIHigh < 10.1, "%f to %f", time.CILow, time.CIHigh)
+	expect.True(t, time.Regression)
+
+	a := time.Pages[0]
+	expect.Equal(t, "a", a.Page)
+	expect.Equal(t, Stats{N: 3, Mean: 10, StdDev: 0.1}, roundStats(a.NoPatch))
+	expect.InDelta(t, 10, a.PercentChange, 0.0001)
+	// The difference of the means is 1 +- 2.776 * sqrt(0.01/3 + 0.01/3), with 4 degrees of freedom.
+	expect.InDelta(t, 10-2.2666, a.CILow, 0.001)
+	expect.InDelta(t, 10+2.2666, a.CIHigh, 0.001)
+	expect.True(t, a.Regression)
+	expect.False(t, a.Outlier)
+	expect.True(t, time.Pages[5].Outlier)
+
+	// The metric regression comes first, then the pages from largest to smallest.
+	assert.Len(t, r.Regressions, 7)
+	expect.Equal(t, Regression{Metric: "time (ms)", PercentChange: time.PercentChange, CILow: time.CILow, CIHigh: time.CIHigh}, r.Regressions[0])
+	expect.Equal(t, "f", r.Regressions[1].Page)
+	expect.Equal(t, "a", r.Regressions[2].Page)
+	expect.Equal(t, "e", r.Regressions[6].Page)
+
+	// Changes below the threshold are not significant.
+	r = Compare(noPatch, withPatch, 15)
+	expect.False(t, r.Metrics[1].Regression)
+	expect.False(t, r.Metrics[1].Pages[0].Regression)
+	assert.Len(t, r.Regressions, 1)
+	expect.Equal(t, "f", r.Regressions[0].Page)
+}
+
+func TestCompareWithoutRepeats(t *testing.T) {
+	testutils.SmallTest(t)
+	r := Compare(Samples{"time (ms)": {"a": {10}, "b": {20}}}, Samples{"time (ms)": {"a": {12}, "b": {22}}}, 0)
+	assert.Len(t, r.Metrics, 1)
+	m := r.Metrics[0]
+	expect.InDelta(t, 15, m.PercentChange, 0.0001)
+	expect.True(t, m.HasCI)
+	for _, p := range m.Pages {
+		expect.False(t, p.HasCI, p.Page)
+		expect.False(t, p.Significant, p.Page)
+	}
+}
+
+func TestHigherIsBetter(t *testing.T) {
+	testutils.SmallTest(t)
+	expect.True(t, higherIsBetter("Total (score)"))
+	expect.True(t, higherIsBetter("frames (fps)"))
+	expect.True(t, higherIsBetter("throughput (count_biggerIsBetter)"))
+	expect.False(t, higherIsBetter("rasterize_time (ms)"))
+	expect.False(t, higherIsBetter("memory (sizeInBytes_smallerIsBetter)"))
+	expect.False(t, higherIsBetter("score"))
+}
+
+func TestTCritical(t *testing.T) {
+	testutils.SmallTest(t)
+	expect.Equal(t, 12.706, tCritical(0.5))
+	expect.Equal(t, 12.706, tCritical(1))
+	expect.Equal(t, 2.228, tCritical(10.9))
+	expect.Equal(t, 2.042, tCritical(35))
+	expect.Equal(t, 1.962, tCritical(100000))
+}
+
+func TestWriteFiles(t *testing.T) {
+	testutils.SmallTest(t)
+	dir, err := ioutil.TempDir("", "perf_report")
+	assert.NoError(t, err)
+	defer testutils.RemoveAll(t, dir)
+
+	noPatch, withPatch := testSamples()
+	r := Compare(noPatch, withPatch, 5)
+	r.RunID = "rmistry-20170510163703"
+	r.DetailsLink = "https://ct.skia.org/results/index.html"
+	assert.NoError(t, r.WriteFiles(dir))
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, REPORT_JSON))
+	assert.NoError(t, err)
+	decoded := &Report{}
+	assert.NoError(t, json.Unmarshal(b, decoded))
+	expect.Equal(t, r.RunID, decoded.RunID)
+	expect.Len(t, decoded.Metrics, 2)
+	expect.Len(t, decoded.Regressions, len(r.Regressions))
+
+	b, err = ioutil.ReadFile(filepath.Join(dir, REPORT_HTML))
+	assert.NoError(t, err)
+	html := string(b)
+	expect.True(t, strings.Contains(html, "rmistry-20170510163703"))
+	expect.True(t, strings.Contains(html, `href="https://ct.skia.org/results/index.html"`))
+	expect.True(t, strings.Contains(html, "f (outlier)"))
+}
+
+func roundStats(s Stats) Stats {
+	round := func(v float64) float64 { return float64(int64(v*10000+0.5)) / 10000 }
+	return Stats{N: s.N, Mean: round(s.Mean), StdDev: round(s.StdDev)}
+}
@@ -74,6 +74,7 @@ func pendingChromiumPerfTask() ChromiumPerfTask {
 			Description:          "description",
 			ChromiumPatch:        "chromiumpatch",
 			SkiaPatch:            "skiapatch",
+			V8Patch:              "v8patch",
 		},
 	}
 }
@@ -90,6 +91,8 @@ func TestChromiumPerfExecute(t *testing.T) {
 			"chromiumpatch\n")
 		assertFileContents(t, filepath.Join(os.TempDir(), runId+".skia.patch"),
 			"skiapatch\n")
+		assertFileContents(t, filepath.Join(os.TempDir(), runId+".v8.patch"),
+			"v8patch\n")
 		return nil
 	})
 	err := task.Execute()
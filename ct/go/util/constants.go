@@ -8,8 +8,6 @@ import (
 )
 
 const (
-	// Use the CTFE proxy to Google Storage. See skbug.com/6762
-	GCS_HTTP_LINK         = "https://ct.skia.org/results/"
 	CT_EMAIL_DISPLAY_NAME = "Cluster Telemetry"
 
 	GMAIL_CACHED_TOKEN = "ct_gmail_cached_token"
@@ -31,6 +29,10 @@ const (
 	CHROMIUM_ANALYSIS_TASKS_DIR_NAME = "chromium_analysis_runs"
 	FIX_ARCHIVE_TASKS_DIR_NAME       = "fix_archive_runs"
 
+	// Extension of the files that hold the value of every repeated run of every page, before
+	// csv_pivot_table_merger.py averages them.
+	REPEATS_OUTPUT_EXT = ".repeats"
+
 	// Limit the number of times CT tries to get a remote file before giving up.
 	MAX_URI_GET_TRIES = 4
 
@@ -182,6 +184,10 @@ var (
 	CtUser        = "chrome-bot"
 	GCSBucketName = "cluster-telemetry"
 
+	// Use the CTFE proxy to Google Storage. See skbug.com/6762
+	// SetVarsForLocalWorkers points it to the local directory that stands in for Google Storage.
+	GCS_HTTP_LINK = "https://ct.skia.org/results/"
+
 	// Email address of cluster telemetry admins. They will be notified everytime
 	// a task has started and completed.
 	CtAdmins = []string{"rmistry@google.com", "benjaminwagner@google.com"}
@@ -34,11 +34,18 @@ type GcsUtil struct {
 	// The client used to connect to Google Storage.
 	client  *http.Client
 	service *storage.Service
+	// If not empty then this local directory is used instead of Google Storage.
+	// See NewLocalGcsUtil.
+	localDir string
 }
 
 // NewGcsUtil initializes and returns a utility for CT interations with Google
-// Storage. If client is nil then auth.NewClient is invoked.
+// Storage. If client is nil then auth.NewClient is invoked. If LocalGCSDir is
+// set then the returned utility uses it instead of Google Storage.
 func NewGcsUtil(client *http.Client) (*GcsUtil, error) {
+	if LocalGCSDir != "" {
+		return NewLocalGcsUtil(LocalGCSDir), nil
+	}
 	if client == nil {
 		var authErr error
 		// If ClientSecretPath exists then assume that we do not get tokens from metadata.
@@ -89,6 +96,9 @@ func getRespBody(res *storage.Object, client *http.Client) (io.ReadCloser, error
 // Returns the response body of the specified GCS file. Client must close the
 // response body when finished with it.
 func (gs *GcsUtil) GetRemoteFileContents(filePath string) (io.ReadCloser, error) {
+	if gs.localDir != "" {
+		return gs.getLocalFileContents(filePath)
+	}
 	res, err := gs.service.Objects.Get(GCSBucketName, filePath).Do()
 	if err != nil {
 		return nil, fmt.Errorf("Could not get %s from GCS: %s", filePath, err)
@@ -109,6 +119,9 @@ func (gs *GcsUtil) downloadRemoteDir(localDir, gsDir string) error {
 	util.RemoveAll(localDir)
 	// Create the local dir.
 	util.MkdirAll(localDir, 0700)
+	if gs.localDir != "" {
+		return gs.copyLocalDir(gsDir, localDir)
+	}
 	// The channel where the storage objects to be downloaded will be sent to.
 	chStorageObjects := make(chan filePathToStorageObject, DOWNLOAD_UPLOAD_GOROUTINE_POOL_SIZE)
 
@@ -224,6 +237,9 @@ func (gs *GcsUtil) DeleteRemoteDirLogErr(gsDir string) {
 }
 
 func (gs *GcsUtil) DeleteRemoteDir(gsDir string) error {
+	if gs.localDir != "" {
+		return os.RemoveAll(gs.localPath(gsDir))
+	}
 	// The channel where the GCS filepaths to be deleted will be sent to.
 	chFilePaths := make(chan string, DELETE_GOROUTINE_POOL_SIZE)
 
@@ -289,6 +305,9 @@ func (gs *GcsUtil) DeleteRemoteDir(gsDir string) error {
 func (gs *GcsUtil) UploadFile(fileName, localDir, gsDir string) error {
 	localFile := filepath.Join(localDir, fileName)
 	gsFile := filepath.Join(gsDir, fileName)
+	if gs.localDir != "" {
+		return copyLocalFile(localFile, gs.localPath(gsFile))
+	}
 	object := &storage.Object{Name: gsFile}
 	f, err := os.Open(localFile)
 	if err != nil {
@@ -375,6 +394,10 @@ func (gs *GcsUtil) DownloadSwarmingArtifacts(localDir, remoteDirName, pagesetTyp
 
 // GetRemoteDirCount returns the number of objects in the specified dir.
 func (gs *GcsUtil) GetRemoteDirCount(gsDir string) (int, error) {
+	if gs.localDir != "" {
+		files, err := gs.listLocalDir(gsDir)
+		return len(files), err
+	}
 	req := gs.service.Objects.List(GCSBucketName).Prefix(gsDir + "/")
 	count := 0
 	for req != nil {
@@ -393,6 +416,9 @@ func (gs *GcsUtil) GetRemoteDirCount(gsDir string) (int, error) {
 }
 
 func (gs *GcsUtil) downloadFromSwarmingDir(remoteDir, gsDir, localDir string, runID int, mtx *sync.Mutex, artifactToIndex map[string]int) error {
+	if gs.localDir != "" {
+		return gs.copyFromLocalSwarmingDir(remoteDir, localDir, mtx, artifactToIndex)
+	}
 	req := gs.service.Objects.List(GCSBucketName).Prefix(remoteDir + "/")
 	for req != nil {
 		resp, err := req.Do()
@@ -487,7 +513,9 @@ func (gs *GcsUtil) UploadDir(localDir, gsDir string, cleanDir bool) error {
 				}
 				// Sleep for a second after uploading file to avoid bombarding Cloud
 				// storage.
-				time.Sleep(time.Second)
+				if gs.localDir == "" {
+					time.Sleep(time.Second)
+				}
 			}
 		}(i + 1)
 	}
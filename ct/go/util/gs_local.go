@@ -0,0 +1,126 @@
+// Local directory that stands in for Google Storage when running local workers.
+package util
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+)
+
+// NewLocalGcsUtil returns a utility that stores everything in localDir instead of
+// Google Storage. Objects are stored in localDir/GCSBucketName/ so that links
+// built from GCS_HTTP_LINK work once it points to localDir.
+func NewLocalGcsUtil(localDir string) *GcsUtil {
+	return &GcsUtil{localDir: localDir}
+}
+
+// localPath returns the local path of the specified Google Storage path.
+func (gs *GcsUtil) localPath(gsPath string) string {
+	return filepath.Join(gs.localDir, GCSBucketName, gsPath)
+}
+
+func (gs *GcsUtil) getLocalFileContents(filePath string) (io.ReadCloser, error) {
+	f, err := os.Open(gs.localPath(filePath))
+	if err != nil {
+		return nil, fmt.Errorf("Could not get %s from %s: %s", filePath, gs.localDir, err)
+	}
+	return f, nil
+}
+
+// listLocalDir returns the Google Storage paths of all files in the specified
+// dir and its subdirs. Like listing Google Storage, a missing dir has no files.
+func (gs *GcsUtil) listLocalDir(gsDir string) ([]string, error) {
+	files := []string{}
+	root := gs.localPath(gsDir)
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return files, nil
+	}
+	visit := func(p string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if f.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.Join(gsDir, rel))
+		return nil
+	}
+	if err := filepath.Walk(root, visit); err != nil {
+		return nil, fmt.Errorf("Error occured while listing %s: %s", gsDir, err)
+	}
+	return files, nil
+}
+
+// copyLocalDir copies the specified Google Storage dir into localDir, keeping
+// its subdirs.
+func (gs *GcsUtil) copyLocalDir(gsDir, localDir string) error {
+	files, err := gs.listLocalDir(gsDir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		rel, err := filepath.Rel(gsDir, f)
+		if err != nil {
+			return err
+		}
+		if err := copyLocalFile(gs.localPath(f), filepath.Join(localDir, rel)); err != nil {
+			return err
+		}
+		sklog.Infof("Copied %s to %s", gs.localPath(f), filepath.Join(localDir, rel))
+	}
+	return nil
+}
+
+// copyFromLocalSwarmingDir is the local version of downloadFromSwarmingDir.
+func (gs *GcsUtil) copyFromLocalSwarmingDir(remoteDir, localDir string, mtx *sync.Mutex, artifactToIndex map[string]int) error {
+	files, err := gs.listLocalDir(remoteDir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		fileName := filepath.Base(f)
+		index, err := strconv.Atoi(path.Base(filepath.Dir(f)))
+		if err != nil {
+			return fmt.Errorf("%s was not in expected format: %s", filepath.Dir(f), err)
+		}
+		if err := copyLocalFile(gs.localPath(f), filepath.Join(localDir, fileName)); err != nil {
+			return err
+		}
+		mtx.Lock()
+		artifactToIndex[path.Join(localDir, fileName)] = index
+		mtx.Unlock()
+	}
+	return nil
+}
+
+// copyLocalFile copies src to dst, creating the dirs of dst if necessary.
+func copyLocalFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("Error opening %s: %s", src, err)
+	}
+	defer util.Close(in)
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return fmt.Errorf("Could not create dir for %s: %s", dst, err)
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("Unable to create file %s: %s", dst, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		util.Close(out)
+		return fmt.Errorf("Could not copy %s to %s: %s", src, dst, err)
+	}
+	return out.Close()
+}
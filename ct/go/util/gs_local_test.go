@@ -0,0 +1,58 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/util"
+)
+
+func TestLocalGcsUtil(t *testing.T) {
+	testutils.SmallTest(t)
+	gcsDir, err := ioutil.TempDir("", "util_test_gcs_")
+	assert.NoError(t, err)
+	defer util.RemoveAll(gcsDir)
+	localDir, err := ioutil.TempDir("", "util_test_")
+	assert.NoError(t, err)
+	defer util.RemoveAll(localDir)
+	gs := NewLocalGcsUtil(gcsDir)
+
+	// Upload page sets in the layout of swarming artifacts.
+	for _, f := range []string{"1/1.py", "2/2.py", "3/3.py"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(localDir, filepath.Dir(f)), 0700))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(localDir, f), []byte(f), 0600))
+	}
+	remoteDir := filepath.Join(SWARMING_DIR_NAME, PAGESETS_DIR_NAME, "10k")
+	assert.NoError(t, gs.UploadDir(localDir, remoteDir, true))
+	_, err = os.Stat(filepath.Join(gcsDir, GCSBucketName, remoteDir, "2", "2.py"))
+	assert.NoError(t, err)
+	count, err := gs.GetRemoteDirCount(remoteDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	r, err := gs.GetRemoteFileContents(filepath.Join(remoteDir, "3", "3.py"))
+	assert.NoError(t, err)
+	contents, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	util.Close(r)
+	assert.Equal(t, "3/3.py", string(contents))
+	_, err = gs.GetRemoteFileContents(filepath.Join(remoteDir, "4", "4.py"))
+	assert.Error(t, err)
+
+	downloadDir := filepath.Join(localDir, "download")
+	pageSetToIndex, err := gs.DownloadSwarmingArtifacts(downloadDir, PAGESETS_DIR_NAME, "10k", 1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{
+		filepath.Join(downloadDir, "1.py"): 1,
+		filepath.Join(downloadDir, "2.py"): 2,
+	}, pageSetToIndex)
+
+	assert.NoError(t, gs.DeleteRemoteDir(remoteDir))
+	count, err = gs.GetRemoteDirCount(remoteDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
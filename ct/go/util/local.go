@@ -2,11 +2,33 @@
 package util
 
 import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
 	"os/user"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+)
+
+var (
+	// LocalGCSDir is the local directory that stands in for Google Storage when
+	// running local workers. See SetVarsForLocalWorkers.
+	LocalGCSDir = ""
+	// LocalMaxPages is the maximum number of pages local workers process. 0 means
+	// all pages are processed.
+	LocalMaxPages = 0
+
+	isolateCommandRegexp = regexp.MustCompile(`(?s)'command':\s*\[(.*?)\]`)
+	isolateStringRegexp  = regexp.MustCompile(`'([^']*)'`)
+	isolateVarRegexp     = regexp.MustCompile(`<\((\w+)\)`)
 )
 
 func SetVarsForLocal() {
@@ -25,3 +47,112 @@ func SetVarsForLocal() {
 	}
 	GCSBucketName = "cluster-telemetry-test"
 }
+
+// SetVarsForLocalWorkers makes master scripts run worker scripts as local
+// subprocesses instead of triggering swarming tasks, and makes both use gcsDir
+// instead of Google Storage. Results are written in the same layout as in
+// Google Storage, so links to them open the local files. Only the first
+// maxPages pages are processed, unless maxPages is 0.
+func SetVarsForLocalWorkers(gcsDir string, maxPages int) {
+	SetVarsForLocal()
+	absDir, err := filepath.Abs(gcsDir)
+	if err != nil {
+		sklog.Fatalf("Could not get absolute path of %s: %s", gcsDir, err)
+	}
+	util.MkdirAll(absDir, 0700)
+	LocalGCSDir = absDir
+	LocalMaxPages = maxPages
+	GCS_HTTP_LINK = "file://" + absDir + "/"
+}
+
+// runLocalTasks is the local version of TriggerSwarmingTask. The tasks are run
+// one after the other, and like swarming tasks failed ones are only logged.
+func runLocalTasks(pagesetType, taskPrefix, isolateName string, timeout time.Duration, maxPagesPerBot, numPages int, isolateExtraArgs map[string]string, repeatValue int) (int, error) {
+	if LocalMaxPages > 0 && numPages > LocalMaxPages {
+		sklog.Infof("Only processing %d of %d pages locally", LocalMaxPages, numPages)
+		numPages = LocalMaxPages
+	}
+	numPagesPerBot := GetNumPagesPerBot(repeatValue, maxPagesPerBot)
+	numTasks := int(math.Ceil(float64(numPages) / float64(numPagesPerBot)))
+	for i := 1; i <= numTasks; i++ {
+		isolateArgs := getTaskIsolateArgs(i, numPagesPerBot, pagesetType, isolateExtraArgs)
+		// Do not let the last task go past numPages.
+		isolateArgs["NUM"] = strconv.Itoa(util.MinInt(numPagesPerBot, numPages-GetStartRange(i, numPagesPerBot)+1))
+		taskName := fmt.Sprintf("%s_%d", taskPrefix, i)
+		if err := runLocalTask(taskName, isolateName, isolateArgs, "", timeout); err != nil {
+			sklog.Errorf("task %s failed: %s", taskName, err)
+		}
+	}
+	return numTasks, nil
+}
+
+// runLocalBuildRepoTask is the local version of TriggerBuildRepoSwarmingTask.
+func runLocalBuildRepoTask(taskName string, isolateArgs map[string]string, timeout time.Duration) ([]string, error) {
+	outDir, err := ioutil.TempDir(StorageDir, "local_work_")
+	if err != nil {
+		return nil, fmt.Errorf("Could not get temp dir: %s", err)
+	}
+	defer util.RemoveAll(outDir)
+	if err := runLocalTask(taskName, BUILD_REPO_ISOLATE, isolateArgs, outDir, timeout); err != nil {
+		return nil, fmt.Errorf("task %s failed: %s", taskName, err)
+	}
+	outputFile := filepath.Join(outDir, BUILD_OUTPUT_FILENAME)
+	contents, err := ioutil.ReadFile(outputFile)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read outputfile %s: %s", outputFile, err)
+	}
+	return strings.Split(string(contents), ","), nil
+}
+
+// runLocalTask runs the command of the specified isolate with the local flags.
+// outDir replaces ${ISOLATED_OUTDIR}.
+func runLocalTask(taskName, isolateName string, isolateArgs map[string]string, outDir string, timeout time.Duration) error {
+	_, currentFile, _, _ := runtime.Caller(0)
+	pathToIsolates := filepath.Join(filepath.Dir(filepath.Dir(filepath.Dir(currentFile))), "isolates")
+	cmd, err := getIsolateCommand(filepath.Join(pathToIsolates, isolateName), isolateArgs)
+	if err != nil {
+		return err
+	}
+	args := []string{}
+	for _, arg := range cmd[1:] {
+		args = append(args, strings.Replace(arg, "${ISOLATED_OUTDIR}", outDir, -1))
+	}
+	args = append(args, "--local", "--local_gcs_dir="+LocalGCSDir)
+	sklog.Infof("Running task %s locally: %s %s", taskName, cmd[0], strings.Join(args, " "))
+	return ExecuteCmd(cmd[0], args, os.Environ(), timeout, nil, nil)
+}
+
+// getIsolateCommand returns the command of the specified isolate file with its
+// variables replaced by isolateArgs. The binary is relative to the isolate
+// file, the same way it is in the isolate.
+func getIsolateCommand(isolatePath string, isolateArgs map[string]string) ([]string, error) {
+	contents, err := ioutil.ReadFile(isolatePath)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read %s: %s", isolatePath, err)
+	}
+	m := isolateCommandRegexp.FindSubmatch(contents)
+	if m == nil {
+		return nil, fmt.Errorf("No command in %s", isolatePath)
+	}
+	cmd := []string{}
+	for _, s := range isolateStringRegexp.FindAllStringSubmatch(string(m[1]), -1) {
+		var missing []string
+		arg := isolateVarRegexp.ReplaceAllStringFunc(s[1], func(v string) string {
+			name := isolateVarRegexp.FindStringSubmatch(v)[1]
+			value, ok := isolateArgs[name]
+			if !ok {
+				missing = append(missing, name)
+			}
+			return value
+		})
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("No value for %s in %s", strings.Join(missing, ", "), isolatePath)
+		}
+		cmd = append(cmd, arg)
+	}
+	if len(cmd) == 0 {
+		return nil, fmt.Errorf("Empty command in %s", isolatePath)
+	}
+	cmd[0] = filepath.Join(filepath.Dir(isolatePath), cmd[0])
+	return cmd, nil
+}
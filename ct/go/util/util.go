@@ -375,7 +375,11 @@ func GetNumPagesPerBot(repeatValue, maxPagesPerBot int) int {
 }
 
 // TriggerSwarmingTask returns the number of triggered tasks and an error (if any).
+// If LocalGCSDir is set then the tasks are run as local subprocesses instead.
 func TriggerSwarmingTask(pagesetType, taskPrefix, isolateName, runID string, hardTimeout, ioTimeout time.Duration, priority, maxPagesPerBot, numPages int, isolateExtraArgs, dimensions map[string]string, repeatValue int) (int, error) {
+	if LocalGCSDir != "" {
+		return runLocalTasks(pagesetType, taskPrefix, isolateName, hardTimeout, maxPagesPerBot, numPages, isolateExtraArgs, repeatValue)
+	}
 	// Instantiate the swarming client.
 	workDir, err := ioutil.TempDir(StorageDir, "swarming_work_")
 	if err != nil {
@@ -398,15 +402,7 @@ func TriggerSwarmingTask(pagesetType, taskPrefix, isolateName, runID string, har
 	numPagesPerBot := GetNumPagesPerBot(repeatValue, maxPagesPerBot)
 	numTasks := int(math.Ceil(float64(numPages) / float64(numPagesPerBot)))
 	for i := 1; i <= numTasks; i++ {
-		isolateArgs := map[string]string{
-			"START_RANGE":  strconv.Itoa(GetStartRange(i, numPagesPerBot)),
-			"NUM":          strconv.Itoa(numPagesPerBot),
-			"PAGESET_TYPE": pagesetType,
-		}
-		// Add isolateExtraArgs (if specified) into the isolateArgs.
-		for k, v := range isolateExtraArgs {
-			isolateArgs[k] = v
-		}
+		isolateArgs := getTaskIsolateArgs(i, numPagesPerBot, pagesetType, isolateExtraArgs)
 		taskName := fmt.Sprintf("%s_%d", taskPrefix, i)
 		genJSON, err := s.CreateIsolatedGenJSON(path.Join(pathToIsolates, isolateName), s.WorkDir, "linux", taskName, isolateArgs, []string{})
 		if err != nil {
@@ -467,6 +463,20 @@ func TriggerSwarmingTask(pagesetType, taskPrefix, isolateName, runID string, har
 	return numTasks, nil
 }
 
+// getTaskIsolateArgs returns the isolate args of the specified task of TriggerSwarmingTask.
+func getTaskIsolateArgs(taskNum, numPagesPerBot int, pagesetType string, isolateExtraArgs map[string]string) map[string]string {
+	isolateArgs := map[string]string{
+		"START_RANGE":  strconv.Itoa(GetStartRange(taskNum, numPagesPerBot)),
+		"NUM":          strconv.Itoa(numPagesPerBot),
+		"PAGESET_TYPE": pagesetType,
+	}
+	// Add isolateExtraArgs (if specified) into the isolateArgs.
+	for k, v := range isolateExtraArgs {
+		isolateArgs[k] = v
+	}
+	return isolateArgs
+}
+
 // getServiceAccount returns the service account that should be used when triggering swarming tasks.
 func getServiceAccount(dimensions map[string]string) string {
 	serviceAccount := ""
@@ -525,6 +535,11 @@ func MergeUploadCSVFiles(runID, pathToPyFiles string, gs *GcsUtil, totalPages, m
 			continue
 		}
 	}
+	// Combine the repeated runs of all slaves. They are used to compare runs and are not
+	// essential, so failures are only logged.
+	if err := mergeUploadRepeatsFiles(runID, gs, numTasks, numPagesPerBot); err != nil {
+		sklog.Errorf("Unable to merge and upload the repeated runs of %s: %s", runID, err)
+	}
 	// Call csv_merger.py to merge all results into a single results CSV.
 	pathToCsvMerger := filepath.Join(pathToPyFiles, "csv_merger.py")
 	outputFileName := runID + ".output"
@@ -548,6 +563,42 @@ func MergeUploadCSVFiles(runID, pathToPyFiles string, gs *GcsUtil, totalPages, m
 	return noOutputSlaves, nil
 }
 
+// mergeUploadRepeatsFiles combines the REPEATS_OUTPUT_EXT files uploaded by
+// MergeUploadCSVFilesOnWorkers into StorageDir/BenchmarkRunsDir/runID/runID.repeats and uploads
+// it next to the merged output.
+func mergeUploadRepeatsFiles(runID string, gs *GcsUtil, numTasks, numPagesPerBot int) error {
+	localOutputDir := filepath.Join(StorageDir, BenchmarkRunsDir, runID)
+	repeatsFileName := runID + REPEATS_OUTPUT_EXT
+	rows := [][]string{}
+	for i := 1; i <= numTasks; i++ {
+		workerRemotePath := filepath.Join(BenchmarkRunsDir, runID, strconv.Itoa(GetStartRange(i, numPagesPerBot)), "outputs", repeatsFileName)
+		respBody, err := gs.GetRemoteFileContents(workerRemotePath)
+		if err != nil {
+			sklog.Warningf("Could not fetch %s: %s", workerRemotePath, err)
+			continue
+		}
+		reader := csv.NewReader(respBody)
+		reader.FieldsPerRecord = -1
+		workerRows, err := reader.ReadAll()
+		util.Close(respBody)
+		if err != nil {
+			sklog.Errorf("Could not read %s: %s", workerRemotePath, err)
+			continue
+		}
+		if len(workerRows) > 1 {
+			rows = append(rows, workerRows[1:]...)
+		}
+	}
+	if err := createCSV(filepath.Join(localOutputDir, repeatsFileName), REPEATS_HEADERS, rows); err != nil {
+		return err
+	}
+	remoteOutputDir := filepath.Join(BenchmarkRunsDir, runID, "consolidated_outputs")
+	if err := gs.UploadFile(repeatsFileName, localOutputDir, remoteOutputDir); err != nil {
+		return fmt.Errorf("Unable to upload %s to %s: %s", repeatsFileName, remoteOutputDir, err)
+	}
+	return nil
+}
+
 // GetRepeatValue returns the defaultValue if "--pageset-repeat" is not specified in benchmarkArgs.
 func GetRepeatValue(benchmarkArgs string, defaultValue int) int {
 	return GetIntFlagValue(benchmarkArgs, PAGESET_REPEAT_FLAG, defaultValue)
@@ -672,6 +723,8 @@ func MergeUploadCSVFilesOnWorkers(localOutputDir, pathToPyFiles, runID, remoteDi
 	if err != nil {
 		return fmt.Errorf("Unable to read %s: %s", localOutputDir, err)
 	}
+	// The values of every repeated run, which are lost when the pivot tables are averaged.
+	repeatRows := [][]string{}
 	for _, fileInfo := range fileInfos {
 		if !fileInfo.IsDir() {
 			continue
@@ -700,6 +753,14 @@ func MergeUploadCSVFilesOnWorkers(localOutputDir, pathToPyFiles, runID, remoteDi
 			sklog.Errorf("Could not write to %s: %s", newFile, err)
 			continue
 		}
+		repeatRows = append(repeatRows, getRepeatRows(headers, values)...)
+	}
+	// Write the repeated runs next to the merged output so that the master can compare them.
+	repeatsFileName := runID + REPEATS_OUTPUT_EXT
+	if err := createCSV(filepath.Join(localOutputDir, repeatsFileName), REPEATS_HEADERS, repeatRows); err != nil {
+		sklog.Errorf("Could not write %s: %s", repeatsFileName, err)
+	} else if err := gs.UploadFile(repeatsFileName, localOutputDir, filepath.Join(remoteDir, strconv.Itoa(startRange), "outputs")); err != nil {
+		sklog.Errorf("Unable to upload %s: %s", repeatsFileName, err)
 	}
 	// Call csv_pivot_table_merger.py to merge all results into a single results CSV.
 	pathToCsvMerger := filepath.Join(pathToPyFiles, "csv_pivot_table_merger.py")
@@ -725,6 +786,46 @@ func MergeUploadCSVFilesOnWorkers(localOutputDir, pathToPyFiles, runID, remoteDi
 	return nil
 }
 
+// REPEATS_HEADERS are the columns of REPEATS_OUTPUT_EXT files. The name includes the units, the
+// same way csv_pivot_table_merger.py names its columns.
+var REPEATS_HEADERS = []string{"page_name", "name", "value", "run_index"}
+
+// getRepeatRows converts rows of a telemetry pivot table into rows with REPEATS_HEADERS. Rows
+// without a page or with a value that is not a number are skipped.
+func getRepeatRows(headers []string, values [][]string) [][]string {
+	cols := map[string]int{}
+	for i, h := range headers {
+		cols[h] = i
+	}
+	for _, h := range []string{"page", "name", "value"} {
+		if _, ok := cols[h]; !ok {
+			return nil
+		}
+	}
+	get := func(row []string, h string) string {
+		if i, ok := cols[h]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+	rows := [][]string{}
+	for _, row := range values {
+		page := get(row, "page")
+		if page == "" {
+			continue
+		}
+		if _, err := strconv.ParseFloat(get(row, "value"), 64); err != nil {
+			continue
+		}
+		name := get(row, "name")
+		if units := get(row, "units"); units != "" {
+			name = fmt.Sprintf("%s (%s)", name, units)
+		}
+		rows = append(rows, []string{page, name, get(row, "value"), get(row, "run_index")})
+	}
+	return rows
+}
+
 func getRowsFromCSV(csvPath string) ([]string, [][]string, error) {
 	csvFile, err := os.Open(csvPath)
 	defer util.Close(csvFile)
@@ -764,10 +865,41 @@ func writeRowsToCSV(csvPath string, headers []string, values [][]string) error {
 	return nil
 }
 
+// createCSV creates or truncates the CSV file at csvPath and writes the headers and values to it.
+func createCSV(csvPath string, headers []string, values [][]string) error {
+	csvFile, err := os.Create(csvPath)
+	if err != nil {
+		return fmt.Errorf("Could not create %s: %s", csvPath, err)
+	}
+	defer util.Close(csvFile)
+	writer := csv.NewWriter(csvFile)
+	if err := writer.Write(headers); err != nil {
+		return fmt.Errorf("Could not write to %s: %s", csvPath, err)
+	}
+	if err := writer.WriteAll(values); err != nil {
+		return fmt.Errorf("Could not write to %s: %s", csvPath, err)
+	}
+	return nil
+}
+
 // TriggerBuildRepoSwarmingTask creates a isolated.gen.json file using BUILD_REPO_ISOLATE,
 // archives it, and triggers it's swarming task. The swarming task will run the build_repo
 // worker script which will return a list of remote build directories.
+//
+// If LocalGCSDir is set then the build_repo worker script is run as a local
+// subprocess instead.
 func TriggerBuildRepoSwarmingTask(taskName, runID, repo, targetPlatform string, hashes, patches []string, singleBuild bool, hardTimeout, ioTimeout time.Duration) ([]string, error) {
+	isolateArgs := map[string]string{
+		"RUN_ID":          runID,
+		"REPO":            repo,
+		"HASHES":          strings.Join(hashes, ","),
+		"PATCHES":         strings.Join(patches, ","),
+		"SINGLE_BUILD":    strconv.FormatBool(singleBuild),
+		"TARGET_PLATFORM": targetPlatform,
+	}
+	if LocalGCSDir != "" {
+		return runLocalBuildRepoTask(taskName, isolateArgs, hardTimeout)
+	}
 	// Instantiate the swarming client.
 	workDir, err := ioutil.TempDir(StorageDir, "swarming_work_")
 	if err != nil {
@@ -786,14 +918,6 @@ func TriggerBuildRepoSwarmingTask(taskName, runID, repo, targetPlatform string,
 	// Get path to isolate files.
 	_, currentFile, _, _ := runtime.Caller(0)
 	pathToIsolates := filepath.Join(filepath.Dir(filepath.Dir(filepath.Dir(currentFile))), "isolates")
-	isolateArgs := map[string]string{
-		"RUN_ID":          runID,
-		"REPO":            repo,
-		"HASHES":          strings.Join(hashes, ","),
-		"PATCHES":         strings.Join(patches, ","),
-		"SINGLE_BUILD":    strconv.FormatBool(singleBuild),
-		"TARGET_PLATFORM": targetPlatform,
-	}
 	genJSON, err := s.CreateIsolatedGenJSON(path.Join(pathToIsolates, BUILD_REPO_ISOLATE), s.WorkDir, "linux", taskName, isolateArgs, []string{})
 	if err != nil {
 		return nil, fmt.Errorf("Could not create isolated.gen.json for task %s: %s", taskName, err)
@@ -64,3 +64,52 @@ func TestRemoveFlagsFromArgs(t *testing.T) {
 	assert.Equal(t, "--abc", RemoveFlagsFromArgs("--abc", PAGESET_REPEAT_FLAG))
 	assert.Equal(t, "--output-format=csv-pivot-table --traffic-setting=Regular-3G", RemoveFlagsFromArgs("--output-format=csv-pivot-table --run-benchmark-timeout=900 --traffic-setting=Regular-3G", RUN_BENCHMARK_TIMEOUT_FLAG))
 }
+
+func TestGetRepeatRows(t *testing.T) {
+	testutils.SmallTest(t)
+	headers := []string{"page_set", "page", "name", "value", "units", "run_index"}
+	values := [][]string{
+		{"alexa1_1", "http://www.facebook.com/ (#1)", "rasterize_time", "2.359", "ms", "0"},
+		{"alexa1_1", "http://www.facebook.com/ (#1)", "rasterize_time", "2.5", "ms", "1"},
+		{"alexa1_1", "http://www.facebook.com/ (#1)", "pixels_recorded", "1172655", "", "0"},
+		{"alexa1_1", "http://www.facebook.com/ (#1)", "trace", "abc", "", "0"},
+		{"alexa1_1", "", "rasterize_time", "2.5", "ms", "0"},
+	}
+	assert.Equal(t, [][]string{
+		{"http://www.facebook.com/ (#1)", "rasterize_time (ms)", "2.359", "0"},
+		{"http://www.facebook.com/ (#1)", "rasterize_time (ms)", "2.5", "1"},
+		{"http://www.facebook.com/ (#1)", "pixels_recorded", "1172655", "0"},
+	}, getRepeatRows(headers, values))
+	// Pivot tables without values are skipped.
+	assert.Nil(t, getRepeatRows([]string{"page_set", "page", "name"}, values))
+}
+
+func TestGetIsolateCommand(t *testing.T) {
+	testutils.SmallTest(t)
+	pathToIsolates := filepath.Join(filepath.Dir(GetPathToPyFiles(false)), "isolates")
+	isolateArgs := map[string]string{
+		"RUN_ID":          "rmistry-20170510163703",
+		"REPO":            "chromium",
+		"HASHES":          "abc,def",
+		"PATCHES":         "",
+		"SINGLE_BUILD":    "true",
+		"TARGET_PLATFORM": "Linux",
+	}
+	cmd, err := getIsolateCommand(filepath.Join(pathToIsolates, BUILD_REPO_ISOLATE), isolateArgs)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(pathToIsolates, "..", "..", "..", "..", "..", "bin", "build_repo"),
+		"-logtostderr",
+		"--run_id=rmistry-20170510163703",
+		"--repo=chromium",
+		"--hashes=abc,def",
+		"--patches=",
+		"--single_build=true",
+		"--target_platform=Linux",
+		"--out=${ISOLATED_OUTDIR}",
+	}, cmd)
+
+	delete(isolateArgs, "REPO")
+	_, err = getIsolateCommand(filepath.Join(pathToIsolates, BUILD_REPO_ISOLATE), isolateArgs)
+	assert.Error(t, err)
+}
@@ -18,11 +18,15 @@ import (
 
 var (
 	Local = flag.Bool("local", false, "Running locally if true. As opposed to in production.")
+
+	localGCSDir = flag.String("local_gcs_dir", "", "If set, this local directory is used instead of Google Storage. Set by master scripts that run worker scripts locally.")
 )
 
 func Init() {
 	common.Init()
-	if *Local {
+	if *localGCSDir != "" {
+		util.SetVarsForLocalWorkers(*localGCSDir, 0)
+	} else if *Local {
 		util.SetVarsForLocal()
 	} else {
 		// Add depot_tools to the PATH.
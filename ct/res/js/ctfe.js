@@ -174,33 +174,17 @@ this.ctfe = this.ctfe || function() {
   }
 
   /**
-   * Returns a string that describes the specified CLs.
+   * Returns a string that describes the specified CLs. Takes any number of CL descriptions, some of
+   * which may be empty.
    **/
-  ctfe.getDescriptionOfCls = function(chromiumClDesc, skiaClDesc, catapultClDesc) {
-    if (!chromiumClDesc && !skiaClDesc && !catapultClDesc) {
+  ctfe.getDescriptionOfCls = function() {
+    var descs = Array.prototype.filter.call(arguments, function(desc) {
+      return desc;
+    });
+    if (descs.length == 0) {
       return "";
     }
-    var str = "Testing ";
-    var prev = false;
-    if (chromiumClDesc) {
-      str += chromiumClDesc;
-      prev = true;
-    }
-    if (skiaClDesc) {
-      if (prev) {
-        str += " and ";
-      }
-      str += skiaClDesc;
-      prev = true;
-    }
-    if (catapultClDesc) {
-      if (prev) {
-        str += " and ";
-      }
-      str += catapultClDesc;
-      prev = true;
-    }
-    return str;
+    return "Testing " + descs.join(" and ");
   }
 
   return ctfe;
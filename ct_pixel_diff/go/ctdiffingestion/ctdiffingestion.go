@@ -1,6 +1,7 @@
 package ctdiffingestion
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -145,7 +146,7 @@ func (p *pixelDiffProcessor) Process(resultsFile ingestion.ResultFileLocation) e
 		// Calculate diff metrics if the entry contains both nopatch and withpatch
 		// images.
 		if rec.IsReadyForDiff() {
-			diffResult, err := p.diffStore.Get(diff.PRIORITY_NOW, rec.NoPatchImg, []string{rec.WithPatchImg})
+			diffResult, err := p.diffStore.Get(context.Background(), diff.PRIORITY_NOW, rec.NoPatchImg, []string{rec.WithPatchImg})
 			if err != nil {
 				return err
 			}
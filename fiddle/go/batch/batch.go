@@ -0,0 +1,423 @@
+// Package batch runs many fiddles submitted at once through the /_/batch API,
+// each at a chosen revision of Skia, and keeps their structured results in
+// memory for the caller to poll.
+package batch
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.skia.org/infra/fiddle/go/bisect"
+	"go.skia.org/infra/fiddle/go/named"
+	"go.skia.org/infra/fiddle/go/runner"
+	"go.skia.org/infra/fiddle/go/store"
+	"go.skia.org/infra/fiddle/go/types"
+	"go.skia.org/infra/go/buildskia"
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/go/sklog"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// MAX_ITEMS is the maximum number of fiddles in a single batch.
+	MAX_ITEMS = 100
+
+	// MAX_QUEUED is the maximum number of batches waiting to run.
+	MAX_QUEUED = 20
+
+	// MAX_BATCHES is the number of batches kept in memory. Once there are
+	// more than this the oldest finished batches are dropped.
+	MAX_BATCHES = 200
+
+	// LIMITER_IDLE is how long a client's rate limiter is kept after its last
+	// batch.
+	LIMITER_IDLE = time.Hour
+)
+
+var (
+	// RateLimitedErr is returned from Add if the client has submitted too many
+	// fiddles recently.
+	RateLimitedErr = errors.New("Too many fiddles submitted, try again later.")
+
+	batchItems       = metrics2.GetCounter("batch-items", nil)
+	batchFailures    = metrics2.GetCounter("batch-failures", nil)
+	batchRateLimited = metrics2.GetCounter("batch-rate-limited", nil)
+)
+
+// batch is a BatchStatus along with the items to run.
+type batch struct {
+	status *types.BatchStatus
+	items  []*types.BatchItem
+}
+
+// copyStatus returns a copy of the status of the batch suitable for reading
+// while the original continues to be updated.
+func (b *batch) copyStatus() *types.BatchStatus {
+	ret := &types.BatchStatus{}
+	*ret = *b.status
+	ret.Results = make([]*types.BatchResult, 0, len(b.status.Results))
+	for _, r := range b.status.Results {
+		res := *r
+		ret.Results = append(ret.Results, &res)
+	}
+	return ret
+}
+
+// limiter is the rate limiter of a single client.
+type limiter struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+// Batcher runs batches one at a time and keeps the most recent ones in
+// memory.
+type Batcher struct {
+	fiddleRoot  string
+	depotTools  string
+	local       bool
+	builds      *buildskia.ContinuousBuilder
+	fiddleStore *store.Store
+	names       *named.Named
+	rate        rate.Limit
+	burst       int
+
+	queue chan *batch
+
+	// mutex protects batches, order, limiters, and the contents of each
+	// batch.
+	mutex    sync.Mutex
+	batches  map[string]*batch
+	order    []string // Batch ids, oldest first.
+	limiters map[string]*limiter
+}
+
+// New returns a new Batcher.
+//
+//    fiddleRoot - The root of the fiddle working directory. See DESIGN.md.
+//    depotTools - The directory where depot_tools is checked out.
+//    local - True if running locally, see runner.Run.
+//    builds - The builder whose builds of Skia the fiddles are run against.
+//    fiddleStore - Where fiddles and their outputs are stored.
+//    names - Used to dereference named includes.
+//    perMinute - The number of fiddles each client may run per minute.
+//    burst - The number of fiddles each client may run at once.
+//
+// Call Start() to begin running batches.
+func New(fiddleRoot, depotTools string, local bool, builds *buildskia.ContinuousBuilder, fiddleStore *store.Store, names *named.Named, perMinute float64, burst int) *Batcher {
+	return &Batcher{
+		fiddleRoot:  fiddleRoot,
+		depotTools:  depotTools,
+		local:       local,
+		builds:      builds,
+		fiddleStore: fiddleStore,
+		names:       names,
+		rate:        rate.Limit(perMinute / 60),
+		burst:       burst,
+		queue:       make(chan *batch, MAX_QUEUED),
+		batches:     map[string]*batch{},
+		order:       []string{},
+		limiters:    map[string]*limiter{},
+	}
+}
+
+// Start the Go routine that runs queued batches.
+func (b *Batcher) Start() {
+	go func() {
+		for bat := range b.queue {
+			b.runBatch(bat)
+		}
+	}()
+}
+
+// batchId returns a new random batch id.
+func batchId() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("Failed to generate batch id: %s", err)
+	}
+	return fmt.Sprintf("%x", buf), nil
+}
+
+// allow returns true if the client may run n more fiddles.
+//
+// allow presumes the caller already has a lock on the mutex.
+func (b *Batcher) allow(client string, n int) bool {
+	now := time.Now()
+	for c, l := range b.limiters {
+		if now.Sub(l.lastUsed) > LIMITER_IDLE {
+			delete(b.limiters, c)
+		}
+	}
+	l, ok := b.limiters[client]
+	if !ok {
+		l = &limiter{
+			limiter: rate.NewLimiter(b.rate, b.burst),
+		}
+		b.limiters[client] = l
+	}
+	l.lastUsed = now
+	return l.limiter.AllowN(now, n)
+}
+
+// resolveRevision returns the full git hash of the build of Skia that matches
+// the given revision, which may be a prefix of the git hash. An empty
+// revision is the current build.
+func resolveRevision(revision string, current string, available []string) (string, error) {
+	if revision == "" {
+		if current == "" {
+			return "", fmt.Errorf("There are no builds of Skia yet.")
+		}
+		return current, nil
+	}
+	found := ""
+	for _, h := range available {
+		if strings.HasPrefix(h, revision) {
+			if found != "" && found != h {
+				return "", fmt.Errorf("Ambiguous revision: %q", revision)
+			}
+			found = h
+		}
+	}
+	if found == "" {
+		return "", fmt.Errorf("Revision %q isn't an available build of Skia.", revision)
+	}
+	return found, nil
+}
+
+// validate checks the items of a batch and resolves their includes and
+// revisions, in place.
+func (b *Batcher) validate(items []*types.BatchItem) error {
+	available, err := b.builds.AvailableBuilds()
+	if err != nil {
+		return fmt.Errorf("Failed to list the available builds of Skia: %s", err)
+	}
+	current := b.builds.Current().Hash
+	ids := map[string]bool{}
+	for _, item := range items {
+		if item == nil || item.Id == "" {
+			return fmt.Errorf("Every fiddle in a batch must have an id.")
+		}
+		if ids[item.Id] {
+			return fmt.Errorf("Duplicate id in batch: %q", item.Id)
+		}
+		ids[item.Id] = true
+		for i, id := range item.Options.Includes {
+			fiddleHash, err := b.names.DereferenceID(id)
+			if err != nil {
+				return fmt.Errorf("Invalid include %q for %q: %s", id, item.Id, err)
+			}
+			item.Options.Includes[i] = fiddleHash
+		}
+		if err := runner.ValidateOptions(&item.Options); err != nil {
+			return fmt.Errorf("Invalid options for %q: %s", item.Id, err)
+		}
+		item.Revision, err = resolveRevision(item.Revision, current, available)
+		if err != nil {
+			return fmt.Errorf("Invalid revision for %q: %s", item.Id, err)
+		}
+	}
+	return nil
+}
+
+// enqueue queues the batch to be run on behalf of the given client. The
+// client's rate limit is only charged if the batch is queued.
+//
+// enqueue presumes the caller already has a lock on the mutex.
+func (b *Batcher) enqueue(client string, bat *batch) error {
+	// Only enqueue sends to the queue, so it can't fill up before the send
+	// below.
+	if len(b.queue) == cap(b.queue) {
+		return fmt.Errorf("Too many batches are queued, try again later.")
+	}
+	if !b.allow(client, len(bat.items)) {
+		batchRateLimited.Inc(1)
+		return RateLimitedErr
+	}
+	b.queue <- bat
+	b.batches[bat.status.Id] = bat
+	b.order = append(b.order, bat.status.Id)
+	b.trim()
+	return nil
+}
+
+// Add queues the fiddles in the request to be run on behalf of the given
+// client, which is used for rate limiting. Returns RateLimitedErr if the
+// client has run too many fiddles recently. Batches that are rejected don't
+// count against the client's rate limit.
+func (b *Batcher) Add(client string, req *types.BatchRequest) (*types.BatchStatus, error) {
+	if len(req.Items) == 0 {
+		return nil, fmt.Errorf("A batch must contain at least one fiddle.")
+	}
+	if len(req.Items) > MAX_ITEMS {
+		return nil, fmt.Errorf("Too many fiddles in the batch: %d > %d", len(req.Items), MAX_ITEMS)
+	}
+	if err := b.validate(req.Items); err != nil {
+		return nil, err
+	}
+	id, err := batchId()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	bat := &batch{
+		status: &types.BatchStatus{
+			Id:      id,
+			Created: now,
+			Results: make([]*types.BatchResult, 0, len(req.Items)),
+		},
+		items: req.Items,
+	}
+	for _, item := range req.Items {
+		bat.status.Results = append(bat.status.Results, &types.BatchResult{
+			Id:            item.Id,
+			Status:        types.BATCH_QUEUED,
+			Revision:      item.Revision,
+			CompileErrors: []types.CompileError{},
+			Outputs:       map[string]string{},
+			Queued:        now,
+		})
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := b.enqueue(client, bat); err != nil {
+		return nil, err
+	}
+	return bat.copyStatus(), nil
+}
+
+// trim drops the oldest finished batches once there are more than
+// MAX_BATCHES.
+//
+// trim presumes the caller already has a lock on the mutex.
+func (b *Batcher) trim() {
+	order := []string{}
+	excess := len(b.order) - MAX_BATCHES
+	for _, id := range b.order {
+		if excess > 0 && b.batches[id].status.Done {
+			delete(b.batches, id)
+			excess--
+			continue
+		}
+		order = append(order, id)
+	}
+	b.order = order
+}
+
+// Get returns a copy of the status of the batch with the given id.
+func (b *Batcher) Get(id string) (*types.BatchStatus, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	bat, ok := b.batches[id]
+	if !ok {
+		return nil, fmt.Errorf("Unknown batch: %s", id)
+	}
+	return bat.copyStatus(), nil
+}
+
+// runBatch runs each of the items in a batch in turn.
+func (b *Batcher) runBatch(bat *batch) {
+	sklog.Infof("Batch: Starting %s with %d fiddles.", bat.status.Id, len(bat.items))
+	for i, item := range bat.items {
+		b.mutex.Lock()
+		res := bat.status.Results[i]
+		res.Status = types.BATCH_RUNNING
+		res.Started = time.Now()
+		b.mutex.Unlock()
+
+		batchItems.Inc(1)
+		done, err := b.run(item)
+		if err != nil {
+			sklog.Warningf("Batch: %s failed to run %q: %s", bat.status.Id, item.Id, err)
+			batchFailures.Inc(1)
+			done = &types.BatchResult{
+				Status:        types.BATCH_FAILURE,
+				Error:         err.Error(),
+				CompileErrors: []types.CompileError{},
+				Outputs:       map[string]string{},
+			}
+		}
+
+		b.mutex.Lock()
+		done.Id = res.Id
+		done.Revision = res.Revision
+		done.Queued = res.Queued
+		done.Started = res.Started
+		done.Finished = time.Now()
+		bat.status.Results[i] = done
+		b.mutex.Unlock()
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	bat.status.Done = true
+	sklog.Infof("Batch: Finished %s.", bat.status.Id)
+}
+
+// run compiles and runs a single item of a batch at its revision and stores
+// the fiddle, along with its outputs if it ran successfully.
+func (b *Batcher) run(item *types.BatchItem) (*types.BatchResult, error) {
+	includes, err := runner.Includes(b.fiddleStore, &item.Options)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load the included fiddles: %s", err)
+	}
+	checkout := filepath.Join(b.fiddleRoot, "versions", item.Revision)
+	tmpDir, err := runner.WriteDrawCpp(checkout, b.fiddleRoot, item.Code, includes, &item.Options)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to write the fiddle: %s", err)
+	}
+	start := time.Now()
+	res, err := runner.Run(checkout, b.fiddleRoot, b.depotTools, item.Revision, b.local, tmpDir, &item.Options)
+	runMs := int64(time.Since(start) / time.Millisecond)
+	if !b.local {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			sklog.Errorf("Failed to remove temp dir: %s", err)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to run the fiddle: %s", err)
+	}
+
+	ret := &types.BatchResult{
+		Status:        types.BATCH_SUCCESS,
+		CompileErrors: []types.CompileError{},
+		Outputs:       map[string]string{},
+		Stderr:        res.Execute.Errors,
+		RunMs:         runMs,
+	}
+	if res.Compile.Errors != "" {
+		ret.CompileErrors = runner.CompileErrors(res.Compile.Output, runner.SourceFiles(includes, &item.Options))
+	}
+	if res.Execute.Errors != "" {
+		ret.RunTimeError = "Failed to run, possibly violated security container."
+	}
+	if res.Execute.Output.Text != "" {
+		stdout, err := base64.StdEncoding.DecodeString(res.Execute.Output.Text)
+		if err != nil {
+			return nil, fmt.Errorf("Text wasn't properly encoded base64: %s", err)
+		}
+		ret.Stdout = string(stdout)
+	}
+
+	ts, err := runner.GitHashTimeStamp(b.fiddleRoot, item.Revision)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find the timestamp of %s: %s", item.Revision, err)
+	}
+	// As with /_/run, only the code is stored for fiddles that fail.
+	if res.Compile.Errors != "" || res.Execute.Errors != "" {
+		res = nil
+	} else {
+		ret.Outputs = bisect.Digests(res)
+	}
+	ret.FiddleHash, err = b.fiddleStore.Put(item.Code, item.Options, item.Revision, ts, res)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to store the fiddle: %s", err)
+	}
+	return ret, nil
+}
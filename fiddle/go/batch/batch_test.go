@@ -0,0 +1,126 @@
+package batch
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.skia.org/infra/fiddle/go/types"
+	"go.skia.org/infra/go/testutils"
+)
+
+func TestResolveRevision(t *testing.T) {
+	testutils.SmallTest(t)
+	available := []string{
+		"aaaa1111aaaa1111aaaa1111aaaa1111aaaa1111",
+		"aaaa2222aaaa2222aaaa2222aaaa2222aaaa2222",
+		"bbbb1111bbbb1111bbbb1111bbbb1111bbbb1111",
+	}
+	current := available[2]
+
+	got, err := resolveRevision("", current, available)
+	assert.NoError(t, err)
+	assert.Equal(t, current, got)
+
+	got, err = resolveRevision("aaaa2", current, available)
+	assert.NoError(t, err)
+	assert.Equal(t, available[1], got)
+
+	got, err = resolveRevision(available[0], current, available)
+	assert.NoError(t, err)
+	assert.Equal(t, available[0], got)
+
+	_, err = resolveRevision("aaaa", current, available)
+	assert.Error(t, err)
+
+	_, err = resolveRevision("cccc", current, available)
+	assert.Error(t, err)
+
+	_, err = resolveRevision("", "", available)
+	assert.Error(t, err)
+}
+
+func TestAllow(t *testing.T) {
+	testutils.SmallTest(t)
+	b := New("", "", true, nil, nil, nil, 1, 10)
+
+	assert.True(t, b.allow("alice", 6))
+	assert.False(t, b.allow("alice", 6))
+	assert.True(t, b.allow("alice", 4))
+
+	// Each client has their own limit.
+	assert.True(t, b.allow("bob", 10))
+	assert.False(t, b.allow("bob", 11))
+
+	// Idle limiters are dropped.
+	b.limiters["alice"].lastUsed = time.Now().Add(-2 * LIMITER_IDLE)
+	assert.True(t, b.allow("bob", 0))
+	_, ok := b.limiters["alice"]
+	assert.False(t, ok)
+}
+
+func TestEnqueue(t *testing.T) {
+	testutils.SmallTest(t)
+	b := New("", "", true, nil, nil, nil, 1, 10)
+	newBatch := func(id string, n int) *batch {
+		return &batch{
+			status: &types.BatchStatus{Id: id},
+			items:  make([]*types.BatchItem, n),
+		}
+	}
+
+	assert.NoError(t, b.enqueue("alice", newBatch("a", 6)))
+	assert.Equal(t, []string{"a"}, b.order)
+	assert.Equal(t, RateLimitedErr, b.enqueue("alice", newBatch("b", 6)))
+	assert.Equal(t, 1, len(b.queue))
+	_, ok := b.batches["b"]
+	assert.False(t, ok)
+
+	// A full queue doesn't charge the rate limit.
+	for i := 1; i < MAX_QUEUED; i++ {
+		b.queue <- newBatch("", 0)
+	}
+	assert.Error(t, b.enqueue("alice", newBatch("c", 4)))
+	<-b.queue
+	assert.NoError(t, b.enqueue("alice", newBatch("d", 4)))
+	assert.Equal(t, []string{"a", "d"}, b.order)
+}
+
+func TestTrim(t *testing.T) {
+	testutils.SmallTest(t)
+	b := New("", "", true, nil, nil, nil, 1, 10)
+	for i := 0; i < MAX_BATCHES+2; i++ {
+		id := fmt.Sprintf("%03d", i)
+		b.batches[id] = &batch{
+			status: &types.BatchStatus{
+				Id:   id,
+				Done: i != 0,
+			},
+		}
+		b.order = append(b.order, id)
+	}
+	b.trim()
+	assert.Equal(t, MAX_BATCHES, len(b.order))
+	assert.Equal(t, MAX_BATCHES, len(b.batches))
+	// The oldest batch isn't done so it is kept.
+	assert.Equal(t, "000", b.order[0])
+	assert.Equal(t, "003", b.order[1])
+}
+
+func TestCopyStatus(t *testing.T) {
+	testutils.SmallTest(t)
+	bat := &batch{
+		status: &types.BatchStatus{
+			Id: "abc",
+			Results: []*types.BatchResult{
+				{Id: "one", Status: types.BATCH_QUEUED},
+			},
+		},
+	}
+	cp := bat.copyStatus()
+	bat.status.Results[0].Status = types.BATCH_RUNNING
+	bat.status.Done = true
+	assert.Equal(t, types.BATCH_QUEUED, cp.Results[0].Status)
+	assert.False(t, cp.Done)
+}
@@ -0,0 +1,440 @@
+// Package bisect finds the first Skia commit at which the output of a fiddle
+// changed, by building and running the fiddle across a range of commits.
+package bisect
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.skia.org/infra/fiddle/go/buildlib"
+	"go.skia.org/infra/fiddle/go/runner"
+	"go.skia.org/infra/fiddle/go/store"
+	"go.skia.org/infra/fiddle/go/types"
+	"go.skia.org/infra/go/buildskia"
+	"go.skia.org/infra/go/git/gitinfo"
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/go/vcsinfo"
+)
+
+// The states a Bisection can be in.
+const (
+	STATUS_QUEUED  = "queued"
+	STATUS_RUNNING = "running"
+	STATUS_SUCCESS = "success"
+	STATUS_FAILURE = "failure"
+)
+
+const (
+	// MAX_COMMITS is the maximum number of commits in the range of a single
+	// bisection.
+	MAX_COMMITS = 2000
+
+	// MAX_QUEUED is the maximum number of bisections waiting to run.
+	MAX_QUEUED = 10
+
+	// MAX_BISECTIONS is the number of bisections kept in memory. Once there
+	// are more than this the oldest finished bisections are dropped.
+	MAX_BISECTIONS = 100
+)
+
+var (
+	bisectTotal    = metrics2.GetCounter("bisect-total", nil)
+	bisectFailures = metrics2.GetCounter("bisect-failures", nil)
+	bisectBuilds   = metrics2.GetCounter("bisect-builds", nil)
+)
+
+// Step is a single commit that the fiddle was run at during a bisection.
+type Step struct {
+	Hash    string   `json:"hash"`
+	Cached  bool     `json:"cached"`  // True if a cached build of Skia was used.
+	Changed []string `json:"changed"` // The outputs that differ from those at the good commit.
+	Skipped bool     `json:"skipped"` // True if the fiddle failed to build or run at this commit.
+	Error   string   `json:"error"`
+}
+
+// Bisection is a search for the first commit in a range at which the output
+// of a fiddle changed.
+type Bisection struct {
+	Id         string    `json:"id"`
+	FiddleHash string    `json:"fiddleHash"`
+	User       string    `json:"user"`
+	Good       string    `json:"good"`
+	Bad        string    `json:"bad"`
+	NumCommits int       `json:"numCommits"` // The number of commits in (Good, Bad].
+	Status     string    `json:"status"`
+	Error      string    `json:"error"`
+	Steps      []*Step   `json:"steps"`
+	Created    time.Time `json:"created"`
+	Finished   time.Time `json:"finished"`
+
+	// The results, only set if Status is STATUS_SUCCESS.
+	LastUnchanged string               `json:"lastUnchanged"`
+	FirstChanged  string               `json:"firstChanged"`
+	Commit        *vcsinfo.ShortCommit `json:"commit"`  // Details of FirstChanged.
+	Changed       []string             `json:"changed"` // The outputs that changed at FirstChanged.
+	Skipped       []string             `json:"skipped"` // Commits between LastUnchanged and FirstChanged that couldn't be tried.
+
+	// commits is the range being bisected, oldest first, starting at Good.
+	commits []string
+
+	// before and after are the results of running the fiddle at
+	// LastUnchanged and FirstChanged.
+	before *types.Result
+	after  *types.Result
+}
+
+// Copy returns a copy of the Bisection suitable for reading while the
+// original continues to be updated.
+func (b *Bisection) Copy() *Bisection {
+	ret := &Bisection{}
+	*ret = *b
+	ret.Steps = make([]*Step, 0, len(b.Steps))
+	for _, s := range b.Steps {
+		step := *s
+		step.Changed = util.CopyStringSlice(s.Changed)
+		ret.Steps = append(ret.Steps, &step)
+	}
+	if b.Commit != nil {
+		commit := *b.Commit
+		ret.Commit = &commit
+	}
+	ret.Changed = util.CopyStringSlice(b.Changed)
+	ret.Skipped = util.CopyStringSlice(b.Skipped)
+	return ret
+}
+
+// Done returns true if the bisection has finished, successfully or not.
+func (b *Bisection) Done() bool {
+	return b.Status == STATUS_SUCCESS || b.Status == STATUS_FAILURE
+}
+
+// bisectionId returns the id of a bisection of the given fiddle between the
+// given full git hashes.
+func bisectionId(fiddleHash, good, bad string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(fiddleHash+":"+good+":"+bad)))[:16]
+}
+
+// Bisector runs bisections one at a time, since each may need to build Skia
+// at many commits, and keeps the most recent ones in memory.
+type Bisector struct {
+	fiddleRoot  string
+	depotTools  string
+	local       bool
+	repo        *gitinfo.GitInfo
+	builds      *buildskia.ContinuousBuilder
+	fiddleStore *store.Store
+
+	queue chan *Bisection
+
+	// mutex protects bisections, order, and the contents of each Bisection.
+	mutex      sync.Mutex
+	bisections map[string]*Bisection
+	order      []string // Bisection ids, oldest first.
+}
+
+// New returns a new Bisector.
+//
+//    fiddleRoot - The root of the fiddle working directory. See DESIGN.md.
+//    depotTools - The directory where depot_tools is checked out.
+//    local - True if running locally, see runner.Run.
+//    repo - A checkout of Skia used to find the commits to bisect.
+//    builds - The builder whose cached builds are preferred when bisecting.
+//    fiddleStore - Where to find the code of fiddles.
+//
+// Call Start() to begin running bisections.
+func New(fiddleRoot, depotTools string, local bool, repo *gitinfo.GitInfo, builds *buildskia.ContinuousBuilder, fiddleStore *store.Store) *Bisector {
+	return &Bisector{
+		fiddleRoot:  fiddleRoot,
+		depotTools:  depotTools,
+		local:       local,
+		repo:        repo,
+		builds:      builds,
+		fiddleStore: fiddleStore,
+		queue:       make(chan *Bisection, MAX_QUEUED),
+		bisections:  map[string]*Bisection{},
+		order:       []string{},
+	}
+}
+
+// Start the Go routine that runs queued bisections.
+func (b *Bisector) Start() {
+	go func() {
+		for bis := range b.queue {
+			b.bisect(bis)
+		}
+	}()
+}
+
+// Add queues a bisection of the fiddle with the given hash, looking for the
+// first commit in (good, bad] at which its output differs from that at good.
+// If the same bisection has already been added, and didn't fail, then it is
+// returned instead of starting a new one.
+func (b *Bisector) Add(fiddleHash, good, bad, user string) (*Bisection, error) {
+	_, opts, err := b.fiddleStore.GetCode(fiddleHash)
+	if err != nil {
+		return nil, fmt.Errorf("Fiddle not found.")
+	}
+	if opts.Animated {
+		return nil, fmt.Errorf("Animated fiddles can't be bisected.")
+	}
+	good, err = b.repo.FullHash(good)
+	if err != nil {
+		return nil, fmt.Errorf("Unknown good commit: %s", err)
+	}
+	bad, err = b.repo.FullHash(bad)
+	if err != nil {
+		return nil, fmt.Errorf("Unknown bad commit: %s", err)
+	}
+	if good == bad || !b.repo.IsAncestor(good, bad) {
+		return nil, fmt.Errorf("The good commit must be an ancestor of the bad commit.")
+	}
+	commits, err := b.repo.RevList("--first-parent", "--reverse", good+".."+bad)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list commits: %s", err)
+	}
+	if len(commits) > MAX_COMMITS {
+		return nil, fmt.Errorf("Too many commits to bisect: %d > %d", len(commits), MAX_COMMITS)
+	}
+
+	id := bisectionId(fiddleHash, good, bad)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if existing, ok := b.bisections[id]; ok && existing.Status != STATUS_FAILURE {
+		return existing.Copy(), nil
+	}
+	bis := &Bisection{
+		Id:         id,
+		FiddleHash: fiddleHash,
+		User:       user,
+		Good:       good,
+		Bad:        bad,
+		NumCommits: len(commits),
+		Status:     STATUS_QUEUED,
+		Steps:      []*Step{},
+		Created:    time.Now(),
+		commits:    append([]string{good}, commits...),
+	}
+	select {
+	case b.queue <- bis:
+	default:
+		return nil, fmt.Errorf("Too many bisections are queued, try again later.")
+	}
+	if _, ok := b.bisections[id]; !ok {
+		b.order = append(b.order, id)
+	}
+	b.bisections[id] = bis
+	b.trim()
+	return bis.Copy(), nil
+}
+
+// trim drops the oldest finished bisections once there are more than
+// MAX_BISECTIONS.
+//
+// trim presumes the caller already has a lock on the mutex.
+func (b *Bisector) trim() {
+	order := []string{}
+	excess := len(b.order) - MAX_BISECTIONS
+	for _, id := range b.order {
+		if excess > 0 && b.bisections[id].Done() {
+			delete(b.bisections, id)
+			excess--
+			continue
+		}
+		order = append(order, id)
+	}
+	b.order = order
+}
+
+// Get returns a copy of the bisection with the given id.
+func (b *Bisector) Get(id string) (*Bisection, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	bis, ok := b.bisections[id]
+	if !ok {
+		return nil, fmt.Errorf("Unknown bisection: %s", id)
+	}
+	return bis.Copy(), nil
+}
+
+// List returns copies of all the bisections, newest first.
+func (b *Bisector) List() []*Bisection {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	ret := make([]*Bisection, 0, len(b.order))
+	for i := len(b.order) - 1; i >= 0; i-- {
+		ret = append(ret, b.bisections[b.order[i]].Copy())
+	}
+	return ret
+}
+
+// Media returns the given output of the fiddle at the last unchanged commit,
+// or at the first changed commit if 'after' is true, of a successful
+// bisection. Returns the media and its content type.
+func (b *Bisector) Media(id string, after bool, media store.Media) ([]byte, string, error) {
+	b.mutex.Lock()
+	bis, ok := b.bisections[id]
+	var res *types.Result
+	if ok {
+		res = bis.before
+		if after {
+			res = bis.after
+		}
+	}
+	b.mutex.Unlock()
+	if res == nil {
+		return nil, "", fmt.Errorf("No results for bisection: %s", id)
+	}
+	var b64 string
+	contentType := "image/png"
+	switch media {
+	case store.CPU:
+		b64 = res.Execute.Output.Raster
+	case store.GPU:
+		b64 = res.Execute.Output.Gpu
+	case store.PDF:
+		b64 = res.Execute.Output.Pdf
+		contentType = "application/pdf"
+	case store.TXT:
+		b64 = res.Execute.Output.Text
+		contentType = "text/plain"
+	default:
+		return nil, "", fmt.Errorf("Unsupported media for bisection: %s", media)
+	}
+	body, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, "", fmt.Errorf("Media wasn't properly encoded base64: %s", err)
+	}
+	return body, contentType, nil
+}
+
+// cachedBuilds returns the set of git hashes that have complete builds under
+// fiddleRoot/versions.
+func (b *Bisector) cachedBuilds() map[string]bool {
+	ret := map[string]bool{}
+	hashes, err := b.builds.AvailableBuilds()
+	if err != nil {
+		sklog.Errorf("Failed to list available builds: %s", err)
+		return ret
+	}
+	for _, h := range hashes {
+		ret[h] = true
+	}
+	return ret
+}
+
+// build checks out and builds Skia at the given git hash into
+// fiddleRoot/versions/<gitHash>, just like the builds done by
+// buildskia.ContinuousBuilder.
+func (b *Bisector) build(gitHash string) error {
+	sklog.Infof("Bisect: Building %s", gitHash)
+	bisectBuilds.Inc(1)
+	checkout := filepath.Join(b.fiddleRoot, "versions", gitHash)
+	if _, err := buildskia.GNDownloadSkia("", gitHash, checkout, b.depotTools, false, false); err != nil {
+		return fmt.Errorf("Failed to fetch: %s", err)
+	}
+	return buildlib.BuildLib(checkout, b.depotTools)
+}
+
+// runAt runs the given fiddle at the given git hash, which must already be
+// built.
+func (b *Bisector) runAt(code string, includes []types.File, opts *types.Options, gitHash string) (*types.Result, error) {
+	checkout := filepath.Join(b.fiddleRoot, "versions", gitHash)
+	tmpDir, err := runner.WriteDrawCpp(checkout, b.fiddleRoot, code, includes, opts)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to write the fiddle: %s", err)
+	}
+	defer func() {
+		if !b.local {
+			if err := os.RemoveAll(tmpDir); err != nil {
+				sklog.Errorf("Failed to remove temp dir: %s", err)
+			}
+		}
+	}()
+	return runner.Run(checkout, b.fiddleRoot, b.depotTools, gitHash, b.local, tmpDir, opts)
+}
+
+// bisect runs a single bisection to completion.
+func (b *Bisector) bisect(bis *Bisection) {
+	bisectTotal.Inc(1)
+	b.mutex.Lock()
+	bis.Status = STATUS_RUNNING
+	b.mutex.Unlock()
+	sklog.Infof("Bisect: Starting %s for fiddle %s in %s..%s", bis.Id, bis.FiddleHash, bis.Good, bis.Bad)
+
+	res, err := b.search(bis)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	bis.Finished = time.Now()
+	if err != nil {
+		sklog.Errorf("Bisect: %s failed: %s", bis.Id, err)
+		bisectFailures.Inc(1)
+		bis.Status = STATUS_FAILURE
+		bis.Error = err.Error()
+		return
+	}
+	bis.Status = STATUS_SUCCESS
+	bis.LastUnchanged = bis.commits[res.lastUnchanged]
+	bis.FirstChanged = bis.commits[res.firstChanged]
+	bis.Changed = res.changed
+	bis.Skipped = util.CopyStringSlice(bis.commits[res.lastUnchanged+1 : res.firstChanged])
+	bis.before = res.before
+	bis.after = res.after
+	if details, err := b.repo.Details(bis.FirstChanged, false); err != nil {
+		sklog.Errorf("Failed to retrieve details of %s: %s", bis.FirstChanged, err)
+	} else {
+		bis.Commit = details.ShortCommit
+	}
+	sklog.Infof("Bisect: %s finished, first changed at %s: %v", bis.Id, bis.FirstChanged, bis.Changed)
+}
+
+// search finds the commit at which the fiddle output changed, building Skia
+// as needed. Skia checkouts built just for this bisection are removed
+// afterwards.
+func (b *Bisector) search(bis *Bisection) (*searchResult, error) {
+	code, opts, err := b.fiddleStore.GetCode(bis.FiddleHash)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load the fiddle: %s", err)
+	}
+	includes, err := runner.Includes(b.fiddleStore, opts)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load the included fiddles: %s", err)
+	}
+	cached := b.cachedBuilds()
+	built := []string{}
+	defer func() {
+		// Don't remove any checkouts that became cached builds while we ran.
+		stillCached := b.cachedBuilds()
+		for _, hash := range built {
+			if stillCached[hash] {
+				continue
+			}
+			if err := os.RemoveAll(filepath.Join(b.fiddleRoot, "versions", hash)); err != nil {
+				sklog.Errorf("Failed to remove checkout for %s: %s", hash, err)
+			}
+		}
+	}()
+	run := func(gitHash string) (*types.Result, error) {
+		if !cached[gitHash] {
+			built = append(built, gitHash)
+			if err := b.build(gitHash); err != nil {
+				return nil, fmt.Errorf("Failed to build Skia: %s", err)
+			}
+		}
+		return b.runAt(code, includes, opts, gitHash)
+	}
+	step := func(s *Step) {
+		sklog.Infof("Bisect: %s at %s changed: %v skipped: %v", bis.Id, s.Hash, s.Changed, s.Skipped)
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		bis.Steps = append(bis.Steps, s)
+	}
+	return search(bis.commits, cached, run, step)
+}
@@ -0,0 +1,173 @@
+package bisect
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+
+	"go.skia.org/infra/fiddle/go/types"
+)
+
+// The names of the outputs of a fiddle that are compared by Diff.
+const (
+	OUTPUT_RASTER = "raster"
+	OUTPUT_GPU    = "gpu"
+	OUTPUT_PDF    = "pdf"
+	OUTPUT_TEXT   = "text"
+	OUTPUT_ERRORS = "errors"
+)
+
+// failed returns true if the fiddle failed to compile or run.
+func failed(r *types.Result) bool {
+	return r.Errors != "" || r.Compile.Errors != "" || r.Execute.Errors != ""
+}
+
+// decodePNG decodes a base64 encoded PNG as emitted by fiddle_run.
+func decodePNG(b64 string) (image.Image, error) {
+	b, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode base64: %s", err)
+	}
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode PNG: %s", err)
+	}
+	return img, nil
+}
+
+// PixelDiff returns the number of pixels that differ between the two base64
+// encoded PNGs. If the images are of different sizes then every pixel of the
+// larger image is counted as different.
+func PixelDiff(a, b string) (int, error) {
+	imgA, err := decodePNG(a)
+	if err != nil {
+		return 0, err
+	}
+	imgB, err := decodePNG(b)
+	if err != nil {
+		return 0, err
+	}
+	boundsA := imgA.Bounds()
+	boundsB := imgB.Bounds()
+	if boundsA.Size() != boundsB.Size() {
+		sizeA := boundsA.Dx() * boundsA.Dy()
+		sizeB := boundsB.Dx() * boundsB.Dy()
+		if sizeA > sizeB {
+			return sizeA, nil
+		}
+		return sizeB, nil
+	}
+	n := 0
+	for y := 0; y < boundsA.Dy(); y++ {
+		for x := 0; x < boundsA.Dx(); x++ {
+			ca := color.NRGBAModel.Convert(imgA.At(boundsA.Min.X+x, boundsA.Min.Y+y))
+			cb := color.NRGBAModel.Convert(imgB.At(boundsB.Min.X+x, boundsB.Min.Y+y))
+			if ca != cb {
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+// samePNG returns true if the two base64 encoded PNGs have identical pixels.
+// PNGs that can't be decoded are only the same if they're byte-for-byte
+// identical.
+func samePNG(a, b string) bool {
+	if a == b {
+		return true
+	}
+	n, err := PixelDiff(a, b)
+	if err != nil {
+		return false
+	}
+	return n == 0
+}
+
+// Diff returns the names of the outputs, i.e. OUTPUT_RASTER, etc., that
+// differ between the two results of running a fiddle.
+//
+// The PNG outputs are compared pixel-wise so that changes in PNG encoding
+// aren't reported, while the PDF and text outputs are compared byte-wise. If
+// exactly one of the fiddles failed to compile or run then only OUTPUT_ERRORS
+// is returned, and if both failed then they are considered the same.
+func Diff(a, b *types.Result) []string {
+	failedA, failedB := failed(a), failed(b)
+	if failedA || failedB {
+		if failedA != failedB {
+			return []string{OUTPUT_ERRORS}
+		}
+		return []string{}
+	}
+	outA := a.Execute.Output
+	outB := b.Execute.Output
+	ret := []string{}
+	if !samePNG(outA.Raster, outB.Raster) {
+		ret = append(ret, OUTPUT_RASTER)
+	}
+	if !samePNG(outA.Gpu, outB.Gpu) {
+		ret = append(ret, OUTPUT_GPU)
+	}
+	if outA.Pdf != outB.Pdf {
+		ret = append(ret, OUTPUT_PDF)
+	}
+	if outA.Text != outB.Text {
+		ret = append(ret, OUTPUT_TEXT)
+	}
+	return ret
+}
+
+// pixelDigest returns the md5 of the pixels of the base64 encoded PNG, along
+// with its dimensions, so that two PNGs have the same digest iff PixelDiff
+// reports no differences between them.
+func pixelDigest(b64 string) (string, error) {
+	img, err := decodePNG(b64)
+	if err != nil {
+		return "", err
+	}
+	bounds := img.Bounds()
+	h := md5.New()
+	if _, err := fmt.Fprintf(h, "%dx%d:", bounds.Dx(), bounds.Dy()); err != nil {
+		return "", fmt.Errorf("Failed to write md5: %s", err)
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if _, err := h.Write([]byte{c.R, c.G, c.B, c.A}); err != nil {
+				return "", fmt.Errorf("Failed to write md5: %s", err)
+			}
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// Digests returns a digest of each of the outputs, i.e. OUTPUT_RASTER, etc.,
+// of the result of running a fiddle, so that results can be compared without
+// keeping all their outputs around. An output is only present if it isn't
+// empty, and OUTPUT_ERRORS is never present. For two results that both
+// compiled and ran, an output's digests differ iff Diff reports that output.
+func Digests(r *types.Result) map[string]string {
+	ret := map[string]string{}
+	out := r.Execute.Output
+	for name, b64 := range map[string]string{OUTPUT_RASTER: out.Raster, OUTPUT_GPU: out.Gpu} {
+		if b64 == "" {
+			continue
+		}
+		digest, err := pixelDigest(b64)
+		if err != nil {
+			digest = fmt.Sprintf("%x", md5.Sum([]byte(b64)))
+		}
+		ret[name] = digest
+	}
+	for name, b64 := range map[string]string{OUTPUT_PDF: out.Pdf, OUTPUT_TEXT: out.Text} {
+		if b64 == "" {
+			continue
+		}
+		ret[name] = fmt.Sprintf("%x", md5.Sum([]byte(b64)))
+	}
+	return ret
+}
@@ -0,0 +1,113 @@
+package bisect
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.skia.org/infra/fiddle/go/types"
+	"go.skia.org/infra/go/testutils"
+)
+
+// encodePNG returns a base64 encoded PNG of the given size filled with c.
+func encodePNG(t *testing.T, w, h int, c color.Color, level png.CompressionLevel) string {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: level}
+	assert.NoError(t, enc.Encode(&buf, img))
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestPixelDiff(t *testing.T) {
+	testutils.SmallTest(t)
+	red := encodePNG(t, 4, 4, color.NRGBA{255, 0, 0, 255}, png.DefaultCompression)
+	redUncompressed := encodePNG(t, 4, 4, color.NRGBA{255, 0, 0, 255}, png.NoCompression)
+	blue := encodePNG(t, 4, 4, color.NRGBA{0, 0, 255, 255}, png.DefaultCompression)
+	big := encodePNG(t, 8, 8, color.NRGBA{255, 0, 0, 255}, png.DefaultCompression)
+
+	assert.NotEqual(t, red, redUncompressed)
+	n, err := PixelDiff(red, redUncompressed)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = PixelDiff(red, blue)
+	assert.NoError(t, err)
+	assert.Equal(t, 16, n)
+
+	n, err = PixelDiff(red, big)
+	assert.NoError(t, err)
+	assert.Equal(t, 64, n)
+
+	_, err = PixelDiff(red, "not base64!")
+	assert.Error(t, err)
+}
+
+func TestDiff(t *testing.T) {
+	testutils.SmallTest(t)
+	red := encodePNG(t, 4, 4, color.NRGBA{255, 0, 0, 255}, png.DefaultCompression)
+	redUncompressed := encodePNG(t, 4, 4, color.NRGBA{255, 0, 0, 255}, png.NoCompression)
+	blue := encodePNG(t, 4, 4, color.NRGBA{0, 0, 255, 255}, png.DefaultCompression)
+
+	result := func(raster, gpu, pdf, text string) *types.Result {
+		return &types.Result{
+			Execute: types.Execute{
+				Output: types.Output{
+					Raster: raster,
+					Gpu:    gpu,
+					Pdf:    pdf,
+					Text:   text,
+				},
+			},
+		}
+	}
+
+	a := result(red, red, "pdf", "")
+	assert.Equal(t, []string{}, Diff(a, result(redUncompressed, red, "pdf", "")))
+	assert.Equal(t, []string{OUTPUT_RASTER}, Diff(a, result(blue, red, "pdf", "")))
+	assert.Equal(t, []string{OUTPUT_GPU, OUTPUT_PDF}, Diff(a, result(red, blue, "pdf2", "")))
+	assert.Equal(t, []string{OUTPUT_TEXT}, Diff(result("", "", "", "aGk="), result("", "", "", "aG8=")))
+
+	// Failures to compile or run.
+	compileFailed := result("", "", "", "")
+	compileFailed.Compile.Errors = "error: expected ';'"
+	runFailed := result("", "", "", "")
+	runFailed.Execute.Errors = "Segmentation fault"
+	assert.Equal(t, []string{OUTPUT_ERRORS}, Diff(a, compileFailed))
+	assert.Equal(t, []string{OUTPUT_ERRORS}, Diff(runFailed, a))
+	assert.Equal(t, []string{}, Diff(compileFailed, runFailed))
+}
+
+func TestDigests(t *testing.T) {
+	testutils.SmallTest(t)
+	red := encodePNG(t, 4, 4, color.NRGBA{255, 0, 0, 255}, png.DefaultCompression)
+	redUncompressed := encodePNG(t, 4, 4, color.NRGBA{255, 0, 0, 255}, png.NoCompression)
+	blue := encodePNG(t, 4, 4, color.NRGBA{0, 0, 255, 255}, png.DefaultCompression)
+
+	result := func(raster, text string) *types.Result {
+		return &types.Result{
+			Execute: types.Execute{
+				Output: types.Output{
+					Raster: raster,
+					Text:   text,
+				},
+			},
+		}
+	}
+	d := Digests(result(red, ""))
+	assert.Equal(t, 1, len(d))
+	assert.Equal(t, d, Digests(result(redUncompressed, "")))
+	assert.NotEqual(t, d[OUTPUT_RASTER], Digests(result(blue, ""))[OUTPUT_RASTER])
+
+	d = Digests(result("", "aGk="))
+	assert.Equal(t, 1, len(d))
+	assert.NotEqual(t, d[OUTPUT_TEXT], Digests(result("", "aG8="))[OUTPUT_TEXT])
+}
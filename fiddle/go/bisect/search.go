@@ -0,0 +1,144 @@
+package bisect
+
+import (
+	"fmt"
+
+	"go.skia.org/infra/fiddle/go/types"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+)
+
+const (
+	// CACHED_BUILD_SLACK controls how far from the midpoint of the remaining
+	// range a cached build may be and still be tried in preference to the
+	// midpoint, as a fraction of the width of the range. Trying a cached build
+	// only costs a run, while any other commit needs a full build of Skia.
+	CACHED_BUILD_SLACK = 4
+)
+
+// runFunc runs the fiddle at the given Skia git hash.
+type runFunc func(gitHash string) (*types.Result, error)
+
+// searchResult is the outcome of a successful search.
+type searchResult struct {
+	// lastUnchanged and firstChanged are indices into the commits that were
+	// searched.
+	lastUnchanged int
+	firstChanged  int
+
+	// before and after are the results of running the fiddle at
+	// lastUnchanged and firstChanged.
+	before *types.Result
+	after  *types.Result
+
+	// changed are the outputs that differ between before and after.
+	changed []string
+}
+
+// pickNext returns the index of the next commit to try in the open range
+// (lo, hi), or -1 if every commit in the range has been skipped.
+//
+// The commit closest to the midpoint of the range is chosen, unless there is a
+// cached build within 1/CACHED_BUILD_SLACK of the range of the midpoint, in
+// which case the closest cached build is chosen.
+func pickNext(commits []string, lo, hi int, cached map[string]bool, skipped map[int]bool) int {
+	mid := (lo + hi) / 2
+	slack := (hi - lo) / CACHED_BUILD_SLACK
+	best := -1
+	bestCached := -1
+	for i := lo + 1; i < hi; i++ {
+		if skipped[i] {
+			continue
+		}
+		dist := util.AbsInt(i - mid)
+		if best == -1 || dist < util.AbsInt(best-mid) {
+			best = i
+		}
+		if cached[commits[i]] && dist <= slack && (bestCached == -1 || dist < util.AbsInt(bestCached-mid)) {
+			bestCached = i
+		}
+	}
+	if bestCached != -1 {
+		return bestCached
+	}
+	return best
+}
+
+// search does a binary search for the first commit at which the output of a
+// fiddle differs from its output at commits[0].
+//
+//    commits - The commits to search, oldest first. The first is the known
+//        good commit and the last the known bad commit.
+//    cached - The set of git hashes that have cached builds.
+//    run - Runs the fiddle at a given git hash.
+//    step - Called with each commit the fiddle was run at.
+//
+// Commits where the fiddle fails to build or run are skipped, so if every
+// commit in between the returned lastUnchanged and firstChanged was skipped
+// then the change may have happened at any one of them.
+func search(commits []string, cached map[string]bool, run runFunc, step func(*Step)) (*searchResult, error) {
+	if len(commits) < 2 {
+		return nil, fmt.Errorf("At least two commits are needed to bisect.")
+	}
+	try := func(i int) (*types.Result, error) {
+		res, err := run(commits[i])
+		if err != nil {
+			step(&Step{
+				Hash:    commits[i],
+				Cached:  cached[commits[i]],
+				Skipped: true,
+				Error:   err.Error(),
+			})
+		}
+		return res, err
+	}
+
+	lo := 0
+	hi := len(commits) - 1
+	before, err := try(lo)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to run the fiddle at the good commit %s: %s", commits[lo], err)
+	}
+	step(&Step{Hash: commits[lo], Cached: cached[commits[lo]], Changed: []string{}})
+	baseline := before
+
+	after, err := try(hi)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to run the fiddle at the bad commit %s: %s", commits[hi], err)
+	}
+	changed := Diff(baseline, after)
+	step(&Step{Hash: commits[hi], Cached: cached[commits[hi]], Changed: changed})
+	if len(changed) == 0 {
+		return nil, fmt.Errorf("The fiddle output is the same at %s and %s.", commits[lo], commits[hi])
+	}
+
+	skipped := map[int]bool{}
+	for {
+		i := pickNext(commits, lo, hi, cached, skipped)
+		if i == -1 {
+			break
+		}
+		res, err := try(i)
+		if err != nil {
+			sklog.Warningf("Skipping %s: %s", commits[i], err)
+			skipped[i] = true
+			continue
+		}
+		changed := Diff(baseline, res)
+		step(&Step{Hash: commits[i], Cached: cached[commits[i]], Changed: changed})
+		if len(changed) == 0 {
+			lo = i
+			before = res
+		} else {
+			hi = i
+			after = res
+		}
+	}
+	return &searchResult{
+		lastUnchanged: lo,
+		firstChanged:  hi,
+		before:        before,
+		after:         after,
+		changed:       Diff(before, after),
+	}, nil
+}
@@ -0,0 +1,129 @@
+package bisect
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.skia.org/infra/fiddle/go/types"
+	"go.skia.org/infra/go/testutils"
+)
+
+// fakeRun returns a runFunc where the text output of the fiddle is "old"
+// before commits[changeAt] and "new" from then on. Running at any commit in
+// broken returns an error. Every git hash run is appended to ran.
+func fakeRun(commits []string, changeAt int, broken map[string]bool, ran *[]string) runFunc {
+	return func(gitHash string) (*types.Result, error) {
+		*ran = append(*ran, gitHash)
+		if broken[gitHash] {
+			return nil, fmt.Errorf("Failed to build.")
+		}
+		text := "old"
+		for i, c := range commits {
+			if c == gitHash && i >= changeAt {
+				text = "new"
+			}
+		}
+		return &types.Result{
+			Execute: types.Execute{
+				Output: types.Output{
+					Text: text,
+				},
+			},
+		}, nil
+	}
+}
+
+func makeCommits(n int) []string {
+	ret := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		ret = append(ret, fmt.Sprintf("%040d", i))
+	}
+	return ret
+}
+
+func TestSearch(t *testing.T) {
+	testutils.SmallTest(t)
+	commits := makeCommits(100)
+	for _, changeAt := range []int{1, 2, 37, 50, 98, 99} {
+		ran := []string{}
+		steps := []*Step{}
+		res, err := search(commits, map[string]bool{}, fakeRun(commits, changeAt, nil, &ran), func(s *Step) {
+			steps = append(steps, s)
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, changeAt-1, res.lastUnchanged)
+		assert.Equal(t, changeAt, res.firstChanged)
+		assert.Equal(t, []string{OUTPUT_TEXT}, res.changed)
+		assert.Equal(t, "old", res.before.Execute.Output.Text)
+		assert.Equal(t, "new", res.after.Execute.Output.Text)
+		assert.Equal(t, len(ran), len(steps))
+		// Both ends plus a binary search over the 98 commits in between.
+		assert.True(t, len(ran) <= 2+8, fmt.Sprintf("Ran %d times", len(ran)))
+	}
+}
+
+func TestSearchNoChange(t *testing.T) {
+	testutils.SmallTest(t)
+	commits := makeCommits(10)
+	ran := []string{}
+	_, err := search(commits, map[string]bool{}, fakeRun(commits, 10, nil, &ran), func(*Step) {})
+	assert.Error(t, err)
+	assert.Equal(t, []string{commits[0], commits[9]}, ran)
+}
+
+func TestSearchSkipsBroken(t *testing.T) {
+	testutils.SmallTest(t)
+	commits := makeCommits(10)
+	broken := map[string]bool{
+		commits[3]: true,
+		commits[4]: true,
+	}
+	ran := []string{}
+	steps := []*Step{}
+	res, err := search(commits, map[string]bool{}, fakeRun(commits, 4, broken, &ran), func(s *Step) {
+		steps = append(steps, s)
+	})
+	assert.NoError(t, err)
+	// The change could have happened at commits 3 or 4, but neither can be
+	// run, so the range can't be narrowed further.
+	assert.Equal(t, 2, res.lastUnchanged)
+	assert.Equal(t, 5, res.firstChanged)
+	skipped := 0
+	for _, s := range steps {
+		if s.Skipped {
+			skipped++
+			assert.Equal(t, "Failed to build.", s.Error)
+		}
+	}
+	assert.Equal(t, 2, skipped)
+
+	// A broken good commit is an error.
+	_, err = search(commits, map[string]bool{}, fakeRun(commits, 4, map[string]bool{commits[0]: true}, &ran), func(*Step) {})
+	assert.Error(t, err)
+}
+
+func TestPickNext(t *testing.T) {
+	testutils.SmallTest(t)
+	commits := makeCommits(101)
+	noCache := map[string]bool{}
+	noSkips := map[int]bool{}
+
+	// The midpoint is chosen if there are no cached builds.
+	assert.Equal(t, 50, pickNext(commits, 0, 100, noCache, noSkips))
+
+	// Cached builds near the midpoint are preferred.
+	cached := map[string]bool{
+		commits[40]: true,
+		commits[70]: true,
+		commits[90]: true,
+	}
+	assert.Equal(t, 40, pickNext(commits, 0, 100, cached, noSkips))
+	// But not those too far from it.
+	assert.Equal(t, 50, pickNext(commits, 0, 100, map[string]bool{commits[90]: true}, noSkips))
+
+	// Skipped commits are never chosen.
+	assert.Equal(t, 51, pickNext(commits, 49, 52, noCache, map[int]bool{50: true}))
+	assert.Equal(t, -1, pickNext(commits, 49, 52, noCache, map[int]bool{50: true, 51: true}))
+	assert.Equal(t, -1, pickNext(commits, 49, 50, noCache, noSkips))
+}
@@ -8,10 +8,10 @@ import (
 	"fmt"
 	"html/template"
 	ttemplate "html/template"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 	"sync"
@@ -20,9 +20,12 @@ import (
 	_ "net/http/pprof"
 
 	"github.com/gorilla/mux"
+	"go.skia.org/infra/fiddle/go/batch"
+	"go.skia.org/infra/fiddle/go/bisect"
 	"go.skia.org/infra/fiddle/go/buildlib"
 	"go.skia.org/infra/fiddle/go/buildsecwrap"
 	"go.skia.org/infra/fiddle/go/named"
+	"go.skia.org/infra/fiddle/go/regression"
 	"go.skia.org/infra/fiddle/go/runner"
 	"go.skia.org/infra/fiddle/go/source"
 	"go.skia.org/infra/fiddle/go/store"
@@ -39,18 +42,31 @@ import (
 
 const (
 	FIDDLE_HASH_LENGTH = 32
+
+	// REGRESSION_PERIOD is how often to check for a new build of Skia to run
+	// the named regression suite against.
+	REGRESSION_PERIOD = 5 * time.Minute
+
+	// CLIENT_ADDR_HEADER is the header in which the proxy passes on the
+	// address of the client.
+	CLIENT_ADDR_HEADER = "X-Real-IP"
 )
 
 // flags
 var (
-	fiddleRoot        = flag.String("fiddle_root", "", "Directory location where all the work is done.")
-	local             = flag.Bool("local", false, "Running locally if true. As opposed to in production.")
-	promPort          = flag.String("prom_port", ":20000", "Metrics service address (e.g., ':10110')")
-	port              = flag.String("port", ":8000", "HTTP service address (e.g., ':8000')")
-	preserveTemp      = flag.Bool("preserve_temp", false, "If true then preserve the build artifacts in the fiddle/tmp directory. Used for debugging only.")
-	resourcesDir      = flag.String("resources_dir", "", "The directory to find templates, JS, and CSS files. If blank the current directory will be used.")
-	timeBetweenBuilds = flag.Duration("time_between_builds", time.Hour, "How long to wait between building LKGR of Skia.")
-	tryNamed          = flag.Bool("try_named", true, "Start the Go routine that periodically tries all the named fiddles.")
+	batchBurst          = flag.Int("batch_burst", batch.MAX_ITEMS, "The number of fiddles a single client may submit at once through the batch API.")
+	batchPerMinute      = flag.Float64("batch_per_minute", 30, "The number of fiddles per minute a single client may run through the batch API.")
+	fiddleRoot          = flag.String("fiddle_root", "", "Directory location where all the work is done.")
+	local               = flag.Bool("local", false, "Running locally if true. As opposed to in production.")
+	namedRegression     = flag.Bool("named_regression", true, "Run the named fiddles against every new build of Skia and report the ones whose output changed.")
+	namedRegressionGold = flag.Bool("named_regression_gold", false, "Upload the outputs of the named regression suite for ingestion by Gold.")
+	namedRegressionTag  = flag.String("named_regression_tag", "", "If set, only the named fiddles with this tag are run by the named regression suite.")
+	promPort            = flag.String("prom_port", ":20000", "Metrics service address (e.g., ':10110')")
+	port                = flag.String("port", ":8000", "HTTP service address (e.g., ':8000')")
+	preserveTemp        = flag.Bool("preserve_temp", false, "If true then preserve the build artifacts in the fiddle/tmp directory. Used for debugging only.")
+	resourcesDir        = flag.String("resources_dir", "", "The directory to find templates, JS, and CSS files. If blank the current directory will be used.")
+	timeBetweenBuilds   = flag.Duration("time_between_builds", time.Hour, "How long to wait between building LKGR of Skia.")
+	tryNamed            = flag.Bool("try_named", true, "Start the Go routine that periodically tries all the named fiddles.")
 )
 
 var (
@@ -63,6 +79,14 @@ var (
 			}
 			return s
 		},
+		"json": func(v interface{}) string {
+			b, err := json.Marshal(v)
+			if err != nil {
+				sklog.Errorf("Failed to encode %v as JSON: %s", v, err)
+				return ""
+			}
+			return string(b)
+		},
 	}
 
 	defaultFiddle *types.FiddleContext = &types.FiddleContext{
@@ -91,35 +115,15 @@ var (
 		".skp":        store.SKP,
 	}
 
-	// parseCompilerOutput parses the compiler output to look for lines
-	// that begin with "draw.cpp:<N>:<M>:" where N and M are the line and column
-	// number where the error occurred. It also strips off the full path name
-	// of draw.cpp.
-	//
-	// For example if we had the following input line:
-	//
-	//    "/usr/local../src/draw.cpp:8:5: error: expected ‘)’ before ‘canvas’\n void draw(SkCanvas* canvas) {\n     ^\n"
-	//
-	// Then the re.FindAllStringSubmatch(s, -1) will return a match of the form:
-	//
-	//    [][]string{
-	//      []string{
-	//        "/usr/local.../src/draw.cpp:8:5: error: expected ‘)’ before ‘canvas’",
-	//        "/usr/local.../src/",
-	//        "draw.cpp:8:5: error: expected ‘)’ before ‘canvas’",
-	//        "8",
-	//        "5",
-	//      },
-	//    }
-	//
-	// Note that slice items 2, 3, and 4 are the ones we are really interested in.
-	parseCompilerOutput = regexp.MustCompile("^(.*/)(draw.cpp:([0-9]+):([-0-9]+):.*)")
-	namedFailures       = metrics2.GetCounter("named-failures", nil)
-	maybeSecViolations  = metrics2.GetCounter("maybe-sec-container-violation", nil)
-	runs                = metrics2.GetCounter("runs", nil)
-	tryNamedLiveness    = metrics2.NewLiveness("try-named")
+	namedFailures      = metrics2.GetCounter("named-failures", nil)
+	maybeSecViolations = metrics2.GetCounter("maybe-sec-container-violation", nil)
+	runs               = metrics2.GetCounter("runs", nil)
+	tryNamedLiveness   = metrics2.NewLiveness("try-named")
 
 	build        *buildskia.ContinuousBuilder
+	batcher      *batch.Batcher
+	bisector     *bisect.Bisector
+	suite        *regression.Suite
 	fiddleStore  *store.Store
 	repo         *gitinfo.GitInfo
 	src          *source.Source
@@ -135,6 +139,9 @@ func loadTemplates() {
 		filepath.Join(*resourcesDir, "templates/iframe.html"),
 		filepath.Join(*resourcesDir, "templates/failing.html"),
 		filepath.Join(*resourcesDir, "templates/named.html"),
+		filepath.Join(*resourcesDir, "templates/bisect.html"),
+		filepath.Join(*resourcesDir, "templates/bisections.html"),
+		filepath.Join(*resourcesDir, "templates/regression.html"),
 		// Sub templates used by other templates.
 		filepath.Join(*resourcesDir, "templates/header.html"),
 		filepath.Join(*resourcesDir, "templates/menu.html"),
@@ -180,6 +187,216 @@ func namedHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// bisectionsHandler lists all the bisections and has a form for starting a
+// new one. The fiddle, good, and bad query parameters pre-fill the form.
+func bisectionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html")
+	if *local {
+		loadTemplates()
+	}
+	context := struct {
+		Fiddle     string
+		Good       string
+		Bad        string
+		Bisections []*bisect.Bisection
+	}{
+		Fiddle:     r.FormValue("fiddle"),
+		Good:       r.FormValue("good"),
+		Bad:        r.FormValue("bad"),
+		Bisections: bisector.List(),
+	}
+	if err := templates.ExecuteTemplate(w, "bisections.html", context); err != nil {
+		sklog.Errorf("Failed to expand template: %s", err)
+	}
+}
+
+// bisectStartHandler starts a new bisection from the form values fiddle,
+// good, and bad, and then redirects to the page for that bisection.
+func bisectStartHandler(w http.ResponseWriter, r *http.Request) {
+	user := login.LoggedInAs(r)
+	if user == "" {
+		http.Error(w, "You must be logged in to bisect a fiddle.", http.StatusForbidden)
+		return
+	}
+	fiddleHash, err := names.DereferenceID(strings.TrimSpace(r.FormValue("fiddle")))
+	if err != nil {
+		httputils.ReportError(w, r, err, "Invalid fiddle id.")
+		return
+	}
+	bis, err := bisector.Add(fiddleHash, strings.TrimSpace(r.FormValue("good")), strings.TrimSpace(r.FormValue("bad")), user)
+	if err != nil {
+		httputils.ReportError(w, r, err, fmt.Sprintf("Failed to start bisection: %s", err))
+		return
+	}
+	http.Redirect(w, r, "/bisect/"+bis.Id, http.StatusSeeOther)
+}
+
+// clientAddr returns the address of the client which made the request. In
+// production fiddle runs behind the proxy, which puts the client's address in
+// the CLIENT_ADDR_HEADER header, replacing any value sent by the client; see
+// skfe/sys/skia_org_nginx. Otherwise the request's remote address is used.
+func clientAddr(r *http.Request) string {
+	if addr := strings.TrimSpace(r.Header.Get(CLIENT_ADDR_HEADER)); addr != "" {
+		return addr
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// batchStartHandler queues the fiddles in a types.BatchRequest to be run and
+// returns the initial types.BatchStatus. See API.md.
+func batchStartHandler(w http.ResponseWriter, r *http.Request) {
+	req := &types.BatchRequest{}
+	defer util.Close(r.Body)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to decode request: %s", err), http.StatusBadRequest)
+		return
+	}
+	// Rate limit by user if logged in, otherwise by address.
+	client := login.LoggedInAs(r)
+	if client == "" {
+		client = clientAddr(r)
+	}
+	status, err := batcher.Add(client, req)
+	if err == batch.RateLimitedErr {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to start batch: %s", err), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		httputils.ReportError(w, r, err, "Failed to JSON Encode response.")
+	}
+}
+
+// batchJSONHandler returns the types.BatchStatus of a single batch.
+func batchJSONHandler(w http.ResponseWriter, r *http.Request) {
+	status, err := batcher.Get(mux.Vars(r)["id"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		httputils.ReportError(w, r, err, "Failed to JSON Encode response.")
+	}
+}
+
+// bisectHandler displays the progress of a single bisection and, once it
+// has finished, the outputs on either side of the change.
+func bisectHandler(w http.ResponseWriter, r *http.Request) {
+	bis, err := bisector.Get(mux.Vars(r)["id"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if *local {
+		loadTemplates()
+	}
+	if err := templates.ExecuteTemplate(w, "bisect.html", bis); err != nil {
+		sklog.Errorf("Failed to expand template: %s", err)
+	}
+}
+
+// bisectJSONHandler returns the JSON description of a single bisection.
+func bisectJSONHandler(w http.ResponseWriter, r *http.Request) {
+	bis, err := bisector.Get(mux.Vars(r)["id"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(bis); err != nil {
+		httputils.ReportError(w, r, err, "Failed to JSON Encode response.")
+	}
+}
+
+// bisectMediaHandler serves up the outputs of a fiddle on either side of the
+// change found by a bisection.
+//
+// The URLs look like:
+//
+//   /bisect/0123456789abcdef/before_raster.png
+//   /bisect/0123456789abcdef/after_gpu.png
+//   /bisect/0123456789abcdef/after.pdf
+//   /bisect/0123456789abcdef/before.txt
+func bisectMediaHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	image := mux.Vars(r)["image"]
+	after := strings.HasPrefix(image, "after")
+	trailing := strings.TrimPrefix(strings.TrimPrefix(image, "after"), "before")
+	media, ok := trailingToMedia[trailing]
+	if trailing == ".txt" {
+		media, ok = store.TXT, true
+	}
+	if !ok || trailing == image {
+		http.NotFound(w, r)
+		return
+	}
+	body, contentType, err := bisector.Media(id, after, media)
+	if err != nil {
+		http.NotFound(w, r)
+		sklog.Errorf("Failed to retrieve bisect media: %s", err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	if _, err := w.Write(body); err != nil {
+		sklog.Errorf("Failed to write bisect media: %s", err)
+	}
+}
+
+// loadRegressionReport returns the regression report with the id given in the
+// id query parameter, or the latest report if there is none.
+func loadRegressionReport(r *http.Request) (*regression.Report, error) {
+	if suite == nil {
+		return nil, fmt.Errorf("The named regression suite isn't running.")
+	}
+	if id := r.FormValue("id"); id != "" {
+		return suite.Get(id)
+	}
+	report := suite.Latest()
+	if report == nil {
+		return nil, fmt.Errorf("There are no regression reports yet.")
+	}
+	return report, nil
+}
+
+// regressionHandler displays a report of the named fiddles whose outputs
+// changed with a new build of Skia.
+func regressionHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := loadRegressionReport(r)
+	if err != nil {
+		httputils.ReportError(w, r, err, fmt.Sprintf("Failed to load regression report: %s", err))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if *local {
+		loadTemplates()
+	}
+	if err := templates.ExecuteTemplate(w, "regression.html", report); err != nil {
+		sklog.Errorf("Failed to expand template: %s", err)
+	}
+}
+
+// regressionJSONHandler returns the JSON regression report.
+func regressionJSONHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := loadRegressionReport(r)
+	if err != nil {
+		httputils.ReportError(w, r, err, fmt.Sprintf("Failed to load regression report: %s", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		httputils.ReportError(w, r, err, "Failed to JSON Encode response.")
+	}
+}
+
 // iframeHandle handles permalinks to individual fiddles.
 func iframeHandle(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
@@ -363,6 +580,15 @@ func run(user string, req *types.FiddleContext) (*types.RunResults, error) {
 		CompileErrors: []types.CompileError{},
 		FiddleHash:    "",
 	}
+	// Includes may refer to named fiddles, but only fiddle hashes are stored
+	// so that a fiddle doesn't change when a name is updated.
+	for i, id := range req.Options.Includes {
+		fiddleHash, err := names.DereferenceID(id)
+		if err != nil {
+			return resp, fmt.Errorf("Invalid include %q: %s", id, err)
+		}
+		req.Options.Includes[i] = fiddleHash
+	}
 	if err := runner.ValidateOptions(&req.Options); err != nil {
 		return resp, fmt.Errorf("Invalid Options: %s", err)
 	}
@@ -392,10 +618,14 @@ func run(user string, req *types.FiddleContext) (*types.RunResults, error) {
 		}
 	}
 
+	includes, err := runner.Includes(fiddleStore, &req.Options)
+	if err != nil {
+		return resp, fmt.Errorf("Failed to load the included fiddles: %s", err)
+	}
 	current := build.Current()
 	sklog.Infof("Building at: %s", current.Hash)
 	checkout := filepath.Join(*fiddleRoot, "versions", current.Hash)
-	tmpDir, err := runner.WriteDrawCpp(checkout, *fiddleRoot, req.Code, &req.Options)
+	tmpDir, err := runner.WriteDrawCpp(checkout, *fiddleRoot, req.Code, includes, &req.Options)
 	if err != nil {
 		return resp, fmt.Errorf("Failed to write the fiddle.")
 	}
@@ -417,33 +647,7 @@ func run(user string, req *types.FiddleContext) (*types.RunResults, error) {
 	// Take the compiler output and strip off all the implementation dependant information
 	// and format it to be retured in types.RunResults.
 	if res.Compile.Errors != "" {
-		lines := strings.Split(res.Compile.Output, "\n")
-		for _, line := range lines {
-			match := parseCompilerOutput.FindAllStringSubmatch(line, -1)
-			if match == nil || len(match[0]) < 5 {
-				resp.CompileErrors = append(resp.CompileErrors, types.CompileError{
-					Text: line,
-					Line: 0,
-					Col:  0,
-				})
-				continue
-			}
-			line_num, err := strconv.Atoi(match[0][3])
-			if err != nil {
-				sklog.Errorf("Failed to parse compiler output line number: %#v: %s", match, err)
-				continue
-			}
-			col_num, err := strconv.Atoi(match[0][4])
-			if err != nil {
-				sklog.Errorf("Failed to parse compiler output column number: %#v: %s", match, err)
-				continue
-			}
-			resp.CompileErrors = append(resp.CompileErrors, types.CompileError{
-				Text: match[0][2],
-				Line: line_num,
-				Col:  col_num,
-			})
-		}
+		resp.CompileErrors = runner.CompileErrors(res.Compile.Output, runner.SourceFiles(includes, &req.Options))
 	}
 	// Since the compile failed we will only store the code, not the media.
 	if res.Compile.Errors != "" || res.Execute.Errors != "" {
@@ -476,7 +680,7 @@ func run(user string, req *types.FiddleContext) (*types.RunResults, error) {
 	// Only logged in users can create named fiddles.
 	if req.Name != "" && user != "" && fiddleHash != "" {
 		// Create a name for this fiddle. Validation is done in this func.
-		err := names.Add(req.Name, fiddleHash, user, req.Overwrite)
+		err := names.Add(req.Name, fiddleHash, user, req.Tags, req.Overwrite)
 		if err == named.DuplicateNameErr {
 			return resp, fmt.Errorf("Duplicate fiddle name.")
 		}
@@ -531,8 +735,14 @@ func singleStepTryNamed() {
 			sklog.Errorf("Can't get code for %s: %s", name.Name, err)
 			continue
 		}
+		includes, err := runner.Includes(fiddleStore, options)
+		if err != nil {
+			sklog.Errorf("Can't get includes for %s: %s", name.Name, err)
+			failing = append(failing, name)
+			continue
+		}
 		checkout := filepath.Join(*fiddleRoot, "versions", current.Hash)
-		tmpDir, err := runner.WriteDrawCpp(checkout, *fiddleRoot, code, options)
+		tmpDir, err := runner.WriteDrawCpp(checkout, *fiddleRoot, code, includes, options)
 		if err != nil {
 			sklog.Errorf("Failed to write fiddle for %s: %s", name.Name, err)
 			continue
@@ -609,6 +819,14 @@ func main() {
 	names = named.New(fiddleStore)
 	build = buildskia.New(*fiddleRoot, depotTools, repo, buildlib.BuildLib, 64, *timeBetweenBuilds, true)
 	build.Start()
+	batcher = batch.New(*fiddleRoot, depotTools, *local, build, fiddleStore, names, *batchPerMinute, *batchBurst)
+	batcher.Start()
+	bisector = bisect.New(*fiddleRoot, depotTools, *local, repo, build, fiddleStore)
+	bisector.Start()
+	if *namedRegression {
+		suite = regression.New(*fiddleRoot, depotTools, *local, build, fiddleStore, names, *namedRegressionTag, *namedRegressionGold)
+		suite.Start(REGRESSION_PERIOD)
+	}
 	if *tryNamed {
 		StartTryNamed()
 	}
@@ -626,8 +844,17 @@ func main() {
 	r.HandleFunc("/s/{id:[0-9]+}", sourceHandler)
 	r.HandleFunc("/f/", failedHandler)
 	r.HandleFunc("/named/", namedHandler)
+	r.HandleFunc("/regression/", regressionHandler)
+	r.HandleFunc("/bisect/", bisectionsHandler)
+	r.HandleFunc("/bisect/{id:[0-9a-f]+}", bisectHandler)
+	r.HandleFunc("/bisect/{id:[0-9a-f]+}/{image:[._a-z]+}", bisectMediaHandler)
 	r.HandleFunc("/", mainHandler)
 	r.HandleFunc("/_/run", runHandler)
+	r.HandleFunc("/_/regression", regressionJSONHandler)
+	r.HandleFunc("/_/batch", batchStartHandler).Methods("POST")
+	r.HandleFunc("/_/batch/{id:[0-9a-f]+}", batchJSONHandler)
+	r.HandleFunc("/_/bisect", bisectStartHandler).Methods("POST")
+	r.HandleFunc("/_/bisect/{id:[0-9a-f]+}", bisectJSONHandler)
 	r.HandleFunc("/oauth2callback/", login.OAuth2CallbackHandler)
 	r.HandleFunc("/logout/", login.LogoutHandler)
 	r.HandleFunc("/loginstatus/", login.StatusHandler)
@@ -2,6 +2,10 @@
 //
 // Example:
 //  fiddlecli --input demo/testbulk.json --output /tmp/output.json
+//
+// With --batch the fiddles are submitted through the batch API, see
+// fiddle/API.md, and the output is a types.BatchStatus:
+//  fiddlecli --batch --revision 1234abcd --input demo/testbulk.json --output /tmp/output.json
 package main
 
 import (
@@ -11,22 +15,29 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/http"
+	"sort"
 	"sync"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 
 	"go.skia.org/infra/fiddle/go/types"
 	"go.skia.org/infra/go/httputils"
+	"go.skia.org/infra/go/util"
 )
 
 // flags
 var (
-	domain = flag.String("domain", "https://fiddle.skia.org", "Where to send the JSON request.")
-	input  = flag.String("input", "", "The name of the file to read the JSON from.")
-	output = flag.String("output", "", "The name of the file to write the JSON results to.")
-	procs  = flag.Int("procs", 4, "The number of parallel requests to make to the fiddle server.")
-	quiet  = flag.Bool("quiet", false, "Run without a progress bar.")
-	force  = flag.Bool("force", false, "Force a compile and run for each fiddle, don't take the fast path.")
+	batch    = flag.Bool("batch", false, "Submit all the fiddles at once through the batch API and poll for the results.")
+	domain   = flag.String("domain", "https://fiddle.skia.org", "Where to send the JSON request.")
+	input    = flag.String("input", "", "The name of the file to read the JSON from.")
+	output   = flag.String("output", "", "The name of the file to write the JSON results to.")
+	poll     = flag.Duration("poll", 5*time.Second, "How often to poll for the results of a batch.")
+	procs    = flag.Int("procs", 4, "The number of parallel requests to make to the fiddle server.")
+	quiet    = flag.Bool("quiet", false, "Run without a progress bar.")
+	force    = flag.Bool("force", false, "Force a compile and run for each fiddle, don't take the fast path.")
+	revision = flag.String("revision", "", "With --batch, the git hash of the build of Skia to run the fiddles at. Defaults to the current build.")
 )
 
 // chanRequest is sent to each worker in the pool.
@@ -56,6 +67,14 @@ func main() {
 	if err := json.Unmarshal(b, &requests); err != nil {
 		log.Fatalf("%s does not contain valid JSON: %s", *input, err)
 	}
+	if *batch {
+		status, err := runBatch(requests)
+		if err != nil {
+			log.Fatalf("Failed to run batch: %s", err)
+		}
+		writeOutput(status)
+		return
+	}
 
 	g := errgroup.Group{}
 	requestsCh := make(chan chanRequest, len(requests))
@@ -118,7 +137,12 @@ func main() {
 	if !*quiet {
 		fmt.Print("\n")
 	}
-	b, err = json.MarshalIndent(response, "", "  ")
+	writeOutput(response)
+}
+
+// writeOutput writes the results as JSON to the --output file.
+func writeOutput(results interface{}) {
+	b, err := json.MarshalIndent(results, "", "  ")
 	if err != nil {
 		log.Fatalf("Failed to encode response file: %s", err)
 	}
@@ -126,3 +150,70 @@ func main() {
 		log.Fatalf("Failed to write response file: %s", err)
 	}
 }
+
+// decodeStatus decodes a types.BatchStatus from the response to a batch API
+// request.
+func decodeStatus(resp *http.Response) (*types.BatchStatus, error) {
+	defer util.Close(resp.Body)
+	if resp.StatusCode != 200 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Request failed with %d: %s", resp.StatusCode, string(b))
+	}
+	status := &types.BatchStatus{}
+	if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+		return nil, fmt.Errorf("Failed to read response: %s", err)
+	}
+	return status, nil
+}
+
+// runBatch submits all the requests as a single batch and polls until every
+// fiddle in the batch has finished.
+func runBatch(requests types.BulkRequest) (*types.BatchStatus, error) {
+	ids := []string{}
+	for id := range requests {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	batchReq := &types.BatchRequest{
+		Items: []*types.BatchItem{},
+	}
+	for _, id := range ids {
+		batchReq.Items = append(batchReq.Items, &types.BatchItem{
+			Id:       id,
+			Revision: *revision,
+			Code:     requests[id].Code,
+			Options:  requests[id].Options,
+		})
+	}
+	b, err := json.Marshal(batchReq)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to encode the batch: %s", err)
+	}
+	c := httputils.NewTimeoutClient()
+	resp, err := c.Post(*domain+"/_/batch", "application/json", bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to submit the batch: %s", err)
+	}
+	status, err := decodeStatus(resp)
+	if err != nil {
+		return nil, err
+	}
+	for !status.Done {
+		if !*quiet {
+			fmt.Print(".")
+		}
+		time.Sleep(*poll)
+		resp, err := c.Get(*domain + "/_/batch/" + status.Id)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to poll the batch: %s", err)
+		}
+		status, err = decodeStatus(resp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !*quiet {
+		fmt.Print("\n")
+	}
+	return status, nil
+}
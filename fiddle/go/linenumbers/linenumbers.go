@@ -2,9 +2,34 @@ package linenumbers
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
+var (
+	// compilerOutputRe parses the compiler output to look for lines that
+	// begin with "<file>:<N>:<M>:" where N and M are the line and column
+	// number where the error occurred, optionally preceded by the path to the
+	// file.
+	//
+	// For example if we had the following input line:
+	//
+	//    "/usr/local../src/draw.cpp:8:5: error: expected ‘)’ before ‘canvas’"
+	//
+	// Then re.FindStringSubmatch(s) will return a match of the form:
+	//
+	//      []string{
+	//        "/usr/local.../src/draw.cpp:8:5: error: expected ‘)’ before ‘canvas’",
+	//        "/usr/local.../src/",
+	//        "draw.cpp:8:5: error: expected ‘)’ before ‘canvas’",
+	//        "draw.cpp",
+	//        "8",
+	//        "5",
+	//      }
+	compilerOutputRe = regexp.MustCompile("^(.*/)?(([^/:\\s]+):([0-9]+):([-0-9]+):.*)")
+)
+
 // LineNumbers adds #line numbering to the user's code.
 func LineNumbers(c string) string {
 	lines := strings.Split(c, "\n")
@@ -15,3 +40,60 @@ func LineNumbers(c string) string {
 	}
 	return strings.Join(ret, "\n")
 }
+
+// FileLineNumbers adds #line numbering to the code of the given file, so
+// that the compiler reports errors in the code against that file name and
+// the line number within that file.
+func FileLineNumbers(c, filename string) string {
+	lines := strings.Split(c, "\n")
+	ret := []string{}
+	for i, line := range lines {
+		ret = append(ret, fmt.Sprintf("#line %d %q", i+1, filename))
+		ret = append(ret, line)
+	}
+	return strings.Join(ret, "\n")
+}
+
+// Location is where in the user's code an error occurred.
+type Location struct {
+	File string
+	Line int
+	Col  int
+
+	// Text is the compiler output with the path of the file stripped off.
+	Text string
+}
+
+// ParseCompilerOutput parses a single line of compiler output and returns the
+// Location of the error if the line refers to one of the given files. Returns
+// nil otherwise, for example if the line refers to a file in Skia.
+func ParseCompilerOutput(line string, files []string) *Location {
+	match := compilerOutputRe.FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+	found := false
+	for _, f := range files {
+		if f == match[3] {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+	lineNum, err := strconv.Atoi(match[4])
+	if err != nil {
+		return nil
+	}
+	col, err := strconv.Atoi(match[5])
+	if err != nil {
+		return nil
+	}
+	return &Location{
+		File: match[3],
+		Line: lineNum,
+		Col:  col,
+		Text: match[2],
+	}
+}
@@ -26,3 +26,40 @@ c`
 `
 	assert.Equal(t, want, LineNumbers(code))
 }
+
+func TestFileLineNumbers(t *testing.T) {
+	testutils.SmallTest(t)
+	code := `a
+b`
+	want := `#line 1 "helpers.h"
+a
+#line 2 "helpers.h"
+b`
+	assert.Equal(t, want, FileLineNumbers(code, "helpers.h"))
+}
+
+func TestParseCompilerOutput(t *testing.T) {
+	testutils.SmallTest(t)
+	files := []string{"draw.cpp", "helpers.h"}
+
+	loc := ParseCompilerOutput("/usr/local/src/skia/tools/fiddle/draw.cpp:8:5: error: expected ‘)’ before ‘canvas’", files)
+	assert.Equal(t, &Location{
+		File: "draw.cpp",
+		Line: 8,
+		Col:  5,
+		Text: "draw.cpp:8:5: error: expected ‘)’ before ‘canvas’",
+	}, loc)
+
+	// Errors in files named by #line directives have no path.
+	loc = ParseCompilerOutput("helpers.h:3:12: error: ‘foo’ was not declared in this scope", files)
+	assert.Equal(t, &Location{
+		File: "helpers.h",
+		Line: 3,
+		Col:  12,
+		Text: "helpers.h:3:12: error: ‘foo’ was not declared in this scope",
+	}, loc)
+
+	// Errors in other files, or lines that aren't errors, aren't mapped.
+	assert.Nil(t, ParseCompilerOutput("../../include/core/SkCanvas.h:100:5: note: candidate", files))
+	assert.Nil(t, ParseCompilerOutput(" void draw(SkCanvas* canvas) {", files))
+}
@@ -40,7 +40,7 @@ var (
 // methods that Named uses.
 type NameStore interface {
 	GetHashFromName(name string) (string, error)
-	WriteName(name, hash, user string) error
+	WriteName(name, hash, user string, tags []string) error
 }
 
 // Named deals with creating and dereferencing named fiddles.
@@ -67,11 +67,18 @@ func New(st NameStore) *Named {
 //   name      - The name of the fidde, w/o the @ prefix.
 //   hash      - The fiddle hash.
 //   user      - The email of the user that created the name.
+//   tags      - Tags for the named fiddle, e.g. "docs". If nil then the tags
+//               of an existing name are kept.
 //   overwrite - True if the write should proceed if the name already exists.
-func (n *Named) Add(name, hash, user string, overwrite bool) error {
+func (n *Named) Add(name, hash, user string, tags []string, overwrite bool) error {
 	if !fiddleNameRe.MatchString(name) {
 		return fmt.Errorf("Not a valid fiddle name %q", name)
 	}
+	for _, tag := range tags {
+		if !fiddleNameRe.MatchString(tag) {
+			return fmt.Errorf("Not a valid fiddle tag %q", tag)
+		}
+	}
 	if !fiddleHashRe.MatchString(hash) {
 		return fmt.Errorf("Not a valid fiddle hash  %q", hash)
 	}
@@ -81,7 +88,7 @@ func (n *Named) Add(name, hash, user string, overwrite bool) error {
 		if !overwrite {
 			return DuplicateNameErr
 		}
-		if oldHash == hash {
+		if oldHash == hash && tags == nil {
 			// Don't bother writing if the hash is already correct.
 			return nil
 		}
@@ -89,7 +96,7 @@ func (n *Named) Add(name, hash, user string, overwrite bool) error {
 	} else {
 		sklog.Infof("Named Fiddle Created: %s %s by %s", name, hash, user)
 	}
-	if err := n.st.WriteName(name, hash, user); err != nil {
+	if err := n.st.WriteName(name, hash, user, tags); err != nil {
 		return fmt.Errorf("Failed to write name: %s", err)
 	}
 	n.mutex.Lock()
@@ -12,6 +12,7 @@ import (
 
 type namedMock struct {
 	lookup map[string]string
+	writes int
 }
 
 func (n *namedMock) GetHashFromName(name string) (string, error) {
@@ -22,10 +23,11 @@ func (n *namedMock) GetHashFromName(name string) (string, error) {
 	}
 }
 
-func (n *namedMock) WriteName(name, hash, user string) error {
+func (n *namedMock) WriteName(name, hash, user string, tags []string) error {
 	if name == "bad_name_to_trigger_fail" {
 		return fmt.Errorf("Failed to write.")
 	}
+	n.writes++
 	return nil
 }
 
@@ -111,18 +113,28 @@ func TestAdd(t *testing.T) {
 	}
 
 	names := New(mock)
-	err := names.Add("a_good_name", "cbb8dee39e9f1576cd97c2d504db8eee", "user", true)
+	err := names.Add("a_good_name", "cbb8dee39e9f1576cd97c2d504db8eee", "user", nil, true)
 	assert.NoError(t, err)
 
-	err = names.Add("no spaces in names", "cbb8dee39e9f1576cd97c2d504db8eee", "user", true)
+	err = names.Add("no spaces in names", "cbb8dee39e9f1576cd97c2d504db8eee", "user", nil, true)
 	assert.Error(t, err)
 
-	err = names.Add("a_good_name", "cbb8_bash_hash", "user", true)
+	err = names.Add("a_good_name", "cbb8_bash_hash", "user", nil, true)
 	assert.Error(t, err)
 
-	err = names.Add("star", "cbb8dee39e9f1576cd97c2d504db8eee", "user", false)
+	err = names.Add("a_good_name", "cbb8dee39e9f1576cd97c2d504db8eee", "user", []string{"no spaces in tags"}, true)
+	assert.Error(t, err)
+
+	err = names.Add("star", "cbb8dee39e9f1576cd97c2d504db8eee", "user", nil, false)
 	assert.Equal(t, err, DuplicateNameErr)
 
-	err = names.Add("star", "cbb8dee39e9f1576cd97c2d504db8eee", "user", true)
+	// Nothing to write if neither the hash nor the tags change.
+	writes := mock.writes
+	err = names.Add("star", "cbb8dee39e9f1576cd97c2d504db8eee", "user", nil, true)
+	assert.NoError(t, err)
+	assert.Equal(t, writes, mock.writes)
+
+	err = names.Add("star", "cbb8dee39e9f1576cd97c2d504db8eee", "user", []string{"docs"}, true)
 	assert.NoError(t, err)
+	assert.Equal(t, writes+1, mock.writes)
 }
@@ -0,0 +1,112 @@
+package regression
+
+import (
+	"encoding/json"
+	"sort"
+
+	"go.skia.org/infra/fiddle/go/bisect"
+	"go.skia.org/infra/fiddle/go/types"
+	"go.skia.org/infra/go/sklog"
+)
+
+const (
+	// GOLD_SOURCE_TYPE is the source_type, i.e. the corpus, of the named
+	// fiddles in Gold.
+	GOLD_SOURCE_TYPE = "fiddle"
+)
+
+var (
+	// goldOutputs are the outputs uploaded to Gold, which only ingests PNGs.
+	goldOutputs = []string{bisect.OUTPUT_RASTER, bisect.OUTPUT_GPU}
+
+	// goldKey is the key shared by all the results uploaded to Gold.
+	goldKey = map[string]string{
+		"source": "fiddle.skia.org",
+	}
+)
+
+// goldResult is a single result in goldResults.
+type goldResult struct {
+	Key     map[string]string `json:"key"`
+	Options map[string]string `json:"options"`
+	Digest  string            `json:"md5"`
+}
+
+// goldResults is the subset of the DM JSON format that Gold ingests, see
+// goldingestion.DMResults.
+type goldResults struct {
+	GitHash string            `json:"gitHash"`
+	Key     map[string]string `json:"key"`
+	Results []*goldResult     `json:"results"`
+}
+
+// toGold converts the Summaries of the named fiddles which were run against
+// the given build of Skia into the results ingested by Gold. Each PNG output
+// of a fiddle is a test named after the fiddle, with the output as its
+// config.
+func toGold(gitHash string, summaries map[string]*Summary) *goldResults {
+	names := make([]string, 0, len(summaries))
+	for name := range summaries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ret := &goldResults{
+		GitHash: gitHash,
+		Key:     goldKey,
+		Results: []*goldResult{},
+	}
+	for _, name := range names {
+		for _, output := range goldOutputs {
+			digest, ok := summaries[name].Digests[output]
+			if !ok {
+				continue
+			}
+			ret.Results = append(ret.Results, &goldResult{
+				Key: map[string]string{
+					"name":        name,
+					"config":      output,
+					"source_type": GOLD_SOURCE_TYPE,
+				},
+				Options: map[string]string{
+					"ext": "png",
+				},
+				Digest: digest,
+			})
+		}
+	}
+	return ret
+}
+
+// putGoldImages uploads the PNG outputs of running a fiddle for Gold, unless
+// they were already uploaded for the previous build.
+func (s *Suite) putGoldImages(name string, summary, prev *Summary, res *types.Result) {
+	images := map[string]string{
+		bisect.OUTPUT_RASTER: res.Execute.Output.Raster,
+		bisect.OUTPUT_GPU:    res.Execute.Output.Gpu,
+	}
+	for _, output := range goldOutputs {
+		digest, ok := summary.Digests[output]
+		if !ok {
+			continue
+		}
+		if prev != nil && prev.Digests[output] == digest {
+			continue
+		}
+		if err := s.fiddleStore.PutGoldImage(digest, images[output]); err != nil {
+			sklog.Errorf("Failed to upload the %s output of %s to Gold: %s", output, name, err)
+		}
+	}
+}
+
+// putGoldResults uploads the results of the named fiddles which were run in
+// the given report for ingestion by Gold.
+func (s *Suite) putGoldResults(report *Report, summaries map[string]*Summary) {
+	b, err := json.MarshalIndent(toGold(report.GitHash, summaries), "", "  ")
+	if err != nil {
+		sklog.Errorf("Failed to encode Gold results: %s", err)
+		return
+	}
+	if err := s.fiddleStore.PutGoldResults(report.RunId(), report.Created, b); err != nil {
+		sklog.Errorf("Failed to upload Gold results: %s", err)
+	}
+}
@@ -0,0 +1,354 @@
+// Package regression re-runs the named fiddles against each new build of
+// Skia and reports the ones whose output, compile status, or runtime error
+// changed since the previous build. The outputs may also be uploaded for
+// ingestion by Gold.
+package regression
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.skia.org/infra/fiddle/go/bisect"
+	"go.skia.org/infra/fiddle/go/named"
+	"go.skia.org/infra/fiddle/go/runner"
+	"go.skia.org/infra/fiddle/go/store"
+	"go.skia.org/infra/fiddle/go/types"
+	"go.skia.org/infra/go/buildskia"
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+)
+
+// The kinds of changes, in addition to the outputs bisect.OUTPUT_*, that are
+// reported in a Change.
+const (
+	CHANGE_COMPILE = "compile" // The fiddle started or stopped compiling.
+	CHANGE_RUNTIME = "runtime" // The runtime error of the fiddle changed.
+)
+
+var (
+	// outputs are the outputs compared between builds, in the order they are
+	// reported.
+	outputs = []string{bisect.OUTPUT_RASTER, bisect.OUTPUT_GPU, bisect.OUTPUT_PDF, bisect.OUTPUT_TEXT}
+)
+
+// Summary is the outcome of running a named fiddle against a build of Skia.
+type Summary struct {
+	FiddleHash    string            `json:"fiddleHash"`
+	CompileErrors bool              `json:"compileErrors"`
+	RunTimeError  string            `json:"runtimeError"`
+	Digests       map[string]string `json:"digests"` // See bisect.Digests.
+}
+
+// summarize returns the Summary of running the given fiddle.
+func summarize(fiddleHash string, res *types.Result) *Summary {
+	ret := &Summary{
+		FiddleHash:    fiddleHash,
+		CompileErrors: res.Compile.Errors != "",
+		RunTimeError:  res.Execute.Errors,
+		Digests:       map[string]string{},
+	}
+	if !ret.CompileErrors && ret.RunTimeError == "" {
+		ret.Digests = bisect.Digests(res)
+	}
+	return ret
+}
+
+// Change describes how the outcome of running a named fiddle changed between
+// two builds of Skia.
+type Change struct {
+	Name    string   `json:"name"`
+	Changed []string `json:"changed"` // CHANGE_COMPILE, CHANGE_RUNTIME, or the outputs that changed.
+	Before  *Summary `json:"before"`
+	After   *Summary `json:"after"`
+}
+
+// Report is the result of running the named fiddles against a build of Skia.
+type Report struct {
+	GitHash     string    `json:"gitHash"`
+	Timestamp   time.Time `json:"timestamp"` // The timestamp of the GitHash commit.
+	PrevGitHash string    `json:"prevGitHash"`
+	Created     time.Time `json:"created"`
+
+	// Results are keyed by fiddle name, w/o the @ prefix. Fiddles that
+	// failed to run at all, as opposed to failing to compile, keep their
+	// Summary from the previous build.
+	Results map[string]*Summary `json:"results"`
+
+	// Changes are sorted by name.
+	Changes []*Change `json:"changes"`
+}
+
+// RunId returns the id used to store the report, see store.RunId.
+func (r *Report) RunId() string {
+	return store.RunId(r.GitHash, r.Timestamp)
+}
+
+// compare returns the Changes between the previous and current Summaries.
+// Fiddles that are new, or whose name now points at a different fiddle, are
+// not compared.
+func compare(prev, cur map[string]*Summary) []*Change {
+	names := make([]string, 0, len(cur))
+	for name := range cur {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ret := []*Change{}
+	for _, name := range names {
+		before, ok := prev[name]
+		after := cur[name]
+		if !ok || before.FiddleHash != after.FiddleHash {
+			continue
+		}
+		changed := []string{}
+		if before.CompileErrors != after.CompileErrors {
+			changed = append(changed, CHANGE_COMPILE)
+		} else if before.RunTimeError != after.RunTimeError {
+			changed = append(changed, CHANGE_RUNTIME)
+		} else {
+			for _, output := range outputs {
+				if before.Digests[output] != after.Digests[output] {
+					changed = append(changed, output)
+				}
+			}
+		}
+		if len(changed) > 0 {
+			ret = append(ret, &Change{
+				Name:    name,
+				Changed: changed,
+				Before:  before,
+				After:   after,
+			})
+		}
+	}
+	return ret
+}
+
+// Suite re-runs the named fiddles whenever a new build of Skia is available.
+type Suite struct {
+	fiddleRoot  string
+	depotTools  string
+	local       bool
+	build       *buildskia.ContinuousBuilder
+	fiddleStore *store.Store
+	names       *named.Named
+	tag         string
+	gold        bool
+
+	changes  metrics2.Int64Metric
+	liveness metrics2.Liveness
+
+	// mutex protects latest.
+	mutex  sync.Mutex
+	latest *Report
+}
+
+// New returns a new Suite.
+//
+//    fiddleRoot - The root of the fiddle working directory. See DESIGN.md.
+//    depotTools - The directory where depot_tools is checked out.
+//    local - True if running locally, see runner.Run.
+//    build - The builder of Skia whose new builds are tested.
+//    fiddleStore - Where fiddles, their outputs, and the reports are stored.
+//    names - Used to dereference the named fiddles.
+//    tag - Only named fiddles with this tag are run. May be empty to run all
+//        the named fiddles.
+//    gold - True if the outputs should also be uploaded for Gold, see
+//        store.PutGoldResults.
+//
+// Call Start() to begin running the suite.
+func New(fiddleRoot, depotTools string, local bool, build *buildskia.ContinuousBuilder, fiddleStore *store.Store, names *named.Named, tag string, gold bool) *Suite {
+	return &Suite{
+		fiddleRoot:  fiddleRoot,
+		depotTools:  depotTools,
+		local:       local,
+		build:       build,
+		fiddleStore: fiddleStore,
+		names:       names,
+		tag:         tag,
+		gold:        gold,
+		changes:     metrics2.GetInt64Metric("named-changes", nil),
+		liveness:    metrics2.NewLiveness("named-regression"),
+	}
+}
+
+// Start the Go routine that checks for a new build of Skia every period and
+// runs the suite against it.
+func (s *Suite) Start(period time.Duration) {
+	if err := s.loadLatest(); err != nil {
+		sklog.Errorf("Failed to load the latest regression report: %s", err)
+	}
+	go func() {
+		s.singleStep()
+		for range time.Tick(period) {
+			s.singleStep()
+		}
+	}()
+}
+
+// Latest returns the most recent Report, or nil if there isn't one.
+func (s *Suite) Latest() *Report {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.latest
+}
+
+// Get returns the Report with the given runId.
+func (s *Suite) Get(runId string) (*Report, error) {
+	b, err := s.fiddleStore.GetRegressionReport(runId)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{}
+	if err := json.Unmarshal(b, report); err != nil {
+		return nil, fmt.Errorf("Failed to decode regression report %q: %s", runId, err)
+	}
+	return report, nil
+}
+
+// loadLatest loads the most recent report from the store.
+func (s *Suite) loadLatest() error {
+	runIds, err := s.fiddleStore.ListRegressionReports()
+	if err != nil {
+		return err
+	}
+	if len(runIds) == 0 {
+		return nil
+	}
+	report, err := s.Get(runIds[len(runIds)-1])
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.latest = report
+	s.changes.Update(int64(len(report.Changes)))
+	return nil
+}
+
+// run runs the given fiddle against the given build of Skia.
+func (s *Suite) run(code string, opts *types.Options, gitHash string) (*types.Result, error) {
+	includes, err := runner.Includes(s.fiddleStore, opts)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load the included fiddles: %s", err)
+	}
+	checkout := filepath.Join(s.fiddleRoot, "versions", gitHash)
+	tmpDir, err := runner.WriteDrawCpp(checkout, s.fiddleRoot, code, includes, opts)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to write the fiddle: %s", err)
+	}
+	defer func() {
+		if !s.local {
+			if err := os.RemoveAll(tmpDir); err != nil {
+				sklog.Errorf("Failed to remove temp dir: %s", err)
+			}
+		}
+	}()
+	return runner.Run(checkout, s.fiddleRoot, s.depotTools, gitHash, s.local, tmpDir, opts)
+}
+
+// singleStep runs the suite if there is a new build of Skia.
+func (s *Suite) singleStep() {
+	current := s.build.Current()
+	if current.Timestamp.IsZero() {
+		// There are no builds of Skia yet.
+		return
+	}
+	prev := s.Latest()
+	if prev != nil && prev.GitHash == current.Hash {
+		s.liveness.Reset()
+		return
+	}
+	report, err := s.runSuite(current.Hash, current.Timestamp, prev)
+	if err != nil {
+		sklog.Errorf("Failed to run the named fiddle regression suite: %s", err)
+		return
+	}
+	b, err := json.Marshal(report)
+	if err != nil {
+		sklog.Errorf("Failed to encode regression report: %s", err)
+		return
+	}
+	if err := s.fiddleStore.PutRegressionReport(report.RunId(), b); err != nil {
+		sklog.Errorf("Failed to store regression report: %s", err)
+		return
+	}
+	for _, c := range report.Changes {
+		sklog.Warningf("Named fiddle @%s changed at %s: %v", c.Name, report.GitHash, c.Changed)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.latest = report
+	s.changes.Update(int64(len(report.Changes)))
+	s.liveness.Reset()
+}
+
+// runSuite runs all the named fiddles with the tag against the given build of
+// Skia, stores their outputs, and returns the Report comparing them to the
+// previous Report, which may be nil.
+func (s *Suite) runSuite(gitHash string, ts time.Time, prev *Report) (*Report, error) {
+	sklog.Infof("Begin: Regression suite at %s", gitHash)
+	allNames, err := s.fiddleStore.ListAllNames()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list all named fiddles: %s", err)
+	}
+	prevResults := map[string]*Summary{}
+	report := &Report{
+		GitHash:   gitHash,
+		Timestamp: ts,
+		Created:   time.Now(),
+		Results:   map[string]*Summary{},
+	}
+	if prev != nil {
+		prevResults = prev.Results
+		report.PrevGitHash = prev.GitHash
+	}
+	// The Summaries of the fiddles which ran against this build, as opposed
+	// to those carried over from the previous build.
+	ran := map[string]*Summary{}
+	for _, name := range allNames {
+		if s.tag != "" && !util.In(s.tag, name.Tags) {
+			continue
+		}
+		fiddleHash, err := s.names.DereferenceID("@" + name.Name)
+		if err != nil {
+			sklog.Errorf("Can't dereference %s: %s", name.Name, err)
+			continue
+		}
+		code, options, err := s.fiddleStore.GetCode(fiddleHash)
+		if err != nil {
+			sklog.Errorf("Can't get code for %s: %s", name.Name, err)
+			continue
+		}
+		res, err := s.run(code, options, gitHash)
+		if err != nil {
+			sklog.Errorf("Failed to run fiddle for %s: %s", name.Name, err)
+			if p, ok := prevResults[name.Name]; ok {
+				report.Results[name.Name] = p
+			}
+			continue
+		}
+		summary := summarize(fiddleHash, res)
+		report.Results[name.Name] = summary
+		if !summary.CompileErrors && summary.RunTimeError == "" {
+			if err := s.fiddleStore.PutMedia(*options, fiddleHash, gitHash, ts, res); err != nil {
+				sklog.Errorf("Failed to store the outputs of %s: %s", name.Name, err)
+			}
+			ran[name.Name] = summary
+			if s.gold {
+				s.putGoldImages(name.Name, summary, prevResults[name.Name], res)
+			}
+		}
+	}
+	if s.gold {
+		s.putGoldResults(report, ran)
+	}
+	report.Changes = compare(prevResults, report.Results)
+	sklog.Infof("End: Regression suite at %s, %d changes in %d named fiddles.", gitHash, len(report.Changes), len(report.Results))
+	return report, nil
+}
@@ -0,0 +1,131 @@
+package regression
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.skia.org/infra/fiddle/go/bisect"
+	"go.skia.org/infra/fiddle/go/types"
+	"go.skia.org/infra/go/testutils"
+)
+
+func TestSummarize(t *testing.T) {
+	testutils.SmallTest(t)
+	res := &types.Result{
+		Execute: types.Execute{
+			Output: types.Output{
+				Text: "aGk=",
+			},
+		},
+	}
+	s := summarize("abc", res)
+	assert.Equal(t, "abc", s.FiddleHash)
+	assert.False(t, s.CompileErrors)
+	assert.Equal(t, "", s.RunTimeError)
+	assert.Equal(t, bisect.Digests(res), s.Digests)
+
+	res.Compile.Errors = "error: expected ';'"
+	s = summarize("abc", res)
+	assert.True(t, s.CompileErrors)
+	assert.Equal(t, map[string]string{}, s.Digests)
+}
+
+func TestCompare(t *testing.T) {
+	testutils.SmallTest(t)
+	prev := map[string]*Summary{
+		"same": {
+			FiddleHash: "1",
+			Digests:    map[string]string{bisect.OUTPUT_RASTER: "a", bisect.OUTPUT_GPU: "b"},
+		},
+		"pixels": {
+			FiddleHash: "2",
+			Digests:    map[string]string{bisect.OUTPUT_RASTER: "a", bisect.OUTPUT_GPU: "b", bisect.OUTPUT_PDF: "c"},
+		},
+		"broken": {
+			FiddleHash: "3",
+			Digests:    map[string]string{bisect.OUTPUT_TEXT: "a"},
+		},
+		"crashes": {
+			FiddleHash:   "4",
+			RunTimeError: "Segmentation fault",
+			Digests:      map[string]string{},
+		},
+		"renamed": {
+			FiddleHash: "5",
+			Digests:    map[string]string{bisect.OUTPUT_RASTER: "a"},
+		},
+	}
+	cur := map[string]*Summary{
+		"same": {
+			FiddleHash: "1",
+			Digests:    map[string]string{bisect.OUTPUT_RASTER: "a", bisect.OUTPUT_GPU: "b"},
+		},
+		"pixels": {
+			FiddleHash: "2",
+			Digests:    map[string]string{bisect.OUTPUT_RASTER: "x", bisect.OUTPUT_GPU: "b", bisect.OUTPUT_PDF: "y"},
+		},
+		"broken": {
+			FiddleHash:    "3",
+			CompileErrors: true,
+			Digests:       map[string]string{},
+		},
+		"crashes": {
+			FiddleHash:   "4",
+			RunTimeError: "Aborted",
+			Digests:      map[string]string{},
+		},
+		"renamed": {
+			FiddleHash: "6",
+			Digests:    map[string]string{bisect.OUTPUT_RASTER: "b"},
+		},
+		"new": {
+			FiddleHash: "7",
+			Digests:    map[string]string{bisect.OUTPUT_RASTER: "a"},
+		},
+	}
+	changes := compare(prev, cur)
+	assert.Equal(t, 3, len(changes))
+	assert.Equal(t, "broken", changes[0].Name)
+	assert.Equal(t, []string{CHANGE_COMPILE}, changes[0].Changed)
+	assert.Equal(t, prev["broken"], changes[0].Before)
+	assert.Equal(t, cur["broken"], changes[0].After)
+	assert.Equal(t, "crashes", changes[1].Name)
+	assert.Equal(t, []string{CHANGE_RUNTIME}, changes[1].Changed)
+	assert.Equal(t, "pixels", changes[2].Name)
+	assert.Equal(t, []string{bisect.OUTPUT_RASTER, bisect.OUTPUT_PDF}, changes[2].Changed)
+
+	// Nothing to compare against.
+	assert.Equal(t, []*Change{}, compare(map[string]*Summary{}, cur))
+}
+
+func TestToGold(t *testing.T) {
+	testutils.SmallTest(t)
+	summaries := map[string]*Summary{
+		"star": {
+			FiddleHash: "1",
+			Digests:    map[string]string{bisect.OUTPUT_RASTER: "a", bisect.OUTPUT_GPU: "b", bisect.OUTPUT_PDF: "c"},
+		},
+		"text": {
+			FiddleHash: "2",
+			Digests:    map[string]string{bisect.OUTPUT_TEXT: "d"},
+		},
+		"cpu_only": {
+			FiddleHash: "3",
+			Digests:    map[string]string{bisect.OUTPUT_RASTER: "e"},
+		},
+	}
+	g := toGold("abcd", summaries)
+	assert.Equal(t, "abcd", g.GitHash)
+	assert.Equal(t, goldKey, g.Key)
+	assert.Equal(t, 3, len(g.Results))
+	assert.Equal(t, &goldResult{
+		Key:     map[string]string{"name": "cpu_only", "config": bisect.OUTPUT_RASTER, "source_type": GOLD_SOURCE_TYPE},
+		Options: map[string]string{"ext": "png"},
+		Digest:  "e",
+	}, g.Results[0])
+	assert.Equal(t, "star", g.Results[1].Key["name"])
+	assert.Equal(t, "a", g.Results[1].Digest)
+	assert.Equal(t, "star", g.Results[2].Key["name"])
+	assert.Equal(t, bisect.OUTPUT_GPU, g.Results[2].Key["config"])
+	assert.Equal(t, "b", g.Results[2].Digest)
+}
@@ -10,6 +10,8 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
 
 	"go.skia.org/infra/go/metrics2"
@@ -32,23 +34,208 @@ DrawOptions GetDrawOptions() {
 
 %s
 `
+
+	// DRAW_FILENAME is the file name the compiler reports errors in the
+	// fiddle's own code against.
+	DRAW_FILENAME = "draw.cpp"
+
+	// MAX_INCLUDES is the maximum number of fiddles that may be included,
+	// directly or indirectly, by a fiddle.
+	MAX_INCLUDES = 20
+
+	// MAX_FILES is the maximum number of additional source files a fiddle
+	// may have.
+	MAX_FILES = 10
 )
 
 var (
 	runTotal    = metrics2.GetCounter("run-total", nil)
 	runFailures = metrics2.GetCounter("run-failures", nil)
+
+	// fiddleHashRe is used to validate the fiddle hashes of includes.
+	fiddleHashRe = regexp.MustCompile("^[0-9a-zA-Z]{32}$")
+
+	// fileNameRe is used to validate the names of additional source files.
+	fileNameRe = regexp.MustCompile("^[0-9a-zA-Z_]+\\.(h|cpp)$")
+
+	// drawFuncRe finds the start of the draw() function of a fiddle.
+	drawFuncRe = regexp.MustCompile("void\\s+draw\\s*\\(\\s*SkCanvas\\s*\\*\\s*\\w*\\s*\\)\\s*\\{")
 )
 
+// CodeStore is the subset of store.Store needed to resolve includes.
+type CodeStore interface {
+	GetCode(fiddleHash string) (string, *types.Options, error)
+}
+
+// matchingBrace returns the index just past the '}' that matches the '{' at
+// code[open], skipping over comments and string and character literals.
+// Returns len(code) if there is no matching brace.
+func matchingBrace(code string, open int) int {
+	depth := 0
+	for i := open; i < len(code); i++ {
+		switch code[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		case '/':
+			if strings.HasPrefix(code[i:], "//") {
+				end := strings.IndexByte(code[i:], '\n')
+				if end == -1 {
+					return len(code)
+				}
+				i += end
+			} else if strings.HasPrefix(code[i:], "/*") {
+				end := strings.Index(code[i+2:], "*/")
+				if end == -1 {
+					return len(code)
+				}
+				i += end + 3
+			}
+		case '"', '\'':
+			quote := code[i]
+			for i++; i < len(code) && code[i] != quote; i++ {
+				if code[i] == '\\' {
+					i++
+				}
+			}
+		}
+	}
+	return len(code)
+}
+
+// TopLevelCode returns the code of a fiddle with its draw() function blanked
+// out, which is what gets compiled when the fiddle is included by another
+// fiddle. Newlines are left in place so that line numbers don't change.
+func TopLevelCode(code string) string {
+	loc := drawFuncRe.FindStringIndex(code)
+	if loc == nil {
+		return code
+	}
+	end := matchingBrace(code, loc[1]-1)
+	b := []byte(code)
+	for i := loc[0]; i < end; i++ {
+		if b[i] != '\n' {
+			b[i] = ' '
+		}
+	}
+	return string(b)
+}
+
+// IncludeFilename returns the file name the compiler reports errors in the
+// top level code of an included fiddle against.
+func IncludeFilename(fiddleHash string) string {
+	return fiddleHash + ".cpp"
+}
+
+// Includes returns the source files that need to be compiled before the code
+// of a fiddle with the given options, i.e. the additional source files and
+// top level code of all the fiddles it includes, directly or indirectly, in
+// the order they need to be compiled. Each fiddle is only included once.
+func Includes(st CodeStore, opts *types.Options) ([]types.File, error) {
+	ret := []types.File{}
+	seen := map[string]bool{}
+	var add func(hashes []string) error
+	add = func(hashes []string) error {
+		for _, fiddleHash := range hashes {
+			if seen[fiddleHash] {
+				continue
+			}
+			seen[fiddleHash] = true
+			if len(seen) > MAX_INCLUDES {
+				return fmt.Errorf("Too many included fiddles, at most %d are allowed.", MAX_INCLUDES)
+			}
+			code, includeOpts, err := st.GetCode(fiddleHash)
+			if err != nil {
+				return fmt.Errorf("Failed to load included fiddle %s: %s", fiddleHash, err)
+			}
+			if err := add(includeOpts.Includes); err != nil {
+				return err
+			}
+			for _, f := range includeOpts.Files {
+				ret = append(ret, types.File{
+					Name: fmt.Sprintf("%s_%s", fiddleHash, f.Name),
+					Code: f.Code,
+				})
+			}
+			ret = append(ret, types.File{
+				Name: IncludeFilename(fiddleHash),
+				Code: TopLevelCode(code),
+			})
+		}
+		return nil
+	}
+	if err := add(opts.Includes); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// SourceFiles returns the names of all the files that are compiled for a
+// fiddle with the given includes, as returned from Includes, and options.
+func SourceFiles(includes []types.File, opts *types.Options) []string {
+	ret := []string{}
+	for _, f := range includes {
+		ret = append(ret, f.Name)
+	}
+	for _, f := range opts.Files {
+		ret = append(ret, f.Name)
+	}
+	return append(ret, DRAW_FILENAME)
+}
+
+// CompileErrors parses the compiler output of a fiddle into CompileErrors,
+// where files are the source files of the fiddle, as returned from
+// SourceFiles. Lines that aren't about an error in one of the files are
+// returned with a Line of 0 and an empty File.
+func CompileErrors(output string, files []string) []types.CompileError {
+	ret := []types.CompileError{}
+	for _, line := range strings.Split(output, "\n") {
+		loc := linenumbers.ParseCompilerOutput(line, files)
+		if loc == nil {
+			ret = append(ret, types.CompileError{
+				Text: line,
+				Line: 0,
+				Col:  0,
+			})
+			continue
+		}
+		ret = append(ret, types.CompileError{
+			Text: loc.Text,
+			Line: loc.Line,
+			Col:  loc.Col,
+			File: loc.File,
+		})
+	}
+	return ret
+}
+
 // prepCodeToCompile adds the line numbers and the right prefix code
 // to the fiddle so it compiles and links correctly.
 //
 //    fiddleRoot - The root of the fiddle working directory. See DESIGN.md.
 //    code - The code to compile.
+//    includes - The included source files, as returned from Includes.
 //    opts - The user's options about how to run that code.
 //
+// The includes and the additional files in opts are compiled before the code,
+// each with line numbering that names the file it came from.
+//
 // Returns the prepped code.
-func prepCodeToCompile(fiddleRoot, code string, opts *types.Options) string {
-	code = linenumbers.LineNumbers(code)
+func prepCodeToCompile(fiddleRoot, code string, includes []types.File, opts *types.Options) string {
+	files := append(append([]types.File{}, includes...), opts.Files...)
+	if len(files) == 0 {
+		code = linenumbers.LineNumbers(code)
+	} else {
+		sources := []string{}
+		for _, f := range files {
+			sources = append(sources, linenumbers.FileLineNumbers(f.Code, f.Name))
+		}
+		code = strings.Join(append(sources, linenumbers.FileLineNumbers(code, DRAW_FILENAME)), "\n")
+	}
 	sourceImage := "0"
 	if opts.Source != 0 {
 		filename := fmt.Sprintf("%d.png", opts.Source)
@@ -75,6 +262,27 @@ func ValidateOptions(opts *types.Options) error {
 	} else {
 		opts.Duration = 0
 	}
+	if len(opts.Includes) > MAX_INCLUDES {
+		return fmt.Errorf("Too many included fiddles, at most %d are allowed.", MAX_INCLUDES)
+	}
+	for _, fiddleHash := range opts.Includes {
+		if !fiddleHashRe.MatchString(fiddleHash) {
+			return fmt.Errorf("Not a valid fiddle hash to include: %q", fiddleHash)
+		}
+	}
+	if len(opts.Files) > MAX_FILES {
+		return fmt.Errorf("Too many files, at most %d are allowed.", MAX_FILES)
+	}
+	names := map[string]bool{}
+	for _, f := range opts.Files {
+		if !fileNameRe.MatchString(f.Name) || f.Name == DRAW_FILENAME {
+			return fmt.Errorf("Not a valid file name: %q", f.Name)
+		}
+		if names[f.Name] {
+			return fmt.Errorf("Duplicate file name: %q", f.Name)
+		}
+		names[f.Name] = true
+	}
 	return nil
 }
 
@@ -84,13 +292,14 @@ func ValidateOptions(opts *types.Options) error {
 //
 //    fiddleRoot - The root of the fiddle working directory. See DESIGN.md.
 //    code - The code to compile.
+//    includes - The included source files, as returned from Includes.
 //    opts - The user's options about how to run that code.
 //    local - If true then we are running locally, so write the code to
 //        fiddleRoot/src/draw.cpp.
 //
 // Returns a temp directory. Depending on 'local' this is where the 'draw.cpp' file was written.
-func WriteDrawCpp(checkout, fiddleRoot, code string, opts *types.Options) (string, error) {
-	code = prepCodeToCompile(fiddleRoot, code, opts)
+func WriteDrawCpp(checkout, fiddleRoot, code string, includes []types.File, opts *types.Options) (string, error) {
+	code = prepCodeToCompile(fiddleRoot, code, includes, opts)
 	dstDir := filepath.Join(fiddleRoot, "src")
 	var err error
 	tmpDir := filepath.Join(fiddleRoot, "tmp")
@@ -32,7 +32,7 @@ void draw(SkCanvas* canvas) {
 #line 2
 }
 `
-	got := prepCodeToCompile("/mnt/pd0/fiddle/", "void draw(SkCanvas* canvas) {\n}", opts)
+	got := prepCodeToCompile("/mnt/pd0/fiddle/", "void draw(SkCanvas* canvas) {\n}", nil, opts)
 	assert.Equal(t, want, got)
 
 	opts = &types.Options{
@@ -51,7 +51,7 @@ void draw(SkCanvas* canvas) {
 #line 2
 }
 `
-	got = prepCodeToCompile("/mnt/pd0/fiddle/", "void draw(SkCanvas* canvas) {\n}", opts)
+	got = prepCodeToCompile("/mnt/pd0/fiddle/", "void draw(SkCanvas* canvas) {\n}", nil, opts)
 	assert.Equal(t, want, got)
 
 	opts = &types.Options{
@@ -73,10 +73,121 @@ void draw(SkCanvas* canvas) {
 #line 2
 }
 `
-	got = prepCodeToCompile("/mnt/pd0/fiddle/", "void draw(SkCanvas* canvas) {\n}", opts)
+	got = prepCodeToCompile("/mnt/pd0/fiddle/", "void draw(SkCanvas* canvas) {\n}", nil, opts)
 	assert.Equal(t, want, got)
 }
 
+func TestPrepMultipleFiles(t *testing.T) {
+	testutils.SmallTest(t)
+	opts := &types.Options{
+		Width:  128,
+		Height: 256,
+		Files: []types.File{
+			{Name: "helpers.h", Code: "int two() {\n  return 2;\n}"},
+		},
+	}
+	includes := []types.File{
+		{Name: "cbb8dee39e9f1576cd97c2d504db8eee.cpp", Code: "int one() { return 1; }"},
+	}
+	want := `#include "fiddle_main.h"
+DrawOptions GetDrawOptions() {
+  static const char *path = 0; // Either a string, or 0.
+  return DrawOptions(128, 256, true, true, true, true, false, false, false, path);
+}
+
+#line 1 "cbb8dee39e9f1576cd97c2d504db8eee.cpp"
+int one() { return 1; }
+#line 1 "helpers.h"
+int two() {
+#line 2 "helpers.h"
+  return 2;
+#line 3 "helpers.h"
+}
+#line 1 "draw.cpp"
+void draw(SkCanvas* canvas) {
+#line 2 "draw.cpp"
+}
+`
+	got := prepCodeToCompile("/mnt/pd0/fiddle/", "void draw(SkCanvas* canvas) {\n}", includes, opts)
+	assert.Equal(t, want, got)
+	assert.Equal(t, []string{"cbb8dee39e9f1576cd97c2d504db8eee.cpp", "helpers.h", "draw.cpp"}, SourceFiles(includes, opts))
+}
+
+func TestTopLevelCode(t *testing.T) {
+	testutils.SmallTest(t)
+	code := `int helper() { return 1; }
+
+void draw(SkCanvas* canvas) {
+    // A brace in a comment }
+    const char* s = "}";
+    char c = '}';
+    if (helper()) {
+        canvas->clear(SK_ColorRED);
+    }
+    /* } */
+}
+
+int other() { return 2; }`
+	got := TopLevelCode(code)
+	assert.Equal(t, len(code), len(got))
+	lines := strings.Split(got, "\n")
+	assert.Equal(t, len(strings.Split(code, "\n")), len(lines))
+	assert.Equal(t, "int helper() { return 1; }", lines[0])
+	assert.Equal(t, "int other() { return 2; }", lines[len(lines)-1])
+	assert.Equal(t, "", strings.TrimSpace(strings.Join(lines[1:len(lines)-1], "")))
+
+	// Code without a draw() function is unchanged.
+	assert.Equal(t, "int helper();", TopLevelCode("int helper();"))
+}
+
+// testCodeStore is a CodeStore for testing.
+type testCodeStore map[string]struct {
+	code string
+	opts *types.Options
+}
+
+func (t testCodeStore) GetCode(fiddleHash string) (string, *types.Options, error) {
+	f, ok := t[fiddleHash]
+	if !ok {
+		return "", nil, fmt.Errorf("Not found: %s", fiddleHash)
+	}
+	return f.code, f.opts, nil
+}
+
+func TestIncludes(t *testing.T) {
+	testutils.SmallTest(t)
+	a := strings.Repeat("a", 32)
+	b := strings.Repeat("b", 32)
+	c := strings.Repeat("c", 32)
+	st := testCodeStore{
+		a: {
+			code: "int a() { return 1; }\nvoid draw(SkCanvas* canvas) {}",
+			opts: &types.Options{},
+		},
+		b: {
+			code: "int b() { return a(); }",
+			opts: &types.Options{
+				Includes: []string{a},
+				Files:    []types.File{{Name: "b.h", Code: "int b();"}},
+			},
+		},
+	}
+	files, err := Includes(st, &types.Options{Includes: []string{b, a}})
+	assert.NoError(t, err)
+	assert.Equal(t, []types.File{
+		{Name: a + ".cpp", Code: "int a() { return 1; }\n                              "},
+		{Name: b + "_b.h", Code: "int b();"},
+		{Name: b + ".cpp", Code: "int b() { return a(); }"},
+	}, files)
+
+	files, err = Includes(st, &types.Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, []types.File{}, files)
+
+	_, err = Includes(st, &types.Options{Includes: []string{c}})
+	assert.Error(t, err)
+}
+
 func TestWriteDrawCpp(t *testing.T) {
 	testutils.SmallTest(t)
 	// Create a temp fiddleRoot that gets cleaned up.
@@ -106,7 +217,7 @@ func TestWriteDrawCpp(t *testing.T) {
 		Height: 256,
 		Source: 2,
 	}
-	dir, err := WriteDrawCpp(checkout, fiddleRoot, "void draw(SkCanvas* canvas) {\n}", opts)
+	dir, err := WriteDrawCpp(checkout, fiddleRoot, "void draw(SkCanvas* canvas) {\n}", nil, opts)
 	assert.NoError(t, err)
 	assert.True(t, strings.HasPrefix(dir, filepath.Join(fiddleRoot, "tmp")))
 }
@@ -171,6 +282,42 @@ func TestValidateOptions(t *testing.T) {
 			errorExpected: true,
 			message:       "negative duration",
 		},
+		{
+			value: &types.Options{
+				Includes: []string{"@helpers"},
+			},
+			errorExpected: true,
+			message:       "include not dereferenced",
+		},
+		{
+			value: &types.Options{
+				Includes: []string{"cbb8dee39e9f1576cd97c2d504db8eee"},
+				Files:    []types.File{{Name: "helpers.h"}, {Name: "helpers.cpp"}},
+			},
+			errorExpected: false,
+			message:       "includes and files",
+		},
+		{
+			value: &types.Options{
+				Files: []types.File{{Name: "draw.cpp"}},
+			},
+			errorExpected: true,
+			message:       "reserved file name",
+		},
+		{
+			value: &types.Options{
+				Files: []types.File{{Name: "../helpers.h"}},
+			},
+			errorExpected: true,
+			message:       "invalid file name",
+		},
+		{
+			value: &types.Options{
+				Files: []types.File{{Name: "helpers.h"}, {Name: "helpers.h"}},
+			},
+			errorExpected: true,
+			message:       "duplicate file name",
+		},
 	}
 
 	for _, tc := range testCases {
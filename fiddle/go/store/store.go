@@ -44,6 +44,9 @@ const (
 	F16_METADATA      = "f16"
 	ANIMATED_METADATA = "animated"
 	DURATION_METADATA = "duration"
+	INCLUDES_METADATA = "includes"
+	FILES_METADATA    = "files"
+	TAGS_METADATA     = "tags"
 )
 
 // Media is the type of outputs we can get from running a fiddle.
@@ -195,6 +198,10 @@ func (s *Store) writeMediaFile(media Media, fiddleHash, runId, b64 string) error
 //
 //   gs://skia-fiddle/fiddle/<fiddleHash>/draw.cpp
 //
+// Any additional source files in options are written alongside it:
+//
+//   gs://skia-fiddle/fiddle/<fiddleHash>/<filename>
+//
 // And media files are written to:
 //
 //   gs://skia-fiddle/fiddle/<fiddleHash>/<runId>/cpu.png
@@ -227,9 +234,24 @@ func (s *Store) Put(code string, options types.Options, gitHash string, ts time.
 		ANIMATED_METADATA: fmt.Sprintf("%v", options.Animated),
 		DURATION_METADATA: fmt.Sprintf("%f", options.Duration),
 	}
+	if len(options.Includes) > 0 {
+		w.ObjectAttrs.Metadata[INCLUDES_METADATA] = strings.Join(options.Includes, ",")
+	}
+	if len(options.Files) > 0 {
+		names := []string{}
+		for _, f := range options.Files {
+			names = append(names, f.Name)
+		}
+		w.ObjectAttrs.Metadata[FILES_METADATA] = strings.Join(names, ",")
+	}
 	if n, err := w.Write([]byte(code)); err != nil {
 		return "", fmt.Errorf("There was a problem storing the code. Uploaded %d bytes: %s", n, err)
 	}
+	for _, f := range options.Files {
+		if err := s.writeFile(fiddleHash, f); err != nil {
+			return "", err
+		}
+	}
 	// Write media, if any.
 	if results == nil {
 		return fiddleHash, nil
@@ -240,6 +262,35 @@ func (s *Store) Put(code string, options types.Options, gitHash string, ts time.
 	return fiddleHash, nil
 }
 
+// writeFile writes an additional source file of a fiddle to Google Storage.
+func (s *Store) writeFile(fiddleHash string, f types.File) error {
+	path := strings.Join([]string{"fiddle", fiddleHash, f.Name}, "/")
+	w := s.bucket.Object(path).NewWriter(context.Background())
+	w.ObjectAttrs.ContentEncoding = "text/plain"
+	if n, err := w.Write([]byte(f.Code)); err != nil {
+		util.Close(w)
+		return fmt.Errorf("There was a problem storing the file %q. Uploaded %d bytes: %s", f.Name, n, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("There was a problem storing the file %q: %s", f.Name, err)
+	}
+	return nil
+}
+
+// readFile reads an additional source file of a fiddle from Google Storage.
+func (s *Store) readFile(fiddleHash, name string) (string, error) {
+	r, err := s.bucket.Object(fmt.Sprintf("fiddle/%s/%s", fiddleHash, name)).NewReader(context.Background())
+	if err != nil {
+		return "", fmt.Errorf("Failed to open file %q for %s: %s", name, fiddleHash, err)
+	}
+	defer util.Close(r)
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read file %q for %s: %s", name, fiddleHash, err)
+	}
+	return string(b), nil
+}
+
 // PutMedia writes the media for the given fiddleHash to Google Storage.
 //
 //    fiddleHash - The fiddle hash.
@@ -261,7 +312,7 @@ func (s *Store) Put(code string, options types.Options, gitHash string, ts time.
 // Returns the fiddleHash.
 func (s *Store) PutMedia(options types.Options, fiddleHash string, gitHash string, ts time.Time, results *types.Result) error {
 	// Write each of the media files.
-	runId := fmt.Sprintf("%s:%s", ts.UTC().Format(time.RFC3339), gitHash)
+	runId := RunId(gitHash, ts)
 	if options.TextOnly {
 		err := s.writeMediaFile(TXT, fiddleHash, runId, results.Execute.Output.Text)
 		if err != nil {
@@ -351,6 +402,21 @@ func (s *Store) GetCode(fiddleHash string) (string, *types.Options, error) {
 		Animated: animated,
 		Duration: duration,
 	}
+	if includes := attr.Metadata[INCLUDES_METADATA]; includes != "" {
+		options.Includes = strings.Split(includes, ",")
+	}
+	if files := attr.Metadata[FILES_METADATA]; files != "" {
+		for _, name := range strings.Split(files, ",") {
+			fileCode, err := s.readFile(fiddleHash, name)
+			if err != nil {
+				return "", nil, err
+			}
+			options.Files = append(options.Files, types.File{
+				Name: name,
+				Code: fileCode,
+			})
+		}
+	}
 	return string(b), options, nil
 }
 
@@ -513,6 +579,15 @@ func (s *Store) ListSourceImages() ([]int, error) {
 type Named struct {
 	Name string
 	User string
+	Tags []string
+}
+
+// splitTags parses the value of TAGS_METADATA.
+func splitTags(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
 }
 
 // ListAllNames returns the list of all named fiddles.
@@ -531,6 +606,7 @@ func (s *Store) ListAllNames() ([]Named, error) {
 		ret = append(ret, Named{
 			Name: filename,
 			User: obj.Metadata[USER_METADATA],
+			Tags: splitTags(obj.Metadata[TAGS_METADATA]),
 		})
 	}
 	return ret, nil
@@ -556,15 +632,136 @@ func (s *Store) GetHashFromName(name string) (string, error) {
 //   name - The name of the fidde.
 //   hash - The fiddle hash.
 //   user - The email of the user that created the name.
-func (s *Store) WriteName(name, hash, user string) error {
+//   tags - The tags of the named fiddle. If nil then the tags of an existing
+//          name are kept.
+func (s *Store) WriteName(name, hash, user string, tags []string) error {
 	ctx := context.Background()
-	w := s.bucket.Object(fmt.Sprintf("named/%s", name)).NewWriter(ctx)
+	obj := s.bucket.Object(fmt.Sprintf("named/%s", name))
+	joined := strings.Join(tags, ",")
+	if tags == nil {
+		if attrs, err := obj.Attrs(ctx); err == nil {
+			joined = attrs.Metadata[TAGS_METADATA]
+		} else if err != storage.ErrObjectNotExist {
+			return fmt.Errorf("Failed to read tags of named file %q: %s", name, err)
+		}
+	}
+	w := obj.NewWriter(ctx)
 	defer util.Close(w)
 	w.ObjectAttrs.Metadata = map[string]string{
 		USER_METADATA: user,
+		TAGS_METADATA: joined,
 	}
 	if _, err := w.Write([]byte(hash)); err != nil {
 		return fmt.Errorf("Failed to write named file %q: %s", name, err)
 	}
 	return nil
 }
+
+// PutRegressionReport writes the JSON encoded regression report for a run of
+// the named fiddles against a build of Skia.
+//
+//    runId - Identifies the build of Skia, see RunId.
+//    report - The JSON encoded report.
+//
+// Reports are written to:
+//
+//   gs://skia-fiddle/regression/<runId>.json
+func (s *Store) PutRegressionReport(runId string, report []byte) error {
+	w := s.bucket.Object(fmt.Sprintf("regression/%s.json", runId)).NewWriter(context.Background())
+	w.ObjectAttrs.ContentType = "application/json"
+	if _, err := w.Write(report); err != nil {
+		util.Close(w)
+		return fmt.Errorf("Failed to write regression report %q: %s", runId, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("Failed to close regression report %q: %s", runId, err)
+	}
+	return nil
+}
+
+// ListRegressionReports returns the runIds of all the regression reports,
+// oldest first.
+func (s *Store) ListRegressionReports() ([]string, error) {
+	ret := []string{}
+	q := &storage.Query{
+		Prefix: "regression/",
+	}
+	it := s.bucket.Objects(context.Background(), q)
+	for obj, err := it.Next(); err != iterator.Done; obj, err = it.Next() {
+		if err != nil {
+			return nil, fmt.Errorf("Failed to retrieve regression report list: %s", err)
+		}
+		ret = append(ret, strings.TrimSuffix(strings.TrimPrefix(obj.Name, "regression/"), ".json"))
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// GetRegressionReport returns the JSON encoded regression report with the
+// given runId.
+func (s *Store) GetRegressionReport(runId string) ([]byte, error) {
+	r, err := s.bucket.Object(fmt.Sprintf("regression/%s.json", runId)).NewReader(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open regression report %q: %s", runId, err)
+	}
+	defer util.Close(r)
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read regression report %q: %s", runId, err)
+	}
+	return b, nil
+}
+
+// PutGoldResults writes the results of a run of the named fiddles against a
+// build of Skia in the format that Gold ingests, see goldingestion.DMResults.
+//
+//    runId - Identifies the build of Skia, see RunId.
+//    ts - When the results were created, used to find the directory to write
+//         to, since Gold ingests directories by the hour.
+//    results - The JSON encoded results.
+//
+// Results are written to:
+//
+//   gs://skia-fiddle/gold/dm-json-v1/YYYY/MM/DD/HH/<runId>.json
+func (s *Store) PutGoldResults(runId string, ts time.Time, results []byte) error {
+	path := fmt.Sprintf("gold/dm-json-v1/%s/%s.json", ts.UTC().Format("2006/01/02/15"), runId)
+	w := s.bucket.Object(path).NewWriter(context.Background())
+	w.ObjectAttrs.ContentType = "application/json"
+	if _, err := w.Write(results); err != nil {
+		util.Close(w)
+		return fmt.Errorf("Failed to write Gold results %q: %s", path, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("Failed to close Gold results %q: %s", path, err)
+	}
+	return nil
+}
+
+// PutGoldImage writes a base64 encoded PNG where Gold can find it by its
+// digest.
+//
+// Images are written to:
+//
+//   gs://skia-fiddle/gold/dm-images-v1/<digest>.png
+func (s *Store) PutGoldImage(digest, b64 string) error {
+	body, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return fmt.Errorf("Image wasn't properly encoded base64: %s", err)
+	}
+	w := s.bucket.Object(fmt.Sprintf("gold/dm-images-v1/%s.png", digest)).NewWriter(context.Background())
+	w.ObjectAttrs.ContentType = "image/png"
+	if _, err := w.Write(body); err != nil {
+		util.Close(w)
+		return fmt.Errorf("Failed to write Gold image %q: %s", digest, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("Failed to close Gold image %q: %s", digest, err)
+	}
+	return nil
+}
+
+// RunId returns the identifier used for outputs of fiddles run against the
+// given build of Skia, which sorts in order of the git commit timestamp.
+func RunId(gitHash string, ts time.Time) string {
+	return fmt.Sprintf("%s:%s", ts.UTC().Format(time.RFC3339), gitHash)
+}
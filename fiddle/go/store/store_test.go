@@ -2,6 +2,7 @@ package store
 
 import (
 	"testing"
+	"time"
 
 	"go.skia.org/infra/go/testutils"
 
@@ -14,3 +15,15 @@ func TestMedia(t *testing.T) {
 	assert.Equal(t, "pdf.pdf", mediaProps[PDF].filename)
 	assert.Equal(t, "abcd-GPU", cacheKey("abcd", GPU))
 }
+
+func TestSplitTags(t *testing.T) {
+	testutils.SmallTest(t)
+	assert.Equal(t, []string{}, splitTags(""))
+	assert.Equal(t, []string{"docs", "gpu"}, splitTags("docs,gpu"))
+}
+
+func TestRunId(t *testing.T) {
+	testutils.SmallTest(t)
+	ts := time.Date(2017, 5, 4, 3, 2, 1, 0, time.FixedZone("EST", -5*60*60))
+	assert.Equal(t, "2017-05-04T08:02:01Z:abcd", RunId("abcd", ts))
+}
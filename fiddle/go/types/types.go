@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"strings"
+	"time"
 
 	"go.skia.org/infra/fiddle/go/linenumbers"
 	"go.skia.org/infra/go/vcsinfo"
@@ -42,6 +43,12 @@ type Output struct {
 	GLInfo         string `json:"GLInfo"`
 }
 
+// File is an additional source file of a fiddle.
+type File struct {
+	Name string `json:"name"`
+	Code string `json:"code"`
+}
+
 // Options are the users options they can select when running a fiddle that
 // will cause it to produce different output.
 //
@@ -55,6 +62,15 @@ type Options struct {
 	TextOnly bool    `json:"textOnly"`
 	Animated bool    `json:"animated"`
 	Duration float64 `json:"duration"`
+
+	// Includes are the fiddle hashes of other fiddles whose top level code,
+	// i.e. everything but their draw() function, is compiled along with this
+	// fiddle. In a request they may also be fiddle names prefixed with "@".
+	Includes []string `json:"includes,omitempty"`
+
+	// Files are additional source files that are compiled along with this
+	// fiddle, after the includes and before the fiddle's own code.
+	Files []File `json:"files,omitempty"`
 }
 
 // ComputeHash calculates the fiddleHash for the given code and options.
@@ -89,6 +105,20 @@ func (o *Options) ComputeHash(code string) (string, error) {
 		}
 		out = append(out, line)
 	}
+	// Includes and Files are only added to the hash when present so that the
+	// hashes of single file fiddles don't change.
+	if len(o.Includes) > 0 {
+		out = append(out, fmt.Sprintf("// Includes: %s", strings.Join(o.Includes, ", ")))
+	}
+	for _, f := range o.Files {
+		out = append(out, fmt.Sprintf("// File: %s", f.Name))
+		for _, line := range strings.Split(linenumbers.LineNumbers(f.Code), "\n") {
+			if strings.Contains(line, "%:") {
+				return "", fmt.Errorf("Unable to compile source.")
+			}
+			out = append(out, line)
+		}
+	}
 	h := md5.New()
 	if _, err := h.Write([]byte(strings.Join(out, "\n"))); err != nil {
 		return "", fmt.Errorf("Failed to write md5: %v", err)
@@ -109,16 +139,18 @@ type FiddleContext struct {
 	Code      string              `json:"code"`
 	Name      string              `json:"name"`      // In a request can be the name to create for this fiddle.
 	Overwrite bool                `json:"overwrite"` // In a request, should a name be overwritten if it already exists.
+	Tags      []string            `json:"tags"`      // In a request, the tags for the name, if omitted the existing tags are kept.
 	Fast      bool                `json:"fast"`      // Fast, don't compile and run if a fiddle with this hash has already been compiled and run.
 	Options   Options             `json:"options"`
 }
 
-// CompileError is a single line of compiler error output, along with the line
-// and column that the error occurred at.
+// CompileError is a single line of compiler error output, along with the file,
+// line, and column that the error occurred at.
 type CompileError struct {
 	Text string `json:"text"`
 	Line int    `json:"line"`
 	Col  int    `json:"col"`
+	File string `json:"file"` // The file the error is in, empty if the error isn't in the fiddle's code.
 }
 
 // RunResults is the results we serialize to JSON as the results from a run.
@@ -131,3 +163,56 @@ type RunResults struct {
 
 type BulkRequest map[string]*FiddleContext
 type BulkResponse map[string]*RunResults
+
+// The states of a BatchResult.
+const (
+	BATCH_QUEUED  = "queued"
+	BATCH_RUNNING = "running"
+	BATCH_SUCCESS = "success" // The fiddle was run, though it may have failed to compile or run.
+	BATCH_FAILURE = "failure" // The fiddle couldn't be run, see BatchResult.Error.
+)
+
+// BatchItem is a single fiddle to run as part of a BatchRequest.
+type BatchItem struct {
+	Id       string  `json:"id"`       // Chosen by the caller, unique within the batch.
+	Revision string  `json:"revision"` // The Skia git hash to run at. Defaults to the current build.
+	Code     string  `json:"code"`
+	Options  Options `json:"options"`
+}
+
+// BatchRequest is the incoming JSON request to /_/batch.
+type BatchRequest struct {
+	Items []*BatchItem `json:"items"`
+}
+
+// BatchResult is the outcome of running a single BatchItem.
+type BatchResult struct {
+	Id            string            `json:"id"`
+	Status        string            `json:"status"`
+	Error         string            `json:"error"`    // Why the fiddle couldn't be run, if Status is BATCH_FAILURE.
+	Revision      string            `json:"revision"` // The full Skia git hash the fiddle was run at.
+	FiddleHash    string            `json:"fiddleHash"`
+	CompileErrors []CompileError    `json:"compile_errors"`
+	RunTimeError  string            `json:"runtime_error"`
+	Stdout        string            `json:"stdout"` // The text output of the fiddle, i.e. SkDebugf().
+	Stderr        string            `json:"stderr"`
+	Outputs       map[string]string `json:"outputs"` // The md5 of each output, keyed by "raster", "gpu", "pdf", or "text".
+
+	Queued   time.Time `json:"queued"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	RunMs    int64     `json:"runMs"` // How long it took to compile and run the fiddle.
+}
+
+// Done returns true if the item has finished, successfully or not.
+func (r *BatchResult) Done() bool {
+	return r.Status == BATCH_SUCCESS || r.Status == BATCH_FAILURE
+}
+
+// BatchStatus is the JSON response from /_/batch and /_/batch/<id>.
+type BatchStatus struct {
+	Id      string         `json:"id"`
+	Created time.Time      `json:"created"`
+	Done    bool           `json:"done"` // True once every item has finished.
+	Results []*BatchResult `json:"results"`
+}
@@ -54,3 +54,40 @@ func TestOptions(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "92c7b15afd12fd711ce65ba412574e3d", hash)
 }
+
+func TestOptionsIncludesAndFiles(t *testing.T) {
+	testutils.SmallTest(t)
+	code := "void draw(SkCanvas* canvas) {\n}"
+	o := Options{
+		Width:  256,
+		Height: 256,
+	}
+	single, err := o.ComputeHash(code)
+	assert.NoError(t, err)
+
+	o.Includes = []string{"cbb8dee39e9f1576cd97c2d504db8eee"}
+	withInclude, err := o.ComputeHash(code)
+	assert.NoError(t, err)
+	assert.NotEqual(t, single, withInclude)
+
+	o.Files = []File{{Name: "helpers.h", Code: "int two();"}}
+	withFile, err := o.ComputeHash(code)
+	assert.NoError(t, err)
+	assert.NotEqual(t, withInclude, withFile)
+
+	// The name of a file is part of the hash.
+	o.Files[0].Name = "other.h"
+	renamed, err := o.ComputeHash(code)
+	assert.NoError(t, err)
+	assert.NotEqual(t, withFile, renamed)
+
+	// As is its code.
+	o.Files[0].Code = "int three();"
+	changed, err := o.ComputeHash(code)
+	assert.NoError(t, err)
+	assert.NotEqual(t, renamed, changed)
+
+	o.Files[0].Code = "%:"
+	_, err = o.ComputeHash(code)
+	assert.Error(t, err)
+}
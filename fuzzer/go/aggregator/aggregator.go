@@ -3,6 +3,7 @@ package aggregator
 import (
 	"bytes"
 	"crypto/sha1"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -15,6 +16,7 @@ import (
 	"time"
 
 	"cloud.google.com/go/storage"
+	"go.skia.org/infra/fuzzer/go/bisect"
 	"go.skia.org/infra/fuzzer/go/common"
 	"go.skia.org/infra/fuzzer/go/config"
 	"go.skia.org/infra/fuzzer/go/data"
@@ -50,6 +52,9 @@ type Aggregator struct {
 	// Should be set if we want to upload grey fuzzes.  This should only be true
 	// if we are changing versions.
 	UploadGreyFuzzes bool
+	// If not nil, the bad fuzzes that bugs are created for are bisected to find the commits
+	// that introduced them.
+	Bisector *bisect.Bisector
 
 	storageClient *storage.Client
 
@@ -65,6 +70,8 @@ type Aggregator struct {
 
 	// maps category to its deduplicator
 	deduplicators map[string]deduplicator.Deduplicator
+	// maps category to how many fuzzes were in the last uploaded cluster report.
+	reportedClusterSizes map[string]int
 
 	// The shutdown channels are used to signal shutdowns.  There are two groups, to
 	// allow for a softer, cleaner shutdown w/ minimal lost work.
@@ -86,13 +93,19 @@ const (
 	EMPTY_THRESHOLD = 5
 )
 
-var (
-	CLANG_DEBUG   = common.TEST_HARNESS_NAME + "_clang_debug"
-	CLANG_RELEASE = common.TEST_HARNESS_NAME + "_clang_release"
-	ASAN_DEBUG    = common.TEST_HARNESS_NAME + "_asan_debug"
-	ASAN_RELEASE  = common.TEST_HARNESS_NAME + "_asan_release"
+// The suffixes of the analysis executables.  Each fuzz category is analyzed by the executables
+// named common.ExecutableName(category) + suffix, e.g. fuzz_clang_debug.
+const (
+	CLANG_DEBUG   = "_clang_debug"
+	CLANG_RELEASE = "_clang_release"
+	ASAN_DEBUG    = "_asan_debug"
+	ASAN_RELEASE  = "_asan_release"
 )
 
+// The prefixes of libFuzzer artifacts that are not crashes.  afl-fuzz puts the equivalent inputs
+// in hangs/, which we ignore.
+var libFuzzerNonCrashPrefixes = []string{"oom-", "timeout-", "slow-unit-"}
+
 // analysisPackage is a struct containing all the pieces of a fuzz needed to analyse it.
 type analysisPackage struct {
 	FilePath string
@@ -129,13 +142,20 @@ func StartAggregator(s *storage.Client, im *issues.IssuesManager, startingReport
 		UploadGreyFuzzes:   false,
 		deduplicators:      make(map[string]deduplicator.Deduplicator),
 		monitoringShutdown: make(chan bool, 2),
+
+		reportedClusterSizes: make(map[string]int),
 		// aggregationShutdown needs to be created with a calculated capacity in start
 	}
 
 	// preload the deduplicator
 	for _, category := range config.Generator.FuzzesToGenerate {
-		client := fstorage.NewFuzzerGCSClient(s, config.GCS.Bucket)
-		d := deduplicator.NewRemoteDeduplicator(client)
+		var d deduplicator.Deduplicator
+		if config.Aggregator.SimilarityThreshold > 0 {
+			d = deduplicator.NewSimilarityDeduplicator(config.Aggregator.SimilarityThreshold)
+		} else {
+			client := fstorage.NewFuzzerGCSClient(s, config.GCS.Bucket)
+			d = deduplicator.NewRemoteDeduplicator(client)
+		}
 		d.SetRevision(config.Common.SkiaVersion.Hash)
 		for report := range startingReports[category] {
 			d.IsUnique(report)
@@ -190,9 +210,10 @@ func (agg *Aggregator) start() error {
 	return nil
 }
 
-// buildAnalysisBinaries creates the 4 executables we need to perform analysis and makes a copy of
-// them in the executablePath.  We need (Debug,Release) x (Clang,ASAN).  The copied binaries have
-// a suffix like _clang_debug
+// buildAnalysisBinaries creates the 4 executables we need to perform analysis for each of the
+// executables needed by config.Generator.FuzzesToGenerate and makes a copy of them in the
+// executablePath.  We need (Debug,Release) x (Clang,ASAN).  The copied binaries have a suffix like
+// _clang_debug
 func (agg *Aggregator) buildAnalysisBinaries() error {
 	if _, err := fileutil.EnsureDirExists(config.Aggregator.FuzzPath); err != nil {
 		return err
@@ -200,25 +221,29 @@ func (agg *Aggregator) buildAnalysisBinaries() error {
 	if _, err := fileutil.EnsureDirExists(config.Aggregator.WorkingPath); err != nil {
 		return err
 	}
-	if srcExe, err := common.BuildClangHarness(buildskia.DEBUG_BUILD, true); err != nil {
-		return err
-	} else if err := fileutil.CopyExecutable(srcExe, filepath.Join(config.Aggregator.WorkingPath, CLANG_DEBUG)); err != nil {
-		return err
-	}
-	if srcExe, err := common.BuildClangHarness(buildskia.RELEASE_BUILD, true); err != nil {
-		return err
-	} else if err := fileutil.CopyExecutable(srcExe, filepath.Join(config.Aggregator.WorkingPath, CLANG_RELEASE)); err != nil {
-		return err
-	}
-	if srcExe, err := common.BuildASANHarness(buildskia.DEBUG_BUILD, false); err != nil {
-		return err
-	} else if err := fileutil.CopyExecutable(srcExe, filepath.Join(config.Aggregator.WorkingPath, ASAN_DEBUG)); err != nil {
-		return err
-	}
-	if srcExe, err := common.BuildASANHarness(buildskia.RELEASE_BUILD, false); err != nil {
-		return err
-	} else if err := fileutil.CopyExecutable(srcExe, filepath.Join(config.Aggregator.WorkingPath, ASAN_RELEASE)); err != nil {
-		return err
+	for i, target := range common.ExecutableNames(config.Generator.FuzzesToGenerate) {
+		// Only the first build of each build type needs to start from a clean output directory.
+		isClean := i == 0
+		if srcExe, err := common.BuildClangHarness(target, buildskia.DEBUG_BUILD, isClean); err != nil {
+			return err
+		} else if err := fileutil.CopyExecutable(srcExe, filepath.Join(config.Aggregator.WorkingPath, target+CLANG_DEBUG)); err != nil {
+			return err
+		}
+		if srcExe, err := common.BuildClangHarness(target, buildskia.RELEASE_BUILD, isClean); err != nil {
+			return err
+		} else if err := fileutil.CopyExecutable(srcExe, filepath.Join(config.Aggregator.WorkingPath, target+CLANG_RELEASE)); err != nil {
+			return err
+		}
+		if srcExe, err := common.BuildASANHarness(target, buildskia.DEBUG_BUILD, false); err != nil {
+			return err
+		} else if err := fileutil.CopyExecutable(srcExe, filepath.Join(config.Aggregator.WorkingPath, target+ASAN_DEBUG)); err != nil {
+			return err
+		}
+		if srcExe, err := common.BuildASANHarness(target, buildskia.RELEASE_BUILD, false); err != nil {
+			return err
+		} else if err := fileutil.CopyExecutable(srcExe, filepath.Join(config.Aggregator.WorkingPath, target+ASAN_RELEASE)); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -295,6 +320,7 @@ func (agg *Aggregator) scanHelper(alreadyFoundFuzzes *SortedStringSlice) error {
 //			-fuzzer_stats
 //		-fuzzer1/
 //		...
+// libFuzzer fuzzers are run so that their crashes end up in the same place.
 func findBadFuzzPaths(category string, alreadyFoundFuzzes *SortedStringSlice) ([]string, error) {
 	badFuzzPaths := make([]string, 0)
 
@@ -343,7 +369,7 @@ func findBadFuzzPaths(category string, alreadyFoundFuzzes *SortedStringSlice) ([
 				}
 				for _, crash := range crashContents {
 					// Make sure the files are actually crashable files we haven't found before
-					if crash.Name() != "README.txt" {
+					if isCrash(crash.Name()) {
 						if fuzzPath := filepath.Join(crashPath, crash.Name()); !alreadyFoundFuzzes.Contains(fuzzPath) {
 							badFuzzPaths = append(badFuzzPaths, fuzzPath)
 						}
@@ -355,13 +381,28 @@ func findBadFuzzPaths(category string, alreadyFoundFuzzes *SortedStringSlice) ([
 	return badFuzzPaths, nil
 }
 
+// isCrash returns true if the file with the given name, found in a crashes folder, is a crashing
+// input, as opposed to a README or a libFuzzer artifact that is not a crash.
+func isCrash(name string) bool {
+	if name == "README.txt" {
+		return false
+	}
+	for _, prefix := range libFuzzerNonCrashPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
 var aflMetrics = []string{"start_time", "last_update", "cycles_done", "execs_done", "execs_per_sec", "paths_total", "paths_found", "paths_imported", "stability"}
 
 var aflRegexps = make([]*regexp.Regexp, 0, len(aflMetrics))
 
 // collectFuzzerMetrics looks through the fuzzer_stats file in the main fuzzer output folder of
-// each fuzz category and extracts some key metrics from it.  The format of this file is
-// detailed in http://lcamtuf.coredump.cx/afl/status_screen.txt
+// each afl-fuzz fuzz category and extracts some key metrics from it.  The format of this file is
+// detailed in http://lcamtuf.coredump.cx/afl/status_screen.txt  libFuzzer does not write a stats
+// file, so libFuzzer categories are skipped.
 func collectFuzzerMetrics() error {
 	// Compile the regexps for the metrics once
 	if len(aflRegexps) == 0 {
@@ -375,6 +416,9 @@ func collectFuzzerMetrics() error {
 	}
 
 	for _, category := range config.Generator.FuzzesToGenerate {
+		if common.Generator(category) != common.GENERATOR_AFL {
+			continue
+		}
 		statsFile := filepath.Join(config.Generator.AflOutputPath, category, "fuzzer0", "fuzzer_stats")
 		b, err := ioutil.ReadFile(statsFile)
 		if err != nil {
@@ -455,18 +499,13 @@ func setupAnalysis(workingDirPath string) error {
 		return err
 	}
 
-	// make a copy of the 4 executables that were made in buildAnalysisBinaries()
-	if err := fileutil.CopyExecutable(filepath.Join(config.Aggregator.WorkingPath, CLANG_DEBUG), filepath.Join(workingDirPath, CLANG_DEBUG)); err != nil {
-		return err
-	}
-	if err := fileutil.CopyExecutable(filepath.Join(config.Aggregator.WorkingPath, CLANG_RELEASE), filepath.Join(workingDirPath, CLANG_RELEASE)); err != nil {
-		return err
-	}
-	if err := fileutil.CopyExecutable(filepath.Join(config.Aggregator.WorkingPath, ASAN_DEBUG), filepath.Join(workingDirPath, ASAN_DEBUG)); err != nil {
-		return err
-	}
-	if err := fileutil.CopyExecutable(filepath.Join(config.Aggregator.WorkingPath, ASAN_RELEASE), filepath.Join(workingDirPath, ASAN_RELEASE)); err != nil {
-		return err
+	// make a copy of the executables that were made in buildAnalysisBinaries()
+	for _, target := range common.ExecutableNames(config.Generator.FuzzesToGenerate) {
+		for _, suffix := range []string{CLANG_DEBUG, CLANG_RELEASE, ASAN_DEBUG, ASAN_RELEASE} {
+			if err := fileutil.CopyExecutable(filepath.Join(config.Aggregator.WorkingPath, target+suffix), filepath.Join(workingDirPath, target+suffix)); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -484,26 +523,27 @@ func analyze(workingDirPath, filename, category string) (uploadPackage, error) {
 		FilePath: filepath.Join(config.Aggregator.FuzzPath, filename),
 		Category: category,
 	}
+	exe := common.ExecutableName(category)
 
-	if dump, stderr, err := performAnalysis(workingDirPath, CLANG_DEBUG, upload.FilePath, category); err != nil {
+	if dump, stderr, err := performAnalysis(workingDirPath, exe+CLANG_DEBUG, upload.FilePath, category); err != nil {
 		return upload, err
 	} else {
 		upload.Data.Debug.Dump = dump
 		upload.Data.Debug.StdErr = stderr
 	}
-	if dump, stderr, err := performAnalysis(workingDirPath, CLANG_RELEASE, upload.FilePath, category); err != nil {
+	if dump, stderr, err := performAnalysis(workingDirPath, exe+CLANG_RELEASE, upload.FilePath, category); err != nil {
 		return upload, err
 	} else {
 		upload.Data.Release.Dump = dump
 		upload.Data.Release.StdErr = stderr
 	}
 	// AddressSanitizer only outputs to stderr
-	if _, stderr, err := performAnalysis(workingDirPath, ASAN_DEBUG, upload.FilePath, category); err != nil {
+	if _, stderr, err := performAnalysis(workingDirPath, exe+ASAN_DEBUG, upload.FilePath, category); err != nil {
 		return upload, err
 	} else {
 		upload.Data.Debug.Asan = stderr
 	}
-	if _, stderr, err := performAnalysis(workingDirPath, ASAN_RELEASE, upload.FilePath, category); err != nil {
+	if _, stderr, err := performAnalysis(workingDirPath, exe+ASAN_RELEASE, upload.FilePath, category); err != nil {
 		return upload, err
 	} else {
 		upload.Data.Release.Asan = stderr
@@ -708,6 +748,11 @@ func (agg *Aggregator) bugReportingHelper(p bugReportingPackage) error {
 		sklog.Infof("Creating bug for %s", p.Data.FuzzName)
 		if err := agg.issueManager.CreateBadBugIssue(p.Data, "Crash found on 'stable' fuzzer"); err != nil {
 			sklog.Errorf("Error while creating issue for bad fuzz: %s", err)
+		} else if agg.Bisector != nil {
+			fuzzPath := filepath.Join(config.Aggregator.FuzzPath, p.Data.FuzzName)
+			if err := agg.Bisector.Bisect(p.Data.Category, p.Data.FuzzName, fuzzPath, p.Data.CommitRevision); err != nil {
+				sklog.Errorf("Could not bisect bad fuzz: %s", err)
+			}
 		}
 	}
 	return nil
@@ -734,10 +779,53 @@ func (agg *Aggregator) monitorStatus(numAnalysisProcesses, numUploadProcesses in
 			metrics2.GetInt64Metric("fuzzer_queue_size_analysis", nil).Update(int64(len(agg.forAnalysis)))
 			metrics2.GetInt64Metric("fuzzer_queue_size_upload", nil).Update(int64(len(agg.forUpload)))
 			metrics2.GetInt64Metric("fuzzer_queue_size_bug-report", nil).Update(int64(len(agg.forBugReporting)))
+			agg.uploadClusterReports()
 		}
 	}
 }
 
+// uploadClusterReports uploads the report of every deduplicator that clusters fuzzes and has
+// seen new fuzzes since its report was last uploaded.  The reports go next to the fuzzes,
+// as clusters.txt for groomers and clusters.json for tools.
+func (agg *Aggregator) uploadClusterReports() {
+	for category, d := range agg.deduplicators {
+		cr, ok := d.(deduplicator.ClusterReporter)
+		if !ok {
+			continue
+		}
+		r := cr.ClusterReport()
+		if r.NumFuzzes == agg.reportedClusterSizes[category] {
+			continue
+		}
+		js, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			sklog.Errorf("Could not encode %s cluster report: %s", category, err)
+			continue
+		}
+		prefix := fmt.Sprintf("%s/%s/%s/clusters", category, r.Revision, config.Generator.Architecture)
+		if err := agg.uploadReport(prefix+".txt", []byte(r.String())); err != nil {
+			sklog.Errorf("Could not upload %s cluster report: %s", category, err)
+			continue
+		}
+		if err := agg.uploadReport(prefix+".json", js); err != nil {
+			sklog.Errorf("Could not upload %s cluster report: %s", category, err)
+			continue
+		}
+		agg.reportedClusterSizes[category] = r.NumFuzzes
+	}
+}
+
+// uploadReport uploads the contents as a text file with the given name to GCS.
+func (agg *Aggregator) uploadReport(name string, contents []byte) error {
+	w := agg.storageClient.Bucket(config.GCS.Bucket).Object(name).NewWriter(context.Background())
+	w.ObjectAttrs.ContentEncoding = "text/plain"
+	if n, err := w.Write(contents); err != nil {
+		util.Close(w)
+		return fmt.Errorf("There was a problem uploading %s.  Only uploaded %d bytes: %s", name, n, err)
+	}
+	return w.Close()
+}
+
 // Shutdown gracefully shuts down the aggregator. Anything that was being processed will finish
 // prior to the shutdown.
 func (agg *Aggregator) ShutDown() {
@@ -764,6 +852,7 @@ func (agg *Aggregator) RestartAnalysis() error {
 	for _, d := range agg.deduplicators {
 		d.SetRevision(config.Common.SkiaVersion.Hash)
 	}
+	agg.reportedClusterSizes = make(map[string]int)
 	return agg.start()
 }
 
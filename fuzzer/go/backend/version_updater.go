@@ -10,10 +10,12 @@ import (
 	"go.skia.org/infra/fuzzer/go/config"
 	"go.skia.org/infra/fuzzer/go/download_skia"
 	"go.skia.org/infra/fuzzer/go/generator"
+	"go.skia.org/infra/fuzzer/go/issues"
 	fstorage "go.skia.org/infra/fuzzer/go/storage"
 	"go.skia.org/infra/go/gcs"
 	"go.skia.org/infra/go/metrics2"
 	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
 	"golang.org/x/net/context"
 )
 
@@ -24,14 +26,17 @@ type VersionUpdater struct {
 	aggregator    *aggregator.Aggregator
 	// There is one of these for every fuzz category.
 	generators []*generator.Generator
+	// Used to report fuzzes that were fixed or regressed on their bugs.  May be nil.
+	issueManager *issues.IssuesManager
 }
 
 // NewVersionUpdater creates a VersionUpdater
-func NewVersionUpdater(s fstorage.FuzzerGCSClient, agg *aggregator.Aggregator, g []*generator.Generator) *VersionUpdater {
+func NewVersionUpdater(s fstorage.FuzzerGCSClient, agg *aggregator.Aggregator, g []*generator.Generator, im *issues.IssuesManager) *VersionUpdater {
 	return &VersionUpdater{
 		storageClient: s,
 		aggregator:    agg,
 		generators:    g,
+		issueManager:  im,
 	}
 }
 
@@ -123,6 +128,10 @@ func (v *VersionUpdater) reanalyze(oldRevision string) error {
 			v.aggregator.ForceAnalysis(name, category)
 		}
 		v.aggregator.WaitForEmptyQueues()
+		// The bad fuzzes that are now grey no longer crash, i.e. they were fixed.
+		stillBad, fixed, _ := v.aggregator.UploadedFuzzNames()
+		stillBad = append([]string{}, stillBad...)
+		v.markFixed(category, fixed)
 		sklog.Infof("Reanalyzing grey %s fuzzes", category)
 		v.aggregator.MakeBugOnBadFuzz = true
 		v.aggregator.WatchForRegressions = true
@@ -134,6 +143,7 @@ func (v *VersionUpdater) reanalyze(oldRevision string) error {
 		v.aggregator.MakeBugOnBadFuzz = true
 		v.aggregator.UploadGreyFuzzes = false
 		bad, grey, deduped := v.aggregator.UploadedFuzzNames()
+		v.markRegressed(category, util.NewStringSet(bad).Complement(util.NewStringSet(stillBad)).Keys())
 		sklog.Infof("Done reanalyzing %s.  Uploaded %d bad and %d grey fuzzes.  There were %d duplicate bad fuzzes that were skipped.", category, len(bad), len(grey), len(deduped))
 		metrics2.GetInt64Metric("fuzzer_fuzzes_status", map[string]string{"category": category, "architecture": config.Generator.Architecture, "status": "bad"}).Update(int64(len(bad)))
 		metrics2.GetInt64Metric("fuzzer_fuzzes_status", map[string]string{"category": category, "architecture": config.Generator.Architecture, "status": "grey"}).Update(int64(len(grey)))
@@ -147,6 +157,61 @@ func (v *VersionUpdater) reanalyze(oldRevision string) error {
 	return nil
 }
 
+// markFixed records that the given fuzzes, which crashed at the previous revision but not at the
+// current one, were fixed, and reports it on their bugs.
+func (v *VersionUpdater) markFixed(category string, names []string) {
+	revision := config.Common.SkiaVersion.Hash
+	for _, name := range names {
+		h, err := fstorage.GetFuzzHistory(v.storageClient, category, config.Generator.Architecture, name)
+		if err != nil {
+			sklog.Errorf("Could not mark %s as fixed: %s", name, err)
+			continue
+		}
+		if h.FixedRevision != "" {
+			continue
+		}
+		h.FixedRevision = revision
+		if err := fstorage.SetFuzzHistory(v.storageClient, category, config.Generator.Architecture, name, h); err != nil {
+			sklog.Errorf("Could not mark %s as fixed: %s", name, err)
+			continue
+		}
+		sklog.Infof("%s fuzz %s was fixed as of %s", category, name, revision)
+		if v.issueManager != nil {
+			if _, err := v.issueManager.CommentOnFuzzIssues(name, issues.FixedMessage(h)); err != nil {
+				sklog.Errorf("Could not report %s as fixed: %s", name, err)
+			}
+		}
+	}
+	metrics2.GetInt64Metric("fuzzer_fuzzes_fixed", map[string]string{"category": category, "architecture": config.Generator.Architecture}).Update(int64(len(names)))
+}
+
+// markRegressed clears the FixedRevision of any of the given fuzzes, which crash at the current
+// revision, that had been marked as fixed, and reports it on their bugs.
+func (v *VersionUpdater) markRegressed(category string, names []string) {
+	revision := config.Common.SkiaVersion.Hash
+	for _, name := range names {
+		h, err := fstorage.GetFuzzHistory(v.storageClient, category, config.Generator.Architecture, name)
+		if err != nil {
+			sklog.Errorf("Could not check if %s had been fixed: %s", name, err)
+			continue
+		}
+		if h.FixedRevision == "" {
+			continue
+		}
+		h.FixedRevision = ""
+		if err := fstorage.SetFuzzHistory(v.storageClient, category, config.Generator.Architecture, name, h); err != nil {
+			sklog.Errorf("Could not mark %s as regressed: %s", name, err)
+			continue
+		}
+		sklog.Infof("%s fuzz %s crashes again as of %s", category, name, revision)
+		if v.issueManager != nil {
+			if _, err := v.issueManager.CommentOnFuzzIssues(name, issues.RegressedMessage(revision)); err != nil {
+				sklog.Errorf("Could not report %s as regressed: %s", name, err)
+			}
+		}
+	}
+}
+
 // downloadAllBadAndGreyFuzzes downloads just the fuzzes from a commit in GCS. It uses multiple
 // processes to do so and puts them in config.Aggregator.FuzzPath/[category].
 func downloadAllBadAndGreyFuzzes(commitHash, category string, storageClient fstorage.FuzzerGCSClient) (badFuzzPaths []string, greyFuzzPaths []string, err error) {
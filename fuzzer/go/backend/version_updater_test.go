@@ -27,7 +27,7 @@ func TestReportWorkDone(t *testing.T) {
 	common.SetMockCommon(mc)
 
 	// The nil arguments shouldn't be needed in reportWorkDone
-	v := NewVersionUpdater(mg, nil, nil)
+	v := NewVersionUpdater(mg, nil, nil, nil)
 
 	mg.On("DeleteFile", ctx, "skia_version/pending/working_skia-fuzzer-be-3").Return(nil).Once()
 	mg.On("AllFilesInDirectory", ctx, "skia_version/pending/working_", callback).Run(func(args mock.Arguments) {
@@ -51,7 +51,7 @@ func TestReportWorkDoneLastStanding(t *testing.T) {
 	common.SetMockCommon(mc)
 
 	// The nil arguments shouldn't be needed in reportWorkDone
-	v := NewVersionUpdater(mg, nil, nil)
+	v := NewVersionUpdater(mg, nil, nil, nil)
 
 	mg.On("DeleteFile", ctx, "skia_version/pending/working_skia-fuzzer-be-3").Return(nil).Once()
 	// Suppose there are no other backend workers left (and thus no files)
@@ -76,7 +76,7 @@ func TestReportWorkDone404(t *testing.T) {
 	common.SetMockCommon(mc)
 
 	// The nil arguments shouldn't be needed in reportWorkDone
-	v := NewVersionUpdater(mg, nil, nil)
+	v := NewVersionUpdater(mg, nil, nil, nil)
 
 	err := fmt.Errorf("Got non server error statuscode 404")
 	mg.On("DeleteFile", ctx, "skia_version/pending/working_skia-fuzzer-be-3").Return(err).Once()
@@ -0,0 +1,275 @@
+package bisect
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.skia.org/infra/fuzzer/go/common"
+	"go.skia.org/infra/fuzzer/go/config"
+	"go.skia.org/infra/fuzzer/go/data"
+	"go.skia.org/infra/fuzzer/go/download_skia"
+	"go.skia.org/infra/fuzzer/go/issues"
+	fstorage "go.skia.org/infra/fuzzer/go/storage"
+	"go.skia.org/infra/go/exec"
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/go/vcsinfo"
+)
+
+// QUEUE_SIZE is the maximum number of fuzzes waiting to be bisected.  Bisecting takes a while, so
+// if more bad fuzzes than this are found in a short time, the extra ones are not bisected.
+const QUEUE_SIZE = 100
+
+// Bisector finds the commits that introduced bad fuzzes.  It checks out, builds and runs older
+// revisions of Skia in its own checkout, config.Bisect.SkiaRoot, so it does not disturb the
+// revision under fuzz.  The results are stored as each fuzz's data.FuzzHistory and commented on
+// the fuzz's bugs.  Fuzzes are bisected one at a time, in the background.
+type Bisector struct {
+	storageClient fstorage.FuzzerGCSClient
+	issueManager  *issues.IssuesManager
+	queue         chan request
+	queueSize     metrics2.Int64Metric
+}
+
+// request is a fuzz waiting to be bisected.
+type request struct {
+	Category string
+	FuzzName string
+	// FuzzPath is the path to the Bisector's own copy of the fuzz.
+	FuzzPath string
+	// Revision is the revision of Skia the fuzz was found to crash at.
+	Revision string
+}
+
+// New creates a new Bisector.  Start must be called before any fuzzes are bisected.
+func New(s fstorage.FuzzerGCSClient, im *issues.IssuesManager) *Bisector {
+	return &Bisector{
+		storageClient: s,
+		issueManager:  im,
+		queue:         make(chan request, QUEUE_SIZE),
+		queueSize:     metrics2.GetInt64Metric("fuzzer_queue_size_bisect", nil),
+	}
+}
+
+// Start starts the goroutine that bisects the queued fuzzes.
+func (b *Bisector) Start() {
+	go func() {
+		for r := range b.queue {
+			b.queueSize.Update(int64(len(b.queue)))
+			if err := b.process(r); err != nil {
+				sklog.Errorf("Could not bisect %s fuzz %s: %s", r.Category, r.FuzzName, err)
+				metrics2.GetCounter("fuzzer_bisect_failures", nil).Inc(1)
+			}
+		}
+	}()
+}
+
+// Bisect queues up the given fuzz to be bisected.  fuzzPath is the path to the fuzz on disk,
+// which is copied, so it can be removed once Bisect returns.  revision is the revision of Skia the
+// fuzz was found to crash at.  If the queue is full, the fuzz is not bisected.
+func (b *Bisector) Bisect(category, fuzzName, fuzzPath, revision string) error {
+	contents, err := ioutil.ReadFile(fuzzPath)
+	if err != nil {
+		return fmt.Errorf("Could not read fuzz %s: %s", fuzzPath, err)
+	}
+	r := request{
+		Category: category,
+		FuzzName: fuzzName,
+		FuzzPath: filepath.Join(config.Bisect.WorkingPath, fuzzName),
+		Revision: revision,
+	}
+	if err := ioutil.WriteFile(r.FuzzPath, contents, 0644); err != nil {
+		return fmt.Errorf("Could not copy fuzz to %s: %s", r.FuzzPath, err)
+	}
+	select {
+	case b.queue <- r:
+		b.queueSize.Update(int64(len(b.queue)))
+		return nil
+	default:
+		util.Remove(r.FuzzPath)
+		return fmt.Errorf("Bisection queue is full, not bisecting %s", fuzzName)
+	}
+}
+
+// process bisects the requested fuzz, stores the result in the fuzz's history and reports it on
+// the fuzz's bugs.
+func (b *Bisector) process(r request) error {
+	defer util.Remove(r.FuzzPath)
+	sklog.Infof("Bisecting %s fuzz %s from %s", r.Category, r.FuzzName, r.Revision)
+	commits, err := b.commits(r.Revision)
+	if err != nil {
+		return err
+	}
+	introduced, lastGood, err := findCulprit(commits, func(revision string) (bool, error) {
+		return b.reproduces(r.Category, r.FuzzPath, revision)
+	})
+	if err != nil {
+		return err
+	}
+	sklog.Infof("Bisected %s fuzz %s to (%s, %s]", r.Category, r.FuzzName, lastGood, introduced)
+
+	h, err := fstorage.GetFuzzHistory(b.storageClient, r.Category, config.Generator.Architecture, r.FuzzName)
+	if err != nil {
+		return err
+	}
+	h.IntroducedRevision = introduced
+	h.LastGoodRevision = lastGood
+	h.BisectedAt = r.Revision
+	if err := fstorage.SetFuzzHistory(b.storageClient, r.Category, config.Generator.Architecture, r.FuzzName, h); err != nil {
+		return err
+	}
+	if b.issueManager != nil {
+		if _, err := b.issueManager.CommentOnFuzzIssues(r.FuzzName, issues.BisectedMessage(h)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commits returns the config.Bisect.MaxCommits first-parent commits leading up to and including
+// revision, ordered from oldest to newest.
+func (b *Bisector) commits(revision string) ([]string, error) {
+	// Make sure the checkout exists and knows about revision.
+	if err := download_skia.AtRevision("origin/master", config.Bisect.SkiaRoot, checkoutVersion{}, false); err != nil {
+		sklog.Warningf("Could not update the bisection checkout, trying to continue anyway: %s", err)
+	}
+	repo := filepath.Join(config.Bisect.SkiaRoot, "skia")
+	if _, err := exec.RunCwd(repo, "git", "fetch", "origin"); err != nil {
+		return nil, fmt.Errorf("Could not fetch Skia in %s: %s", repo, err)
+	}
+	output, err := exec.RunCwd(repo, "git", "rev-list", "--first-parent", "-n", strconv.Itoa(config.Bisect.MaxCommits), revision)
+	if err != nil {
+		return nil, fmt.Errorf("Could not list the commits before %s: %s", revision, err)
+	}
+	commits := strings.Split(strings.TrimSpace(output), "\n")
+	// rev-list lists the newest commits first.
+	for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+		commits[i], commits[j] = commits[j], commits[i]
+	}
+	return commits, nil
+}
+
+// reproduces checks out the given revision of Skia, builds it and returns true if the fuzz at
+// fuzzPath crashes it.  It returns an error if the revision could not be tested, e.g. because it
+// does not build.
+func (b *Bisector) reproduces(category, fuzzPath, revision string) (bool, error) {
+	if err := download_skia.AtRevision(revision, config.Bisect.SkiaRoot, checkoutVersion{}, false); err != nil {
+		return false, fmt.Errorf("Could not check out %s: %s", revision, err)
+	}
+	target := common.ExecutableName(category)
+	clangExe, err := common.BuildSkia(config.Bisect.SkiaRoot, target, false)
+	if err != nil {
+		return false, fmt.Errorf("Could not build %s at %s: %s", target, revision, err)
+	}
+	asanExe, err := common.BuildSkia(config.Bisect.SkiaRoot, target, true)
+	if err != nil {
+		return false, fmt.Errorf("Could not build ASAN %s at %s: %s", target, revision, err)
+	}
+
+	// Only the Release build is used, so the empty Debug results count as grey.
+	g := data.GCSPackage{
+		Name:         filepath.Base(fuzzPath),
+		FuzzCategory: category,
+	}
+	g.Release.Dump, g.Release.StdErr = run(clangExe, category, fuzzPath)
+	_, g.Release.Asan = run(asanExe, category, fuzzPath)
+	result := data.ParseGCSPackage(g)
+	sklog.Infof("At %s, %s has flags %s", revision, g.Name, result.Release.Flags)
+	return !result.IsGrey(), nil
+}
+
+// run runs the executable on the fuzz the same way the aggregator analyzes fuzzes, and returns
+// the crash dump and standard error.
+func run(executable, category, fuzzPath string) (string, string) {
+	var dump bytes.Buffer
+	var stdErr bytes.Buffer
+	cmd := &exec.Command{
+		Name:        "timeout",
+		Args:        common.AnalysisArgsFor(category, executable, fuzzPath),
+		Stdout:      &dump,
+		Stderr:      &stdErr,
+		Dir:         config.Bisect.WorkingPath,
+		InheritPath: true,
+		Env:         []string{common.ASAN_OPTIONS},
+		Verbose:     exec.Debug,
+	}
+	// Errors are expected, as the fuzz may crash.
+	_ = exec.Run(cmd)
+	return dump.String(), stdErr.String()
+}
+
+// findCulprit bisects commits, which are ordered from oldest to newest and whose newest commit is
+// known to crash, to find the oldest commit that crashes.  reproduces returns whether or not a
+// commit crashes, or an error if the commit could not be tested, in which case it is skipped.  It
+// returns the oldest commit found to crash and the newest commit before it found not to crash.
+// If the oldest testable commit crashes, the second is "".
+func findCulprit(commits []string, reproduces func(string) (bool, error)) (string, string, error) {
+	if len(commits) == 0 {
+		return "", "", fmt.Errorf("No commits to bisect")
+	}
+	bad := len(commits) - 1
+	good := -1
+	// Find the oldest testable commit, which hopefully does not crash.
+	for i := 0; i < bad; i++ {
+		crashes, err := reproduces(commits[i])
+		if err != nil {
+			sklog.Warningf("Skipping %s: %s", commits[i], err)
+			continue
+		}
+		if crashes {
+			return commits[i], "", nil
+		}
+		good = i
+		break
+	}
+	if good < 0 {
+		return "", "", fmt.Errorf("None of the %d commits before %s could be tested", bad, commits[bad])
+	}
+
+	untestable := map[int]bool{}
+	for bad-good > 1 {
+		mid, ok := pick(good, bad, untestable)
+		if !ok {
+			// Everything between good and bad is untestable.
+			break
+		}
+		crashes, err := reproduces(commits[mid])
+		if err != nil {
+			sklog.Warningf("Skipping %s: %s", commits[mid], err)
+			untestable[mid] = true
+			continue
+		}
+		if crashes {
+			bad = mid
+		} else {
+			good = mid
+		}
+	}
+	return commits[bad], commits[good], nil
+}
+
+// pick returns the index between good and bad, exclusive, closest to the middle that has not been
+// found to be untestable, and false if there is none.
+func pick(good, bad int, untestable map[int]bool) (int, bool) {
+	mid := (good + bad) / 2
+	for d := 0; mid-d > good || mid+d < bad; d++ {
+		if i := mid + d; i < bad && !untestable[i] {
+			return i, true
+		}
+		if i := mid - d; i > good && !untestable[i] {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// checkoutVersion is a config.VersionSetter for the bisection checkout, whose revision does not
+// need to be kept track of.
+type checkoutVersion struct{}
+
+func (checkoutVersion) SetSkiaVersion(lc *vcsinfo.LongCommit) {}
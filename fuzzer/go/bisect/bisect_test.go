@@ -0,0 +1,103 @@
+package bisect
+
+import (
+	"fmt"
+	"testing"
+
+	"go.skia.org/infra/go/testutils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testCommits = []string{"c0", "c1", "c2", "c3", "c4", "c5", "c6", "c7", "c8", "c9"}
+
+// reproducer returns a reproduces function for findCulprit where the commits from culprit on
+// crash and the commits in broken can't be tested.  It also returns the list of tested commits.
+func reproducer(culprit int, broken ...int) (func(string) (bool, error), *[]string) {
+	tested := []string{}
+	return func(c string) (bool, error) {
+		tested = append(tested, c)
+		for i, commit := range testCommits {
+			if commit != c {
+				continue
+			}
+			for _, b := range broken {
+				if b == i {
+					return false, fmt.Errorf("%s does not build", c)
+				}
+			}
+			return i >= culprit, nil
+		}
+		return false, fmt.Errorf("Unknown commit %s", c)
+	}, &tested
+}
+
+func TestFindCulprit(t *testing.T) {
+	testutils.SmallTest(t)
+	for culprit := 1; culprit < len(testCommits); culprit++ {
+		r, tested := reproducer(culprit)
+		introduced, lastGood, err := findCulprit(testCommits, r)
+		assert.NoError(t, err)
+		assert.Equal(t, testCommits[culprit], introduced)
+		assert.Equal(t, testCommits[culprit-1], lastGood)
+		// The oldest commit is tested first, then it's a binary search.
+		assert.True(t, len(*tested) <= 5, "Tested too many commits: %q", *tested)
+	}
+}
+
+func TestFindCulpritOldestCrashes(t *testing.T) {
+	testutils.SmallTest(t)
+	r, tested := reproducer(0)
+	introduced, lastGood, err := findCulprit(testCommits, r)
+	assert.NoError(t, err)
+	assert.Equal(t, "c0", introduced)
+	assert.Equal(t, "", lastGood)
+	assert.Equal(t, []string{"c0"}, *tested)
+
+	// The oldest commits don't build.
+	r, tested = reproducer(3, 0, 1)
+	introduced, lastGood, err = findCulprit(testCommits, r)
+	assert.NoError(t, err)
+	assert.Equal(t, "c3", introduced)
+	assert.Equal(t, "c2", lastGood)
+	assert.Equal(t, []string{"c0", "c1", "c2"}, (*tested)[:3])
+}
+
+func TestFindCulpritUntestable(t *testing.T) {
+	testutils.SmallTest(t)
+	// c4 and c5 don't build, so the culprit could be c4, c5 or c6.
+	r, _ := reproducer(5, 4, 5)
+	introduced, lastGood, err := findCulprit(testCommits, r)
+	assert.NoError(t, err)
+	assert.Equal(t, "c6", introduced)
+	assert.Equal(t, "c3", lastGood)
+
+	// Nothing builds.
+	r, _ = reproducer(5, 0, 1, 2, 3, 4, 5, 6, 7, 8)
+	_, _, err = findCulprit(testCommits, r)
+	assert.Error(t, err)
+
+	_, _, err = findCulprit([]string{}, r)
+	assert.Error(t, err)
+}
+
+func TestPick(t *testing.T) {
+	testutils.SmallTest(t)
+	i, ok := pick(0, 10, map[int]bool{})
+	assert.True(t, ok)
+	assert.Equal(t, 5, i)
+
+	i, ok = pick(0, 10, map[int]bool{5: true})
+	assert.True(t, ok)
+	assert.Equal(t, 6, i)
+
+	i, ok = pick(0, 10, map[int]bool{5: true, 6: true})
+	assert.True(t, ok)
+	assert.Equal(t, 4, i)
+
+	_, ok = pick(3, 6, map[int]bool{4: true, 5: true})
+	assert.False(t, ok)
+
+	_, ok = pick(3, 4, map[int]bool{})
+	assert.False(t, ok)
+}
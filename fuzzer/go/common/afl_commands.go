@@ -17,6 +17,8 @@ type GenerationArgs []string
 // GNU timeout is used instead of the option on exec.Command because experimentation with the latter
 // showed evidence of that way leaking processes, which lead to OOM errors. GNU catchsegv generates
 // human readable dumps of crashes, which can then be scanned for stacktrace information.
+// libFuzzer executables run a single file when given its path, but are told not to install their
+// own signal handlers, so that the crash output looks like that of the AFL test harness.
 func AnalysisArgsFor(category string, pathToExecutable, pathToFile string) AnalysisArgs {
 	timeoutInSeconds := fmt.Sprintf("%ds", config.Aggregator.AnalysisTimeout/time.Second)
 	f, found := fuzzers[category]
@@ -25,6 +27,9 @@ func AnalysisArgsFor(category string, pathToExecutable, pathToFile string) Analy
 		return nil
 	}
 	cmd := append([]string{timeoutInSeconds, "catchsegv", pathToExecutable}, f.ArgsAfterExecutable...)
+	if f.Generator == GENERATOR_LIBFUZZER {
+		cmd = append(cmd, LIBFUZZER_ANALYSIS_ARGS...)
+	}
 	return append(cmd, pathToFile)
 }
 
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"go.skia.org/infra/fuzzer/go/config"
 	"go.skia.org/infra/go/buildskia"
@@ -12,29 +13,49 @@ import (
 	"go.skia.org/infra/go/sklog"
 )
 
-// BuildClangHarness builds the test harness for fuzzing using clang, pulling it from the executable
-// cache if possible.  It returns the path to the executable (which should be copied somewhere else)
-// and any error.
-func BuildClangHarness(buildType buildskia.ReleaseType, isClean bool) (string, error) {
-	sklog.Infof("Building %s clang harness, or fetching from cache", buildType)
+// BuildClangHarness builds the given executable, i.e. TEST_HARNESS_NAME or a libFuzzer target,
+// using clang, pulling it from the executable cache if possible.  It returns the path to the
+// executable (which should be copied somewhere else) and any error.
+func BuildClangHarness(target string, buildType buildskia.ReleaseType, isClean bool) (string, error) {
+	sklog.Infof("Building %s clang %s, or fetching from cache", buildType, target)
 	buildArgs := []string{
 		fmt.Sprintf("cc=%q", config.Common.ClangPath),
 		fmt.Sprintf("cxx=%q", config.Common.ClangPlusPlusPath),
 	}
-	return buildOrGetCachedHarness("clang", buildType, isClean, buildArgs)
+	return buildOrGetCachedHarness(config.Common.SkiaRoot, target, "clang", buildType, isClean, buildArgs, nil)
 }
 
-// BuildASANHarness builds the test harness for fuzzing using clang and AddressSanitizer, pulling it
-// from the executable cache if possible.  It returns the path to the executable (which should be
-// copied somewhere else) and any error.
-func BuildASANHarness(buildType buildskia.ReleaseType, isClean bool) (string, error) {
-	sklog.Infof("Building %s ASAN harness, or fetching from cache", buildType)
+// BuildASANHarness builds the given executable, i.e. TEST_HARNESS_NAME or a libFuzzer target,
+// using clang and AddressSanitizer, pulling it from the executable cache if possible.  It returns
+// the path to the executable (which should be copied somewhere else) and any error.
+func BuildASANHarness(target string, buildType buildskia.ReleaseType, isClean bool) (string, error) {
+	sklog.Infof("Building %s ASAN %s, or fetching from cache", buildType, target)
 	buildArgs := []string{
 		fmt.Sprintf("cc=%q", config.Common.ClangPath),
 		fmt.Sprintf("cxx=%q", config.Common.ClangPlusPlusPath),
 		`sanitize="ASAN"`,
 	}
-	return buildOrGetCachedHarness("asan", buildType, isClean, buildArgs)
+	return buildOrGetCachedHarness(config.Common.SkiaRoot, target, "asan", buildType, isClean, buildArgs, nil)
+}
+
+// BuildSkia builds a Release version of the given executable, i.e. TEST_HARNESS_NAME or a
+// libFuzzer target, of the Skia checkout in skiaRoot using clang, with AddressSanitizer if asan is
+// true.  Unlike the other Build functions, skiaRoot need not be config.Common.SkiaRoot, so this can
+// build revisions other than the one under fuzz.  The build is pulled from the executable cache if
+// possible.  It returns the path to the executable (which should be copied somewhere else) and any
+// error.
+func BuildSkia(skiaRoot, target string, asan bool) (string, error) {
+	buildName := "clang"
+	buildArgs := []string{
+		fmt.Sprintf("cc=%q", config.Common.ClangPath),
+		fmt.Sprintf("cxx=%q", config.Common.ClangPlusPlusPath),
+	}
+	if asan {
+		buildName = "asan"
+		buildArgs = append(buildArgs, `sanitize="ASAN"`)
+	}
+	sklog.Infof("Building %s %s in %s, or fetching from cache", buildName, target, skiaRoot)
+	return buildOrGetCachedHarness(skiaRoot, target, buildName, buildskia.RELEASE_BUILD, false, buildArgs, nil)
 }
 
 // BuildFuzzingHarness builds the test harness for fuzzing using afl-instrumented clang, pulling it
@@ -47,7 +68,21 @@ func BuildFuzzingHarness(buildType buildskia.ReleaseType, isClean bool) (string,
 		fmt.Sprintf("cxx=%q", filepath.Join(config.Generator.AflRoot, "afl-clang-fast++")),
 	}
 
-	return buildOrGetCachedHarness("afl-instrumented", buildType, isClean, buildArgs)
+	return buildOrGetCachedHarness(config.Common.SkiaRoot, TEST_HARNESS_NAME, "afl-instrumented", buildType, isClean, buildArgs, nil)
+}
+
+// BuildLibFuzzerHarness builds the given libFuzzer target for fuzzing, using clang with
+// AddressSanitizer and libFuzzer's coverage instrumentation, pulling it from the executable cache
+// if possible.  It returns the path to the executable (which should be copied somewhere else) and
+// any error.
+func BuildLibFuzzerHarness(target string, buildType buildskia.ReleaseType, isClean bool) (string, error) {
+	sklog.Infof("Building %s libFuzzer %s, or fetching from cache", buildType, target)
+	buildArgs := []string{
+		fmt.Sprintf("cc=%q", config.Common.ClangPath),
+		fmt.Sprintf("cxx=%q", config.Common.ClangPlusPlusPath),
+		`sanitize="ASAN"`,
+	}
+	return buildOrGetCachedHarness(config.Common.SkiaRoot, target, "libfuzzer-instrumented", buildType, isClean, buildArgs, []string{"-fsanitize=fuzzer-no-link"})
 }
 
 // buildOrGetCachedHarness first looks into the ExecutableCache for a already built binary.  If it
@@ -57,19 +92,28 @@ func BuildFuzzingHarness(buildType buildskia.ReleaseType, isClean bool) (string,
 // buildName is a human friendly name for this build type. buildType is Release, Debug, etc,
 // buildName and buildType work together to identify a unique build (in the eyes of the cache, at
 // least).  isClean is whether the build output directory should be cleared before making a new
-// build.  buildArgs are the arguments passed to GN.
-func buildOrGetCachedHarness(buildName string, buildType buildskia.ReleaseType, isClean bool, buildArgs []string) (string, error) {
+// build.  buildArgs are the arguments passed to GN.  target is the ninja target to build, either
+// TEST_HARNESS_NAME or a libFuzzer target, which is linked against libFuzzer.  extraCFlags are
+// added to the extra_cflags passed to GN.  skiaRoot is the directory containing the Skia checkout
+// to build.
+func buildOrGetCachedHarness(skiaRoot, target, buildName string, buildType buildskia.ReleaseType, isClean bool, buildArgs, extraCFlags []string) (string, error) {
 	if buildType == buildskia.RELEASE_BUILD {
 		buildArgs = append(buildArgs, "is_debug=false")
 	}
 	// This makes crashing because we ran out of memory or because someone called SK_ABORT turn
 	// into an exit(1), so we don't count it as a "crash".
-	buildArgs = append(buildArgs, `extra_cflags=["-DIS_FUZZING"]`)
+	cflags := append([]string{"-DIS_FUZZING"}, extraCFlags...)
+	buildArgs = append(buildArgs, fmt.Sprintf("extra_cflags=[%s]", quoteGNList(cflags)))
+	if target != TEST_HARNESS_NAME {
+		// libFuzzer supplies main(), which calls the target's LLVMFuzzerTestOneInput.
+		buildArgs = append(buildArgs, `extra_ldflags=["-fsanitize=fuzzer"]`)
+		buildName = target + "_" + buildName
+	}
 	// System freetype has many MSAN-like bugs, which can throw off our fuzzer. Build our own
 	// (newer) freetype to minimize these.
 	buildArgs = append(buildArgs, "skia_use_system_freetype2=false")
 
-	d := filepath.Join(config.Common.SkiaRoot, "skia")
+	d := filepath.Join(skiaRoot, "skia")
 	gi, err := gitinfo.NewGitInfo(d, false, false)
 	if err != nil {
 		return "", fmt.Errorf("Could not locate git info about Skia Root %s: %s", d, err)
@@ -89,7 +133,7 @@ func buildOrGetCachedHarness(buildName string, buildType buildskia.ReleaseType,
 	if info, err := os.Stat(cachedFile); err != nil {
 		if os.IsNotExist(err) {
 			sklog.Infof("Did not find %s %s build for revision %s in cache.  Going to build it.", buildName, buildType, hashes[0])
-			if builtExePath, err := buildHarness(buildType, isClean, buildArgs); err != nil {
+			if builtExePath, err := buildHarness(skiaRoot, target, buildType, isClean, buildArgs); err != nil {
 				return "", fmt.Errorf("There was a problem building: %s", err)
 			} else {
 				return cachedFile, fileutil.CopyExecutable(builtExePath, cachedFile)
@@ -105,27 +149,36 @@ func buildOrGetCachedHarness(buildName string, buildType buildskia.ReleaseType,
 	}
 }
 
-// buildHarnesGNs builds the test harness for fuzzing. It activates Skia's GN command, which creates
+// quoteGNList returns the given strings quoted and comma separated, for use in a GN list.
+func quoteGNList(l []string) string {
+	quoted := make([]string, 0, len(l))
+	for _, s := range l {
+		quoted = append(quoted, fmt.Sprintf("%q", s))
+	}
+	return strings.Join(quoted, ",")
+}
+
+// buildHarnesGNs builds the given target for fuzzing. It activates Skia's GN command, which creates
 // the build (ninja) files for a Clang build. Then, it uses buildskia.GNNinjaBuild to execute the
 // build. It returns the path to the executable (which should be copied somewhere else) and
 // any error. buildType is Release, Debug, etc, isClean is whether the build output directory should
 // be cleared before making a new build. buildArgs are the arguments that should be passed into GN.
-func buildHarness(buildType buildskia.ReleaseType, isClean bool, buildArgs []string) (string, error) {
+func buildHarness(skiaRoot, target string, buildType buildskia.ReleaseType, isClean bool, buildArgs []string) (string, error) {
 	// clean previous build if specified
 
-	buildLocation := filepath.Join(config.Common.SkiaRoot, "skia", "out", string(buildType))
+	buildLocation := filepath.Join(skiaRoot, "skia", "out", string(buildType))
 	if isClean {
 		if err := os.RemoveAll(buildLocation); err != nil {
 			return "", fmt.Errorf("Could not clear out %s before building: %s", buildLocation, err)
 		}
 	}
 
-	if err := buildskia.GNGen(config.Common.SkiaRoot, config.Common.DepotToolsPath, string(buildType), buildArgs); err != nil {
+	if err := buildskia.GNGen(skiaRoot, config.Common.DepotToolsPath, string(buildType), buildArgs); err != nil {
 		return "", fmt.Errorf("Failed GN: %s", err)
 	}
 
-	builtExe := filepath.Join(buildLocation, TEST_HARNESS_NAME)
+	builtExe := filepath.Join(buildLocation, target)
 
-	_, err := buildskia.GNNinjaBuild(config.Common.SkiaRoot, config.Common.DepotToolsPath, string(buildType), TEST_HARNESS_NAME, config.Common.VerboseBuilds)
+	_, err := buildskia.GNNinjaBuild(skiaRoot, config.Common.DepotToolsPath, string(buildType), target, config.Common.VerboseBuilds)
 	return builtExe, err
 }
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
 )
 
 const (
@@ -22,6 +23,10 @@ const (
 	FUZZER_NOT_FOUND    = "FUZZER_NOT_FOUND"
 
 	UNCLAIMED = "<unclaimed>"
+
+	// The fuzzing engines that can be used to generate fuzzes, see FuzzerInfo.Generator.
+	GENERATOR_AFL       = "afl"
+	GENERATOR_LIBFUZZER = "libfuzzer"
 )
 
 // The list of architectures we fuzz on
@@ -43,6 +48,19 @@ type FuzzerInfo struct {
 	// ArgsAfterExecutable is a map of arguments that come after the executable
 	// and before the path to the bytes file, that will be fuzzed.
 	ArgsAfterExecutable []string
+	// Generator is the fuzzing engine used to generate fuzzes, GENERATOR_AFL or
+	// GENERATOR_LIBFUZZER.  If empty, GENERATOR_AFL is used.
+	Generator string
+	// LibFuzzerTarget is the GN target that builds the libFuzzer executable for this fuzzer.
+	// Required for GENERATOR_LIBFUZZER fuzzers, whose executables take the path to the bytes file
+	// as their only argument, so ArgsAfterExecutable should be empty.
+	LibFuzzerTarget string
+	// Dictionary is the path, relative to the Skia checkout, of a libFuzzer dictionary file for
+	// this fuzzer.  Optional, and only used by GENERATOR_LIBFUZZER fuzzers.
+	Dictionary string
+	// MaxLen is the maximum length in bytes of the inputs libFuzzer generates.  If 0, libFuzzer
+	// picks the maximum length based on the corpus.  Only used by GENERATOR_LIBFUZZER fuzzers.
+	MaxLen int
 }
 
 // fuzzers is a map of fuzzer_name -> FuzzerInfo for all registered fuzzers.  This should be a
@@ -140,6 +158,15 @@ var fuzzers = map[string]FuzzerInfo{
 		ExtraBugLabels:      nil,
 		ArgsAfterExecutable: []string{"--type", "region_deserialize", "--bytes"},
 	},
+	"region_set_path": {
+		PrettyName:      "SkRegion setPath",
+		Status:          EXPERIMENTAL_FUZZER,
+		Groomer:         "kjlubick",
+		ExtraBugLabels:  nil,
+		Generator:       GENERATOR_LIBFUZZER,
+		LibFuzzerTarget: "region_set_path",
+		MaxLen:          4096,
+	},
 	"skcodec_scale": {
 		PrettyName:          "SkCodec (Scaling)",
 		Status:              STABLE_FUZZER,
@@ -168,7 +195,10 @@ var FUZZ_CATEGORIES = []string{}
 
 func init() {
 	commonImpl = &defaultImpl{}
-	for k := range fuzzers {
+	for k, f := range fuzzers {
+		if f.Generator == GENERATOR_LIBFUZZER && f.LibFuzzerTarget == "" {
+			sklog.Fatalf("libFuzzer fuzzer %q must have a LibFuzzerTarget", k)
+		}
 		FUZZ_CATEGORIES = append(FUZZ_CATEGORIES, k)
 	}
 	sort.Strings(FUZZ_CATEGORIES)
@@ -203,6 +233,46 @@ func ReplicationArgs(category string) string {
 	return strings.Join(f.ArgsAfterExecutable, " ")
 }
 
+// Generator returns the fuzzing engine, i.e. GENERATOR_AFL or GENERATOR_LIBFUZZER, used to
+// generate fuzzes of a given category.
+func Generator(category string) string {
+	f, found := fuzzers[category]
+	if !found {
+		sklog.Errorf("Unknown category %s", category)
+		return FUZZER_NOT_FOUND
+	}
+	if f.Generator == "" {
+		return GENERATOR_AFL
+	}
+	return f.Generator
+}
+
+// ExecutableName returns the name of the executable, i.e. the GN target, that runs fuzzes of a
+// given category.
+func ExecutableName(category string) string {
+	f, found := fuzzers[category]
+	if !found {
+		sklog.Errorf("Unknown category %s", category)
+		return FUZZER_NOT_FOUND
+	}
+	if Generator(category) == GENERATOR_LIBFUZZER {
+		return f.LibFuzzerTarget
+	}
+	return TEST_HARNESS_NAME
+}
+
+// ExecutableNames returns the alphabetized, distinct names of the executables needed to run
+// fuzzes of the given categories.
+func ExecutableNames(categories []string) []string {
+	names := util.StringSet{}
+	for _, c := range categories {
+		names[ExecutableName(c)] = true
+	}
+	ret := names.Keys()
+	sort.Strings(ret)
+	return ret
+}
+
 // HasCategory returns if a given string corresponds to a known fuzzer category.
 func HasCategory(c string) bool {
 	_, found := fuzzers[c]
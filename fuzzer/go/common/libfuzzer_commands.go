@@ -0,0 +1,67 @@
+package common
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"go.skia.org/infra/fuzzer/go/config"
+	"go.skia.org/infra/go/sklog"
+)
+
+// LIBFUZZER_RSS_LIMIT_MB is the memory limit, in MB, passed to libFuzzer executables.  This matches
+// the limit that afl-fuzz runs with.
+const LIBFUZZER_RSS_LIMIT_MB = 5000
+
+// LIBFUZZER_ANALYSIS_ARGS stop libFuzzer from handling crashes itself when analyzing a fuzz, leaving
+// them to catchsegv and AddressSanitizer.
+var LIBFUZZER_ANALYSIS_ARGS = []string{"-handle_segv=0", "-handle_bus=0", "-handle_abrt=0", "-handle_ill=0", "-handle_fpe=0"}
+
+// LibFuzzerGenerationArgsFor creates the appropriate arguments to run a libFuzzer executable on a
+// fuzz of the given category.  The executable reads from and adds interesting inputs to
+// corpusPath and writes any crashing inputs to artifactPath, which should be a directory.  The
+// category's dictionary and -max_len are passed along, if specified.
+func LibFuzzerGenerationArgsFor(category, corpusPath, artifactPath string) GenerationArgs {
+	cmd, ok := libFuzzerArgs(category)
+	if !ok {
+		return nil
+	}
+	// libFuzzer prepends the prefix to the name of each artifact, so the trailing slash puts the
+	// artifacts in the directory.
+	cmd = append(cmd, fmt.Sprintf("-artifact_prefix=%s/", artifactPath))
+	return append(cmd, corpusPath)
+}
+
+// LibFuzzerMergeArgsFor creates the appropriate arguments to have a libFuzzer executable of the
+// given category merge the inputs in inputPaths into corpusPath.  Only the inputs that add
+// coverage are kept, so merging an empty corpusPath with the existing corpus as an input
+// minimizes it.
+func LibFuzzerMergeArgsFor(category, corpusPath string, inputPaths ...string) GenerationArgs {
+	cmd, ok := libFuzzerArgs(category)
+	if !ok {
+		return nil
+	}
+	cmd = append(cmd, "-merge=1", corpusPath)
+	return append(cmd, inputPaths...)
+}
+
+// libFuzzerArgs returns the arguments that every run of a libFuzzer executable of the given
+// category needs, and false if the category is not a libFuzzer category.
+func libFuzzerArgs(category string) (GenerationArgs, bool) {
+	f, found := fuzzers[category]
+	if !found {
+		sklog.Errorf("Unknown fuzz category %q", category)
+		return nil, false
+	}
+	if f.Generator != GENERATOR_LIBFUZZER {
+		sklog.Errorf("Fuzz category %q is not a libFuzzer fuzzer", category)
+		return nil, false
+	}
+	cmd := GenerationArgs{fmt.Sprintf("-rss_limit_mb=%d", LIBFUZZER_RSS_LIMIT_MB)}
+	if f.MaxLen > 0 {
+		cmd = append(cmd, fmt.Sprintf("-max_len=%d", f.MaxLen))
+	}
+	if f.Dictionary != "" {
+		cmd = append(cmd, "-dict="+filepath.Join(config.Common.SkiaRoot, "skia", f.Dictionary))
+	}
+	return cmd, true
+}
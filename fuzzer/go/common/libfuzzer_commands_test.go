@@ -0,0 +1,44 @@
+package common
+
+import (
+	"testing"
+
+	"go.skia.org/infra/fuzzer/go/config"
+	"go.skia.org/infra/go/testutils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLibFuzzerArgs(t *testing.T) {
+	testutils.SmallTest(t)
+	config.Common.SkiaRoot = "/skia_root"
+	fuzzers["libfuzzer_test"] = FuzzerInfo{
+		Generator:       GENERATOR_LIBFUZZER,
+		LibFuzzerTarget: "test_target",
+		Dictionary:      "fuzz/test.dict",
+		MaxLen:          1024,
+	}
+	defer delete(fuzzers, "libfuzzer_test")
+
+	assert.Equal(t, GenerationArgs{"-rss_limit_mb=5000", "-max_len=1024", "-dict=/skia_root/skia/fuzz/test.dict", "-artifact_prefix=/out/fuzzer0/crashes/", "/corpus"}, LibFuzzerGenerationArgsFor("libfuzzer_test", "/corpus", "/out/fuzzer0/crashes"))
+	assert.Equal(t, GenerationArgs{"-rss_limit_mb=5000", "-max_len=1024", "-dict=/skia_root/skia/fuzz/test.dict", "-merge=1", "/corpus", "/seeds"}, LibFuzzerMergeArgsFor("libfuzzer_test", "/corpus", "/seeds"))
+
+	assert.Equal(t, GENERATOR_LIBFUZZER, Generator("libfuzzer_test"))
+	assert.Equal(t, "test_target", ExecutableName("libfuzzer_test"))
+	assert.Equal(t, "", ReplicationArgs("libfuzzer_test"))
+}
+
+func TestLibFuzzerArgsNotLibFuzzer(t *testing.T) {
+	testutils.SmallTest(t)
+	assert.Nil(t, LibFuzzerGenerationArgsFor("api_parse_path", "/corpus", "/crashes"))
+	assert.Nil(t, LibFuzzerMergeArgsFor("not_a_category", "/corpus", "/seeds"))
+
+	assert.Equal(t, GENERATOR_AFL, Generator("api_parse_path"))
+	assert.Equal(t, TEST_HARNESS_NAME, ExecutableName("api_parse_path"))
+}
+
+func TestExecutableNames(t *testing.T) {
+	testutils.SmallTest(t)
+	assert.Equal(t, []string{TEST_HARNESS_NAME}, ExecutableNames([]string{"api_parse_path", "color_icc"}))
+	assert.Equal(t, []string{TEST_HARNESS_NAME, "region_set_path"}, ExecutableNames([]string{"region_set_path", "api_parse_path", "color_icc"}))
+}
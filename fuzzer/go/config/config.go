@@ -29,6 +29,15 @@ type aggregatorConfig struct {
 	RescanPeriod         time.Duration
 	StatusPeriod         time.Duration
 	AnalysisTimeout      time.Duration
+	// SimilarityThreshold, if non-zero, makes the aggregator deduplicate fuzzes by how similar
+	// their stacktraces are, rather than by their exact top frames.
+	SimilarityThreshold float64
+}
+
+type bisectConfig struct {
+	SkiaRoot    string
+	WorkingPath string
+	MaxCommits  int
 }
 
 type frontendConfig struct {
@@ -58,6 +67,7 @@ type commonConfig struct {
 
 var Generator = generatorConfig{}
 var Aggregator = aggregatorConfig{}
+var Bisect = bisectConfig{}
 var GCS = gcsConfig{}
 var Common = commonConfig{}
 var FrontEnd = frontendConfig{}
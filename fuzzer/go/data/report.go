@@ -17,6 +17,31 @@ type FuzzReport struct {
 	FuzzCategory     string `json:"category"`
 	FuzzArchitecture string `json:"architecture"`
 	IsGrey           bool   `json:"isGrey"`
+
+	// These come from the fuzz's FuzzHistory, if it has one.
+	IntroducedRevision string `json:"introducedRevision"`
+	LastGoodRevision   string `json:"lastGoodRevision"`
+	FixedRevision      string `json:"fixedRevision"`
+}
+
+// FuzzHistory records what is known about when a bad fuzz started and stopped crashing Skia.  It
+// is kept separately from the analysis of any one revision, so it carries over when the fuzzer
+// rolls to a new revision of Skia.
+type FuzzHistory struct {
+	// IntroducedRevision is the oldest Skia commit that bisection found the fuzz to crash at, or ""
+	// if the fuzz has not been bisected.
+	IntroducedRevision string `json:"introducedRevision"`
+	// LastGoodRevision is the newest commit before IntroducedRevision that bisection found the fuzz
+	// not to crash at.  If some commits in between could not be built, the culprit is one of the
+	// commits in (LastGoodRevision, IntroducedRevision].  If the fuzz crashed at every commit
+	// bisection looked at, this is "" and the crash was introduced at or before
+	// IntroducedRevision.
+	LastGoodRevision string `json:"lastGoodRevision"`
+	// BisectedAt is the revision bisection started from, i.e. where the fuzz was found.
+	BisectedAt string `json:"bisectedAt"`
+	// FixedRevision is the first revision under fuzz at which the fuzz no longer crashed, or "" if
+	// it still does.
+	FixedRevision string `json:"fixedRevision"`
 }
 
 // ParseReport creates a report given the raw materials passed in.
@@ -31,6 +56,10 @@ func ParseReport(g GCSPackage) FuzzReport {
 		FuzzCategory:      g.FuzzCategory,
 		FuzzArchitecture:  g.FuzzArchitecture,
 		IsGrey:            result.IsGrey(),
+
+		IntroducedRevision: g.History.IntroducedRevision,
+		LastGoodRevision:   g.History.LastGoodRevision,
+		FixedRevision:      g.History.FixedRevision,
 	}
 }
 
@@ -36,6 +36,7 @@ type GCSPackage struct {
 	FuzzArchitecture string
 	Debug            OutputFiles
 	Release          OutputFiles
+	History          FuzzHistory
 }
 
 // A bit mask representing what happened when a fuzz ran against Skia.
@@ -0,0 +1,282 @@
+package deduplicator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.skia.org/infra/fuzzer/go/data"
+	"go.skia.org/infra/go/util"
+)
+
+// _MAX_SIMILARITY_FRAMES is how many frames, after removing boilerplate, from the top of a
+// stacktrace are compared.
+const _MAX_SIMILARITY_FRAMES = 8
+
+// _BOILERPLATE_FUNCTIONS are functions that show up in many unrelated stacktraces, e.g. because
+// they are how Skia aborts or allocates memory, so they say nothing about the crash.
+var _BOILERPLATE_FUNCTIONS = []string{
+	"LLVMFuzzerTestOneInput",
+	"SkAbort_FileLine",
+	"__libc_start_main",
+	"_start",
+	"main",
+	"sk_abort_no_print",
+	"sk_calloc_throw",
+	"sk_free",
+	"sk_malloc_flags",
+	"sk_malloc_throw",
+	"sk_out_of_memory",
+	"sk_realloc_throw",
+}
+
+// _BOILERPLATE_FILES are files whose frames are all boilerplate, e.g. the fuzz harness.
+var _BOILERPLATE_FILES = []string{
+	"FuzzMain.cpp",
+	"SkMemory_malloc.cpp",
+	"fuzz.cpp",
+	"libc-start.c",
+}
+
+// _CRASH_TYPE_FLAGS are the flags that describe how a fuzz crashed, as opposed to which builds
+// crashed.  The flags starting with "ASAN_" are also crash types.
+var _CRASH_TYPE_FLAGS = []string{"AssertionViolated", "BadAlloc", "SKAbortHit"}
+
+// A Cluster is a group of bad fuzzes that are similar enough to be considered the same crash.
+// Only the first fuzz of a cluster, the Representative, was considered unique.
+type Cluster struct {
+	Category       string `json:"category"`
+	Architecture   string `json:"architecture"`
+	CrashType      string `json:"crashType"`
+	Representative string `json:"representative"`
+	// Frames are the compared frames of the Representative, from the Release stacktrace if it has
+	// one.
+	Frames []string `json:"frames"`
+	// Fuzzes are the names of all fuzzes in the cluster, including the Representative.
+	Fuzzes []string `json:"fuzzes"`
+}
+
+// A ClusterReport lists the clusters a deduplicator has found since the last SetRevision,
+// largest first.
+type ClusterReport struct {
+	Revision  string    `json:"revision"`
+	Threshold float64   `json:"threshold"`
+	NumFuzzes int       `json:"numFuzzes"`
+	Clusters  []Cluster `json:"clusters"`
+}
+
+// A ClusterReporter is a Deduplicator that can report how it grouped fuzzes together, so
+// groomers can check what was hidden as a duplicate.
+type ClusterReporter interface {
+	Deduplicator
+	ClusterReport() ClusterReport
+}
+
+// similarityDeduplicator puts every report into the first cluster with the same category,
+// architecture and crash type whose representative's stacktraces are at least threshold similar.
+// Reports that start a new cluster are unique.
+type similarityDeduplicator struct {
+	threshold float64
+	revision  string
+	// maps bucketKey to the clusters in that bucket, in the order they were created.
+	clusters map[string][]*cluster
+	mutex    sync.Mutex
+}
+
+// cluster is a Cluster and the normalized stacktraces of its representative.
+type cluster struct {
+	Cluster
+	debug   []string
+	release []string
+}
+
+// NewSimilarityDeduplicator creates a Deduplicator that clusters reports by how similar their
+// stacktraces are.  threshold is between 0 and 1; the higher it is, the more similar two reports
+// have to be to be considered duplicates.  A threshold of 1 only merges reports whose stacktraces
+// are the same, not counting line numbers and boilerplate frames.
+func NewSimilarityDeduplicator(threshold float64) ClusterReporter {
+	return &similarityDeduplicator{
+		threshold: threshold,
+		clusters:  make(map[string][]*cluster),
+	}
+}
+
+func (d *similarityDeduplicator) SetRevision(r string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.revision = r
+	d.clusters = make(map[string][]*cluster)
+}
+
+func (d *similarityDeduplicator) IsUnique(report data.FuzzReport) bool {
+	// Empty stacktraces should be manually deduplicated.
+	if report.DebugStackTrace.IsEmpty() && report.ReleaseStackTrace.IsEmpty() {
+		return true
+	}
+	// Other flags should also be looked at manually.
+	if util.In("Other", report.DebugFlags) || util.In("Other", report.ReleaseFlags) {
+		return true
+	}
+	debug := normalize(report.DebugStackTrace)
+	release := normalize(report.ReleaseStackTrace)
+	t := crashType(report)
+	k := bucketKey(report.FuzzCategory, report.FuzzArchitecture, t)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, c := range d.clusters[k] {
+		if util.In(report.FuzzName, c.Fuzzes) {
+			return false
+		}
+		if similarity(debug, release, c.debug, c.release) >= d.threshold {
+			c.Fuzzes = append(c.Fuzzes, report.FuzzName)
+			return false
+		}
+	}
+	frames := release
+	if len(frames) == 0 {
+		frames = debug
+	}
+	d.clusters[k] = append(d.clusters[k], &cluster{
+		Cluster: Cluster{
+			Category:       report.FuzzCategory,
+			Architecture:   report.FuzzArchitecture,
+			CrashType:      t,
+			Representative: report.FuzzName,
+			Frames:         frames,
+			Fuzzes:         []string{report.FuzzName},
+		},
+		debug:   debug,
+		release: release,
+	})
+	return true
+}
+
+func (d *similarityDeduplicator) ClusterReport() ClusterReport {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	r := ClusterReport{
+		Revision:  d.revision,
+		Threshold: d.threshold,
+		Clusters:  []Cluster{},
+	}
+	for _, clusters := range d.clusters {
+		for _, c := range clusters {
+			// Copy, so the report does not change along with the deduplicator.
+			cc := c.Cluster
+			cc.Fuzzes = append([]string(nil), c.Fuzzes...)
+			sort.Strings(cc.Fuzzes)
+			r.Clusters = append(r.Clusters, cc)
+			r.NumFuzzes += len(cc.Fuzzes)
+		}
+	}
+	sort.Sort(clusterSlice(r.Clusters))
+	return r
+}
+
+// String returns the report in a form that is easy for a groomer to skim.
+func (r ClusterReport) String() string {
+	s := fmt.Sprintf("%d fuzzes in %d clusters at revision %s (threshold %.2f)\n", r.NumFuzzes, len(r.Clusters), r.Revision, r.Threshold)
+	for _, c := range r.Clusters {
+		s += fmt.Sprintf("\n%s %s %s: %d fuzzes, e.g. %s\n", c.Category, c.Architecture, c.CrashType, len(c.Fuzzes), c.Representative)
+		for _, f := range c.Frames {
+			s += fmt.Sprintf("\t%s\n", f)
+		}
+	}
+	return s
+}
+
+// clusterSlice sorts Clusters from largest to smallest, then by representative.
+type clusterSlice []Cluster
+
+func (s clusterSlice) Len() int      { return len(s) }
+func (s clusterSlice) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s clusterSlice) Less(i, j int) bool {
+	if len(s[i].Fuzzes) != len(s[j].Fuzzes) {
+		return len(s[i].Fuzzes) > len(s[j].Fuzzes)
+	}
+	return s[i].Representative < s[j].Representative
+}
+
+func bucketKey(category, architecture, crashType string) string {
+	return fmt.Sprintf("C:%s,A:%s,T:%s", category, architecture, crashType)
+}
+
+// crashType returns the crash type flags found in either build of the report, joined by "|", or
+// "Crash" if there are none, e.g. for a plain segfault.
+func crashType(r data.FuzzReport) string {
+	types := util.NewStringSet()
+	for _, f := range append(append([]string{}, r.DebugFlags...), r.ReleaseFlags...) {
+		if util.In(f, _CRASH_TYPE_FLAGS) || strings.HasPrefix(f, "ASAN_") {
+			types[f] = true
+		}
+	}
+	if len(types) == 0 {
+		return "Crash"
+	}
+	t := types.Keys()
+	sort.Strings(t)
+	return strings.Join(t, "|")
+}
+
+// normalize returns the top _MAX_SIMILARITY_FRAMES frames of the stacktrace that are not
+// boilerplate, identified only by file and function, so that line numbers do not matter.
+func normalize(st data.StackTrace) []string {
+	frames := []string{}
+	for _, f := range st.Frames {
+		if len(frames) == _MAX_SIMILARITY_FRAMES {
+			break
+		}
+		if util.In(f.FunctionName, _BOILERPLATE_FUNCTIONS) || util.In(f.FileName, _BOILERPLATE_FILES) {
+			continue
+		}
+		frames = append(frames, fmt.Sprintf("%s %s", f.FileName, f.FunctionName))
+	}
+	return frames
+}
+
+// similarity compares the Debug and Release stacktraces of two reports and returns the average
+// similarity of the builds for which either report has a stacktrace.  A build for which only one
+// report has a stacktrace counts as completely different.
+func similarity(debugA, releaseA, debugB, releaseB []string) float64 {
+	total, n := 0.0, 0
+	if len(debugA) > 0 || len(debugB) > 0 {
+		total += frameSimilarity(debugA, debugB)
+		n++
+	}
+	if len(releaseA) > 0 || len(releaseB) > 0 {
+		total += frameSimilarity(releaseA, releaseB)
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	return total / float64(n)
+}
+
+// frameSimilarity returns how similar two sequences of frames are, from 0 to 1, based on the
+// length of their longest common subsequence.  Using a subsequence, rather than comparing frame by
+// frame, means that a frame which was inlined in one build and not the other only costs a little.
+func frameSimilarity(a, b []string) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] > lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	return 2 * float64(lcs[0][0]) / float64(len(a)+len(b))
+}
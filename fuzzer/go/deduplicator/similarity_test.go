@@ -0,0 +1,196 @@
+package deduplicator
+
+import (
+	"math"
+	"testing"
+
+	"go.skia.org/infra/fuzzer/go/data"
+	"go.skia.org/infra/go/testutils"
+)
+
+func TestSimilaritySimpleDeduplication(t *testing.T) {
+	testutils.SmallTest(t)
+	d := NewSimilarityDeduplicator(0.75)
+	r1 := data.MockReport("skpicture", "aaaa")
+	// mock report bbbb has the same debug stacktrace as aaaa, but no release stacktrace.
+	r2 := data.MockReport("skpicture", "bbbb")
+	// mock report ffff and aaaa are the same, except for the name.
+	r3 := data.MockReport("skpicture", "ffff")
+	// mock report jjjj and aaaa are the same, except for the name and architecture.
+	r4 := data.MockReport("skpicture", "jjjj")
+
+	if !d.IsUnique(r1) {
+		t.Errorf("The deduplicator has not seen %#v, but said it has", r1)
+	}
+	if !d.IsUnique(r2) {
+		t.Errorf("The deduplicator has not seen %#v, but said it has", r2)
+	}
+	if d.IsUnique(r1) {
+		t.Errorf("Should not have said %#v was unique, it just saw it.", r1)
+	}
+	if d.IsUnique(r3) {
+		t.Errorf("Should not have said %#v was unique, it just saw something like it.", r3)
+	}
+	if !d.IsUnique(r4) {
+		t.Errorf("The deduplicator has not seen %#v, but said it has", r4)
+	}
+}
+
+func TestSimilarityUnknownStacktraces(t *testing.T) {
+	testutils.SmallTest(t)
+	d := NewSimilarityDeduplicator(0.75)
+	// mock report ee has no stacktrace for either.  It should not be considered a duplicate, ever.
+	r1 := data.MockReport("skpicture", "eeee")
+	if !d.IsUnique(r1) {
+		t.Errorf("The deduplicator has not seen %#v, but said it has", r1)
+	}
+	if !d.IsUnique(r1) {
+		t.Errorf("Should not have said %#v was not unique, unknown stacktraces don't count.", r1)
+	}
+}
+
+func TestSimilarityInlinedFrame(t *testing.T) {
+	testutils.SmallTest(t)
+	r1 := makeReport()
+	r1.FuzzName = "aaaa"
+	// r2 is like r1, except that a release frame was inlined and the line numbers are different.
+	r2 := makeReport()
+	r2.FuzzName = "bbbb"
+	r2.ReleaseStackTrace.Frames = append(r2.ReleaseStackTrace.Frames[:1], r2.ReleaseStackTrace.Frames[2:]...)
+	r2.DebugStackTrace.Frames[0].LineNumber = 9999
+
+	d := NewSimilarityDeduplicator(0.75)
+	if !d.IsUnique(r1) {
+		t.Errorf("The deduplicator has not seen %#v, but said it has", r1)
+	}
+	if d.IsUnique(r2) {
+		t.Errorf("Should not have said %#v was unique, it only differs from %#v by an inlined frame.", r2, r1)
+	}
+
+	d = NewSimilarityDeduplicator(1)
+	if !d.IsUnique(r1) {
+		t.Errorf("The deduplicator has not seen %#v, but said it has", r1)
+	}
+	if !d.IsUnique(r2) {
+		t.Errorf("With a threshold of 1, %#v should be unique, as it is missing a frame.", r2)
+	}
+}
+
+func TestSimilarityDifferentFrames(t *testing.T) {
+	testutils.SmallTest(t)
+	d := NewSimilarityDeduplicator(0.75)
+	r1 := makeReport()
+	r1.FuzzName = "aaaa"
+	// r2 shares the release stacktrace with r1, but has a completely different debug one.
+	r2 := makeReport()
+	r2.FuzzName = "bbbb"
+	r2.DebugStackTrace = makeStacktrace(5)
+
+	if !d.IsUnique(r1) {
+		t.Errorf("The deduplicator has not seen %#v, but said it has", r1)
+	}
+	if !d.IsUnique(r2) {
+		t.Errorf("The deduplicator has not seen %#v, but said it has", r2)
+	}
+}
+
+func TestSimilarityCrashType(t *testing.T) {
+	testutils.SmallTest(t)
+	d := NewSimilarityDeduplicator(0.75)
+	r1 := makeReport()
+	r1.FuzzName = "aaaa"
+	// r2 crashes in the same place, but in a different way.
+	r2 := makeReport()
+	r2.FuzzName = "bbbb"
+	r2.ReleaseFlags = append(r2.ReleaseFlags, "ASAN_heap-use-after-free")
+	// r3 is like r2, except it was not caught by the Release build.
+	r3 := makeReport()
+	r3.FuzzName = "cccc"
+	r3.DebugFlags = append(r3.DebugFlags, "ASAN_heap-use-after-free")
+
+	if !d.IsUnique(r1) {
+		t.Errorf("The deduplicator has not seen %#v, but said it has", r1)
+	}
+	if !d.IsUnique(r2) {
+		t.Errorf("The deduplicator has not seen a %s, but said it has", crashType(r2))
+	}
+	if d.IsUnique(r3) {
+		t.Errorf("Should not have said %#v was unique, it just saw a %s in the same place.", r3, crashType(r3))
+	}
+}
+
+func TestSimilarityBoilerplate(t *testing.T) {
+	testutils.SmallTest(t)
+	d := NewSimilarityDeduplicator(1)
+	r1 := makeReport()
+	r1.FuzzName = "aaaa"
+	// r2 is like r1, except that it aborted and was run by the fuzz harness.
+	r2 := makeReport()
+	r2.FuzzName = "bbbb"
+	abort := data.FullStackFrame("src/ports/", "SkDebug_stdio.cpp", "sk_abort_no_print", 12)
+	harness := data.FullStackFrame("fuzz/", "fuzz.cpp", "fuzz_img", 119)
+	r2.DebugStackTrace.Frames = append([]data.StackTraceFrame{abort}, append(r2.DebugStackTrace.Frames, harness)...)
+	r2.ReleaseStackTrace.Frames = append([]data.StackTraceFrame{abort}, append(r2.ReleaseStackTrace.Frames, harness)...)
+
+	if !d.IsUnique(r1) {
+		t.Errorf("The deduplicator has not seen %#v, but said it has", r1)
+	}
+	if d.IsUnique(r2) {
+		t.Errorf("Should not have said %#v was unique, it only differs from %#v by boilerplate frames.", r2, r1)
+	}
+}
+
+func TestClusterReport(t *testing.T) {
+	testutils.SmallTest(t)
+	d := NewSimilarityDeduplicator(0.75)
+	d.SetRevision("COMMIT_HASH")
+	for _, name := range []string{"aaaa", "bbbb", "ffff", "jjjj"} {
+		d.IsUnique(data.MockReport("skpicture", name))
+	}
+	r := d.ClusterReport()
+	if r.Revision != "COMMIT_HASH" {
+		t.Errorf("Wrong revision: %q", r.Revision)
+	}
+	if r.NumFuzzes != 4 {
+		t.Errorf("Should have reported 4 fuzzes, not %d: %s", r.NumFuzzes, r)
+	}
+	if len(r.Clusters) != 3 {
+		t.Fatalf("Should have reported 3 clusters, not %d: %s", len(r.Clusters), r)
+	}
+	// The largest cluster comes first.
+	c := r.Clusters[0]
+	if c.Representative != "aaaa" || len(c.Fuzzes) != 2 || c.Fuzzes[0] != "aaaa" || c.Fuzzes[1] != "ffff" {
+		t.Errorf("Wrong first cluster: %#v", c)
+	}
+	if c.Category != "skpicture" || c.Architecture != "mock_arm8" || c.CrashType != "Crash" {
+		t.Errorf("Wrong first cluster: %#v", c)
+	}
+	if r.Clusters[1].Representative != "bbbb" || r.Clusters[2].Representative != "jjjj" {
+		t.Errorf("Wrong order of clusters: %s", r)
+	}
+
+	d.SetRevision("THE_SECOND_COMMIT_HASH")
+	if r := d.ClusterReport(); r.NumFuzzes != 0 || len(r.Clusters) != 0 {
+		t.Errorf("SetRevision should have cleared the clusters: %s", r)
+	}
+}
+
+func TestFrameSimilarity(t *testing.T) {
+	testutils.SmallTest(t)
+	tests := []struct {
+		a, b     []string
+		expected float64
+	}{
+		{[]string{"a", "b", "c", "d"}, []string{"a", "b", "c", "d"}, 1},
+		{[]string{"a", "b", "c", "d"}, []string{"a", "c", "d"}, 6.0 / 7},
+		{[]string{"a", "b", "c", "d"}, []string{"a", "x", "c", "y"}, 0.5},
+		{[]string{"a", "b", "c", "d"}, []string{"w", "x", "y", "z"}, 0},
+		{[]string{"a", "b", "c", "d"}, []string{}, 0},
+		{[]string{}, []string{}, 1},
+	}
+	for _, test := range tests {
+		if s := frameSimilarity(test.a, test.b); math.Abs(s-test.expected) > 0.0001 {
+			t.Errorf("frameSimilarity(%q, %q) should be %f, not %f", test.a, test.b, test.expected, s)
+		}
+	}
+}
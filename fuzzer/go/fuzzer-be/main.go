@@ -16,6 +16,7 @@ import (
 	"cloud.google.com/go/storage"
 	"go.skia.org/infra/fuzzer/go/aggregator"
 	"go.skia.org/infra/fuzzer/go/backend"
+	"go.skia.org/infra/fuzzer/go/bisect"
 	fcommon "go.skia.org/infra/fuzzer/go/common"
 	"go.skia.org/infra/fuzzer/go/config"
 	"go.skia.org/infra/fuzzer/go/data"
@@ -58,6 +59,11 @@ var (
 	numUploadProcesses   = flag.Int("upload_processes", 0, `The number of processes to upload fuzzes [per fuzz to run]. Defaults to 0, which means "Make an intelligent guess"`)
 	statusPeriod         = flag.Duration("status_period", 60*time.Second, `The time period used to report the status of the aggregation/analysis/upload queue. `)
 	analysisTimeout      = flag.Duration("analysis_timeout", 5*time.Second, `The maximum time an analysis should run.`)
+	similarityThreshold  = flag.Float64("dedup_similarity_threshold", 0, "If non-zero, bad fuzzes are deduplicated by how similar their stacktraces are, from 0 to 1, instead of by their exact top frames.  0.75 is a good start.  The resulting clusters are uploaded next to the fuzzes.")
+
+	bisectSkiaRoot   = flag.String("bisect_skia_root", "", "The root directory of a second Skia checkout, used to bisect bad fuzzes to the commit that introduced them.  If empty, bad fuzzes are not bisected.")
+	bisectWD         = flag.String("bisect_working_dir", filepath.Join(os.TempDir(), "bisect_wd"), "The bisector's working directory.  Can be in /tmp.")
+	bisectMaxCommits = flag.Int("bisect_max_commits", 256, "The number of commits, leading up to the revision a bad fuzz was found at, to bisect.")
 
 	watchAFL        = flag.Bool("watch_afl", false, "(debug only) If the afl master's output should be piped to stdout.")
 	skipGeneration  = flag.Bool("skip_generation", false, "(debug only) If the generation step should be disabled.")
@@ -142,8 +148,13 @@ func main() {
 	if err != nil {
 		sklog.Fatalf("Could not start aggregator: %s", err)
 	}
+	if config.Bisect.SkiaRoot != "" {
+		sklog.Infof("Starting bisector with configuration %#v", config.Bisect)
+		agg.Bisector = bisect.New(client, issueManager)
+		agg.Bisector.Start()
+	}
 
-	updater := backend.NewVersionUpdater(client, agg, generators)
+	updater := backend.NewVersionUpdater(client, agg, generators, issueManager)
 	sklog.Info("Starting version watcher")
 	watcher := version_watcher.New(client, config.Common.VersionCheckPeriod, updater.UpdateToNewSkiaVersion, nil)
 	watcher.Start()
@@ -213,8 +224,27 @@ func writeFlagsToConfig() error {
 	config.Aggregator.StatusPeriod = *statusPeriod
 	config.Aggregator.RescanPeriod = *rescanPeriod
 	config.Aggregator.AnalysisTimeout = *analysisTimeout
+	if *similarityThreshold < 0 || *similarityThreshold > 1 {
+		return fmt.Errorf("--dedup_similarity_threshold must be between 0 and 1")
+	}
+	config.Aggregator.SimilarityThreshold = *similarityThreshold
 	config.Common.ForceReanalysis = *forceReanalysis
 
+	if *bisectSkiaRoot != "" {
+		config.Bisect.SkiaRoot, err = fileutil.EnsureDirExists(*bisectSkiaRoot)
+		if err != nil {
+			return err
+		}
+		config.Bisect.WorkingPath, err = fileutil.EnsureDirExists(*bisectWD)
+		if err != nil {
+			return err
+		}
+		if *bisectMaxCommits < 2 {
+			return fmt.Errorf("--bisect_max_commits must be at least 2")
+		}
+		config.Bisect.MaxCommits = *bisectMaxCommits
+	}
+
 	// Check all the fuzzes are valid ones we can handle
 	for _, f := range *fuzzesToRun {
 		if !fcommon.HasCategory(f) {
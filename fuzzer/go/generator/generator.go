@@ -0,0 +1,195 @@
+package generator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"go.skia.org/infra/fuzzer/go/common"
+	"go.skia.org/infra/fuzzer/go/config"
+	fstorage "go.skia.org/infra/fuzzer/go/storage"
+	"go.skia.org/infra/go/exec"
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/go/sklog"
+	"golang.org/x/net/context"
+)
+
+// fuzzEngine generates fuzzes for a category using a particular fuzzing engine, e.g. afl-fuzz or
+// libFuzzer.  Crashing inputs must end up in
+// config.Generator.AflOutputPath/[category]/[fuzzer]/crashes*/, where the aggregator finds them.
+type fuzzEngine interface {
+	// setup builds the executable for the given category and does anything else needed before
+	// fuzzing can start.  It returns the path to the executable.
+	setup(category string) (string, error)
+	// commands returns the commands that run n fuzzing processes using the given executable.
+	commands(category, executable string, n int) ([]*exec.Command, error)
+	// stopped is called after all fuzzing processes have been killed.
+	stopped(category string)
+}
+
+type Generator struct {
+	Category         string
+	engine           fuzzEngine
+	fuzzProcessCount metrics2.Counter
+	fuzzProcesses    []exec.Process
+}
+
+// New creates a new generator for a fuzzer of a given category.  The fuzzing engine is picked
+// based on the category's common.FuzzerInfo.
+func New(category string) *Generator {
+	var engine fuzzEngine = aflEngine{}
+	if common.Generator(category) == common.GENERATOR_LIBFUZZER {
+		engine = libFuzzerEngine{}
+	}
+	return &Generator{
+		Category:      category,
+		engine:        engine,
+		fuzzProcesses: nil,
+	}
+}
+
+// Start starts up n fuzzing processes, where n is specified by
+// config.Generator.NumBinaryFuzzProcesses or config.Generator.NumAPIFuzzProcesses.  Output goes to
+// config.Generator.AflOutputPath/[category].
+func (g *Generator) Start() error {
+	if config.Generator.SkipGeneration {
+		sklog.Info("Skipping generation because flag was set.")
+		return nil
+	}
+	executable, err := g.setup()
+	if err != nil {
+		return fmt.Errorf("Failed %s generator setup: %s", g.Category, err)
+	}
+
+	fuzzCount := config.Generator.NumBinaryFuzzProcesses
+	if strings.HasPrefix(g.Category, "api_") {
+		fuzzCount = config.Generator.NumAPIFuzzProcesses
+	}
+	if fuzzCount <= 0 {
+		// TODO(kjlubick): Make this actually an intelligent number based on the number of cores.
+		fuzzCount = 4
+	}
+
+	cmds, err := g.engine.commands(g.Category, executable, fuzzCount)
+	if err != nil {
+		return fmt.Errorf("Failed to create %s fuzzing commands: %s", g.Category, err)
+	}
+
+	g.fuzzProcessCount = metrics2.GetCounter("afl-fuzz-process-count", map[string]string{"fuzz_category": g.Category, "architecture": config.Generator.Architecture})
+	g.fuzzProcessCount.Inc(int64(len(cmds)))
+	for _, cmd := range cmds {
+		g.fuzzProcesses = append(g.fuzzProcesses, g.run(cmd))
+	}
+	return nil
+}
+
+// setup clears out previous fuzzing sessions and has the engine build the executable we need to
+// fuzz.
+func (g *Generator) setup() (string, error) {
+	if err := g.Clear(); err != nil {
+		return "", err
+	}
+	return g.engine.setup(g.Category)
+}
+
+// Clear removes the previous fuzzing sessions data and any previously used binaries.
+func (g *Generator) Clear() error {
+	workingPath := filepath.Join(config.Generator.WorkingPath, g.Category)
+	if err := os.RemoveAll(workingPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to remove previous binaries from %s: %s", workingPath, err)
+	}
+	if err := os.MkdirAll(workingPath, 0755); err != nil {
+		return fmt.Errorf("Failed to create working directory %s: %s", workingPath, err)
+	}
+
+	// remove previous fuzz results
+	resultsPath := filepath.Join(config.Generator.AflOutputPath, g.Category)
+	if err := os.RemoveAll(resultsPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to remove previous fuzz results from %s: %s", resultsPath, err)
+	}
+	if err := os.MkdirAll(resultsPath, 0755); err != nil {
+		return fmt.Errorf("Failed to create fuzz results directory %s: %s", resultsPath, err)
+	}
+	return nil
+}
+
+// run runs the command and logs any failures.  It returns the Process that can be used to
+// manually kill the command.
+func (g *Generator) run(command *exec.Command) exec.Process {
+	p, status, err := exec.RunIndefinitely(command)
+	if err != nil {
+		sklog.Errorf("Failed fuzzer command %#v: %s", command, err)
+		return nil
+	}
+	go func() {
+		err := <-status
+		g.fuzzProcessCount.Dec(int64(1))
+		sklog.Infof(`[%s] fuzzer %s with args %q ended with error "%v".  There are %d fuzzers remaining`, g.Category, command.Name, command.Args, err, g.fuzzProcessCount.Get())
+	}()
+	return p
+}
+
+// Stop terminates all fuzzing processes that were spawned, logging any errors. It also lets the
+// engine clean up, e.g. setting some key metrics to 0, so the graphs at mon.skia.org reflect the
+// stoppage.
+func (g *Generator) Stop() {
+	sklog.Infof("Trying to stop %d fuzz processes", len(g.fuzzProcesses))
+	for _, p := range g.fuzzProcesses {
+		if p != nil {
+			if err := p.Kill(); err != nil {
+				sklog.Warningf("[%s] Error while trying to kill fuzz process: %s", g.Category, err)
+			} else {
+				sklog.Infof("[%s] Quietly shutdown fuzz process.", g.Category)
+			}
+		}
+	}
+	g.fuzzProcesses = nil
+	g.engine.stopped(g.Category)
+}
+
+// DownloadSeedFiles downloads the seed files stored in Google Storage to be used by the fuzzing
+// engine.  It places them in config.Generator.FuzzSamples/[category] after cleaning the folder
+// out. It returns an error on failure.
+func (g *Generator) DownloadSeedFiles(storageClient fstorage.FuzzerGCSClient) error {
+	seedPath := filepath.Join(config.Generator.FuzzSamples, g.Category)
+	if err := os.RemoveAll(seedPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Could not clean binary seed path %s: %s", seedPath, err)
+	}
+	if err := os.MkdirAll(seedPath, 0755); err != nil {
+		return fmt.Errorf("Could not create binary seed path %s: %s", seedPath, err)
+	}
+
+	// API fuzzers can all share the same seeds, as they are just random numbers.
+	// EXCEPTION: Canvas fuzzers are pretty slow, so they have their own set of seeds that gets
+	// the fuzzer going much faster. It saves about 3 hours of startup work every time the fuzzers
+	// are restarted.
+	cat := g.Category
+	if strings.HasPrefix(cat, "api_") {
+		cat = "api"
+	}
+	if strings.HasSuffix(cat, "_canvas") {
+		cat = "canvas"
+	}
+	gsFolder := fmt.Sprintf("samples/%s/", cat)
+
+	err := storageClient.AllFilesInDirectory(context.Background(), gsFolder, func(item *storage.ObjectAttrs) {
+		name := item.Name
+		// skip the parent folder
+		if name == gsFolder {
+			return
+		}
+		content, err := storageClient.GetFileContents(context.Background(), name)
+		if err != nil {
+			sklog.Errorf("[%s] Problem downloading %s from Google Storage, continuing anyway", g.Category, item.Name)
+			return
+		}
+		fileName := filepath.Join(seedPath, strings.SplitAfter(name, gsFolder)[1])
+		if err = ioutil.WriteFile(fileName, content, 0644); err != nil && !os.IsExist(err) {
+			sklog.Errorf("[%s] Problem creating binary seed file %s, continuing anyway", g.Category, fileName)
+		}
+	})
+	return err
+}
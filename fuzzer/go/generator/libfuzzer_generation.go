@@ -0,0 +1,90 @@
+package generator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.skia.org/infra/fuzzer/go/common"
+	"go.skia.org/infra/fuzzer/go/config"
+	"go.skia.org/infra/go/buildskia"
+	"go.skia.org/infra/go/exec"
+	"go.skia.org/infra/go/fileutil"
+	"go.skia.org/infra/go/sklog"
+)
+
+// libFuzzerEngine is a fuzzEngine that runs libFuzzer executables.  All processes of a category
+// share one corpus, in config.Generator.WorkingPath/[category]/corpus, and each process writes
+// its crashing inputs to config.Generator.AflOutputPath/[category]/fuzzerN/crashes, mirroring the
+// layout afl-fuzz uses.
+type libFuzzerEngine struct{}
+
+// corpusPath returns the path of the corpus shared by all libFuzzer processes of a category.
+func corpusPath(category string) string {
+	return filepath.Join(config.Generator.WorkingPath, category, "corpus")
+}
+
+// setup builds the libFuzzer executable for the category and copies it to the working directory
+// as "[target]_libfuzzer_Release".  It then merges the seed files into a fresh corpus, which keeps
+// only the seeds that add coverage.
+func (libFuzzerEngine) setup(category string) (string, error) {
+	target := common.ExecutableName(category)
+	srcExe, err := common.BuildLibFuzzerHarness(target, buildskia.RELEASE_BUILD, true)
+	if err != nil {
+		return "", fmt.Errorf("Failed to build libFuzzer executable %s: %s", target, err)
+	}
+	destExe := filepath.Join(config.Generator.WorkingPath, category, target+"_libfuzzer_Release")
+	if err := fileutil.CopyExecutable(srcExe, destExe); err != nil {
+		return "", err
+	}
+
+	corpus := corpusPath(category)
+	if err := os.MkdirAll(corpus, 0755); err != nil {
+		return "", fmt.Errorf("Failed to create corpus directory %s: %s", corpus, err)
+	}
+	mergeCmd := &exec.Command{
+		Name:      destExe,
+		Args:      common.LibFuzzerMergeArgsFor(category, corpus, filepath.Join(config.Generator.FuzzSamples, category)),
+		Dir:       filepath.Join(config.Generator.WorkingPath, category),
+		LogStdout: true,
+		LogStderr: true,
+		Env:       []string{common.ASAN_OPTIONS},
+		Verbose:   exec.Debug,
+	}
+	// libFuzzer can fuzz from an empty corpus, so a failed merge (e.g. a seed that crashes) is not
+	// fatal.
+	if err := exec.Run(mergeCmd); err != nil {
+		sklog.Warningf("[%s] Could not merge seed files into corpus, starting from an empty corpus: %s", category, err)
+	}
+	return destExe, nil
+}
+
+// commands returns n libFuzzer commands that share the corpus.
+func (libFuzzerEngine) commands(category, executable string, n int) ([]*exec.Command, error) {
+	cmds := []*exec.Command{}
+	for i := 0; i < n; i++ {
+		artifactPath := filepath.Join(config.Generator.AflOutputPath, category, fmt.Sprintf("fuzzer%d", i), "crashes")
+		if err := os.MkdirAll(artifactPath, 0755); err != nil {
+			return nil, fmt.Errorf("Failed to create crashes directory %s: %s", artifactPath, err)
+		}
+		cmd := &exec.Command{
+			Name:      executable,
+			Args:      common.LibFuzzerGenerationArgsFor(category, corpusPath(category), artifactPath),
+			Dir:       filepath.Join(config.Generator.WorkingPath, category),
+			LogStdout: true,
+			LogStderr: true,
+			Env:       []string{common.ASAN_OPTIONS},
+			Verbose:   exec.Debug,
+		}
+		// libFuzzer reports its progress on stderr.
+		if i == 0 && config.Generator.WatchAFL {
+			cmd.Stderr = os.Stderr
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds, nil
+}
+
+// stopped does nothing, as libFuzzer keeps no state outside of the corpus and the crashes, which
+// are cleared out when the generator is restarted.
+func (libFuzzerEngine) stopped(category string) {}
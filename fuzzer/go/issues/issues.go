@@ -9,9 +9,13 @@ import (
 	"strings"
 
 	"go.skia.org/infra/fuzzer/go/common"
+	"go.skia.org/infra/fuzzer/go/data"
 	"go.skia.org/infra/go/issues"
+	"go.skia.org/infra/go/sklog"
 )
 
+const SKIA_COMMIT_URL = "https://skia.googlesource.com/skia/+/"
+
 // bugReportingPackage is a struct containing the pieces of a fuzz that may need to have
 // a bug filed or updated.
 type IssueReportingPackage struct {
@@ -37,13 +41,14 @@ type newBug struct {
 	Name           string
 	Revision       string
 	Params         string
+	Target         string
 }
 
 var newBugTemplate = template.Must(template.New("new_bug").Parse(`# Description here about fuzz found in {{.PrettyCategory}}
 {{.Description}}
 
-To replicate, build target "fuzz" at the specified commit and run:
-out/Release/fuzz {{.Params}} ~/Downloads/{{.Name}}
+To replicate, build target "{{.Target}}" at the specified commit and run:
+out/Release/{{.Target}} {{if .Params}}{{.Params}} {{end}}~/Downloads/{{.Name}}
 
 The problem may only be revealed by an ASAN build, in which case you would need to run:
 gn gen out/ASAN --args='cc="/usr/bin/clang" cxx="/usr/bin/clang++" sanitize="ASAN"'
@@ -117,6 +122,7 @@ func issueMessage(p IssueReportingPackage, desc string) (string, error) {
 		Description:    desc,
 		Name:           p.FuzzName,
 		Params:         common.ReplicationArgs(p.Category),
+		Target:         common.ExecutableName(p.Category),
 		Revision:       p.CommitRevision,
 	}
 	var t bytes.Buffer
@@ -125,3 +131,44 @@ func issueMessage(p IssueReportingPackage, desc string) (string, error) {
 	}
 	return t.String(), nil
 }
+
+// CommentOnFuzzIssues adds the given comment to every open issue that was filed about the given
+// fuzz.  It returns the number of issues that were commented on.
+func (im *IssuesManager) CommentOnFuzzIssues(fuzzName, comment string) (int, error) {
+	tracker := issues.NewMonorailIssueTracker(im.client)
+	// The fuzz name is in the description of every bug filed by CreateBadBugIssue.
+	found, err := tracker.FromQuery(fmt.Sprintf("label:FromSkiaFuzzer %s", fuzzName))
+	if err != nil {
+		return 0, fmt.Errorf("Could not search for issues about fuzz %s: %s", fuzzName, err)
+	}
+	n := 0
+	for _, issue := range found {
+		if err := tracker.AddComment(fmt.Sprintf("%d", issue.ID), issues.CommentRequest{Content: comment}); err != nil {
+			return n, fmt.Errorf("Could not comment on issue %d: %s", issue.ID, err)
+		}
+		sklog.Infof("Commented on issue %d about fuzz %s", issue.ID, fuzzName)
+		n++
+	}
+	return n, nil
+}
+
+// BisectedMessage returns the comment explaining the result of bisecting a fuzz, as recorded in
+// the given FuzzHistory.
+func BisectedMessage(h data.FuzzHistory) string {
+	if h.LastGoodRevision == "" {
+		return fmt.Sprintf("The fuzzer could not find the commit that introduced this crash.  It already reproduces at %s, the oldest commit that was bisected.", SKIA_COMMIT_URL+h.IntroducedRevision)
+	}
+	return fmt.Sprintf("The fuzzer bisected this crash to the commits after %s up to and including %s.", SKIA_COMMIT_URL+h.LastGoodRevision, SKIA_COMMIT_URL+h.IntroducedRevision)
+}
+
+// FixedMessage returns the comment reporting that a fuzz no longer reproduces, as recorded in the
+// given FuzzHistory.
+func FixedMessage(h data.FuzzHistory) string {
+	return fmt.Sprintf("This crash no longer reproduces at %s.  If the fix was intentional, this issue can be closed.", SKIA_COMMIT_URL+h.FixedRevision)
+}
+
+// RegressedMessage returns the comment reporting that a fuzz that was thought to be fixed
+// reproduces again at the given revision.
+func RegressedMessage(revision string) string {
+	return fmt.Sprintf("This crash, which was thought to be fixed, reproduces again at %s.", SKIA_COMMIT_URL+revision)
+}
@@ -3,6 +3,7 @@ package issues
 import (
 	"testing"
 
+	"go.skia.org/infra/fuzzer/go/data"
 	"go.skia.org/infra/go/issues"
 	"go.skia.org/infra/go/mockhttpclient"
 	"go.skia.org/infra/go/testutils"
@@ -47,6 +48,24 @@ func TestCreateBadBugIssue(t *testing.T) {
 	}
 }
 
+func TestBisectedMessage(t *testing.T) {
+	testutils.SmallTest(t)
+	h := data.FuzzHistory{
+		IntroducedRevision: "fedcba9876543210",
+		LastGoodRevision:   "0123456789abcdef",
+	}
+	expected := "The fuzzer bisected this crash to the commits after https://skia.googlesource.com/skia/+/0123456789abcdef up to and including https://skia.googlesource.com/skia/+/fedcba9876543210."
+	if m := BisectedMessage(h); m != expected {
+		t.Errorf("Message does not match.  Expected: %s\n\nWas: %s\n", expected, m)
+	}
+
+	h.LastGoodRevision = ""
+	expected = "The fuzzer could not find the commit that introduced this crash.  It already reproduces at https://skia.googlesource.com/skia/+/fedcba9876543210, the oldest commit that was bisected."
+	if m := BisectedMessage(h); m != expected {
+		t.Errorf("Message does not match.  Expected: %s\n\nWas: %s\n", expected, m)
+	}
+}
+
 var expectedIssueRequest = []byte(`{"status":"New","owner":{"name":"caryclark@google.com","htmlLink":"","kind":""},"cc":[{"name":"kjlubick@google.com","htmlLink":"","kind":""}],"labels":["FromSkiaFuzzer","Restrict-View-Google","Type-Defect","Priority-Medium"],"summary":"New crash found in API - ParsePath by fuzzer","description":"# Description here about fuzz found in API - ParsePath\nMock fuzzer found a problem\n\nTo replicate, build target \"fuzz\" at the specified commit and run:\nout/Release/fuzz --type api --name ParsePath --bytes ~/Downloads/1234567890abcdef\n\nThe problem may only be revealed by an ASAN build, in which case you would need to run:\ngn gen out/ASAN --args='cc=\"/usr/bin/clang\" cxx=\"/usr/bin/clang++\" sanitize=\"ASAN\"'\nor:\ngn gen out/ASAN --args='cc=\"/usr/bin/clang\" cxx=\"/usr/bin/clang++\" sanitize=\"ASAN\" is_debug=false'\n\nprior to building.\n\n# tracking metadata below:\nfuzz_category: api_parse_path\nfuzz_commit: fedcba9876543210\nrelated_fuzz: https://fuzzer.skia.org/category/api_parse_path/name/1234567890abcdef\nfuzz_download: https://fuzzer.skia.org/fuzz/1234567890abcdef\n"}
 `)
 
@@ -73,6 +73,7 @@ type fuzzPackage struct {
 	ReleaseASANName  string
 	ReleaseDumpName  string
 	ReleaseErrName   string
+	HistoryName      string
 }
 
 // fetchFuzzPackages scans for all fuzzes in the given folder and returns a slice of all of the
@@ -94,6 +95,7 @@ func fetchFuzzPackages(s *storage.Client, baseFolder, category, architecture str
 			ReleaseASANName:  fmt.Sprintf("%s_release.asan", prefix),
 			ReleaseDumpName:  fmt.Sprintf("%s_release.dump", prefix),
 			ReleaseErrName:   fmt.Sprintf("%s_release.err", prefix),
+			HistoryName:      HistoryPath(category, architecture, fuzzName),
 		})
 	}
 	return fuzzPackages, nil
@@ -129,6 +131,7 @@ func download(s *storage.Client, toDownload <-chan fuzzPackage, reports chan<- d
 				Dump:   emptyStringOnError(gcs.FileContentsFromGCS(s, config.GCS.Bucket, job.ReleaseDumpName)),
 				StdErr: emptyStringOnError(gcs.FileContentsFromGCS(s, config.GCS.Bucket, job.ReleaseErrName)),
 			},
+			History: parseHistory(gcs.FileContentsFromGCS(s, config.GCS.Bucket, job.HistoryName)),
 		}
 
 		reports <- data.ParseReport(p)
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"go.skia.org/infra/fuzzer/go/data"
+	"go.skia.org/infra/go/gcs"
+	"go.skia.org/infra/go/sklog"
+	"golang.org/x/net/context"
+)
+
+// HistoryPath returns the path in GCS of the data.FuzzHistory of a fuzz.  Histories are kept
+// outside of the revision folders, so they carry over when the fuzzer rolls to a new revision.
+func HistoryPath(category, architecture, name string) string {
+	return fmt.Sprintf("%s/history/%s/%s.json", category, architecture, name)
+}
+
+// GetFuzzHistory returns the data.FuzzHistory of a fuzz.  If the fuzz has no history yet, an
+// empty FuzzHistory is returned.
+func GetFuzzHistory(c FuzzerGCSClient, category, architecture, name string) (data.FuzzHistory, error) {
+	h := data.FuzzHistory{}
+	b, err := c.GetFileContents(context.Background(), HistoryPath(category, architecture, name))
+	if err != nil {
+		if isNotExist(err) {
+			return h, nil
+		}
+		return h, fmt.Errorf("Could not read history of fuzz %s: %s", name, err)
+	}
+	if err := json.Unmarshal(b, &h); err != nil {
+		return h, fmt.Errorf("Could not decode history of fuzz %s: %s", name, err)
+	}
+	return h, nil
+}
+
+// SetFuzzHistory stores the data.FuzzHistory of a fuzz, overwriting any previous history.
+func SetFuzzHistory(c FuzzerGCSClient, category, architecture, name string, h data.FuzzHistory) error {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return fmt.Errorf("Could not encode history of fuzz %s: %s", name, err)
+	}
+	if err := c.SetFileContents(context.Background(), HistoryPath(category, architecture, name), gcs.FILE_WRITE_OPTS_TEXT, b); err != nil {
+		return fmt.Errorf("Could not store history of fuzz %s: %s", name, err)
+	}
+	return nil
+}
+
+// isNotExist returns true if the error is GCS saying the requested file does not exist.
+func isNotExist(err error) bool {
+	return err == storage.ErrObjectNotExist || strings.Contains(err.Error(), "404")
+}
+
+// parseHistory decodes a data.FuzzHistory downloaded from GCS.  Most fuzzes have no history, so
+// a failed download results in an empty FuzzHistory without any warnings.
+func parseHistory(b []byte, err error) data.FuzzHistory {
+	h := data.FuzzHistory{}
+	if err != nil {
+		return h
+	}
+	if err := json.Unmarshal(b, &h); err != nil {
+		sklog.Warningf("Ignoring malformed fuzz history: %s", err)
+	}
+	return h
+}
@@ -31,6 +31,7 @@ import (
 // The desired order for all Opts is:
 //  0 - base
 //  1 - cloudlogging
+//  2 - jsonlogging
 //  3 - prometheus
 //
 // Construct the Opts that are desired and pass them to common.InitWith(), i.e.:
@@ -145,6 +146,30 @@ func (o *cloudLoggingInitOpt) order() int {
 	return 1
 }
 
+// jsonLoggingInitOpt implements Opt for JSON logging.
+type jsonLoggingInitOpt struct{}
+
+// JSONLoggingOpt creates an Opt which causes logs to be written to stderr as
+// JSON lines when passed to InitWith(). Has no effect if cloud logging is also
+// initialized. See sklog.SetJSONOutput.
+func JSONLoggingOpt() Opt {
+	return &jsonLoggingInitOpt{}
+}
+
+func (o *jsonLoggingInitOpt) preinit(appName string) error {
+	glog.Info("jsonlogging preinit")
+	sklog.SetJSONOutput(os.Stderr)
+	return nil
+}
+
+func (o *jsonLoggingInitOpt) init(appName string) error {
+	return nil
+}
+
+func (o *jsonLoggingInitOpt) order() int {
+	return 2
+}
+
 // promInitOpt implments Opt for Prometheus.
 type promInitOpt struct {
 	port *string
@@ -0,0 +1,231 @@
+// Package cron parses cron-style schedule expressions and computes the times
+// at which they fire.
+//
+// Expressions use the standard five fields:
+//
+//   minute hour day-of-month month day-of-week
+//
+// Each field may be "*", a single value, a range "a-b", a list "a,b,c", or
+// any of those followed by a step "/n". Day-of-week accepts 0-7, where both 0
+// and 7 indicate Sunday. As in Vixie cron, if both day-of-month and
+// day-of-week are restricted, a day matches if either field matches.
+//
+// The following descriptors are also accepted:
+//
+//   @yearly, @annually  0 0 1 1 *
+//   @monthly            0 0 1 * *
+//   @weekly             0 0 * * 0
+//   @daily, @midnight   0 0 * * *
+//   @nightly            0 5 * * *
+//   @hourly             0 * * * *
+//
+// All schedules are evaluated in UTC.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MAX_SEARCH_YEARS is how far into the future Next will look for a
+	// matching time before giving up.
+	MAX_SEARCH_YEARS = 5
+)
+
+var (
+	// DESCRIPTORS maps the supported "@" descriptors to their equivalent
+	// five-field expressions. "@nightly" matches the time used by the
+	// task-scheduler-trigger-nightly systemd timer.
+	DESCRIPTORS = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@nightly":  "0 5 * * *",
+		"@hourly":   "0 * * * *",
+	}
+)
+
+// field describes the allowed range of one field of an expression.
+type field struct {
+	name string
+	min  int
+	max  int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day-of-month", 1, 31},
+	{"month", 1, 12},
+	{"day-of-week", 0, 7},
+}
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	spec string
+
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+
+	// domStar and dowStar indicate whether the day-of-month and day-of-week
+	// fields were unrestricted, which determines how they are combined.
+	domStar bool
+	dowStar bool
+}
+
+// IsDescriptor returns true iff the given spec is one of the supported "@"
+// descriptors.
+func IsDescriptor(spec string) bool {
+	_, ok := DESCRIPTORS[spec]
+	return ok
+}
+
+// Parse parses the given cron expression.
+func Parse(spec string) (*Schedule, error) {
+	expr := strings.TrimSpace(spec)
+	if strings.HasPrefix(expr, "@") {
+		e, ok := DESCRIPTORS[expr]
+		if !ok {
+			return nil, fmt.Errorf("Unknown cron descriptor %q", expr)
+		}
+		expr = e
+	}
+	split := strings.Fields(expr)
+	if len(split) != len(fields) {
+		return nil, fmt.Errorf("Invalid cron expression %q; expected %d fields but got %d", spec, len(fields), len(split))
+	}
+	bits := make([]uint64, len(fields))
+	for i, f := range fields {
+		b, err := parseField(split[i], f)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cron expression %q: %s", spec, err)
+		}
+		bits[i] = b
+	}
+	s := &Schedule{
+		spec:    spec,
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: strings.HasPrefix(split[2], "*"),
+		dowStar: strings.HasPrefix(split[4], "*"),
+	}
+	// Sunday may be written as either 0 or 7.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+		s.dow &^= 1 << 7
+	}
+	return s, nil
+}
+
+// parseField parses one comma-separated field of an expression into a bitset.
+func parseField(expr string, f field) (uint64, error) {
+	var rv uint64
+	for _, part := range strings.Split(expr, ",") {
+		rangeExpr := part
+		step := 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			rangeExpr = part[:idx]
+			s, err := strconv.Atoi(part[idx+1:])
+			if err != nil || s < 1 {
+				return 0, fmt.Errorf("Invalid step in %s field: %q", f.name, part)
+			}
+			step = s
+		}
+		lo, hi := f.min, f.max
+		if rangeExpr != "*" {
+			bounds := strings.SplitN(rangeExpr, "-", 2)
+			var err error
+			lo, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, fmt.Errorf("Invalid value in %s field: %q", f.name, part)
+			}
+			if len(bounds) == 2 {
+				hi, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return 0, fmt.Errorf("Invalid value in %s field: %q", f.name, part)
+				}
+			} else if step == 1 {
+				hi = lo
+			} else {
+				// "a/n" means "a-max/n".
+				hi = f.max
+			}
+		}
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("Value out of range [%d, %d] in %s field: %q", f.min, f.max, f.name, part)
+		}
+		for i := lo; i <= hi; i += step {
+			rv |= 1 << uint(i)
+		}
+	}
+	return rv, nil
+}
+
+// String returns the expression from which the Schedule was parsed.
+func (s *Schedule) String() string {
+	return s.spec
+}
+
+// dayMatches returns true iff the given time falls on a day matching the
+// Schedule.
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next returns the first time strictly after t at which the Schedule fires,
+// in UTC. Returns the zero time if the Schedule never fires, eg. "0 0 30 2 *".
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(MAX_SEARCH_YEARS, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, time.UTC)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// Between returns the times in (start, end] at which the Schedule fires, in
+// chronological order. At most max times are returned, keeping the latest
+// ones; if max is zero, all times are returned.
+func (s *Schedule) Between(start, end time.Time, max int) []time.Time {
+	rv := []time.Time{}
+	for t := s.Next(start); !t.IsZero() && !t.After(end); t = s.Next(t) {
+		rv = append(rv, t)
+		if max > 0 && len(rv) > max {
+			rv = rv[1:]
+		}
+	}
+	return rv
+}
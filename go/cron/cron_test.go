@@ -0,0 +1,91 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils"
+)
+
+func TestParseErrors(t *testing.T) {
+	testutils.SmallTest(t)
+
+	for _, spec := range []string{
+		"",
+		"@sometimes",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"1-a * * * *",
+	} {
+		_, err := Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestNext(t *testing.T) {
+	testutils.SmallTest(t)
+
+	// Wednesday.
+	now := time.Date(2017, 3, 1, 12, 34, 56, 0, time.UTC)
+	for spec, expect := range map[string]time.Time{
+		"* * * * *":       time.Date(2017, 3, 1, 12, 35, 0, 0, time.UTC),
+		"@hourly":         time.Date(2017, 3, 1, 13, 0, 0, 0, time.UTC),
+		"@daily":          time.Date(2017, 3, 2, 0, 0, 0, 0, time.UTC),
+		"@nightly":        time.Date(2017, 3, 2, 5, 0, 0, 0, time.UTC),
+		"@weekly":         time.Date(2017, 3, 5, 0, 0, 0, 0, time.UTC),
+		"@monthly":        time.Date(2017, 4, 1, 0, 0, 0, 0, time.UTC),
+		"@yearly":         time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		"0 */6 * * *":     time.Date(2017, 3, 1, 18, 0, 0, 0, time.UTC),
+		"30 1-3,22 * * *": time.Date(2017, 3, 1, 22, 30, 0, 0, time.UTC),
+		"0 0 * * 7":       time.Date(2017, 3, 5, 0, 0, 0, 0, time.UTC),
+		"0 0 * * 1-5":     time.Date(2017, 3, 2, 0, 0, 0, 0, time.UTC),
+		"0 0 29 2 *":      time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC),
+		// Both day fields restricted: either may match.
+		"0 0 15 * 5": time.Date(2017, 3, 3, 0, 0, 0, 0, time.UTC),
+		// Never fires.
+		"0 0 30 2 *": time.Time{},
+	} {
+		s, err := Parse(spec)
+		assert.NoError(t, err)
+		assert.Equal(t, expect, s.Next(now), spec)
+	}
+
+	// Next is strictly after the given time.
+	s, err := Parse("@hourly")
+	assert.NoError(t, err)
+	hour := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, hour.Add(time.Hour), s.Next(hour))
+
+	// Times are converted to UTC.
+	loc := time.FixedZone("UTC-8", -8*60*60)
+	assert.Equal(t, hour.Add(time.Hour), s.Next(hour.In(loc)))
+}
+
+func TestBetween(t *testing.T) {
+	testutils.SmallTest(t)
+
+	s, err := Parse("0 */6 * * *")
+	assert.NoError(t, err)
+	start := time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	assert.Equal(t, []time.Time{
+		start.Add(6 * time.Hour),
+		start.Add(12 * time.Hour),
+		start.Add(18 * time.Hour),
+		end,
+	}, s.Between(start, end, 0))
+	assert.Equal(t, []time.Time{
+		start.Add(18 * time.Hour),
+		end,
+	}, s.Between(start, end, 2))
+	assert.Equal(t, []time.Time{}, s.Between(start, start.Add(time.Hour), 0))
+}
@@ -60,13 +60,47 @@ func (g GitDir) Git(cmd ...string) (string, error) {
 	return exec.RunCwd(string(g), append([]string{"git"}, cmd...)...)
 }
 
+// DETAILS_FORMAT is the --format passed to "git log" by Details and
+// LogDetails. Each commit starts with a NUL byte so that the output for
+// multiple commits can be split unambiguously.
+const DETAILS_FORMAT = "--format=format:%x00%H%n%P%n%an%x20(%ae)%n%s%n%ct%n%b"
+
 // Details returns a vcsinfo.LongCommit instance representing the given commit.
 func (g GitDir) Details(name string) (*vcsinfo.LongCommit, error) {
-	output, err := g.Git("log", "-n", "1", "--format=format:%H%n%P%n%an%x20(%ae)%n%s%n%ct%n%b", name)
+	commits, err := g.LogDetails("-n", "1", name)
+	if err != nil {
+		return nil, err
+	}
+	if len(commits) != 1 {
+		return nil, fmt.Errorf("Failed to parse output of 'git log'.")
+	}
+	return commits[0], nil
+}
+
+// LogDetails runs "git log" with the given arguments and returns a
+// vcsinfo.LongCommit for each commit in the output, in the order given by git.
+// This is much faster than calling Details for each commit.
+func (g GitDir) LogDetails(args ...string) ([]*vcsinfo.LongCommit, error) {
+	output, err := g.Git(append([]string{"log", DETAILS_FORMAT}, args...)...)
 	if err != nil {
 		return nil, err
 	}
-	lines := strings.SplitN(output, "\n", 6)
+	records := strings.Split(output, "\x00")
+	rv := make([]*vcsinfo.LongCommit, 0, len(records))
+	for _, record := range records[1:] {
+		c, err := parseDetails(record)
+		if err != nil {
+			return nil, err
+		}
+		rv = append(rv, c)
+	}
+	return rv, nil
+}
+
+// parseDetails parses the output of "git log" with DETAILS_FORMAT for a single
+// commit.
+func parseDetails(record string) (*vcsinfo.LongCommit, error) {
+	lines := strings.SplitN(record, "\n", 6)
 	if len(lines) != 6 {
 		return nil, fmt.Errorf("Failed to parse output of 'git log'.")
 	}
@@ -37,6 +37,27 @@ func TestGitDetails(t *testing.T) {
 	}
 }
 
+func TestGitLogDetails(t *testing.T) {
+	gb, commits := setup(t)
+	defer gb.Cleanup()
+
+	g := GitDir(gb.Dir())
+	details, err := g.LogDetails(commits[0])
+	assert.NoError(t, err)
+	assert.Equal(t, len(commits), len(details))
+	for i, c := range commits {
+		d, err := g.Details(c)
+		assert.NoError(t, err)
+		testutils.AssertDeepEqual(t, d, details[i])
+	}
+
+	details, err = g.LogDetails(fmt.Sprintf("%s..%s", commits[2], commits[0]))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(details))
+	assert.Equal(t, commits[0], details[0].Hash)
+	assert.Equal(t, commits[1], details[1].Hash)
+}
+
 func TestGitBranch(t *testing.T) {
 	gb, commits := setup(t)
 	defer gb.Cleanup()
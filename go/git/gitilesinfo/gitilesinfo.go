@@ -0,0 +1,410 @@
+// Package gitilesinfo implements vcsinfo.VCS on top of the Gitiles JSON API,
+// so that no local checkout of the repo is needed. Commits are cached on disk
+// and only the commits that are new since the last Update are requested.
+package gitilesinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.skia.org/infra/go/gitiles"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/go/vcsinfo"
+)
+
+// cache is the part of GitilesInfo that is stored on disk.
+type cache struct {
+	// Heads maps the name of each loaded branch to its head commit.
+	Heads map[string]string `json:"heads"`
+
+	// Commits contains every loaded commit. The hash is the key.
+	Commits map[string]*vcsinfo.LongCommit `json:"commits"`
+}
+
+// GitilesInfo allows querying a Git repo through Gitiles. It implements
+// vcsinfo.VCS.
+type GitilesInfo struct {
+	repo      *gitiles.Repo
+	branch    string
+	cacheFile string
+
+	cache cache
+
+	// allHeads are the heads of every branch in the repo as of the last
+	// Update, used to compute branch info.
+	allHeads map[string]string
+
+	// hashes are the commits reachable from the loaded heads, sorted by
+	// timestamp.
+	hashes []string
+	index  map[string]int
+
+	// reachable caches the commits reachable from each loaded head.
+	reachable map[string]map[string]bool
+
+	// contains caches whether a head that isn't loaded contains a commit.
+	// The key is "head..hash".
+	contains map[string]bool
+
+	// Any access to the fields above must be protected.
+	mutex sync.Mutex
+}
+
+// NewGitilesInfo creates a new GitilesInfo for the given branch of the repo.
+// Commits are cached in cacheFile, which is created if it doesn't exist. If
+// pull is false and the cache exists, no requests are made to Gitiles until
+// the next Update.
+func NewGitilesInfo(repo *gitiles.Repo, branch, cacheFile string, pull, allBranches bool) (*GitilesInfo, error) {
+	g := &GitilesInfo{
+		repo:      repo,
+		branch:    branch,
+		cacheFile: cacheFile,
+		cache: cache{
+			Heads:   map[string]string{},
+			Commits: map[string]*vcsinfo.LongCommit{},
+		},
+		allHeads: map[string]string{},
+	}
+	if err := g.readCache(); err != nil {
+		return nil, err
+	}
+	if !pull && len(g.cache.Heads) > 0 {
+		g.mutex.Lock()
+		defer g.mutex.Unlock()
+		for name, head := range g.cache.Heads {
+			g.allHeads[name] = head
+		}
+		g.rebuild()
+		return g, nil
+	}
+	return g, g.Update(true, allBranches)
+}
+
+// readCache loads the cache from disk, if it exists.
+func (g *GitilesInfo) readCache() error {
+	f, err := os.Open(g.cacheFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Failed to open cache file %s: %s", g.cacheFile, err)
+	}
+	defer util.Close(f)
+	if err := json.NewDecoder(f).Decode(&g.cache); err != nil {
+		return fmt.Errorf("Failed to decode cache file %s: %s", g.cacheFile, err)
+	}
+	if g.cache.Heads == nil {
+		g.cache.Heads = map[string]string{}
+	}
+	if g.cache.Commits == nil {
+		g.cache.Commits = map[string]*vcsinfo.LongCommit{}
+	}
+	return nil
+}
+
+// writeCache writes the cache to disk. The cache is written to a temporary
+// file first, so that a crash can't leave a partially written cache behind.
+//
+// Caller is responsible for locking the mutex.
+func (g *GitilesInfo) writeCache() error {
+	f, err := ioutil.TempFile(filepath.Dir(g.cacheFile), filepath.Base(g.cacheFile))
+	if err != nil {
+		return fmt.Errorf("Failed to create cache file: %s", err)
+	}
+	if err := json.NewEncoder(f).Encode(&g.cache); err != nil {
+		util.Close(f)
+		util.Remove(f.Name())
+		return fmt.Errorf("Failed to encode cache: %s", err)
+	}
+	if err := f.Close(); err != nil {
+		util.Remove(f.Name())
+		return fmt.Errorf("Failed to write cache: %s", err)
+	}
+	if err := os.Rename(f.Name(), g.cacheFile); err != nil {
+		return fmt.Errorf("Failed to replace cache file %s: %s", g.cacheFile, err)
+	}
+	return nil
+}
+
+// Update loads any new commits from Gitiles. Only the branch given to
+// NewGitilesInfo is loaded, unless allBranches is true. If pull is false this
+// is a no-op, since there is no local checkout to update from.
+func (g *GitilesInfo) Update(pull, allBranches bool) error {
+	if !pull {
+		return nil
+	}
+	sklog.Infof("Beginning Update of %s.", g.repo.URL)
+	allHeads, err := g.repo.Branches()
+	if err != nil {
+		return err
+	}
+	if _, ok := allHeads[g.branch]; !ok {
+		return fmt.Errorf("Branch %s not found in %s.", g.branch, g.repo.URL)
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	heads := map[string]string{}
+	for name, head := range allHeads {
+		if name != g.branch && !allBranches {
+			continue
+		}
+		heads[name] = head
+		// Note that the head may already be in Commits without the commits
+		// before it, e.g. if it was looked up by Details, so only the
+		// loaded heads can be skipped.
+		old, ok := g.cache.Heads[name]
+		if ok && old == head {
+			continue
+		}
+		// Only request the commits that are new since the last Update.
+		var commits []*vcsinfo.LongCommit
+		if ok {
+			commits, err = g.repo.Log(fmt.Sprintf("%s..%s", old, head), 0)
+			if err != nil {
+				// The old head may be gone, e.g. after a force push.
+				sklog.Warningf("Failed to load %s..%s on branch %s; reloading the whole branch: %s", old, head, name, err)
+			}
+		}
+		if !ok || err != nil {
+			commits, err = g.repo.Log(head, 0)
+			if err != nil {
+				return fmt.Errorf("Failed to load branch %s: %s", name, err)
+			}
+		}
+		for _, c := range commits {
+			g.cache.Commits[c.Hash] = c
+		}
+		sklog.Infof("Loaded %d commits from branch %s.", len(commits), name)
+	}
+	g.cache.Heads = heads
+	g.allHeads = allHeads
+	g.rebuild()
+	if err := g.writeCache(); err != nil {
+		return err
+	}
+	sklog.Infof("Finished Update of %s.", g.repo.URL)
+	return nil
+}
+
+// rebuild recomputes hashes and index from the loaded heads.
+//
+// Caller is responsible for locking the mutex.
+func (g *GitilesInfo) rebuild() {
+	g.reachable = map[string]map[string]bool{}
+	g.contains = map[string]bool{}
+	all := map[string]bool{}
+	for _, head := range g.cache.Heads {
+		for h := range g.reachableFrom(head) {
+			all[h] = true
+		}
+	}
+	hashes := make([]string, 0, len(all))
+	for h := range all {
+		hashes = append(hashes, h)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		ti := g.cache.Commits[hashes[i]].Timestamp
+		tj := g.cache.Commits[hashes[j]].Timestamp
+		if ti.Equal(tj) {
+			return hashes[i] < hashes[j]
+		}
+		return ti.Before(tj)
+	})
+	g.hashes = hashes
+	g.index = make(map[string]int, len(hashes))
+	for i, h := range hashes {
+		g.index[h] = i
+	}
+}
+
+// reachableFrom returns the loaded commits that are reachable from head.
+//
+// Caller is responsible for locking the mutex.
+func (g *GitilesInfo) reachableFrom(head string) map[string]bool {
+	if r, ok := g.reachable[head]; ok {
+		return r
+	}
+	r := map[string]bool{}
+	queue := []string{head}
+	for len(queue) > 0 {
+		h := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if r[h] {
+			continue
+		}
+		c, ok := g.cache.Commits[h]
+		if !ok {
+			continue
+		}
+		r[h] = true
+		queue = append(queue, c.Parents...)
+	}
+	g.reachable[head] = r
+	return r
+}
+
+// Details returns more information than ShortCommit about a given commit.
+// See the vcsinfo.VCS interface for details.
+func (g *GitilesInfo) Details(hash string, includeBranchInfo bool) (*vcsinfo.LongCommit, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.details(hash, includeBranchInfo)
+}
+
+// details returns more information than ShortCommit about a given commit.
+// See the vcsinfo.VCS interface for details.
+//
+// Caller is responsible for locking the mutex.
+func (g *GitilesInfo) details(hash string, includeBranchInfo bool) (*vcsinfo.LongCommit, error) {
+	c, ok := g.cache.Commits[hash]
+	if !ok {
+		var err error
+		c, err = g.repo.Details(hash)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get details of %s: %s", hash, err)
+		}
+		// The commit isn't reachable from a loaded head, so caching it
+		// doesn't change hashes.
+		g.cache.Commits[c.Hash] = c
+	}
+	// Return a copy so that callers can't modify the cache.
+	ret := &vcsinfo.LongCommit{
+		ShortCommit: &vcsinfo.ShortCommit{},
+		Parents:     c.Parents,
+		Body:        c.Body,
+		Timestamp:   c.Timestamp,
+		Branches:    map[string]bool{},
+	}
+	*ret.ShortCommit = *c.ShortCommit
+	if includeBranchInfo {
+		branches, err := g.getBranchesForCommit(c.Hash)
+		if err != nil {
+			return nil, err
+		}
+		ret.Branches = branches
+	}
+	return ret, nil
+}
+
+// getBranchesForCommit returns a string set with all the branches that can
+// reach the commit with the given hash. Loaded branches are checked locally,
+// all others are checked by asking Gitiles for the commits in hash that are
+// not in the branch head.
+//
+// Caller is responsible for locking the mutex.
+func (g *GitilesInfo) getBranchesForCommit(hash string) (map[string]bool, error) {
+	ret := map[string]bool{}
+	for name, head := range g.allHeads {
+		if _, ok := g.cache.Heads[name]; ok && g.cache.Heads[name] == head {
+			if g.reachableFrom(head)[hash] {
+				ret[name] = true
+			}
+			continue
+		}
+		key := fmt.Sprintf("%s..%s", head, hash)
+		contains, ok := g.contains[key]
+		if !ok {
+			commits, err := g.repo.Log(key, 1)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to get branches for commit %s: %s", hash, err)
+			}
+			contains = len(commits) == 0
+			g.contains[key] = contains
+		}
+		if contains {
+			ret[name] = true
+		}
+	}
+	return ret, nil
+}
+
+// From returns all commits from 'start' to HEAD.
+func (g *GitilesInfo) From(start time.Time) []string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	ret := []string{}
+	for _, h := range g.hashes {
+		if g.cache.Commits[h].Timestamp.After(start) {
+			ret = append(ret, h)
+		}
+	}
+	return ret
+}
+
+// Range returns all commits from the half open interval ['begin', 'end'), i.e.
+// includes 'begin' and excludes 'end'.
+func (g *GitilesInfo) Range(begin, end time.Time) []*vcsinfo.IndexCommit {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	ret := []*vcsinfo.IndexCommit{}
+	first := sort.Search(len(g.hashes), func(i int) bool {
+		return !g.cache.Commits[g.hashes[i]].Timestamp.Before(begin)
+	})
+	for i := first; i < len(g.hashes); i++ {
+		ts := g.cache.Commits[g.hashes[i]].Timestamp
+		if !ts.Before(end) {
+			break
+		}
+		ret = append(ret, g.indexCommit(i))
+	}
+	return ret
+}
+
+// LastNIndex returns the last N commits.
+func (g *GitilesInfo) LastNIndex(N int) []*vcsinfo.IndexCommit {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	offset := 0
+	if len(g.hashes) > N {
+		offset = len(g.hashes) - N
+	}
+	ret := []*vcsinfo.IndexCommit{}
+	for i := offset; i < len(g.hashes); i++ {
+		ret = append(ret, g.indexCommit(i))
+	}
+	return ret
+}
+
+// indexCommit returns the IndexCommit of the commit at position i.
+//
+// Caller is responsible for locking the mutex.
+func (g *GitilesInfo) indexCommit(i int) *vcsinfo.IndexCommit {
+	return &vcsinfo.IndexCommit{
+		Hash:      g.hashes[i],
+		Index:     i,
+		Timestamp: g.cache.Commits[g.hashes[i]].Timestamp,
+	}
+}
+
+// IndexOf returns the index of the given hash, where 0 is the index of the
+// first commit.
+func (g *GitilesInfo) IndexOf(hash string) (int, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	i, ok := g.index[hash]
+	if !ok {
+		return 0, fmt.Errorf("Hash %s not found.", hash)
+	}
+	return i, nil
+}
+
+// ByIndex returns a LongCommit describing the commit at position N, as ordered
+// by timestamp.
+func (g *GitilesInfo) ByIndex(N int) (*vcsinfo.LongCommit, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if N < 0 || N >= len(g.hashes) {
+		return nil, fmt.Errorf("Hash index not found: %d", N)
+	}
+	return g.details(g.hashes[N], false)
+}
+
+// Ensure that GitilesInfo implements vcsinfo.VCS.
+var _ vcsinfo.VCS = &GitilesInfo{}
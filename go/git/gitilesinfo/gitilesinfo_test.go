@@ -0,0 +1,215 @@
+package gitilesinfo
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.skia.org/infra/go/gitiles"
+	gitiles_testutils "go.skia.org/infra/go/gitiles/testutils"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/go/vcsinfo"
+
+	expect "github.com/stretchr/testify/assert"
+	assert "github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// ts returns the timestamp of the i'th commit.
+func ts(i int) time.Time {
+	return start.Add(time.Duration(i) * time.Minute)
+}
+
+func setup(t *testing.T) (*gitiles_testutils.MockRepo, *gitiles.Repo, string, func()) {
+	m := gitiles_testutils.NewMockRepo()
+	dir, err := ioutil.TempDir("", "gitilesinfo")
+	assert.NoError(t, err)
+	return m, gitiles.NewRepo(m.URL()), filepath.Join(dir, "cache.json"), func() {
+		m.Close()
+		testutils.RemoveAll(t, dir)
+	}
+}
+
+func TestGitilesInfo(t *testing.T) {
+	testutils.SmallTest(t)
+	m, repo, cacheFile, cleanup := setup(t)
+	defer cleanup()
+
+	c0 := m.Commit("master", "First commit", ts(0))
+	c1 := m.Commit("master", "Second commit\n\nWith a body.", ts(1))
+	m.CreateBranch("branch", c1)
+	b2 := m.Commit("branch", "Branch commit", ts(2))
+	c3 := m.Commit("master", "Third commit", ts(3))
+
+	g, err := NewGitilesInfo(repo, "master", cacheFile, true, false)
+	assert.NoError(t, err)
+
+	expect.Equal(t, []string{c1, c3}, g.From(ts(0)))
+	hashes := func(commits []*vcsinfo.IndexCommit) []string {
+		ret := []string{}
+		for _, c := range commits {
+			ret = append(ret, c.Hash)
+		}
+		return ret
+	}
+	expect.Equal(t, []string{c0, c1}, hashes(g.Range(ts(0), ts(3))))
+	expect.Equal(t, []string{c3}, hashes(g.Range(ts(2), ts(4))))
+	expect.Equal(t, []string{}, hashes(g.Range(ts(4), ts(5))))
+	expect.Equal(t, []string{c1, c3}, hashes(g.LastNIndex(2)))
+	expect.Equal(t, []string{c0, c1, c3}, hashes(g.LastNIndex(10)))
+	expect.Equal(t, 2, g.LastNIndex(1)[0].Index)
+	expect.Equal(t, ts(3), g.LastNIndex(1)[0].Timestamp)
+
+	i, err := g.IndexOf(c1)
+	assert.NoError(t, err)
+	expect.Equal(t, 1, i)
+	_, err = g.IndexOf(b2)
+	expect.Error(t, err)
+
+	c, err := g.ByIndex(1)
+	assert.NoError(t, err)
+	expect.Equal(t, c1, c.Hash)
+	expect.Equal(t, "Second commit", c.Subject)
+	expect.Equal(t, "With a body.", c.Body)
+	expect.Equal(t, "Test Author (test@example.com)", c.Author)
+	expect.Equal(t, []string{c0}, c.Parents)
+	expect.Equal(t, ts(1), c.Timestamp)
+	_, err = g.ByIndex(3)
+	expect.Error(t, err)
+
+	// Branch info covers branches that aren't loaded.
+	c, err = g.Details(c1, true)
+	assert.NoError(t, err)
+	expect.Equal(t, map[string]bool{"master": true, "branch": true}, c.Branches)
+	c, err = g.Details(b2, true)
+	assert.NoError(t, err)
+	expect.Equal(t, "Branch commit", c.Subject)
+	expect.Equal(t, map[string]bool{"branch": true}, c.Branches)
+	c, err = g.Details(c3, false)
+	assert.NoError(t, err)
+	expect.Equal(t, map[string]bool{}, c.Branches)
+}
+
+func TestGitilesInfoIncremental(t *testing.T) {
+	testutils.SmallTest(t)
+	m, repo, cacheFile, cleanup := setup(t)
+	defer cleanup()
+
+	c0 := m.Commit("master", "First commit", ts(0))
+	c1 := m.Commit("master", "Second commit", ts(1))
+	g, err := NewGitilesInfo(repo, "master", cacheFile, true, false)
+	assert.NoError(t, err)
+	expect.Equal(t, []string{c0, c1}, g.From(start.Add(-time.Minute)))
+
+	// Only the new commits are requested.
+	c2 := m.Commit("master", "Third commit", ts(2))
+	requests := m.Requests()
+	assert.NoError(t, g.Update(true, false))
+	expect.Equal(t, 2, m.Requests()-requests)
+	expect.Equal(t, []string{c0, c1, c2}, g.From(start.Add(-time.Minute)))
+
+	// Nothing is requested if nothing changed.
+	requests = m.Requests()
+	assert.NoError(t, g.Update(true, false))
+	expect.Equal(t, 1, m.Requests()-requests)
+
+	// A new instance starts from the cache without any requests.
+	requests = m.Requests()
+	g, err = NewGitilesInfo(repo, "master", cacheFile, false, false)
+	assert.NoError(t, err)
+	expect.Equal(t, 0, m.Requests()-requests)
+	expect.Equal(t, []string{c0, c1, c2}, g.From(start.Add(-time.Minute)))
+	c, err := g.Details(c2, false)
+	assert.NoError(t, err)
+	expect.Equal(t, "Third commit", c.Subject)
+	expect.Equal(t, 0, m.Requests()-requests)
+
+	// All branches.
+	m.CreateBranch("branch", c0)
+	b3 := m.Commit("branch", "Branch commit", ts(3))
+	assert.NoError(t, g.Update(true, true))
+	expect.Equal(t, []string{c0, c1, c2, b3}, g.From(start.Add(-time.Minute)))
+	i, err := g.IndexOf(b3)
+	assert.NoError(t, err)
+	expect.Equal(t, 3, i)
+}
+
+func TestGitilesInfoDetailsBeforeUpdate(t *testing.T) {
+	testutils.SmallTest(t)
+	m, repo, cacheFile, cleanup := setup(t)
+	defer cleanup()
+
+	c0 := m.Commit("master", "First commit", ts(0))
+	g, err := NewGitilesInfo(repo, "master", cacheFile, true, false)
+	assert.NoError(t, err)
+
+	// Looking up the new head before the Update must not cause the commits
+	// before it to be skipped.
+	c1 := m.Commit("master", "Second commit", ts(1))
+	c2 := m.Commit("master", "Third commit", ts(2))
+	c, err := g.Details(c2, false)
+	assert.NoError(t, err)
+	expect.Equal(t, "Third commit", c.Subject)
+	assert.NoError(t, g.Update(true, false))
+	expect.Equal(t, []string{c0, c1, c2}, g.From(start.Add(-time.Minute)))
+
+	// The cache on disk is complete too.
+	g, err = NewGitilesInfo(repo, "master", cacheFile, false, false)
+	assert.NoError(t, err)
+	expect.Equal(t, []string{c0, c1, c2}, g.From(start.Add(-time.Minute)))
+}
+
+func TestGitilesInfoForcePush(t *testing.T) {
+	testutils.SmallTest(t)
+	m, repo, cacheFile, cleanup := setup(t)
+	defer cleanup()
+
+	c0 := m.Commit("master", "First commit", ts(0))
+	m.Commit("master", "Bad commit", ts(1))
+	g, err := NewGitilesInfo(repo, "master", cacheFile, true, false)
+	assert.NoError(t, err)
+
+	// The old head no longer exists, so the whole branch is reloaded.
+	m.ForcePush("master", c0)
+	c2 := m.Commit("master", "Good commit", ts(2))
+	assert.NoError(t, g.Update(true, false))
+	expect.Equal(t, []string{c0, c2}, g.From(start.Add(-time.Minute)))
+}
+
+func TestGitilesInfoMerge(t *testing.T) {
+	testutils.SmallTest(t)
+	m, repo, cacheFile, cleanup := setup(t)
+	defer cleanup()
+
+	c0 := m.Commit("master", "First commit", ts(0))
+	m.CreateBranch("branch", c0)
+	b1 := m.Commit("branch", "Branch commit", ts(1))
+	c2 := m.Commit("master", "Second commit", ts(2))
+	g, err := NewGitilesInfo(repo, "master", cacheFile, true, false)
+	assert.NoError(t, err)
+	expect.Equal(t, []string{c0, c2}, g.From(start.Add(-time.Minute)))
+
+	// The merged branch commit is loaded incrementally.
+	c3 := m.Commit("master", "Merge", ts(3), b1)
+	assert.NoError(t, g.Update(true, false))
+	expect.Equal(t, []string{c0, b1, c2, c3}, g.From(start.Add(-time.Minute)))
+	c, err := g.Details(c3, false)
+	assert.NoError(t, err)
+	expect.Equal(t, []string{c2, b1}, c.Parents)
+}
+
+func TestGitilesInfoErrors(t *testing.T) {
+	testutils.SmallTest(t)
+	m, repo, cacheFile, cleanup := setup(t)
+	defer cleanup()
+
+	m.Commit("master", "First commit", ts(0))
+	_, err := NewGitilesInfo(repo, "missing", cacheFile, true, false)
+	expect.Error(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(cacheFile, []byte("not json"), 0644))
+	_, err = NewGitilesInfo(repo, "master", cacheFile, true, false)
+	expect.Error(t, err)
+}
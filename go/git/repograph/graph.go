@@ -5,23 +5,21 @@ package repograph
 */
 
 import (
-	"encoding/gob"
 	"fmt"
-	"os"
 	"path"
 	"sync"
 
 	"go.skia.org/infra/go/sklog"
 
 	"go.skia.org/infra/go/git"
-	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/go/git/repograph/rpc"
 	"go.skia.org/infra/go/vcsinfo"
 )
 
 const (
 	// Name of the file we store inside the Git checkout to speed up the
-	// initial Update().
-	CACHE_FILE = "sk_gitrepo.gob"
+	// initial Update(). See index.go for the format.
+	CACHE_FILE = "sk_gitrepo.idx"
 )
 
 // Commit represents a commit in a Git repo.
@@ -126,19 +124,23 @@ func (s CommitSlice) Hashes() []string {
 	return rv
 }
 
-// Graph represents an entire Git repo.
+// Graph represents an entire Git repo. A Graph is either backed by a local
+// git.Repo, or by a remote graph server; see NewRemote.
 type Graph struct {
 	branches    []*git.Branch
 	commits     map[string]int
 	commitsData []*Commit
 	mtx         sync.RWMutex
 	repo        *git.Repo
-}
 
-// gobGraph is a utility struct used for serializing a Graph using gob.
-type gobGraph struct {
-	Commits     map[string]int
-	CommitsData []*Commit
+	// indexed is the number of commits which have been written to
+	// CACHE_FILE.
+	indexed int
+
+	// client and repoUrl are set instead of repo if the Graph is a copy of
+	// a Graph served by a remote graph server.
+	client  rpc.RepoGraphClient
+	repoUrl string
 }
 
 // New returns a Graph instance which uses the given git.Graph.
@@ -149,22 +151,8 @@ func New(repo *git.Repo) (*Graph, error) {
 		repo:        repo,
 	}
 
-	cacheFile := path.Join(repo.Dir(), CACHE_FILE)
-	f, err := os.Open(cacheFile)
-	if err == nil {
-		var r gobGraph
-		if err := gob.NewDecoder(f).Decode(&r); err != nil {
-			util.Close(f)
-			return nil, err
-		}
-		util.Close(f)
-		rv.commits = r.Commits
-		rv.commitsData = r.CommitsData
-		for _, c := range rv.commitsData {
-			c.repo = rv
-		}
-	} else if !os.IsNotExist(err) {
-		return nil, fmt.Errorf("Failed to read cache file: %s", err)
+	if err := rv.readIndex(path.Join(repo.Dir(), CACHE_FILE)); err != nil {
+		return nil, err
 	}
 	if err := rv.Update(); err != nil {
 		return nil, err
@@ -181,8 +169,12 @@ func NewGraph(repoUrl, workdir string) (*Graph, error) {
 	return New(repo)
 }
 
-// Repo returns the underlying git.Repo object.
+// Repo returns the underlying git.Repo object. Panics if the Graph is backed
+// by a remote graph server, since there is no local checkout to return.
 func (r *Graph) Repo() *git.Repo {
+	if r.client != nil {
+		panic(fmt.Sprintf("repograph.Graph for %s is backed by a graph server and has no git.Repo.", r.repoUrl))
+	}
 	return r.repo
 }
 
@@ -193,12 +185,9 @@ func (r *Graph) Len() int {
 	return len(r.commitsData)
 }
 
-func (r *Graph) addCommit(hash string) error {
-	d, err := r.repo.Details(hash)
-	if err != nil {
-		return fmt.Errorf("repograph.Graph: Failed to obtain Git commit details: %s", err)
-	}
-
+// addCommit adds the given commit to the Graph. All of its parents must
+// already be in the Graph.
+func (r *Graph) addCommit(d *vcsinfo.LongCommit) error {
 	var parents []int
 	if len(d.Parents) > 0 {
 		parentIndices := make([]int, 0, len(d.Parents))
@@ -222,17 +211,42 @@ func (r *Graph) addCommit(hash string) error {
 		ParentIndices: parents,
 		repo:          r,
 	}
-	r.commits[hash] = len(r.commitsData)
+	r.commits[d.Hash] = len(r.commitsData)
 	r.commitsData = append(r.commitsData, c)
 	return nil
 }
 
+// tips returns the hashes of the commits in the Graph which are not the
+// parent of any other commit.
+//
+// Caller is responsible for locking the mutex.
+func (r *Graph) tips() []string {
+	isParent := make([]bool, len(r.commitsData))
+	for _, c := range r.commitsData {
+		for _, p := range c.ParentIndices {
+			isParent[p] = true
+		}
+	}
+	rv := []string{}
+	for i, c := range r.commitsData {
+		if !isParent[i] {
+			rv = append(rv, c.Hash)
+		}
+	}
+	return rv
+}
+
 // Update syncs the local copy of the repo and loads new commits/branches into
-// the Graph object.
+// the Graph object. If the Graph is backed by a remote graph server, only the
+// commits which are new since the last Update are requested from the server.
 func (r *Graph) Update() error {
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
 
+	if r.client != nil {
+		return r.updateRemote()
+	}
+
 	// Update the local copy.
 	sklog.Infof("Updating repograph.Graph...")
 	if err := r.repo.Update(); err != nil {
@@ -246,75 +260,44 @@ func (r *Graph) Update() error {
 		return fmt.Errorf("Failed to get branches for repograph.Graph: %s", err)
 	}
 
-	// Load new commits from the repo.
+	// Load new commits from the repo. Every commit we already have is
+	// reachable from one of the tips of the Graph, so excluding those lets
+	// us load only the new commits, with a single call to git for each
+	// branch.
 	sklog.Infof("  Loading commits...")
+	known := r.tips()
 	for _, b := range branches {
 		// Shortcut: If we already have the head of this branch, don't
 		// bother loading commits.
 		if _, ok := r.commits[b.Head]; ok {
 			continue
 		}
-
-		// Load all commits on this branch.
-		// First, try to load only new commits on this branch.
-		var commits []string
-		newBranch := true
-		for _, old := range r.branches {
-			if old.Name == b.Name {
-				anc, err := r.repo.IsAncestor(old.Head, b.Head)
-				if err != nil {
-					return err
-				}
-				if anc {
-					commits, err = r.repo.RevList("--topo-order", fmt.Sprintf("%s..%s", old.Head, b.Head))
-					if err != nil {
-						return err
-					}
-					newBranch = false
-				}
-				break
-			}
+		// Tips of abandoned history may have been garbage-collected.
+		args := []string{"--topo-order", "--ignore-missing", b.Head}
+		if len(known) > 0 {
+			args = append(append(args, "--not"), known...)
 		}
-		// If this is a new branch, or if the old branch head is not
-		// reachable from the new (eg. if commit history was modified),
-		// load ALL commits reachable from the branch head.
-		if newBranch {
-			sklog.Infof("  Branch %s is new or its history has changed; loading all commits.", b.Name)
-			commits, err = r.repo.RevList("--topo-order", b.Head)
-			if err != nil {
-				return fmt.Errorf("Failed to 'git rev-list' for repograph.Graph: %s", err)
-			}
+		commits, err := r.repo.LogDetails(args...)
+		if err != nil {
+			return fmt.Errorf("Failed to 'git log' for repograph.Graph: %s", err)
 		}
+		sklog.Infof("  Loading %d new commits from branch %s.", len(commits), b.Name)
+		// git log lists children before parents.
 		for i := len(commits) - 1; i >= 0; i-- {
-			hash := commits[i]
-			if hash == "" {
+			if _, ok := r.commits[commits[i].Hash]; ok {
 				continue
 			}
-			if _, ok := r.commits[hash]; ok {
-				continue
-			}
-			if err := r.addCommit(hash); err != nil {
+			if err := r.addCommit(commits[i]); err != nil {
 				return err
 			}
 		}
+		known = append(known, b.Head)
 	}
 	r.branches = branches
 
-	// Write to the cache file.
+	// Append the new commits to the cache file.
 	sklog.Infof("  Writing cache file...")
-	cacheFile := path.Join(r.repo.Dir(), CACHE_FILE)
-	f, err := os.Create(cacheFile)
-	if err != nil {
-		return err
-	}
-	if err := gob.NewEncoder(f).Encode(gobGraph{
-		Commits:     r.commits,
-		CommitsData: r.commitsData,
-	}); err != nil {
-		defer util.Close(f)
-		return err
-	}
-	if err := f.Close(); err != nil {
+	if err := r.writeIndex(path.Join(r.repo.Dir(), CACHE_FILE)); err != nil {
 		return err
 	}
 	sklog.Infof("  Done. Graph has %d commits.", len(r.commits))
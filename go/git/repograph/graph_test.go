@@ -1,15 +1,18 @@
 package repograph
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"path"
 	"testing"
 
 	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/git/repograph/rpc"
 	git_testutils "go.skia.org/infra/go/git/testutils"
 	"go.skia.org/infra/go/testutils"
 	"go.skia.org/infra/go/util"
+	"golang.org/x/net/context"
 )
 
 // gitSetup initializes a Git repo in a temporary directory with some commits.
@@ -351,3 +354,139 @@ func TestUpdateHistoryChanged(t *testing.T) {
 		return true, nil
 	}))
 }
+
+func TestIndexCorrupt(t *testing.T) {
+	testutils.MediumTest(t)
+	testutils.SkipIfShort(t)
+	g, repo, _, cleanup := gitSetup(t)
+	defer cleanup()
+
+	// Simulate a crash while appending to the index.
+	indexFile := path.Join(repo.repo.Dir(), CACHE_FILE)
+	before, err := ioutil.ReadFile(indexFile)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(indexFile, append(before, []byte(`{"hash":"abc`)...), 0644))
+
+	repo2, err := NewGraph(g.Dir(), path.Dir(repo.repo.Dir()))
+	assert.NoError(t, err)
+	assert.Equal(t, repo.Len(), repo2.Len())
+	after, err := ioutil.ReadFile(indexFile)
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	// A commit whose parent isn't in the index is also discarded, along
+	// with everything after it, and then reloaded.
+	lines := bytes.SplitAfter(before, []byte("\n"))
+	corrupt := append(append([]byte{}, lines[0]...), lines[2]...)
+	assert.NoError(t, ioutil.WriteFile(indexFile, append(corrupt, lines[1]...), 0644))
+	repo3, err := NewGraph(g.Dir(), path.Dir(repo.repo.Dir()))
+	assert.NoError(t, err)
+	assert.Equal(t, repo.Len(), repo3.Len())
+	assert.Equal(t, repo.Get("master").Hash, repo3.Get("master").Hash)
+	assert.Equal(t, repo.Get("master").GetParents()[0].Hash, repo3.Get("master").GetParents()[0].Hash)
+}
+
+func TestRemote(t *testing.T) {
+	testutils.MediumTest(t)
+	testutils.SkipIfShort(t)
+	g, repo, commits, cleanup := gitSetup(t)
+	defer cleanup()
+
+	port, err := RunServer(":0", Map{g.Dir(): repo})
+	assert.NoError(t, err)
+	m, err := NewRemoteMap(fmt.Sprintf("localhost%s", port), []string{g.Dir()})
+	assert.NoError(t, err)
+	remote := m[g.Dir()]
+	assert.Panics(t, func() {
+		remote.Repo()
+	})
+
+	check := func() {
+		assert.Equal(t, repo.Len(), remote.Len())
+		assert.Equal(t, repo.Branches(), remote.Branches())
+		for _, b := range repo.Branches() {
+			expect := []string{}
+			assert.NoError(t, repo.Get(b).Recurse(func(c *Commit) (bool, error) {
+				expect = append(expect, c.Hash)
+				return true, nil
+			}))
+			actual := []string{}
+			assert.NoError(t, remote.Get(b).Recurse(func(c *Commit) (bool, error) {
+				actual = append(actual, c.Hash)
+				return true, nil
+			}))
+			assert.Equal(t, expect, actual)
+		}
+	}
+	check()
+	c := remote.Get(commits[4].Hash)
+	assert.NotNil(t, c)
+	assert.Equal(t, commits[4].Subject, c.Subject)
+	assert.True(t, c.HasAncestor(commits[2].Hash))
+
+	// Only new commits are sent.
+	g.CommitGen("myfile.txt")
+	assert.NoError(t, repo.Update())
+	client := remote.client
+	resp, err := client.GetCommits(context.Background(), &rpc.GetCommitsRequest{
+		Repo:     g.Dir(),
+		Start:    int64(remote.Len()),
+		PrevHash: remote.commitsData[remote.Len()-1].Hash,
+	})
+	assert.NoError(t, err)
+	assert.False(t, resp.Reset_)
+	assert.Equal(t, 1, len(resp.Commits))
+	assert.NoError(t, m.Update())
+	check()
+	assert.Equal(t, repo.Get("master").Hash, remote.Get("master").Hash)
+
+	// An inconsistent copy is reset.
+	resp, err = client.GetCommits(context.Background(), &rpc.GetCommitsRequest{
+		Repo:     g.Dir(),
+		Start:    2,
+		PrevHash: "abc123",
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.Reset_)
+	assert.False(t, resp.More)
+	assert.Equal(t, repo.Len(), len(resp.Commits))
+
+	// Large histories are sent in pages, with the branches on the last.
+	defer func(size int) {
+		commitsPageSize = size
+	}(commitsPageSize)
+	commitsPageSize = 1
+	resp, err = client.GetCommits(context.Background(), &rpc.GetCommitsRequest{
+		Repo: g.Dir(),
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.More)
+	assert.Equal(t, 1, len(resp.Commits))
+	assert.Equal(t, 0, len(resp.Branches))
+	paged, err := NewRemote(client, g.Dir())
+	assert.NoError(t, err)
+	assert.Equal(t, repo.Len(), paged.Len())
+	assert.Equal(t, repo.Branches(), paged.Branches())
+	assert.Equal(t, repo.Get("master").Hash, paged.Get("master").Hash)
+
+	// Ancestry queries.
+	anc, err := client.HasAncestor(context.Background(), &rpc.HasAncestorRequest{
+		Repo:     g.Dir(),
+		Commit:   commits[4].Hash,
+		Ancestor: commits[2].Hash,
+	})
+	assert.NoError(t, err)
+	assert.True(t, anc.Val)
+	anc, err = client.HasAncestor(context.Background(), &rpc.HasAncestorRequest{
+		Repo:     g.Dir(),
+		Commit:   commits[2].Hash,
+		Ancestor: commits[3].Hash,
+	})
+	assert.NoError(t, err)
+	assert.False(t, anc.Val)
+	_, err = client.HasAncestor(context.Background(), &rpc.HasAncestorRequest{
+		Repo:   "bogus",
+		Commit: commits[2].Hash,
+	})
+	assert.Error(t, err)
+}
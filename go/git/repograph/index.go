@@ -0,0 +1,123 @@
+package repograph
+
+/*
+   The on-disk index of a Graph. The index file contains one JSON-encoded
+   Commit per line, in the same order as Graph.commitsData. Since commits are
+   never removed from a Graph, Update only needs to append the commits which
+   are new since the last Update, rather than rewriting the whole Graph.
+*/
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+)
+
+// decodeCommit decodes and validates a single commit from the index or from a
+// remote graph server, which is to be added at the end of the Graph.
+//
+// Caller is responsible for locking the mutex.
+func (r *Graph) decodeCommit(b []byte) (*Commit, error) {
+	var c Commit
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	if c.LongCommit == nil || c.ShortCommit == nil {
+		return nil, fmt.Errorf("Commit is missing details.")
+	}
+	if _, ok := r.commits[c.Hash]; ok {
+		return nil, fmt.Errorf("Duplicate commit %s", c.Hash)
+	}
+	for _, p := range c.ParentIndices {
+		if p < 0 || p >= len(r.commitsData) {
+			return nil, fmt.Errorf("Commit %s has invalid parent index %d", c.Hash, p)
+		}
+	}
+	// git.GitDir.Details returns times in the local time zone.
+	c.Timestamp = c.Timestamp.Local()
+	c.repo = r
+	return &c, nil
+}
+
+// appendCommit adds a decoded commit to the end of the Graph.
+//
+// Caller is responsible for locking the mutex.
+func (r *Graph) appendCommit(c *Commit) {
+	r.commits[c.Hash] = len(r.commitsData)
+	r.commitsData = append(r.commitsData, c)
+}
+
+// readIndex loads the commits in the given index file into the Graph. If the
+// end of the file is corrupt, eg. because we crashed while writing it, the
+// corrupt part is discarded and the commits will be reloaded by Update.
+func (r *Graph) readIndex(file string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Failed to read cache file: %s", err)
+	}
+	defer util.Close(f)
+	rd := bufio.NewReader(f)
+	valid := int64(0)
+	for {
+		line, err := rd.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			break
+		} else if err != nil && err != io.EOF {
+			return fmt.Errorf("Failed to read cache file: %s", err)
+		}
+		c, decodeErr := r.decodeCommit(line)
+		if decodeErr != nil || err == io.EOF {
+			// A line without a trailing newline was only partially
+			// written.
+			sklog.Warningf("Discarding corrupt end of %s after %d commits: %v", file, len(r.commitsData), decodeErr)
+			if err := os.Truncate(file, valid); err != nil {
+				return fmt.Errorf("Failed to truncate cache file: %s", err)
+			}
+			break
+		}
+		r.appendCommit(c)
+		valid += int64(len(line))
+	}
+	r.indexed = len(r.commitsData)
+	return nil
+}
+
+// writeIndex appends the commits which were added since the last call to
+// readIndex or writeIndex to the given index file.
+//
+// Caller is responsible for locking the mutex.
+func (r *Graph) writeIndex(file string) error {
+	if r.indexed == len(r.commitsData) {
+		return nil
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("Failed to open cache file: %s", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, c := range r.commitsData[r.indexed:] {
+		if err := enc.Encode(c); err != nil {
+			util.Close(f)
+			return fmt.Errorf("Failed to write cache file: %s", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		util.Close(f)
+		return fmt.Errorf("Failed to write cache file: %s", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("Failed to write cache file: %s", err)
+	}
+	r.indexed = len(r.commitsData)
+	return nil
+}
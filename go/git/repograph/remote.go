@@ -0,0 +1,102 @@
+package repograph
+
+import (
+	"fmt"
+
+	"go.skia.org/infra/go/git"
+	"go.skia.org/infra/go/git/repograph/rpc"
+	"go.skia.org/infra/go/sklog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// NewRemote returns a Graph which is a copy of the Graph for the given repo
+// served by a graph server; see RunServer. Update only requests the commits
+// which are new since the last Update, so that many services can share one
+// up-to-date Graph without each keeping a checkout of the repo. Since there
+// is no checkout, Repo panics for the returned Graph; callers which need to
+// run git commands must use a local Graph.
+func NewRemote(client rpc.RepoGraphClient, repoUrl string) (*Graph, error) {
+	rv := &Graph{
+		commits:     map[string]int{},
+		commitsData: []*Commit{},
+		client:      client,
+		repoUrl:     repoUrl,
+	}
+	if err := rv.Update(); err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// NewRemoteMap returns a Map with remote Graphs for the given repo URLs,
+// served by the graph server at the given address.
+func NewRemoteMap(addr string, repos []string) (Map, error) {
+	// RunServer doesn't use TLS.
+	conn, err := grpc.Dial(addr, grpc.WithInsecure(), grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(MAX_MESSAGE_SIZE), grpc.MaxCallSendMsgSize(MAX_MESSAGE_SIZE)))
+	if err != nil {
+		return nil, err
+	}
+	client := rpc.NewRepoGraphClient(conn)
+	rv := make(map[string]*Graph, len(repos))
+	for _, r := range repos {
+		g, err := NewRemote(client, r)
+		if err != nil {
+			return nil, err
+		}
+		rv[r] = g
+	}
+	return rv, nil
+}
+
+// updateRemote loads new commits and branches from the graph server.
+//
+// Caller is responsible for locking the mutex.
+func (r *Graph) updateRemote() error {
+	sklog.Infof("Updating repograph.Graph for %s from graph server...", r.repoUrl)
+	// Request pages of commits until we have all of them. Commits are
+	// appended as they arrive, so that a failure part way through still
+	// leaves us with a consistent Graph, and the next Update resumes where
+	// this one stopped.
+	var resp *rpc.GetCommitsResponse
+	for resp == nil || resp.More {
+		req := &rpc.GetCommitsRequest{
+			Repo:  r.repoUrl,
+			Start: int64(len(r.commitsData)),
+		}
+		if len(r.commitsData) > 0 {
+			req.PrevHash = r.commitsData[len(r.commitsData)-1].Hash
+		}
+		var err error
+		resp, err = r.client.GetCommits(context.Background(), req)
+		if err != nil {
+			return fmt.Errorf("Failed to update repograph.Graph from graph server: %s", err)
+		}
+		if resp.Reset_ {
+			sklog.Warningf("Graph server has a different history for %s; reloading all commits.", r.repoUrl)
+			r.commits = map[string]int{}
+			r.commitsData = []*Commit{}
+			r.branches = []*git.Branch{}
+		}
+		for _, b := range resp.Commits {
+			c, err := r.decodeCommit(b)
+			if err != nil {
+				return fmt.Errorf("Graph server sent an invalid commit: %s", err)
+			}
+			r.appendCommit(c)
+		}
+	}
+	branches := make([]*git.Branch, 0, len(resp.Branches))
+	for _, b := range resp.Branches {
+		if _, ok := r.commits[b.Head]; !ok {
+			return fmt.Errorf("Branch %s points to unknown commit %s", b.Name, b.Head)
+		}
+		branches = append(branches, &git.Branch{
+			Name: b.Name,
+			Head: b.Head,
+		})
+	}
+	r.branches = branches
+	sklog.Infof("  Done. Graph has %d commits.", len(r.commits))
+	return nil
+}
@@ -0,0 +1,135 @@
+package repograph
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"go.skia.org/infra/go/git/repograph/rpc"
+	"go.skia.org/infra/go/sklog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+const (
+	// MAX_MESSAGE_SIZE is the maximum size of gRPC messages sent and received
+	// by the graph server and its clients. Responses are paged to stay well
+	// below this, but a single commit may be large.
+	MAX_MESSAGE_SIZE = 64 * 1024 * 1024
+)
+
+// commitsPageSize is the number of bytes of commits after which GetCommits
+// stops adding commits to a response. Overridden in tests.
+var commitsPageSize = 1024 * 1024
+
+// RunServer starts a gRPC server on the given port which serves the Graphs in
+// the given Map, and returns its address. The caller is responsible for
+// calling Update on the Map periodically.
+func RunServer(port string, repos Map) (string, error) {
+	lis, err := net.Listen("tcp", port)
+	if err != nil {
+		return "", fmt.Errorf("Failed to create graph server: failed to listen on port %q: %s", port, err)
+	}
+	s := grpc.NewServer(
+		grpc.MaxRecvMsgSize(MAX_MESSAGE_SIZE),
+		grpc.MaxSendMsgSize(MAX_MESSAGE_SIZE))
+	rpc.RegisterRepoGraphServer(s, &rpcServer{repos: repos})
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			sklog.Errorf("Failed to run RPC server: %s", err)
+		}
+	}()
+	addrSplit := strings.Split(lis.Addr().String(), ":")
+	return fmt.Sprintf(":%s", addrSplit[len(addrSplit)-1]), nil
+}
+
+// rpcServer implements rpc.RepoGraphServer.
+type rpcServer struct {
+	repos Map
+}
+
+// graph returns the Graph for the given repo.
+func (s *rpcServer) graph(repo string) (*Graph, error) {
+	g, ok := s.repos[repo]
+	if !ok {
+		return nil, fmt.Errorf("Unknown repo %q", repo)
+	}
+	return g, nil
+}
+
+func (s *rpcServer) GetRepos(ctx context.Context, req *rpc.Empty) (*rpc.Repos, error) {
+	repos := s.repos.RepoURLs()
+	sort.Strings(repos)
+	return &rpc.Repos{
+		Repos: repos,
+	}, nil
+}
+
+func (s *rpcServer) GetCommits(ctx context.Context, req *rpc.GetCommitsRequest) (*rpc.GetCommitsResponse, error) {
+	g, err := s.graph(req.Repo)
+	if err != nil {
+		return nil, err
+	}
+	g.mtx.RLock()
+	defer g.mtx.RUnlock()
+
+	// Commits are never removed from a Graph, so the client's copy is
+	// consistent with ours as long as the last commit it has matches.
+	start := int(req.Start)
+	reset := false
+	if start < 0 || start > len(g.commitsData) {
+		reset = true
+	} else if start > 0 && g.commitsData[start-1].Hash != req.PrevHash {
+		reset = true
+	}
+	if reset {
+		start = 0
+	}
+	// Pages are limited by size rather than number of commits, since commit
+	// messages vary widely in length. Every page has at least one commit.
+	rv := &rpc.GetCommitsResponse{
+		Commits: [][]byte{},
+		Reset_:  reset,
+	}
+	size := 0
+	for _, c := range g.commitsData[start:] {
+		if size >= commitsPageSize {
+			rv.More = true
+			break
+		}
+		b, err := json.Marshal(c)
+		if err != nil {
+			return nil, err
+		}
+		rv.Commits = append(rv.Commits, b)
+		size += len(b)
+	}
+	if rv.More {
+		return rv, nil
+	}
+	// The client can only use the branches once it has all of the commits.
+	rv.Branches = make([]*rpc.Branch, 0, len(g.branches))
+	for _, b := range g.branches {
+		rv.Branches = append(rv.Branches, &rpc.Branch{
+			Name: b.Name,
+			Head: b.Head,
+		})
+	}
+	return rv, nil
+}
+
+func (s *rpcServer) HasAncestor(ctx context.Context, req *rpc.HasAncestorRequest) (*rpc.Bool, error) {
+	g, err := s.graph(req.Repo)
+	if err != nil {
+		return nil, err
+	}
+	c := g.Get(req.Commit)
+	if c == nil {
+		return nil, fmt.Errorf("Unknown commit %q in %s", req.Commit, req.Repo)
+	}
+	return &rpc.Bool{
+		Val: c.HasAncestor(req.Ancestor),
+	}, nil
+}
@@ -1,14 +1,20 @@
 package gitiles
 
 import (
+	"bufio"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"go.skia.org/infra/go/httputils"
 	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/go/vcsinfo"
 )
 
 /*
@@ -17,6 +23,18 @@ import (
 
 const (
 	DOWNLOAD_URL = "%s/+/%s/%s?format=TEXT"
+	LOG_URL      = "%s/+log/%s?format=JSON"
+	REFS_URL     = "%s/+refs/heads?format=JSON"
+
+	// DATE_FORMAT is the format of times in Gitiles JSON responses.
+	DATE_FORMAT = "Mon Jan 02 15:04:05 2006 -0700"
+
+	// DATE_FORMAT_NO_TZ is the format of times in Gitiles JSON responses
+	// from servers that leave out the time zone, which is then UTC.
+	DATE_FORMAT_NO_TZ = "Mon Jan 02 15:04:05 2006"
+
+	// XSSI_PREFIX is prepended to all Gitiles JSON responses.
+	XSSI_PREFIX = ")]}'"
 )
 
 // Repo is an object used for interacting with a single Git repo using Gitiles.
@@ -27,7 +45,12 @@ type Repo struct {
 
 // NewRepo creates and returns a new Repo object.
 func NewRepo(url string) *Repo {
-	c := httputils.NewTimeoutClient()
+	return NewRepoWithClient(url, httputils.NewTimeoutClient())
+}
+
+// NewRepoWithClient creates and returns a new Repo object which uses the given
+// http.Client.
+func NewRepoWithClient(url string, c *http.Client) *Repo {
 	return &Repo{
 		client: c,
 		URL:    url,
@@ -70,3 +93,155 @@ func (r *Repo) DownloadFile(srcPath, dstPath string) error {
 	}
 	return nil
 }
+
+// Author is the author or committer of a commit in a Gitiles JSON response.
+type Author struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Time  string `json:"time"`
+}
+
+// Commit is a single commit in a Gitiles JSON response.
+type Commit struct {
+	Commit    string   `json:"commit"`
+	Parents   []string `json:"parents"`
+	Author    *Author  `json:"author"`
+	Committer *Author  `json:"committer"`
+	Message   string   `json:"message"`
+}
+
+// Log is a page of a Gitiles JSON log response. Next is the commit the next
+// page starts at, if there is one.
+type Log struct {
+	Log  []*Commit `json:"log"`
+	Next string    `json:"next"`
+}
+
+// Ref is a single ref in a Gitiles JSON refs response.
+type Ref struct {
+	Value string `json:"value"`
+}
+
+// getJSON decodes the Gitiles JSON response from the given URL into dst.
+func (r *Repo) getJSON(url string, dst interface{}) error {
+	resp, err := r.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer util.Close(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Request got status %q", resp.Status)
+	}
+	// Skip the XSSI protection prefix.
+	body := bufio.NewReader(resp.Body)
+	prefix, err := body.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("Failed to read response: %s", err)
+	}
+	if strings.TrimSpace(prefix) != XSSI_PREFIX {
+		return fmt.Errorf("Response does not start with %q", XSSI_PREFIX)
+	}
+	if err := json.NewDecoder(body).Decode(dst); err != nil {
+		return fmt.Errorf("Failed to decode response: %s", err)
+	}
+	return nil
+}
+
+// Log returns the commits of the given log expression, e.g. "master" or
+// "abc123..master", newest first. At most n commits are returned, or all of
+// them if n is 0. Several requests are made if necessary.
+func (r *Repo) Log(logExpr string, n int) ([]*vcsinfo.LongCommit, error) {
+	ret := []*vcsinfo.LongCommit{}
+	next := ""
+	for {
+		u := fmt.Sprintf(LOG_URL, r.URL, logExpr)
+		if n > 0 {
+			u += fmt.Sprintf("&n=%d", n-len(ret))
+		}
+		if next != "" {
+			u += "&s=" + url.QueryEscape(next)
+		}
+		var log Log
+		if err := r.getJSON(u, &log); err != nil {
+			return nil, fmt.Errorf("Failed to get log of %s: %s", logExpr, err)
+		}
+		for _, c := range log.Log {
+			lc, err := c.LongCommit()
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, lc)
+		}
+		next = log.Next
+		if next == "" || (n > 0 && len(ret) >= n) {
+			return ret, nil
+		}
+	}
+}
+
+// Details returns the given commit.
+func (r *Repo) Details(ref string) (*vcsinfo.LongCommit, error) {
+	commits, err := r.Log(ref, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(commits) != 1 {
+		return nil, fmt.Errorf("Commit %s not found.", ref)
+	}
+	return commits[0], nil
+}
+
+// Branches returns the head of every branch, keyed by branch name.
+func (r *Repo) Branches() (map[string]string, error) {
+	refs := map[string]*Ref{}
+	if err := r.getJSON(fmt.Sprintf(REFS_URL, r.URL), &refs); err != nil {
+		return nil, fmt.Errorf("Failed to get branches: %s", err)
+	}
+	ret := make(map[string]string, len(refs))
+	for name, ref := range refs {
+		ret[strings.TrimPrefix(name, "refs/heads/")] = ref.Value
+	}
+	return ret, nil
+}
+
+// LongCommit converts the commit into a vcsinfo.LongCommit, in the same format
+// that gitinfo uses.
+func (c *Commit) LongCommit() (*vcsinfo.LongCommit, error) {
+	if c.Author == nil || c.Committer == nil {
+		return nil, fmt.Errorf("Commit %s has no author or committer.", c.Commit)
+	}
+	ts, err := ParseTime(c.Committer.Time)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse time of commit %s: %s", c.Commit, err)
+	}
+	lines := strings.SplitN(c.Message, "\n", 2)
+	body := ""
+	if len(lines) == 2 {
+		body = strings.TrimPrefix(lines[1], "\n")
+	}
+	parents := c.Parents
+	if parents == nil {
+		parents = []string{}
+	}
+	return &vcsinfo.LongCommit{
+		ShortCommit: &vcsinfo.ShortCommit{
+			Hash:    c.Commit,
+			Author:  fmt.Sprintf("%s (%s)", c.Author.Name, c.Author.Email),
+			Subject: lines[0],
+		},
+		Parents:   parents,
+		Body:      body,
+		Timestamp: ts,
+	}, nil
+}
+
+// ParseTime parses a time from a Gitiles JSON response.
+func ParseTime(s string) (time.Time, error) {
+	t, err := time.Parse(DATE_FORMAT, s)
+	if err != nil {
+		if t, err = time.Parse(DATE_FORMAT_NO_TZ, s); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return t.UTC(), nil
+}
@@ -0,0 +1,219 @@
+package testutils
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.skia.org/infra/go/gitiles"
+	"go.skia.org/infra/go/sklog"
+)
+
+// MockRepo is a fake Gitiles server backed by an in-memory commit graph. It
+// serves the +log and +refs JSON endpoints used by gitiles.Repo.
+type MockRepo struct {
+	server *httptest.Server
+
+	mtx      sync.Mutex
+	commits  map[string]*gitiles.Commit
+	branches map[string]string
+	requests int
+}
+
+// NewMockRepo starts a new, empty MockRepo. Call Close when done.
+func NewMockRepo() *MockRepo {
+	m := &MockRepo{
+		commits:  map[string]*gitiles.Commit{},
+		branches: map[string]string{},
+	}
+	m.server = httptest.NewServer(http.HandlerFunc(m.handle))
+	return m
+}
+
+// URL returns the URL of the repo, for use with gitiles.NewRepo.
+func (m *MockRepo) URL() string {
+	return m.server.URL
+}
+
+// Close shuts down the server.
+func (m *MockRepo) Close() {
+	m.server.Close()
+}
+
+// Requests returns the number of requests the server has handled.
+func (m *MockRepo) Requests() int {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.requests
+}
+
+// Commit adds a commit to the given branch, creating the branch if necessary,
+// and returns its hash. The current head of the branch and any extra parents
+// become the parents of the commit.
+func (m *MockRepo) Commit(branch, message string, ts time.Time, extraParents ...string) string {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	parents := []string{}
+	if head, ok := m.branches[branch]; ok {
+		parents = append(parents, head)
+	}
+	parents = append(parents, extraParents...)
+	ts = ts.UTC()
+	hash := fmt.Sprintf("%x", sha1.Sum([]byte(fmt.Sprintf("%s\n%s\n%s\n%v", branch, message, ts, parents))))
+	author := &gitiles.Author{
+		Name:  "Test Author",
+		Email: "test@example.com",
+		Time:  ts.Format(gitiles.DATE_FORMAT),
+	}
+	m.commits[hash] = &gitiles.Commit{
+		Commit:    hash,
+		Parents:   parents,
+		Author:    author,
+		Committer: author,
+		Message:   message,
+	}
+	m.branches[branch] = hash
+	return hash
+}
+
+// CreateBranch creates a new branch whose head is the given commit.
+func (m *MockRepo) CreateBranch(branch, hash string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.branches[branch] = hash
+}
+
+// ForcePush moves the given branch to the given commit, and then deletes all
+// commits that are no longer reachable from any branch, as if the repo had
+// been garbage collected.
+func (m *MockRepo) ForcePush(branch, hash string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.branches[branch] = hash
+	keep := map[string]bool{}
+	for _, head := range m.branches {
+		for h := range m.ancestors(head) {
+			keep[h] = true
+		}
+	}
+	for h := range m.commits {
+		if !keep[h] {
+			delete(m.commits, h)
+		}
+	}
+}
+
+// resolve returns the hash that the given branch name or hash refers to.
+func (m *MockRepo) resolve(ref string) (string, bool) {
+	if hash, ok := m.branches[strings.TrimPrefix(ref, "refs/heads/")]; ok {
+		return hash, true
+	}
+	_, ok := m.commits[ref]
+	return ref, ok
+}
+
+// ancestors returns the given commit and all of its ancestors.
+func (m *MockRepo) ancestors(hash string) map[string]bool {
+	ret := map[string]bool{}
+	queue := []string{hash}
+	for len(queue) > 0 {
+		h := queue[0]
+		queue = queue[1:]
+		if ret[h] {
+			continue
+		}
+		ret[h] = true
+		queue = append(queue, m.commits[h].Parents...)
+	}
+	return ret
+}
+
+// log returns the commits of the given log expression, newest first.
+func (m *MockRepo) log(expr string) ([]*gitiles.Commit, error) {
+	from := ""
+	to := expr
+	if split := strings.SplitN(expr, "..", 2); len(split) == 2 {
+		from, to = split[0], split[1]
+	}
+	toHash, ok := m.resolve(to)
+	if !ok {
+		return nil, fmt.Errorf("Unknown ref %q", to)
+	}
+	include := m.ancestors(toHash)
+	if from != "" {
+		fromHash, ok := m.resolve(from)
+		if !ok {
+			return nil, fmt.Errorf("Unknown ref %q", from)
+		}
+		for h := range m.ancestors(fromHash) {
+			delete(include, h)
+		}
+	}
+	ret := make([]*gitiles.Commit, 0, len(include))
+	for h := range include {
+		ret = append(ret, m.commits[h])
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		ti, _ := gitiles.ParseTime(ret[i].Committer.Time)
+		tj, _ := gitiles.ParseTime(ret[j].Committer.Time)
+		if ti.Equal(tj) {
+			return ret[i].Commit < ret[j].Commit
+		}
+		return ti.After(tj)
+	})
+	return ret, nil
+}
+
+func (m *MockRepo) handle(w http.ResponseWriter, r *http.Request) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.requests++
+	if r.URL.Query().Get("format") != "JSON" {
+		http.Error(w, "Only JSON is supported.", http.StatusBadRequest)
+		return
+	}
+	var resp interface{}
+	if r.URL.Path == "/+refs/heads" {
+		refs := map[string]*gitiles.Ref{}
+		for name, hash := range m.branches {
+			refs[name] = &gitiles.Ref{Value: hash}
+		}
+		resp = refs
+	} else if strings.HasPrefix(r.URL.Path, "/+log/") {
+		commits, err := m.log(strings.TrimPrefix(r.URL.Path, "/+log/"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		// Skip to the start commit, if given.
+		if s := r.URL.Query().Get("s"); s != "" {
+			for len(commits) > 0 && commits[0].Commit != s {
+				commits = commits[1:]
+			}
+		}
+		log := &gitiles.Log{Log: commits}
+		if n, err := strconv.Atoi(r.URL.Query().Get("n")); err == nil && n < len(commits) {
+			log.Log = commits[:n]
+			log.Next = commits[n].Commit
+		}
+		resp = log
+	} else {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := fmt.Fprintln(w, gitiles.XSSI_PREFIX); err != nil {
+		sklog.Errorf("Failed to write response: %s", err)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		sklog.Errorf("Failed to write response: %s", err)
+	}
+}
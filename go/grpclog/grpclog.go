@@ -2,7 +2,16 @@ package grpclog
 
 import (
 	"go.skia.org/infra/go/sklog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
 	grl "google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// REQUEST_ID_METADATA is the gRPC metadata key that carries the ID of the
+	// request a call is made for, see sklog.REQUEST_ID.
+	REQUEST_ID_METADATA = "x-request-id"
 )
 
 // logger implements grpclog.Logger using sklog.
@@ -31,3 +40,31 @@ func (g *logger) Println(args ...interface{}) {
 func Init() {
 	grl.SetLogger(&logger{})
 }
+
+// UnaryClientInterceptor passes the ID of the request that ctx carries, if any,
+// on to the server in the gRPC metadata. Use it with grpc.WithUnaryInterceptor.
+func UnaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if id := sklog.RequestID(ctx); id != "" {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		ctx = metadata.NewOutgoingContext(ctx, metadata.Join(md, metadata.Pairs(REQUEST_ID_METADATA, id)))
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// UnaryServerInterceptor adds the request ID that the client passed in the
+// gRPC metadata, if valid, to the sklog.Logger of the call's context, and logs
+// each call with it. Use it with grpc.UnaryInterceptor.
+func UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md[REQUEST_ID_METADATA]; len(ids) > 0 && sklog.ValidRequestID(ids[0]) {
+			ctx = sklog.NewContext(ctx, sklog.FromContext(ctx).WithField(sklog.REQUEST_ID, ids[0]))
+		}
+	}
+	logger := sklog.FromContext(ctx)
+	logger.Debugf("Handling %s", info.FullMethod)
+	resp, err := handler(ctx, req)
+	if err != nil {
+		logger.Errorf("%s failed: %s", info.FullMethod, err)
+	}
+	return resp, err
+}
@@ -0,0 +1,44 @@
+package grpclog
+
+import (
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/testutils"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// call passes ctx through the client and server interceptors, and returns the
+// request ID the server handler sees.
+func call(t *testing.T, ctx context.Context) string {
+	var serverCtx context.Context
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		serverCtx = metadata.NewIncomingContext(context.Background(), md)
+		return nil
+	}
+	assert.NoError(t, UnaryClientInterceptor(ctx, "/test.Service/Method", nil, nil, nil, invoker))
+	id := ""
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		id = sklog.RequestID(ctx)
+		return nil, nil
+	}
+	_, err := UnaryServerInterceptor(serverCtx, nil, &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}, handler)
+	assert.NoError(t, err)
+	return id
+}
+
+func TestRequestIDPropagation(t *testing.T) {
+	testutils.SmallTest(t)
+	assert.Equal(t, "", call(t, context.Background()))
+
+	ctx := sklog.NewContext(context.Background(), sklog.WithFields(sklog.Fields{sklog.REQUEST_ID: "abc-123"}))
+	assert.Equal(t, "abc-123", call(t, ctx))
+
+	// Invalid IDs are ignored by the server.
+	ctx = metadata.NewOutgoingContext(context.Background(), metadata.Pairs(REQUEST_ID_METADATA, "abc def"))
+	assert.Equal(t, "", call(t, ctx))
+}
@@ -12,6 +12,7 @@ import (
 	"reflect"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -32,6 +33,15 @@ const (
 	FAST_DIAL_TIMEOUT    = 50 * time.Millisecond
 	FAST_REQUEST_TIMEOUT = 100 * time.Millisecond
 
+	// REQUEST_ID_HEADER holds the ID of a request. Valid incoming IDs, see
+	// sklog.ValidRequestID, are reused so that a request can be followed
+	// across servers, and the ID is returned in the response.
+	REQUEST_ID_HEADER = "X-Request-Id"
+
+	// CLOUD_TRACE_HEADER is set by the Google Cloud load balancer, and has the
+	// form "TRACE_ID/SPAN_ID;o=TRACE_TRUE".
+	CLOUD_TRACE_HEADER = "X-Cloud-Trace-Context"
+
 	// Exponential backoff defaults.
 	INITIAL_INTERVAL     = 500 * time.Millisecond
 	RANDOMIZATION_FACTOR = 0.5
@@ -222,7 +232,12 @@ func readAndClose(r io.ReadCloser) string {
 // The message parameter is returned in the HTTP response. If it is not provided then
 // "Unknown error" will be returned instead.
 func ReportError(w http.ResponseWriter, r *http.Request, err error, message string) {
-	sklog.Errorln(message, err)
+	// Some callers pass a nil request.
+	l := &sklog.Logger{}
+	if r != nil {
+		l = sklog.FromContext(r.Context())
+	}
+	l.Errorf("%s %v", message, err)
 	if err != io.ErrClosedPipe {
 		httpErrMsg := message
 		if message == "" {
@@ -235,12 +250,13 @@ func ReportError(w http.ResponseWriter, r *http.Request, err error, message stri
 // responseProxy implements http.ResponseWriter and records the status codes.
 type responseProxy struct {
 	http.ResponseWriter
+	logger      *sklog.Logger
 	wroteHeader bool
 }
 
 func (rp *responseProxy) WriteHeader(code int) {
 	if !rp.wroteHeader {
-		sklog.Infof("Response Code: %d", code)
+		rp.logger.Infof("Response Code: %d", code)
 		metrics2.GetCounter("http.response", map[string]string{"statuscode": strconv.Itoa(code)}).Inc(1)
 		rp.ResponseWriter.WriteHeader(code)
 		rp.wroteHeader = true
@@ -254,10 +270,31 @@ func (rp *responseProxy) WriteHeader(code int) {
 // the default of 200 then this will never record anything.
 func recordResponse(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		h.ServeHTTP(&responseProxy{ResponseWriter: w}, r)
+		h.ServeHTTP(&responseProxy{ResponseWriter: w, logger: sklog.FromContext(r.Context())}, r)
 	})
 }
 
+// withRequestID returns a copy of the request whose context carries a
+// sklog.Logger with the request's ID and Cloud Trace ID, if any, and sets the
+// request ID on the response.
+func withRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+	id := r.Header.Get(REQUEST_ID_HEADER)
+	if !sklog.ValidRequestID(id) {
+		var err error
+		id, err = util.GenerateID()
+		if err != nil {
+			sklog.Errorf("Failed to generate request ID: %s", err)
+		}
+	}
+	w.Header().Set(REQUEST_ID_HEADER, id)
+	fields := sklog.Fields{sklog.REQUEST_ID: id}
+	if trace := r.Header.Get(CLOUD_TRACE_HEADER); trace != "" {
+		fields[sklog.TRACE_ID] = strings.SplitN(trace, "/", 2)[0]
+	}
+	l := sklog.FromContext(r.Context()).WithFields(fields)
+	return r.WithContext(sklog.NewContext(r.Context(), l))
+}
+
 // LoggingGzipRequestResponse records parts of the request and the response to
 // the logs and gzips responses when appropriate.
 func LoggingGzipRequestResponse(h http.Handler) http.Handler {
@@ -265,23 +302,31 @@ func LoggingGzipRequestResponse(h http.Handler) http.Handler {
 }
 
 // LoggingRequestResponse records parts of the request and the response to the logs.
+//
+// Each request is given an ID, which is attached to all of the logs for the
+// request along with its Cloud Trace ID. Handlers should log using
+// sklog.FromContext(r.Context()) so that their logs are also correlated.
 func LoggingRequestResponse(h http.Handler) http.Handler {
 	// Closure to capture the request.
 	f := func(w http.ResponseWriter, r *http.Request) {
-		sklog.Infof("Incoming request: %s %s %#v ", r.URL.Path, r.Method, *(r.URL))
+		l := sklog.FromContext(r.Context())
+		l.Infof("Incoming request: %s %s %#v ", r.URL.Path, r.Method, *(r.URL))
 		defer func() {
 			if err := recover(); err != nil {
 				const size = 64 << 10
 				buf := make([]byte, size)
 				buf = buf[:runtime.Stack(buf, false)]
-				sklog.Errorf("panic serving %v: %v\n%s", r.URL.Path, err, buf)
+				l.Errorf("panic serving %v: %v\n%s", r.URL.Path, err, buf)
 			}
 		}()
 		defer timer.New(fmt.Sprintf("Request: %s Latency:", r.URL.Path)).Stop()
 		h.ServeHTTP(w, r)
 	}
 
-	return recordResponse(http.HandlerFunc(f))
+	rec := recordResponse(http.HandlerFunc(f))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec.ServeHTTP(w, withRequestID(w, r))
+	})
 }
 
 // MakeResourceHandler is an HTTP handler function designed for serving files.
@@ -360,9 +405,12 @@ func ParseFormValues(r *http.Request, rv interface{}) error {
 }
 
 // MetricsTransport is an http.RoundTripper which logs each request to metrics.
+// It counts the requests to each host and records the distribution of their
+// latencies, in seconds.
 type MetricsTransport struct {
 	counters    map[string]metrics2.Counter
 	countersMtx sync.Mutex
+	latencies   map[string]metrics2.Float64HistogramMetric
 	rt          http.RoundTripper
 }
 
@@ -380,9 +428,28 @@ func (mt *MetricsTransport) getCounter(host string) metrics2.Counter {
 	return c
 }
 
+// getLatency returns the cached metrics2.Float64HistogramMetric for the given
+// host.
+func (mt *MetricsTransport) getLatency(host string) metrics2.Float64HistogramMetric {
+	mt.countersMtx.Lock()
+	defer mt.countersMtx.Unlock()
+	h, ok := mt.latencies[host]
+	if !ok {
+		h = metrics2.GetFloat64HistogramMetric("http_request_latency_s", metrics2.DEFAULT_BUCKETS, map[string]string{
+			"host": host,
+		})
+		mt.latencies[host] = h
+	}
+	return h
+}
+
 // See docs for http.RoundTripper.
 func (mt *MetricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	mt.getCounter(req.URL.Host).Inc(1)
+	start := time.Now()
+	defer func() {
+		mt.getLatency(req.URL.Host).Observe(time.Since(start).Seconds())
+	}()
 	return mt.rt.RoundTrip(req)
 }
 
@@ -400,8 +467,9 @@ func NewMetricsTransport(rt http.RoundTripper) http.RoundTripper {
 		}
 	}
 	return &MetricsTransport{
-		counters: map[string]metrics2.Counter{},
-		rt:       rt,
+		counters:  map[string]metrics2.Counter{},
+		latencies: map[string]metrics2.Float64HistogramMetric{},
+		rt:        rt,
 	}
 }
 
@@ -237,8 +237,14 @@ func getSession(r *http.Request) (*Session, error) {
 }
 
 // LoggedInAs returns the user's ID, i.e. their email address, if they are
-// logged in, and "" if they are not logged in.
+// logged in, and "" if they are not logged in. Requests which carry an API
+// token are logged in as the owner of the token if the token's scopes allow
+// the request; see tokens.go.
 func LoggedInAs(r *http.Request) string {
+	if isTokenRequest(r) {
+		email, _ := tokenEmail(r)
+		return email
+	}
 	s, err := getSession(r)
 	if err != nil {
 		return ""
@@ -275,9 +281,21 @@ func IsGoogler(r *http.Request) bool {
 }
 
 // IsAdmin determines whether the user is logged in with an account on the admin
-// whitelist. If true, user is allowed to perform admin tasks.
+// whitelist. If true, user is allowed to perform admin tasks. Requests which
+// carry an API token additionally need the token to have SCOPE_ADMIN.
 func IsAdmin(r *http.Request) bool {
-	return activeAdminEmailWhiteList[LoggedInAs(r)]
+	if isTokenRequest(r) {
+		email, t := tokenEmail(r)
+		return t != nil && t.HasScope(SCOPE_ADMIN) && isAdminEmail(email)
+	}
+	return isAdminEmail(LoggedInAs(r))
+}
+
+// isAdminEmail returns true iff the given email address is on the admin
+// whitelist. Email addresses are compared case-insensitively; the whitelist
+// is lowercased by splitAuthWhiteList.
+func isAdminEmail(email string) bool {
+	return activeAdminEmailWhiteList[strings.ToLower(email)]
 }
 
 // A JSON Web Token can contain much info, such as 'iss' and 'sub'. We don't care about
@@ -502,6 +520,7 @@ func GetHttpClient(r *http.Request) *http.Client {
 // URL path that the user is redirected to at the end of the auth flow.
 func ForceAuth(h http.Handler, oauthCallbackPath string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = withToken(r)
 		userId := LoggedInAs(r)
 		if userId == "" {
 			// If this is not the oauth callback then redirect.
@@ -520,6 +539,8 @@ func ForceAuth(h http.Handler, oauthCallbackPath string) http.Handler {
 	})
 }
 
+// splitAuthWhiteList splits the given whitespace-separated whitelist into
+// domains and email addresses, both lowercased.
 func splitAuthWhiteList(whiteList string) (map[string]bool, map[string]bool) {
 	domains := map[string]bool{}
 	emails := map[string]bool{}
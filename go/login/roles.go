@@ -0,0 +1,294 @@
+package login
+
+// Roles.
+//
+// Beyond being logged in, users may be granted roles which determine what they
+// are allowed to do within an app. Roles are ordered, and each role includes
+// all of the roles before it:
+//
+//   viewer  - May view pages which require login.
+//   triager - May triage, e.g. images in Gold or regressions in Perf.
+//   editor  - May change the configuration of the app, e.g. alerts in Perf or
+//             the blacklist in the Task Scheduler.
+//   admin   - May perform admin tasks. Users on the admin whitelist are always
+//             admins.
+//
+// Each app assigns roles in a JSON config file which looks like:
+//
+//   {
+//     "groups": {
+//       "contractors": ["alice@example.com", "bob@example.com"]
+//     },
+//     "roles": {
+//       "viewer":  ["*"],
+//       "triager": ["group:contractors"],
+//       "editor":  ["google.com", "carol@chromium.org"],
+//       "admin":   []
+//     }
+//   }
+//
+// Each entry in a role or group is either an email address, a domain, "*" for
+// all logged in users, or (in roles only) "group:<name>". Users must still be
+// on the auth whitelist in order to log in at all.
+//
+// API tokens only carry as much of the owner's role as their scopes allow; see
+// tokens.go.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"go.skia.org/infra/go/sklog"
+)
+
+// Role is the level of access a user has within an app.
+type Role int
+
+const (
+	ROLE_NONE Role = iota
+	ROLE_VIEWER
+	ROLE_TRIAGER
+	ROLE_EDITOR
+	ROLE_ADMIN
+)
+
+const (
+	// GROUP_PREFIX is the prefix of role config entries which refer to a
+	// group.
+	GROUP_PREFIX = "group:"
+
+	// ALL_USERS is the role config entry which matches all logged in users.
+	ALL_USERS = "*"
+)
+
+var (
+	roleNames = map[Role]string{
+		ROLE_NONE:    "none",
+		ROLE_VIEWER:  "viewer",
+		ROLE_TRIAGER: "triager",
+		ROLE_EDITOR:  "editor",
+		ROLE_ADMIN:   "admin",
+	}
+
+	// DEFAULT_ROLES gives every logged in user the editor role, which
+	// matches the behavior of apps which only check LoggedInAs.
+	DEFAULT_ROLES = &RoleConfig{
+		Roles: map[string][]string{
+			"editor": []string{ALL_USERS},
+		},
+	}
+
+	// GOOGLER_ROLES gives every logged in user the viewer role, and users
+	// with an @google.com account the editor role, which matches the
+	// behavior of apps which check IsGoogler.
+	GOOGLER_ROLES = &RoleConfig{
+		Roles: map[string][]string{
+			"viewer": []string{ALL_USERS},
+			"editor": []string{"google.com"},
+		},
+	}
+
+	// activeRoles holds the roles assigned by the config passed to
+	// InitRoles.
+	activeRoles = mustCompileRoles(DEFAULT_ROLES)
+)
+
+// String returns the name of the role as used in role configs.
+func (r Role) String() string {
+	if s, ok := roleNames[r]; ok {
+		return s
+	}
+	return fmt.Sprintf("Role(%d)", int(r))
+}
+
+// ParseRole returns the Role with the given name.
+func ParseRole(s string) (Role, error) {
+	for r, name := range roleNames {
+		if name == s && r != ROLE_NONE {
+			return r, nil
+		}
+	}
+	return ROLE_NONE, fmt.Errorf("Unknown role %q", s)
+}
+
+// RoleConfig assigns roles to users and groups. See the top of this file for
+// the JSON format.
+type RoleConfig struct {
+	// Groups maps group names to their members.
+	Groups map[string][]string `json:"groups"`
+
+	// Roles maps role names to the users, domains and groups which have the
+	// role.
+	Roles map[string][]string `json:"roles"`
+}
+
+// roleMembers is the expanded set of users which have a given role.
+type roleMembers struct {
+	all     bool
+	domains map[string]bool
+	emails  map[string]bool
+}
+
+// matches returns true iff the given email address is a member. The email
+// address must be lowercase.
+func (m *roleMembers) matches(email string) bool {
+	if m.all || m.emails[email] {
+		return true
+	}
+	parts := strings.Split(email, "@")
+	return len(parts) == 2 && m.domains[parts[1]]
+}
+
+// add adds the given email address, domain or ALL_USERS to the members.
+func (m *roleMembers) add(entry string) {
+	entry = strings.ToLower(strings.TrimSpace(entry))
+	if entry == ALL_USERS {
+		m.all = true
+	} else if strings.Contains(entry, "@") {
+		m.emails[entry] = true
+	} else {
+		m.domains[entry] = true
+	}
+}
+
+// compileRoles validates the RoleConfig and expands its groups. The returned
+// map contains an entry for every role other than ROLE_NONE.
+func compileRoles(cfg *RoleConfig) (map[Role]*roleMembers, error) {
+	rv := map[Role]*roleMembers{}
+	for r := range roleNames {
+		if r != ROLE_NONE {
+			rv[r] = &roleMembers{
+				domains: map[string]bool{},
+				emails:  map[string]bool{},
+			}
+		}
+	}
+	for name, entries := range cfg.Roles {
+		role, err := ParseRole(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if strings.HasPrefix(e, GROUP_PREFIX) {
+				members, ok := cfg.Groups[strings.TrimPrefix(e, GROUP_PREFIX)]
+				if !ok {
+					return nil, fmt.Errorf("Role %s refers to unknown group %q", name, e)
+				}
+				for _, m := range members {
+					if strings.HasPrefix(m, GROUP_PREFIX) {
+						return nil, fmt.Errorf("Groups may not contain other groups; found %q", m)
+					}
+					rv[role].add(m)
+				}
+			} else {
+				rv[role].add(e)
+			}
+		}
+	}
+	return rv, nil
+}
+
+// mustCompileRoles is compileRoles for RoleConfigs which are known to be
+// valid.
+func mustCompileRoles(cfg *RoleConfig) map[Role]*roleMembers {
+	rv, err := compileRoles(cfg)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	return rv
+}
+
+// InitRoles sets the roles of users from the given JSON config file. If
+// configFile is blank then the given default RoleConfig is used instead, e.g.
+// DEFAULT_ROLES or GOOGLER_ROLES.
+func InitRoles(configFile string, defaults *RoleConfig) error {
+	cfg := defaults
+	if configFile != "" {
+		b, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			return fmt.Errorf("Failed to read role config: %s", err)
+		}
+		cfg = &RoleConfig{}
+		if err := json.Unmarshal(b, cfg); err != nil {
+			return fmt.Errorf("Failed to parse role config: %s", err)
+		}
+	}
+	roles, err := compileRoles(cfg)
+	if err != nil {
+		return fmt.Errorf("Invalid role config: %s", err)
+	}
+	activeRoles = roles
+	return nil
+}
+
+// roleOfEmail returns the highest role assigned to the given user. Email
+// addresses are compared case-insensitively.
+func roleOfEmail(email string) Role {
+	if email == "" {
+		return ROLE_NONE
+	}
+	if isAdminEmail(email) {
+		return ROLE_ADMIN
+	}
+	email = strings.ToLower(email)
+	for r := ROLE_ADMIN; r > ROLE_NONE; r-- {
+		if activeRoles[r].matches(email) {
+			return r
+		}
+	}
+	return ROLE_NONE
+}
+
+// maxTokenRole returns the highest role which may be exercised using the
+// given API token.
+func maxTokenRole(t *Token) Role {
+	if t.HasScope(SCOPE_ADMIN) {
+		return ROLE_ADMIN
+	}
+	if t.HasScope(SCOPE_TRIAGE) {
+		// SCOPE_TRIAGE only allows triaging, not changing the
+		// configuration of the app.
+		return ROLE_TRIAGER
+	}
+	return ROLE_VIEWER
+}
+
+// RoleOf returns the role of the logged in user, or ROLE_NONE if they are not
+// logged in.
+func RoleOf(r *http.Request) Role {
+	if isTokenRequest(r) {
+		email, t := tokenEmail(r)
+		if t == nil {
+			return ROLE_NONE
+		}
+		role := roleOfEmail(email)
+		if max := maxTokenRole(t); role > max {
+			role = max
+		}
+		return role
+	}
+	return roleOfEmail(LoggedInAs(r))
+}
+
+// HasRole returns true iff the logged in user has the given role, or a role
+// which includes it.
+func HasRole(r *http.Request, role Role) bool {
+	return RoleOf(r) >= role
+}
+
+// RequireRole is middleware which only calls the wrapped handler if the logged
+// in user has the given role. Other requests get a 403 response.
+func RequireRole(role Role, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r = withToken(r)
+		if has := RoleOf(r); has < role {
+			sklog.Warningf("Denied %s %s to %q with role %s; requires %s.", r.Method, r.URL.Path, LoggedInAs(r), has, role)
+			http.Error(w, fmt.Sprintf("You must be logged in with the %s role to do that.", role), http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
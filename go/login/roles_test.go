@@ -0,0 +1,198 @@
+package login
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils"
+)
+
+const TEST_ROLES = `{
+  "groups": {
+    "contractors": ["alice@example.com", "Bob@example.com"]
+  },
+  "roles": {
+    "viewer":  ["*"],
+    "triager": ["group:contractors"],
+    "editor":  ["google.com", "carol@skia.org"],
+    "admin":   ["dave@skia.org"]
+  }
+}`
+
+// sessionRequest returns a request made by the given user, logged in via the
+// OAuth 2.0 flow.
+func sessionRequest(t *testing.T, email string) *http.Request {
+	r, err := http.NewRequest("POST", "http://www.skia.org/", nil)
+	assert.NoError(t, err)
+	c, err := CookieFor(&Session{
+		Email:     email,
+		AuthScope: DEFAULT_SCOPE[0],
+	}, r)
+	assert.NoError(t, err)
+	r.AddCookie(c)
+	return r
+}
+
+func TestRoles(t *testing.T) {
+	testutils.MediumTest(t)
+	once.Do(loginInit)
+	activeUserEmailWhiteList["alice@example.com"] = true
+	activeUserEmailWhiteList["bob@example.com"] = true
+	activeAdminEmailWhiteList["admin@google.com"] = true
+	defer func() {
+		delete(activeUserEmailWhiteList, "alice@example.com")
+		delete(activeUserEmailWhiteList, "bob@example.com")
+		delete(activeAdminEmailWhiteList, "admin@google.com")
+		assert.NoError(t, InitRoles("", DEFAULT_ROLES))
+	}()
+
+	tmp, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer testutils.RemoveAll(t, tmp)
+	cfgFile := path.Join(tmp, "roles.json")
+	assert.NoError(t, ioutil.WriteFile(cfgFile, []byte(TEST_ROLES), 0644))
+	assert.NoError(t, InitRoles(cfgFile, DEFAULT_ROLES))
+
+	test := func(email string, expect Role) {
+		assert.Equal(t, expect, RoleOf(sessionRequest(t, email)), email)
+	}
+	test("alice@example.com", ROLE_TRIAGER)
+	test("bob@example.com", ROLE_TRIAGER)
+	test("carol@skia.org", ROLE_EDITOR)
+	test("fred@google.com", ROLE_EDITOR)
+	test("dave@skia.org", ROLE_ADMIN)
+	test("admin@google.com", ROLE_ADMIN)
+	test("erin@skia.org", ROLE_VIEWER)
+	// Email addresses are case-insensitive.
+	test("Carol@skia.org", ROLE_EDITOR)
+	test("FRED@google.com", ROLE_EDITOR)
+	test("Dave@skia.org", ROLE_ADMIN)
+	test("Admin@google.com", ROLE_ADMIN)
+	// Not on the auth whitelist.
+	test("mallory@example.com", ROLE_NONE)
+	r, err := http.NewRequest("GET", "http://www.skia.org/", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, ROLE_NONE, RoleOf(r))
+
+	// Defaults.
+	assert.NoError(t, InitRoles("", GOOGLER_ROLES))
+	test("alice@example.com", ROLE_VIEWER)
+	test("fred@google.com", ROLE_EDITOR)
+	assert.NoError(t, InitRoles("", DEFAULT_ROLES))
+	test("alice@example.com", ROLE_EDITOR)
+	test("admin@google.com", ROLE_ADMIN)
+
+	// Invalid configs.
+	assert.Error(t, InitRoles("", &RoleConfig{Roles: map[string][]string{"owner": {"*"}}}))
+	assert.Error(t, InitRoles("", &RoleConfig{Roles: map[string][]string{"editor": {"group:missing"}}}))
+	assert.Error(t, InitRoles(path.Join(tmp, "missing.json"), DEFAULT_ROLES))
+}
+
+// Admins on a mixed-case whitelist keep the admin role.
+func TestRolesMixedCaseAdmin(t *testing.T) {
+	testutils.MediumTest(t)
+	once.Do(loginInit)
+	oldAdmins := activeAdminEmailWhiteList
+	defer func() {
+		activeAdminEmailWhiteList = oldAdmins
+	}()
+	_, activeAdminEmailWhiteList = splitAuthWhiteList("Root@Google.com")
+
+	for _, email := range []string{"root@google.com", "Root@google.com", "ROOT@google.com"} {
+		assert.Equal(t, ROLE_ADMIN, RoleOf(sessionRequest(t, email)), email)
+		assert.True(t, IsAdmin(sessionRequest(t, email)), email)
+	}
+	assert.NotEqual(t, ROLE_ADMIN, RoleOf(sessionRequest(t, "fred@google.com")))
+	assert.False(t, IsAdmin(sessionRequest(t, "fred@google.com")))
+}
+
+func TestRoleTokens(t *testing.T) {
+	testutils.MediumTest(t)
+	defer setupTokens(t)()
+	assert.NoError(t, InitRoles("", &RoleConfig{
+		Roles: map[string][]string{
+			"admin": {"fred@google.com"},
+		},
+	}))
+	defer func() {
+		assert.NoError(t, InitRoles("", DEFAULT_ROLES))
+	}()
+
+	test := func(scopes []string, method string, expect Role) {
+		_, secret, err := CreateToken("fred@google.com", "test", scopes, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, expect, RoleOf(tokenRequest(t, method, secret)))
+	}
+	test([]string{SCOPE_READ}, "GET", ROLE_VIEWER)
+	test([]string{SCOPE_READ}, "POST", ROLE_NONE)
+	test([]string{SCOPE_TRIAGE}, "POST", ROLE_TRIAGER)
+	test([]string{SCOPE_ADMIN}, "POST", ROLE_ADMIN)
+}
+
+func TestRequireRole(t *testing.T) {
+	testutils.MediumTest(t)
+	once.Do(loginInit)
+	assert.NoError(t, InitRoles("", GOOGLER_ROLES))
+	defer func() {
+		assert.NoError(t, InitRoles("", DEFAULT_ROLES))
+	}()
+
+	called := false
+	h := RequireRole(ROLE_EDITOR, func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	w := httptest.NewRecorder()
+	h(w, sessionRequest(t, "fred@skia.org"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.False(t, called)
+
+	w = httptest.NewRecorder()
+	h(w, sessionRequest(t, "fred@google.com"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, called)
+}
+
+// A token with SCOPE_TRIAGE may triage but not edit, even if its owner is an
+// editor.
+func TestRequireRoleTriageToken(t *testing.T) {
+	testutils.MediumTest(t)
+	defer setupTokens(t)()
+	assert.NoError(t, InitRoles("", GOOGLER_ROLES))
+	defer func() {
+		assert.NoError(t, InitRoles("", DEFAULT_ROLES))
+	}()
+
+	_, secret, err := CreateToken("fred@google.com", "triage", []string{SCOPE_READ, SCOPE_TRIAGE}, 0)
+	assert.NoError(t, err)
+	test := func(role Role, expect int) {
+		called := false
+		h := RequireRole(role, func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		})
+		w := httptest.NewRecorder()
+		h(w, tokenRequest(t, "POST", secret))
+		assert.Equal(t, expect, w.Code)
+		assert.Equal(t, expect == http.StatusOK, called)
+	}
+	test(ROLE_TRIAGER, http.StatusOK)
+	test(ROLE_EDITOR, http.StatusForbidden)
+}
+
+func TestParseRole(t *testing.T) {
+	testutils.SmallTest(t)
+	for _, r := range []Role{ROLE_VIEWER, ROLE_TRIAGER, ROLE_EDITOR, ROLE_ADMIN} {
+		parsed, err := ParseRole(r.String())
+		assert.NoError(t, err)
+		assert.Equal(t, r, parsed)
+	}
+	_, err := ParseRole("none")
+	assert.Error(t, err)
+	_, err = ParseRole("owner")
+	assert.Error(t, err)
+	assert.True(t, ROLE_ADMIN > ROLE_EDITOR && ROLE_EDITOR > ROLE_TRIAGER && ROLE_TRIAGER > ROLE_VIEWER)
+}
@@ -0,0 +1,558 @@
+package login
+
+// API tokens.
+//
+// Scripts can't go through the OAuth 2.0 flow, so a logged in user can create
+// API tokens which are then sent in the Authorization header of a request:
+//
+//   Authorization: Bearer <token id>.<secret>
+//
+// Only the SHA-256 hash of the secret is stored, so the full token is only
+// available to the user when it is created. Every token has a set of scopes
+// which limit what it can be used for, and an expiration time. Tokens can be
+// revoked by their owner at any time. Every use of a token is logged.
+//
+// Apps which accept API tokens should wrap their handlers with TokenAuth, so
+// that the token is only looked up once per request.
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"go.skia.org/infra/go/httputils"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+)
+
+const (
+	// SCOPE_READ allows a token to be used for requests which don't change
+	// any state, i.e. GET and HEAD requests.
+	SCOPE_READ = "read"
+
+	// SCOPE_TRIAGE allows a token to be used for requests which change
+	// state, e.g. triaging images or adding comments. Tokens with this scope
+	// have at most the triager role, so they may not change the
+	// configuration of an app; see roles.go.
+	SCOPE_TRIAGE = "triage"
+
+	// SCOPE_ADMIN allows a token to be used for admin tasks. The owner of
+	// the token must also be on the admin whitelist.
+	SCOPE_ADMIN = "admin"
+
+	// DEFAULT_TOKEN_LIFETIME is the lifetime of a token if none is given
+	// when it is created.
+	DEFAULT_TOKEN_LIFETIME = 30 * 24 * time.Hour
+
+	// MAX_TOKEN_LIFETIME is the longest allowed lifetime of a token.
+	MAX_TOKEN_LIFETIME = 365 * 24 * time.Hour
+
+	// AUTHORIZATION_PREFIX is the prefix of the Authorization header value
+	// which carries an API token.
+	AUTHORIZATION_PREFIX = "Bearer "
+
+	// Name of the bucket in which tokens are stored.
+	BUCKET_TOKENS = "tokens"
+
+	// How often the LastUsed time of a token is written back to the
+	// TokenDB.
+	LAST_USED_GRANULARITY = time.Minute
+)
+
+var (
+	// VALID_SCOPES is the set of scopes a token may have.
+	VALID_SCOPES = []string{SCOPE_READ, SCOPE_TRIAGE, SCOPE_ADMIN}
+
+	// activeTokenDB is the TokenDB used to look up tokens. API tokens are
+	// not accepted if it is nil.
+	activeTokenDB    TokenDB = nil
+	activeTokenDBMtx sync.RWMutex
+)
+
+// Token is an API token which allows a script to act on behalf of a user.
+type Token struct {
+	// ID identifies the token. It is not secret.
+	ID string
+	// Email is the email address of the owner of the token.
+	Email string
+	// Name is a description of the token, supplied by the owner.
+	Name string
+	// Scopes is the list of scopes granted to the token.
+	Scopes []string
+	// Hash is the hex-encoded SHA-256 hash of the token secret.
+	Hash     string `json:",omitempty"`
+	Created  time.Time
+	Expires  time.Time
+	LastUsed time.Time
+	Revoked  bool
+}
+
+// HasScope returns true iff the token was granted the given scope.
+func (t *Token) HasScope(scope string) bool {
+	return util.In(scope, t.Scopes)
+}
+
+// Valid returns true iff the token has not expired or been revoked.
+func (t *Token) Valid(now time.Time) bool {
+	return !t.Revoked && now.Before(t.Expires)
+}
+
+// allows returns true iff the token may be used for the given request method.
+func (t *Token) allows(method string) bool {
+	if t.HasScope(SCOPE_TRIAGE) || t.HasScope(SCOPE_ADMIN) {
+		return true
+	}
+	return t.HasScope(SCOPE_READ) && (method == "GET" || method == "HEAD")
+}
+
+// copyWithoutHash returns a copy of the token which is safe to send to the
+// user.
+func (t *Token) copyWithoutHash() *Token {
+	rv := *t
+	rv.Hash = ""
+	rv.Scopes = append([]string{}, t.Scopes...)
+	return &rv
+}
+
+// TokenDB is an interface used for storing API tokens.
+type TokenDB interface {
+	// Get returns the token with the given ID, or nil if there is no such
+	// token.
+	Get(id string) (*Token, error)
+
+	// List returns all tokens owned by the given user.
+	List(email string) ([]*Token, error)
+
+	// Put inserts or updates the given token.
+	Put(t *Token) error
+
+	// Update atomically reads the token with the given ID, passes it to fn
+	// and, if fn returns no error, writes it back. Returns the updated token,
+	// or nil if there is no such token, in which case fn is not called.
+	Update(id string, fn func(*Token) error) (*Token, error)
+
+	// Close cleans up the TokenDB.
+	Close() error
+}
+
+// tokenDB is a TokenDB backed by a BoltDB.
+type tokenDB struct {
+	db *bolt.DB
+}
+
+// NewTokenDB returns a TokenDB which stores tokens in the given BoltDB file.
+func NewTokenDB(filename string) (TokenDB, error) {
+	db, err := bolt.Open(filename, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(BUCKET_TOKENS))
+		return err
+	}); err != nil {
+		util.Close(db)
+		return nil, err
+	}
+	return &tokenDB{
+		db: db,
+	}, nil
+}
+
+// See documentation for TokenDB.
+func (d *tokenDB) Get(id string) (*Token, error) {
+	var rv *Token
+	if err := d.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(BUCKET_TOKENS)).Get([]byte(id))
+		if v == nil {
+			return nil
+		}
+		rv = new(Token)
+		return json.Unmarshal(v, rv)
+	}); err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// See documentation for TokenDB.
+func (d *tokenDB) List(email string) ([]*Token, error) {
+	rv := []*Token{}
+	if err := d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(BUCKET_TOKENS)).ForEach(func(k, v []byte) error {
+			t := new(Token)
+			if err := json.Unmarshal(v, t); err != nil {
+				return err
+			}
+			if t.Email == email {
+				rv = append(rv, t)
+			}
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	sort.Sort(tokenSlice(rv))
+	return rv, nil
+}
+
+// See documentation for TokenDB.
+func (d *tokenDB) Put(t *Token) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(BUCKET_TOKENS)).Put([]byte(t.ID), b)
+	})
+}
+
+// See documentation for TokenDB.
+func (d *tokenDB) Update(id string, fn func(*Token) error) (*Token, error) {
+	var rv *Token
+	if err := d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BUCKET_TOKENS))
+		v := b.Get([]byte(id))
+		if v == nil {
+			return nil
+		}
+		t := new(Token)
+		if err := json.Unmarshal(v, t); err != nil {
+			return err
+		}
+		if err := fn(t); err != nil {
+			return err
+		}
+		enc, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(id), enc); err != nil {
+			return err
+		}
+		rv = t
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// See documentation for TokenDB.
+func (d *tokenDB) Close() error {
+	return d.db.Close()
+}
+
+// tokenSlice sorts tokens by creation time, newest first.
+type tokenSlice []*Token
+
+func (s tokenSlice) Len() int           { return len(s) }
+func (s tokenSlice) Less(a, b int) bool { return s[a].Created.After(s[b].Created) }
+func (s tokenSlice) Swap(a, b int)      { s[a], s[b] = s[b], s[a] }
+
+// InitTokens enables API tokens, which are stored in the given TokenDB. Until
+// InitTokens is called, requests carrying an API token are treated as not
+// logged in.
+func InitTokens(db TokenDB) {
+	activeTokenDBMtx.Lock()
+	defer activeTokenDBMtx.Unlock()
+	activeTokenDB = db
+}
+
+// getTokenDB returns the active TokenDB, or nil if API tokens are not enabled.
+func getTokenDB() TokenDB {
+	activeTokenDBMtx.RLock()
+	defer activeTokenDBMtx.RUnlock()
+	return activeTokenDB
+}
+
+// hashSecret returns the hex-encoded SHA-256 hash of the given token secret.
+func hashSecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+// CreateToken creates a new API token owned by the given user and inserts it
+// into the TokenDB. Returns the Token and the value which must be sent in the
+// Authorization header to use it; the latter can't be retrieved later.
+func CreateToken(email, name string, scopes []string, lifetime time.Duration) (*Token, string, error) {
+	db := getTokenDB()
+	if db == nil {
+		return nil, "", fmt.Errorf("API tokens are not enabled.")
+	}
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("At least one scope is required.")
+	}
+	for _, s := range scopes {
+		if !util.In(s, VALID_SCOPES) {
+			return nil, "", fmt.Errorf("Unknown scope %q", s)
+		}
+	}
+	if lifetime == 0 {
+		lifetime = DEFAULT_TOKEN_LIFETIME
+	}
+	if lifetime < 0 || lifetime > MAX_TOKEN_LIFETIME {
+		return nil, "", fmt.Errorf("Token lifetime must be positive and no more than %s.", MAX_TOKEN_LIFETIME)
+	}
+	id, err := util.GenerateID()
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to generate token ID: %s", err)
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", fmt.Errorf("Failed to generate token secret: %s", err)
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now().UTC()
+	t := &Token{
+		ID:      id,
+		Email:   email,
+		Name:    name,
+		Scopes:  scopes,
+		Hash:    hashSecret(secret),
+		Created: now,
+		Expires: now.Add(lifetime),
+	}
+	if err := db.Put(t); err != nil {
+		return nil, "", fmt.Errorf("Failed to store token: %s", err)
+	}
+	sklog.Infof("API token %s (%q) with scopes %v created by %s, expires %s", t.ID, t.Name, t.Scopes, email, t.Expires)
+	return t.copyWithoutHash(), id + "." + secret, nil
+}
+
+// RevokeToken revokes the API token with the given ID, which must be owned by
+// the given user.
+func RevokeToken(email, id string) error {
+	db := getTokenDB()
+	if db == nil {
+		return fmt.Errorf("API tokens are not enabled.")
+	}
+	notFound := fmt.Errorf("No such token %q", id)
+	t, err := db.Update(id, func(t *Token) error {
+		if t.Email != email {
+			return notFound
+		}
+		t.Revoked = true
+		return nil
+	})
+	if err == notFound || (err == nil && t == nil) {
+		return notFound
+	} else if err != nil {
+		return fmt.Errorf("Failed to revoke token: %s", err)
+	}
+	sklog.Infof("API token %s (%q) revoked by %s", t.ID, t.Name, email)
+	return nil
+}
+
+// isTokenRequest returns true iff the request carries an API token.
+func isTokenRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Authorization"), AUTHORIZATION_PREFIX)
+}
+
+// getToken returns the valid API token sent with the request, or nil if the
+// request has no Authorization header. Every use of a token is logged.
+func getToken(r *http.Request) (*Token, error) {
+	if !isTokenRequest(r) {
+		return nil, nil
+	}
+	auth := r.Header.Get("Authorization")
+	db := getTokenDB()
+	if db == nil {
+		return nil, fmt.Errorf("API tokens are not enabled.")
+	}
+	parts := strings.SplitN(strings.TrimPrefix(auth, AUTHORIZATION_PREFIX), ".", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Malformed API token.")
+	}
+	t, err := db.Get(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve token: %s", err)
+	}
+	if t == nil || subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hashSecret(parts[1]))) != 1 {
+		sklog.Warningf("API token: rejected unknown token %q for %s %s from %s", parts[0], r.Method, r.URL.Path, r.RemoteAddr)
+		return nil, fmt.Errorf("Unknown API token.")
+	}
+	now := time.Now().UTC()
+	if !t.Valid(now) {
+		sklog.Warningf("API token: rejected expired or revoked token %s of %s for %s %s from %s", t.ID, t.Email, r.Method, r.URL.Path, r.RemoteAddr)
+		return nil, fmt.Errorf("API token is expired or revoked.")
+	}
+	sklog.Infof("API token: token %s (%q) of %s used for %s %s from %s", t.ID, t.Name, t.Email, r.Method, r.URL.Path, r.RemoteAddr)
+	if now.Sub(t.LastUsed) > LAST_USED_GRANULARITY {
+		// Update only the last use, so that e.g. a concurrent revocation
+		// isn't overwritten.
+		if _, err := db.Update(t.ID, func(t *Token) error {
+			t.LastUsed = now
+			return nil
+		}); err != nil {
+			sklog.Errorf("Failed to update last use of API token %s: %s", t.ID, err)
+		}
+		t.LastUsed = now
+	}
+	return t, nil
+}
+
+// tokenResult is the outcome of looking up the API token of a request.
+type tokenResult struct {
+	email string
+	token *Token
+}
+
+// contextKey is the type of the keys of values which this package stores in
+// request contexts.
+type contextKey int
+
+// tokenResultKey is the context key of the request's *tokenResult.
+const tokenResultKey contextKey = 0
+
+// withToken returns the request with the outcome of looking up its API token
+// stored in its context, so that the token is only looked up, and its use only
+// logged, once per request. Requests without a token, or whose token was
+// already looked up, are returned unchanged.
+func withToken(r *http.Request) *http.Request {
+	if !isTokenRequest(r) {
+		return r
+	}
+	if _, ok := r.Context().Value(tokenResultKey).(*tokenResult); ok {
+		return r
+	}
+	email, t := lookupTokenEmail(r)
+	return r.WithContext(context.WithValue(r.Context(), tokenResultKey, &tokenResult{
+		email: email,
+		token: t,
+	}))
+}
+
+// TokenAuth is middleware which looks up the API token sent with a request
+// once, before the wrapped handler is called. LoggedInAs, RoleOf etc. use the
+// result rather than looking the token up again. RequireRole and ForceAuth do
+// this themselves.
+func TokenAuth(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, withToken(r))
+	})
+}
+
+// tokenEmail returns the email address of the owner of the API token sent
+// with the request, if the token is valid, allowed to make the request, and
+// the owner is whitelisted. Otherwise returns "". If the request went through
+// withToken, the stored result is returned; otherwise the token is looked up.
+func tokenEmail(r *http.Request) (string, *Token) {
+	if res, ok := r.Context().Value(tokenResultKey).(*tokenResult); ok {
+		return res.email, res.token
+	}
+	return lookupTokenEmail(r)
+}
+
+// lookupTokenEmail looks up the API token sent with the request; see
+// tokenEmail.
+func lookupTokenEmail(r *http.Request) (string, *Token) {
+	t, err := getToken(r)
+	if err != nil {
+		sklog.Warningf("API token: %s", err)
+		return "", nil
+	}
+	if t == nil || !inWhitelist(t.Email) {
+		return "", nil
+	}
+	if !t.allows(r.Method) {
+		sklog.Warningf("API token: token %s of %s does not allow %s %s", t.ID, t.Email, r.Method, r.URL.Path)
+		return "", nil
+	}
+	return t.Email, t
+}
+
+// TokensHandler lets the logged in user manage their API tokens. Only users
+// logged in via the OAuth 2.0 flow can manage tokens, i.e. API tokens can't be
+// used to create more API tokens.
+//
+//   GET    - Returns the list of the user's tokens as JSON.
+//   POST   - Creates a token. The request body looks like:
+//
+//            {
+//              "Name":   "my script",
+//              "Scopes": ["read", "triage"],
+//              "Days":   30
+//            }
+//
+//            The response contains the new Token and its Secret, which is the
+//            value to send in the Authorization header after "Bearer ".
+//   DELETE - Revokes the token given by the "id" query parameter.
+func TokensHandler(w http.ResponseWriter, r *http.Request) {
+	s, err := getSession(r)
+	if err != nil || !inWhitelist(s.Email) {
+		http.Error(w, "You must be logged in to manage API tokens.", http.StatusForbidden)
+		return
+	}
+	email := s.Email
+	db := getTokenDB()
+	if db == nil {
+		http.Error(w, "API tokens are not enabled.", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case "GET":
+		// Fall through to listing the tokens below.
+	case "POST":
+		var req struct {
+			Name   string
+			Scopes []string
+			Days   int
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httputils.ReportError(w, r, err, "Failed to decode request.")
+			return
+		}
+		if util.In(SCOPE_ADMIN, req.Scopes) && !isAdminEmail(email) {
+			http.Error(w, "Only admins may create tokens with the admin scope.", http.StatusForbidden)
+			return
+		}
+		t, secret, err := CreateToken(email, req.Name, req.Scopes, time.Duration(req.Days)*24*time.Hour)
+		if err != nil {
+			httputils.ReportError(w, r, err, fmt.Sprintf("Failed to create token: %s", err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(struct {
+			Token  *Token
+			Secret string
+		}{
+			Token:  t,
+			Secret: secret,
+		}); err != nil {
+			sklog.Errorf("Failed to write response: %s", err)
+		}
+		return
+	case "DELETE":
+		if err := RevokeToken(email, r.FormValue("id")); err != nil {
+			httputils.ReportError(w, r, err, fmt.Sprintf("Failed to revoke token: %s", err))
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed.", http.StatusMethodNotAllowed)
+		return
+	}
+	tokens, err := db.List(email)
+	if err != nil {
+		httputils.ReportError(w, r, err, "Failed to retrieve tokens.")
+		return
+	}
+	rv := make([]*Token, 0, len(tokens))
+	for _, t := range tokens {
+		rv = append(rv, t.copyWithoutHash())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(rv); err != nil {
+		sklog.Errorf("Failed to write response: %s", err)
+	}
+}
@@ -0,0 +1,280 @@
+package login
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils"
+)
+
+// setupTokens initializes the login system with a TokenDB in a temporary
+// directory. Returns a cleanup func.
+func setupTokens(t *testing.T) func() {
+	once.Do(loginInit)
+	tmp, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	db, err := NewTokenDB(path.Join(tmp, "tokens.db"))
+	assert.NoError(t, err)
+	InitTokens(db)
+	return func() {
+		InitTokens(nil)
+		testutils.AssertCloses(t, db)
+		testutils.RemoveAll(t, tmp)
+	}
+}
+
+func tokenRequest(t *testing.T, method, secret string) *http.Request {
+	r, err := http.NewRequest(method, "http://www.skia.org/", nil)
+	assert.NoError(t, err)
+	r.Header.Set("Authorization", AUTHORIZATION_PREFIX+secret)
+	return r
+}
+
+func TestTokenScopes(t *testing.T) {
+	testutils.MediumTest(t)
+	defer setupTokens(t)()
+	activeAdminEmailWhiteList["admin@google.com"] = true
+	defer delete(activeAdminEmailWhiteList, "admin@google.com")
+
+	_, readSecret, err := CreateToken("fred@google.com", "read", []string{SCOPE_READ}, 0)
+	assert.NoError(t, err)
+	_, triageSecret, err := CreateToken("fred@google.com", "triage", []string{SCOPE_READ, SCOPE_TRIAGE}, 0)
+	assert.NoError(t, err)
+	_, adminSecret, err := CreateToken("admin@google.com", "admin", []string{SCOPE_ADMIN}, 0)
+	assert.NoError(t, err)
+	_, notAdminSecret, err := CreateToken("fred@google.com", "admin", []string{SCOPE_ADMIN}, 0)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "fred@google.com", LoggedInAs(tokenRequest(t, "GET", readSecret)))
+	assert.Equal(t, "", LoggedInAs(tokenRequest(t, "POST", readSecret)))
+	assert.Equal(t, "fred@google.com", LoggedInAs(tokenRequest(t, "POST", triageSecret)))
+	assert.False(t, IsAdmin(tokenRequest(t, "POST", triageSecret)))
+	assert.True(t, IsAdmin(tokenRequest(t, "POST", adminSecret)))
+	assert.False(t, IsAdmin(tokenRequest(t, "POST", notAdminSecret)))
+
+	// Bad secrets.
+	assert.Equal(t, "", LoggedInAs(tokenRequest(t, "GET", readSecret+"x")))
+	assert.Equal(t, "", LoggedInAs(tokenRequest(t, "GET", "garbage")))
+	assert.Equal(t, "", LoggedInAs(tokenRequest(t, "GET", "")))
+
+	// Invalid tokens.
+	_, _, err = CreateToken("fred@google.com", "bad", []string{}, 0)
+	assert.Error(t, err)
+	_, _, err = CreateToken("fred@google.com", "bad", []string{"write"}, 0)
+	assert.Error(t, err)
+	_, _, err = CreateToken("fred@google.com", "bad", []string{SCOPE_READ}, 2*MAX_TOKEN_LIFETIME)
+	assert.Error(t, err)
+}
+
+func TestTokenExpireRevoke(t *testing.T) {
+	testutils.MediumTest(t)
+	defer setupTokens(t)()
+
+	tok, secret, err := CreateToken("fred@google.com", "short", []string{SCOPE_READ}, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "", tok.Hash)
+	assert.Equal(t, "fred@google.com", LoggedInAs(tokenRequest(t, "GET", secret)))
+
+	// LastUsed was recorded and the hash, not the secret, was stored.
+	stored, err := getTokenDB().Get(tok.ID)
+	assert.NoError(t, err)
+	assert.False(t, stored.LastUsed.IsZero())
+	assert.Equal(t, hashSecret(strings.TrimPrefix(secret, tok.ID+".")), stored.Hash)
+
+	// Expire the token.
+	stored.Expires = time.Now().Add(-time.Minute)
+	assert.NoError(t, getTokenDB().Put(stored))
+	assert.Equal(t, "", LoggedInAs(tokenRequest(t, "GET", secret)))
+
+	// Only the owner can revoke a token.
+	_, secret, err = CreateToken("fred@google.com", "revoked", []string{SCOPE_READ}, 0)
+	assert.NoError(t, err)
+	id := strings.SplitN(secret, ".", 2)[0]
+	assert.Error(t, RevokeToken("barney@google.com", id))
+	assert.Equal(t, "fred@google.com", LoggedInAs(tokenRequest(t, "GET", secret)))
+	assert.NoError(t, RevokeToken("fred@google.com", id))
+	assert.Equal(t, "", LoggedInAs(tokenRequest(t, "GET", secret)))
+
+	// The owner is no longer whitelisted.
+	_, secret, err = CreateToken("fred@example.com", "example", []string{SCOPE_READ}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "", LoggedInAs(tokenRequest(t, "GET", secret)))
+
+	// Tokens are not accepted if they are disabled.
+	_, secret, err = CreateToken("fred@google.com", "disabled", []string{SCOPE_READ}, 0)
+	assert.NoError(t, err)
+	db := getTokenDB()
+	InitTokens(nil)
+	assert.Equal(t, "", LoggedInAs(tokenRequest(t, "GET", secret)))
+	InitTokens(db)
+}
+
+func TestTokensHandler(t *testing.T) {
+	testutils.MediumTest(t)
+	defer setupTokens(t)()
+
+	s := &Session{
+		Email:     "fred@google.com",
+		ID:        "12345",
+		AuthScope: DEFAULT_SCOPE[0],
+	}
+	do := func(method, url string, body interface{}, cookie bool) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		if body != nil {
+			assert.NoError(t, json.NewEncoder(&b).Encode(body))
+		}
+		r, err := http.NewRequest(method, url, &b)
+		assert.NoError(t, err)
+		if cookie {
+			c, err := CookieFor(s, r)
+			assert.NoError(t, err)
+			r.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		TokensHandler(w, r)
+		return w
+	}
+
+	// Not logged in.
+	assert.Equal(t, http.StatusForbidden, do("GET", "/json/tokens", nil, false).Code)
+
+	// Create a token.
+	w := do("POST", "/json/tokens", map[string]interface{}{
+		"Name":   "my script",
+		"Scopes": []string{SCOPE_TRIAGE},
+		"Days":   7,
+	}, true)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var created struct {
+		Token  *Token
+		Secret string
+	}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.Equal(t, "my script", created.Token.Name)
+	assert.Equal(t, "", created.Token.Hash)
+	assert.Equal(t, "fred@google.com", LoggedInAs(tokenRequest(t, "POST", created.Secret)))
+
+	// Non-admins can't create admin tokens.
+	w = do("POST", "/json/tokens", map[string]interface{}{
+		"Name":   "admin",
+		"Scopes": []string{SCOPE_ADMIN},
+	}, true)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// API tokens can't be used to manage tokens.
+	r := tokenRequest(t, "GET", created.Secret)
+	w = httptest.NewRecorder()
+	TokensHandler(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// List and revoke.
+	var tokens []*Token
+	w = do("GET", "/json/tokens", nil, true)
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&tokens))
+	assert.Len(t, tokens, 1)
+	assert.Equal(t, created.Token.ID, tokens[0].ID)
+	assert.Equal(t, "", tokens[0].Hash)
+	w = do("DELETE", fmt.Sprintf("/json/tokens?id=%s", created.Token.ID), nil, true)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&tokens))
+	assert.Len(t, tokens, 1)
+	assert.True(t, tokens[0].Revoked)
+	assert.Equal(t, "", LoggedInAs(tokenRequest(t, "POST", created.Secret)))
+}
+
+// hookTokenDB wraps a TokenDB, counting calls to Get and calling afterGet, if
+// set, after each one.
+type hookTokenDB struct {
+	TokenDB
+	gets     int
+	afterGet func()
+}
+
+func (d *hookTokenDB) Get(id string) (*Token, error) {
+	d.gets++
+	t, err := d.TokenDB.Get(id)
+	if d.afterGet != nil {
+		d.afterGet()
+	}
+	return t, err
+}
+
+func TestTokenRevokeDuringUse(t *testing.T) {
+	testutils.MediumTest(t)
+	defer setupTokens(t)()
+	tok, secret, err := CreateToken("fred@google.com", "racy", []string{SCOPE_READ}, 0)
+	assert.NoError(t, err)
+
+	// The token is revoked after it was read but before its last use is
+	// written back.
+	db := &hookTokenDB{TokenDB: getTokenDB()}
+	db.afterGet = func() {
+		db.afterGet = nil
+		assert.NoError(t, RevokeToken("fred@google.com", tok.ID))
+	}
+	InitTokens(db)
+	assert.Equal(t, "fred@google.com", LoggedInAs(tokenRequest(t, "GET", secret)))
+
+	// The revocation sticks.
+	stored, err := db.TokenDB.Get(tok.ID)
+	assert.NoError(t, err)
+	assert.True(t, stored.Revoked)
+	assert.False(t, stored.LastUsed.IsZero())
+	assert.Equal(t, "", LoggedInAs(tokenRequest(t, "GET", secret)))
+}
+
+func TestTokenLookedUpOncePerRequest(t *testing.T) {
+	testutils.MediumTest(t)
+	defer setupTokens(t)()
+	activeAdminEmailWhiteList["admin@google.com"] = true
+	defer delete(activeAdminEmailWhiteList, "admin@google.com")
+	_, secret, err := CreateToken("admin@google.com", "admin", []string{SCOPE_ADMIN}, 0)
+	assert.NoError(t, err)
+	db := &hookTokenDB{TokenDB: getTokenDB()}
+	InitTokens(db)
+
+	// The token is looked up once by TokenAuth, even if the request is
+	// replaced by the wrapped handlers.
+	called := false
+	h := TokenAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(context.WithValue(r.Context(), contextKey(1), "value"))
+		RequireRole(ROLE_ADMIN, func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			assert.Equal(t, "admin@google.com", LoggedInAs(r))
+			assert.True(t, IsAdmin(r))
+			assert.Equal(t, ROLE_ADMIN, RoleOf(r))
+		})(w, r)
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, tokenRequest(t, "POST", secret))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, called)
+	assert.Equal(t, 1, db.gets)
+
+	// RequireRole looks up the token itself.
+	called = false
+	w = httptest.NewRecorder()
+	RequireRole(ROLE_ADMIN, func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		assert.Equal(t, "admin@google.com", LoggedInAs(r))
+	})(w, tokenRequest(t, "POST", secret))
+	assert.True(t, called)
+	assert.Equal(t, 2, db.gets)
+
+	// Requests which didn't go through any of the middleware look up the
+	// token every time.
+	r := tokenRequest(t, "POST", secret)
+	assert.Equal(t, "admin@google.com", LoggedInAs(r))
+	assert.Equal(t, "admin@google.com", LoggedInAs(r))
+	assert.Equal(t, 4, db.gets)
+}
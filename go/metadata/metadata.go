@@ -1,6 +1,7 @@
 package metadata
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -54,8 +55,20 @@ const (
 
 	// NSQ_TEST_SERVER refers to a test server in GCE which runs NSQ for testing purposes.
 	NSQ_TEST_SERVER = "nsq-test-server"
+
+	// PUSH_RELEASE_KEY is the PEM encoded RSA public key that release packages
+	// are verified with. See go/packages/provenance.go.
+	PUSH_RELEASE_KEY = "push_release_key"
+
+	// PUSH_PRODUCTION is the instance level metadata that marks a server as
+	// production if set to "true". pulld only installs verified release
+	// packages on production servers.
+	PUSH_PRODUCTION = "push_production"
 )
 
+// ErrNotFound is returned by Get and ProjectGet if the value is not set.
+var ErrNotFound = errors.New("Metadata value not found.")
+
 // get retrieves the named value from the Metadata server. See
 // https://developers.google.com/compute/docs/metadata
 //
@@ -72,10 +85,13 @@ func get(name string, level string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("metadata.Get() failed to make HTTP request for %s: %s", name, err)
 	}
+	defer util.Close(resp.Body)
+	if resp.StatusCode == http.StatusNotFound {
+		return "", ErrNotFound
+	}
 	if resp.StatusCode != http.StatusOK {
 		return "", fmt.Errorf("HTTP response has status %d", resp.StatusCode)
 	}
-	defer util.Close(resp.Body)
 	value, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return "", fmt.Errorf("Failed to read %s from metadata server: %s", name, err)
@@ -60,6 +60,18 @@ since data points will not be evenly spaced and may not exist for a time
 period.  Timer requires a name and not a measurement, because the measurement
 is always “timer” and the provided name is inserted as a tag.
 
+### Histograms
+
+Timers and Float64SummaryMetric compute quantiles within a single process,
+which can't be combined across instances or tags.  To alert on, e.g., the 99th
+percentile latency of a service, use a Float64HistogramMetric instead, which
+counts values in fixed buckets: metrics2.GetFloat64HistogramMetric(measurement,
+buckets, tags).Observe(value).  Pass nil buckets to use DEFAULT_BUCKETS, which
+suit latencies in seconds, or create them with ExponentialBuckets.  The buckets
+of a measurement are fixed when its first metric is created.
+metrics2.NewHistogramTimer(name, buckets, tags) returns a Timer which records
+into a histogram, in nanoseconds, as well as the usual summary.
+
 ### FuncTimer
 
 FuncTimer is a special Timer designed specifically for timing the duration of
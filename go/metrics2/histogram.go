@@ -0,0 +1,27 @@
+package metrics2
+
+var (
+	// DEFAULT_BUCKETS are the default buckets for Float64HistogramMetric,
+	// suitable for latencies in seconds, from 5ms to 10s.
+	DEFAULT_BUCKETS = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	// TIMER_BUCKETS are the default buckets for histogram Timers, which
+	// record in nanoseconds, from 1ms to ~2m.
+	TIMER_BUCKETS = ExponentialBuckets(1e6, 2, 18)
+)
+
+// ExponentialBuckets returns count buckets for a Float64HistogramMetric, where
+// the first bucket has an upper bound of start and each following bucket's
+// upper bound is factor times the previous one. Panics if count < 1,
+// start <= 0 or factor <= 1, since those are programming errors.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	if count < 1 || start <= 0 || factor <= 1 {
+		panic("ExponentialBuckets requires count >= 1, start > 0 and factor > 1.")
+	}
+	rv := make([]float64, count)
+	for i := range rv {
+		rv[i] = start
+		start *= factor
+	}
+	return rv
+}
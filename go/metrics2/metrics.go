@@ -69,6 +69,14 @@ type Float64SummaryMetric interface {
 	Observe(v float64)
 }
 
+// Float64HistogramMetric is a metric which counts float64 values in buckets.
+// Unlike Float64SummaryMetric, histograms may be aggregated across tags and
+// instances, e.g. to compute the 99th percentile latency of a service.
+type Float64HistogramMetric interface {
+	// Observe adds a data point to the metric.
+	Observe(v float64)
+}
+
 // Counter is a struct used for tracking metrics which increment or decrement.
 type Counter interface {
 	// Dec decrements the counter by the given quantity.
@@ -104,11 +112,23 @@ type Client interface {
 	// GetFloat64SummaryMetric returns an Float64SummaryMetric instance.
 	GetFloat64SummaryMetric(measurement string, tags ...map[string]string) Float64SummaryMetric
 
+	// GetFloat64HistogramMetric returns a Float64HistogramMetric instance
+	// which counts values in the given buckets. Buckets are the upper bounds
+	// of each bucket, in increasing order; DEFAULT_BUCKETS is used if buckets
+	// is nil. All metrics with the same measurement share the buckets given
+	// when the first of them was created.
+	GetFloat64HistogramMetric(measurement string, buckets []float64, tags ...map[string]string) Float64HistogramMetric
+
 	// NewLiveness creates a new Liveness metric helper.
 	NewLiveness(name string, tagsList ...map[string]string) Liveness
 
 	// NewTimer creates and returns a new started timer.
 	NewTimer(name string, tagsList ...map[string]string) Timer
+
+	// NewHistogramTimer creates and returns a new started timer which also
+	// records into a Float64HistogramMetric with the given buckets, in
+	// nanoseconds. TIMER_BUCKETS is used if buckets is nil.
+	NewHistogramTimer(name string, buckets []float64, tagsList ...map[string]string) Timer
 }
 
 var (
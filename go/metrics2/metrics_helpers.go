@@ -9,3 +9,8 @@ func GetInt64Metric(measurement string, tags ...map[string]string) Int64Metric {
 func GetFloat64Metric(measurement string, tags ...map[string]string) Float64Metric {
 	return defaultClient.GetFloat64Metric(measurement, tags...)
 }
+
+// GetFloat64HistogramMetric returns a Float64HistogramMetric instance using the default client.
+func GetFloat64HistogramMetric(measurement string, buckets []float64, tags ...map[string]string) Float64HistogramMetric {
+	return defaultClient.GetFloat64HistogramMetric(measurement, buckets, tags...)
+}
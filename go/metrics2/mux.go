@@ -62,6 +62,16 @@ func (m *muxClient) GetFloat64SummaryMetric(name string, tagList ...map[string]s
 	return ret
 }
 
+func (m *muxClient) GetFloat64HistogramMetric(name string, buckets []float64, tagList ...map[string]string) Float64HistogramMetric {
+	ret := &muxFloat64HistogramMetric{
+		metrics: []Float64HistogramMetric{},
+	}
+	for _, c := range m.clients {
+		ret.metrics = append(ret.metrics, c.GetFloat64HistogramMetric(name, buckets, tagList...))
+	}
+	return ret
+}
+
 func (m *muxClient) GetInt64Metric(name string, tagList ...map[string]string) Int64Metric {
 	ret := &muxInt64Metric{
 		metrics: []Int64Metric{},
@@ -92,6 +102,16 @@ func (m *muxClient) NewTimer(name string, tagList ...map[string]string) Timer {
 	return ret
 }
 
+func (m *muxClient) NewHistogramTimer(name string, buckets []float64, tagList ...map[string]string) Timer {
+	ret := &muxTimer{
+		timers: []Timer{},
+	}
+	for _, c := range m.clients {
+		ret.timers = append(ret.timers, c.NewHistogramTimer(name, buckets, tagList...))
+	}
+	return ret
+}
+
 // muxTimer implements the Timer interface.
 type muxTimer struct {
 	timers []Timer
@@ -191,6 +211,17 @@ func (mf *muxFloat64SummaryMetric) Observe(v float64) {
 	}
 }
 
+// muxFloat64HistogramMetric implements the Float64HistogramMetric interface.
+type muxFloat64HistogramMetric struct {
+	metrics []Float64HistogramMetric
+}
+
+func (mf *muxFloat64HistogramMetric) Observe(v float64) {
+	for _, m := range mf.metrics {
+		m.Observe(v)
+	}
+}
+
 // muxCounter implements the Counter interface.
 type muxCounter struct {
 	metrics []Counter
@@ -232,6 +263,7 @@ func (mc *muxCounter) Reset() {
 var _ Client = (*muxClient)(nil)
 var _ Counter = (*muxCounter)(nil)
 var _ Float64Metric = (*muxFloat64Metric)(nil)
+var _ Float64HistogramMetric = (*muxFloat64HistogramMetric)(nil)
 var _ Int64Metric = (*muxInt64Metric)(nil)
 var _ Liveness = (*muxLiveness)(nil)
 var _ Timer = (*muxTimer)(nil)
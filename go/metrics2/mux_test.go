@@ -63,6 +63,16 @@ func testClient(t *testing.T, c Client) {
 
 	gc.Reset()
 	assert.Equal(t, int64(0), gc.Get())
+
+	// Float64HistogramMetric
+	gh := c.GetFloat64HistogramMetric("a.h", []float64{1, 2, 4}, map[string]string{"some_key": "some-value"})
+	assert.NotNil(t, gh)
+	gh.Observe(3)
+
+	// Histogram timer.
+	tm := c.NewHistogramTimer("t", nil, map[string]string{"some_key": "some-value"})
+	assert.NotNil(t, tm)
+	tm.Stop()
 }
 
 func TestClients(t *testing.T) {
@@ -81,6 +81,15 @@ func (m *promFloat64Summary) Observe(v float64) {
 	m.observer.Observe(v)
 }
 
+// promFloat64Histogram implements the Float64HistogramMetric interface.
+type promFloat64Histogram struct {
+	observer prometheus.Observer
+}
+
+func (m *promFloat64Histogram) Observe(v float64) {
+	m.observer.Observe(v)
+}
+
 // promCounter implements the Counter interface.
 type promCounter struct {
 	pi *promInt64
@@ -119,6 +128,10 @@ type promClient struct {
 	float64SummaryVecs  map[string]*prometheus.SummaryVec
 	float64Summaries    map[string]*promFloat64Summary
 	float64SummaryMutex sync.Mutex
+
+	float64HistogramVecs  map[string]*prometheus.HistogramVec
+	float64Histograms     map[string]*promFloat64Histogram
+	float64HistogramMutex sync.Mutex
 }
 
 func newPromClient() *promClient {
@@ -129,6 +142,9 @@ func newPromClient() *promClient {
 		float64Gauges:      map[string]*promFloat64{},
 		float64SummaryVecs: map[string]*prometheus.SummaryVec{},
 		float64Summaries:   map[string]*promFloat64Summary{},
+
+		float64HistogramVecs: map[string]*prometheus.HistogramVec{},
+		float64Histograms:    map[string]*promFloat64Histogram{},
 	}
 }
 
@@ -311,6 +327,56 @@ func (p *promClient) GetFloat64SummaryMetric(name string, tags ...map[string]str
 	return ret
 }
 
+func (p *promClient) GetFloat64HistogramMetric(name string, buckets []float64, tags ...map[string]string) Float64HistogramMetric {
+	measurement, cleanTags, keys, histogramKey, histogramVecKey := p.commonGet(name, tags...)
+
+	p.float64HistogramMutex.Lock()
+	ret, ok := p.float64Histograms[histogramKey]
+	p.float64HistogramMutex.Unlock()
+
+	if ok {
+		return ret
+	}
+
+	if buckets == nil {
+		buckets = DEFAULT_BUCKETS
+	}
+
+	// Didn't find the metric, so we need to look for a HistogramVec to create it under.
+	p.float64HistogramMutex.Lock()
+	histogramVec, ok := p.float64HistogramVecs[histogramVecKey]
+	if !ok {
+		// Register a new histogram vec.
+		histogramVec = prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    measurement,
+				Help:    measurement,
+				Buckets: buckets,
+			},
+			keys,
+		)
+		err := prometheus.Register(histogramVec)
+		if err != nil {
+			glog.Fatalf("Failed to register %q %v: %s", measurement, cleanTags, err)
+		}
+		p.float64HistogramVecs[histogramVecKey] = histogramVec
+	}
+	p.float64HistogramMutex.Unlock()
+
+	observer, err := histogramVec.GetMetricWith(prometheus.Labels(cleanTags))
+	if err != nil {
+		glog.Fatalf("Failed to get observer: %s", err)
+	}
+	ret = &promFloat64Histogram{
+		observer: observer,
+	}
+
+	p.float64HistogramMutex.Lock()
+	p.float64Histograms[histogramKey] = ret
+	p.float64HistogramMutex.Unlock()
+	return ret
+}
+
 func (c *promClient) Flush() error {
 	// The Flush is a lie.
 	return nil
@@ -321,12 +387,20 @@ func (c *promClient) NewLiveness(name string, tagsList ...map[string]string) Liv
 }
 
 func (c *promClient) NewTimer(name string, tagsList ...map[string]string) Timer {
-	return newTimer(c, name, true, tagsList...)
+	return newTimer(c, name, true, nil, tagsList...)
+}
+
+func (c *promClient) NewHistogramTimer(name string, buckets []float64, tagsList ...map[string]string) Timer {
+	if buckets == nil {
+		buckets = TIMER_BUCKETS
+	}
+	return newTimer(c, name, true, buckets, tagsList...)
 }
 
 // Validate that the concrete structs faithfully implement their respective interfaces.
 var _ Int64Metric = (*promInt64)(nil)
 var _ Float64Metric = (*promFloat64)(nil)
 var _ Float64SummaryMetric = (*promFloat64Summary)(nil)
+var _ Float64HistogramMetric = (*promFloat64Histogram)(nil)
 var _ Counter = (*promCounter)(nil)
 var _ Client = (*promClient)(nil)
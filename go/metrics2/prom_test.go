@@ -95,6 +95,40 @@ func TestCounter(t *testing.T) {
 	assert.Equal(t, int64(0), g.Get())
 }
 
+func TestFloat64Histogram(t *testing.T) {
+	testutils.SmallTest(t)
+	c := getPromClient()
+	h := c.GetFloat64HistogramMetric("a.h", []float64{1, 2, 4}, map[string]string{"some_key": "some-value"})
+	assert.NotNil(t, h)
+	assert.NotNil(t, c.float64HistogramVecs["a_h [some_key]"])
+	assert.NotNil(t, c.float64Histograms["a_h-some_key-some-value"])
+	h.Observe(1.5)
+	h.Observe(3)
+
+	// The same metric is returned for the same tags.
+	assert.Equal(t, h, c.GetFloat64HistogramMetric("a.h", nil, map[string]string{"some_key": "some-value"}))
+
+	// Default buckets.
+	h = c.GetFloat64HistogramMetric("default_h", nil)
+	assert.NotNil(t, h)
+	h.Observe(0.1)
+
+	// Histogram timer.
+	tm := c.NewHistogramTimer("my-timer", nil)
+	tm.Stop()
+	assert.NotNil(t, c.float64Summaries["timer_my_timer_ns-name-my-timer-type-timer"])
+	assert.NotNil(t, c.float64Histograms["timer_my_timer_ns_histogram-name-my-timer-type-timer"])
+}
+
+func TestExponentialBuckets(t *testing.T) {
+	testutils.SmallTest(t)
+	assert.Equal(t, []float64{1, 3, 9, 27}, ExponentialBuckets(1, 3, 4))
+	assert.Len(t, TIMER_BUCKETS, 18)
+	assert.Panics(t, func() { ExponentialBuckets(0, 2, 4) })
+	assert.Panics(t, func() { ExponentialBuckets(1, 1, 4) })
+	assert.Panics(t, func() { ExponentialBuckets(1, 2, 0) })
+}
+
 func TestPanicOn(t *testing.T) {
 	testutils.SmallTest(t)
 	/*
@@ -18,13 +18,17 @@ const (
 type timer struct {
 	begin time.Time
 	m     Float64SummaryMetric
+	// h is nil unless the timer also records into a histogram.
+	h Float64HistogramMetric
 }
 
 // NewTimer creates and returns a new started timer.
 //
 // makeUnique - True if the measurement name needs to made unique, which means
 //              to append 'name' to 'timer'.
-func newTimer(c Client, name string, makeUnique bool, tagsList ...map[string]string) Timer {
+// buckets    - If not nil, the timer also records into a histogram with
+//              these buckets.
+func newTimer(c Client, name string, makeUnique bool, buckets []float64, tagsList ...map[string]string) Timer {
 	// Make a copy of the tags and add the name.
 	tags := util.AddParams(map[string]string{}, tagsList...)
 	tags["name"] = name
@@ -36,6 +40,9 @@ func newTimer(c Client, name string, makeUnique bool, tagsList ...map[string]str
 	ret := &timer{
 		m: c.GetFloat64SummaryMetric(measurement, tags),
 	}
+	if buckets != nil {
+		ret.h = c.GetFloat64HistogramMetric(measurement+"_histogram", buckets, tags)
+	}
 	ret.Start()
 	return ret
 }
@@ -49,6 +56,9 @@ func (t *timer) Start() {
 func (t *timer) Stop() {
 	v := float64(time.Now().Sub(t.begin))
 	t.m.Observe(v)
+	if t.h != nil {
+		t.h.Observe(v)
+	}
 }
 
 // NewTimer creates and returns a new Timer using the default client.
@@ -56,6 +66,14 @@ func NewTimer(name string, tags ...map[string]string) Timer {
 	return defaultClient.NewTimer(name, tags...)
 }
 
+// NewHistogramTimer creates and returns a new Timer using the default client,
+// which also records into a histogram with the given buckets so that
+// percentiles may be computed across instances. TIMER_BUCKETS is used if
+// buckets is nil.
+func NewHistogramTimer(name string, buckets []float64, tags ...map[string]string) Timer {
+	return defaultClient.NewHistogramTimer(name, buckets, tags...)
+}
+
 // FuncTimer is specifically intended for measuring the duration of functions.
 // It uses the default client.
 //
@@ -4,6 +4,7 @@ package packages
 import (
 	"bufio"
 	"bytes"
+	"crypto/rsa"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -41,6 +42,18 @@ type Package struct {
 	Dirty    bool
 	Note     string
 	Services []string
+
+	// The rest of the provenance of the package, see provenance.go.
+	BuildHost string
+	GoVersion string
+	SHA256    string // Of the .deb file.
+	Signature string // Base64 encoded signature of Provenance().
+
+	// Verified is true if the package can be installed on production
+	// servers, and Verification explains why not otherwise. Only set if a
+	// release key was given to SetReleaseKey.
+	Verified     bool
+	Verification string
 }
 
 func (p *Package) String() string {
@@ -177,7 +190,7 @@ func safeGetTime(m map[string]string, key string) time.Time {
 	if value == "" {
 		return time.Time{}
 	}
-	ret, err := time.Parse("2006-01-02T15:04:05Z", value)
+	ret, err := time.Parse(DATETIME_FORMAT, value)
 	if err != nil {
 		sklog.Errorf("Failed to parse metadata datatime %s: %s", value, err)
 	}
@@ -212,6 +225,26 @@ func safeGetStringSlice(m map[string]string, key string) []string {
 	}
 }
 
+// packageFromMetadata creates a Package from the Google Storage metadata of its
+// .deb file, and verifies it if there is a release key.
+func packageFromMetadata(name string, m map[string]string) *Package {
+	p := &Package{
+		Name:      name,
+		Hash:      safeGet(m, "hash", ""),
+		UserID:    safeGet(m, "userid", ""),
+		Built:     safeGetTime(m, "datetime"),
+		Dirty:     safeGetBool(m, "dirty"),
+		Note:      safeGet(m, "note", ""),
+		Services:  safeGetStringSlice(m, "services"),
+		BuildHost: safeGet(m, "buildhost", ""),
+		GoVersion: safeGet(m, "goversion", ""),
+		SHA256:    safeGet(m, "sha256", ""),
+		Signature: safeGet(m, "signature", ""),
+	}
+	p.setVerification(releaseKey)
+	return p
+}
+
 // PackageSlice is for sorting Packages by Built time.
 type PackageSlice []*Package
 
@@ -247,15 +280,7 @@ func AllAvailable(store *storage.Service) (map[string][]*Package, error) {
 				sklog.Errorf("Debian package without proper metadata: %s", o.Name)
 				continue
 			}
-			p := &Package{
-				Name:     o.Name[5:], // Strip of debs/ from the beginning.
-				Hash:     safeGet(o.Metadata, "hash", ""),
-				UserID:   safeGet(o.Metadata, "userid", ""),
-				Built:    safeGetTime(o.Metadata, "datetime"),
-				Dirty:    safeGetBool(o.Metadata, "dirty"),
-				Note:     safeGet(o.Metadata, "note", ""),
-				Services: safeGetStringSlice(o.Metadata, "services"),
-			}
+			p := packageFromMetadata(o.Name[5:], o.Metadata) // Strip of debs/ from the beginning.
 			if _, ok := ret[key]; !ok {
 				ret[key] = []*Package{}
 			}
@@ -289,15 +314,7 @@ func AllAvailableApp(store *storage.Service, appName string) ([]*Package, error)
 				sklog.Errorf("Debian package without proper metadata: %s", o.Name)
 				continue
 			}
-			p := &Package{
-				Name:     o.Name[len(prefix):], // Strip of debs/ from the beginning.
-				Hash:     safeGet(o.Metadata, "hash", ""),
-				UserID:   safeGet(o.Metadata, "userid", ""),
-				Built:    safeGetTime(o.Metadata, "datetime"),
-				Dirty:    safeGetBool(o.Metadata, "dirty"),
-				Note:     safeGet(o.Metadata, "note", ""),
-				Services: safeGetStringSlice(o.Metadata, "services"),
-			}
+			p := packageFromMetadata(o.Name[len(prefix):], o.Metadata) // Strip of debs/ from the beginning.
 			ret = append(ret, p)
 		}
 		if objs.NextPageToken == "" {
@@ -402,13 +419,30 @@ func ToLocalFile(packages []string, filename string) error {
 	return nil
 }
 
-// Install downloads and installs a debian package from Google Storage.
-func Install(client *http.Client, store *storage.Service, name string) error {
+// VerifyError is returned by Install if a package fails Verify or VerifyFile.
+type VerifyError struct {
+	Err error
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("Refusing to install: %s", e.Err)
+}
+
+// Install downloads and installs a debian package from Google Storage. If key
+// is not nil then packages that fail Verify or VerifyFile are not installed,
+// and a *VerifyError is returned.
+func Install(client *http.Client, store *storage.Service, name string, key *rsa.PublicKey) error {
 	sklog.Infof("Installing: %s", name)
 	obj, err := store.Objects.Get(bucketName, "debs/"+name).Do()
 	if err != nil {
 		return fmt.Errorf("Failed to retrieve Google Storage metadata about debian package: %s", err)
 	}
+	p := packageFromMetadata(name, obj.Metadata)
+	if key != nil {
+		if err := p.Verify(key); err != nil {
+			return &VerifyError{Err: err}
+		}
+	}
 	req, err := gcs.RequestForStorageURL(obj.MediaLink)
 	if err != nil {
 		return fmt.Errorf("Failed to construct request object for media: %s", err)
@@ -429,6 +463,11 @@ func Install(client *http.Client, store *storage.Service, name string) error {
 	if copyErr != nil {
 		return fmt.Errorf("Failed to download file: %s", copyErr)
 	}
+	if key != nil {
+		if err := p.VerifyFile(f.Name()); err != nil {
+			return &VerifyError{Err: err}
+		}
+	}
 
 	if err := installDependencies(f.Name()); err != nil {
 		return fmt.Errorf("Error installing dependencies: %s", err)
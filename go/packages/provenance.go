@@ -0,0 +1,135 @@
+package packages
+
+// Release packages record where they came from in their Google Storage
+// metadata, and ../../bash/release.sh signs that provenance record with the
+// release key if RELEASE_SIGNING_KEY is set. Servers that are marked
+// production only install packages whose provenance is signed, that were built
+// from a clean tree, and whose contents match the signed SHA-256.
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.skia.org/infra/go/util"
+)
+
+const (
+	// DATETIME_FORMAT is the format of the datetime metadata of a package.
+	DATETIME_FORMAT = "2006-01-02T15:04:05Z"
+
+	// VERIFIED is the Verification of packages that pass Verify.
+	VERIFIED = "verified"
+)
+
+var (
+	// releaseKey is used to verify packages in AllAvailable and
+	// AllAvailableApp. See SetReleaseKey.
+	releaseKey *rsa.PublicKey
+)
+
+// SetReleaseKey sets the key that AllAvailable and AllAvailableApp use to fill
+// in the Verified and Verification of each package.
+func SetReleaseKey(key *rsa.PublicKey) {
+	releaseKey = key
+}
+
+// ParseReleaseKey parses a PEM encoded RSA public key, e.g. the output of
+// `openssl rsa -in release_key.pem -pubout`.
+func ParseReleaseKey(b []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("No PEM data found in release key.")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse release key: %s", err)
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("Release key is not an RSA key.")
+	}
+	return rsaKey, nil
+}
+
+// Provenance returns the record of where the package came from that release.sh
+// signs. It must match the PROVENANCE built in release.sh byte for byte.
+func (p *Package) Provenance() []byte {
+	lines := []string{
+		"name:" + p.Name,
+		"sha256:" + p.SHA256,
+		"hash:" + p.Hash,
+		"userid:" + p.UserID,
+		"datetime:" + p.Built.UTC().Format(DATETIME_FORMAT),
+		"buildhost:" + p.BuildHost,
+		fmt.Sprintf("dirty:%t", p.Dirty),
+		"goversion:" + p.GoVersion,
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// Verify returns an error if the package is not safe to install on production
+// servers, i.e. if it was built from a dirty tree, or its provenance is not
+// signed by key.
+func (p *Package) Verify(key *rsa.PublicKey) error {
+	if key == nil {
+		return fmt.Errorf("No release key to verify %s with.", p.Name)
+	}
+	if p.Signature == "" {
+		return fmt.Errorf("%s is not signed.", p.Name)
+	}
+	if p.SHA256 == "" {
+		return fmt.Errorf("%s has no SHA-256.", p.Name)
+	}
+	if p.Dirty {
+		return fmt.Errorf("%s was built from a dirty tree.", p.Name)
+	}
+	sig, err := base64.StdEncoding.DecodeString(p.Signature)
+	if err != nil {
+		return fmt.Errorf("%s has a malformed signature: %s", p.Name, err)
+	}
+	hashed := sha256.Sum256(p.Provenance())
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], sig); err != nil {
+		return fmt.Errorf("%s has an invalid signature: %s", p.Name, err)
+	}
+	return nil
+}
+
+// VerifyFile returns an error if the contents of the given file don't match
+// the SHA-256 in the provenance of the package.
+func (p *Package) VerifyFile(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("Failed to open %s: %s", filename, err)
+	}
+	defer util.Close(f)
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("Failed to read %s: %s", filename, err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != p.SHA256 {
+		return fmt.Errorf("%s has SHA-256 %s, but was signed with %s.", p.Name, got, p.SHA256)
+	}
+	return nil
+}
+
+// setVerification fills in Verified and Verification using key.
+func (p *Package) setVerification(key *rsa.PublicKey) {
+	if key == nil {
+		return
+	}
+	if err := p.Verify(key); err != nil {
+		p.Verification = err.Error()
+		return
+	}
+	p.Verified = true
+	p.Verification = VERIFIED
+}
@@ -0,0 +1,144 @@
+package packages
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.skia.org/infra/go/testutils"
+
+	expect "github.com/stretchr/testify/assert"
+	assert "github.com/stretchr/testify/require"
+)
+
+const DEB_CONTENTS = "not really a debian package"
+
+// signedPackage returns a package signed with key, as release.sh would upload
+// it.
+func signedPackage(t *testing.T, key *rsa.PrivateKey) *Package {
+	sum := sha256.Sum256([]byte(DEB_CONTENTS))
+	p := packageFromMetadata("pulld/pulld:someone@example.com:2017-06-01T12:00:00Z:abc123.deb", map[string]string{
+		"appname":   "pulld",
+		"hash":      "abc123",
+		"userid":    "someone@example.com",
+		"datetime":  "2017-06-01T12:00:00Z",
+		"dirty":     "false",
+		"services":  "pulld.service",
+		"buildhost": "builder.example.com",
+		"goversion": "go1.8.3",
+		"sha256":    hex.EncodeToString(sum[:]),
+	})
+	hashed := sha256.Sum256(p.Provenance())
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	assert.NoError(t, err)
+	p.Signature = base64.StdEncoding.EncodeToString(sig)
+	return p
+}
+
+func TestProvenance(t *testing.T) {
+	testutils.SmallTest(t)
+	p := &Package{
+		Name:      "pulld/pulld:someone@example.com:2017-06-01T12:00:00Z:abc123.deb",
+		Hash:      "abc123",
+		UserID:    "someone@example.com",
+		Built:     time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC),
+		BuildHost: "builder.example.com",
+		GoVersion: "go1.8.3",
+		SHA256:    "0123",
+		Note:      "Not part of the provenance.",
+	}
+	expect.Equal(t, `name:pulld/pulld:someone@example.com:2017-06-01T12:00:00Z:abc123.deb
+sha256:0123
+hash:abc123
+userid:someone@example.com
+datetime:2017-06-01T12:00:00Z
+buildhost:builder.example.com
+dirty:false
+goversion:go1.8.3
+`, string(p.Provenance()))
+}
+
+func TestVerify(t *testing.T) {
+	testutils.SmallTest(t)
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+
+	p := signedPackage(t, key)
+	expect.NoError(t, p.Verify(&key.PublicKey))
+	expect.Error(t, p.Verify(&otherKey.PublicKey))
+	expect.Error(t, p.Verify(nil))
+
+	p = signedPackage(t, key)
+	p.setVerification(&key.PublicKey)
+	expect.True(t, p.Verified)
+	expect.Equal(t, VERIFIED, p.Verification)
+
+	// Changing any part of the provenance invalidates the signature.
+	p = signedPackage(t, key)
+	p.Hash = "def456"
+	expect.Error(t, p.Verify(&key.PublicKey))
+
+	p = signedPackage(t, key)
+	p.Dirty = true
+	expect.Error(t, p.Verify(&key.PublicKey))
+
+	p = signedPackage(t, key)
+	p.Signature = ""
+	expect.Error(t, p.Verify(&key.PublicKey))
+
+	p = signedPackage(t, key)
+	p.Signature = "not base64!"
+	expect.Error(t, p.Verify(&key.PublicKey))
+
+	// Without a release key packages are not verified when loaded.
+	p = packageFromMetadata("pulld/pulld.deb", map[string]string{"appname": "pulld"})
+	expect.False(t, p.Verified)
+	expect.Equal(t, "", p.Verification)
+	p.setVerification(&key.PublicKey)
+	expect.False(t, p.Verified)
+	expect.Equal(t, "pulld/pulld.deb is not signed.", p.Verification)
+}
+
+func TestVerifyFile(t *testing.T) {
+	testutils.SmallTest(t)
+	dir, err := ioutil.TempDir("", "packages")
+	assert.NoError(t, err)
+	defer testutils.RemoveAll(t, dir)
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	p := signedPackage(t, key)
+
+	filename := filepath.Join(dir, "pulld.deb")
+	assert.NoError(t, ioutil.WriteFile(filename, []byte(DEB_CONTENTS), 0644))
+	expect.NoError(t, p.VerifyFile(filename))
+
+	assert.NoError(t, ioutil.WriteFile(filename, []byte("something else"), 0644))
+	expect.Error(t, p.VerifyFile(filename))
+	expect.Error(t, p.VerifyFile(filepath.Join(dir, "missing.deb")))
+}
+
+func TestParseReleaseKey(t *testing.T) {
+	testutils.SmallTest(t)
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	b, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.NoError(t, err)
+
+	parsed, err := ParseReleaseKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b}))
+	assert.NoError(t, err)
+	expect.Equal(t, key.PublicKey, *parsed)
+
+	_, err = ParseReleaseKey([]byte("not a key"))
+	expect.Error(t, err)
+}
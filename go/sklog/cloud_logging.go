@@ -11,6 +11,7 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/skia-dev/glog"
 	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
 	logging "google.golang.org/api/logging/v2beta1"
 )
 
@@ -154,7 +155,8 @@ type CloudLogger interface {
 	Flush()
 }
 
-// LogPayload represents the contents of a Log Entry with a text payload.
+// LogPayload represents the contents of a Log Entry with a text payload, or a JSON payload if it
+// has Fields.
 type LogPayload struct {
 	// Payload is the text content of the log file.
 	Payload string
@@ -165,6 +167,9 @@ type LogPayload struct {
 	// Any additional labels to be added to this Log Entry. hostname is already included.
 	// These labels can be searched on.
 	ExtraLabels map[string]string
+	// Fields are sent along with the Payload as the JSON payload of the Log Entry. See
+	// structured.go.
+	Fields Fields
 }
 
 // logsClient implements the CloudLogger interface.
@@ -216,7 +221,7 @@ func SetCloudLoggerForTesting(c CloudLogger) {
 // CloudLogError writes an error to CloudLogging if the global logger has been set.
 // Otherwise, it just prints it using glog.
 func CloudLogError(reportName string, err error) {
-	log(0, ERROR, reportName, err.Error())
+	log(0, ERROR, reportName, err.Error(), nil)
 }
 
 // See documentation on interface.
@@ -242,7 +247,14 @@ func (c *logsClient) BatchCloudLog(reportName string, payloads ...*LogPayload) {
 		for k, v := range payload.ExtraLabels {
 			labels[k] = v
 		}
-		c.payloadCh <- &logging.LogEntry{
+		// Request and trace IDs are also added as labels, since those are
+		// faster to filter on.
+		for _, k := range []string{REQUEST_ID, TRACE_ID} {
+			if v, ok := payload.Fields[k]; ok {
+				labels[k] = fmt.Sprintf("%v", v)
+			}
+		}
+		entry := &logging.LogEntry{
 			// The LogName is the second stage of grouping, after MonitoredResource name. The first
 			// part of the following string is boilerplate to tell cloud logging what project this is.
 			// The logs/reportName part basically creates a virtual log file with a given name in the
@@ -259,6 +271,18 @@ func (c *logsClient) BatchCloudLog(reportName string, payloads ...*LogPayload) {
 			Resource: c.loggingResource,
 			Severity: payload.Severity,
 		}
+		if len(payload.Fields) > 0 {
+			b, err := jsonPayload(payload.Fields, map[string]interface{}{MESSAGE: payload.Payload})
+			// Entries which are too large for a single JSON payload fall back to
+			// text, which can be split; see splitEntry.
+			if err == nil && ENTRY_SIZE_BASE+len(b) <= ENTRY_SIZE_MAX {
+				entry.TextPayload = ""
+				entry.JsonPayload = googleapi.RawMessage(b)
+			} else {
+				entry.TextPayload += fieldsString(payload.Fields)
+			}
+		}
+		c.payloadCh <- entry
 	}
 }
 
@@ -272,7 +296,7 @@ func (c *logsClient) Flush() {
 
 // entrySize returns the estimated size in bytes of the given LogEntry.
 func entrySize(e *logging.LogEntry) int {
-	return ENTRY_SIZE_BASE + len(e.TextPayload)
+	return ENTRY_SIZE_BASE + len(e.TextPayload) + len(e.JsonPayload)
 }
 
 // splitEntry splits the LogEntry into multiple, if necessary.
@@ -60,106 +60,106 @@ var (
 // and so on.
 func Debug(msg ...interface{}) {
 	sawLogWithSeverity(DEBUG)
-	log(0, DEBUG, defaultReportName, fmt.Sprint(msg...))
+	log(0, DEBUG, defaultReportName, fmt.Sprint(msg...), nil)
 }
 
 func Debugf(format string, v ...interface{}) {
 	sawLogWithSeverity(DEBUG)
-	log(0, DEBUG, defaultReportName, fmt.Sprintf(format, v...))
+	log(0, DEBUG, defaultReportName, fmt.Sprintf(format, v...), nil)
 }
 
 func DebugfWithDepth(depth int, format string, v ...interface{}) {
 	sawLogWithSeverity(DEBUG)
-	log(depth, DEBUG, defaultReportName, fmt.Sprintf(format, v...))
+	log(depth, DEBUG, defaultReportName, fmt.Sprintf(format, v...), nil)
 }
 
 func Debugln(msg ...interface{}) {
 	sawLogWithSeverity(DEBUG)
-	log(0, DEBUG, defaultReportName, fmt.Sprintln(msg...))
+	log(0, DEBUG, defaultReportName, fmt.Sprintln(msg...), nil)
 }
 func Info(msg ...interface{}) {
 	sawLogWithSeverity(INFO)
-	log(0, INFO, defaultReportName, fmt.Sprint(msg...))
+	log(0, INFO, defaultReportName, fmt.Sprint(msg...), nil)
 }
 
 func Infof(format string, v ...interface{}) {
 	sawLogWithSeverity(INFO)
-	log(0, INFO, defaultReportName, fmt.Sprintf(format, v...))
+	log(0, INFO, defaultReportName, fmt.Sprintf(format, v...), nil)
 }
 
 func InfofWithDepth(depth int, format string, v ...interface{}) {
 	sawLogWithSeverity(INFO)
-	log(depth, INFO, defaultReportName, fmt.Sprintf(format, v...))
+	log(depth, INFO, defaultReportName, fmt.Sprintf(format, v...), nil)
 }
 
 func Infoln(msg ...interface{}) {
 	sawLogWithSeverity(INFO)
-	log(0, INFO, defaultReportName, fmt.Sprintln(msg...))
+	log(0, INFO, defaultReportName, fmt.Sprintln(msg...), nil)
 }
 
 func Warning(msg ...interface{}) {
 	sawLogWithSeverity(WARNING)
-	log(0, WARNING, defaultReportName, fmt.Sprint(msg...))
+	log(0, WARNING, defaultReportName, fmt.Sprint(msg...), nil)
 }
 
 func Warningf(format string, v ...interface{}) {
 	sawLogWithSeverity(WARNING)
-	log(0, WARNING, defaultReportName, fmt.Sprintf(format, v...))
+	log(0, WARNING, defaultReportName, fmt.Sprintf(format, v...), nil)
 }
 
 func WarningfWithDepth(depth int, format string, v ...interface{}) {
 	sawLogWithSeverity(WARNING)
-	log(depth, WARNING, defaultReportName, fmt.Sprintf(format, v...))
+	log(depth, WARNING, defaultReportName, fmt.Sprintf(format, v...), nil)
 }
 
 func Warningln(msg ...interface{}) {
 	sawLogWithSeverity(WARNING)
-	log(0, WARNING, defaultReportName, fmt.Sprintln(msg...))
+	log(0, WARNING, defaultReportName, fmt.Sprintln(msg...), nil)
 }
 
 func Error(msg ...interface{}) {
 	sawLogWithSeverity(ERROR)
-	log(0, ERROR, defaultReportName, fmt.Sprint(msg...))
+	log(0, ERROR, defaultReportName, fmt.Sprint(msg...), nil)
 }
 
 func Errorf(format string, v ...interface{}) {
 	sawLogWithSeverity(ERROR)
-	log(0, ERROR, defaultReportName, fmt.Sprintf(format, v...))
+	log(0, ERROR, defaultReportName, fmt.Sprintf(format, v...), nil)
 }
 
 func ErrorfWithDepth(depth int, format string, v ...interface{}) {
 	sawLogWithSeverity(ERROR)
-	log(depth, ERROR, defaultReportName, fmt.Sprintf(format, v...))
+	log(depth, ERROR, defaultReportName, fmt.Sprintf(format, v...), nil)
 }
 
 func Errorln(msg ...interface{}) {
 	sawLogWithSeverity(ERROR)
-	log(0, ERROR, defaultReportName, fmt.Sprintln(msg...))
+	log(0, ERROR, defaultReportName, fmt.Sprintln(msg...), nil)
 }
 
 // Fatal* uses an ALERT Cloud Logging Severity and then panics, similar to glog.Fatalf()
 // In Fatal*, there is no callback to sawLogWithSeverity, as the program will soon exit
 // and the counter will be reset to 0.
 func Fatal(msg ...interface{}) {
-	log(0, ALERT, defaultReportName, fmt.Sprint(msg...))
+	log(0, ALERT, defaultReportName, fmt.Sprint(msg...), nil)
 	Flush()
 	panic(fmt.Sprint(msg...))
 }
 
 func Fatalf(format string, v ...interface{}) {
-	log(0, ALERT, defaultReportName, fmt.Sprintf(format, v...))
+	log(0, ALERT, defaultReportName, fmt.Sprintf(format, v...), nil)
 	Flush()
 	panic(fmt.Sprintf(format, v...))
 }
 
 func FatalfWithDepth(depth int, format string, v ...interface{}) {
-	log(depth, ALERT, defaultReportName, fmt.Sprintf(format, v...))
+	log(depth, ALERT, defaultReportName, fmt.Sprintf(format, v...), nil)
 	Flush()
 	panic(fmt.Sprintf(format, v...))
 }
 
 func Fatalln(msg ...interface{}) {
-	log(0, ALERT, defaultReportName, fmt.Sprintln(msg...))
+	log(0, ALERT, defaultReportName, fmt.Sprintln(msg...), nil)
 	Flush()
 	panic(fmt.Sprintln(msg...))
 }
@@ -173,22 +173,27 @@ func Flush() {
 
 // log creates a log entry.  This log entry is either sent to Cloud Logging or glog if the former is
 // not configured.  reportName is the "virtual log file" used by cloud logging.  reportName is
-// ignored by glog. Both logs include file and line information.
-func log(depthOffset int, severity, reportName, payload string) {
+// ignored by glog. Both logs include file and line information. fields, which may be nil, are
+// attached to the entry; see structured.go.
+func log(depthOffset int, severity, reportName, payload string, fields Fields) {
 	// We want to start at least 3 levels up, which is where the caller called
 	// sklog.Infof (or whatever). Otherwise, we'll be including unneeded stack lines.
 	stackDepth := 3 + depthOffset
 	stacks := CallStack(5, stackDepth)
 	prettyPayload := fmt.Sprintf("%s %v", stacks[0].String(), payload)
 	if logger == nil {
-		logToGlog(stackDepth, severity, payload)
+		// ALERT is still sent to glog after being written as JSON, so that the
+		// process dies.
+		if !logToJSON(&stacks[0], severity, payload, fields) || severity == ALERT {
+			logToGlog(stackDepth, severity, payload+fieldsString(fields))
+		}
 	} else {
 		// TODO(kjlubick): After cloud logging has baked in a while, remove the backup logs to glog
 		if severity != ALERT {
 			// ALERT, aka, Fatal* will be logged to glog after the call to CloudLog.
 			// If we called logToGlog with alert, it will die before reporting the fatal
 			// to CloudLog.
-			logToGlog(stackDepth, severity, payload)
+			logToGlog(stackDepth, severity, payload+fieldsString(fields))
 		}
 		stack := map[string]string{
 			"stacktrace_0": stacks[0].String(),
@@ -202,6 +207,7 @@ func log(depthOffset int, severity, reportName, payload string) {
 			Severity:    severity,
 			Payload:     prettyPayload,
 			ExtraLabels: stack,
+			Fields:      fields,
 		})
 	}
 }
@@ -0,0 +1,241 @@
+package sklog
+
+// Structured logging.
+//
+// A Logger carries a set of key/value Fields which are attached to every
+// entry it logs. Fields are sent to Cloud Logging as a JSON payload, written
+// as JSON lines if SetJSONOutput has been called, and otherwise appended to
+// the glog message as "key=value" pairs. Loggers may be carried in a
+// context.Context, which is how httputils.LoggingRequestResponse makes the
+// request and trace IDs of an incoming request available to its handlers:
+//
+//   sklog.FromContext(r.Context()).WithField("user", user).Infof("Triaged %d digests.", n)
+//
+// The request ID is passed on to gRPC servers by the interceptors in
+// go/grpclog.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// REQUEST_ID is the field which holds the ID of the HTTP request being
+	// handled.
+	REQUEST_ID = "request_id"
+
+	// TRACE_ID is the field which holds the Cloud Trace ID of the HTTP request
+	// being handled, if any.
+	TRACE_ID = "trace_id"
+
+	// MAX_REQUEST_ID_LENGTH is the longest request ID that is accepted from
+	// a client, see ValidRequestID.
+	MAX_REQUEST_ID_LENGTH = 64
+
+	// MESSAGE is the key of the log message in JSON output.
+	MESSAGE = "message"
+)
+
+// Fields are key/value pairs attached to a log entry. Values must be
+// marshallable to JSON.
+type Fields map[string]interface{}
+
+// contextKey is the type of the key used to store a Logger in a Context.
+type contextKey struct{}
+
+var (
+	// jsonOut, if not nil, is where log entries are written as JSON lines
+	// when Cloud Logging is not configured.
+	jsonOut   io.Writer
+	jsonOutMu sync.Mutex
+
+	// requestIDRegex matches the request IDs that are accepted from clients.
+	requestIDRegex = regexp.MustCompile(fmt.Sprintf(`^[A-Za-z0-9_-]{1,%d}$`, MAX_REQUEST_ID_LENGTH))
+)
+
+// ValidRequestID returns true if id, a request ID received from a client, may
+// be used as the REQUEST_ID of the request. Only short IDs made of letters,
+// digits, '_' and '-' are accepted, so that clients can't inject anything into
+// logs or response headers.
+func ValidRequestID(id string) bool {
+	return requestIDRegex.MatchString(id)
+}
+
+// RequestID returns the REQUEST_ID field of the Logger in ctx, or "" if it
+// has none.
+func RequestID(ctx context.Context) string {
+	id, _ := FromContext(ctx).Fields()[REQUEST_ID].(string)
+	return id
+}
+
+// SetJSONOutput causes log entries to be written to w as JSON lines instead of
+// to glog when Cloud Logging is not configured. Pass nil to return to glog.
+func SetJSONOutput(w io.Writer) {
+	jsonOutMu.Lock()
+	defer jsonOutMu.Unlock()
+	jsonOut = w
+}
+
+// Logger logs entries with a set of Fields attached. Loggers are immutable and
+// safe for concurrent use. The zero value logs without any Fields.
+type Logger struct {
+	fields Fields
+}
+
+// WithFields returns a Logger which attaches the given Fields to every entry.
+func WithFields(f Fields) *Logger {
+	return (&Logger{}).WithFields(f)
+}
+
+// WithFields returns a copy of the Logger with the given Fields added. Fields
+// with the same key replace the existing ones.
+func (l *Logger) WithFields(f Fields) *Logger {
+	fields := make(Fields, len(l.fields)+len(f))
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	for k, v := range f {
+		fields[k] = v
+	}
+	return &Logger{fields: fields}
+}
+
+// WithField returns a copy of the Logger with the given field added.
+func (l *Logger) WithField(key string, value interface{}) *Logger {
+	return l.WithFields(Fields{key: value})
+}
+
+// Fields returns a copy of the Fields attached by the Logger.
+func (l *Logger) Fields() Fields {
+	rv := make(Fields, len(l.fields))
+	for k, v := range l.fields {
+		rv[k] = v
+	}
+	return rv
+}
+
+func (l *Logger) Debug(msg ...interface{}) {
+	sawLogWithSeverity(DEBUG)
+	log(0, DEBUG, defaultReportName, fmt.Sprint(msg...), l.fields)
+}
+
+func (l *Logger) Debugf(format string, v ...interface{}) {
+	sawLogWithSeverity(DEBUG)
+	log(0, DEBUG, defaultReportName, fmt.Sprintf(format, v...), l.fields)
+}
+
+func (l *Logger) Info(msg ...interface{}) {
+	sawLogWithSeverity(INFO)
+	log(0, INFO, defaultReportName, fmt.Sprint(msg...), l.fields)
+}
+
+func (l *Logger) Infof(format string, v ...interface{}) {
+	sawLogWithSeverity(INFO)
+	log(0, INFO, defaultReportName, fmt.Sprintf(format, v...), l.fields)
+}
+
+func (l *Logger) Warning(msg ...interface{}) {
+	sawLogWithSeverity(WARNING)
+	log(0, WARNING, defaultReportName, fmt.Sprint(msg...), l.fields)
+}
+
+func (l *Logger) Warningf(format string, v ...interface{}) {
+	sawLogWithSeverity(WARNING)
+	log(0, WARNING, defaultReportName, fmt.Sprintf(format, v...), l.fields)
+}
+
+func (l *Logger) Error(msg ...interface{}) {
+	sawLogWithSeverity(ERROR)
+	log(0, ERROR, defaultReportName, fmt.Sprint(msg...), l.fields)
+}
+
+func (l *Logger) Errorf(format string, v ...interface{}) {
+	sawLogWithSeverity(ERROR)
+	log(0, ERROR, defaultReportName, fmt.Sprintf(format, v...), l.fields)
+}
+
+// NewContext returns a copy of ctx which carries the given Logger.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the Logger carried by ctx, or a Logger without any
+// Fields if there is none.
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(contextKey{}).(*Logger); ok && l != nil {
+			return l
+		}
+	}
+	return &Logger{}
+}
+
+// fieldsString returns the Fields as " key=value" pairs, sorted by key, for
+// appending to a text log message.
+func fieldsString(f Fields) string {
+	if len(f) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf(" %s=%v", k, f[k]))
+	}
+	return strings.Join(parts, "")
+}
+
+// jsonPayload returns the message and Fields as a JSON object. Values which
+// can't be marshalled to JSON are converted to strings.
+func jsonPayload(f Fields, extra map[string]interface{}) ([]byte, error) {
+	obj := make(map[string]interface{}, len(f)+len(extra))
+	for k, v := range f {
+		obj[k] = v
+	}
+	for k, v := range extra {
+		obj[k] = v
+	}
+	b, err := json.Marshal(obj)
+	if err == nil {
+		return b, nil
+	}
+	for k, v := range f {
+		obj[k] = fmt.Sprintf("%v", v)
+	}
+	return json.Marshal(obj)
+}
+
+// logToJSON writes a JSON line for the entry if SetJSONOutput has been
+// called. Returns false if JSON output is not enabled.
+func logToJSON(source *StackTrace, severity, payload string, fields Fields) bool {
+	jsonOutMu.Lock()
+	defer jsonOutMu.Unlock()
+	if jsonOut == nil {
+		return false
+	}
+	b, err := jsonPayload(fields, map[string]interface{}{
+		"time":     time.Now().UTC().Format(time.RFC3339Nano),
+		"severity": severity,
+		"source":   source.String(),
+		MESSAGE:    strings.TrimSuffix(payload, "\n"),
+	})
+	if err != nil {
+		// Fall back to glog.
+		return false
+	}
+	b = append(b, '\n')
+	if _, err := jsonOut.Write(b); err != nil {
+		return false
+	}
+	return true
+}
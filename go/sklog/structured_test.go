@@ -0,0 +1,136 @@
+package sklog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils"
+	logging "google.golang.org/api/logging/v2beta1"
+)
+
+// mockCloudLogger implements CloudLogger and records the payloads it is given.
+type mockCloudLogger struct {
+	payloads []*LogPayload
+}
+
+func (m *mockCloudLogger) CloudLog(reportName string, payload *LogPayload) {
+	m.payloads = append(m.payloads, payload)
+}
+
+func (m *mockCloudLogger) BatchCloudLog(reportName string, payloads ...*LogPayload) {
+	m.payloads = append(m.payloads, payloads...)
+}
+
+func (m *mockCloudLogger) Flush() {}
+
+func TestJSONOutput(t *testing.T) {
+	testutils.SmallTest(t)
+	var buf bytes.Buffer
+	SetJSONOutput(&buf)
+	defer SetJSONOutput(nil)
+
+	l := WithFields(Fields{REQUEST_ID: "abc", "count": 3})
+	l.WithField("user", "fred@google.com").Infof("Hello %s", "world")
+	l.Error("Oops")
+	Warningln("Plain")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 3)
+	entries := make([]map[string]interface{}, 0, len(lines))
+	for _, line := range lines {
+		e := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &e))
+		entries = append(entries, e)
+	}
+	assert.Equal(t, "Hello world", entries[0][MESSAGE])
+	assert.Equal(t, INFO, entries[0]["severity"])
+	assert.Equal(t, "abc", entries[0][REQUEST_ID])
+	assert.Equal(t, float64(3), entries[0]["count"])
+	assert.Equal(t, "fred@google.com", entries[0]["user"])
+	assert.True(t, strings.HasPrefix(entries[0]["source"].(string), "structured_test.go:"))
+
+	// WithField doesn't modify the original Logger.
+	assert.Equal(t, ERROR, entries[1]["severity"])
+	assert.Equal(t, "abc", entries[1][REQUEST_ID])
+	_, ok := entries[1]["user"]
+	assert.False(t, ok)
+
+	// Plain logs have no fields, and lose the trailing newline.
+	assert.Equal(t, "Plain", entries[2][MESSAGE])
+	_, ok = entries[2][REQUEST_ID]
+	assert.False(t, ok)
+}
+
+func TestContext(t *testing.T) {
+	testutils.SmallTest(t)
+	assert.Equal(t, Fields{}, FromContext(context.Background()).Fields())
+
+	assert.Equal(t, "", RequestID(context.Background()))
+
+	ctx := NewContext(context.Background(), WithFields(Fields{REQUEST_ID: "abc"}))
+	assert.Equal(t, Fields{REQUEST_ID: "abc"}, FromContext(ctx).Fields())
+	assert.Equal(t, "abc", RequestID(ctx))
+
+	// Fields are sent to cloud logging.
+	m := &mockCloudLogger{}
+	SetCloudLoggerForTesting(m)
+	defer SetCloudLoggerForTesting(nil)
+	FromContext(ctx).Info("Hello")
+	Info("World")
+	assert.Len(t, m.payloads, 2)
+	assert.Equal(t, Fields{REQUEST_ID: "abc"}, m.payloads[0].Fields)
+	assert.True(t, strings.HasSuffix(m.payloads[0].Payload, " Hello"))
+	assert.Nil(t, m.payloads[1].Fields)
+}
+
+func TestValidRequestID(t *testing.T) {
+	testutils.SmallTest(t)
+	assert.True(t, ValidRequestID("abc"))
+	assert.True(t, ValidRequestID("A-b_9"))
+	assert.True(t, ValidRequestID(strings.Repeat("a", MAX_REQUEST_ID_LENGTH)))
+
+	assert.False(t, ValidRequestID(""))
+	assert.False(t, ValidRequestID(strings.Repeat("a", MAX_REQUEST_ID_LENGTH+1)))
+	assert.False(t, ValidRequestID("abc def"))
+	assert.False(t, ValidRequestID("abc\nlevel=error"))
+	assert.False(t, ValidRequestID("<script>"))
+	assert.False(t, ValidRequestID("abc\u00e9"))
+}
+
+func TestFieldsString(t *testing.T) {
+	testutils.SmallTest(t)
+	assert.Equal(t, "", fieldsString(nil))
+	assert.Equal(t, " a=1 b=two", fieldsString(Fields{"b": "two", "a": 1}))
+}
+
+func TestCloudJSONPayload(t *testing.T) {
+	testutils.SmallTest(t)
+	c := &logsClient{
+		hostname:  "host",
+		payloadCh: make(chan *logging.LogEntry, 2),
+	}
+	c.BatchCloudLog("report", &LogPayload{
+		Payload:  "Hello",
+		Severity: INFO,
+		Fields:   Fields{REQUEST_ID: "abc", "n": 1},
+	}, &LogPayload{
+		Payload:  "World",
+		Severity: INFO,
+	})
+
+	e := <-c.payloadCh
+	assert.Equal(t, "", e.TextPayload)
+	assert.Equal(t, "abc", e.Labels[REQUEST_ID])
+	assert.Equal(t, "host", e.Labels["hostname"])
+	obj := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(e.JsonPayload, &obj))
+	assert.Equal(t, map[string]interface{}{MESSAGE: "Hello", REQUEST_ID: "abc", "n": float64(1)}, obj)
+
+	e = <-c.payloadCh
+	assert.Equal(t, "World", e.TextPayload)
+	assert.Nil(t, e.JsonPayload)
+}
@@ -1,6 +1,8 @@
 package swarming
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"regexp"
@@ -101,9 +103,14 @@ type ApiClient interface {
 	// information (eg. overhead) in addition to the normal task data.
 	ListTaskResults(start, end time.Time, tags []string, state string, includePerformanceStats bool) ([]*swarming.SwarmingRpcsTaskResult, error)
 
-	// CancelTask cancels the task with the given ID.
+	// CancelTask cancels the task with the given ID. Only pending tasks are
+	// cancelled; running tasks are left to finish.
 	CancelTask(id string) error
 
+	// KillTask cancels the task with the given ID, killing it if it is
+	// already running.
+	KillTask(id string) error
+
 	// TriggerTask triggers a task with the given request.
 	TriggerTask(t *swarming.SwarmingRpcsNewTaskRequest) (*swarming.SwarmingRpcsTaskRequestMetadata, error)
 
@@ -120,6 +127,7 @@ type ApiClient interface {
 }
 
 type apiClient struct {
+	c *http.Client
 	s *swarming.Service
 }
 
@@ -131,7 +139,10 @@ func NewApiClient(c *http.Client, server string) (ApiClient, error) {
 		return nil, err
 	}
 	s.BasePath = fmt.Sprintf(API_BASE_PATH_PATTERN, server)
-	return &apiClient{s}, nil
+	return &apiClient{
+		c: c,
+		s: s,
+	}, nil
 }
 
 func (c *apiClient) SwarmingService() *swarming.Service {
@@ -347,6 +358,32 @@ func (c *apiClient) CancelTask(id string) error {
 	return nil
 }
 
+func (c *apiClient) KillTask(id string) error {
+	// The generated API client doesn't support the request body of the
+	// cancel call, which is needed to kill running tasks.
+	body, err := json.Marshal(map[string]bool{"kill_running": true})
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%stask/%s/cancel", c.s.BasePath, id)
+	resp, err := c.c.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("Failed to kill task %s: %s", id, err)
+	}
+	defer util.Close(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Failed to kill task %s: status code %d", id, resp.StatusCode)
+	}
+	var res swarming.SwarmingRpcsCancelResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("Failed to decode response when killing task %s: %s", id, err)
+	}
+	if !res.Ok {
+		return fmt.Errorf("Could not kill task %s", id)
+	}
+	return nil
+}
+
 func (c *apiClient) TriggerTask(t *swarming.SwarmingRpcsNewTaskRequest) (*swarming.SwarmingRpcsTaskRequestMetadata, error) {
 	return c.s.Tasks.New(t).Do()
 }
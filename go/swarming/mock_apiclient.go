@@ -32,6 +32,20 @@ func (_m *MockApiClient) CancelTask(id string) error {
 	return r0
 }
 
+// KillTask provides a mock function with given fields: id
+func (_m *MockApiClient) KillTask(id string) error {
+	ret := _m.Called(id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // GetStdoutOfTask provides a mock function with given fields: id
 func (_m *MockApiClient) GetStdoutOfTask(id string) (*v1.SwarmingRpcsTaskOutput, error) {
 	ret := _m.Called(id)
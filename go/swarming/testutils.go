@@ -23,6 +23,9 @@ type TestClient struct {
 
 	triggerFailure map[string]bool
 	triggerMtx     sync.Mutex
+
+	killed    []string
+	killedMtx sync.Mutex
 }
 
 func NewTestClient() *TestClient {
@@ -142,6 +145,21 @@ func (c *TestClient) CancelTask(id string) error {
 	return nil
 }
 
+// KillTask records the ID of the killed task; see KilledTasks.
+func (c *TestClient) KillTask(id string) error {
+	c.killedMtx.Lock()
+	defer c.killedMtx.Unlock()
+	c.killed = append(c.killed, id)
+	return nil
+}
+
+// KilledTasks returns the IDs of the tasks passed to KillTask.
+func (c *TestClient) KilledTasks() []string {
+	c.killedMtx.Lock()
+	defer c.killedMtx.Unlock()
+	return append([]string{}, c.killed...)
+}
+
 // md5Tags returns a MD5 hash of the task tags, excluding task ID.
 func md5Tags(tags []string) string {
 	filtered := make([]string, 0, len(tags))
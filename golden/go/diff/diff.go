@@ -1,6 +1,7 @@
 package diff
 
 import (
+	"context"
 	"image"
 	"image/color"
 	"image/draw"
@@ -134,10 +135,13 @@ type DiffFn func(*image.NRGBA, *image.NRGBA) (interface{}, *image.NRGBA)
 
 // DiffStore defines an interface for a type that retrieves, stores and
 // diffs images. How it retrieves the images is up to the implementation.
+//
+// The ctx of each call carries the logger of the request being handled, see
+// sklog.FromContext, which a remote DiffStore passes on to the diff server.
 type DiffStore interface {
 	// Get returns the DiffMetrics of the provided dMain digest vs all digests
 	// specified in dRest.
-	Get(priority int64, mainDigest string, rightDigests []string) (map[string]interface{}, error)
+	Get(ctx context.Context, priority int64, mainDigest string, rightDigests []string) (map[string]interface{}, error)
 
 	// ImageHandler returns a http.Handler for the given path prefix. The caller
 	// can then serve images of the format:
@@ -147,22 +151,22 @@ type DiffStore interface {
 
 	// WarmDigest will fetch the given digests. If sync is true the call will
 	// block until all digests have been fetched or failed to fetch.
-	WarmDigests(priority int64, digests []string, sync bool)
+	WarmDigests(ctx context.Context, priority int64, digests []string, sync bool)
 
 	// WarmDiffs will calculate the difference between every digests in
 	// leftDigests and every in digests in rightDigests.
-	WarmDiffs(priority int64, leftDigests []string, rightDigests []string)
+	WarmDiffs(ctx context.Context, priority int64, leftDigests []string, rightDigests []string)
 
 	// UnavailableDigests returns map[digest]*DigestFailure which can be used
 	// to check whether a digest could not be processed and to provide details
 	// about failures.
-	UnavailableDigests() map[string]*DigestFailure
+	UnavailableDigests(ctx context.Context) map[string]*DigestFailure
 
 	// PurgeDigests removes all information related to the indicated digests
 	// (image, diffmetric) from local caches. If purgeGCS is true it will also
 	// purge the digests image from Google storage, forcing that the digest
 	// be re-uploaded by the build bots.
-	PurgeDigests(digests []string, purgeGCS bool) error
+	PurgeDigests(ctx context.Context, digests []string, purgeGCS bool) error
 }
 
 // OpenImage is a utility function that opens the specified file and returns an
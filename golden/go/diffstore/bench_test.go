@@ -1,6 +1,7 @@
 package diffstore
 
 import (
+	"context"
 	"os"
 	"sync"
 	"testing"
@@ -59,13 +60,13 @@ func BenchmarkMemDiffStore(b *testing.B) {
 
 		digests := digestSet.Keys()
 		allDigests = append(allDigests, digests)
-		diffStore.WarmDigests(diff.PRIORITY_NOW, digests, false)
+		diffStore.WarmDigests(context.Background(), diff.PRIORITY_NOW, digests, false)
 
 		wg.Add(1)
 		go func(digests []string) {
 			defer wg.Done()
 			for _, d1 := range digests {
-				_, _ = diffStore.Get(diff.PRIORITY_NOW, d1, digests)
+				_, _ = diffStore.Get(context.Background(), diff.PRIORITY_NOW, d1, digests)
 			}
 		}(digests)
 
@@ -83,7 +84,7 @@ func BenchmarkMemDiffStore(b *testing.B) {
 		go func(digests []string) {
 			defer wg.Done()
 			for _, d1 := range digests {
-				_, _ = diffStore.Get(diff.PRIORITY_NOW, d1, digests)
+				_, _ = diffStore.Get(context.Background(), diff.PRIORITY_NOW, d1, digests)
 			}
 		}(digests)
 	}
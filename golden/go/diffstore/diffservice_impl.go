@@ -32,7 +32,7 @@ func NewDiffServiceServer(diffStore diff.DiffStore, codec util.LRUCodec) DiffSer
 
 // GetDiffs wraps around the Get method of the underlying DiffStore.
 func (d *DiffServiceImpl) GetDiffs(ctx context.Context, req *GetDiffsRequest) (*GetDiffsResponse, error) {
-	diffs, err := d.diffStore.Get(req.Priority, req.MainDigest, req.RightDigests)
+	diffs, err := d.diffStore.Get(ctx, req.Priority, req.MainDigest, req.RightDigests)
 	if err != nil {
 		return nil, err
 	}
@@ -49,19 +49,19 @@ func (d *DiffServiceImpl) GetDiffs(ctx context.Context, req *GetDiffsRequest) (*
 
 // WarmDigests wraps around the WarmDigests method of the underlying DiffStore.
 func (d *DiffServiceImpl) WarmDigests(ctx context.Context, req *WarmDigestsRequest) (*Empty, error) {
-	d.diffStore.WarmDigests(req.Priority, req.Digests, req.Sync)
+	d.diffStore.WarmDigests(ctx, req.Priority, req.Digests, req.Sync)
 	return &Empty{}, nil
 }
 
 // WarmDiffs wraps around the WarmDiffs method of the underlying DiffStore.
 func (d *DiffServiceImpl) WarmDiffs(ctx context.Context, req *WarmDiffsRequest) (*Empty, error) {
-	d.diffStore.WarmDiffs(req.Priority, req.LeftDigests, req.RightDigests)
+	d.diffStore.WarmDiffs(ctx, req.Priority, req.LeftDigests, req.RightDigests)
 	return &Empty{}, nil
 }
 
 // UnavailableDigests wraps around the UnavailableDigests method of the underlying DiffStore.
 func (d *DiffServiceImpl) UnavailableDigests(ctx context.Context, req *Empty) (*UnavailableDigestsResponse, error) {
-	unavailable := d.diffStore.UnavailableDigests()
+	unavailable := d.diffStore.UnavailableDigests(ctx)
 	ret := make(map[string]*DigestFailureResponse, len(unavailable))
 	for k, failure := range unavailable {
 		ret[k] = &DigestFailureResponse{
@@ -75,7 +75,7 @@ func (d *DiffServiceImpl) UnavailableDigests(ctx context.Context, req *Empty) (*
 
 // PurgeDigests wraps around the PurgeDigests method of the underlying DiffStore.
 func (d *DiffServiceImpl) PurgeDigests(ctx context.Context, req *PurgeDigestsRequest) (*Empty, error) {
-	return &Empty{}, d.diffStore.PurgeDigests(req.Digests, req.PurgeGCS)
+	return &Empty{}, d.diffStore.PurgeDigests(ctx, req.Digests, req.PurgeGCS)
 }
 
 // Ping returns an empty message, used to test the connection.
@@ -1,6 +1,7 @@
 package diffstore
 
 import (
+	"context"
 	"fmt"
 	"image"
 	"net"
@@ -139,14 +140,14 @@ func testDiffStore(t *testing.T, tile *tiling.Tile, baseDir string, diffStore di
 
 	// Warm the digests and make sure they are in the cache.
 	digests := testDigests[0][:TEST_N_DIGESTS]
-	diffStore.WarmDigests(diff.PRIORITY_NOW, digests, false)
+	diffStore.WarmDigests(context.Background(), diff.PRIORITY_NOW, digests, false)
 	memDiffStore.imgLoader.sync()
 	for _, d := range digests {
 		assert.True(t, memDiffStore.imgLoader.IsOnDisk(d), fmt.Sprintf("Could not find '%s'", d))
 	}
 
 	// Warm the diffs and make sure they are in the cache.
-	diffStore.WarmDiffs(diff.PRIORITY_NOW, digests, digests)
+	diffStore.WarmDiffs(context.Background(), diff.PRIORITY_NOW, digests, digests)
 	memDiffStore.sync()
 
 	diffIDs := make([]string, 0, len(digests)*len(digests))
@@ -164,7 +165,7 @@ func testDiffStore(t *testing.T, tile *tiling.Tile, baseDir string, diffStore di
 	foundDiffs := make(map[string]map[string]interface{}, len(digests))
 	ti := timer.New("Get warmed diffs.")
 	for _, oneDigest := range digests {
-		found, err := diffStore.Get(diff.PRIORITY_NOW, oneDigest, digests)
+		found, err := diffStore.Get(context.Background(), diff.PRIORITY_NOW, oneDigest, digests)
 		assert.NoError(t, err)
 		foundDiffs[oneDigest] = found
 
@@ -184,7 +185,7 @@ func testDiffStore(t *testing.T, tile *tiling.Tile, baseDir string, diffStore di
 	ti = timer.New("Get cold diffs")
 	foundDiffs = make(map[string]map[string]interface{}, len(digests))
 	for _, oneDigest := range digests {
-		found, err := diffStore.Get(diff.PRIORITY_NOW, oneDigest, digests)
+		found, err := diffStore.Get(context.Background(), diff.PRIORITY_NOW, oneDigest, digests)
 		assert.NoError(t, err)
 		foundDiffs[oneDigest] = found
 	}
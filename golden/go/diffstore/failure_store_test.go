@@ -1,6 +1,7 @@
 package diffstore
 
 import (
+	"context"
 	"testing"
 
 	assert "github.com/stretchr/testify/require"
@@ -36,16 +37,16 @@ func TestFailureHandling(t *testing.T) {
 	mainDigest := validDigests[0]
 	diffDigests := append(validDigests[1:6], invalidDigest_1, invalidDigest_2)
 
-	diffs, err := diffStore.Get(diff.PRIORITY_NOW, mainDigest, diffDigests)
+	diffs, err := diffStore.Get(context.Background(), diff.PRIORITY_NOW, mainDigest, diffDigests)
 	assert.NoError(t, err)
 	assert.Equal(t, len(diffDigests)-2, len(diffs))
 
-	unavailableDigests := diffStore.UnavailableDigests()
+	unavailableDigests := diffStore.UnavailableDigests(context.Background())
 	assert.Equal(t, 2, len(unavailableDigests))
 	assert.NotNil(t, unavailableDigests[invalidDigest_1])
 	assert.NotNil(t, unavailableDigests[invalidDigest_2])
 
-	assert.NoError(t, diffStore.PurgeDigests([]string{invalidDigest_1, invalidDigest_2}, true))
-	unavailableDigests = diffStore.UnavailableDigests()
+	assert.NoError(t, diffStore.PurgeDigests(context.Background(), []string{invalidDigest_1, invalidDigest_2}, true))
+	unavailableDigests = diffStore.UnavailableDigests(context.Background())
 	assert.Equal(t, 0, len(unavailableDigests))
 }
@@ -2,6 +2,7 @@ package diffstore
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"math"
 	"net/http"
@@ -254,7 +255,7 @@ func NewMemDiffStore(client *http.Client, diffFn diff.DiffFn, baseDir string, gs
 
 // WarmDigests fetches images based on the given list of digests. It does
 // not cache the images but makes sure they are downloaded from GCS.
-func (d *MemDiffStore) WarmDigests(priority int64, digests []string, sync bool) {
+func (d *MemDiffStore) WarmDigests(ctx context.Context, priority int64, digests []string, sync bool) {
 	missingDigests := make([]string, 0, len(digests))
 	for _, digest := range digests {
 		if !d.imgLoader.IsOnDisk(digest) {
@@ -269,7 +270,7 @@ func (d *MemDiffStore) WarmDigests(priority int64, digests []string, sync bool)
 // WarmDiffs puts the diff metrics for the cross product of leftDigests x rightDigests into the cache for the
 // given diff metric and with the given priority. This means if there are multiple subsets of the digests
 // with varying priority (ignored vs "regular") we can call this multiple times.
-func (d *MemDiffStore) WarmDiffs(priority int64, leftDigests []string, rightDigests []string) {
+func (d *MemDiffStore) WarmDiffs(ctx context.Context, priority int64, leftDigests []string, rightDigests []string) {
 	priority = rtcache.PriorityTimeCombined(priority)
 	diffIDs := d.getDiffIds(leftDigests, rightDigests)
 	sklog.Infof("Warming %d diffs", len(diffIDs))
@@ -289,7 +290,7 @@ func (d *MemDiffStore) sync() {
 }
 
 // See DiffStore interface.
-func (d *MemDiffStore) Get(priority int64, mainDigest string, rightDigests []string) (map[string]interface{}, error) {
+func (d *MemDiffStore) Get(ctx context.Context, priority int64, mainDigest string, rightDigests []string) (map[string]interface{}, error) {
 	if mainDigest == "" {
 		return nil, fmt.Errorf("Received empty dMain digest.")
 	}
@@ -320,12 +321,12 @@ func (d *MemDiffStore) Get(priority int64, mainDigest string, rightDigests []str
 }
 
 // UnavailableDigests implements the DiffStore interface.
-func (m *MemDiffStore) UnavailableDigests() map[string]*diff.DigestFailure {
+func (m *MemDiffStore) UnavailableDigests(ctx context.Context) map[string]*diff.DigestFailure {
 	return m.imgLoader.failureStore.unavailableDigests()
 }
 
 // PurgeDigests implements the DiffStore interface.
-func (m *MemDiffStore) PurgeDigests(digests []string, purgeGCS bool) error {
+func (m *MemDiffStore) PurgeDigests(ctx context.Context, digests []string, purgeGCS bool) error {
 	// We remove the given digests from the various places where they might
 	// be stored. None of the purge steps should return an error if the digests
 	// related information is missing. So any error indicates a bigger problem in the
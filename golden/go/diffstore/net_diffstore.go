@@ -43,9 +43,9 @@ func NewNetDiffStore(conn *grpc.ClientConn, diffServerImageAddress string, codec
 }
 
 // Get, see the diff.DiffStore interface.
-func (n *NetDiffStore) Get(priority int64, mainDigest string, rightDigests []string) (map[string]interface{}, error) {
+func (n *NetDiffStore) Get(ctx context.Context, priority int64, mainDigest string, rightDigests []string) (map[string]interface{}, error) {
 	req := &GetDiffsRequest{Priority: priority, MainDigest: mainDigest, RightDigests: rightDigests}
-	resp, err := n.serviceClient.GetDiffs(context.Background(), req)
+	resp, err := n.serviceClient.GetDiffs(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -75,26 +75,26 @@ func (n *NetDiffStore) ImageHandler(urlPrefix string) (http.Handler, error) {
 }
 
 // WarmDigests, see the diff.DiffStore interface.
-func (n *NetDiffStore) WarmDigests(priority int64, digests []string, sync bool) {
+func (n *NetDiffStore) WarmDigests(ctx context.Context, priority int64, digests []string, sync bool) {
 	req := &WarmDigestsRequest{Priority: priority, Digests: digests, Sync: sync}
-	_, err := n.serviceClient.WarmDigests(context.Background(), req)
+	_, err := n.serviceClient.WarmDigests(ctx, req)
 	if err != nil {
 		sklog.Errorf("Error warming digests: %s", err)
 	}
 }
 
 // WarmDiffs, see the diff.DiffStore interface.
-func (n *NetDiffStore) WarmDiffs(priority int64, leftDigests []string, rightDigests []string) {
+func (n *NetDiffStore) WarmDiffs(ctx context.Context, priority int64, leftDigests []string, rightDigests []string) {
 	req := &WarmDiffsRequest{Priority: priority, LeftDigests: leftDigests, RightDigests: rightDigests}
-	_, err := n.serviceClient.WarmDiffs(context.Background(), req)
+	_, err := n.serviceClient.WarmDiffs(ctx, req)
 	if err != nil {
 		sklog.Errorf("Error warming diffs: %s", err)
 	}
 }
 
 // UnavailableDigests, see the diff.DiffStore interface.
-func (n *NetDiffStore) UnavailableDigests() map[string]*diff.DigestFailure {
-	resp, err := n.serviceClient.UnavailableDigests(context.Background(), &Empty{})
+func (n *NetDiffStore) UnavailableDigests(ctx context.Context) map[string]*diff.DigestFailure {
+	resp, err := n.serviceClient.UnavailableDigests(ctx, &Empty{})
 	if err != nil {
 		return map[string]*diff.DigestFailure{}
 	}
@@ -111,9 +111,9 @@ func (n *NetDiffStore) UnavailableDigests() map[string]*diff.DigestFailure {
 }
 
 // PurgeDigests, see the diff.DiffStore interface.
-func (n *NetDiffStore) PurgeDigests(digests []string, purgeGCS bool) error {
+func (n *NetDiffStore) PurgeDigests(ctx context.Context, digests []string, purgeGCS bool) error {
 	req := &PurgeDigestsRequest{Digests: digests, PurgeGCS: purgeGCS}
-	_, err := n.serviceClient.PurgeDigests(context.Background(), req)
+	_, err := n.serviceClient.PurgeDigests(ctx, req)
 	if err != nil {
 		return fmt.Errorf("Error purging digests: %s", err)
 	}
@@ -2,6 +2,7 @@
 package digesttools
 
 import (
+	"context"
 	"math"
 
 	"go.skia.org/infra/go/sklog"
@@ -32,7 +33,7 @@ func newClosest() *Closest {
 // If no digest of type 'label' is found then Closest.Digest is the empty string.
 func ClosestDigest(test string, digest string, exp *expstorage.Expectations, tallies tally.Tally, diffStore diff.DiffStore, label types.Label) *Closest {
 	ret := newClosest()
-	unavailableDigests := diffStore.UnavailableDigests()
+	unavailableDigests := diffStore.UnavailableDigests(context.Background())
 
 	if _, ok := unavailableDigests[digest]; ok {
 		return ret
@@ -49,7 +50,7 @@ func ClosestDigest(test string, digest string, exp *expstorage.Expectations, tal
 		return ret
 	}
 
-	if diffMetrics, err := diffStore.Get(diff.PRIORITY_NOW, digest, selected); err != nil {
+	if diffMetrics, err := diffStore.Get(context.Background(), diff.PRIORITY_NOW, digest, selected); err != nil {
 		sklog.Errorf("ClosestDigest: Failed to get diff: %s", err)
 		return ret
 	} else {
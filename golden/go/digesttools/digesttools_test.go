@@ -1,6 +1,7 @@
 package digesttools
 
 import (
+	"context"
 	"math"
 	"net/http"
 	"testing"
@@ -15,14 +16,20 @@ import (
 
 type MockDiffStore struct{}
 
-func (m MockDiffStore) ImageHandler(urlPrefix string) (http.Handler, error)                   { return nil, nil }
-func (m MockDiffStore) WarmDigests(priority int64, digests []string, sync bool)               {}
-func (m MockDiffStore) WarmDiffs(priority int64, leftDigests []string, rightDigests []string) {}
-func (m MockDiffStore) UnavailableDigests() map[string]*diff.DigestFailure                    { return nil }
-func (m MockDiffStore) PurgeDigests(digests []string, purgeGCS bool) error                    { return nil }
+func (m MockDiffStore) ImageHandler(urlPrefix string) (http.Handler, error) { return nil, nil }
+func (m MockDiffStore) WarmDigests(ctx context.Context, priority int64, digests []string, sync bool) {
+}
+func (m MockDiffStore) WarmDiffs(ctx context.Context, priority int64, leftDigests []string, rightDigests []string) {
+}
+func (m MockDiffStore) UnavailableDigests(ctx context.Context) map[string]*diff.DigestFailure {
+	return nil
+}
+func (m MockDiffStore) PurgeDigests(ctx context.Context, digests []string, purgeGCS bool) error {
+	return nil
+}
 
 // Get always finds that digest "eee" is closest to dMain.
-func (m MockDiffStore) Get(priority int64, dMain string, dRest []string) (map[string]interface{}, error) {
+func (m MockDiffStore) Get(ctx context.Context, priority int64, dMain string, dRest []string) (map[string]interface{}, error) {
 	result := map[string]interface{}{}
 	for i, d := range dRest {
 		diffPercent := float32(i + 2)
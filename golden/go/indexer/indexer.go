@@ -3,6 +3,7 @@
 package indexer
 
 import (
+	"context"
 	"net/url"
 	"sync"
 	"time"
@@ -350,7 +351,7 @@ func writeKnownHashesList(state interface{}) error {
 	// Trigger writing the hashes list.
 	go func() {
 		byTest := idx.TalliesByTest(true)
-		unavailableDigests := idx.storages.DiffStore.UnavailableDigests()
+		unavailableDigests := idx.storages.DiffStore.UnavailableDigests(context.Background())
 		// Collect all hashes in the tile that haven't been marked as unavailable yet.
 		hashes := util.StringSet{}
 		for _, test := range byTest {
@@ -363,8 +364,8 @@ func writeKnownHashesList(state interface{}) error {
 
 		// Make sure they all fetched already. This will block until all digests
 		// are on disk or have failed to load repeatedly.
-		idx.storages.DiffStore.WarmDigests(diff.PRIORITY_NOW, hashes.Keys(), true)
-		unavailableDigests = idx.storages.DiffStore.UnavailableDigests()
+		idx.storages.DiffStore.WarmDigests(context.Background(), diff.PRIORITY_NOW, hashes.Keys(), true)
+		unavailableDigests = idx.storages.DiffStore.UnavailableDigests(context.Background())
 		for h := range hashes {
 			if _, ok := unavailableDigests[h]; ok {
 				delete(hashes, h)
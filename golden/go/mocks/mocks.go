@@ -1,6 +1,7 @@
 package mocks
 
 import (
+	"context"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
@@ -31,7 +32,7 @@ func MockUrlGenerator(path string) string {
 // Mock the diffstore.
 type MockDiffStore struct{}
 
-func (m MockDiffStore) Get(priority int64, dMain string, dRest []string) (map[string]interface{}, error) {
+func (m MockDiffStore) Get(ctx context.Context, priority int64, dMain string, dRest []string) (map[string]interface{}, error) {
 	result := map[string]interface{}{}
 	for _, d := range dRest {
 		if dMain != d {
@@ -50,11 +51,17 @@ func (m MockDiffStore) Get(priority int64, dMain string, dRest []string) (map[st
 	return result, nil
 }
 
-func (m MockDiffStore) UnavailableDigests() map[string]*diff.DigestFailure                    { return nil }
-func (m MockDiffStore) PurgeDigests(digests []string, purgeGCS bool) error                    { return nil }
-func (m MockDiffStore) ImageHandler(urlPrefix string) (http.Handler, error)                   { return nil, nil }
-func (m MockDiffStore) WarmDigests(priority int64, digests []string, sync bool)               {}
-func (m MockDiffStore) WarmDiffs(priority int64, leftDigests []string, rightDigests []string) {}
+func (m MockDiffStore) UnavailableDigests(ctx context.Context) map[string]*diff.DigestFailure {
+	return nil
+}
+func (m MockDiffStore) PurgeDigests(ctx context.Context, digests []string, purgeGCS bool) error {
+	return nil
+}
+func (m MockDiffStore) ImageHandler(urlPrefix string) (http.Handler, error) { return nil, nil }
+func (m MockDiffStore) WarmDigests(ctx context.Context, priority int64, digests []string, sync bool) {
+}
+func (m MockDiffStore) WarmDiffs(ctx context.Context, priority int64, leftDigests []string, rightDigests []string) {
+}
 
 func NewMockDiffStore() diff.DiffStore {
 	return MockDiffStore{}
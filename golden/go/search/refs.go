@@ -1,6 +1,7 @@
 package search
 
 import (
+	"context"
 	"math"
 
 	"go.skia.org/infra/go/paramtools"
@@ -50,7 +51,7 @@ func NewRefDiffer(exp *expstorage.Expectations, diffStore diff.DiffStore, idx *i
 // the digests that are compared, i.e. this allows to restrict comparison
 // of gamma correct images to other digests that are also gamma correct.
 func (r *RefDiffer) GetRefDiffs(metric string, match []string, test, digest string, params paramtools.ParamSet, traces map[string]*types.GoldenTrace, includeIgnores bool) (string, map[string]*SRDiffDigest) {
-	unavailableDigests := r.diffStore.UnavailableDigests()
+	unavailableDigests := r.diffStore.UnavailableDigests(context.Background())
 	if _, ok := unavailableDigests[digest]; ok {
 		return "", nil
 	}
@@ -102,7 +103,7 @@ func (r *RefDiffer) getDigestsWithLabel(test string, match []string, params para
 
 // getClosestDiff returns the closest diff between a digest and a set of digest.
 func (r *RefDiffer) getClosestDiff(metric, digest string, compDigests []string) *SRDiffDigest {
-	diffs, err := r.diffStore.Get(diff.PRIORITY_NOW, digest, compDigests)
+	diffs, err := r.diffStore.Get(context.Background(), diff.PRIORITY_NOW, digest, compDigests)
 	if err != nil {
 		sklog.Errorf("Error diffing %s %v: %s", digest, compDigests, err)
 		return nil
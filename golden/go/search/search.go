@@ -2,6 +2,7 @@
 package search
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"net/url"
@@ -214,7 +215,7 @@ func (p DigestSlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 
 // Search returns a slice of Digests that match the input query, and the total number of Digests
 // that matched the query. It also returns a slice of Commits that were used in the calculations.
-func Search(q *Query, storages *storage.Storage, idx *indexer.SearchIndex) (*SearchResponse, error) {
+func Search(ctx context.Context, q *Query, storages *storage.Storage, idx *indexer.SearchIndex) (*SearchResponse, error) {
 	tile := idx.GetTile(q.IncludeIgnores)
 
 	e, err := storages.ExpectationsStore.Get()
@@ -226,7 +227,7 @@ func Search(q *Query, storages *storage.Storage, idx *indexer.SearchIndex) (*Sea
 	var issueResponse *IssueResponse = nil
 	var commits []*tiling.Commit = nil
 	if q.Issue != "" {
-		ret, issueResponse, err = searchByIssue(q.Issue, q, e, q.Query, storages, idx)
+		ret, issueResponse, err = searchByIssue(ctx, q.Issue, q, e, q.Query, storages, idx)
 	} else {
 		ret, commits, err = searchTile(q, e, q.Query, storages, tile, idx)
 	}
@@ -249,7 +250,7 @@ func Search(q *Query, storages *storage.Storage, idx *indexer.SearchIndex) (*Sea
 	}, nil
 }
 
-func searchByIssue(issueID string, q *Query, exp *expstorage.Expectations, parsedQuery url.Values, storages *storage.Storage, idx *indexer.SearchIndex) ([]*Digest, *IssueResponse, error) {
+func searchByIssue(ctx context.Context, issueID string, q *Query, exp *expstorage.Expectations, parsedQuery url.Values, storages *storage.Storage, idx *indexer.SearchIndex) ([]*Digest, *IssueResponse, error) {
 	issue, tile, err := storages.TrybotResults.GetIssue(issueID, q.Patchsets)
 	if err != nil {
 		return nil, nil, err
@@ -345,7 +346,7 @@ func searchByIssue(issueID string, q *Query, exp *expstorage.Expectations, parse
 	}
 	// This has priority PRIORITY_NOW because this is used in a HTTP request where
 	// the requester expects the images to be be available.
-	storages.DiffStore.WarmDigests(diff.PRIORITY_NOW, allDigests, false)
+	storages.DiffStore.WarmDigests(ctx, diff.PRIORITY_NOW, allDigests, false)
 
 	issueResponse := &IssueResponse{
 		IssueDetails:   issue,
@@ -609,9 +610,9 @@ type DigestDiff struct {
 
 // CompareDigests compares two digests that were generated by the given test. It returns
 // an instance of DigestDiff.
-func CompareDigests(test, left, right string, storages *storage.Storage, idx *indexer.SearchIndex) (*DigestDiff, error) {
+func CompareDigests(ctx context.Context, test, left, right string, storages *storage.Storage, idx *indexer.SearchIndex) (*DigestDiff, error) {
 	// Get the diff between the two digests
-	diffs, err := storages.DiffStore.Get(diff.PRIORITY_NOW, left, []string{right})
+	diffs, err := storages.DiffStore.Get(ctx, diff.PRIORITY_NOW, left, []string{right})
 	if err != nil {
 		return nil, err
 	}
@@ -1055,7 +1056,7 @@ func (c *ctRowSlice) Swap(i, j int)      { c.data[i], c.data[j] = c.data[j], c.d
 //    diffMetric: id of the diffmetric to use (assumed to be defined in the diff package).
 //    limit: is the maximum number of diffs to return after the sort.
 func getDiffs(diffStore diff.DiffStore, digest string, colDigests []string, sortDir, diffMetric string, limit int32) ([]*CTDiffMetrics, int, error) {
-	diffMap, err := diffStore.Get(diff.PRIORITY_NOW, digest, colDigests)
+	diffMap, err := diffStore.Get(context.Background(), diff.PRIORITY_NOW, digest, colDigests)
 	if err != nil {
 		return nil, 0, err
 	}
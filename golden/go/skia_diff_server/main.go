@@ -10,6 +10,7 @@ import (
 
 	"go.skia.org/infra/go/auth"
 	"go.skia.org/infra/go/common"
+	"go.skia.org/infra/go/grpclog"
 	"go.skia.org/infra/go/skiaversion"
 	"go.skia.org/infra/go/sklog"
 	"go.skia.org/infra/golden/go/diff"
@@ -79,6 +80,7 @@ func main() {
 	codec := diffstore.MetricMapCodec{}
 	serverImpl := diffstore.NewDiffServiceServer(memDiffStore, codec)
 	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(grpclog.UnaryServerInterceptor),
 		grpc.MaxRecvMsgSize(diffstore.MAX_MESSAGE_SIZE),
 		grpc.MaxSendMsgSize(diffstore.MAX_MESSAGE_SIZE))
 	diffstore.RegisterDiffServiceServer(grpcServer, serverImpl)
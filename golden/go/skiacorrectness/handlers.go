@@ -218,7 +218,7 @@ func jsonSearchHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	searchResponse, err := search.Search(&query, storages, ixr.GetIndex())
+	searchResponse, err := search.Search(r.Context(), &query, storages, ixr.GetIndex())
 	if err != nil {
 		httputils.ReportError(w, r, err, "Search for digests failed.")
 		return
@@ -329,7 +329,7 @@ func jsonDiffHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ret, err := search.CompareDigests(test, left, right, storages, ixr.GetIndex())
+	ret, err := search.CompareDigests(r.Context(), test, left, right, storages, ixr.GetIndex())
 	if err != nil {
 		httputils.ReportError(w, r, err, "Unable to compare digests")
 		return
@@ -367,10 +367,6 @@ func jsonIgnoresHandler(w http.ResponseWriter, r *http.Request) {
 // jsonIgnoresUpdateHandler updates an existing ignores rule.
 func jsonIgnoresUpdateHandler(w http.ResponseWriter, r *http.Request) {
 	user := login.LoggedInAs(r)
-	if user == "" {
-		httputils.ReportError(w, r, fmt.Errorf("Not logged in."), "You must be logged in to update an ignore rule.")
-		return
-	}
 	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 0)
 	if err != nil {
 		httputils.ReportError(w, r, err, "ID must be valid integer.")
@@ -410,10 +406,6 @@ func jsonIgnoresUpdateHandler(w http.ResponseWriter, r *http.Request) {
 // jsonIgnoresDeleteHandler deletes an existing ignores rule.
 func jsonIgnoresDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	user := login.LoggedInAs(r)
-	if user == "" {
-		httputils.ReportError(w, r, fmt.Errorf("Not logged in."), "You must be logged in to add an ignore rule.")
-		return
-	}
 	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 0)
 	if err != nil {
 		httputils.ReportError(w, r, err, "ID must be valid integer.")
@@ -431,10 +423,6 @@ func jsonIgnoresDeleteHandler(w http.ResponseWriter, r *http.Request) {
 // jsonIgnoresAddHandler is for adding a new ignore rule.
 func jsonIgnoresAddHandler(w http.ResponseWriter, r *http.Request) {
 	user := login.LoggedInAs(r)
-	if user == "" {
-		httputils.ReportError(w, r, fmt.Errorf("Not logged in."), "You must be logged in to add an ignore rule.")
-		return
-	}
 	req := &IgnoresRequest{}
 	if err := parseJson(r, req); err != nil {
 		httputils.ReportError(w, r, err, "Failed to parse submitted data.")
@@ -486,17 +474,14 @@ type TriageRequest struct {
 // the expectations.
 func jsonTriageHandler(w http.ResponseWriter, r *http.Request) {
 	user := login.LoggedInAs(r)
-	if user == "" {
-		httputils.ReportError(w, r, fmt.Errorf("Not logged in."), "You must be logged in to triage.")
-		return
-	}
+	logger := sklog.FromContext(r.Context()).WithField("user", user)
 
 	req := &TriageRequest{}
 	if err := parseJson(r, req); err != nil {
 		httputils.ReportError(w, r, err, "Failed to parse JSON request.")
 		return
 	}
-	sklog.Infof("Triage request: %#v", req)
+	logger.WithField("test", req.Test).Infof("Triage request: %#v", req)
 
 	var tc map[string]types.TestClassification
 
@@ -543,11 +528,12 @@ func jsonTriageHandler(w http.ResponseWriter, r *http.Request) {
 		httputils.ReportError(w, r, err, "Failed to store the updated expectations.")
 		return
 	}
+	logger.Infof("Triaged digests of %d tests.", len(tc))
 
 	w.Header().Set("Content-Type", "application/json")
 	enc := json.NewEncoder(w)
 	if err := enc.Encode(map[string]string{}); err != nil {
-		sklog.Errorf("Failed to write or encode result: %s", err)
+		logger.Errorf("Failed to write or encode result: %s", err)
 	}
 }
 
@@ -625,7 +611,7 @@ func jsonClusterDiffHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	idx := ixr.GetIndex()
-	searchResponse, err := search.Search(&q, storages, ixr.GetIndex())
+	searchResponse, err := search.Search(r.Context(), &q, storages, ixr.GetIndex())
 	if err != nil {
 		httputils.ReportError(w, r, err, "Search for digests failed.")
 		return
@@ -657,7 +643,7 @@ func jsonClusterDiffHandler(w http.ResponseWriter, r *http.Request) {
 			Status: d.Status,
 		})
 		remaining := digests[i:]
-		diffs, err := storages.DiffStore.Get(diff.PRIORITY_NOW, d.Digest, remaining)
+		diffs, err := storages.DiffStore.Get(r.Context(), diff.PRIORITY_NOW, d.Digest, remaining)
 		if err != nil {
 			sklog.Errorf("Failed to calculate differences: %s", err)
 			continue
@@ -816,7 +802,7 @@ type FailureList struct {
 
 // jsonListFailureHandler returns the digests that have failed to load.
 func jsonListFailureHandler(w http.ResponseWriter, r *http.Request) {
-	unavailable := storages.DiffStore.UnavailableDigests()
+	unavailable := storages.DiffStore.UnavailableDigests(r.Context())
 	ret := FailureList{
 		DigestFailures: make([]*diff.DigestFailure, 0, len(unavailable)),
 		Count:          len(unavailable),
@@ -855,12 +841,6 @@ func jsonClearDigests(w http.ResponseWriter, r *http.Request) {
 // purgeDigests removes digests from the local cache and from GS if a query argument is set.
 // Returns true if there was no error sent to the response writer.
 func purgeDigests(w http.ResponseWriter, r *http.Request) bool {
-	user := login.LoggedInAs(r)
-	if user == "" {
-		httputils.ReportError(w, r, fmt.Errorf("Not logged in."), "You must be logged in to clear digests.")
-		return false
-	}
-
 	digests := []string{}
 	dec := json.NewDecoder(r.Body)
 	if err := dec.Decode(&digests); err != nil {
@@ -869,7 +849,7 @@ func purgeDigests(w http.ResponseWriter, r *http.Request) bool {
 	}
 	purgeGCS := r.URL.Query().Get("purge") == "true"
 
-	if err := storages.DiffStore.PurgeDigests(digests, purgeGCS); err != nil {
+	if err := storages.DiffStore.PurgeDigests(r.Context(), digests, purgeGCS); err != nil {
 		httputils.ReportError(w, r, err, "Unable to clear digests.")
 		return false
 	}
@@ -911,12 +891,8 @@ func jsonTriageLogHandler(w http.ResponseWriter, r *http.Request) {
 // If successful it retunrs the same result as a call to jsonTriageLogHandler
 // to reflect the changed triagelog.
 func jsonTriageUndoHandler(w http.ResponseWriter, r *http.Request) {
-	// Get the user and make sure they are logged in.
+	// Get the user. The route requires the triager role, so they are logged in.
 	user := login.LoggedInAs(r)
-	if user == "" {
-		httputils.ReportError(w, r, fmt.Errorf("Not logged in."), "You must be logged in to change expectations.")
-		return
-	}
 
 	// Extract the id to undo.
 	changeID, err := strconv.Atoi(r.URL.Query().Get("id"))
@@ -987,7 +963,7 @@ func jsonParamsHandler(w http.ResponseWriter, r *http.Request) {
 // regardless of triage status.
 // Endpoint used by the buildbots to avoid transferring already known images.
 func textAllHashesHandler(w http.ResponseWriter, r *http.Request) {
-	unavailableDigests := storages.DiffStore.UnavailableDigests()
+	unavailableDigests := storages.DiffStore.UnavailableDigests(r.Context())
 
 	idx := ixr.GetIndex()
 	byTest := idx.TalliesByTest(true)
@@ -20,6 +20,7 @@ import (
 	"go.skia.org/infra/go/eventbus"
 	"go.skia.org/infra/go/gerrit"
 	"go.skia.org/infra/go/git/gitinfo"
+	"go.skia.org/infra/go/grpclog"
 	"go.skia.org/infra/go/httputils"
 	"go.skia.org/infra/go/issues"
 	"go.skia.org/infra/go/login"
@@ -71,6 +72,7 @@ var (
 	redirectURL         = flag.String("redirect_url", "https://gold.skia.org/oauth2callback/", "OAuth2 redirect url. Only used when local=false.")
 	resourcesDir        = flag.String("resources_dir", "", "The directory to find templates, JS, and CSS files. If blank the directory relative to the source code files will be used.")
 	rietveldURL         = flag.String("rietveld_url", "https://codereview.chromium.org/", "URL of the Rietveld instance where we retrieve CL metadata.")
+	rolesConfig         = flag.String("roles_config", "", "JSON file which assigns roles to users and groups, see go/login/roles.go. If blank, every logged in user may triage and edit ignores.")
 	gerritURL           = flag.String("gerrit_url", gerrit.GERRIT_SKIA_URL, "URL of the Gerrit instance where we retrieve CL metadata.")
 	storageDir          = flag.String("storage_dir", "/tmp/gold-storage", "Directory to store reproducible application data.")
 	gitRepoDir          = flag.String("git_repo_dir", "../../../skia", "Directory location for the Skia repo.")
@@ -171,6 +173,9 @@ func main() {
 	if err := login.Init(useRedirectURL, authWhiteList); err != nil {
 		sklog.Fatalf("Failed to initialize the login system: %s", err)
 	}
+	if err := login.InitRoles(*rolesConfig, login.DEFAULT_ROLES); err != nil {
+		sklog.Fatalf("Failed to initialize roles: %s", err)
+	}
 
 	// Get the client to be used to access GCS and the Monorail issue tracker.
 	client, err := auth.NewJWTServiceAccountClient("", *serviceAccountFile, nil, gstorage.CloudPlatformScope, "https://www.googleapis.com/auth/userinfo.email")
@@ -185,6 +190,7 @@ func main() {
 		// Create the client connection and connect to the server.
 		conn, err := grpc.Dial(*diffServerGRPCAddr,
 			grpc.WithInsecure(),
+			grpc.WithUnaryInterceptor(grpclog.UnaryClientInterceptor),
 			grpc.WithDefaultCallOptions(
 				grpc.MaxCallSendMsgSize(diffstore.MAX_MESSAGE_SIZE),
 				grpc.MaxCallRecvMsgSize(diffstore.MAX_MESSAGE_SIZE)))
@@ -331,18 +337,18 @@ func main() {
 	router.HandleFunc("/json/diff", jsonDiffHandler).Methods("GET")
 	router.HandleFunc("/json/details", jsonDetailsHandler).Methods("GET")
 	router.HandleFunc("/json/ignores", jsonIgnoresHandler).Methods("GET")
-	router.HandleFunc("/json/ignores/add/", jsonIgnoresAddHandler).Methods("POST")
-	router.HandleFunc("/json/ignores/del/{id}", jsonIgnoresDeleteHandler).Methods("POST")
-	router.HandleFunc("/json/ignores/save/{id}", jsonIgnoresUpdateHandler).Methods("POST")
-	router.HandleFunc("/json/triage", jsonTriageHandler).Methods("POST")
+	router.HandleFunc("/json/ignores/add/", login.RequireRole(login.ROLE_EDITOR, jsonIgnoresAddHandler)).Methods("POST")
+	router.HandleFunc("/json/ignores/del/{id}", login.RequireRole(login.ROLE_EDITOR, jsonIgnoresDeleteHandler)).Methods("POST")
+	router.HandleFunc("/json/ignores/save/{id}", login.RequireRole(login.ROLE_EDITOR, jsonIgnoresUpdateHandler)).Methods("POST")
+	router.HandleFunc("/json/triage", login.RequireRole(login.ROLE_TRIAGER, jsonTriageHandler)).Methods("POST")
 	router.HandleFunc("/json/clusterdiff", jsonClusterDiffHandler).Methods("GET")
 	router.HandleFunc("/json/cmp", jsonCompareTestHandler).Methods("POST")
 	router.HandleFunc("/json/triagelog", jsonTriageLogHandler).Methods("GET")
-	router.HandleFunc("/json/triagelog/undo", jsonTriageUndoHandler).Methods("POST")
+	router.HandleFunc("/json/triagelog/undo", login.RequireRole(login.ROLE_TRIAGER, jsonTriageUndoHandler)).Methods("POST")
 	router.HandleFunc("/json/trybot", jsonListTrybotsHandler).Methods("GET")
 	router.HandleFunc("/json/failure", jsonListFailureHandler).Methods("GET")
-	router.HandleFunc("/json/failure/clear", jsonClearFailureHandler).Methods("POST")
-	router.HandleFunc("/json/cleardigests", jsonClearDigests).Methods("POST")
+	router.HandleFunc("/json/failure/clear", login.RequireRole(login.ROLE_EDITOR, jsonClearFailureHandler)).Methods("POST")
+	router.HandleFunc("/json/cleardigests", login.RequireRole(login.ROLE_EDITOR, jsonClearDigests)).Methods("POST")
 
 	// New endpoints
 	router.HandleFunc("/json/newsearch", jsonNewSearchHandler).Methods("GET")
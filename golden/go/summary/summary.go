@@ -2,6 +2,7 @@
 package summary
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"sort"
@@ -351,7 +352,7 @@ func diameter(digests []string, diffStore diff.DiffStore) int {
 		wg.Add(1)
 		go func(d1 string, d2 []string) {
 			defer wg.Done()
-			dms, err := diffStore.Get(diff.PRIORITY_NOW, d1, d2)
+			dms, err := diffStore.Get(context.Background(), diff.PRIORITY_NOW, d1, d2)
 			if err != nil {
 				sklog.Errorf("Unable to get diff: %s", err)
 				return
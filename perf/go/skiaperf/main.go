@@ -97,6 +97,7 @@ var (
 	ptraceStoreDir        = flag.String("ptrace_store_dir", "/tmp/ptracestore", "The directory where the ptracestore tiles are stored.")
 	radius                = flag.Int("radius", 7, "The number of commits to include on either side of a commit when clustering.")
 	resourcesDir          = flag.String("resources_dir", "", "The directory to find templates, JS, and CSS files. If blank the current directory will be used.")
+	rolesConfig           = flag.String("roles_config", "", "JSON file which assigns roles to users and groups, see go/login/roles.go. If blank, every logged in user may triage and edit alerts.")
 	stepUpOnly            = flag.Bool("step_up_only", false, "Only regressions that look like a step up will be reported.")
 	subdomain             = flag.String("subdomain", "perf", "The public subdomain of the server, i.e. 'perf' for perf.skia.org.")
 )
@@ -754,10 +755,6 @@ type TriageResponse struct {
 // If succesful it returns a 200, or an HTTP status code of 500 otherwise.
 func triageHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	if login.LoggedInAs(r) == "" {
-		httputils.ReportError(w, r, fmt.Errorf("Not logged in."), "You must be logged in to triage.")
-		return
-	}
 	tr := &TriageRequest{}
 	if err := json.NewDecoder(r.Body).Decode(tr); err != nil {
 		httputils.ReportError(w, r, err, "Failed to decode JSON.")
@@ -1104,10 +1101,6 @@ func alertNewHandler(w http.ResponseWriter, r *http.Request) {
 
 func alertUpdateHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	if login.LoggedInAs(r) == "" {
-		httputils.ReportError(w, r, fmt.Errorf("Not logged in."), "You must be logged in to edit alerts.")
-		return
-	}
 
 	cfg := &alerts.Config{}
 	if err := json.NewDecoder(r.Body).Decode(cfg); err != nil {
@@ -1133,10 +1126,6 @@ func alertUpdateHandler(w http.ResponseWriter, r *http.Request) {
 
 func alertDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	if login.LoggedInAs(r) == "" {
-		httputils.ReportError(w, r, fmt.Errorf("Not logged in."), "You must be logged in to delete alerts.")
-		return
-	}
 
 	sid := mux.Vars(r)["id"]
 	id, err := strconv.ParseInt(sid, 10, 64)
@@ -1167,10 +1156,6 @@ type TryBugResponse struct {
 
 func alertBugTryHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	if login.LoggedInAs(r) == "" {
-		httputils.ReportError(w, r, fmt.Errorf("Not logged in."), "You must be logged in to test alerts.")
-		return
-	}
 
 	req := &TryBugRequest{}
 	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
@@ -1187,10 +1172,6 @@ func alertBugTryHandler(w http.ResponseWriter, r *http.Request) {
 
 func alertNotifyTryHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	if login.LoggedInAs(r) == "" {
-		httputils.ReportError(w, r, fmt.Errorf("Not logged in."), "You must be logged in to try alerts.")
-		return
-	}
 
 	req := &alerts.Config{}
 	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
@@ -1284,6 +1265,9 @@ func main() {
 	}
 
 	login.SimpleInitMust(*port, *local)
+	if err := login.InitRoles(*rolesConfig, login.DEFAULT_ROLES); err != nil {
+		sklog.Fatal(err)
+	}
 
 	// Resources are served directly.
 	router := mux.NewRouter()
@@ -1320,16 +1304,16 @@ func main() {
 	router.HandleFunc("/_/cluster/status/{id:[a-zA-Z0-9]+}", clusterStatusHandler).Methods("GET")
 	router.HandleFunc("/_/reg/", regressionRangeHandler).Methods("POST")
 	router.HandleFunc("/_/reg/current", regressionCurrentHandler).Methods("GET")
-	router.HandleFunc("/_/triage/", triageHandler).Methods("POST")
+	router.HandleFunc("/_/triage/", login.RequireRole(login.ROLE_TRIAGER, triageHandler)).Methods("POST")
 	router.HandleFunc("/_/alerts/", alertsHandler)
 	router.HandleFunc("/_/details/", detailsHandler).Methods("POST")
 	router.HandleFunc("/_/shift/", shiftHandler).Methods("POST")
 	router.HandleFunc("/_/alert/list/{show}", alertListHandler).Methods("GET")
 	router.HandleFunc("/_/alert/new", alertNewHandler).Methods("GET")
-	router.HandleFunc("/_/alert/update", alertUpdateHandler).Methods("POST")
-	router.HandleFunc("/_/alert/delete/{id:[0-9]+}", alertDeleteHandler).Methods("POST")
-	router.HandleFunc("/_/alert/bug/try", alertBugTryHandler).Methods("POST")
-	router.HandleFunc("/_/alert/notify/try", alertNotifyTryHandler).Methods("POST")
+	router.HandleFunc("/_/alert/update", login.RequireRole(login.ROLE_EDITOR, alertUpdateHandler)).Methods("POST")
+	router.HandleFunc("/_/alert/delete/{id:[0-9]+}", login.RequireRole(login.ROLE_EDITOR, alertDeleteHandler)).Methods("POST")
+	router.HandleFunc("/_/alert/bug/try", login.RequireRole(login.ROLE_EDITOR, alertBugTryHandler)).Methods("POST")
+	router.HandleFunc("/_/alert/notify/try", login.RequireRole(login.ROLE_EDITOR, alertNotifyTryHandler)).Methods("POST")
 
 	var h http.Handler = router
 	if *internalOnly {
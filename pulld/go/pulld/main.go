@@ -51,6 +51,8 @@ var (
 	resourcesDir          = flag.String("resources_dir", "", "The directory to find templates, JS, and CSS files. If blank the current directory will be used.")
 	serviceAccountPath    = flag.String("service_account_path", "", "Path to the service account.  Can be empty string to use defaults or project metadata")
 	pullPeriod            = flag.Duration("pull_period", 5*time.Minute, "How often to check the configuration. On GCE, the metadata update will likely happen first")
+	production            = flag.Bool("production", false, "Only install release packages that are signed with the release key and built from a clean tree. Always true on GCE instances with the push_production metadata set to true.")
+	releaseKeyFile        = flag.String("release_key_file", "", "Path to the PEM encoded public key that release packages are verified with. If blank the push_release_key project metadata is used on GCE.")
 )
 
 type UnitStatusSlice []*systemd.UnitStatus
@@ -276,6 +278,24 @@ func listHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// installedHandler returns the list of packages this server has installed, so
+// that push can tell when a rollout has reached the server.
+func installedHandler(w http.ResponseWriter, r *http.Request) {
+	installed, err := packages.FromLocalFile(*installedPackagesFile)
+	if err != nil {
+		httputils.ReportError(w, r, err, "Failed to read installed packages.")
+		return
+	}
+	if installed == nil {
+		installed = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(installed); err != nil {
+		sklog.Errorf("Failed to write or encode output: %s", err)
+	}
+}
+
 // IndexBody is the context for evaluating the index.html template.
 type IndexBody struct {
 	Hostname string
@@ -328,6 +348,7 @@ func main() {
 	r.PathPrefix("/res/").HandlerFunc(httputils.MakeResourceHandler(*resourcesDir))
 	r.HandleFunc("/", mainHandler).Methods("GET")
 	r.HandleFunc("/_/list", listHandler).Methods("GET")
+	r.HandleFunc("/_/installed", installedHandler).Methods("GET")
 	r.HandleFunc("/_/change", changeHandler).Methods("POST")
 	http.Handle("/", httputils.LoggingGzipRequestResponse(r))
 	sklog.Infoln("Ready to serve.")
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"crypto/rsa"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"strings"
@@ -8,6 +11,7 @@ import (
 
 	"go.skia.org/infra/go/auth"
 	"go.skia.org/infra/go/httputils"
+	"go.skia.org/infra/go/metadata"
 	"go.skia.org/infra/go/metrics2"
 	"go.skia.org/infra/go/packages"
 	"go.skia.org/infra/go/sklog"
@@ -21,7 +25,16 @@ var (
 
 	store *storage.Service
 
-	failedInstallCounter = metrics2.GetCounter("pulld_failed_install", nil)
+	// isProduction is true if only verified release packages may be installed.
+	isProduction = false
+
+	// releaseKey is the key release packages are verified with on production
+	// servers. nil if it couldn't be loaded, in which case nothing is
+	// installed on production servers.
+	releaseKey *rsa.PublicKey
+
+	failedInstallCounter  = metrics2.GetCounter("pulld_failed_install", nil)
+	refusedInstallCounter = metrics2.GetCounter("pulld_refused_install", nil)
 )
 
 // differences returns all strings that appear in server but not local.
@@ -62,13 +75,26 @@ func step(client *http.Client, store *storage.Service, hostname string) {
 		if len(strings.Split(name, "/")) == 1 {
 			continue
 		}
+		var key *rsa.PublicKey
+		if isProduction {
+			if releaseKey == nil {
+				refusedInstallCounter.Inc(1)
+				sklog.Errorf("Refusing to install package %s: no release key to verify it with.", name)
+				continue
+			}
+			key = releaseKey
+		}
 		installed = append(installed, name)
 		if err := packages.ToLocalFile(installed, *installedPackagesFile); err != nil {
 			sklog.Errorf("Failed to write local package list: %s", err)
 			continue
 		}
-		if err := packages.Install(client, store, name); err != nil {
-			failedInstallCounter.Inc(1)
+		if err := packages.Install(client, store, name, key); err != nil {
+			if _, ok := err.(*packages.VerifyError); ok {
+				refusedInstallCounter.Inc(1)
+			} else {
+				failedInstallCounter.Inc(1)
+			}
 			sklog.Errorf("Failed to install package %s: %s", name, err)
 			// Pop last name from 'installed' then rewrite the file since the
 			// install failed.
@@ -126,6 +152,54 @@ func metadataWait() {
 	}
 }
 
+// loadReleaseKey loads the key release packages are verified with from
+// --release_key_file, or from the project metadata on GCE.
+func loadReleaseKey() (*rsa.PublicKey, error) {
+	var b []byte
+	if *releaseKeyFile != "" {
+		var err error
+		if b, err = ioutil.ReadFile(*releaseKeyFile); err != nil {
+			return nil, fmt.Errorf("Failed to read release key: %s", err)
+		}
+	} else if *onGCE {
+		value, err := metadata.ProjectGet(metadata.PUSH_RELEASE_KEY)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read release key from metadata: %s", err)
+		}
+		b = []byte(value)
+	} else {
+		return nil, fmt.Errorf("No --release_key_file given.")
+	}
+	return packages.ParseReleaseKey(b)
+}
+
+// verifyInit decides whether this is a production server and loads the
+// release key. If the metadata can't be read then the server is treated as
+// production, so that a metadata outage can't cause unverified packages to be
+// installed.
+func verifyInit() {
+	isProduction = *production
+	if !isProduction && *onGCE {
+		value, err := metadata.Get(metadata.PUSH_PRODUCTION)
+		if err == metadata.ErrNotFound {
+			isProduction = false
+		} else if err != nil {
+			sklog.Errorf("Failed to read %s from metadata, assuming this is a production server: %s", metadata.PUSH_PRODUCTION, err)
+			isProduction = true
+		} else {
+			isProduction = value == "true"
+		}
+	}
+	if !isProduction {
+		return
+	}
+	sklog.Info("Production server, only verified release packages will be installed.")
+	var err error
+	if releaseKey, err = loadReleaseKey(); err != nil {
+		sklog.Errorf("No packages will be installed: %s", err)
+	}
+}
+
 func pullInit(serviceAccountPath string) {
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -144,6 +218,7 @@ func pullInit(serviceAccountPath string) {
 		sklog.Fatalf("Failed to create storage service client: %s", err)
 	}
 
+	verifyInit()
 	if *onGCE {
 		go metadataWait()
 	}
@@ -2,11 +2,13 @@
 package main
 
 import (
+	"crypto/rsa"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"html/template"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"path/filepath"
 	"runtime"
@@ -21,11 +23,14 @@ import (
 	"go.skia.org/infra/go/common"
 	"go.skia.org/infra/go/httputils"
 	"go.skia.org/infra/go/login"
+	"go.skia.org/infra/go/metadata"
 	"go.skia.org/infra/go/metrics2"
 	"go.skia.org/infra/go/packages"
+	"go.skia.org/infra/go/promalertsclient"
 	"go.skia.org/infra/go/sklog"
 	"go.skia.org/infra/go/systemd"
 	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/push/go/rollout"
 	"go.skia.org/infra/push/go/trigger"
 	compute "google.golang.org/api/compute/v1"
 	storage "google.golang.org/api/storage/v1"
@@ -65,20 +70,31 @@ var (
 
 	// The current status of all the units.
 	currentStatus map[string]*systemd.UnitStatus
+
+	// rollouts runs staged rollouts and history records them.
+	rollouts *rollout.Runner
+	history  rollout.History
 )
 
 const (
-	CHAT_MSG = `%s pushed %s to %s`
+	CHAT_MSG         = `%s pushed %s to %s`
+	ROLLOUT_CHAT_MSG = `%s started rolling out %s, starting with %s`
+	ABORT_CHAT_MSG   = `%s aborted rollout %s`
+
+	// NUM_ROLLOUTS is the number of past rollouts returned by rolloutsHandler.
+	NUM_ROLLOUTS = 50
 )
 
 // flags
 var (
+	alertsEndpoint = flag.String("alerts_endpoint", "skia-prom:8001", "The Prometheus alert manager that rollouts check for alerts. If blank only systemd units are checked.")
 	bucketName     = flag.String("bucket_name", "skia-push", "The name of the Google Storage bucket that contains push packages and info.")
 	configFilename = flag.String("config_filename", "skiapush.conf", "Config filename.")
 	local          = flag.Bool("local", false, "Running locally if true. As opposed to in production.")
 	port           = flag.String("port", ":8000", "HTTP service address (e.g., ':8000')")
 	project        = flag.String("project", "google.com:skia-buildbots", "The Google Compute Engine project.")
 	promPort       = flag.String("prom_port", ":20000", "Metrics service address (e.g., ':10110')")
+	releaseKeyFile = flag.String("release_key_file", "", "Path to the PEM encoded public key that release packages are verified with. If blank the push_release_key project metadata is used.")
 	resourcesDir   = flag.String("resources_dir", "", "The directory to find templates, JS, and CSS files. If blank the current directory will be used.")
 )
 
@@ -128,23 +144,64 @@ func Init() {
 	}
 
 	packages.SetBucketName(*bucketName)
+	if key, err := loadReleaseKey(); err != nil {
+		sklog.Errorf("Packages will not be verified: %s", err)
+	} else {
+		packages.SetReleaseKey(key)
+	}
 	packageInfo, err = packages.NewAllInfo(client, store, serverNames)
 	if err != nil {
 		sklog.Fatalf("Failed to create packages.AllInfo at startup: %s", err)
 	}
 
 	chatbot.Init("push.skia.org")
+
+	rolloutConfig, err := rollout.LoadConfig(*configFilename)
+	if err != nil {
+		sklog.Fatalf("Failed to load rollouts from config file: %s", err)
+	}
+	var alerts promalertsclient.APIClient
+	if *alertsEndpoint != "" {
+		alerts = promalertsclient.New(fastClient, *alertsEndpoint)
+	}
+	history = rollout.NewGCSHistory(client, store, *bucketName)
+	rollouts = rollout.NewRunner(rolloutConfig, pushServers{}, alerts, history)
+	if err := rollouts.Resume(); err != nil {
+		sklog.Errorf("Failed to resume rollouts: %s", err)
+	}
+}
+
+// loadReleaseKey loads the key release packages are verified with from
+// --release_key_file or the project metadata.
+func loadReleaseKey() (*rsa.PublicKey, error) {
+	var b []byte
+	if *releaseKeyFile != "" {
+		var err error
+		if b, err = ioutil.ReadFile(*releaseKeyFile); err != nil {
+			return nil, fmt.Errorf("Failed to read release key: %s", err)
+		}
+	} else {
+		value, err := metadata.ProjectGet(metadata.PUSH_RELEASE_KEY)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read release key from metadata: %s", err)
+		}
+		b = []byte(value)
+	}
+	return packages.ParseReleaseKey(b)
 }
 
-// Zones keeps track of the zone of each server.
+// Zones keeps track of the zone of each server, and which servers are marked
+// production.
 type Zones struct {
-	zone  map[string]string
-	comp  *compute.Service
-	mutex sync.Mutex
+	zone       map[string]string
+	production map[string]bool
+	comp       *compute.Service
+	mutex      sync.Mutex
 }
 
 func (i *Zones) load() error {
 	zoneMap := map[string]string{}
+	production := map[string]bool{}
 	zones, err := comp.Zones.List(*project).Do()
 	if err != nil {
 		return fmt.Errorf("Failed to list zones: %s", err)
@@ -157,19 +214,53 @@ func (i *Zones) load() error {
 		}
 		for _, item := range list.Items {
 			zoneMap[item.Name] = zone.Name
+			if item.Metadata == nil {
+				continue
+			}
+			for _, md := range item.Metadata.Items {
+				if md.Key == metadata.PUSH_PRODUCTION && md.Value != nil && *md.Value == "true" {
+					production[item.Name] = true
+				}
+			}
 		}
 	}
 	i.mutex.Lock()
 	defer i.mutex.Unlock()
 
 	i.zone = zoneMap
+	i.production = production
 	return nil
 }
 
 func (i *Zones) Zone(server string) string {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
 	return i.zone[server]
 }
 
+// Production returns true if the server is marked production.
+func (i *Zones) Production(server string) bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.production[server]
+}
+
+// checkProduction returns an error if pkg may not be pushed to server, because
+// the server is marked production and pulld would refuse to install pkg.
+func checkProduction(server, pkg string) error {
+	if !ip.Production(server) || strings.HasSuffix(pkg, "/") {
+		return nil
+	}
+	p, ok := packageInfo.AllAvailableByPackageName()[pkg]
+	if !ok {
+		return fmt.Errorf("Unknown package %s", pkg)
+	}
+	if !p.Verified {
+		return fmt.Errorf("%s is a production server and %s is not verified: %s", server, pkg, p.Verification)
+	}
+	return nil
+}
+
 func NewZones(comp *compute.Service) (*Zones, error) {
 	i := &Zones{
 		comp: comp,
@@ -188,6 +279,93 @@ func NewZones(comp *compute.Service) (*Zones, error) {
 	return i, nil
 }
 
+// installPackage replaces the package of the same app in installed, the
+// packages of server, with pkg and tells pulld on the server to install it. pkg
+// is added if the app is not installed. It returns the new list of packages of
+// the server and the package that was replaced, which is "{appname}/" if the
+// app was not installed.
+func installPackage(server, pkg string, installed *packages.Installed) ([]string, string, error) {
+	if err := checkProduction(server, pkg); err != nil {
+		return nil, "", err
+	}
+	// Find a string starting with the same appname, replace it with pkg.
+	// Leave all other package names unchanged.
+	appName := strings.Split(pkg, "/")[0]
+	previous := ""
+	newInstalled := []string{}
+	for _, name := range installed.Names {
+		if strings.Split(name, "/")[0] == appName {
+			previous = name
+			name = pkg
+		}
+		newInstalled = append(newInstalled, name)
+	}
+	if previous == "" {
+		previous = appName + "/"
+		newInstalled = append(newInstalled, pkg)
+	}
+	sklog.Infof("Updating %s with %#v giving %#v", server, pkg, newInstalled)
+	if err := packageInfo.PutInstalled(server, newInstalled, installed.Generation); err != nil {
+		return nil, "", fmt.Errorf("Failed to update %s: %s", server, err)
+	}
+	if err := trigger.ByMetadata(comp, *project, pkg, server, ip.Zone(server)); err != nil {
+		sklog.Warningf("Could not trigger package load via metadata: %s", err)
+	}
+	return newInstalled, previous, nil
+}
+
+// pushServers implements rollout.Servers by updating the installed packages of
+// servers in the same way a push from the UI does.
+type pushServers struct{}
+
+// Push implements rollout.Servers.
+func (pushServers) Push(server, pkg string) (string, error) {
+	installed, err := packages.InstalledForServer(client, store, server)
+	if err != nil {
+		return "", err
+	}
+	_, previous, err := installPackage(server, pkg, installed)
+	return previous, err
+}
+
+// Services implements rollout.Servers.
+func (pushServers) Services(pkg string) ([]string, error) {
+	if strings.HasSuffix(pkg, "/") {
+		return []string{}, nil
+	}
+	p, ok := packageInfo.AllAvailableByPackageName()[pkg]
+	if !ok {
+		return nil, fmt.Errorf("Unknown package %s", pkg)
+	}
+	return p.Services, nil
+}
+
+// Installed implements rollout.Servers.
+func (pushServers) Installed(server string) ([]string, error) {
+	resp, err := fastClient.Get(fmt.Sprintf("http://%s:10000/_/installed", server))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get installed packages of %s: %s", server, err)
+	}
+	defer util.Close(resp.Body)
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("Bad status code getting installed packages of %s: %d", server, resp.StatusCode)
+	}
+	ret := []string{}
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return nil, fmt.Errorf("Failed to decode installed packages of %s: %s", server, err)
+	}
+	return ret, nil
+}
+
+// UnitStatus implements rollout.Servers.
+func (pushServers) UnitStatus(server string) ([]*systemd.UnitStatus, error) {
+	status := getStatus(server)
+	if status == nil {
+		return nil, fmt.Errorf("Failed to get status of %s", server)
+	}
+	return status, nil
+}
+
 // ServerUI is used in ServersUI.
 type ServerUI struct {
 	// Name is the name of the server.
@@ -195,6 +373,9 @@ type ServerUI struct {
 
 	// Installed is a list of package names.
 	Installed []string
+
+	// Production is true if only verified packages can be installed.
+	Production bool
 }
 
 // ServersUI is the format for data sent to the UI as JSON.
@@ -346,30 +527,16 @@ func stateHandler(w http.ResponseWriter, r *http.Request) {
 			httputils.ReportError(w, r, fmt.Errorf("Unknown server name"), "Unknown server name")
 			return
 		} else {
-			// Find a string starting with the same appname, replace it with
-			// push.Name. Leave all other package names unchanged.
-			appName := strings.Split(push.Name, "/")[0]
-			newInstalled := []string{}
-			for _, oldName := range installedPackages.Names {
-				goodName := oldName
-				if strings.Split(oldName, "/")[0] == appName {
-					goodName = push.Name
-				}
-				newInstalled = append(newInstalled, goodName)
-			}
-			sklog.Infof("Updating %s with %#v giving %#v", push.Server, push.Name, newInstalled)
-			if err := packageInfo.PutInstalled(push.Server, newInstalled, installedPackages.Generation); err != nil {
-				httputils.ReportError(w, r, err, "Failed to update server.")
+			newInstalled, _, err := installPackage(push.Server, push.Name, installedPackages)
+			if err != nil {
+				httputils.ReportError(w, r, err, err.Error())
 				return
 			}
+			appName := strings.Split(push.Name, "/")[0]
 			body := fmt.Sprintf(CHAT_MSG, login.LoggedInAs(r), appName, push.Server)
 			if err := chatbot.Send(body, "push"); err != nil {
 				sklog.Warningf("Failed to send chat notification: %s", err)
 			}
-
-			if err := trigger.ByMetadata(comp, *project, push.Name, push.Server, ip.Zone(push.Server)); err != nil {
-				sklog.Warningf("Could not trigger package load via metadata: %s", err)
-			}
 			allInstalled[push.Server].Names = newInstalled
 		}
 	}
@@ -397,8 +564,9 @@ func serversFromAllInstalled(allInstalled map[string]*packages.Installed) Server
 	sort.Strings(names)
 	for _, name := range names {
 		servers = append(servers, &ServerUI{
-			Name:      name,
-			Installed: allInstalled[name].Names,
+			Name:       name,
+			Installed:  allInstalled[name].Names,
+			Production: ip.Production(name),
 		})
 	}
 
@@ -476,6 +644,107 @@ func changeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// rolloutHandler starts a staged rollout of a package to all the servers that
+// its app is configured for.
+//
+// The request is of the form:
+//
+//   {
+//     "name": "pull/pull:jcgregorio..."
+//   }
+//
+// The response is the new rollout.
+func rolloutHandler(w http.ResponseWriter, r *http.Request) {
+	if !login.IsAdmin(r) {
+		httputils.ReportError(w, r, nil, "You must be logged on as an admin to push.")
+		return
+	}
+	push := PushNewPackage{}
+	defer util.Close(r.Body)
+	if err := json.NewDecoder(r.Body).Decode(&push); err != nil {
+		httputils.ReportError(w, r, fmt.Errorf("Failed to decode rollout request"), "Failed to decode rollout request")
+		return
+	}
+	appName := strings.Split(push.Name, "/")[0]
+	servers := []string{}
+	for name, server := range config.Servers {
+		if util.In(appName, server.AppNames) {
+			servers = append(servers, name)
+		}
+	}
+	ro, err := rollouts.Start(push.Name, login.LoggedInAs(r), servers)
+	if err != nil {
+		httputils.ReportError(w, r, err, fmt.Sprintf("Failed to start rollout: %s", err))
+		return
+	}
+	body := fmt.Sprintf(ROLLOUT_CHAT_MSG, login.LoggedInAs(r), appName, strings.Join(ro.Stages[0].Servers, ", "))
+	if err := chatbot.Send(body, "push"); err != nil {
+		sklog.Warningf("Failed to send chat notification: %s", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ro); err != nil {
+		sklog.Errorf("Failed to write or encode output: %s", err)
+	}
+}
+
+// AbortRollout is the format of the request to abort a rollout.
+type AbortRollout struct {
+	ID string `json:"id"`
+}
+
+// abortHandler aborts a running rollout, which then rolls back all the servers
+// it reached.
+//
+// The request is of the form:
+//
+//   {
+//     "id": "20170101T000000Z-pull"
+//   }
+func abortHandler(w http.ResponseWriter, r *http.Request) {
+	if !login.IsAdmin(r) {
+		httputils.ReportError(w, r, nil, "You must be logged on as an admin to abort a rollout.")
+		return
+	}
+	abort := AbortRollout{}
+	defer util.Close(r.Body)
+	if err := json.NewDecoder(r.Body).Decode(&abort); err != nil {
+		httputils.ReportError(w, r, fmt.Errorf("Failed to decode abort request"), "Failed to decode abort request")
+		return
+	}
+	if err := rollouts.Abort(abort.ID, login.LoggedInAs(r)); err != nil {
+		httputils.ReportError(w, r, err, fmt.Sprintf("Failed to abort rollout: %s", err))
+		return
+	}
+	body := fmt.Sprintf(ABORT_CHAT_MSG, login.LoggedInAs(r), abort.ID)
+	if err := chatbot.Send(body, "push"); err != nil {
+		sklog.Warningf("Failed to send chat notification: %s", err)
+	}
+	rolloutsHandler(w, r)
+}
+
+// RolloutsUI is the format of the rollouts sent to the UI as JSON.
+type RolloutsUI struct {
+	Running []*rollout.Rollout `json:"running"`
+	History []*rollout.Rollout `json:"history"`
+}
+
+// rolloutsHandler handles the GET of the JSON for the running and most recent
+// rollouts.
+func rolloutsHandler(w http.ResponseWriter, r *http.Request) {
+	past, err := history.List(NUM_ROLLOUTS)
+	if err != nil {
+		httputils.ReportError(w, r, err, "Failed to load rollout history.")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(RolloutsUI{
+		Running: rollouts.Running(),
+		History: past,
+	}); err != nil {
+		sklog.Errorf("Failed to write or encode output: %s", err)
+	}
+}
+
 // mainHandler handles the GET of the main page.
 func mainHandler(w http.ResponseWriter, r *http.Request) {
 	if *local {
@@ -552,6 +821,9 @@ func main() {
 	r.HandleFunc("/_/change", changeHandler)
 	r.HandleFunc("/_/state", stateHandler)
 	r.HandleFunc("/_/status", statusHandler)
+	r.HandleFunc("/_/rollout", rolloutHandler).Methods("POST")
+	r.HandleFunc("/_/rollout/abort", abortHandler).Methods("POST")
+	r.HandleFunc("/_/rollouts", rolloutsHandler).Methods("GET")
 	r.HandleFunc("/loginstatus/", login.StatusHandler)
 	r.HandleFunc("/logout/", login.LogoutHandler)
 	r.HandleFunc("/oauth2callback/", login.OAuth2CallbackHandler)
@@ -0,0 +1,101 @@
+package rollout
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"go.skia.org/infra/go/gcs"
+	"go.skia.org/infra/go/util"
+	storage "google.golang.org/api/storage/v1"
+)
+
+const (
+	// HISTORY_PREFIX is where rollouts are stored in the push bucket, one JSON
+	// file per rollout.
+	HISTORY_PREFIX = "rollouts/"
+)
+
+// gcsHistory is a History stored in Google Storage.
+type gcsHistory struct {
+	client *http.Client
+	store  *storage.Service
+	bucket string
+}
+
+// NewGCSHistory returns a History that stores rollouts in
+// gs://{bucket}/rollouts/{id}.json.
+func NewGCSHistory(client *http.Client, store *storage.Service, bucket string) History {
+	return &gcsHistory{
+		client: client,
+		store:  store,
+		bucket: bucket,
+	}
+}
+
+// Put implements History.
+func (h *gcsHistory) Put(r *Rollout) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("Failed to encode rollout: %s", err)
+	}
+	if _, err := h.store.Objects.Insert(h.bucket, &storage.Object{Name: HISTORY_PREFIX + r.ID + ".json"}).Media(bytes.NewReader(b)).Do(); err != nil {
+		return fmt.Errorf("Failed to write rollout %s to Google Storage: %s", r.ID, err)
+	}
+	return nil
+}
+
+// List implements History. Rollout IDs start with their start time, so the
+// most recent rollouts have the largest names.
+func (h *gcsHistory) List(n int) ([]*Rollout, error) {
+	objs := []*storage.Object{}
+	req := h.store.Objects.List(h.bucket).Prefix(HISTORY_PREFIX)
+	for {
+		resp, err := req.Do()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list rollouts: %s", err)
+		}
+		objs = append(objs, resp.Items...)
+		if resp.NextPageToken == "" {
+			break
+		}
+		req.PageToken(resp.NextPageToken)
+	}
+	sort.Slice(objs, func(i, j int) bool { return objs[i].Name > objs[j].Name })
+	if len(objs) > n {
+		objs = objs[:n]
+	}
+
+	ret := make([]*Rollout, 0, len(objs))
+	for _, obj := range objs {
+		r, err := h.get(obj)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, r)
+	}
+	return ret, nil
+}
+
+// get reads a single rollout.
+func (h *gcsHistory) get(obj *storage.Object) (*Rollout, error) {
+	req, err := gcs.RequestForStorageURL(obj.MediaLink)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to construct request object for media: %s", err)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve rollout %s: %s", obj.Name, err)
+	}
+	defer util.Close(resp.Body)
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("Wrong status code retrieving rollout %s: %d", obj.Name, resp.StatusCode)
+	}
+	r := &Rollout{}
+	if err := json.NewDecoder(resp.Body).Decode(r); err != nil {
+		return nil, fmt.Errorf("Failed to decode rollout %s: %s", obj.Name, err)
+	}
+	return r, nil
+}
@@ -0,0 +1,721 @@
+// rollout pushes a new package to all the servers of an app in stages, starting
+// with a single canary server, and automatically reverts every server it
+// touched to its previous package if the servers are unhealthy after a stage or
+// the rollout is aborted.
+package rollout
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/prometheus/common/model"
+	"go.skia.org/infra/go/promalertsclient"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/systemd"
+	"go.skia.org/infra/go/util"
+)
+
+const (
+	// States of a Rollout.
+	STATE_RUNNING     = "running"
+	STATE_SUCCEEDED   = "succeeded"
+	STATE_ROLLED_BACK = "rolled back"
+	// STATE_FAILED means the rollout could not be rolled back completely and
+	// needs attention.
+	STATE_FAILED = "failed"
+
+	// DEFAULT_WAIT is how long the new package runs on the servers of a stage
+	// before their health is checked.
+	DEFAULT_WAIT = 10 * time.Minute
+
+	// DEFAULT_INSTALL_TIMEOUT is how long pulld has to install the new package.
+	DEFAULT_INSTALL_TIMEOUT = 15 * time.Minute
+
+	// POLL_PERIOD is how often we check whether pulld has installed the new
+	// package, and whether the rollout was aborted while waiting.
+	POLL_PERIOD = 15 * time.Second
+
+	// NUM_RESUMABLE is the number of most recent rollouts that are checked for
+	// ones that were still running when push stopped.
+	NUM_RESUMABLE = 50
+
+	// SERVER_PLACEHOLDER is replaced by the name of the server being checked in
+	// alert queries.
+	SERVER_PLACEHOLDER = "$server"
+)
+
+var (
+	// matcherRegexp parses a single label matcher of an alert query, e.g.
+	// `instance=~"skia-perf:.*"`.
+	matcherRegexp = regexp.MustCompile(`^\s*(\w+)\s*(=~|!~|!=|=)\s*"?([^"]*)"?\s*$`)
+)
+
+// AppConfig is the rollout plan of a single app. It is read from the
+// [rollouts.{appname}] sections of skiapush.conf.
+type AppConfig struct {
+	// Canary is the server the new package is pushed to first. Defaults to
+	// the first server of the app in alphabetical order.
+	Canary string
+
+	// Wait is how long the new package runs before the health of the servers
+	// is checked, e.g. "10m".
+	Wait string
+
+	// InstallTimeout is how long pulld has to install the new package, e.g.
+	// "15m".
+	InstallTimeout string
+
+	// AlertQuery is a comma separated list of label matchers, e.g.
+	// `app="skiaperf",instance=~"$server:.*"`. A stage is unhealthy if any
+	// alert that matches all of them is firing and not silenced. $server is
+	// replaced by the name of each server of the stage.
+	AlertQuery string
+
+	wait           time.Duration
+	installTimeout time.Duration
+}
+
+// Config is the rollout plans of all apps, keyed by app name.
+type Config map[string]*AppConfig
+
+// LoadConfig reads the rollout plans from the given skiapush.conf.
+func LoadConfig(filename string) (Config, error) {
+	var c struct {
+		Rollouts Config
+	}
+	if _, err := toml.DecodeFile(filename, &c); err != nil {
+		return nil, fmt.Errorf("Failed to decode rollouts config file: %s", err)
+	}
+	if c.Rollouts == nil {
+		c.Rollouts = Config{}
+	}
+	for app, cfg := range c.Rollouts {
+		if err := cfg.init(); err != nil {
+			return nil, fmt.Errorf("Invalid rollout config for %s: %s", app, err)
+		}
+	}
+	return c.Rollouts, nil
+}
+
+// init parses and validates the config.
+func (c *AppConfig) init() error {
+	var err error
+	c.wait = DEFAULT_WAIT
+	if c.Wait != "" {
+		if c.wait, err = time.ParseDuration(c.Wait); err != nil {
+			return fmt.Errorf("Invalid wait: %s", err)
+		}
+	}
+	c.installTimeout = DEFAULT_INSTALL_TIMEOUT
+	if c.InstallTimeout != "" {
+		if c.installTimeout, err = time.ParseDuration(c.InstallTimeout); err != nil {
+			return fmt.Errorf("Invalid installTimeout: %s", err)
+		}
+	}
+	_, err = parseQuery(c.AlertQuery, "")
+	return err
+}
+
+// get returns the config for the given app, or the defaults if it has none.
+func (c Config) get(app string) *AppConfig {
+	if cfg, ok := c[app]; ok {
+		return cfg
+	}
+	cfg := &AppConfig{}
+	if err := cfg.init(); err != nil {
+		sklog.Fatalf("Default rollout config is invalid: %s", err)
+	}
+	return cfg
+}
+
+// matcher matches a single label of an alert.
+type matcher struct {
+	label string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func (m *matcher) match(a promalertsclient.Alert) bool {
+	value := string(a.Labels[model.LabelName(m.label)])
+	switch m.op {
+	case "=":
+		return value == m.value
+	case "!=":
+		return value != m.value
+	case "=~":
+		return m.re.MatchString(value)
+	default:
+		return !m.re.MatchString(value)
+	}
+}
+
+// parseQuery parses an AlertQuery, replacing SERVER_PLACEHOLDER with server.
+func parseQuery(query, server string) ([]*matcher, error) {
+	ret := []*matcher{}
+	if strings.TrimSpace(query) == "" {
+		return ret, nil
+	}
+	for _, part := range strings.Split(strings.Replace(query, SERVER_PLACEHOLDER, server, -1), ",") {
+		m := matcherRegexp.FindStringSubmatch(part)
+		if m == nil {
+			return nil, fmt.Errorf("Invalid label matcher %q", part)
+		}
+		lm := &matcher{label: m[1], op: m[2], value: m[3]}
+		if lm.op == "=~" || lm.op == "!~" {
+			re, err := regexp.Compile("^(?:" + lm.value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("Invalid regexp in label matcher %q: %s", part, err)
+			}
+			lm.re = re
+		}
+		ret = append(ret, lm)
+	}
+	return ret, nil
+}
+
+// Servers is how a rollout changes and inspects the servers of an app.
+type Servers interface {
+	// Push replaces the package of the same app on the server with pkg and
+	// returns the package it replaced, which is "{appname}/" if the app was
+	// not installed. Pushing "{appname}/" uninstalls the app.
+	Push(server, pkg string) (string, error)
+
+	// Installed returns the packages that pulld has installed on the server.
+	Installed(server string) ([]string, error)
+
+	// Services returns the systemd services of pkg that must be running once
+	// it is installed. There are none for "{appname}/".
+	Services(pkg string) ([]string, error)
+
+	// UnitStatus returns the status of the push managed services on the
+	// server.
+	UnitStatus(server string) ([]*systemd.UnitStatus, error)
+}
+
+// History stores rollouts.
+type History interface {
+	// Put writes the rollout, replacing any earlier version of it.
+	Put(r *Rollout) error
+
+	// List returns up to n of the most recent rollouts, newest first.
+	List(n int) ([]*Rollout, error)
+}
+
+// Stage is a set of servers that the package is pushed to together, after which
+// their health is checked.
+type Stage struct {
+	Name     string    `json:"name"`
+	Servers  []string  `json:"servers"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+
+	// Problems explains why the servers were found unhealthy. Empty if they
+	// are healthy.
+	Problems []string `json:"problems"`
+}
+
+// Rollout is a single staged push of a package to all the servers of an app.
+type Rollout struct {
+	ID       string    `json:"id"`
+	App      string    `json:"app"`
+	Package  string    `json:"package"`
+	User     string    `json:"user"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	State    string    `json:"state"`
+	Stages   []*Stage  `json:"stages"`
+
+	// Previous is the package that was installed on each server before the
+	// rollout reached it.
+	Previous map[string]string `json:"previous"`
+
+	// Aborted is the user who aborted the rollout, if it was aborted.
+	Aborted string `json:"aborted"`
+
+	// Message describes how the rollout ended.
+	Message string `json:"message"`
+}
+
+// Runner runs rollouts, at most one per app at a time.
+type Runner struct {
+	config  Config
+	servers Servers
+	alerts  promalertsclient.APIClient
+	history History
+
+	// sleep and pollPeriod are changed in tests.
+	sleep      func(time.Duration)
+	pollPeriod time.Duration
+
+	// mutex protects running and all the Rollouts in it.
+	mutex   sync.Mutex
+	running map[string]*Rollout
+}
+
+// NewRunner creates a new Runner. alerts may be nil, in which case only the
+// systemd units of the servers are checked.
+func NewRunner(config Config, servers Servers, alerts promalertsclient.APIClient, history History) *Runner {
+	return &Runner{
+		config:     config,
+		servers:    servers,
+		alerts:     alerts,
+		history:    history,
+		sleep:      time.Sleep,
+		pollPeriod: POLL_PERIOD,
+		running:    map[string]*Rollout{},
+	}
+}
+
+// Start starts a rollout of pkg to the given servers in the background. The
+// returned Rollout must not be modified.
+func (r *Runner) Start(pkg, user string, servers []string) (*Rollout, error) {
+	if _, err := r.servers.Services(pkg); err != nil {
+		return nil, err
+	}
+	ro, err := r.plan(pkg, user, servers)
+	if err != nil {
+		return nil, err
+	}
+	go r.run(ro)
+	return r.snapshot(ro), nil
+}
+
+// Resume continues in the background the rollouts that were still running when
+// push stopped. Stages that had already finished are not repeated, and
+// rollouts that were aborted or had an unhealthy stage are rolled back.
+func (r *Runner) Resume() error {
+	unfinished, err := r.unfinished()
+	if err != nil {
+		return err
+	}
+	for _, ro := range unfinished {
+		sklog.Infof("Resuming rollout %s", ro.ID)
+		go r.run(ro)
+	}
+	return nil
+}
+
+// unfinished finds the rollouts in the history that are still running and
+// marks them as running. If there are several for the same app only the most
+// recent one is resumed, the others are marked as failed.
+func (r *Runner) unfinished() ([]*Rollout, error) {
+	past, err := r.history.List(NUM_RESUMABLE)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load rollouts to resume: %s", err)
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	ret := []*Rollout{}
+	for _, ro := range past {
+		if ro.State != STATE_RUNNING {
+			continue
+		}
+		if running, ok := r.running[ro.App]; ok {
+			ro.State = STATE_FAILED
+			ro.Message = fmt.Sprintf("Superseded by rollout %s of %s.", running.ID, ro.App)
+			ro.Finished = time.Now().UTC()
+			r.put(ro)
+			continue
+		}
+		if ro.Previous == nil {
+			ro.Previous = map[string]string{}
+		}
+		r.running[ro.App] = ro
+		ret = append(ret, ro)
+	}
+	return ret, nil
+}
+
+// Abort stops the running rollout with the given ID and rolls it back.
+func (r *Runner) Abort(id, user string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, ro := range r.running {
+		if ro.ID != id {
+			continue
+		}
+		if ro.Aborted == "" {
+			ro.Aborted = user
+			r.put(ro)
+		}
+		return nil
+	}
+	return fmt.Errorf("Rollout %s is not running.", id)
+}
+
+// abortReason returns why the rollout must stop, or "" if it wasn't aborted.
+func (r *Runner) abortReason(ro *Rollout) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if ro.Aborted == "" {
+		return ""
+	}
+	return fmt.Sprintf("Aborted by %s", ro.Aborted)
+}
+
+// Running returns copies of the rollouts that are currently running.
+func (r *Runner) Running() []*Rollout {
+	r.mutex.Lock()
+	running := make([]*Rollout, 0, len(r.running))
+	for _, ro := range r.running {
+		running = append(running, ro)
+	}
+	r.mutex.Unlock()
+
+	ret := make([]*Rollout, 0, len(running))
+	for _, ro := range running {
+		ret = append(ret, r.snapshot(ro))
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].App < ret[j].App })
+	return ret
+}
+
+// snapshot returns a deep copy of the rollout.
+func (r *Runner) snapshot(ro *Rollout) *Rollout {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	b, err := json.Marshal(ro)
+	if err != nil {
+		sklog.Errorf("Failed to encode rollout: %s", err)
+		return ro
+	}
+	ret := &Rollout{}
+	if err := json.Unmarshal(b, ret); err != nil {
+		sklog.Errorf("Failed to decode rollout: %s", err)
+		return ro
+	}
+	return ret
+}
+
+// plan creates the rollout and its stages, and marks it as running.
+func (r *Runner) plan(pkg, user string, servers []string) (*Rollout, error) {
+	app := strings.Split(pkg, "/")[0]
+	if app == "" || !strings.Contains(pkg, "/") {
+		return nil, fmt.Errorf("Not a valid package name: %q", pkg)
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("No servers to roll out %s to.", app)
+	}
+	servers = append([]string{}, servers...)
+	sort.Strings(servers)
+	canary := r.config.get(app).Canary
+	if !util.In(canary, servers) {
+		canary = servers[0]
+	}
+	rest := []string{}
+	for _, s := range servers {
+		if s != canary {
+			rest = append(rest, s)
+		}
+	}
+	now := time.Now().UTC()
+	ro := &Rollout{
+		ID:       fmt.Sprintf("%s-%s", now.Format("20060102T150405Z"), app),
+		App:      app,
+		Package:  pkg,
+		User:     user,
+		Started:  now,
+		State:    STATE_RUNNING,
+		Stages:   []*Stage{{Name: "canary", Servers: []string{canary}, Problems: []string{}}},
+		Previous: map[string]string{},
+	}
+	if len(rest) > 0 {
+		ro.Stages = append(ro.Stages, &Stage{Name: "rest", Servers: rest, Problems: []string{}})
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if running, ok := r.running[app]; ok {
+		return nil, fmt.Errorf("Rollout %s of %s is still running.", running.ID, app)
+	}
+	r.running[app] = ro
+	r.put(ro)
+	return ro, nil
+}
+
+// update applies f to the rollout and records the result.
+func (r *Runner) update(ro *Rollout, f func()) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	f()
+	r.put(ro)
+}
+
+// put records the rollout. The caller must hold the mutex.
+func (r *Runner) put(ro *Rollout) {
+	if err := r.history.Put(ro); err != nil {
+		sklog.Errorf("Failed to record rollout %s: %s", ro.ID, err)
+	}
+}
+
+// run runs the stages of the rollout one after the other, and rolls back if a
+// stage fails or the rollout is aborted.
+func (r *Runner) run(ro *Rollout) {
+	cfg := r.config.get(ro.App)
+	services, err := r.servers.Services(ro.Package)
+	if err != nil {
+		r.rollback(ro, fmt.Sprintf("Failed to get the services of %s: %s", ro.Package, err))
+		return
+	}
+	for _, stage := range ro.Stages {
+		if reason := r.abortReason(ro); reason != "" {
+			r.rollback(ro, reason)
+			return
+		}
+		// Stages that finished before push was restarted are not repeated.
+		if stage.Finished.IsZero() {
+			r.runStage(ro, stage, cfg, services)
+		}
+		if len(stage.Problems) > 0 {
+			reason := r.abortReason(ro)
+			if reason == "" {
+				reason = fmt.Sprintf("The %s stage was unhealthy", stage.Name)
+			}
+			sklog.Warningf("Rollout %s: %s: %s", ro.ID, reason, strings.Join(stage.Problems, "; "))
+			r.rollback(ro, reason)
+			return
+		}
+	}
+	if reason := r.abortReason(ro); reason != "" {
+		r.rollback(ro, reason)
+		return
+	}
+	r.finish(ro, STATE_SUCCEEDED, fmt.Sprintf("%s is running on all servers.", ro.Package))
+}
+
+// runStage pushes the package to the servers of the stage and records their
+// health.
+func (r *Runner) runStage(ro *Rollout, stage *Stage, cfg *AppConfig, services []string) {
+	r.update(ro, func() {
+		if stage.Started.IsZero() {
+			stage.Started = time.Now().UTC()
+		}
+	})
+	sklog.Infof("Rollout %s: pushing %s to %s", ro.ID, ro.Package, strings.Join(stage.Servers, ", "))
+	problems := []string{}
+	for _, server := range stage.Servers {
+		previous, err := r.servers.Push(server, ro.Package)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Failed to push to %s: %s", server, err))
+			break
+		}
+		r.update(ro, func() {
+			// A resumed stage may push to the server again, keep the package
+			// that was installed before the rollout.
+			if _, ok := ro.Previous[server]; !ok {
+				ro.Previous[server] = previous
+			}
+		})
+	}
+	if len(problems) == 0 {
+		problems = r.checkHealth(cfg, ro.Package, stage.Servers, services, func() string { return r.abortReason(ro) })
+	}
+	r.update(ro, func() {
+		stage.Finished = time.Now().UTC()
+		stage.Problems = problems
+	})
+}
+
+// isInstalled returns true if pulld has installed pkg, or has uninstalled the
+// app if pkg is "{appname}/".
+func isInstalled(pkg string, installed []string) bool {
+	if !strings.HasSuffix(pkg, "/") {
+		return util.In(pkg, installed)
+	}
+	for _, name := range installed {
+		if strings.HasPrefix(name, pkg) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkHealth waits for pulld to install pkg on all the servers, lets it run
+// for the configured time, and then returns the problems with the servers.
+// stop is checked while waiting and, if it returns a reason, checkHealth
+// returns it as the only problem. stop may be nil.
+func (r *Runner) checkHealth(cfg *AppConfig, pkg string, servers, services []string, stop func() string) []string {
+	stopped := func() string {
+		if stop == nil {
+			return ""
+		}
+		return stop()
+	}
+	deadline := time.Now().Add(cfg.installTimeout)
+	pending := servers
+	for {
+		if reason := stopped(); reason != "" {
+			return []string{reason}
+		}
+		notInstalled := []string{}
+		for _, server := range pending {
+			installed, err := r.servers.Installed(server)
+			if err != nil {
+				sklog.Warningf("Failed to get installed packages of %s: %s", server, err)
+			}
+			if err != nil || !isInstalled(pkg, installed) {
+				notInstalled = append(notInstalled, server)
+			}
+		}
+		pending = notInstalled
+		if len(pending) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			problems := []string{}
+			for _, server := range pending {
+				problems = append(problems, fmt.Sprintf("%s did not install %s within %s.", server, pkg, cfg.installTimeout))
+			}
+			return problems
+		}
+		r.sleep(r.pollPeriod)
+	}
+
+	// Let the new package run for a while before judging it.
+	for left := cfg.wait; left > 0; left -= r.pollPeriod {
+		if reason := stopped(); reason != "" {
+			return []string{reason}
+		}
+		if left < r.pollPeriod {
+			r.sleep(left)
+		} else {
+			r.sleep(r.pollPeriod)
+		}
+	}
+	if reason := stopped(); reason != "" {
+		return []string{reason}
+	}
+
+	problems := []string{}
+	for _, server := range servers {
+		problems = append(problems, r.unitProblems(server, services)...)
+		problems = append(problems, r.alertProblems(cfg, server)...)
+	}
+	return problems
+}
+
+// unitProblems returns the services that are not active on the server.
+func (r *Runner) unitProblems(server string, services []string) []string {
+	units, err := r.servers.UnitStatus(server)
+	if err != nil {
+		return []string{fmt.Sprintf("Failed to get status of services on %s: %s", server, err)}
+	}
+	problems := []string{}
+	for _, service := range services {
+		found := false
+		for _, unit := range units {
+			if unit.Status == nil || unit.Status.Name != service {
+				continue
+			}
+			found = true
+			if unit.Status.ActiveState != "active" {
+				problems = append(problems, fmt.Sprintf("%s on %s is %s (%s).", service, server, unit.Status.ActiveState, unit.Status.SubState))
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("%s is not running on %s.", service, server))
+		}
+	}
+	return problems
+}
+
+// alertProblems returns the firing alerts that match the alert query for the
+// server.
+func (r *Runner) alertProblems(cfg *AppConfig, server string) []string {
+	if r.alerts == nil || strings.TrimSpace(cfg.AlertQuery) == "" {
+		return nil
+	}
+	matchers, err := parseQuery(cfg.AlertQuery, server)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	alerts, err := r.alerts.GetAlerts(func(a promalertsclient.Alert) bool {
+		if a.Silenced || a.Resolved() {
+			return false
+		}
+		for _, m := range matchers {
+			if !m.match(a) {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return []string{fmt.Sprintf("Failed to get alerts for %s: %s", server, err)}
+	}
+	problems := []string{}
+	for _, a := range alerts {
+		problems = append(problems, fmt.Sprintf("Alert %s is firing for %s.", a.Name(), server))
+	}
+	return problems
+}
+
+// rollback reverts all servers the rollout reached to their previous packages
+// and checks that they are healthy again in the same way as after a stage.
+func (r *Runner) rollback(ro *Rollout, reason string) {
+	r.mutex.Lock()
+	previous := make(map[string]string, len(ro.Previous))
+	for server, pkg := range ro.Previous {
+		previous[server] = pkg
+	}
+	r.mutex.Unlock()
+	servers := make([]string, 0, len(previous))
+	for server := range previous {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+	if len(servers) == 0 {
+		r.finish(ro, STATE_ROLLED_BACK, fmt.Sprintf("%s; no servers needed rolling back.", reason))
+		return
+	}
+
+	problems := []string{}
+	byPackage := map[string][]string{}
+	for _, server := range servers {
+		sklog.Infof("Rollout %s: rolling back %s to %s", ro.ID, server, previous[server])
+		if _, err := r.servers.Push(server, previous[server]); err != nil {
+			problems = append(problems, fmt.Sprintf("Failed to roll back %s: %s", server, err))
+			continue
+		}
+		byPackage[previous[server]] = append(byPackage[previous[server]], server)
+	}
+	pkgs := make([]string, 0, len(byPackage))
+	for pkg := range byPackage {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+	cfg := r.config.get(ro.App)
+	for _, pkg := range pkgs {
+		services, err := r.servers.Services(pkg)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Failed to get the services of %s: %s", pkg, err))
+			continue
+		}
+		problems = append(problems, r.checkHealth(cfg, pkg, byPackage[pkg], services, nil)...)
+	}
+	if len(problems) > 0 {
+		r.finish(ro, STATE_FAILED, fmt.Sprintf("%s and rolling back failed: %s", reason, strings.Join(problems, "; ")))
+		return
+	}
+	r.finish(ro, STATE_ROLLED_BACK, fmt.Sprintf("%s; rolled back %s.", reason, strings.Join(servers, ", ")))
+}
+
+// finish records the end of the rollout and allows the next rollout of the app
+// to start.
+func (r *Runner) finish(ro *Rollout, state, message string) {
+	sklog.Infof("Rollout %s %s: %s", ro.ID, state, message)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	ro.State = state
+	ro.Message = message
+	ro.Finished = time.Now().UTC()
+	r.put(ro)
+	delete(r.running, ro.App)
+}
@@ -0,0 +1,426 @@
+package rollout
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/skia-dev/go-systemd/dbus"
+	"github.com/stretchr/testify/mock"
+	"go.skia.org/infra/go/promalertsclient"
+	"go.skia.org/infra/go/systemd"
+	"go.skia.org/infra/go/testutils"
+
+	expect "github.com/stretchr/testify/assert"
+	assert "github.com/stretchr/testify/require"
+)
+
+const (
+	OLD_PKG = "skiaperf/skiaperf:old.deb"
+	NEW_PKG = "skiaperf/skiaperf:new.deb"
+	BAD_PKG = "skiaperf/skiaperf:bad.deb"
+	// OTHER_BAD_PKG also fails to run.
+	OTHER_BAD_PKG = "skiaperf/skiaperf:bad2.deb"
+)
+
+// fakeServers runs skiaperf.service on every server, which fails on the servers
+// that have BAD_PKG or OTHER_BAD_PKG installed.
+type fakeServers struct {
+	mutex     sync.Mutex
+	current   map[string]string
+	pushes    []string
+	noInstall bool
+}
+
+func newFakeServers(servers ...string) *fakeServers {
+	f := &fakeServers{current: map[string]string{}}
+	for _, s := range servers {
+		f.current[s] = OLD_PKG
+	}
+	return f
+}
+
+func (f *fakeServers) Push(server, pkg string) (string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	previous, ok := f.current[server]
+	if !ok {
+		return "", fmt.Errorf("Unknown server %s", server)
+	}
+	f.current[server] = pkg
+	f.pushes = append(f.pushes, server+" "+pkg)
+	return previous, nil
+}
+
+func (f *fakeServers) Installed(server string) ([]string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.noInstall {
+		return []string{OLD_PKG}, nil
+	}
+	return []string{f.current[server]}, nil
+}
+
+func (f *fakeServers) Services(pkg string) ([]string, error) {
+	if strings.HasSuffix(pkg, "/") {
+		return []string{}, nil
+	}
+	return []string{"skiaperf.service"}, nil
+}
+
+func (f *fakeServers) UnitStatus(server string) ([]*systemd.UnitStatus, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	state := "active"
+	if f.current[server] == BAD_PKG || f.current[server] == OTHER_BAD_PKG {
+		state = "failed"
+	}
+	return []*systemd.UnitStatus{
+		{Status: &dbus.UnitStatus{Name: "skiaperf.service", ActiveState: state, SubState: "dead"}},
+	}, nil
+}
+
+// fakeHistory keeps the rollouts in memory.
+type fakeHistory struct {
+	mutex    sync.Mutex
+	rollouts map[string]*Rollout
+	puts     int
+}
+
+func (h *fakeHistory) Put(r *Rollout) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	c := &Rollout{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return err
+	}
+	h.rollouts[r.ID] = c
+	h.puts++
+	return nil
+}
+
+func (h *fakeHistory) List(n int) ([]*Rollout, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	ret := []*Rollout{}
+	for _, r := range h.rollouts {
+		ret = append(ret, r)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID > ret[j].ID })
+	if len(ret) > n {
+		ret = ret[:n]
+	}
+	return ret, nil
+}
+
+func newTestRunner(config Config, servers Servers, alerts promalertsclient.APIClient) (*Runner, *fakeHistory) {
+	for _, cfg := range config {
+		if err := cfg.init(); err != nil {
+			panic(err)
+		}
+	}
+	h := &fakeHistory{rollouts: map[string]*Rollout{}}
+	r := NewRunner(config, servers, alerts, h)
+	r.sleep = func(time.Duration) {}
+	r.pollPeriod = time.Minute
+	return r, h
+}
+
+// runRollout runs a rollout to completion and returns it as recorded in the
+// history.
+func runRollout(t *testing.T, r *Runner, h *fakeHistory, pkg string, servers ...string) *Rollout {
+	ro, err := r.plan(pkg, "someone@example.com", servers)
+	assert.NoError(t, err)
+	r.run(ro)
+	assert.Empty(t, r.Running())
+	return h.rollouts[ro.ID]
+}
+
+func TestRolloutSucceeds(t *testing.T) {
+	testutils.SmallTest(t)
+	s := newFakeServers("skia-perf-a", "skia-perf-b", "skia-perf-c")
+	r, h := newTestRunner(Config{"skiaperf": {Canary: "skia-perf-b"}}, s, nil)
+
+	ro := runRollout(t, r, h, NEW_PKG, "skia-perf-c", "skia-perf-a", "skia-perf-b")
+	assert.NotNil(t, ro)
+	expect.Equal(t, STATE_SUCCEEDED, ro.State)
+	expect.Equal(t, "skiaperf", ro.App)
+	expect.Equal(t, "someone@example.com", ro.User)
+	expect.False(t, ro.Finished.IsZero())
+	assert.Len(t, ro.Stages, 2)
+	expect.Equal(t, []string{"skia-perf-b"}, ro.Stages[0].Servers)
+	expect.Equal(t, []string{"skia-perf-a", "skia-perf-c"}, ro.Stages[1].Servers)
+	for _, stage := range ro.Stages {
+		expect.Empty(t, stage.Problems)
+		expect.False(t, stage.Finished.IsZero())
+	}
+	expect.Equal(t, map[string]string{"skia-perf-a": OLD_PKG, "skia-perf-b": OLD_PKG, "skia-perf-c": OLD_PKG}, ro.Previous)
+	expect.Equal(t, []string{"skia-perf-b " + NEW_PKG, "skia-perf-a " + NEW_PKG, "skia-perf-c " + NEW_PKG}, s.pushes)
+	expect.True(t, h.puts > 2)
+}
+
+func TestRolloutSingleServer(t *testing.T) {
+	testutils.SmallTest(t)
+	s := newFakeServers("skia-perf-a")
+	// The canary defaults to the first server if the configured one isn't used by the app.
+	r, h := newTestRunner(Config{"skiaperf": {Canary: "skia-perf-z"}}, s, nil)
+
+	ro := runRollout(t, r, h, NEW_PKG, "skia-perf-a")
+	expect.Equal(t, STATE_SUCCEEDED, ro.State)
+	assert.Len(t, ro.Stages, 1)
+	expect.Equal(t, []string{"skia-perf-a"}, ro.Stages[0].Servers)
+}
+
+func TestRolloutUnhealthyCanaryRollsBack(t *testing.T) {
+	testutils.SmallTest(t)
+	s := newFakeServers("skia-perf-a", "skia-perf-b")
+	r, h := newTestRunner(Config{}, s, nil)
+
+	ro := runRollout(t, r, h, BAD_PKG, "skia-perf-a", "skia-perf-b")
+	expect.Equal(t, STATE_ROLLED_BACK, ro.State)
+	expect.Equal(t, []string{"skiaperf.service on skia-perf-a is failed (dead)."}, ro.Stages[0].Problems)
+	expect.True(t, ro.Stages[1].Started.IsZero())
+	expect.Equal(t, []string{"skia-perf-a " + BAD_PKG, "skia-perf-a " + OLD_PKG}, s.pushes)
+	expect.Equal(t, OLD_PKG, s.current["skia-perf-a"])
+	expect.Equal(t, OLD_PKG, s.current["skia-perf-b"])
+}
+
+func TestRolloutAlertsRollBackAllServers(t *testing.T) {
+	testutils.SmallTest(t)
+	s := newFakeServers("skia-perf-a", "skia-perf-b")
+	ma := promalertsclient.NewMockClient()
+	defer ma.AssertExpectations(t)
+	alert := promalertsclient.Alert{Alert: model.Alert{Labels: model.LabelSet{"alertname": "PerfErrors", "instance": "skia-perf-b:20000"}}}
+	ma.On("GetAlerts", mock.AnythingOfType("func(promalertsclient.Alert) bool")).Return([]promalertsclient.Alert{}, nil).Once()
+	ma.On("GetAlerts", mock.AnythingOfType("func(promalertsclient.Alert) bool")).Return([]promalertsclient.Alert{alert}, nil).Once()
+	// The alert has stopped firing once both servers are rolled back.
+	ma.On("GetAlerts", mock.AnythingOfType("func(promalertsclient.Alert) bool")).Return([]promalertsclient.Alert{}, nil).Twice()
+	r, h := newTestRunner(Config{"skiaperf": {AlertQuery: `instance=~"$server:.*"`}}, s, ma)
+
+	ro := runRollout(t, r, h, NEW_PKG, "skia-perf-a", "skia-perf-b")
+	expect.Equal(t, STATE_ROLLED_BACK, ro.State)
+	expect.Empty(t, ro.Stages[0].Problems)
+	expect.Equal(t, []string{"Alert PerfErrors is firing for skia-perf-b."}, ro.Stages[1].Problems)
+	expect.Equal(t, OLD_PKG, s.current["skia-perf-a"])
+	expect.Equal(t, OLD_PKG, s.current["skia-perf-b"])
+	expect.True(t, strings.Contains(ro.Message, "skia-perf-a, skia-perf-b"), ro.Message)
+}
+
+func TestRolloutInstallTimeout(t *testing.T) {
+	testutils.SmallTest(t)
+	s := newFakeServers("skia-perf-a")
+	s.noInstall = true
+	r, h := newTestRunner(Config{"skiaperf": {InstallTimeout: "0s"}}, s, nil)
+
+	ro := runRollout(t, r, h, NEW_PKG, "skia-perf-a")
+	expect.Equal(t, STATE_ROLLED_BACK, ro.State)
+	expect.Equal(t, []string{"skia-perf-a did not install " + NEW_PKG + " within 0s."}, ro.Stages[0].Problems)
+	expect.Equal(t, OLD_PKG, s.current["skia-perf-a"])
+}
+
+func TestRolloutRollbackChecksHealth(t *testing.T) {
+	testutils.SmallTest(t)
+	s := newFakeServers("skia-perf-a", "skia-perf-b")
+	s.current["skia-perf-a"] = BAD_PKG
+	r, h := newTestRunner(Config{}, s, nil)
+
+	ro := runRollout(t, r, h, OTHER_BAD_PKG, "skia-perf-a", "skia-perf-b")
+	expect.Equal(t, STATE_FAILED, ro.State)
+	expect.Equal(t, "The canary stage was unhealthy and rolling back failed: skiaperf.service on skia-perf-a is failed (dead).", ro.Message)
+	expect.Equal(t, []string{"skia-perf-a " + OTHER_BAD_PKG, "skia-perf-a " + BAD_PKG}, s.pushes)
+}
+
+func TestRolloutAbort(t *testing.T) {
+	testutils.SmallTest(t)
+	s := newFakeServers("skia-perf-a", "skia-perf-b")
+	r, h := newTestRunner(Config{}, s, nil)
+
+	ro, err := r.plan(NEW_PKG, "someone@example.com", []string{"skia-perf-a", "skia-perf-b"})
+	assert.NoError(t, err)
+	// Abort while waiting to check the health of the canary.
+	sleeps := 0
+	r.sleep = func(time.Duration) {
+		sleeps++
+		if sleeps == 1 {
+			assert.NoError(t, r.Abort(ro.ID, "other@example.com"))
+		}
+	}
+	r.run(ro)
+	ro = h.rollouts[ro.ID]
+	expect.Equal(t, STATE_ROLLED_BACK, ro.State)
+	expect.Equal(t, "other@example.com", ro.Aborted)
+	expect.Equal(t, []string{"Aborted by other@example.com"}, ro.Stages[0].Problems)
+	expect.True(t, ro.Stages[1].Started.IsZero())
+	expect.Equal(t, "Aborted by other@example.com; rolled back skia-perf-a.", ro.Message)
+	expect.Equal(t, []string{"skia-perf-a " + NEW_PKG, "skia-perf-a " + OLD_PKG}, s.pushes)
+	// The rollback waited for the health of the server.
+	expect.True(t, sleeps > 10)
+
+	expect.Error(t, r.Abort(ro.ID, "other@example.com"))
+}
+
+func TestRolloutResume(t *testing.T) {
+	testutils.SmallTest(t)
+	s := newFakeServers("skia-perf-a", "skia-perf-b", "skia-perf-c")
+	r, h := newTestRunner(Config{}, s, nil)
+
+	// Push stopped after the canary stage and after pushing to skia-perf-b.
+	ro, err := r.plan(NEW_PKG, "someone@example.com", []string{"skia-perf-a", "skia-perf-b", "skia-perf-c"})
+	assert.NoError(t, err)
+	now := time.Now().UTC()
+	s.current["skia-perf-a"] = NEW_PKG
+	s.current["skia-perf-b"] = NEW_PKG
+	ro.Stages[0].Started = now
+	ro.Stages[0].Finished = now
+	ro.Stages[1].Started = now
+	ro.Previous = map[string]string{"skia-perf-a": OLD_PKG, "skia-perf-b": OLD_PKG}
+	assert.NoError(t, h.Put(ro))
+	// An older rollout of another app that had already finished.
+	assert.NoError(t, h.Put(&Rollout{ID: "20170101T000000Z-pulld", App: "pulld", State: STATE_SUCCEEDED}))
+
+	r, _ = newTestRunner(Config{}, s, nil)
+	r.history = h
+	unfinished, err := r.unfinished()
+	assert.NoError(t, err)
+	assert.Len(t, unfinished, 1)
+	expect.Equal(t, ro.ID, r.Running()[0].ID)
+	r.run(unfinished[0])
+	assert.Empty(t, r.Running())
+
+	ro = h.rollouts[ro.ID]
+	expect.Equal(t, STATE_SUCCEEDED, ro.State)
+	expect.Equal(t, []string{"skia-perf-b " + NEW_PKG, "skia-perf-c " + NEW_PKG}, s.pushes)
+	expect.Equal(t, map[string]string{"skia-perf-a": OLD_PKG, "skia-perf-b": OLD_PKG, "skia-perf-c": OLD_PKG}, ro.Previous)
+}
+
+func TestRolloutResumeRollsBack(t *testing.T) {
+	testutils.SmallTest(t)
+	s := newFakeServers("skia-perf-a", "skia-perf-b")
+	r, h := newTestRunner(Config{}, s, nil)
+
+	// Push stopped after the canary stage was found unhealthy.
+	ro, err := r.plan(BAD_PKG, "someone@example.com", []string{"skia-perf-a", "skia-perf-b"})
+	assert.NoError(t, err)
+	now := time.Now().UTC()
+	s.current["skia-perf-a"] = BAD_PKG
+	ro.Stages[0].Started = now
+	ro.Stages[0].Finished = now
+	ro.Stages[0].Problems = []string{"skiaperf.service on skia-perf-a is failed (dead)."}
+	ro.Previous = map[string]string{"skia-perf-a": OLD_PKG}
+	assert.NoError(t, h.Put(ro))
+
+	r, _ = newTestRunner(Config{}, s, nil)
+	r.history = h
+	unfinished, err := r.unfinished()
+	assert.NoError(t, err)
+	assert.Len(t, unfinished, 1)
+	r.run(unfinished[0])
+
+	ro = h.rollouts[ro.ID]
+	expect.Equal(t, STATE_ROLLED_BACK, ro.State)
+	expect.Equal(t, []string{"skia-perf-a " + OLD_PKG}, s.pushes)
+	expect.True(t, ro.Stages[1].Started.IsZero())
+}
+
+func TestOneRolloutPerApp(t *testing.T) {
+	testutils.SmallTest(t)
+	s := newFakeServers("skia-perf-a")
+	r, _ := newTestRunner(Config{}, s, nil)
+
+	ro, err := r.plan(NEW_PKG, "someone@example.com", []string{"skia-perf-a"})
+	assert.NoError(t, err)
+	_, err = r.plan(BAD_PKG, "someone@example.com", []string{"skia-perf-a"})
+	expect.Error(t, err)
+	// Other apps are not blocked.
+	_, err = r.plan("pulld/pulld:new.deb", "someone@example.com", []string{"skia-perf-a"})
+	expect.NoError(t, err)
+	running := r.Running()
+	assert.Len(t, running, 2)
+	expect.Equal(t, "pulld", running[0].App)
+	expect.Equal(t, ro.ID, running[1].ID)
+
+	r.run(ro)
+	_, err = r.plan(BAD_PKG, "someone@example.com", []string{"skia-perf-a"})
+	expect.NoError(t, err)
+
+	_, err = r.plan("skiaperf", "someone@example.com", []string{"skia-perf-a"})
+	expect.Error(t, err)
+	_, err = r.plan("prober/prober:new.deb", "someone@example.com", nil)
+	expect.Error(t, err)
+}
+
+func TestParseQuery(t *testing.T) {
+	testutils.SmallTest(t)
+	matchers, err := parseQuery(`alertname="PerfErrors", instance=~"$server:.*",job!=probe,severity!~warn|info`, "skia-perf-a")
+	assert.NoError(t, err)
+	assert.Len(t, matchers, 4)
+	match := func(labels model.LabelSet) bool {
+		for _, m := range matchers {
+			if !m.match(promalertsclient.Alert{Alert: model.Alert{Labels: labels}}) {
+				return false
+			}
+		}
+		return true
+	}
+	expect.True(t, match(model.LabelSet{"alertname": "PerfErrors", "instance": "skia-perf-a:20000", "severity": "critical"}))
+	expect.False(t, match(model.LabelSet{"alertname": "PerfErrors", "instance": "skia-perf-b:20000"}))
+	expect.False(t, match(model.LabelSet{"alertname": "PerfErrors", "instance": "skia-perf-a:20000", "job": "probe"}))
+	expect.False(t, match(model.LabelSet{"alertname": "PerfErrors", "instance": "skia-perf-a:20000", "severity": "warn"}))
+	expect.False(t, match(model.LabelSet{"alertname": "Other", "instance": "skia-perf-a:20000"}))
+
+	matchers, err = parseQuery("  ", "skia-perf-a")
+	assert.NoError(t, err)
+	expect.Empty(t, matchers)
+
+	_, err = parseQuery("alertname", "")
+	expect.Error(t, err)
+	_, err = parseQuery(`instance=~"(("`, "")
+	expect.Error(t, err)
+}
+
+func TestLoadConfig(t *testing.T) {
+	testutils.SmallTest(t)
+	dir, err := ioutil.TempDir("", "rollout")
+	assert.NoError(t, err)
+	defer testutils.RemoveAll(t, dir)
+
+	filename := filepath.Join(dir, "skiapush.conf")
+	assert.NoError(t, ioutil.WriteFile(filename, []byte(`
+[servers]
+  [servers.skia-perf]
+  appNames = ["skiaperf"]
+
+[rollouts]
+  [rollouts.skiaperf]
+  canary = "skia-perf"
+  wait = "5m"
+  alertQuery = 'app="skiaperf"'
+`), 0644))
+	config, err := LoadConfig(filename)
+	assert.NoError(t, err)
+	cfg := config.get("skiaperf")
+	expect.Equal(t, "skia-perf", cfg.Canary)
+	expect.Equal(t, 5*time.Minute, cfg.wait)
+	expect.Equal(t, DEFAULT_INSTALL_TIMEOUT, cfg.installTimeout)
+	expect.Equal(t, `app="skiaperf"`, cfg.AlertQuery)
+	expect.Equal(t, DEFAULT_WAIT, config.get("prober").wait)
+
+	assert.NoError(t, ioutil.WriteFile(filename, []byte(`
+[rollouts]
+  [rollouts.skiaperf]
+  wait = "soon"
+`), 0644))
+	_, err = LoadConfig(filename)
+	expect.Error(t, err)
+}
@@ -0,0 +1,58 @@
+// repograph_server keeps a repograph.Graph for each of a set of repos up to
+// date, and serves them over gRPC so that other services can share them
+// instead of each keeping their own checkouts. See repograph.NewRemoteMap.
+package main
+
+import (
+	"flag"
+	"os"
+	"path"
+	"time"
+
+	"go.skia.org/infra/go/common"
+	"go.skia.org/infra/go/git/repograph"
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/go/sklog"
+)
+
+// flags
+var (
+	port           = flag.String("port", ":8000", "The port to serve the gRPC endpoint on.")
+	promPort       = flag.String("prom_port", ":20000", "Metrics service address (e.g., ':20000')")
+	repoUrls       = common.NewMultiStringFlag("repo", nil, "Repositories to serve.")
+	updateInterval = flag.Duration("update_interval", time.Minute, "How often to update the repos.")
+	workdir        = flag.String("workdir", ".", "Directory to use for scratch work.")
+)
+
+func main() {
+	defer common.LogPanic()
+	common.InitWithMust("repograph_server", common.PrometheusOpt(promPort), common.CloudLoggingOpt())
+
+	reposDir := path.Join(*workdir, "repos")
+	if err := os.MkdirAll(reposDir, os.ModePerm); err != nil {
+		sklog.Fatal(err)
+	}
+	if *repoUrls == nil {
+		*repoUrls = common.PUBLIC_REPOS
+	}
+	repos, err := repograph.NewMap(*repoUrls, reposDir)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	sklog.Info("Checkout complete")
+
+	addr, err := repograph.RunServer(*port, repos)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	sklog.Infof("Serving repos on %s", addr)
+
+	liveness := metrics2.NewLiveness("repograph_server_update")
+	for range time.Tick(*updateInterval) {
+		if err := repos.Update(); err != nil {
+			sklog.Errorf("Failed to update repos: %s", err)
+			continue
+		}
+		liveness.Reset()
+	}
+}
@@ -310,6 +310,9 @@ func (c *BTCache) taskToBuild(task *db.Task, loggedIn bool) *buildbot.Build {
 	if !task.Fake() {
 		properties = append(properties, []interface{}{"taskRetryURL", fmt.Sprintf(TASK_TRIGGER_URL_FMT, c.taskSchedulerUrl, task.Name, task.Revision), PROPERTY_SOURCE})
 	}
+	if task.Flaky {
+		properties = append(properties, []interface{}{"flaky", "true", PROPERTY_SOURCE})
+	}
 	if task.SwarmingBotId != "" {
 		buildSlave = task.SwarmingBotId
 		properties = append(properties, [][]interface{}{
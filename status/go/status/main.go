@@ -54,6 +54,7 @@ var (
 	capacityTemplate *template.Template       = nil
 	commitsTemplate  *template.Template       = nil
 	tasksPerCommit   *tasksPerCommitCache     = nil
+	tokensTemplate   *template.Template       = nil
 )
 
 // flags
@@ -63,11 +64,13 @@ var (
 	port                        = flag.String("port", ":8002", "HTTP service port (e.g., ':8002')")
 	promPort                    = flag.String("prom_port", ":20000", "Metrics service address (e.g., ':10110')")
 	repoUrls                    = common.NewMultiStringFlag("repo", nil, "Repositories to query for status.")
+	repographServer             = flag.String("repograph_server", "", "Address of a repograph_server to load the repos from. If blank, the repos are checked out in workdir.")
 	resourcesDir                = flag.String("resources_dir", "", "The directory to find templates, JS, and CSS files. If blank the current directory will be used.")
 	swarmingUrl                 = flag.String("swarming_url", "https://chromium-swarm.appspot.com", "URL of the Swarming server.")
 	taskSchedulerDbUrl          = flag.String("task_db_url", "http://skia-task-scheduler:8008/db/", "Where the Skia task scheduler database is hosted.")
 	taskSchedulerUrl            = flag.String("task_scheduler_url", "https://task-scheduler.skia.org", "URL of the Task Scheduler server.")
 	testing                     = flag.Bool("testing", false, "Set to true for locally testing rules. No email will be sent.")
+	tokenDb                     = flag.String("token_db", "", "BoltDB file in which API tokens are stored. If blank, API tokens are not accepted.")
 	useMetadata                 = flag.Bool("use_metadata", true, "Load sensitive values from metadata not from flags.")
 	workdir                     = flag.String("workdir", ".", "Directory to use for scratch work.")
 
@@ -100,6 +103,10 @@ func reloadTemplates() {
 		filepath.Join(*resourcesDir, "templates/capacity.html"),
 		filepath.Join(*resourcesDir, "templates/header.html"),
 	))
+	tokensTemplate = template.Must(template.ParseFiles(
+		filepath.Join(*resourcesDir, "templates/tokens.html"),
+		filepath.Join(*resourcesDir, "templates/header.html"),
+	))
 }
 
 func Init() {
@@ -459,6 +466,20 @@ func capacityHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func tokensHandler(w http.ResponseWriter, r *http.Request) {
+	defer timer.New("tokensHandler").Stop()
+	w.Header().Set("Content-Type", "text/html")
+
+	// Don't use cached templates in testing mode.
+	if *testing {
+		reloadTemplates()
+	}
+
+	if err := tokensTemplate.Execute(w, nil); err != nil {
+		httputils.ReportError(w, r, err, fmt.Sprintf("Failed to expand template: %v", err))
+	}
+}
+
 func capacityStatsHandler(w http.ResponseWriter, r *http.Request) {
 	defer timer.New("capacityStatsHandler").Stop()
 	w.Header().Set("Content-Type", "application/json")
@@ -533,6 +554,10 @@ func runServer(serverURL string) {
 	r.HandleFunc("/repo/{repo}", statusHandler)
 	r.HandleFunc("/capacity", capacityHandler)
 	r.HandleFunc("/capacity/json", capacityStatsHandler)
+	if *tokenDb != "" {
+		r.HandleFunc("/tokens", tokensHandler)
+		r.HandleFunc("/json/tokens", login.TokensHandler)
+	}
 	r.HandleFunc("/json/version", skiaversion.JsonHandler)
 	r.HandleFunc("/json/{repo}/buildProgress", buildProgressHandler)
 	r.HandleFunc("/logout/", login.LogoutHandler)
@@ -549,7 +574,7 @@ func runServer(serverURL string) {
 	commits.HandleFunc("/", commitsJsonHandler)
 	commits.HandleFunc("/{commit:[a-f0-9]+}/comments", addCommitCommentHandler).Methods("POST")
 	commits.HandleFunc("/{commit:[a-f0-9]+}/comments/{commentId:[0-9]+}", deleteCommitCommentHandler).Methods("DELETE")
-	http.Handle("/", httputils.LoggingGzipRequestResponse(r))
+	http.Handle("/", httputils.LoggingGzipRequestResponse(login.TokenAuth(r)))
 	sklog.Infof("Ready to serve on %s", serverURL)
 	sklog.Fatal(http.ListenAndServe(*port, nil))
 }
@@ -595,6 +620,14 @@ func main() {
 	}
 
 	login.SimpleInitMust(*port, *testing)
+	if *tokenDb != "" {
+		tokens, err := login.NewTokenDB(*tokenDb)
+		if err != nil {
+			sklog.Fatal(err)
+		}
+		defer util.Close(tokens)
+		login.InitTokens(tokens)
+	}
 
 	// Check out source code.
 	reposDir := path.Join(*workdir, "repos")
@@ -604,7 +637,11 @@ func main() {
 	if *repoUrls == nil {
 		*repoUrls = common.PUBLIC_REPOS
 	}
-	repos, err = repograph.NewMap(*repoUrls, reposDir)
+	if *repographServer != "" {
+		repos, err = repograph.NewRemoteMap(*repographServer, *repoUrls)
+	} else {
+		repos, err = repograph.NewMap(*repoUrls, reposDir)
+	}
 	if err != nil {
 		sklog.Fatal(err)
 	}
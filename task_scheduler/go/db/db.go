@@ -2,6 +2,7 @@ package db
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"time"
 
@@ -342,6 +343,126 @@ func SearchJobs(db JobReader, p *JobSearchParams) ([]*Job, error) {
 	return matchJobs(jobs, p), nil
 }
 
+// TaskSearchParams are parameters on which Tasks may be searched. All fields
+// are optional; if a field is not provided, the search will return Tasks with
+// any value for that field. If either of TimeStart or TimeEnd is not provided,
+// the search defaults to the last 24 hours.
+type TaskSearchParams struct {
+	RepoState
+	// BotId matches Task.SwarmingBotId.
+	BotId string `json:"bot_id"`
+	// Commit matches Tasks whose blamelist includes the given commit.
+	Commit string `json:"commit"`
+	Name   string `json:"name"`
+	// Properties matches Tasks which have all of the given properties.
+	Properties map[string]string `json:"properties,omitempty"`
+	Status     TaskStatus        `json:"status"`
+	TimeStart  time.Time         `json:"time_start"`
+	TimeEnd    time.Time         `json:"time_end"`
+
+	// Offset is the number of matching Tasks to skip, for pagination.
+	Offset int `json:"offset"`
+	// Limit is the maximum number of Tasks to return. Zero indicates no limit.
+	Limit int `json:"limit"`
+	// CountOnly indicates that only the number of matching Tasks should be
+	// returned.
+	CountOnly bool `json:"count_only"`
+}
+
+// TaskSearchResult is the result of a Task search.
+type TaskSearchResult struct {
+	// Count is the total number of Tasks which matched the search, ignoring
+	// Offset and Limit.
+	Count int `json:"count"`
+	// Tasks contains the matching Tasks within Offset and Limit, sorted by
+	// Created timestamp. Empty if CountOnly was specified.
+	Tasks []*Task `json:"tasks"`
+}
+
+// TaskSearcher is implemented by TaskReaders which can search for Tasks more
+// efficiently than by loading all Tasks in the time range. Use SearchTasks
+// rather than calling SearchTasks on a TaskSearcher directly.
+type TaskSearcher interface {
+	// SearchTasks returns Tasks which match the given search parameters.
+	// TimeStart and TimeEnd are always set.
+	SearchTasks(*TaskSearchParams) (*TaskSearchResult, error)
+}
+
+// searchPropertiesMatch returns true if test contains all of the key/value
+// pairs in search.
+func searchPropertiesMatch(search, test map[string]string) bool {
+	for k, v := range search {
+		if actual, ok := test[k]; !ok || actual != v {
+			return false
+		}
+	}
+	return true
+}
+
+// matchTasks returns Tasks which match the given search parameters.
+func matchTasks(tasks []*Task, p *TaskSearchParams) []*Task {
+	rv := []*Task{}
+	for _, t := range tasks {
+		// Compare all attributes which are provided.
+		if true &&
+			!p.TimeStart.After(t.Created) &&
+			t.Created.Before(p.TimeEnd) &&
+			searchStringEqual(p.Issue, t.Issue) &&
+			searchStringEqual(p.Patchset, t.Patchset) &&
+			searchStringEqual(p.Server, t.Server) &&
+			searchStringEqual(p.Repo, t.Repo) &&
+			searchStringEqual(p.Revision, t.Revision) &&
+			searchStringEqual(p.Name, t.Name) &&
+			searchStringEqual(p.BotId, t.SwarmingBotId) &&
+			searchStringEqual(string(p.Status), string(t.Status)) &&
+			(p.Commit == "" || util.In(p.Commit, t.Commits)) &&
+			searchPropertiesMatch(p.Properties, t.Properties) {
+			rv = append(rv, t)
+		}
+	}
+	return rv
+}
+
+// FilterTasks returns the result of searching the given Tasks, which must be
+// sorted by Created timestamp, with the given search parameters. Provided for
+// implementations of TaskSearcher.
+func FilterTasks(tasks []*Task, p *TaskSearchParams) *TaskSearchResult {
+	matched := matchTasks(tasks, p)
+	rv := &TaskSearchResult{
+		Count: len(matched),
+		Tasks: []*Task{},
+	}
+	if p.CountOnly || p.Offset >= len(matched) {
+		return rv
+	}
+	end := len(matched)
+	if p.Limit > 0 && p.Offset+p.Limit < end {
+		end = p.Offset + p.Limit
+	}
+	rv.Tasks = matched[p.Offset:end]
+	return rv
+}
+
+// SearchTasks returns Tasks in the given time range which match the given
+// search parameters. If db is a TaskSearcher, the search is delegated to it.
+func SearchTasks(db TaskReader, p *TaskSearchParams) (*TaskSearchResult, error) {
+	if util.TimeIsZero(p.TimeStart) || util.TimeIsZero(p.TimeEnd) {
+		p.TimeEnd = time.Now()
+		p.TimeStart = p.TimeEnd.Add(-24 * time.Hour)
+	}
+	if p.Offset < 0 || p.Limit < 0 {
+		return nil, fmt.Errorf("Offset and Limit must not be negative; got %d and %d.", p.Offset, p.Limit)
+	}
+	if s, ok := db.(TaskSearcher); ok {
+		return s.SearchTasks(p)
+	}
+	tasks, err := db.GetTasksFromDateRange(p.TimeStart, p.TimeEnd)
+	if err != nil {
+		return nil, err
+	}
+	return FilterTasks(tasks, p), nil
+}
+
 // RemoteDB allows retrieving tasks and jobs and full access to comments.
 type RemoteDB interface {
 	TaskReader
@@ -349,11 +470,12 @@ type RemoteDB interface {
 	CommentDB
 }
 
-// DB implements TaskDB, JobDB, and CommentDB.
+// DB implements TaskDB, JobDB, CommentDB, and FlakinessDB.
 type DB interface {
 	TaskDB
 	JobDB
 	CommentDB
+	FlakinessDB
 }
 
 // DBCloser is a DB that must be closed when no longer in use.
@@ -362,20 +484,23 @@ type DBCloser interface {
 	DB
 }
 
-// federatedDB joins an independent TaskDB, JobDB, and CommentDB into a DB.
+// federatedDB joins an independent TaskDB, JobDB, CommentDB, and FlakinessDB
+// into a DB.
 type federatedDB struct {
 	TaskDB
 	JobDB
 	CommentDB
+	FlakinessDB
 }
 
-// NewDB returns a DB that delegates to independent TaskDB, JobDB, and
-// CommentDB.
-func NewDB(tdb TaskDB, jdb JobDB, cdb CommentDB) DB {
+// NewDB returns a DB that delegates to independent TaskDB, JobDB, CommentDB,
+// and FlakinessDB.
+func NewDB(tdb TaskDB, jdb JobDB, cdb CommentDB, fdb FlakinessDB) DB {
 	return &federatedDB{
-		TaskDB:    tdb,
-		JobDB:     jdb,
-		CommentDB: cdb,
+		TaskDB:      tdb,
+		JobDB:       jdb,
+		CommentDB:   cdb,
+		FlakinessDB: fdb,
 	}
 }
 
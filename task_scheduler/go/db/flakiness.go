@@ -0,0 +1,163 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FlakinessStats contains counts of finished tasks, used to compute the
+// flakiness rate of a TaskSpec or bot.
+type FlakinessStats struct {
+	// Runs is the number of tasks which succeeded or failed.
+	Runs int `json:"runs"`
+
+	// Failures is the number of tasks which failed, including flakes.
+	Failures int `json:"failures"`
+
+	// Flakes is the number of tasks which failed, but were retried
+	// successfully at the same commit.
+	Flakes int `json:"flakes"`
+}
+
+// Rate returns the fraction of runs which were flaky.
+func (s *FlakinessStats) Rate() float64 {
+	if s.Runs == 0 {
+		return 0.0
+	}
+	return float64(s.Flakes) / float64(s.Runs)
+}
+
+// Add includes the given Task in the stats. Tasks which are not finished or
+// which ended in a mishap are ignored.
+func (s *FlakinessStats) Add(t *Task) {
+	switch t.Status {
+	case TASK_STATUS_SUCCESS:
+		s.Runs++
+	case TASK_STATUS_FAILURE:
+		s.Runs++
+		s.Failures++
+		if t.Flaky {
+			s.Flakes++
+		}
+	}
+}
+
+// RepoFlakiness contains flakiness statistics for a single repository.
+type RepoFlakiness struct {
+	// Repo is the repository to which the statistics apply.
+	Repo string `json:"repo"`
+
+	// TaskSpecs maps TaskSpec name to its flakiness statistics.
+	TaskSpecs map[string]*FlakinessStats `json:"taskSpecs"`
+
+	// Bots maps Swarming bot ID to its flakiness statistics.
+	Bots map[string]*FlakinessStats `json:"bots"`
+
+	// Updated is the time at which the statistics were computed.
+	Updated time.Time `json:"updated"`
+}
+
+// Copy returns a copy of the RepoFlakiness.
+func (f *RepoFlakiness) Copy() *RepoFlakiness {
+	copyStats := func(m map[string]*FlakinessStats) map[string]*FlakinessStats {
+		if m == nil {
+			return nil
+		}
+		rv := make(map[string]*FlakinessStats, len(m))
+		for k, v := range m {
+			cpy := *v
+			rv[k] = &cpy
+		}
+		return rv
+	}
+	return &RepoFlakiness{
+		Repo:      f.Repo,
+		TaskSpecs: copyStats(f.TaskSpecs),
+		Bots:      copyStats(f.Bots),
+		Updated:   f.Updated,
+	}
+}
+
+// FlakinessDB stores flakiness statistics for TaskSpecs and bots.
+type FlakinessDB interface {
+	// GetFlakinessForRepos returns the flakiness statistics for the given
+	// repos. Repos with no statistics are returned with empty maps.
+	GetFlakinessForRepos(repos []string) ([]*RepoFlakiness, error)
+
+	// PutFlakiness replaces the flakiness statistics for a repo.
+	PutFlakiness(*RepoFlakiness) error
+}
+
+// FlakinessBox implements FlakinessDB with in-memory storage.
+//
+// When created via NewFlakinessBoxWithPersistence, FlakinessBox will persist
+// the in-memory representation on every change using the provided writer
+// function.
+//
+// FlakinessBox can be default-initialized if only in-memory storage is desired.
+type FlakinessBox struct {
+	// mtx protects flakiness.
+	mtx sync.RWMutex
+	// flakiness is map[repo_name]*RepoFlakiness.
+	flakiness map[string]*RepoFlakiness
+	// writer is called to persist flakiness after every change.
+	writer func(map[string]*RepoFlakiness) error
+}
+
+// NewFlakinessBoxWithPersistence creates a FlakinessBox that is initialized
+// with init and sends the updated in-memory representation to writer after
+// each change. The value of init and the argument to writer is
+// map[repo_name]*RepoFlakiness. init must not be modified by the caller.
+// writer must not call any methods of FlakinessBox. writer may return an
+// error to prevent a change from taking effect.
+func NewFlakinessBoxWithPersistence(init map[string]*RepoFlakiness, writer func(map[string]*RepoFlakiness) error) *FlakinessBox {
+	return &FlakinessBox{
+		flakiness: init,
+		writer:    writer,
+	}
+}
+
+// See documentation for FlakinessDB.GetFlakinessForRepos.
+func (b *FlakinessBox) GetFlakinessForRepos(repos []string) ([]*RepoFlakiness, error) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	rv := make([]*RepoFlakiness, len(repos))
+	for i, repo := range repos {
+		if f, ok := b.flakiness[repo]; ok {
+			rv[i] = f.Copy()
+		} else {
+			rv[i] = &RepoFlakiness{
+				Repo:      repo,
+				TaskSpecs: map[string]*FlakinessStats{},
+				Bots:      map[string]*FlakinessStats{},
+			}
+		}
+	}
+	return rv, nil
+}
+
+// See documentation for FlakinessDB.PutFlakiness.
+func (b *FlakinessBox) PutFlakiness(f *RepoFlakiness) error {
+	if f.Repo == "" {
+		return fmt.Errorf("RepoFlakiness missing required Repo field. %#v", f)
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if b.flakiness == nil {
+		b.flakiness = make(map[string]*RepoFlakiness, 1)
+	}
+	old, hadOld := b.flakiness[f.Repo]
+	b.flakiness[f.Repo] = f.Copy()
+	if b.writer != nil {
+		if err := b.writer(b.flakiness); err != nil {
+			if hadOld {
+				b.flakiness[f.Repo] = old
+			} else {
+				delete(b.flakiness, f.Repo)
+			}
+			return err
+		}
+	}
+	return nil
+}
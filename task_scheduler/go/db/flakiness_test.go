@@ -0,0 +1,131 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils"
+)
+
+func TestFlakinessStats(t *testing.T) {
+	testutils.SmallTest(t)
+	s := &FlakinessStats{}
+	assert.Equal(t, 0.0, s.Rate())
+	s.Add(&Task{Status: TASK_STATUS_PENDING})
+	s.Add(&Task{Status: TASK_STATUS_RUNNING})
+	s.Add(&Task{Status: TASK_STATUS_MISHAP})
+	testutils.AssertDeepEqual(t, &FlakinessStats{}, s)
+	s.Add(&Task{Status: TASK_STATUS_SUCCESS})
+	s.Add(&Task{Status: TASK_STATUS_FAILURE})
+	s.Add(&Task{Status: TASK_STATUS_FAILURE, Flaky: true})
+	s.Add(&Task{Status: TASK_STATUS_SUCCESS})
+	testutils.AssertDeepEqual(t, &FlakinessStats{
+		Runs:     4,
+		Failures: 2,
+		Flakes:   1,
+	}, s)
+	assert.Equal(t, 0.25, s.Rate())
+}
+
+func TestCopyRepoFlakiness(t *testing.T) {
+	testutils.SmallTest(t)
+	v := &RepoFlakiness{
+		Repo: "r1",
+		TaskSpecs: map[string]*FlakinessStats{
+			"Test": {Runs: 10, Failures: 3, Flakes: 2},
+		},
+		Bots: map[string]*FlakinessStats{
+			"bot1": {Runs: 5, Failures: 1, Flakes: 1},
+		},
+		Updated: time.Now(),
+	}
+	testutils.AssertCopy(t, v, v.Copy())
+}
+
+func TestFlakinessBox(t *testing.T) {
+	testutils.SmallTest(t)
+	b := &FlakinessBox{}
+
+	// Nothing stored yet.
+	rv, err := b.GetFlakinessForRepos([]string{"r1"})
+	assert.NoError(t, err)
+	testutils.AssertDeepEqual(t, []*RepoFlakiness{
+		{
+			Repo:      "r1",
+			TaskSpecs: map[string]*FlakinessStats{},
+			Bots:      map[string]*FlakinessStats{},
+		},
+	}, rv)
+
+	f := &RepoFlakiness{
+		Repo: "r1",
+		TaskSpecs: map[string]*FlakinessStats{
+			"Test": {Runs: 10, Failures: 3, Flakes: 2},
+		},
+		Bots:    map[string]*FlakinessStats{},
+		Updated: time.Unix(1480683321, 0).UTC(),
+	}
+	assert.NoError(t, b.PutFlakiness(f))
+	rv, err = b.GetFlakinessForRepos([]string{"r1"})
+	assert.NoError(t, err)
+	testutils.AssertDeepEqual(t, []*RepoFlakiness{f}, rv)
+
+	// Modifying the returned value does not affect the stored value.
+	rv[0].TaskSpecs["Test"].Flakes = 5
+	rv, err = b.GetFlakinessForRepos([]string{"r1"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rv[0].TaskSpecs["Test"].Flakes)
+
+	assert.Error(t, b.PutFlakiness(&RepoFlakiness{}))
+}
+
+func TestFlakinessBoxWithPersistence(t *testing.T) {
+	testutils.SmallTest(t)
+	callCount := 0
+	var injectedError error = nil
+	expected := map[string]*RepoFlakiness{}
+	testWriter := func(actual map[string]*RepoFlakiness) error {
+		callCount++
+		if injectedError != nil {
+			return injectedError
+		}
+		testutils.AssertDeepEqual(t, expected, actual)
+		return nil
+	}
+
+	init := map[string]*RepoFlakiness{
+		"r1": {
+			Repo: "r1",
+			TaskSpecs: map[string]*FlakinessStats{
+				"Test": {Runs: 1},
+			},
+			Bots: map[string]*FlakinessStats{},
+		},
+	}
+	b := NewFlakinessBoxWithPersistence(init, testWriter)
+	assert.Equal(t, 0, callCount)
+
+	f := &RepoFlakiness{
+		Repo: "r2",
+		TaskSpecs: map[string]*FlakinessStats{
+			"Build": {Runs: 2, Failures: 1, Flakes: 1},
+		},
+		Bots: map[string]*FlakinessStats{},
+	}
+	expected["r1"] = init["r1"].Copy()
+	expected["r2"] = f.Copy()
+	assert.NoError(t, b.PutFlakiness(f))
+	assert.Equal(t, 1, callCount)
+
+	// Errors from the writer prevent the change from taking effect.
+	injectedError = fmt.Errorf("No soup for you!")
+	f2 := f.Copy()
+	f2.TaskSpecs["Build"].Runs = 3
+	assert.EqualError(t, b.PutFlakiness(f2), injectedError.Error())
+	assert.Equal(t, 2, callCount)
+	rv, err := b.GetFlakinessForRepos([]string{"r1", "r2"})
+	assert.NoError(t, err)
+	testutils.AssertDeepEqual(t, []*RepoFlakiness{expected["r1"], expected["r2"]}, rv)
+}
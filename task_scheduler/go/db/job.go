@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
 )
 
 const (
@@ -134,6 +135,10 @@ type Job struct {
 	// Priority is an indicator of the relative priority of this Job.
 	Priority float64 `json:"priority"`
 
+	// Quarantined are the names of TaskSpecs whose failures do not cause
+	// this Job to fail, because they have been found to be too flaky.
+	Quarantined []string `json:"quarantined,omitempty"`
+
 	// RepoState is the current state of the repository for this Job.
 	RepoState
 
@@ -144,6 +149,10 @@ type Job struct {
 	// the Job. Keys are TaskSpec names and values are slices of TaskSummary
 	// instances describing the Tasks.
 	Tasks map[string][]*TaskSummary `json:"tasks"`
+
+	// Trigger is the name of the periodic trigger which caused this Job to
+	// be created, if any.
+	Trigger string `json:"trigger,omitempty"`
 }
 
 // Copy returns a copy of the Job.
@@ -179,9 +188,11 @@ func (j *Job) Copy() *Job {
 		IsForce:             j.IsForce,
 		Name:                j.Name,
 		Priority:            j.Priority,
+		Quarantined:         util.CopyStringSlice(j.Quarantined),
 		RepoState:           j.RepoState.Copy(),
 		Status:              j.Status,
 		Tasks:               tasks,
+		Trigger:             j.Trigger,
 	}
 }
 
@@ -252,12 +263,19 @@ func (j *Job) DeriveStatus() JobStatus {
 		// We may have more than one Task for this spec, due to
 		// retrying of failed Tasks. We should not return a "failed"
 		// result if we still have retry attempts remaining or if we've
-		// already retried and succeeded.
+		// already retried and succeeded. Preempted Tasks don't count
+		// as attempts.
 		maxAttempts := tasks[0].MaxAttempts
 		if maxAttempts == 0 {
 			maxAttempts = DEFAULT_MAX_TASK_ATTEMPTS
 		}
-		canRetry := len(tasks) < maxAttempts
+		attempts := 0
+		for _, t := range tasks {
+			if !t.Preempted {
+				attempts++
+			}
+		}
+		canRetry := attempts < maxAttempts
 		bestStatus := JOB_STATUS_MISHAP
 		for _, t := range tasks {
 			status := JobStatusFromTaskStatus(t.Status)
@@ -269,6 +287,9 @@ func (j *Job) DeriveStatus() JobStatus {
 			worstStatus = WorseJobStatus(worstStatus, bestStatus)
 		} else if canRetry {
 			worstStatus = WorseJobStatus(worstStatus, JOB_STATUS_IN_PROGRESS)
+		} else if bestStatus == JOB_STATUS_FAILURE && util.In(name, j.Quarantined) {
+			// Failures of quarantined TaskSpecs are ignored.
+			worstStatus = WorseJobStatus(worstStatus, JOB_STATUS_SUCCESS)
 		} else {
 			worstStatus = WorseJobStatus(worstStatus, bestStatus)
 		}
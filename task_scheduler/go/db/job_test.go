@@ -25,6 +25,7 @@ func makeFullJob(now time.Time) *Job {
 		IsForce:             true,
 		Name:                "C",
 		Priority:            1.2,
+		Quarantined:         []string{"flaky-test"},
 		RepoState: RepoState{
 			Repo: DEFAULT_TEST_REPO,
 		},
@@ -36,6 +37,7 @@ func makeFullJob(now time.Time) *Job {
 				SwarmingTaskId: "abc123",
 			}},
 		},
+		Trigger: "nightly",
 	}
 }
 
@@ -231,4 +233,19 @@ func TestJobDeriveStatus(t *testing.T) {
 	// It succeeded!
 	t3.Status = TASK_STATUS_SUCCESS
 	assert.Equal(t, j1.DeriveStatus(), JOB_STATUS_SUCCESS)
+
+	// If the test task is quarantined, its failures are ignored.
+	t3.Status = TASK_STATUS_FAILURE
+	t3.MaxAttempts = 1
+	assert.Equal(t, j1.DeriveStatus(), JOB_STATUS_FAILURE)
+	j1.Quarantined = []string{"test"}
+	assert.Equal(t, j1.DeriveStatus(), JOB_STATUS_SUCCESS)
+
+	// But not its mishaps.
+	t3.Status = TASK_STATUS_MISHAP
+	assert.Equal(t, j1.DeriveStatus(), JOB_STATUS_MISHAP)
+
+	// Preempted tasks don't count as attempts.
+	t3.Preempted = true
+	assert.Equal(t, j1.DeriveStatus(), JOB_STATUS_IN_PROGRESS)
 }
@@ -59,12 +59,39 @@ const (
 	//     big endian; v[9:] is the GOB of the Job.
 	BUCKET_JOBS_VERSION = 1
 
+	// BUCKET_TASK_INDEX is the name of the Task secondary index bucket, used by
+	// SearchTasks. Key is "<field>\x00<value>\x00<Task.Id>" (see taskIndexKeys)
+	// and value is empty. Since Task.Id begins with the creation time, the keys
+	// for each field and value are sorted by creation time. Index entries are
+	// updated by PutTasks.
+	BUCKET_TASK_INDEX = "task-index"
+	// BUCKET_TASK_INDEX_KEYS is the name of the reverse Task index bucket. Key
+	// is Task.Id, value is the Task's keys in BUCKET_TASK_INDEX (see
+	// packIndexKeys). PutTasks uses it to remove the old index entries of
+	// updated Tasks without decoding them.
+	BUCKET_TASK_INDEX_KEYS = "task-index-keys"
+	// TASK_INDEX_* are the fields indexed in BUCKET_TASK_INDEX.
+	TASK_INDEX_BOT      = "bot"
+	TASK_INDEX_COMMIT   = "commit"
+	TASK_INDEX_ISSUE    = "issue"
+	TASK_INDEX_NAME     = "name"
+	TASK_INDEX_REPO     = "repo"
+	TASK_INDEX_REVISION = "revision"
+	TASK_INDEX_STATUS   = "status"
+
 	// BUCKET_COMMENTS is the name of the comments bucket. Key is KEY_COMMENT_MAP,
 	// value is the GOB of the map provided by db.CommentBox. The comment map will
 	// be updated in place. All repos share the same bucket.
 	BUCKET_COMMENTS = "comments"
 	KEY_COMMENT_MAP = "comment-map"
 
+	// BUCKET_FLAKINESS is the name of the flakiness bucket. Key is
+	// KEY_FLAKINESS_MAP, value is the GOB of the map provided by
+	// db.FlakinessBox. The flakiness map will be updated in place. All repos
+	// share the same bucket.
+	BUCKET_FLAKINESS  = "flakiness"
+	KEY_FLAKINESS_MAP = "flakiness-map"
+
 	// BUCKET_BACKUP is the name of the backup bucket. Key is
 	// KEY_INCREMENTAL_BACKUP_TIME, value is time.Time.MarshalBinary. The value
 	// will be updated in place.
@@ -225,6 +252,10 @@ type localDB struct {
 	// this localDB to persist the comments.
 	*db.CommentBox
 
+	// FlakinessBox is embedded in order to implement db.FlakinessDB.
+	// FlakinessBox uses this localDB to persist the flakiness statistics.
+	*db.FlakinessBox
+
 	// Close will send on each of these channels to indicate goroutines should
 	// stop.
 	notifyOnClose []chan bool
@@ -296,6 +327,128 @@ func tasksBucket(tx *bolt.Tx) *bolt.Bucket {
 	return b
 }
 
+// Returns the Task index bucket.
+func taskIndexBucket(tx *bolt.Tx) *bolt.Bucket {
+	return tx.Bucket([]byte(BUCKET_TASK_INDEX))
+}
+
+// Returns the reverse Task index bucket.
+func taskIndexKeysBucket(tx *bolt.Tx) *bolt.Bucket {
+	return tx.Bucket([]byte(BUCKET_TASK_INDEX_KEYS))
+}
+
+// taskIndexPrefix returns the prefix of BUCKET_TASK_INDEX keys for Tasks with
+// the given value for the given field.
+func taskIndexPrefix(field, value string) string {
+	return field + "\x00" + value + "\x00"
+}
+
+// taskIndexKeys returns the BUCKET_TASK_INDEX keys for the given Task.
+func taskIndexKeys(t *db.Task) [][]byte {
+	rv := [][]byte{}
+	add := func(field, value string) {
+		if value != "" {
+			rv = append(rv, []byte(taskIndexPrefix(field, value)+t.Id))
+		}
+	}
+	add(TASK_INDEX_BOT, t.SwarmingBotId)
+	for _, c := range t.Commits {
+		add(TASK_INDEX_COMMIT, c)
+	}
+	add(TASK_INDEX_ISSUE, t.Issue)
+	add(TASK_INDEX_NAME, t.Name)
+	add(TASK_INDEX_REPO, t.Repo)
+	add(TASK_INDEX_REVISION, t.Revision)
+	add(TASK_INDEX_STATUS, string(t.Status))
+	return rv
+}
+
+// packIndexKeys creates a value for BUCKET_TASK_INDEX_KEYS. Each key is
+// preceded by its length as a uvarint.
+func packIndexKeys(keys [][]byte) []byte {
+	rv := []byte{}
+	buf := make([]byte, binary.MaxVarintLen64)
+	for _, k := range keys {
+		n := binary.PutUvarint(buf, uint64(len(k)))
+		rv = append(rv, buf[:n]...)
+		rv = append(rv, k...)
+	}
+	return rv
+}
+
+// unpackIndexKeys gets the keys from a value created by packIndexKeys.
+func unpackIndexKeys(value []byte) ([][]byte, error) {
+	rv := [][]byte{}
+	for len(value) > 0 {
+		l, n := binary.Uvarint(value)
+		if n <= 0 || uint64(len(value)-n) < l {
+			return nil, fmt.Errorf("Invalid Task index keys: %v", value)
+		}
+		value = value[n:]
+		rv = append(rv, value[:l])
+		value = value[l:]
+	}
+	return rv, nil
+}
+
+// updateTaskIndex replaces the BUCKET_TASK_INDEX entries of the Task with the
+// given Id with newKeys. The Task's current entries are found in
+// BUCKET_TASK_INDEX_KEYS, which is updated as well.
+func updateTaskIndex(tx *bolt.Tx, id string, newKeys [][]byte) error {
+	indexBucket := taskIndexBucket(tx)
+	keysBucket := taskIndexKeysBucket(tx)
+	if value := keysBucket.Get([]byte(id)); value != nil {
+		oldKeys, err := unpackIndexKeys(value)
+		if err != nil {
+			return err
+		}
+		for _, k := range oldKeys {
+			if err := indexBucket.Delete(k); err != nil {
+				return err
+			}
+		}
+	}
+	for _, k := range newKeys {
+		if err := indexBucket.Put(k, []byte{}); err != nil {
+			return err
+		}
+	}
+	return keysBucket.Put([]byte(id), packIndexKeys(newKeys))
+}
+
+// buildTaskIndex creates the BUCKET_TASK_INDEX and BUCKET_TASK_INDEX_KEYS
+// buckets, replacing them if they exist, and adds index entries for all Tasks
+// in the DB. tx must be an update transaction.
+func buildTaskIndex(tx *bolt.Tx) error {
+	for _, name := range []string{BUCKET_TASK_INDEX, BUCKET_TASK_INDEX_KEYS} {
+		if tx.Bucket([]byte(name)) != nil {
+			if err := tx.DeleteBucket([]byte(name)); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.CreateBucket([]byte(name)); err != nil {
+			return err
+		}
+	}
+	count := 0
+	if err := tasksBucket(tx).ForEach(func(k, v []byte) error {
+		_, serialized, err := unpackTask(v)
+		if err != nil {
+			return err
+		}
+		var t db.Task
+		if err := gob.NewDecoder(bytes.NewReader(serialized)).Decode(&t); err != nil {
+			return err
+		}
+		count++
+		return updateTaskIndex(tx, t.Id, taskIndexKeys(&t))
+	}); err != nil {
+		return err
+	}
+	sklog.Infof("Built Task index for %d Tasks.", count)
+	return nil
+}
+
 // Returns the jobs bucket with FillPercent set.
 func jobsBucket(tx *bolt.Tx) *bolt.Bucket {
 	b := tx.Bucket([]byte(BUCKET_JOBS))
@@ -336,6 +489,7 @@ func NewDB(name, filename string) (db.BackupDBCloser, error) {
 	}()
 
 	comments := map[string]*db.RepoComments{}
+	flakiness := map[string]*db.RepoFlakiness{}
 
 	if err := d.update("NewDB", func(tx *bolt.Tx) error {
 		if _, err := tx.CreateBucketIfNotExists([]byte(BUCKET_TASKS)); err != nil {
@@ -344,10 +498,20 @@ func NewDB(name, filename string) (db.BackupDBCloser, error) {
 		if _, err := tx.CreateBucketIfNotExists([]byte(BUCKET_JOBS)); err != nil {
 			return err
 		}
+		if taskIndexBucket(tx) == nil || taskIndexKeysBucket(tx) == nil {
+			// The DB was created before the Task index existed, or is new.
+			if err := buildTaskIndex(tx); err != nil {
+				return err
+			}
+		}
 		commentsBucket, err := tx.CreateBucketIfNotExists([]byte(BUCKET_COMMENTS))
 		if err != nil {
 			return err
 		}
+		flakinessBucket, err := tx.CreateBucketIfNotExists([]byte(BUCKET_FLAKINESS))
+		if err != nil {
+			return err
+		}
 		if _, err := tx.CreateBucketIfNotExists([]byte(BUCKET_BACKUP)); err != nil {
 			return err
 		}
@@ -359,14 +523,22 @@ func NewDB(name, filename string) (db.BackupDBCloser, error) {
 			}
 		}
 
+		serializedFlakinessMap := flakinessBucket.Get([]byte(KEY_FLAKINESS_MAP))
+		if serializedFlakinessMap != nil {
+			if err := gob.NewDecoder(bytes.NewReader(serializedFlakinessMap)).Decode(&flakiness); err != nil {
+				return err
+			}
+		}
+
 		return nil
 	}); err != nil {
 		return nil, err
 	}
 
 	d.CommentBox = db.NewCommentBoxWithPersistence(comments, d.writeCommentsMap)
+	d.FlakinessBox = db.NewFlakinessBoxWithPersistence(flakiness, d.writeFlakinessMap)
 
-	if dbMetric, err := boltutil.NewDbMetric(boltdb, []string{BUCKET_TASKS, BUCKET_JOBS, BUCKET_COMMENTS}, map[string]string{"database": name}); err != nil {
+	if dbMetric, err := boltutil.NewDbMetric(boltdb, []string{BUCKET_TASKS, BUCKET_TASK_INDEX, BUCKET_TASK_INDEX_KEYS, BUCKET_JOBS, BUCKET_COMMENTS, BUCKET_FLAKINESS}, map[string]string{"database": name}); err != nil {
 		return nil, err
 	} else {
 		d.dbMetric = dbMetric
@@ -499,6 +671,82 @@ func (d *localDB) GetTasksFromDateRange(start, end time.Time) ([]*db.Task, error
 	return result[startIdx:endIdx], nil
 }
 
+// See documentation for db.TaskSearcher interface.
+func (d *localDB) SearchTasks(p *db.TaskSearchParams) (*db.TaskSearchResult, error) {
+	lookups := map[string]string{}
+	for field, value := range map[string]string{
+		TASK_INDEX_BOT:      p.BotId,
+		TASK_INDEX_COMMIT:   p.Commit,
+		TASK_INDEX_ISSUE:    p.Issue,
+		TASK_INDEX_NAME:     p.Name,
+		TASK_INDEX_REPO:     p.Repo,
+		TASK_INDEX_REVISION: p.Revision,
+		TASK_INDEX_STATUS:   string(p.Status),
+	} {
+		if value != "" {
+			lookups[field] = value
+		}
+	}
+	if len(lookups) == 0 {
+		tasks, err := d.GetTasksFromDateRange(p.TimeStart, p.TimeEnd)
+		if err != nil {
+			return nil, err
+		}
+		return db.FilterTasks(tasks, p), nil
+	}
+
+	min := p.TimeStart.Add(-MAX_CREATED_TIME_SKEW).UTC().Format(TIMESTAMP_FORMAT)
+	max := p.TimeEnd.UTC().Format(TIMESTAMP_FORMAT)
+	decoder := db.TaskDecoder{}
+	if err := d.view("SearchTasks", func(tx *bolt.Tx) error {
+		// Find the Ids of Tasks which match all of the indexed fields.
+		var ids map[string]bool
+		c := taskIndexBucket(tx).Cursor()
+		for field, value := range lookups {
+			prefix := taskIndexPrefix(field, value)
+			maxKey := []byte(prefix + max)
+			found := map[string]bool{}
+			for k, _ := c.Seek([]byte(prefix + min)); k != nil && bytes.Compare(k, maxKey) <= 0; k, _ = c.Next() {
+				id := string(k[len(prefix):])
+				if ids == nil || ids[id] {
+					found[id] = true
+				}
+			}
+			ids = found
+			if len(ids) == 0 {
+				return nil
+			}
+		}
+		bucket := tasksBucket(tx)
+		for id := range ids {
+			value := bucket.Get([]byte(id))
+			if value == nil {
+				return fmt.Errorf("Task index refers to nonexistent Task %s", id)
+			}
+			_, serialized, err := unpackTask(value)
+			if err != nil {
+				return err
+			}
+			cpy := make([]byte, len(serialized))
+			copy(cpy, serialized)
+			if !decoder.Process(cpy) {
+				return nil
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	result, err := decoder.Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(db.TaskSlice(result))
+	// The remaining fields, and the exact time range, are checked by
+	// FilterTasks.
+	return db.FilterTasks(result, p), nil
+}
+
 // See documentation for TaskDB interface.
 func (d *localDB) PutTask(t *db.Task) error {
 	return d.PutTasks([]*db.Task{t})
@@ -594,6 +842,9 @@ func (d *localDB) PutTasks(tasks []*db.Task) error {
 			if err := bucket.Put([]byte(t.Id), value); err != nil {
 				return err
 			}
+			if err := updateTaskIndex(tx, t.Id, taskIndexKeys(t)); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
@@ -797,6 +1048,19 @@ func (d *localDB) writeCommentsMap(comments map[string]*db.RepoComments) error {
 	})
 }
 
+// writeFlakinessMap is passed to db.NewFlakinessBoxWithPersistence to persist
+// flakiness statistics after every change. Updates the value stored in
+// BUCKET_FLAKINESS.
+func (d *localDB) writeFlakinessMap(flakiness map[string]*db.RepoFlakiness) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(flakiness); err != nil {
+		return err
+	}
+	return d.update("writeFlakinessMap", func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(BUCKET_FLAKINESS)).Put([]byte(KEY_FLAKINESS_MAP), buf.Bytes())
+	})
+}
+
 // See docs for BackupDBCloser interface.
 func (d *localDB) WriteBackup(w io.Writer) error {
 	return d.view("WriteBackup", func(tx *bolt.Tx) error {
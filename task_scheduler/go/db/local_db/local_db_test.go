@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/boltdb/bolt"
 	assert "github.com/stretchr/testify/require"
 	"go.skia.org/infra/go/testutils"
 	"go.skia.org/infra/go/util"
@@ -137,6 +138,42 @@ func TestPackUnpackV1(t *testing.T) {
 	}
 }
 
+func TestPackUnpackIndexKeys(t *testing.T) {
+	testutils.SmallTest(t)
+	testCases := []struct {
+		keys   [][]byte
+		packed []byte
+	}{
+		{
+			keys:   [][]byte{},
+			packed: []byte{},
+		},
+		{
+			keys:   [][]byte{[]byte("ab"), {}, []byte("c")},
+			packed: []byte{0x02, 'a', 'b', 0x00, 0x01, 'c'},
+		},
+		{
+			keys:   [][]byte{make([]byte, 200)},
+			packed: append([]byte{0xc8, 0x01}, make([]byte, 200)...),
+		},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.packed, packIndexKeys(testCase.keys))
+		keys, err := unpackIndexKeys(testCase.packed)
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.keys, keys)
+	}
+
+	for _, invalid := range [][]byte{
+		{0x80},
+		{0x02, 'a'},
+		{0x01, 'a', 0x03},
+	} {
+		_, err := unpackIndexKeys(invalid)
+		assert.Error(t, err)
+	}
+}
+
 // Create a localDB for testing. Call defer util.RemoveAll() on the second
 // return value.
 func makeDB(t *testing.T, name string) (db.BackupDBCloser, string) {
@@ -617,6 +654,71 @@ func TestLocalDBTaskDBUpdateTasksWithRetries(t *testing.T) {
 	db.TestUpdateTasksWithRetries(t, d)
 }
 
+func TestLocalDBTaskSearch(t *testing.T) {
+	testutils.MediumTest(t)
+	d, tmpdir := makeDB(t, "TestLocalDBTaskSearch")
+	defer util.RemoveAll(tmpdir)
+	defer testutils.AssertCloses(t, d)
+	db.TestTaskSearch(t, d)
+}
+
+// NewDB should build the Task index for a DB which was created before the
+// index existed.
+func TestLocalDBBuildTaskIndex(t *testing.T) {
+	testutils.MediumTest(t)
+	tmpdir, err := ioutil.TempDir("", "TestLocalDBBuildTaskIndex")
+	assert.NoError(t, err)
+	defer util.RemoveAll(tmpdir)
+	filename := filepath.Join(tmpdir, "task.db")
+	d, err := NewDB("TestLocalDBBuildTaskIndex", filename)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	t1 := &db.Task{
+		Created: now,
+		TaskKey: db.TaskKey{
+			Name: "Build",
+		},
+	}
+	assert.NoError(t, d.PutTask(t1))
+
+	check := func(name string, expect ...*db.Task) {
+		rv, err := db.SearchTasks(d, &db.TaskSearchParams{
+			Name:      name,
+			TimeStart: now.Add(-time.Hour),
+			TimeEnd:   now.Add(time.Hour),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, len(expect), rv.Count)
+		for i, task := range expect {
+			assert.Equal(t, task.Id, rv.Tasks[i].Id)
+		}
+	}
+
+	// Either index bucket being missing causes both to be rebuilt.
+	for _, bucket := range []string{BUCKET_TASK_INDEX, BUCKET_TASK_INDEX_KEYS} {
+		assert.NoError(t, d.(*localDB).update("DeleteTaskIndex", func(tx *bolt.Tx) error {
+			return tx.DeleteBucket([]byte(bucket))
+		}))
+		testutils.AssertCloses(t, d)
+
+		d, err = NewDB("TestLocalDBBuildTaskIndex", filename)
+		assert.NoError(t, err)
+		check("Build", t1)
+
+		// Updating the Task must remove its old index entries.
+		t1.Name = "Test"
+		assert.NoError(t, d.PutTask(t1))
+		check("Build")
+		check("Test", t1)
+		t1.Name = "Build"
+		assert.NoError(t, d.PutTask(t1))
+		check("Build", t1)
+		check("Test")
+	}
+	testutils.AssertCloses(t, d)
+}
+
 func TestLocalDBJobDB(t *testing.T) {
 	testutils.MediumTest(t)
 	d, tmpdir := makeDB(t, "TestLocalDBJobDB")
@@ -657,6 +759,37 @@ func TestLocalDBCommentDB(t *testing.T) {
 	db.TestCommentDB(t, d)
 }
 
+func TestLocalDBFlakinessPersistence(t *testing.T) {
+	testutils.MediumTest(t)
+	tmpdir, err := ioutil.TempDir("", "TestLocalDBFlakinessPersistence")
+	assert.NoError(t, err)
+	defer util.RemoveAll(tmpdir)
+	filename := filepath.Join(tmpdir, "task.db")
+	d, err := NewDB("TestLocalDBFlakinessPersistence", filename)
+	assert.NoError(t, err)
+
+	f := &db.RepoFlakiness{
+		Repo: "r1",
+		TaskSpecs: map[string]*db.FlakinessStats{
+			"Test": {Runs: 10, Failures: 3, Flakes: 2},
+		},
+		Bots: map[string]*db.FlakinessStats{
+			"bot1": {Runs: 4, Failures: 1, Flakes: 1},
+		},
+		Updated: time.Unix(1480683321, 0).UTC(),
+	}
+	assert.NoError(t, d.PutFlakiness(f))
+	testutils.AssertCloses(t, d)
+
+	// Reopen the DB and verify that the stats were persisted.
+	d, err = NewDB("TestLocalDBFlakinessPersistence", filename)
+	assert.NoError(t, err)
+	defer testutils.AssertCloses(t, d)
+	rv, err := d.GetFlakinessForRepos([]string{"r1"})
+	assert.NoError(t, err)
+	testutils.AssertDeepEqual(t, []*db.RepoFlakiness{f}, rv)
+}
+
 func TestLocalDBIncrementalBackupTime(t *testing.T) {
 	testutils.MediumTest(t)
 	d, tmpdir := makeDB(t, "TestLocalDBIncrementalBackupTime")
@@ -197,5 +197,5 @@ func NewInMemoryJobDB() JobDB {
 // NewInMemoryDB returns an extremely simple, inefficient, in-memory DB
 // implementation.
 func NewInMemoryDB() DB {
-	return NewDB(NewInMemoryTaskDB(), NewInMemoryJobDB(), &CommentBox{})
+	return NewDB(NewInMemoryTaskDB(), NewInMemoryJobDB(), &CommentBox{}, &FlakinessBox{})
 }
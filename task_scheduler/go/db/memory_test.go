@@ -26,6 +26,11 @@ func TestInMemoryTaskDBUpdateTasksWithRetries(t *testing.T) {
 	TestUpdateTasksWithRetries(t, NewInMemoryTaskDB())
 }
 
+func TestInMemoryTaskSearch(t *testing.T) {
+	testutils.SmallTest(t)
+	TestTaskSearch(t, NewInMemoryTaskDB())
+}
+
 func TestInMemoryJobDB(t *testing.T) {
 	testutils.SmallTest(t)
 	TestJobDB(t, NewInMemoryJobDB())
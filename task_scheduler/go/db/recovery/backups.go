@@ -46,6 +46,19 @@ const (
 	JOB_BACKUP_DIR = "job-backup"
 	// JOB_FILE_NAME_EXTENSION is added to the base filename.
 	JOB_FILE_NAME_EXTENSION = "gob"
+
+	// VERSION_BACKUP_DIR is the prefix of the object name to store versioned
+	// Task and Job backups in the GCS bucket. Unlike JOB_BACKUP_DIR, every
+	// version of each Task and Job is kept, keyed by DbModified, which allows
+	// the DB to be restored as of any point in time.
+	VERSION_BACKUP_DIR = "version-backup"
+	// VERSION_KIND_TASK and VERSION_KIND_JOB are the subdirectories of
+	// VERSION_BACKUP_DIR for Tasks and Jobs, respectively.
+	VERSION_KIND_TASK = "tasks"
+	VERSION_KIND_JOB  = "jobs"
+	// VERSION_TIMESTAMP_FORMAT is used to format DbModified as the base
+	// filename for versioned backups. It sorts lexicographically.
+	VERSION_TIMESTAMP_FORMAT = "20060102T150405.000000000Z"
 )
 
 // DBBackup has methods to trigger periodic and immediate backups.
@@ -75,6 +88,11 @@ type gsDBBackup struct {
 	triggerDir string
 	// modifiedJobsId is the return value of StartTrackingModifiedJobs.
 	modifiedJobsId string
+	// versionTasksId and versionJobsId are the return values of
+	// StartTrackingModifiedTasks and StartTrackingModifiedJobs for
+	// versionBackupStep.
+	versionTasksId string
+	versionJobsId  string
 	// lastDBBackupLiveness records the modified time of the most recent DB
 	// backup.
 	lastDBBackupLiveness metrics2.Liveness
@@ -91,6 +109,12 @@ type gsDBBackup struct {
 	// incrementalBackupResetCount records the number of times GetModifiedJobsGOB
 	// returned ErrUnknownId since the last successful DB backup.
 	incrementalBackupResetCount metrics2.Counter
+	// versionBackupCount records the number of Task and Job versions backed up
+	// since the gsDBBackup was created.
+	versionBackupCount metrics2.Counter
+	// versionBackupLiveness tracks whether versionBackupStep is running
+	// successfully.
+	versionBackupLiveness metrics2.Liveness
 }
 
 // NewDBBackup creates a DBBackup.
@@ -114,6 +138,9 @@ func NewDBBackup(ctx context.Context, gsBucket string, db db.BackupDBCloser, nam
 		if err := b.incrementalBackupStep(time.Now()); err != nil {
 			sklog.Errorf("Incremental Job backup failed: %s", err)
 		}
+		if err := b.versionBackupStep(); err != nil {
+			sklog.Errorf("Versioned Task and Job backup failed: %s", err)
+		}
 	})
 
 	return b, nil
@@ -127,6 +154,14 @@ func newGsDbBackupWithClient(ctx context.Context, gsBucket string, db db.BackupD
 	if err != nil {
 		return nil, err
 	}
+	versionTasksId, err := db.StartTrackingModifiedTasks()
+	if err != nil {
+		return nil, err
+	}
+	versionJobsId, err := db.StartTrackingModifiedJobs()
+	if err != nil {
+		return nil, err
+	}
 	metricTags := map[string]string{
 		"database": name,
 	}
@@ -137,17 +172,23 @@ func newGsDbBackupWithClient(ctx context.Context, gsBucket string, db db.BackupD
 		ctx:                         ctx,
 		triggerDir:                  path.Join(workdir, TRIGGER_DIRNAME),
 		modifiedJobsId:              modJobsId,
+		versionTasksId:              versionTasksId,
+		versionJobsId:               versionJobsId,
 		lastDBBackupLiveness:        metrics2.NewLiveness("last-db-backup", metricTags),
 		recentDBBackupCount:         metrics2.GetInt64Metric("recent-db-backup-count", metricTags),
 		maybeBackupDBLiveness:       metrics2.NewLiveness("db-backup-maybe-backup-db", metricTags),
 		jobBackupCount:              metrics2.GetCounter("incremental-job-backup", metricTags),
 		incrementalBackupLiveness:   metrics2.NewLiveness("incremental-backup", metricTags),
 		incrementalBackupResetCount: metrics2.GetCounter("incremental-backup-reset", metricTags),
+		versionBackupCount:          metrics2.GetCounter("version-backup", metricTags),
+		versionBackupLiveness:       metrics2.NewLiveness("last-version-backup", metricTags),
 	}
 	// Release resources when done.
 	go func() {
 		<-ctx.Done()
-		b.db.StopTrackingModifiedTasks(b.modifiedJobsId)
+		b.db.StopTrackingModifiedJobs(b.modifiedJobsId)
+		b.db.StopTrackingModifiedTasks(b.versionTasksId)
+		b.db.StopTrackingModifiedJobs(b.versionJobsId)
 		// TODO(benjaminwagner): Liveness doesn't have a Delete method.
 		//if err := b.lastDBBackupLiveness.Delete(); err != nil {
 		//	sklog.Error(err)
@@ -169,6 +210,9 @@ func newGsDbBackupWithClient(ctx context.Context, gsBucket string, db db.BackupD
 		if err := b.incrementalBackupResetCount.Delete(); err != nil {
 			sklog.Error(err)
 		}
+		if err := b.versionBackupCount.Delete(); err != nil {
+			sklog.Error(err)
+		}
 	}()
 	return b, nil
 }
@@ -463,16 +507,115 @@ func (b *gsDBBackup) incrementalBackupStep(now time.Time) error {
 		}
 		b.incrementalBackupLiveness.Reset()
 		return nil
-	} else if len(errs) == 1 {
+	}
+	return combineErrors("Multiple errors performing incremental Job backups:", errs)
+}
+
+// combineErrors returns the single error in errs or an error containing msg
+// followed by each of errs.
+func combineErrors(msg string, errs []error) error {
+	if len(errs) == 1 {
 		return errs[0]
+	}
+	errStr := &bytes.Buffer{}
+	fmt.Fprint(errStr, msg)
+	for _, err := range errs {
+		fmt.Fprint(errStr, "\n", err.Error())
+	}
+	return errors.New(errStr.String())
+}
+
+// formatVersionObjectName returns the GCS object name for the version of a Task
+// or Job with the given id and DbModified time. kind is VERSION_KIND_TASK or
+// VERSION_KIND_JOB.
+func formatVersionObjectName(kind, id string, dbModified time.Time) string {
+	ts := dbModified.UTC()
+	return fmt.Sprintf("%s/%s/%s/%s/%s.%s", VERSION_BACKUP_DIR, kind, ts.Format("2006/01/02"), id, ts.Format(VERSION_TIMESTAMP_FORMAT), JOB_FILE_NAME_EXTENSION)
+}
+
+// formatVersionDirName returns the GCS object name prefix for versions of
+// Tasks or Jobs modified on the same day as the given time.
+func formatVersionDirName(kind string, ts time.Time) string {
+	return fmt.Sprintf("%s/%s/%s/", VERSION_BACKUP_DIR, kind, ts.UTC().Format("2006/01/02"))
+}
+
+// parseVersionObjectName returns the Task or Job ID and DbModified time from a
+// GCS object name formatted with formatVersionObjectName.
+func parseVersionObjectName(name string) (string, time.Time, error) {
+	id := path.Base(path.Dir(name))
+	ts, err := time.Parse(VERSION_TIMESTAMP_FORMAT, strings.TrimSuffix(path.Base(name), "."+JOB_FILE_NAME_EXTENSION))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("Unable to parse version object name %q: %s", name, err)
+	}
+	return id, ts, nil
+}
+
+// backupVersions writes each of the given GOB-encoded Tasks or Jobs to GCS.
+// getDbModified decodes the DbModified time from the GOB. Returns the errors
+// encountered.
+func (b *gsDBBackup) backupVersions(kind string, gobs map[string][]byte, getDbModified func([]byte) (time.Time, error)) []error {
+	bucket := b.gsClient.Bucket(b.gsBucket)
+	errs := []error{}
+	for id, g := range gobs {
+		dbModified, err := getDbModified(g)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Unable to decode %s %s: %s", kind, id, err))
+			continue
+		}
+		if err := upload(b.ctx, bytes.NewReader(g), bucket, formatVersionObjectName(kind, id, dbModified), dbModified); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		b.versionBackupCount.Inc(1)
+	}
+	return errs
+}
+
+// versionBackupStep writes a new version of every recently modified Task and
+// Job to GCS.
+func (b *gsDBBackup) versionBackupStep() error {
+	errs := []error{}
+	tasks, err := b.db.GetModifiedTasksGOB(b.versionTasksId)
+	if db.IsUnknownId(err) {
+		sklog.Errorf("versionBackupStep too slow; GetModifiedTasksGOB expired id: %s", b.versionTasksId)
+		id, startErr := b.db.StartTrackingModifiedTasks()
+		if startErr != nil {
+			return startErr
+		}
+		b.versionTasksId = id
+		errs = append(errs, err)
+	} else if err != nil {
+		errs = append(errs, err)
 	} else {
-		errStr := &bytes.Buffer{}
-		fmt.Fprint(errStr, "Multiple errors performing incremental Job backups:")
-		for _, err := range errs {
-			fmt.Fprint(errStr, "\n", err.Error())
+		errs = append(errs, b.backupVersions(VERSION_KIND_TASK, tasks, func(g []byte) (time.Time, error) {
+			var t db.Task
+			err := gob.NewDecoder(bytes.NewReader(g)).Decode(&t)
+			return t.DbModified, err
+		})...)
+	}
+	jobs, err := b.db.GetModifiedJobsGOB(b.versionJobsId)
+	if db.IsUnknownId(err) {
+		sklog.Errorf("versionBackupStep too slow; GetModifiedJobsGOB expired id: %s", b.versionJobsId)
+		id, startErr := b.db.StartTrackingModifiedJobs()
+		if startErr != nil {
+			return startErr
 		}
-		return errors.New(errStr.String())
+		b.versionJobsId = id
+		errs = append(errs, err)
+	} else if err != nil {
+		errs = append(errs, err)
+	} else {
+		errs = append(errs, b.backupVersions(VERSION_KIND_JOB, jobs, func(g []byte) (time.Time, error) {
+			var j db.Job
+			err := gob.NewDecoder(bytes.NewReader(g)).Decode(&j)
+			return j.DbModified, err
+		})...)
+	}
+	if len(errs) == 0 {
+		b.versionBackupLiveness.Reset()
+		return nil
 	}
+	return combineErrors("Multiple errors performing versioned Task and Job backups:", errs)
 }
 
 // downloadGOB reads and GOB-decodes the given object from GCS.
@@ -887,6 +887,25 @@ func TestParseIdFromJobObjectName(t *testing.T) {
 	test("20161116T220425.634818978Z_0000000000001e88")
 }
 
+func TestFormatVersionObjectName(t *testing.T) {
+	testutils.SmallTest(t)
+	ts := time.Date(2016, 2, 29, 1, 2, 3, 4, time.UTC)
+	assert.Equal(t, "version-backup/tasks/2016/02/29/nurse/20160229T010203.000000004Z.gob", formatVersionObjectName(VERSION_KIND_TASK, "nurse", ts))
+	assert.Equal(t, "version-backup/jobs/2016/02/29/", formatVersionDirName(VERSION_KIND_JOB, ts))
+	test := func(id string) {
+		actualId, actualTs, err := parseVersionObjectName(formatVersionObjectName(VERSION_KIND_JOB, id, ts))
+		assert.NoError(t, err)
+		assert.Equal(t, id, actualId)
+		assert.True(t, ts.Equal(actualTs))
+	}
+	test("police-officer")
+	test("name.with.internal.dots")
+	test("20161116T220425.634818978Z_0000000000001e88")
+
+	_, _, err := parseVersionObjectName("version-backup/jobs/2016/02/29/nurse.gob")
+	assert.Error(t, err)
+}
+
 // makeJob returns a dummy Job without Id and DbModified set.
 func makeJob(now time.Time) *db.Job {
 	return &db.Job{
@@ -1211,6 +1230,94 @@ func TestIncrementalBackupStepSetTSError(t *testing.T) {
 	assert.True(t, b.incrementalBackupLiveness.Get() > MAX_TEST_TIME_SECONDS)
 }
 
+// versionBackupStep should back up every version of each added or modified
+// Task and Job.
+func TestVersionBackupStep(t *testing.T) {
+	testutils.SmallTest(t)
+	now := time.Now()
+
+	r := mux.NewRouter()
+	actualBytesGzip := map[string][]byte{}
+	addMultipartHandler(t, r, actualBytesGzip)
+
+	b, cancel := getMockedDBBackup(t, r)
+	defer cancel()
+
+	// Metrics occasionally fail to be deleted, so we might have a leftover from a
+	// previous test.
+	beforeCount := b.versionBackupCount.Get()
+
+	b.versionBackupLiveness.ManualReset(time.Time{})
+
+	checkUploaded := func(name string, expected, actual interface{}) {
+		gzR, err := gzip.NewReader(bytes.NewReader(actualBytesGzip[name]))
+		assert.NoError(t, err)
+		assert.NoError(t, gob.NewDecoder(gzR).Decode(actual))
+		assert.NoError(t, gzR.Close())
+		testutils.AssertDeepEqual(t, expected, actual)
+	}
+
+	// Add a task and a job.
+	t1 := &db.Task{Created: now.UTC()}
+	assert.NoError(t, b.db.PutTask(t1))
+	j1 := makeJob(now)
+	assert.NoError(t, b.db.PutJob(j1))
+	t1Name := formatVersionObjectName(VERSION_KIND_TASK, t1.Id, t1.DbModified)
+	j1Name := formatVersionObjectName(VERSION_KIND_JOB, j1.Id, j1.DbModified)
+
+	assert.NoError(t, b.versionBackupStep())
+	checkUploaded(t1Name, t1, &db.Task{})
+	checkUploaded(j1Name, j1, &db.Job{})
+	assert.True(t, b.versionBackupLiveness.Get() < MAX_TEST_TIME_SECONDS)
+	assert.Equal(t, beforeCount+2, b.versionBackupCount.Get())
+
+	// Modify the job. The original version is kept.
+	t1Orig := t1.Copy()
+	j1Orig := j1.Copy()
+	j1.Status = db.JOB_STATUS_CANCELED
+	assert.NoError(t, b.db.PutJob(j1))
+	j1NewName := formatVersionObjectName(VERSION_KIND_JOB, j1.Id, j1.DbModified)
+	assert.NotEqual(t, j1Name, j1NewName)
+
+	assert.NoError(t, b.versionBackupStep())
+	checkUploaded(t1Name, t1Orig, &db.Task{})
+	checkUploaded(j1Name, j1Orig, &db.Job{})
+	checkUploaded(j1NewName, j1, &db.Job{})
+	assert.Equal(t, 3, len(actualBytesGzip))
+	assert.Equal(t, beforeCount+3, b.versionBackupCount.Get())
+}
+
+// versionBackupStep should restart modified data tracking on ErrUnknownId.
+func TestVersionBackupStepReset(t *testing.T) {
+	testutils.SmallTest(t)
+	r := mux.NewRouter()
+
+	actualBytesGzip := map[string][]byte{}
+	addMultipartHandler(t, r, actualBytesGzip)
+
+	b, cancel := getMockedDBBackup(t, r)
+	defer cancel()
+
+	b.versionBackupLiveness.ManualReset(time.Time{})
+
+	// Invalidate the IDs.
+	b.db.StopTrackingModifiedTasks(b.versionTasksId)
+	b.db.StopTrackingModifiedJobs(b.versionJobsId)
+
+	err := b.versionBackupStep()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Multiple errors performing versioned Task and Job backups")
+	assert.True(t, b.versionBackupLiveness.Get() > MAX_TEST_TIME_SECONDS)
+
+	// Ensure next round succeeds.
+	t1 := &db.Task{Created: time.Now().UTC()}
+	assert.NoError(t, b.db.PutTask(t1))
+	assert.NoError(t, b.versionBackupStep())
+	assert.True(t, b.versionBackupLiveness.Get() < MAX_TEST_TIME_SECONDS)
+	assert.Equal(t, 1, len(actualBytesGzip))
+	assert.True(t, len(actualBytesGzip[formatVersionObjectName(VERSION_KIND_TASK, t1.Id, t1.DbModified)]) > 0)
+}
+
 // addGetObjectHandler causes r to respond to a request for the contents of
 // TEST_BUCKET/name with the given contents.
 func addGetObjectHandler(t *testing.T, r *mux.Router, name string, contents []byte) {
@@ -0,0 +1,351 @@
+// Implementation of restoring a DB from backups in Google Cloud Storage (GCS).
+package recovery
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"go.skia.org/infra/go/gcs"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/db"
+	"go.skia.org/infra/task_scheduler/go/db/local_db"
+	"golang.org/x/net/context"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	// RESTORE_REPLAY_PERIOD is how long before a full DB backup was uploaded
+	// that we begin replaying versioned backups on top of it. Writing and
+	// uploading a full DB backup takes much less time than this, so any
+	// change which is not included in the full backup is replayed.
+	RESTORE_REPLAY_PERIOD = 24 * time.Hour
+)
+
+// findDBBackup returns the attributes of the most recent full DB backup which
+// was uploaded no later than target.
+func findDBBackup(gsClient *storage.Client, gsBucket string, target time.Time) (*storage.ObjectAttrs, error) {
+	var rv *storage.ObjectAttrs
+	if err := gcs.AllFilesInDir(gsClient, gsBucket, DB_BACKUP_DIR, func(item *storage.ObjectAttrs) {
+		if item.Updated.After(target) {
+			return
+		}
+		if rv == nil || item.Updated.After(rv.Updated) {
+			rv = item
+		}
+	}); err != nil {
+		return nil, fmt.Errorf("Unable to list DB backups in %s/%s: %s", gsBucket, DB_BACKUP_DIR, err)
+	}
+	if rv == nil {
+		return nil, fmt.Errorf("No DB backup in %s/%s was created before %s.", gsBucket, DB_BACKUP_DIR, target)
+	}
+	return rv, nil
+}
+
+// downloadFile writes the given object from GCS to the given file.
+func downloadFile(ctx context.Context, bucket *storage.BucketHandle, objectname string, filename string) (err error) {
+	objR, err := bucket.Object(objectname).NewReader(ctx)
+	if err != nil {
+		return err
+	}
+	// As long as we can read the object, we don't care if Close returns an
+	// error.
+	defer util.Close(objR)
+	fileW, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("Could not create file to write DB backup: %s", err)
+	}
+	defer func() {
+		// We set fileW to nil when we manually close it below.
+		if fileW != nil {
+			util.Close(fileW)
+		}
+	}()
+	// As in downloadGOB, GCS decompresses the object on the server side.
+	if _, err := io.Copy(fileW, objR); err != nil {
+		return err
+	}
+	err, fileW = fileW.Close(), nil
+	return err
+}
+
+// retrieveVersionNames returns the GCS object name of the most recent version
+// of each Task or Job of the given kind which was modified between since and
+// until, inclusive, as a map[id]objectname.
+func retrieveVersionNames(ctx context.Context, bucket *storage.BucketHandle, kind string, since, until time.Time) (map[string]string, error) {
+	rv := map[string]string{}
+	versions := map[string]time.Time{}
+	lastDir := formatVersionDirName(kind, until)
+	// Iterate from sinceDir forward to lastDir.
+	for t := since; ; t = t.Add(24 * time.Hour) {
+		curDir := formatVersionDirName(kind, t)
+		if curDir > lastDir {
+			break
+		}
+		q := &storage.Query{Prefix: curDir, Versions: false}
+		it := bucket.Objects(ctx, q)
+		for obj, err := it.Next(); err != iterator.Done; obj, err = it.Next() {
+			if err != nil {
+				return nil, fmt.Errorf("Unable to list %s in %s: %s", kind, curDir, err)
+			}
+			id, ts, err := parseVersionObjectName(obj.Name)
+			if err != nil {
+				return nil, err
+			}
+			if ts.Before(since) || ts.After(until) {
+				continue
+			}
+			if prev, ok := versions[id]; ok && !ts.After(prev) {
+				continue
+			}
+			versions[id] = ts
+			rv[id] = obj.Name
+		}
+	}
+	return rv, nil
+}
+
+// RetrieveVersions returns the most recent backed-up version of each Task and
+// Job which was modified between since and until, inclusive, as
+// map[Task.Id]*Task and map[Job.Id]*Job.
+func RetrieveVersions(ctx context.Context, gsClient *storage.Client, gsBucket string, since, until time.Time) (map[string]*db.Task, map[string]*db.Job, error) {
+	bucket := gsClient.Bucket(gsBucket)
+	taskNames, err := retrieveVersionNames(ctx, bucket, VERSION_KIND_TASK, since, until)
+	if err != nil {
+		return nil, nil, err
+	}
+	jobNames, err := retrieveVersionNames(ctx, bucket, VERSION_KIND_JOB, since, until)
+	if err != nil {
+		return nil, nil, err
+	}
+	tasks := make(map[string]*db.Task, len(taskNames))
+	for id, name := range taskNames {
+		var task db.Task
+		if err := downloadGOB(ctx, bucket, name, &task); err != nil {
+			return nil, nil, fmt.Errorf("Unable to read %s/%s: %s", gsBucket, name, err)
+		}
+		tasks[id] = &task
+	}
+	jobs := make(map[string]*db.Job, len(jobNames))
+	for id, name := range jobNames {
+		var job db.Job
+		if err := downloadGOB(ctx, bucket, name, &job); err != nil {
+			return nil, nil, fmt.Errorf("Unable to read %s/%s: %s", gsBucket, name, err)
+		}
+		jobs[id] = &job
+	}
+	return tasks, jobs, nil
+}
+
+// replayTasks writes each of the given Tasks to d unless d already contains
+// the same or a newer version. The DbModified time of the written Tasks is
+// set by d.
+func replayTasks(d db.DB, tasks map[string]*db.Task) (int, error) {
+	toPut := make([]*db.Task, 0, len(tasks))
+	for id, task := range tasks {
+		existing, err := d.GetTaskById(id)
+		if err != nil {
+			return 0, err
+		}
+		if existing != nil {
+			if !task.DbModified.After(existing.DbModified) {
+				continue
+			}
+			task.DbModified = existing.DbModified
+		} else {
+			task.DbModified = time.Time{}
+		}
+		toPut = append(toPut, task)
+	}
+	sort.Sort(db.TaskSlice(toPut))
+	return len(toPut), d.PutTasks(toPut)
+}
+
+// replayJobs writes each of the given Jobs to d unless d already contains the
+// same or a newer version. The DbModified time of the written Jobs is set by
+// d.
+func replayJobs(d db.DB, jobs map[string]*db.Job) (int, error) {
+	toPut := make([]*db.Job, 0, len(jobs))
+	for id, job := range jobs {
+		existing, err := d.GetJobById(id)
+		if err != nil {
+			return 0, err
+		}
+		if existing != nil {
+			if !job.DbModified.After(existing.DbModified) {
+				continue
+			}
+			job.DbModified = existing.DbModified
+		} else {
+			job.DbModified = time.Time{}
+		}
+		toPut = append(toPut, job)
+	}
+	sort.Sort(db.JobSlice(toPut))
+	return len(toPut), d.PutJobs(toPut)
+}
+
+// RestoreDB writes a local_db to the given file containing the contents of
+// the backed-up DB as of the given target time. The most recent full DB backup
+// uploaded before target is used as a base, and versioned backups of Tasks
+// and Jobs modified up to target are replayed on top of it. Tasks and Jobs
+// which are replayed have their DbModified time set to the time of the
+// restore.
+func RestoreDB(ctx context.Context, gsClient *storage.Client, gsBucket string, target time.Time, filename string) error {
+	backup, err := findDBBackup(gsClient, gsBucket, target)
+	if err != nil {
+		return err
+	}
+	sklog.Infof("Downloading DB backup %s/%s, uploaded at %s.", gsBucket, backup.Name, backup.Updated)
+	if err := downloadFile(ctx, gsClient.Bucket(gsBucket), backup.Name, filename); err != nil {
+		return fmt.Errorf("Unable to download %s/%s: %s", gsBucket, backup.Name, err)
+	}
+
+	since := backup.Updated.Add(-RESTORE_REPLAY_PERIOD)
+	sklog.Infof("Retrieving Task and Job versions from %s to %s.", since, target)
+	tasks, jobs, err := RetrieveVersions(ctx, gsClient, gsBucket, since, target)
+	if err != nil {
+		return err
+	}
+
+	d, err := local_db.NewDB("task-scheduler-restore", filename)
+	if err != nil {
+		return err
+	}
+	defer util.Close(d)
+	taskCount, err := replayTasks(d, tasks)
+	if err != nil {
+		return fmt.Errorf("Unable to replay Tasks: %s", err)
+	}
+	jobCount, err := replayJobs(d, jobs)
+	if err != nil {
+		return fmt.Errorf("Unable to replay Jobs: %s", err)
+	}
+	sklog.Infof("Replayed %d Tasks and %d Jobs.", taskCount, jobCount)
+	return d.SetIncrementalBackupTime(target)
+}
+
+// IntegrityReport describes the differences between a restored DB and a live
+// DB. All fields contain sorted IDs.
+type IntegrityReport struct {
+	// MissingTasks and MissingJobs are in the live DB but not in the restored
+	// DB.
+	MissingTasks []string `json:"missingTasks"`
+	MissingJobs  []string `json:"missingJobs"`
+
+	// ExtraTasks and ExtraJobs are in the restored DB but not in the live DB.
+	ExtraTasks []string `json:"extraTasks"`
+	ExtraJobs  []string `json:"extraJobs"`
+
+	// MismatchedTasks and MismatchedJobs differ between the restored and live
+	// DBs, even though they were not modified in the live DB after the target
+	// time.
+	MismatchedTasks []string `json:"mismatchedTasks"`
+	MismatchedJobs  []string `json:"mismatchedJobs"`
+
+	// ModifiedTasks and ModifiedJobs differ between the restored and live DBs
+	// because they were modified in the live DB after the target time. These
+	// are expected and do not indicate a problem.
+	ModifiedTasks []string `json:"modifiedTasks"`
+	ModifiedJobs  []string `json:"modifiedJobs"`
+}
+
+// Ok returns true if the restored DB is consistent with the live DB.
+func (r *IntegrityReport) Ok() bool {
+	return len(r.MissingTasks) == 0 && len(r.MissingJobs) == 0 &&
+		len(r.ExtraTasks) == 0 && len(r.ExtraJobs) == 0 &&
+		len(r.MismatchedTasks) == 0 && len(r.MismatchedJobs) == 0
+}
+
+// classify adds id to the appropriate list given whether the item is in the
+// restored and live DBs, whether the two versions are equal, and whether the
+// live version was modified after the target time.
+func classify(id string, inRestored, inLive, equal, modifiedAfterTarget bool, missing, extra, mismatched, modified *[]string) {
+	if !inLive {
+		*extra = append(*extra, id)
+	} else if modifiedAfterTarget {
+		if inRestored && !equal {
+			*modified = append(*modified, id)
+		}
+	} else if !inRestored {
+		*missing = append(*missing, id)
+	} else if !equal {
+		*mismatched = append(*mismatched, id)
+	}
+}
+
+// VerifyDB compares the Tasks and Jobs created between from and target in the
+// restored DB to those in the live DB. DbModified is ignored when comparing,
+// since it is changed by RestoreDB.
+func VerifyDB(restored, live db.RemoteDB, from, target time.Time) (*IntegrityReport, error) {
+	r := &IntegrityReport{
+		MissingTasks:    []string{},
+		MissingJobs:     []string{},
+		ExtraTasks:      []string{},
+		ExtraJobs:       []string{},
+		MismatchedTasks: []string{},
+		MismatchedJobs:  []string{},
+		ModifiedTasks:   []string{},
+		ModifiedJobs:    []string{},
+	}
+
+	restoredTasks, err := restored.GetTasksFromDateRange(from, target)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read Tasks from restored DB: %s", err)
+	}
+	liveTasks, err := live.GetTasksFromDateRange(from, target)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read Tasks from live DB: %s", err)
+	}
+	restoredTaskMap := make(map[string]*db.Task, len(restoredTasks))
+	for _, t := range restoredTasks {
+		cpy := t.Copy()
+		cpy.DbModified = time.Time{}
+		restoredTaskMap[t.Id] = cpy
+	}
+	for _, t := range liveTasks {
+		cpy := t.Copy()
+		cpy.DbModified = time.Time{}
+		restoredTask, ok := restoredTaskMap[t.Id]
+		delete(restoredTaskMap, t.Id)
+		classify(t.Id, ok, true, ok && reflect.DeepEqual(restoredTask, cpy), t.DbModified.After(target), &r.MissingTasks, &r.ExtraTasks, &r.MismatchedTasks, &r.ModifiedTasks)
+	}
+	for id := range restoredTaskMap {
+		classify(id, true, false, false, false, &r.MissingTasks, &r.ExtraTasks, &r.MismatchedTasks, &r.ModifiedTasks)
+	}
+
+	restoredJobs, err := restored.GetJobsFromDateRange(from, target)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read Jobs from restored DB: %s", err)
+	}
+	liveJobs, err := live.GetJobsFromDateRange(from, target)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read Jobs from live DB: %s", err)
+	}
+	restoredJobMap := make(map[string]*db.Job, len(restoredJobs))
+	for _, j := range restoredJobs {
+		cpy := j.Copy()
+		cpy.DbModified = time.Time{}
+		restoredJobMap[j.Id] = cpy
+	}
+	for _, j := range liveJobs {
+		cpy := j.Copy()
+		cpy.DbModified = time.Time{}
+		restoredJob, ok := restoredJobMap[j.Id]
+		delete(restoredJobMap, j.Id)
+		classify(j.Id, ok, true, ok && reflect.DeepEqual(restoredJob, cpy), j.DbModified.After(target), &r.MissingJobs, &r.ExtraJobs, &r.MismatchedJobs, &r.ModifiedJobs)
+	}
+	for id := range restoredJobMap {
+		classify(id, true, false, false, false, &r.MissingJobs, &r.ExtraJobs, &r.MismatchedJobs, &r.ModifiedJobs)
+	}
+
+	for _, ids := range [][]string{r.MissingTasks, r.MissingJobs, r.ExtraTasks, r.ExtraJobs, r.MismatchedTasks, r.MismatchedJobs, r.ModifiedTasks, r.ModifiedJobs} {
+		sort.Strings(ids)
+	}
+	return r, nil
+}
@@ -0,0 +1,109 @@
+// Restore the Task Scheduler DB as of a given time from backups in GCS, or
+// verify a restored DB against a live DB.
+//
+// Example:
+//   restore_db --db_file=/tmp/restored.bdb --target=2017-03-01T12:00:00Z
+//   restore_db --db_file=/tmp/restored.bdb --target=2017-03-01T12:00:00Z --verify --task_db_url=http://skia-task-scheduler:8008/db/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/net/context"
+	"google.golang.org/api/option"
+
+	"go.skia.org/infra/go/auth"
+	"go.skia.org/infra/go/common"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/db/local_db"
+	"go.skia.org/infra/task_scheduler/go/db/recovery"
+	"go.skia.org/infra/task_scheduler/go/db/remote_db"
+)
+
+var (
+	dbFile       = flag.String("db_file", "", "Local DB file to write, or to read if --verify is set.")
+	gsBucket     = flag.String("bucket", "skia-task-scheduler", "GCS bucket to read.")
+	target       = flag.String("target", "", "Time as of which to restore the DB, in RFC3339 format. Defaults to the current time.")
+	taskDbUrl    = flag.String("task_db_url", "", "Address of the live Task Scheduler remote DB, used with --verify.")
+	verify       = flag.Bool("verify", false, "Instead of restoring, compare the existing --db_file to the live DB at --task_db_url.")
+	verifyPeriod = flag.Duration("verify_period", 24*time.Hour, "Duration of time range before --target to compare with --verify.")
+)
+
+func main() {
+	defer common.LogPanic()
+
+	// Global init.
+	common.Init()
+
+	if *dbFile == "" {
+		sklog.Fatal("--db_file is required.")
+	}
+	targetTime := time.Now().UTC()
+	if *target != "" {
+		var err error
+		targetTime, err = time.Parse(time.RFC3339, *target)
+		if err != nil {
+			sklog.Fatalf("Invalid --target: %s", err)
+		}
+	}
+
+	if *verify {
+		if *taskDbUrl == "" {
+			sklog.Fatal("--task_db_url is required with --verify.")
+		}
+		restored, err := local_db.NewDB("task-scheduler-restore", *dbFile)
+		if err != nil {
+			sklog.Fatal(err)
+		}
+		defer util.Close(restored)
+		live, err := remote_db.NewClient(*taskDbUrl)
+		if err != nil {
+			sklog.Fatal(err)
+		}
+		sklog.Infof("Comparing %s to %s from %s to %s...", *dbFile, *taskDbUrl, targetTime.Add(-*verifyPeriod), targetTime)
+		report, err := recovery.VerifyDB(restored, live, targetTime.Add(-*verifyPeriod), targetTime)
+		if err != nil {
+			sklog.Fatal(err)
+		}
+		enc, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			sklog.Fatal(err)
+		}
+		if _, err := os.Stdout.Write(enc); err != nil {
+			sklog.Fatal(err)
+		}
+		fmt.Fprintln(os.Stdout)
+		if !report.Ok() {
+			sklog.Fatal("Restored DB does not match the live DB.")
+		}
+		return
+	}
+
+	if _, err := os.Stat(*dbFile); err == nil {
+		sklog.Fatalf("%s already exists; refusing to overwrite it.", *dbFile)
+	}
+
+	// Authenticated HTTP client.
+	httpClient, err := auth.NewClient(true, "", auth.SCOPE_READ_ONLY)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+
+	ctx := context.Background()
+	gsClient, err := storage.NewClient(ctx, option.WithHTTPClient(httpClient))
+	if err != nil {
+		sklog.Fatal(err)
+	}
+
+	sklog.Infof("Restoring DB as of %s to %s...", targetTime, *dbFile)
+	if err := recovery.RestoreDB(ctx, gsClient, *gsBucket, targetTime, *dbFile); err != nil {
+		sklog.Fatal(err)
+	}
+	sklog.Infof("Restored DB to %s.", *dbFile)
+}
@@ -0,0 +1,148 @@
+package recovery
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/task_scheduler/go/db"
+)
+
+// RetrieveVersions should return the most recent version of each Task modified
+// within the given time range.
+func TestRetrieveVersions(t *testing.T) {
+	testutils.SmallTest(t)
+
+	r := mux.NewRouter()
+	now := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	since := now.Add(-time.Minute)
+	prefix := formatVersionDirName(VERSION_KIND_TASK, now)
+
+	// t1 has two versions before now and one after.
+	t1 := &db.Task{Id: "t1", Created: since}
+	objs := []object{}
+	for _, ts := range []time.Time{since.Add(time.Second), now, now.Add(time.Second)} {
+		objs = append(objs, object{TEST_BUCKET, formatVersionObjectName(VERSION_KIND_TASK, t1.Id, ts), ts})
+	}
+	// t2 has one version before since.
+	objs = append(objs, object{TEST_BUCKET, formatVersionObjectName(VERSION_KIND_TASK, "t2", since.Add(-time.Second)), since})
+	addListObjectsHandler(t, r, prefix, objs)
+	addListObjectsHandler(t, r, formatVersionDirName(VERSION_KIND_JOB, now), []object{})
+
+	t1.DbModified = now
+	buf := &bytes.Buffer{}
+	assert.NoError(t, gob.NewEncoder(buf).Encode(t1))
+	addGetObjectHandler(t, r, formatVersionObjectName(VERSION_KIND_TASK, t1.Id, now), buf.Bytes())
+
+	b, cancel := getMockedDBBackup(t, r)
+	defer cancel()
+
+	tasks, jobs, err := RetrieveVersions(b.ctx, b.gsClient, b.gsBucket, since, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(jobs))
+	assert.Equal(t, 1, len(tasks))
+	testutils.AssertDeepEqual(t, t1, tasks[t1.Id])
+}
+
+// replayTasks and replayJobs should write only versions which are newer than
+// those in the DB.
+func TestReplay(t *testing.T) {
+	testutils.SmallTest(t)
+	d := db.NewInMemoryDB()
+	now := time.Now()
+
+	t1 := &db.Task{Created: now}
+	t2 := &db.Task{Created: now}
+	assert.NoError(t, d.PutTasks([]*db.Task{t1, t2}))
+
+	// t1 was modified after the backup; t2 was backed up before its current
+	// version; t3 is not in the DB at all.
+	t1New := t1.Copy()
+	t1New.Status = db.TASK_STATUS_SUCCESS
+	t1New.DbModified = t1.DbModified.Add(time.Second)
+	t2Old := t2.Copy()
+	t2Old.Status = db.TASK_STATUS_FAILURE
+	t2Old.DbModified = t2.DbModified.Add(-time.Second)
+	t3 := &db.Task{Id: "t3", Created: now, Status: db.TASK_STATUS_RUNNING}
+	count, err := replayTasks(d, map[string]*db.Task{
+		t1New.Id: t1New,
+		t2Old.Id: t2Old,
+		t3.Id:    t3,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	for _, expected := range []*db.Task{t1New, t2, t3} {
+		actual, err := d.GetTaskById(expected.Id)
+		assert.NoError(t, err)
+		assert.NotNil(t, actual)
+		assert.Equal(t, expected.Status, actual.Status)
+	}
+
+	j1 := makeJob(now)
+	assert.NoError(t, d.PutJob(j1))
+	j1New := j1.Copy()
+	j1New.Status = db.JOB_STATUS_CANCELED
+	j1New.DbModified = j1.DbModified.Add(time.Second)
+	count, err = replayJobs(d, map[string]*db.Job{j1New.Id: j1New})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	actual, err := d.GetJobById(j1.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, db.JOB_STATUS_CANCELED, actual.Status)
+}
+
+// VerifyDB should report each kind of difference between the DBs.
+func TestVerifyDB(t *testing.T) {
+	testutils.SmallTest(t)
+	restored := db.NewInMemoryDB()
+	live := db.NewInMemoryDB()
+	now := time.Now()
+	from := now.Add(-time.Hour)
+
+	task := func(status db.TaskStatus) *db.Task {
+		return &db.Task{
+			Created: now.Add(-time.Minute),
+			Status:  status,
+		}
+	}
+	same := task(db.TASK_STATUS_SUCCESS)
+	missing := task(db.TASK_STATUS_SUCCESS)
+	mismatched := task(db.TASK_STATUS_SUCCESS)
+	modified := task(db.TASK_STATUS_RUNNING)
+	assert.NoError(t, live.PutTasks([]*db.Task{same, missing, mismatched, modified}))
+	mismatchedCopy := mismatched.Copy()
+	mismatchedCopy.Status = db.TASK_STATUS_FAILURE
+	extra := task(db.TASK_STATUS_SUCCESS)
+	extra.Id = "extra"
+	assert.NoError(t, restored.PutTasks([]*db.Task{same.Copy(), mismatchedCopy, modified.Copy(), extra}))
+
+	missingJob := makeJob(now.Add(-time.Minute))
+	assert.NoError(t, live.PutJob(missingJob))
+
+	target := time.Now()
+	time.Sleep(time.Millisecond)
+	modified.Status = db.TASK_STATUS_SUCCESS
+	assert.NoError(t, live.PutTask(modified))
+
+	r, err := VerifyDB(restored, live, from, target)
+	assert.NoError(t, err)
+	testutils.AssertDeepEqual(t, &IntegrityReport{
+		MissingTasks:    []string{missing.Id},
+		MissingJobs:     []string{missingJob.Id},
+		ExtraTasks:      []string{extra.Id},
+		ExtraJobs:       []string{},
+		MismatchedTasks: []string{mismatched.Id},
+		MismatchedJobs:  []string{},
+		ModifiedTasks:   []string{modified.Id},
+		ModifiedJobs:    []string{},
+	}, r)
+	assert.False(t, r.Ok())
+
+	r, err = VerifyDB(live, live, from, target)
+	assert.NoError(t, err)
+	assert.True(t, r.Ok())
+}
@@ -25,6 +25,7 @@ const (
 	// Server handles requests on these paths. See registerHandlers for detail.
 	MODIFIED_TASKS_PATH     = "modified-tasks"
 	TASKS_PATH              = "tasks"
+	TASK_SEARCH_PATH        = "tasks/search"
 	MODIFIED_JOBS_PATH      = "modified-jobs"
 	JOBS_PATH               = "jobs"
 	COMMENTS_PATH           = "comments"
@@ -66,6 +67,7 @@ func (s *server) registerHandlers(r *mux.Router) {
 	r.HandleFunc("/"+MODIFIED_TASKS_PATH, s.DeleteModifiedTasksHandler).Methods(http.MethodDelete)
 	r.HandleFunc("/"+MODIFIED_TASKS_PATH, s.GetModifiedTasksHandler).Methods(http.MethodGet)
 	r.HandleFunc("/"+TASKS_PATH, s.GetTasksHandler).Methods(http.MethodGet)
+	r.HandleFunc("/"+TASK_SEARCH_PATH, s.PostTaskSearchHandler).Methods(http.MethodPost)
 	r.HandleFunc("/"+MODIFIED_JOBS_PATH, s.PostModifiedJobsHandler).Methods(http.MethodPost)
 	r.HandleFunc("/"+MODIFIED_JOBS_PATH, s.DeleteModifiedJobsHandler).Methods(http.MethodDelete)
 	r.HandleFunc("/"+MODIFIED_JOBS_PATH, s.GetModifiedJobsHandler).Methods(http.MethodGet)
@@ -539,6 +541,81 @@ func (c *client) GetTasksFromDateRange(from time.Time, to time.Time) ([]*db.Task
 	return c.getTaskList(c.serverRoot + TASKS_PATH + "?" + params.Encode())
 }
 
+// PostTaskSearchHandler translates a POST request where the body is a
+// GOB-encoded db.TaskSearchParams to db.SearchTasks.
+//   - format: must be "gob"; default "gob"
+// Response is GOB stream; first object is the total number of matching tasks,
+// second object is the number of tasks returned, the remaining objects are
+// db.Tasks.
+func (s *server) PostTaskSearchHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "gob" {
+		httputils.ReportError(w, r, nil, fmt.Sprintf("Unsupported format %q", format))
+		return
+	}
+	var params db.TaskSearchParams
+	if err := gob.NewDecoder(r.Body).Decode(&params); err != nil {
+		httputils.ReportError(w, r, err, "Unable to decode TaskSearchParams")
+		return
+	}
+	result, err := db.SearchTasks(s.d, &params)
+	if err != nil {
+		reportDBError(w, r, err, "Unable to search tasks")
+		return
+	}
+	w.Header().Set("Content-Type", "application/gob")
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(result.Count); err != nil {
+		httputils.ReportError(w, r, err, "Unable to encode task count")
+		return
+	}
+	if err := enc.Encode(len(result.Tasks)); err != nil {
+		httputils.ReportError(w, r, err, "Unable to encode task count")
+		return
+	}
+	for _, task := range result.Tasks {
+		if err := enc.Encode(task); err != nil {
+			httputils.ReportError(w, r, err, "Unable to encode task")
+			return
+		}
+		flush(w)
+	}
+}
+
+// See documentation for db.TaskSearcher.
+func (c *client) SearchTasks(p *db.TaskSearchParams) (*db.TaskSearchResult, error) {
+	buf := bytes.Buffer{}
+	if err := gob.NewEncoder(&buf).Encode(p); err != nil {
+		return nil, err
+	}
+	r, err := c.client.Post(c.serverRoot+TASK_SEARCH_PATH+"?format=gob", "application/gob", &buf)
+	if err != nil {
+		return nil, err
+	}
+	defer util.Close(r.Body)
+	if err := interpretStatusCode(r); err != nil {
+		return nil, err
+	}
+	dec := gob.NewDecoder(r.Body)
+	rv := &db.TaskSearchResult{}
+	if err := dec.Decode(&rv.Count); err != nil {
+		return nil, err
+	}
+	var count int
+	if err := dec.Decode(&count); err != nil {
+		return nil, err
+	}
+	rv.Tasks = make([]*db.Task, count)
+	for i := range rv.Tasks {
+		var t db.Task
+		if err := dec.Decode(&t); err != nil {
+			return nil, err
+		}
+		rv.Tasks[i] = &t
+	}
+	return rv, nil
+}
+
 // GetJobsHandler translates a GET request to GetJobsFromDateRange or
 // GetJobById.
 //   - format: must be "gob"; default "gob"
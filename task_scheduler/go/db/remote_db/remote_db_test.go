@@ -28,6 +28,10 @@ func (b *clientWithBackdoor) Close() error {
 	return nil
 }
 
+func (b *clientWithBackdoor) SearchTasks(p *db.TaskSearchParams) (*db.TaskSearchResult, error) {
+	return b.RemoteDB.(db.TaskSearcher).SearchTasks(p)
+}
+
 func (b *clientWithBackdoor) AssignId(task *db.Task) error {
 	return b.backdoor.AssignId(task)
 }
@@ -88,6 +92,13 @@ func TestRemoteDBTaskDBUpdateTasksWithRetries(t *testing.T) {
 	db.TestUpdateTasksWithRetries(t, d)
 }
 
+func TestRemoteDBTaskSearch(t *testing.T) {
+	testutils.SmallTest(t)
+	d := makeDB(t)
+	defer testutils.AssertCloses(t, d)
+	db.TestTaskSearch(t, d)
+}
+
 func TestRemoteDBJobDB(t *testing.T) {
 	testutils.SmallTest(t)
 	d := makeDB(t)
@@ -0,0 +1,106 @@
+// Search for Tasks in the Task Scheduler DB and write them as JSON.
+//
+// Example:
+//   search_tasks --repo=https://skia.googlesource.com/skia.git --status=FAILURE --bot=skia-gce-001
+//   search_tasks --name=Build-Ubuntu-GCC-x86_64-Release --property=key:value --count
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.skia.org/infra/go/common"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/task_scheduler/go/db"
+	"go.skia.org/infra/task_scheduler/go/db/remote_db"
+)
+
+var (
+	taskSchedulerDbUrl = flag.String("task_db_url", "http://skia-task-scheduler:8008/db/", "Where the Skia task scheduler database is hosted.")
+
+	bot        = flag.String("bot", "", "Only return Tasks which ran on this Swarming bot.")
+	commit     = flag.String("commit", "", "Only return Tasks whose blamelist includes this commit.")
+	count      = flag.Bool("count", false, "Only print the number of matching Tasks.")
+	end        = flag.String("end", "", "End of the time range to search, in RFC3339 format. Defaults to the current time.")
+	issue      = flag.String("issue", "", "Only return Tasks for this code review issue.")
+	limit      = flag.Int("limit", 100, "Maximum number of Tasks to return. Zero indicates no limit.")
+	name       = flag.String("name", "", "Only return Tasks with this name.")
+	offset     = flag.Int("offset", 0, "Number of matching Tasks to skip.")
+	patchset   = flag.String("patchset", "", "Only return Tasks for this code review patchset.")
+	properties = common.NewMultiStringFlag("property", nil, "Only return Tasks with this property, given as \"key:value\". May be repeated.")
+	repo       = flag.String("repo", "", "Only return Tasks for this repo.")
+	revision   = flag.String("revision", "", "Only return Tasks at this revision.")
+	period     = flag.Duration("period", 24*time.Hour, "Duration of time range to search.")
+	status     = flag.String("status", "", "Only return Tasks with this status.")
+)
+
+func main() {
+	defer common.LogPanic()
+
+	// Global init.
+	common.Init()
+
+	endTime := time.Now().UTC()
+	if *end != "" {
+		var err error
+		endTime, err = time.Parse(time.RFC3339, *end)
+		if err != nil {
+			sklog.Fatalf("Invalid --end: %s", err)
+		}
+	}
+	props := make(map[string]string, len(*properties))
+	for _, p := range *properties {
+		split := strings.SplitN(p, ":", 2)
+		if len(split) != 2 {
+			sklog.Fatalf("Invalid --property %q; expected \"key:value\".", p)
+		}
+		props[split[0]] = split[1]
+	}
+
+	params := &db.TaskSearchParams{
+		RepoState: db.RepoState{
+			Patch: db.Patch{
+				Issue:    *issue,
+				Patchset: *patchset,
+			},
+			Repo:     *repo,
+			Revision: *revision,
+		},
+		BotId:      *bot,
+		Commit:     *commit,
+		Name:       *name,
+		Properties: props,
+		Status:     db.TaskStatus(*status),
+		TimeStart:  endTime.Add(-*period),
+		TimeEnd:    endTime,
+		Offset:     *offset,
+		Limit:      *limit,
+		CountOnly:  *count,
+	}
+
+	d, err := remote_db.NewClient(*taskSchedulerDbUrl)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	result, err := db.SearchTasks(d, params)
+	if err != nil {
+		sklog.Fatal(err)
+	}
+
+	if *count {
+		fmt.Fprintln(os.Stdout, result.Count)
+		return
+	}
+	enc, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		sklog.Fatal(err)
+	}
+	if _, err := os.Stdout.Write(enc); err != nil {
+		sklog.Fatal(err)
+	}
+	fmt.Fprintln(os.Stdout)
+}
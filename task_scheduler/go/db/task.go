@@ -120,6 +120,10 @@ type Task struct {
 	// zero if the task is pending or running.
 	Finished time.Time `json:"finished"`
 
+	// Flaky indicates that this task failed, but a retry of the task at the
+	// same commit succeeded.
+	Flaky bool `json:"flaky"`
+
 	// Id is a generated unique identifier for this Task instance. Must be
 	// URL-safe.
 	Id string `json:"id"`
@@ -132,9 +136,18 @@ type Task struct {
 	// MaxAttempts is the maximum number of attempts for this TaskSpec.
 	MaxAttempts int `json:"max_attempts"`
 
+	// Outputs maps the names of the artifacts produced by this Task to
+	// their locations within IsolatedOutput.
+	Outputs map[string]string `json:"outputs"`
+
 	// ParentTaskIds are IDs of tasks which satisfied this task's dependencies.
 	ParentTaskIds []string `json:"parentTaskIds"`
 
+	// Preempted indicates that the Task Scheduler cancelled this task to
+	// make room for a higher-priority task. Preempted tasks are re-run
+	// without counting against MaxAttempts.
+	Preempted bool `json:"preempted"`
+
 	// Properties contains key-value pairs from external sources. Both key and
 	// value must be UTF-8 strings. Prefer a JavaScript identifier for key. Use
 	// base64 encoding for binary data.
@@ -384,10 +397,13 @@ func (t *Task) Copy() *Task {
 		Created:        t.Created,
 		DbModified:     t.DbModified,
 		Finished:       t.Finished,
+		Flaky:          t.Flaky,
 		Id:             t.Id,
 		IsolatedOutput: t.IsolatedOutput,
 		MaxAttempts:    t.MaxAttempts,
+		Outputs:        util.CopyStringMap(t.Outputs),
 		ParentTaskIds:  parentTaskIds,
+		Preempted:      t.Preempted,
 		Properties:     util.CopyStringMap(t.Properties),
 		RetryOf:        t.RetryOf,
 		Started:        t.Started,
@@ -398,6 +414,16 @@ func (t *Task) Copy() *Task {
 	}
 }
 
+// GetOutput returns the location of the named artifact within IsolatedOutput,
+// or an error if the Task does not produce such an artifact.
+func (t *Task) GetOutput(name string) (string, error) {
+	p, ok := t.Outputs[name]
+	if !ok {
+		return "", fmt.Errorf("Task %s does not produce output %q", t.Id, name)
+	}
+	return p, nil
+}
+
 // Validate returns an error if the task is not valid.
 func (task *Task) Validate() error {
 	if !task.TaskKey.Valid() {
@@ -406,6 +432,11 @@ func (task *Task) Validate() error {
 	if task.Fake() && !(task.IsolatedOutput == "" && task.SwarmingBotId == "" && task.SwarmingTaskId == "") {
 		return fmt.Errorf("Can not specify Swarming info for a fake task.")
 	}
+	for name, p := range task.Outputs {
+		if name == "" || p == "" {
+			return fmt.Errorf("Outputs must have a name and path: %q: %q", name, p)
+		}
+	}
 	for key, value := range task.Properties {
 		if !utf8.ValidString(key) {
 			return fmt.Errorf("Invalid property key -- must be valid UTF8: %q", key)
@@ -426,8 +457,10 @@ func (task *Task) Valid() bool {
 // TaskSummary is a subset of the information found in a Task.
 type TaskSummary struct {
 	Attempt        int        `json:"attempt"`
+	Flaky          bool       `json:"flaky"`
 	Id             string     `json:"id"`
 	MaxAttempts    int        `json:"max_attempts"`
+	Preempted      bool       `json:"preempted"`
 	Status         TaskStatus `json:"status"`
 	SwarmingTaskId string     `json:"swarmingTaskId"`
 }
@@ -436,8 +469,10 @@ type TaskSummary struct {
 func (t *Task) MakeTaskSummary() *TaskSummary {
 	return &TaskSummary{
 		Attempt:        t.Attempt,
+		Flaky:          t.Flaky,
 		Id:             t.Id,
 		MaxAttempts:    t.MaxAttempts,
+		Preempted:      t.Preempted,
 		Status:         t.Status,
 		SwarmingTaskId: t.SwarmingTaskId,
 	}
@@ -447,8 +482,10 @@ func (t *Task) MakeTaskSummary() *TaskSummary {
 func (t *TaskSummary) Copy() *TaskSummary {
 	return &TaskSummary{
 		Attempt:        t.Attempt,
+		Flaky:          t.Flaky,
 		Id:             t.Id,
 		MaxAttempts:    t.MaxAttempts,
+		Preempted:      t.Preempted,
 		Status:         t.Status,
 		SwarmingTaskId: t.SwarmingTaskId,
 	}
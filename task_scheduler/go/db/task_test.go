@@ -657,10 +657,15 @@ func TestCopyTask(t *testing.T) {
 		Created:        now.Add(time.Nanosecond),
 		DbModified:     now.Add(time.Millisecond),
 		Finished:       now.Add(time.Second),
+		Flaky:          true,
 		Id:             "42",
 		IsolatedOutput: "lonely-result",
 		MaxAttempts:    2,
-		ParentTaskIds:  []string{"38", "39", "40"},
+		Outputs: map[string]string{
+			"binary": "out/dm",
+		},
+		ParentTaskIds: []string{"38", "39", "40"},
+		Preempted:     true,
 		Properties: map[string]string{
 			"color":   "blue",
 			"awesome": "true",
@@ -712,6 +717,13 @@ func TestValidateTask(t *testing.T) {
 		task.SwarmingBotId = "skynet"
 		test(task, "Can not specify Swarming info")
 	}
+	{
+		task := tmpl.Copy()
+		task.Outputs = map[string]string{
+			"binary": "",
+		}
+		test(task, "Outputs must have a name and path")
+	}
 	{
 		task := tmpl.Copy()
 		task.Properties = map[string]string{
@@ -852,12 +864,29 @@ func TestTaskDecoderError(t *testing.T) {
 	assert.Equal(t, 0, len(result))
 }
 
+func TestTaskGetOutput(t *testing.T) {
+	testutils.SmallTest(t)
+	task := &Task{
+		Id: "42",
+		Outputs: map[string]string{
+			"binary": "out/dm",
+		},
+	}
+	p, err := task.GetOutput("binary")
+	assert.NoError(t, err)
+	assert.Equal(t, "out/dm", p)
+	_, err = task.GetOutput("bogus")
+	assert.EqualError(t, err, "Task 42 does not produce output \"bogus\"")
+}
+
 func TestCopyTaskSummary(t *testing.T) {
 	testutils.SmallTest(t)
 	v := &TaskSummary{
 		Attempt:        1,
+		Flaky:          true,
 		Id:             "123",
 		MaxAttempts:    2,
+		Preempted:      true,
 		Status:         TASK_STATUS_FAILURE,
 		SwarmingTaskId: "abc123",
 	}
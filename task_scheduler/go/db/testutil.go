@@ -622,6 +622,85 @@ func TestUpdateTasksWithRetries(t *testing.T, db TaskDB) {
 	testUpdateTaskWithRetriesTaskNotFound(t, db)
 }
 
+// TestTaskSearch performs basic tests of SearchTasks on an implementation of
+// TaskDB.
+func TestTaskSearch(t *testing.T, db TaskDB) {
+	now := time.Now()
+	makeSearchTask := func(ago time.Duration, repo, name, bot string, status TaskStatus, commits []string) *Task {
+		task := makeTask(now.Add(-ago), commits)
+		task.Repo = repo
+		task.Name = name
+		task.SwarmingBotId = bot
+		task.Status = status
+		return task
+	}
+	t1 := makeSearchTask(3*time.Minute, "a.git", "Build", "bot1", TASK_STATUS_SUCCESS, []string{"a", "b"})
+	t1.Properties = map[string]string{"key": "value"}
+	t2 := makeSearchTask(2*time.Minute, "a.git", "Test", "bot2", TASK_STATUS_FAILURE, []string{"c"})
+	t2.Patch = Patch{
+		Issue:    "10",
+		Patchset: "1",
+		Server:   "https://codereview",
+	}
+	t3 := makeSearchTask(time.Minute, "b.git", "Build", "bot1", TASK_STATUS_RUNNING, []string{"d"})
+	assert.NoError(t, db.PutTasks([]*Task{t1, t2, t3}))
+
+	check := func(p *TaskSearchParams, count int, expected ...*Task) {
+		p.TimeStart = now.Add(-time.Hour)
+		p.TimeEnd = now.Add(time.Hour)
+		rv, err := SearchTasks(db, p)
+		assert.NoError(t, err)
+		assert.Equal(t, count, rv.Count)
+		ids := make([]string, 0, len(rv.Tasks))
+		for _, task := range rv.Tasks {
+			ids = append(ids, task.Id)
+		}
+		expectedIds := make([]string, 0, len(expected))
+		for _, task := range expected {
+			expectedIds = append(expectedIds, task.Id)
+		}
+		assert.Equal(t, expectedIds, ids)
+	}
+
+	check(&TaskSearchParams{}, 3, t1, t2, t3)
+	check(&TaskSearchParams{Name: "Build"}, 2, t1, t3)
+	check(&TaskSearchParams{Name: "Build", RepoState: RepoState{Repo: "a.git"}}, 1, t1)
+	check(&TaskSearchParams{BotId: "bot1"}, 2, t1, t3)
+	check(&TaskSearchParams{Status: TASK_STATUS_FAILURE}, 1, t2)
+	check(&TaskSearchParams{Commit: "b"}, 1, t1)
+	check(&TaskSearchParams{RepoState: RepoState{Revision: "c"}}, 1, t2)
+	check(&TaskSearchParams{RepoState: RepoState{Patch: Patch{Issue: "10", Patchset: "1"}}}, 1, t2)
+	check(&TaskSearchParams{RepoState: RepoState{Patch: Patch{Issue: "10", Patchset: "2"}}}, 0)
+	check(&TaskSearchParams{Properties: map[string]string{"key": "value"}}, 1, t1)
+	check(&TaskSearchParams{Properties: map[string]string{"key": "other"}}, 0)
+	check(&TaskSearchParams{Name: "Bogus"}, 0)
+
+	// Pagination.
+	check(&TaskSearchParams{Limit: 2}, 3, t1, t2)
+	check(&TaskSearchParams{Offset: 2, Limit: 2}, 3, t3)
+	check(&TaskSearchParams{Offset: 5}, 3)
+	check(&TaskSearchParams{CountOnly: true}, 3)
+
+	// Modified Tasks should be found using their new values.
+	t3.Status = TASK_STATUS_SUCCESS
+	assert.NoError(t, db.PutTask(t3))
+	check(&TaskSearchParams{Status: TASK_STATUS_RUNNING}, 0)
+	check(&TaskSearchParams{Status: TASK_STATUS_SUCCESS}, 2, t1, t3)
+
+	// Time range.
+	rv, err := SearchTasks(db, &TaskSearchParams{
+		BotId:     "bot1",
+		TimeStart: t1.Created.Add(time.Nanosecond),
+		TimeEnd:   now,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rv.Count)
+	assert.Equal(t, t3.Id, rv.Tasks[0].Id)
+
+	_, err = SearchTasks(db, &TaskSearchParams{Offset: -1})
+	assert.Error(t, err)
+}
+
 // TestJobDB performs basic tests on an implementation of JobDB.
 func TestJobDB(t *testing.T, db JobDB) {
 	_, err := db.GetModifiedJobs("dummy-id")
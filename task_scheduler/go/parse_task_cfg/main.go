@@ -32,5 +32,14 @@ func main() {
 	sklog.Infof("Task config:")
 	for name, t := range cfg.Tasks {
 		sklog.Infof("  %s: %v", name, t)
+		for _, c := range t.Caches {
+			sklog.Infof("    cache %q at %s", c.Name, c.Path)
+		}
+		for _, in := range t.Inputs {
+			sklog.Infof("    input %q from %s as $%s", in.Output, in.Task, in.Env)
+		}
+		for _, o := range t.Outputs {
+			sklog.Infof("    output %q at %s", o.Name, o.Path)
+		}
 	}
 }
@@ -0,0 +1,205 @@
+package scheduling
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/task_scheduler/go/db"
+)
+
+const (
+	// FLAKY_TASK_COMMENT_USER is the user name attached to TaskComments
+	// which are added to flaky tasks.
+	FLAKY_TASK_COMMENT_USER = "task-scheduler"
+
+	// MIN_QUARANTINE_RUNS is the minimum number of runs of a TaskSpec
+	// within the scheduling window before it may be quarantined.
+	MIN_QUARANTINE_RUNS = 10
+
+	// Measurement name for flakiness rates by TaskSpec.
+	MEASUREMENT_TASK_SPEC_FLAKINESS = "task-spec-flakiness"
+)
+
+// findFlakyTasks returns the Tasks which should be marked as flaky, given all
+// of the Tasks for a single TaskKey. A Task is flaky if it failed but another
+// attempt at the same TaskKey succeeded.
+func findFlakyTasks(tasks []*db.Task) []*db.Task {
+	succeeded := false
+	for _, t := range tasks {
+		if t.Success() {
+			succeeded = true
+			break
+		}
+	}
+	if !succeeded {
+		return nil
+	}
+	var rv []*db.Task
+	for _, t := range tasks {
+		if t.Status == db.TASK_STATUS_FAILURE && !t.Flaky {
+			rv = append(rv, t)
+		}
+	}
+	return rv
+}
+
+// markTasksFlaky sets the Flaky bit on the given Tasks, keyed by ID, in the DB
+// and adds a TaskComment to each one whose TaskSpec requests it.
+func (s *TaskScheduler) markTasksFlaky(flaky map[string]*db.Task) error {
+	if len(flaky) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(flaky))
+	for id := range flaky {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if _, err := db.UpdateTasksWithRetries(s.db, func() ([]*db.Task, error) {
+		tasks := make([]*db.Task, 0, len(ids))
+		for _, id := range ids {
+			t, err := s.db.GetTaskById(id)
+			if err != nil {
+				return nil, err
+			}
+			if t == nil {
+				return nil, db.ErrNotFound
+			}
+			t.Flaky = true
+			tasks = append(tasks, t)
+		}
+		return tasks, nil
+	}); err != nil {
+		return fmt.Errorf("Failed to mark tasks as flaky: %s", err)
+	}
+
+	now := time.Now()
+	for _, id := range ids {
+		t := flaky[id]
+		spec, err := s.taskCfgCache.GetTaskSpec(t.RepoState, t.Name)
+		if err != nil {
+			return err
+		}
+		if spec.Flakes == nil || !spec.Flakes.Comment {
+			continue
+		}
+		c := &db.TaskComment{
+			Repo:      t.Repo,
+			Revision:  t.Revision,
+			Name:      t.Name,
+			Timestamp: now,
+			TaskId:    t.Id,
+			User:      FLAKY_TASK_COMMENT_USER,
+			Message:   fmt.Sprintf("Task %s failed on %s but succeeded when retried at the same commit; marking as flaky.", t.Id, t.SwarmingBotId),
+		}
+		if err := s.db.PutTaskComment(c); err != nil && err != db.ErrAlreadyExists {
+			return fmt.Errorf("Failed to add comment to flaky task: %s", err)
+		}
+	}
+	return nil
+}
+
+// quarantinedTaskSpecs returns the sorted names of the TaskSpecs in the given
+// Job whose failures should not cause the Job to fail, or nil if there are
+// none.
+func (s *TaskScheduler) quarantinedTaskSpecs(j *db.Job) ([]string, error) {
+	s.flakinessMtx.RLock()
+	stats := s.flakiness[j.Repo]
+	s.flakinessMtx.RUnlock()
+	if stats == nil {
+		return nil, nil
+	}
+	var rv []string
+	for name := range j.Dependencies {
+		st, ok := stats.TaskSpecs[name]
+		if !ok || st.Runs < MIN_QUARANTINE_RUNS {
+			continue
+		}
+		spec, err := s.taskCfgCache.GetTaskSpec(j.RepoState, name)
+		if err != nil {
+			return nil, err
+		}
+		if spec.Flakes == nil || !spec.Flakes.Quarantine {
+			continue
+		}
+		if st.Rate() >= spec.Flakes.GetQuarantineThreshold() {
+			rv = append(rv, name)
+		}
+	}
+	sort.Strings(rv)
+	return rv, nil
+}
+
+// computeFlakiness computes the flakiness stats for each of the given repos
+// from the given tasks. Try jobs are ignored, since their failures may be
+// caused by the patch.
+func computeFlakiness(repos []string, tasks []*db.Task, now time.Time) map[string]*db.RepoFlakiness {
+	rv := make(map[string]*db.RepoFlakiness, len(repos))
+	for _, repo := range repos {
+		rv[repo] = &db.RepoFlakiness{
+			Repo:      repo,
+			TaskSpecs: map[string]*db.FlakinessStats{},
+			Bots:      map[string]*db.FlakinessStats{},
+			Updated:   now,
+		}
+	}
+	add := func(m map[string]*db.FlakinessStats, key string, t *db.Task) {
+		st, ok := m[key]
+		if !ok {
+			st = &db.FlakinessStats{}
+			m[key] = st
+		}
+		st.Add(t)
+	}
+	for _, t := range tasks {
+		if t.IsTryJob() || !t.Done() {
+			continue
+		}
+		f, ok := rv[t.Repo]
+		if !ok {
+			continue
+		}
+		add(f.TaskSpecs, t.Name, t)
+		if t.SwarmingBotId != "" {
+			add(f.Bots, t.SwarmingBotId, t)
+		}
+	}
+	return rv
+}
+
+// updateFlakiness recomputes the flakiness stats for all tasks within the
+// scheduling window and stores them in the DB.
+func (s *TaskScheduler) updateFlakiness(now time.Time) error {
+	defer metrics2.FuncTimer().Stop()
+	tasks, err := s.tCache.GetTasksFromDateRange(s.window.EarliestStart(), now)
+	if err != nil {
+		return err
+	}
+	windowTasks := make([]*db.Task, 0, len(tasks))
+	for _, t := range tasks {
+		if s.window.TestTime(t.Repo, t.Created) {
+			windowTasks = append(windowTasks, t)
+		}
+	}
+	repos := make([]string, 0, len(s.repos))
+	for repo := range s.repos {
+		repos = append(repos, repo)
+	}
+	flakiness := computeFlakiness(repos, windowTasks, now)
+	for _, f := range flakiness {
+		if err := s.db.PutFlakiness(f); err != nil {
+			return fmt.Errorf("Failed to store flakiness stats: %s", err)
+		}
+		for name, st := range f.TaskSpecs {
+			metrics2.GetFloat64Metric(MEASUREMENT_TASK_SPEC_FLAKINESS, map[string]string{
+				"repo":      f.Repo,
+				"task_name": name,
+			}).Update(st.Rate())
+		}
+	}
+	s.flakinessMtx.Lock()
+	defer s.flakinessMtx.Unlock()
+	s.flakiness = flakiness
+	return nil
+}
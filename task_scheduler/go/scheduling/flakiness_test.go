@@ -0,0 +1,86 @@
+package scheduling
+
+import (
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/task_scheduler/go/db"
+)
+
+func TestFindFlakyTasks(t *testing.T) {
+	testutils.SmallTest(t)
+
+	t1 := &db.Task{Id: "1", Status: db.TASK_STATUS_FAILURE}
+	t2 := &db.Task{Id: "2", Status: db.TASK_STATUS_MISHAP}
+	t3 := &db.Task{Id: "3", Status: db.TASK_STATUS_RUNNING}
+
+	// No successful attempts, so nothing is flaky.
+	assert.Equal(t, 0, len(findFlakyTasks([]*db.Task{})))
+	assert.Equal(t, 0, len(findFlakyTasks([]*db.Task{t1, t2, t3})))
+
+	// The retry succeeded; only the failure is flaky.
+	t3.Status = db.TASK_STATUS_SUCCESS
+	testutils.AssertDeepEqual(t, []*db.Task{t1}, findFlakyTasks([]*db.Task{t1, t2, t3}))
+
+	// Tasks which are already marked don't need to be marked again.
+	t1.Flaky = true
+	assert.Equal(t, 0, len(findFlakyTasks([]*db.Task{t1, t2, t3})))
+}
+
+func TestComputeFlakiness(t *testing.T) {
+	testutils.SmallTest(t)
+
+	now := time.Now()
+	task := func(repo, name, bot string, status db.TaskStatus, flaky bool) *db.Task {
+		return &db.Task{
+			Flaky:         flaky,
+			Status:        status,
+			SwarmingBotId: bot,
+			TaskKey: db.TaskKey{
+				RepoState: db.RepoState{
+					Repo:     repo,
+					Revision: "abc",
+				},
+				Name: name,
+			},
+		}
+	}
+	tryjob := task("a.git", "Test", "bot1", db.TASK_STATUS_FAILURE, true)
+	tryjob.Patch = db.Patch{
+		Issue:    "1",
+		Patchset: "2",
+		Server:   "https://codereview",
+	}
+	tasks := []*db.Task{
+		task("a.git", "Test", "bot1", db.TASK_STATUS_FAILURE, true),
+		task("a.git", "Test", "bot2", db.TASK_STATUS_SUCCESS, false),
+		task("a.git", "Test", "bot2", db.TASK_STATUS_FAILURE, false),
+		task("a.git", "Build", "bot1", db.TASK_STATUS_SUCCESS, false),
+		task("a.git", "Build", "", db.TASK_STATUS_RUNNING, false),
+		task("c.git", "Test", "bot1", db.TASK_STATUS_FAILURE, true),
+		tryjob,
+	}
+	rv := computeFlakiness([]string{"a.git", "b.git"}, tasks, now)
+	testutils.AssertDeepEqual(t, map[string]*db.RepoFlakiness{
+		"a.git": {
+			Repo: "a.git",
+			TaskSpecs: map[string]*db.FlakinessStats{
+				"Build": {Runs: 1},
+				"Test":  {Runs: 3, Failures: 2, Flakes: 1},
+			},
+			Bots: map[string]*db.FlakinessStats{
+				"bot1": {Runs: 2, Failures: 1, Flakes: 1},
+				"bot2": {Runs: 2, Failures: 1},
+			},
+			Updated: now,
+		},
+		"b.git": {
+			Repo:      "b.git",
+			TaskSpecs: map[string]*db.FlakinessStats{},
+			Bots:      map[string]*db.FlakinessStats{},
+			Updated:   now,
+		},
+	}, rv)
+}
@@ -10,6 +10,7 @@ import (
 
 	"go.skia.org/infra/go/sklog"
 
+	"go.skia.org/infra/go/cron"
 	"go.skia.org/infra/go/metrics2"
 	"go.skia.org/infra/go/util"
 	"go.skia.org/infra/task_scheduler/go/db"
@@ -26,16 +27,50 @@ const (
 	// periodic triggers.
 	PERIODIC_TRIGGER_MEASUREMENT = "task-scheduler-periodic-trigger"
 
+	// PERIODIC_TRIGGER_NEXT_RUN_MEASUREMENT is the name of the metric
+	// indicating the next scheduled run of each cron trigger, in seconds
+	// since the epoch.
+	PERIODIC_TRIGGER_NEXT_RUN_MEASUREMENT = "task-scheduler-periodic-trigger-next-run"
+
 	// LAST_TRIGGERED_JSON_FILE is the name of a JSON file containing the
 	// last-triggered time for each known trigger.
 	LAST_TRIGGERED_JSON_FILE = "last-triggered.json"
+
+	// CRON_CATCH_UP_GRACE_PERIOD is how late a cron-triggered Job may be
+	// triggered under the CATCH_UP_NONE policy before the run is
+	// considered missed.
+	CRON_CATCH_UP_GRACE_PERIOD = 15 * time.Minute
+
+	// MAX_CRON_CATCH_UP_JOBS is the maximum number of missed runs of a
+	// cron-triggered JobSpec which are triggered under the CATCH_UP_ALL
+	// policy. If more runs were missed, only the latest ones are triggered.
+	MAX_CRON_CATCH_UP_JOBS = 10
 )
 
+// cronJobRecord records the last run of a cron-triggered JobSpec.
+type cronJobRecord struct {
+	// LastRun is the last time at which the schedule was evaluated and
+	// found to be due, whether or not any Jobs were triggered.
+	LastRun time.Time `json:"last_run"`
+
+	// Revision is the commit at which Jobs were last triggered.
+	Revision string `json:"revision"`
+}
+
+// cronJobKey returns the key used to store the cronJobRecord for the given
+// JobSpec in the given repo.
+func cronJobKey(repo, name string) string {
+	return fmt.Sprintf("%s|%s", repo, name)
+}
+
 // periodicTriggerMetrics tracks liveness metrics for various periodic triggers.
 type periodicTriggerMetrics struct {
 	jsonFile      string
-	LastTriggered map[string]time.Time `json:"last_triggered"`
+	CronJobs      map[string]*cronJobRecord `json:"cron_jobs"`
+	LastTriggered map[string]time.Time      `json:"last_triggered"`
+	NextRun       map[string]time.Time      `json:"next_run"`
 	metrics       map[string]metrics2.Liveness
+	nextRun       map[string]metrics2.Int64Metric
 }
 
 // newPeriodicTriggerMetrics returns a periodicTriggerMetrics instance,
@@ -54,6 +89,12 @@ func newPeriodicTriggerMetrics(workdir string) (*periodicTriggerMetrics, error)
 	} else {
 		rv.LastTriggered = map[string]time.Time{}
 	}
+	if rv.CronJobs == nil {
+		rv.CronJobs = map[string]*cronJobRecord{}
+	}
+	if rv.NextRun == nil {
+		rv.NextRun = map[string]time.Time{}
+	}
 	rv.jsonFile = jsonFile
 	rv.metrics = make(map[string]metrics2.Liveness, len(rv.LastTriggered))
 	for trigger, last := range rv.LastTriggered {
@@ -63,6 +104,10 @@ func newPeriodicTriggerMetrics(workdir string) (*periodicTriggerMetrics, error)
 		lv.ManualReset(last)
 		rv.metrics[trigger] = lv
 	}
+	rv.nextRun = make(map[string]metrics2.Int64Metric, len(rv.NextRun))
+	for trigger, next := range rv.NextRun {
+		rv.SetNextRun(trigger, next)
+	}
 	return &rv, nil
 }
 
@@ -80,6 +125,30 @@ func (m *periodicTriggerMetrics) Reset(name string) {
 	m.LastTriggered[name] = now
 }
 
+// SetNextRun sets the next scheduled run of the given cron trigger. A zero
+// time removes the trigger.
+func (m *periodicTriggerMetrics) SetNextRun(name string, next time.Time) {
+	metric, ok := m.nextRun[name]
+	if next.IsZero() {
+		if ok {
+			if err := metric.Delete(); err != nil {
+				sklog.Errorf("Failed to delete next-run metric for %s: %s", name, err)
+			}
+			delete(m.nextRun, name)
+		}
+		delete(m.NextRun, name)
+		return
+	}
+	if !ok {
+		metric = metrics2.GetInt64Metric(PERIODIC_TRIGGER_NEXT_RUN_MEASUREMENT, map[string]string{
+			"trigger": name,
+		})
+		m.nextRun[name] = metric
+	}
+	metric.Update(next.Unix())
+	m.NextRun[name] = next
+}
+
 // Write writes the last-triggered times to a JSON file.
 func (m *periodicTriggerMetrics) Write() (rv error) {
 	f, err := os.Create(m.jsonFile)
@@ -125,18 +194,8 @@ func deleteTriggerFile(triggerDir, basename string) error {
 	return nil
 }
 
-// triggerPeriodicJobs triggers jobs at HEAD of the master branch in each repo
-// for any files present in the trigger dir.
-func (s *TaskScheduler) triggerPeriodicJobs() error {
-	triggerDir := path.Join(s.workdir, TRIGGER_DIRNAME)
-	triggers, err := findAndParseTriggerFiles(triggerDir)
-	if err != nil {
-		return err
-	}
-	if len(triggers) == 0 {
-		return nil
-	}
-	// Obtain the TasksCfg at tip of master in each repo.
+// getPeriodicTasksCfgs returns the TasksCfg at tip of master in each repo.
+func (s *TaskScheduler) getPeriodicTasksCfgs() (map[db.RepoState]*specs.TasksCfg, error) {
 	cfgs := make(map[db.RepoState]*specs.TasksCfg, len(s.repos))
 	for url, repo := range s.repos {
 		head := repo.Get("master")
@@ -146,10 +205,26 @@ func (s *TaskScheduler) triggerPeriodicJobs() error {
 		}
 		cfg, err := s.taskCfgCache.ReadTasksCfg(rs)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		cfgs[rs] = cfg
 	}
+	return cfgs, nil
+}
+
+// triggerPeriodicJobs triggers jobs at HEAD of the master branch in each repo
+// for any files present in the trigger dir and for any cron triggers which
+// are due as of the given time.
+func (s *TaskScheduler) triggerPeriodicJobs(now time.Time) error {
+	triggerDir := path.Join(s.workdir, TRIGGER_DIRNAME)
+	triggers, err := findAndParseTriggerFiles(triggerDir)
+	if err != nil {
+		return err
+	}
+	cfgs, err := s.getPeriodicTasksCfgs()
+	if err != nil {
+		return err
+	}
 	// Trigger the periodic tasks.
 	for _, trigger := range triggers {
 		sklog.Infof("Triggering %s tasks", trigger)
@@ -161,6 +236,7 @@ func (s *TaskScheduler) triggerPeriodicJobs() error {
 					if err != nil {
 						return err
 					}
+					j.Trigger = trigger
 					jobs = append(jobs, j)
 				}
 			}
@@ -173,5 +249,112 @@ func (s *TaskScheduler) triggerPeriodicJobs() error {
 		}
 		s.triggerMetrics.Reset(trigger)
 	}
+	if err := s.triggerCronJobs(cfgs, now); err != nil {
+		return err
+	}
 	return s.triggerMetrics.Write()
 }
+
+// numCronJobs returns the number of Jobs to trigger for a JobSpec with the
+// given catch-up policy, given the scheduled times which have passed since it
+// was last run, in chronological order.
+func numCronJobs(catchUp string, due []time.Time, now time.Time) int {
+	if len(due) == 0 {
+		return 0
+	}
+	switch catchUp {
+	case specs.CATCH_UP_NONE:
+		if now.Sub(due[len(due)-1]) <= CRON_CATCH_UP_GRACE_PERIOD {
+			return 1
+		}
+		return 0
+	case specs.CATCH_UP_ALL:
+		return len(due)
+	default:
+		return 1
+	}
+}
+
+// triggerCronJobs triggers jobs at HEAD of the master branch in each repo for
+// any JobSpecs whose cron triggers have come due since they last ran, and
+// updates the next scheduled run for each cron trigger. JobSpecs which have
+// not been seen before are not triggered until their next scheduled time.
+func (s *TaskScheduler) triggerCronJobs(cfgs map[db.RepoState]*specs.TasksCfg, now time.Time) error {
+	jobs := []*db.Job{}
+	triggered := map[string]bool{}
+	records := map[string]*cronJobRecord{}
+	nextRun := map[string]time.Time{}
+	for rs, cfg := range cfgs {
+		for name, spec := range cfg.Jobs {
+			if !specs.IsCronTrigger(spec.Trigger) {
+				continue
+			}
+			schedule, err := cron.Parse(spec.Trigger)
+			if err != nil {
+				return err
+			}
+			nextRun[spec.Trigger] = schedule.Next(now)
+			key := cronJobKey(rs.Repo, name)
+			prev, ok := s.triggerMetrics.CronJobs[key]
+			if !ok {
+				records[key] = &cronJobRecord{LastRun: now}
+				continue
+			}
+			records[key] = prev
+			max := 1
+			if spec.GetCatchUp() == specs.CATCH_UP_ALL {
+				max = MAX_CRON_CATCH_UP_JOBS
+			}
+			due := schedule.Between(prev.LastRun, now, max)
+			if len(due) == 0 {
+				continue
+			}
+			record := &cronJobRecord{
+				LastRun:  now,
+				Revision: prev.Revision,
+			}
+			records[key] = record
+			if spec.OnlyIfChanged && prev.Revision == rs.Revision {
+				sklog.Infof("Skipping %s in %s; HEAD has not changed since %s.", name, rs.Repo, rs.Revision)
+				continue
+			}
+			n := numCronJobs(spec.GetCatchUp(), due, now)
+			if n == 0 {
+				sklog.Infof("Skipping %s in %s; missed scheduled run at %s.", name, rs.Repo, due[len(due)-1])
+				continue
+			}
+			sklog.Infof("Triggering %d %s job(s) in %s", n, name, rs.Repo)
+			for i := 0; i < n; i++ {
+				j, err := s.taskCfgCache.MakeJob(rs, name)
+				if err != nil {
+					return err
+				}
+				j.Trigger = spec.Trigger
+				jobs = append(jobs, j)
+			}
+			record.Revision = rs.Revision
+			triggered[spec.Trigger] = true
+		}
+	}
+	if len(jobs) > 0 {
+		if err := s.db.PutJobs(jobs); err != nil {
+			return err
+		}
+	}
+	// Only update the records once the Jobs have been inserted, so that
+	// failed runs are retried. This also drops records for JobSpecs which
+	// no longer exist.
+	s.triggerMetrics.CronJobs = records
+	for trigger := range triggered {
+		s.triggerMetrics.Reset(trigger)
+	}
+	for trigger := range s.triggerMetrics.NextRun {
+		if _, ok := nextRun[trigger]; !ok {
+			s.triggerMetrics.SetNextRun(trigger, time.Time{})
+		}
+	}
+	for trigger, next := range nextRun {
+		s.triggerMetrics.SetNextRun(trigger, next)
+	}
+	return nil
+}
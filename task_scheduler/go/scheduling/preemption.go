@@ -0,0 +1,277 @@
+package scheduling
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	swarming_api "github.com/luci/luci-go/common/api/swarming/swarming/v1"
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/go/sklog"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/db"
+)
+
+const (
+	// PREEMPTED_TASK_COMMENT_USER is the user name attached to
+	// TaskComments which are added to preempted tasks.
+	PREEMPTED_TASK_COMMENT_USER = "task-scheduler"
+
+	// MAX_PREEMPTIONS_PER_CYCLE is the maximum number of tasks which may
+	// be preempted in a single scheduling cycle.
+	MAX_PREEMPTIONS_PER_CYCLE = 5
+
+	// MAX_RECENT_PREEMPTIONS is the number of preemptions which are
+	// reported in the TaskSchedulerStatus.
+	MAX_RECENT_PREEMPTIONS = 50
+
+	// PREEMPTION_GRACE_PERIOD is how long a task candidate which caused a
+	// preemption waits for the freed bot before it may preempt another
+	// task.
+	PREEMPTION_GRACE_PERIOD = 10 * time.Minute
+
+	// Measurement name for the number of preempted tasks.
+	MEASUREMENT_TASK_PREEMPTIONS = "task-preemptions"
+)
+
+// Preemption records the cancellation of a backfill task to make room for a
+// higher-priority task candidate.
+//
+// Preemptions are only kept in memory, for the status page and to enforce
+// PREEMPTION_GRACE_PERIOD, so they are lost when the Task Scheduler restarts.
+// The durable record of a preemption is the Preempted bit and the TaskComment
+// which are added to the preempted Task in the DB.
+type Preemption struct {
+	// BotId is the ID of the bot which was running the preempted task.
+	BotId string `json:"botId"`
+
+	// Candidate is the TaskKey of the task candidate which caused the
+	// preemption.
+	Candidate db.TaskKey `json:"candidate"`
+
+	// Score is the score of the task candidate at the time of preemption.
+	Score float64 `json:"score"`
+
+	// Task is the TaskKey of the preempted task.
+	Task db.TaskKey `json:"task"`
+
+	// TaskId is the ID of the preempted task.
+	TaskId string `json:"taskId"`
+
+	// Timestamp is the time of the preemption.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// isBackfill returns true iff the given Task is a backfill task, ie. it is
+// neither a try job nor a forced task and it is not running at HEAD of the
+// master branch. Only backfill tasks may be preempted.
+func (s *TaskScheduler) isBackfill(t *db.Task) bool {
+	if t.IsTryJob() || t.IsForceRun() {
+		return false
+	}
+	repo, ok := s.repos[t.Repo]
+	if !ok {
+		return false
+	}
+	head := repo.Get("master")
+	if head == nil {
+		return false
+	}
+	return t.Revision != head.Hash
+}
+
+// isRerunOfPreempted returns true iff the given Task is a re-run of a preempted
+// Task in the given slice.
+func isRerunOfPreempted(t *db.Task, tasks []*db.Task) bool {
+	for _, prev := range tasks {
+		if prev.Id == t.RetryOf {
+			return prev.Preempted
+		}
+	}
+	return false
+}
+
+// canPreempt returns true iff the given task candidate may cause a backfill
+// task to be preempted, ie. it is a try job or a forced task and it has not
+// recently caused another preemption.
+func canPreempt(c *taskCandidate, recent []*Preemption, now time.Time) bool {
+	if !c.IsTryJob() && !c.IsForceRun() {
+		return false
+	}
+	if c.Score <= 0.0 {
+		return false
+	}
+	for _, p := range recent {
+		if p.Candidate == c.TaskKey && now.Sub(p.Timestamp) < PREEMPTION_GRACE_PERIOD {
+			return false
+		}
+	}
+	return true
+}
+
+// preemptBackfillTasks kills running backfill tasks on Swarming to make
+// room for try jobs and forced tasks in the queue which were not scheduled
+// because no bot in their dimension set was free. The preempted tasks are
+// marked as such in the DB so that they are re-queued without counting as an
+// attempt. Returns the new Preemptions.
+func (s *TaskScheduler) preemptBackfillTasks(queue, scheduled []*taskCandidate, now time.Time) ([]*Preemption, error) {
+	defer metrics2.FuncTimer().Stop()
+
+	wasScheduled := make(map[db.TaskKey]bool, len(scheduled))
+	for _, c := range scheduled {
+		wasScheduled[c.TaskKey] = true
+	}
+	s.queueMtx.RLock()
+	recent := s.preemptions
+	s.queueMtx.RUnlock()
+	candidates := []*taskCandidate{}
+	for _, c := range queue {
+		if !wasScheduled[c.TaskKey] && canPreempt(c, recent, now) {
+			candidates = append(candidates, c)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	// Find the running backfill tasks, keyed by Swarming task ID.
+	unfinished, err := s.tCache.UnfinishedTasks()
+	if err != nil {
+		return nil, err
+	}
+	backfill := map[string]*db.Task{}
+	for _, t := range unfinished {
+		if t.Status == db.TASK_STATUS_RUNNING && !t.Preempted && s.isBackfill(t) {
+			backfill[t.SwarmingTaskId] = t
+		}
+	}
+	if len(backfill) == 0 {
+		return nil, nil
+	}
+
+	rv := []*Preemption{}
+	preempted := map[string]bool{}
+	// Many candidates share a dimension set, so only list the bots for each
+	// dimension set once per cycle.
+	botLists := map[string][]*swarming_api.SwarmingRpcsBotInfo{}
+	for _, c := range candidates {
+		if len(rv) >= MAX_PREEMPTIONS_PER_CYCLE {
+			break
+		}
+		sortedDims := util.CopyStringSlice(c.TaskSpec.Dimensions)
+		sort.Strings(sortedDims)
+		dimsKey := strings.Join(sortedDims, "\n")
+		bots, ok := botLists[dimsKey]
+		if !ok {
+			dims := make(map[string]string, len(c.TaskSpec.Dimensions))
+			for _, d := range c.TaskSpec.Dimensions {
+				split := strings.SplitN(d, ":", 2)
+				dims[split[0]] = split[1]
+			}
+			bots, err = s.swarming.ListBots(dims)
+			if err != nil {
+				return rv, err
+			}
+			botLists[dimsKey] = bots
+		}
+		// Choose the most recently started backfill task, so that we
+		// waste as little work as possible.
+		var victim *db.Task
+		var botId string
+		for _, b := range bots {
+			if b.TaskId == "" || b.IsDead || b.Quarantined {
+				continue
+			}
+			t, ok := backfill[b.TaskId]
+			if !ok || preempted[t.Id] {
+				continue
+			}
+			if victim == nil || t.Started.After(victim.Started) {
+				victim = t
+				botId = b.BotId
+			}
+		}
+		if victim == nil {
+			continue
+		}
+		// Use KillTask, since CancelTask only affects pending tasks.
+		if err := s.swarming.KillTask(victim.SwarmingTaskId); err != nil {
+			sklog.Errorf("Failed to preempt task %s: %s", victim.Id, err)
+			continue
+		}
+		sklog.Infof("Preempted %s @ %s (%s) on %s for %s @ %s (score %f)", victim.Name, victim.Revision, victim.Id, botId, c.Name, c.Revision, c.Score)
+		preempted[victim.Id] = true
+		rv = append(rv, &Preemption{
+			BotId:     botId,
+			Candidate: c.TaskKey.Copy(),
+			Score:     c.Score,
+			Task:      victim.TaskKey.Copy(),
+			TaskId:    victim.Id,
+			Timestamp: now,
+		})
+	}
+	if len(rv) == 0 {
+		return nil, nil
+	}
+	metrics2.GetCounter(MEASUREMENT_TASK_PREEMPTIONS, nil).Inc(int64(len(rv)))
+
+	// Record the preemptions.
+	s.queueMtx.Lock()
+	s.preemptions = append(rv, s.preemptions...)
+	if len(s.preemptions) > MAX_RECENT_PREEMPTIONS {
+		s.preemptions = s.preemptions[:MAX_RECENT_PREEMPTIONS]
+	}
+	s.queueMtx.Unlock()
+	if err := s.markTasksPreempted(rv); err != nil {
+		return rv, err
+	}
+	return rv, nil
+}
+
+// markTasksPreempted sets the Preempted bit on the Tasks for the given
+// Preemptions in the DB and adds a TaskComment to each one.
+func (s *TaskScheduler) markTasksPreempted(preemptions []*Preemption) error {
+	ids := make([]string, 0, len(preemptions))
+	for _, p := range preemptions {
+		ids = append(ids, p.TaskId)
+	}
+	sort.Strings(ids)
+	if _, err := db.UpdateTasksWithRetries(s.db, func() ([]*db.Task, error) {
+		tasks := make([]*db.Task, 0, len(ids))
+		for _, id := range ids {
+			t, err := s.db.GetTaskById(id)
+			if err != nil {
+				return nil, err
+			}
+			if t == nil {
+				return nil, db.ErrNotFound
+			}
+			t.Preempted = true
+			tasks = append(tasks, t)
+		}
+		return tasks, nil
+	}); err != nil {
+		return fmt.Errorf("Failed to mark tasks as preempted: %s", err)
+	}
+
+	for _, p := range preemptions {
+		msg := fmt.Sprintf("Task %s was preempted on %s by %s @ %s", p.TaskId, p.BotId, p.Candidate.Name, p.Candidate.Revision)
+		if p.Candidate.IsTryJob() {
+			msg += fmt.Sprintf(" (issue %s, patchset %s)", p.Candidate.Issue, p.Candidate.Patchset)
+		}
+		c := &db.TaskComment{
+			Repo:      p.Task.Repo,
+			Revision:  p.Task.Revision,
+			Name:      p.Task.Name,
+			Timestamp: p.Timestamp,
+			TaskId:    p.TaskId,
+			User:      PREEMPTED_TASK_COMMENT_USER,
+			Message:   msg + "; it will be retried.",
+		}
+		if err := s.db.PutTaskComment(c); err != nil && err != db.ErrAlreadyExists {
+			return fmt.Errorf("Failed to add comment to preempted task: %s", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package scheduling
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	swarming_api "github.com/luci/luci-go/common/api/swarming/swarming/v1"
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/swarming"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/task_scheduler/go/db"
+	specs_testutils "go.skia.org/infra/task_scheduler/go/specs/testutils"
+)
+
+func TestCanPreempt(t *testing.T) {
+	testutils.SmallTest(t)
+
+	now := time.Now()
+	c := makeTaskCandidate("Test", []string{"pool:Skia"})
+	c.Score = 20.0
+
+	// Only try jobs and forced tasks may preempt.
+	assert.False(t, canPreempt(c, nil, now))
+	c.ForcedJobId = "abc"
+	assert.True(t, canPreempt(c, nil, now))
+	c.ForcedJobId = ""
+	c.Issue = "1"
+	c.Patchset = "2"
+	c.Server = "https://codereview"
+	assert.True(t, canPreempt(c, nil, now))
+	c.Score = 0.0
+	assert.False(t, canPreempt(c, nil, now))
+	c.Score = 20.0
+
+	// A candidate which recently caused a preemption must wait.
+	recent := []*Preemption{
+		{
+			Candidate: c.TaskKey,
+			Timestamp: now.Add(-time.Minute),
+		},
+	}
+	assert.False(t, canPreempt(c, recent, now))
+	recent[0].Timestamp = now.Add(-PREEMPTION_GRACE_PERIOD)
+	assert.True(t, canPreempt(c, recent, now))
+}
+
+// countingSwarming wraps a swarming.ApiClient, counting calls to ListBots.
+type countingSwarming struct {
+	swarming.ApiClient
+	listBots int
+}
+
+func (c *countingSwarming) ListBots(dimensions map[string]string) ([]*swarming_api.SwarmingRpcsBotInfo, error) {
+	c.listBots++
+	return c.ApiClient.ListBots(dimensions)
+}
+
+func TestPreemptBackfillTasks(t *testing.T) {
+	gb, d, swarmingClient, s, _, cleanup := setup(t)
+	defer cleanup()
+
+	rs1 := getRS1(t, gb)
+	rs2 := getRS2(t, gb)
+	now := time.Now()
+
+	// A backfill task at c1 is running on bot1, and a task at HEAD is
+	// running on bot2.
+	backfill := makeTask(specs_testutils.BuildTask, rs1.Repo, rs1.Revision)
+	backfill.Status = db.TASK_STATUS_RUNNING
+	backfill.Started = now.Add(-time.Minute)
+	backfill.SwarmingBotId = "bot1"
+	backfill.SwarmingTaskId = "swarm1"
+	head := makeTask(specs_testutils.TestTask, rs2.Repo, rs2.Revision)
+	head.Status = db.TASK_STATUS_RUNNING
+	head.Started = now.Add(-time.Minute)
+	head.SwarmingBotId = "bot2"
+	head.SwarmingTaskId = "swarm2"
+	assert.NoError(t, d.PutTasks([]*db.Task{backfill, head}))
+	assert.NoError(t, s.tCache.Update())
+	assert.True(t, s.isBackfill(backfill))
+	assert.False(t, s.isBackfill(head))
+
+	bot1 := makeBot("bot1", linuxTaskDims)
+	bot1.TaskId = backfill.SwarmingTaskId
+	bot2 := makeBot("bot2", linuxTaskDims)
+	bot2.TaskId = head.SwarmingTaskId
+	swarmingClient.MockBots([]*swarming_api.SwarmingRpcsBotInfo{bot1, bot2})
+
+	// A regular candidate can't preempt anything.
+	c := makeTaskCandidate(specs_testutils.TestTask, []string{"pool:Skia", "os:Ubuntu"})
+	c.Repo = rs2.Repo
+	c.Revision = rs2.Revision
+	c.Score = 20.0
+	p, err := s.preemptBackfillTasks([]*taskCandidate{c}, nil, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(p))
+
+	// Nor can a try job which was scheduled.
+	c.Issue = "1"
+	c.Patchset = "2"
+	c.Server = "https://codereview"
+	p, err = s.preemptBackfillTasks([]*taskCandidate{c}, []*taskCandidate{c}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(p))
+
+	// The unscheduled try job preempts the backfill task.
+	p, err = s.preemptBackfillTasks([]*taskCandidate{c}, nil, now)
+	assert.NoError(t, err)
+	testutils.AssertDeepEqual(t, []*Preemption{
+		{
+			BotId:     "bot1",
+			Candidate: c.TaskKey,
+			Score:     c.Score,
+			Task:      backfill.TaskKey,
+			TaskId:    backfill.Id,
+			Timestamp: now,
+		},
+	}, p)
+	testutils.AssertDeepEqual(t, p, s.Status().Preemptions)
+	assert.Equal(t, []string{backfill.SwarmingTaskId}, swarmingClient.KilledTasks())
+	preempted, err := d.GetTaskById(backfill.Id)
+	assert.NoError(t, err)
+	assert.True(t, preempted.Preempted)
+	comments, err := d.GetCommentsForRepos([]string{rs1.Repo}, now.Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(comments[0].TaskComments[rs1.Revision][backfill.Name]))
+
+	// The try job doesn't preempt anything else while it waits for the
+	// bot.
+	p, err = s.preemptBackfillTasks([]*taskCandidate{c}, nil, now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(p))
+
+	// Once the preempted task is cancelled, it's re-queued with the same
+	// attempt number.
+	preempted.Status = db.TASK_STATUS_MISHAP
+	preempted.Finished = now
+	assert.NoError(t, d.PutTask(preempted))
+	assert.NoError(t, s.tCache.Update())
+	spec, err := s.taskCfgCache.GetTaskSpec(rs1, backfill.Name)
+	assert.NoError(t, err)
+	candidates, err := s.filterTaskCandidates(map[db.TaskKey]*taskCandidate{
+		backfill.TaskKey: {
+			TaskKey:  backfill.TaskKey,
+			TaskSpec: spec,
+		},
+	})
+	assert.NoError(t, err)
+	requeued := candidates[rs1.Repo][backfill.Name]
+	assert.Equal(t, 1, len(requeued))
+	assert.Equal(t, preempted.Attempt, requeued[0].Attempt)
+	assert.Equal(t, preempted.Id, requeued[0].RetryOf)
+}
+
+// The bots for each dimension set are only listed once per cycle, even if no
+// candidate finds a task to preempt.
+func TestPreemptBackfillTasksListsBotsOnce(t *testing.T) {
+	gb, d, swarmingClient, s, _, cleanup := setup(t)
+	defer cleanup()
+	rs1 := getRS1(t, gb)
+	now := time.Now()
+
+	// A running backfill task is needed for preemption to be attempted,
+	// but it runs on a bot which doesn't match the candidates.
+	backfill := makeTask(specs_testutils.BuildTask, rs1.Repo, rs1.Revision)
+	backfill.Status = db.TASK_STATUS_RUNNING
+	backfill.Started = now.Add(-time.Minute)
+	backfill.SwarmingBotId = "bot1"
+	backfill.SwarmingTaskId = "swarm1"
+	assert.NoError(t, d.PutTask(backfill))
+	assert.NoError(t, s.tCache.Update())
+	assert.True(t, s.isBackfill(backfill))
+	bot1 := makeBot("bot1", map[string]string{"pool": "Skia", "os": "Mac"})
+	bot1.TaskId = backfill.SwarmingTaskId
+	swarmingClient.MockBots([]*swarming_api.SwarmingRpcsBotInfo{bot1})
+
+	counting := &countingSwarming{ApiClient: s.swarming}
+	s.swarming = counting
+	queue := []*taskCandidate{}
+	for i := 0; i < 10; i++ {
+		dims := []string{"pool:Skia", "os:Ubuntu"}
+		if i%2 == 1 {
+			dims = []string{"os:Ubuntu", "pool:Skia"}
+		}
+		c := makeTaskCandidate(fmt.Sprintf("%s-%d", specs_testutils.TestTask, i), dims)
+		c.Issue = "1"
+		c.Patchset = "2"
+		c.Server = "https://codereview"
+		c.Score = 20.0
+		queue = append(queue, c)
+	}
+	p, err := s.preemptBackfillTasks(queue, nil, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(p))
+	assert.Equal(t, 1, counting.listBots)
+}
@@ -0,0 +1,327 @@
+package scheduling
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"go.skia.org/infra/go/metrics2"
+	"go.skia.org/infra/go/util"
+	"go.skia.org/infra/task_scheduler/go/db"
+)
+
+const (
+	// Trigger types, used for dividing bot capacity between Jobs which were
+	// created for different reasons.
+	TRIGGER_TYPE_COMMIT   = "commit"
+	TRIGGER_TYPE_FORCED   = "forced"
+	TRIGGER_TYPE_PERIODIC = "periodic"
+	TRIGGER_TYPE_TRYJOB   = "tryjob"
+
+	// DEFAULT_SHARE_WEIGHT is the weight given to any repo or trigger type
+	// which is not listed in a QuotaConfig.
+	DEFAULT_SHARE_WEIGHT = 1.0
+
+	// Measurement names for share usage by dimension set.
+	MEASUREMENT_SHARE_TARGET = "task-scheduler-share-target"
+	MEASUREMENT_SHARE_USAGE  = "task-scheduler-share-usage"
+)
+
+var (
+	TRIGGER_TYPES = []string{
+		TRIGGER_TYPE_COMMIT,
+		TRIGGER_TYPE_FORCED,
+		TRIGGER_TYPE_PERIODIC,
+		TRIGGER_TYPE_TRYJOB,
+	}
+)
+
+// QuotaConfig describes how the bot capacity in each dimension set is divided
+// between repos and trigger types. The weight of a share is the product of the
+// weight of its repo and the weight of its trigger type. Shares which have no
+// task candidates and no pending or running tasks are considered idle, and
+// their capacity is lent to the other shares in the same dimension set.
+type QuotaConfig struct {
+	// Repos maps repo URLs to relative weights. Repos which are not listed
+	// receive DEFAULT_SHARE_WEIGHT.
+	Repos map[string]float64 `json:"repos"`
+
+	// TriggerTypes maps trigger types to relative weights. Trigger types
+	// which are not listed receive DEFAULT_SHARE_WEIGHT.
+	TriggerTypes map[string]float64 `json:"trigger_types"`
+}
+
+// ReadQuotaConfig reads a QuotaConfig from the given JSON file.
+func ReadQuotaConfig(file string) (*QuotaConfig, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read quota config: %s", err)
+	}
+	defer util.Close(f)
+	var rv QuotaConfig
+	if err := json.NewDecoder(f).Decode(&rv); err != nil {
+		return nil, fmt.Errorf("Failed to decode quota config: %s", err)
+	}
+	if err := rv.Validate(); err != nil {
+		return nil, err
+	}
+	return &rv, nil
+}
+
+// Validate returns an error if the QuotaConfig is not valid.
+func (c *QuotaConfig) Validate() error {
+	for repo, w := range c.Repos {
+		if w < 0.0 {
+			return fmt.Errorf("Weight for repo %q must not be negative; got %f", repo, w)
+		}
+	}
+	for t, w := range c.TriggerTypes {
+		if !util.In(t, TRIGGER_TYPES) {
+			return fmt.Errorf("Unknown trigger type %q; must be one of %v", t, TRIGGER_TYPES)
+		}
+		if w < 0.0 {
+			return fmt.Errorf("Weight for trigger type %q must not be negative; got %f", t, w)
+		}
+	}
+	return nil
+}
+
+// Weight returns the weight of the share for the given repo and trigger type.
+func (c *QuotaConfig) Weight(repo, triggerType string) float64 {
+	repoWeight, ok := c.Repos[repo]
+	if !ok {
+		repoWeight = DEFAULT_SHARE_WEIGHT
+	}
+	triggerWeight, ok := c.TriggerTypes[triggerType]
+	if !ok {
+		triggerWeight = DEFAULT_SHARE_WEIGHT
+	}
+	return repoWeight * triggerWeight
+}
+
+// shareKey identifies a share of the bot capacity in a dimension set.
+type shareKey struct {
+	Repo        string
+	TriggerType string
+}
+
+// ShareUsage describes the current usage of one share of the bot capacity in
+// a dimension set.
+type ShareUsage struct {
+	// Dimensions describes the dimension set, as returned by dimensionsKey.
+	Dimensions string `json:"dimensions"`
+
+	// Repo and TriggerType identify the share.
+	Repo        string `json:"repo"`
+	TriggerType string `json:"trigger_type"`
+
+	// Queued is the number of task candidates in the share.
+	Queued int `json:"queued"`
+
+	// Running is the number of pending or running tasks in the share.
+	Running int `json:"running"`
+
+	// Target is the fraction of the capacity of the dimension set which is
+	// allotted to the share, given the set of shares which are not idle.
+	Target float64 `json:"target"`
+
+	// Usage is the fraction of the pending and running tasks in the
+	// dimension set which belong to the share.
+	Usage float64 `json:"usage"`
+}
+
+// shareUsageSlice implements sort.Interface.
+type shareUsageSlice []*ShareUsage
+
+func (s shareUsageSlice) Len() int { return len(s) }
+func (s shareUsageSlice) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s shareUsageSlice) Less(i, j int) bool {
+	if s[i].Dimensions != s[j].Dimensions {
+		return s[i].Dimensions < s[j].Dimensions
+	}
+	if s[i].Repo != s[j].Repo {
+		return s[i].Repo < s[j].Repo
+	}
+	return s[i].TriggerType < s[j].TriggerType
+}
+
+// triggerTypeForJob returns the trigger type of the given Job.
+func triggerTypeForJob(j *db.Job) string {
+	if j.IsForce {
+		return TRIGGER_TYPE_FORCED
+	} else if j.IsTryJob() {
+		return TRIGGER_TYPE_TRYJOB
+	} else if j.Trigger != "" {
+		return TRIGGER_TYPE_PERIODIC
+	}
+	return TRIGGER_TYPE_COMMIT
+}
+
+// dimensionsKey returns a string which uniquely identifies the given set of
+// dimensions, regardless of their order.
+func dimensionsKey(dims []string) string {
+	cpy := util.CopyStringSlice(dims)
+	sort.Strings(cpy)
+	return strings.Join(cpy, " ")
+}
+
+// quotaEntry is a helper struct used for ordering task candidates by their
+// position within their share.
+type quotaEntry struct {
+	candidate *taskCandidate
+	position  float64
+}
+
+// quotaEntrySlice implements sort.Interface.
+type quotaEntrySlice []*quotaEntry
+
+func (s quotaEntrySlice) Len() int { return len(s) }
+func (s quotaEntrySlice) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s quotaEntrySlice) Less(i, j int) bool {
+	return s[i].position < s[j].position
+}
+
+// applyQuotas reorders the given queue, which is assumed to be sorted in
+// decreasing order by score, so that the candidates in each dimension set are
+// interleaved according to the weights of their shares. Within a share,
+// candidates keep their relative order. Each candidate is positioned at the
+// number of tasks its share would have in use if it ran, divided by the weight
+// of the share, so that a share which is using less than its portion of the
+// capacity moves ahead of a share which is using more. Shares with zero weight
+// are placed at the end of the dimension set, where they may only use bots
+// which no other share wants. The set of queue positions occupied by each
+// dimension set does not change. Also returns the usage of each share which
+// is not idle. The running map is keyed by dimension set and share and
+// contains the number of pending or running tasks.
+func applyQuotas(cfg *QuotaConfig, queue []*taskCandidate, running map[string]map[shareKey]int) ([]*taskCandidate, []*ShareUsage) {
+	positions := map[string][]int{}
+	byDims := map[string][]*taskCandidate{}
+	for i, c := range queue {
+		k := dimensionsKey(c.TaskSpec.Dimensions)
+		positions[k] = append(positions[k], i)
+		byDims[k] = append(byDims[k], c)
+	}
+	allDims := util.StringSet{}
+	for k := range byDims {
+		allDims[k] = true
+	}
+	for k := range running {
+		allDims[k] = true
+	}
+
+	rv := make([]*taskCandidate, len(queue))
+	usage := []*ShareUsage{}
+	for dims := range allDims {
+		counts := running[dims]
+		queued := map[shareKey]int{}
+		entries := make([]*quotaEntry, 0, len(byDims[dims]))
+		for _, c := range byDims[dims] {
+			k := shareKey{
+				Repo:        c.Repo,
+				TriggerType: c.TriggerType,
+			}
+			queued[k]++
+			pos := math.Inf(1)
+			if w := cfg.Weight(k.Repo, k.TriggerType); w > 0.0 {
+				pos = float64(counts[k]+queued[k]) / w
+			}
+			entries = append(entries, &quotaEntry{
+				candidate: c,
+				position:  pos,
+			})
+		}
+		sort.Stable(quotaEntrySlice(entries))
+		for i, e := range entries {
+			rv[positions[dims][i]] = e.candidate
+		}
+
+		// Compute the usage for each active share.
+		active := make(map[shareKey]bool, len(counts)+len(queued))
+		totalRunning := 0
+		for k, n := range counts {
+			active[k] = true
+			totalRunning += n
+		}
+		for k := range queued {
+			active[k] = true
+		}
+		totalWeight := 0.0
+		for k := range active {
+			totalWeight += cfg.Weight(k.Repo, k.TriggerType)
+		}
+		for k := range active {
+			u := &ShareUsage{
+				Dimensions:  dims,
+				Repo:        k.Repo,
+				TriggerType: k.TriggerType,
+				Queued:      queued[k],
+				Running:     counts[k],
+			}
+			if totalWeight > 0.0 {
+				u.Target = cfg.Weight(k.Repo, k.TriggerType) / totalWeight
+			}
+			if totalRunning > 0 {
+				u.Usage = float64(counts[k]) / float64(totalRunning)
+			}
+			usage = append(usage, u)
+		}
+	}
+	sort.Sort(shareUsageSlice(usage))
+	return rv, usage
+}
+
+// runningTasksByShare returns the number of pending and running tasks for the
+// given Jobs, keyed by dimension set and share.
+func (s *TaskScheduler) runningTasksByShare(jobs []*db.Job) (map[string]map[shareKey]int, error) {
+	rv := map[string]map[shareKey]int{}
+	seen := map[string]bool{}
+	for _, j := range jobs {
+		k := shareKey{
+			Repo:        j.Repo,
+			TriggerType: triggerTypeForJob(j),
+		}
+		for name, tasks := range j.Tasks {
+			for _, t := range tasks {
+				if t.Status != db.TASK_STATUS_PENDING && t.Status != db.TASK_STATUS_RUNNING {
+					continue
+				}
+				if seen[t.Id] {
+					continue
+				}
+				seen[t.Id] = true
+				spec, err := s.taskCfgCache.GetTaskSpec(j.RepoState, name)
+				if err != nil {
+					return nil, err
+				}
+				dims := dimensionsKey(spec.Dimensions)
+				byShare, ok := rv[dims]
+				if !ok {
+					byShare = map[shareKey]int{}
+					rv[dims] = byShare
+				}
+				byShare[k]++
+			}
+		}
+	}
+	return rv, nil
+}
+
+// recordShareUsageMetrics generates metrics for the given share usage.
+func recordShareUsageMetrics(usage []*ShareUsage) {
+	for _, u := range usage {
+		tags := map[string]string{
+			"dimensions":   u.Dimensions,
+			"repo":         u.Repo,
+			"trigger_type": u.TriggerType,
+		}
+		metrics2.GetFloat64Metric(MEASUREMENT_SHARE_TARGET, tags).Update(u.Target)
+		metrics2.GetFloat64Metric(MEASUREMENT_SHARE_USAGE, tags).Update(u.Usage)
+	}
+}
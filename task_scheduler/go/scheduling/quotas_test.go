@@ -0,0 +1,189 @@
+package scheduling
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"testing"
+
+	assert "github.com/stretchr/testify/require"
+	"go.skia.org/infra/go/testutils"
+	"go.skia.org/infra/task_scheduler/go/db"
+	"go.skia.org/infra/task_scheduler/go/specs"
+)
+
+func TestQuotaConfigValidate(t *testing.T) {
+	testutils.SmallTest(t)
+
+	c := &QuotaConfig{
+		Repos: map[string]float64{
+			"a.git": 2.0,
+		},
+		TriggerTypes: map[string]float64{
+			TRIGGER_TYPE_TRYJOB: 3.0,
+		},
+	}
+	assert.NoError(t, c.Validate())
+	assert.Equal(t, 6.0, c.Weight("a.git", TRIGGER_TYPE_TRYJOB))
+	assert.Equal(t, 2.0, c.Weight("a.git", TRIGGER_TYPE_COMMIT))
+	assert.Equal(t, DEFAULT_SHARE_WEIGHT, c.Weight("b.git", TRIGGER_TYPE_COMMIT))
+
+	c.TriggerTypes["bogus"] = 1.0
+	assert.EqualError(t, c.Validate(), fmt.Sprintf("Unknown trigger type \"bogus\"; must be one of %v", TRIGGER_TYPES))
+	delete(c.TriggerTypes, "bogus")
+
+	c.Repos["a.git"] = -1.0
+	assert.EqualError(t, c.Validate(), "Weight for repo \"a.git\" must not be negative; got -1.000000")
+}
+
+func TestReadQuotaConfig(t *testing.T) {
+	testutils.SmallTest(t)
+
+	tmp, err := ioutil.TempDir("", "")
+	assert.NoError(t, err)
+	defer testutils.RemoveAll(t, tmp)
+	f := path.Join(tmp, "quotas.json")
+	testutils.WriteFile(t, f, `{"repos": {"a.git": 0.5}, "trigger_types": {"periodic": 0.1}}`)
+	c, err := ReadQuotaConfig(f)
+	assert.NoError(t, err)
+	testutils.AssertDeepEqual(t, &QuotaConfig{
+		Repos:        map[string]float64{"a.git": 0.5},
+		TriggerTypes: map[string]float64{TRIGGER_TYPE_PERIODIC: 0.1},
+	}, c)
+
+	_, err = ReadQuotaConfig(path.Join(tmp, "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestTriggerTypeForJob(t *testing.T) {
+	testutils.SmallTest(t)
+
+	j := &db.Job{
+		RepoState: db.RepoState{
+			Repo:     "a.git",
+			Revision: "abc",
+		},
+	}
+	assert.Equal(t, TRIGGER_TYPE_COMMIT, triggerTypeForJob(j))
+	j.Trigger = "nightly"
+	assert.Equal(t, TRIGGER_TYPE_PERIODIC, triggerTypeForJob(j))
+	j.Trigger = ""
+	j.IsForce = true
+	assert.Equal(t, TRIGGER_TYPE_FORCED, triggerTypeForJob(j))
+	j.IsForce = false
+	j.Patch = db.Patch{
+		Issue:    "1",
+		Patchset: "2",
+		Server:   "https://codereview",
+	}
+	assert.Equal(t, TRIGGER_TYPE_TRYJOB, triggerTypeForJob(j))
+}
+
+func TestApplyQuotas(t *testing.T) {
+	testutils.SmallTest(t)
+
+	dimsLinux := []string{"pool:Skia", "os:Ubuntu"}
+	dimsAndroid := []string{"pool:Skia", "os:Android"}
+	keyLinux := dimensionsKey(dimsLinux)
+	keyAndroid := dimensionsKey(dimsAndroid)
+	assert.Equal(t, "os:Ubuntu pool:Skia", keyLinux)
+
+	candidate := func(name, repo, triggerType string, dims []string, score float64) *taskCandidate {
+		return &taskCandidate{
+			Score: score,
+			TaskKey: db.TaskKey{
+				RepoState: db.RepoState{
+					Repo:     repo,
+					Revision: "abc",
+				},
+				Name: name,
+			},
+			TaskSpec: &specs.TaskSpec{
+				Dimensions: dims,
+			},
+			TriggerType: triggerType,
+		}
+	}
+	a1 := candidate("a1", "a.git", TRIGGER_TYPE_COMMIT, dimsLinux, 10.0)
+	a2 := candidate("a2", "a.git", TRIGGER_TYPE_COMMIT, dimsLinux, 9.0)
+	a3 := candidate("a3", "a.git", TRIGGER_TYPE_COMMIT, dimsLinux, 8.0)
+	android := candidate("android", "a.git", TRIGGER_TYPE_COMMIT, dimsAndroid, 7.0)
+	b1 := candidate("b1", "b.git", TRIGGER_TYPE_TRYJOB, dimsLinux, 6.0)
+	b2 := candidate("b2", "b.git", TRIGGER_TYPE_TRYJOB, dimsLinux, 5.0)
+	queue := []*taskCandidate{a1, a2, a3, android, b1, b2}
+
+	// Equal weights, nothing running. The candidates for the two shares
+	// should be interleaved, and the Android candidate keeps its position.
+	cfg := &QuotaConfig{}
+	rv, usage := applyQuotas(cfg, queue, map[string]map[shareKey]int{})
+	testutils.AssertDeepEqual(t, []*taskCandidate{a1, b1, a2, android, b2, a3}, rv)
+	testutils.AssertDeepEqual(t, []*ShareUsage{
+		{
+			Dimensions:  keyAndroid,
+			Repo:        "a.git",
+			TriggerType: TRIGGER_TYPE_COMMIT,
+			Queued:      1,
+			Target:      1.0,
+		},
+		{
+			Dimensions:  keyLinux,
+			Repo:        "a.git",
+			TriggerType: TRIGGER_TYPE_COMMIT,
+			Queued:      3,
+			Target:      0.5,
+		},
+		{
+			Dimensions:  keyLinux,
+			Repo:        "b.git",
+			TriggerType: TRIGGER_TYPE_TRYJOB,
+			Queued:      2,
+			Target:      0.5,
+		},
+	}, usage)
+
+	// The commit share is already using two bots, so the try jobs should
+	// go first.
+	running := map[string]map[shareKey]int{
+		keyLinux: {
+			shareKey{Repo: "a.git", TriggerType: TRIGGER_TYPE_COMMIT}: 2,
+		},
+	}
+	rv, usage = applyQuotas(cfg, queue, running)
+	testutils.AssertDeepEqual(t, []*taskCandidate{b1, b2, a1, android, a2, a3}, rv)
+	assert.Equal(t, 1.0, usage[1].Usage)
+	assert.Equal(t, 2, usage[1].Running)
+	assert.Equal(t, 0.0, usage[2].Usage)
+
+	// Try jobs get three times the weight.
+	cfg.TriggerTypes = map[string]float64{
+		TRIGGER_TYPE_TRYJOB: 3.0,
+	}
+	rv, usage = applyQuotas(cfg, queue, map[string]map[shareKey]int{})
+	testutils.AssertDeepEqual(t, []*taskCandidate{b1, b2, a1, android, a2, a3}, rv)
+	assert.Equal(t, 0.25, usage[1].Target)
+	assert.Equal(t, 0.75, usage[2].Target)
+
+	// A share with zero weight only gets bots which nobody else wants.
+	cfg.TriggerTypes[TRIGGER_TYPE_TRYJOB] = 0.0
+	rv, _ = applyQuotas(cfg, queue, map[string]map[shareKey]int{})
+	testutils.AssertDeepEqual(t, []*taskCandidate{a1, a2, a3, android, b1, b2}, rv)
+
+	// Shares with running tasks but no candidates still report usage.
+	running = map[string]map[shareKey]int{
+		keyLinux: {
+			shareKey{Repo: "c.git", TriggerType: TRIGGER_TYPE_PERIODIC}: 1,
+		},
+	}
+	rv, usage = applyQuotas(&QuotaConfig{}, []*taskCandidate{}, running)
+	testutils.AssertDeepEqual(t, []*taskCandidate{}, rv)
+	testutils.AssertDeepEqual(t, []*ShareUsage{
+		{
+			Dimensions:  keyLinux,
+			Repo:        "c.git",
+			TriggerType: TRIGGER_TYPE_PERIODIC,
+			Running:     1,
+			Target:      1.0,
+			Usage:       1.0,
+		},
+	}, usage)
+}
@@ -20,24 +20,29 @@ import (
 
 // taskCandidate is a struct used for determining which tasks to schedule.
 type taskCandidate struct {
-	Attempt        int       `json:"attempt"`
-	Commits        []string  `json:"commits"`
-	IsolatedInput  string    `json:"isolatedInput"`
-	IsolatedHashes []string  `json:"isolatedHashes"`
-	JobCreated     time.Time `json:"jobCreated"`
-	ParentTaskIds  []string  `json:"parentTaskIds"`
-	RetryOf        string    `json:"retryOf"`
-	Score          float64   `json:"score"`
-	StealingFromId string    `json:"stealingFromId"`
+	Attempt        int               `json:"attempt"`
+	AvoidBotId     string            `json:"avoidBotId"`
+	Commits        []string          `json:"commits"`
+	InputEnv       map[string]string `json:"inputEnv"`
+	IsolatedInput  string            `json:"isolatedInput"`
+	IsolatedHashes []string          `json:"isolatedHashes"`
+	JobCreated     time.Time         `json:"jobCreated"`
+	ParentTaskIds  []string          `json:"parentTaskIds"`
+	RetryOf        string            `json:"retryOf"`
+	Score          float64           `json:"score"`
+	StealingFromId string            `json:"stealingFromId"`
 	db.TaskKey
-	TaskSpec *specs.TaskSpec `json:"taskSpec"`
+	TaskSpec    *specs.TaskSpec `json:"taskSpec"`
+	TriggerType string          `json:"triggerType"`
 }
 
 // Copy returns a copy of the taskCandidate.
 func (c *taskCandidate) Copy() *taskCandidate {
 	return &taskCandidate{
 		Attempt:        c.Attempt,
+		AvoidBotId:     c.AvoidBotId,
 		Commits:        util.CopyStringSlice(c.Commits),
+		InputEnv:       util.CopyStringMap(c.InputEnv),
 		IsolatedInput:  c.IsolatedInput,
 		IsolatedHashes: util.CopyStringSlice(c.IsolatedHashes),
 		JobCreated:     c.JobCreated,
@@ -47,9 +52,20 @@ func (c *taskCandidate) Copy() *taskCandidate {
 		StealingFromId: c.StealingFromId,
 		TaskKey:        c.TaskKey.Copy(),
 		TaskSpec:       c.TaskSpec.Copy(),
+		TriggerType:    c.TriggerType,
 	}
 }
 
+// tryJobScore returns the score for a try job candidate, which increases with
+// the time that the developer has been waiting on the Job.
+func (c *taskCandidate) tryJobScore(now time.Time) float64 {
+	boost := TRY_JOB_BOOST_PER_HOUR * now.Sub(c.JobCreated).Hours()
+	if boost > MAX_TRY_JOB_BOOST {
+		boost = MAX_TRY_JOB_BOOST
+	}
+	return CANDIDATE_SCORE_TRY_JOB + boost
+}
+
 // MakeId generates a string ID for the taskCandidate.
 func (c *taskCandidate) MakeId() string {
 	var buf bytes.Buffer
@@ -90,11 +106,19 @@ func (c *taskCandidate) MakeTask() *db.Task {
 	if maxAttempts == 0 {
 		maxAttempts = specs.DEFAULT_TASK_SPEC_MAX_ATTEMPTS
 	}
+	var outputs map[string]string
+	if len(c.TaskSpec.Outputs) > 0 {
+		outputs = make(map[string]string, len(c.TaskSpec.Outputs))
+		for _, o := range c.TaskSpec.Outputs {
+			outputs[o.Name] = o.Path
+		}
+	}
 	return &db.Task{
 		Attempt:       c.Attempt,
 		Commits:       commits,
 		Id:            "", // Filled in when the task is inserted into the DB.
 		MaxAttempts:   maxAttempts,
+		Outputs:       outputs,
 		ParentTaskIds: parentTaskIds,
 		RetryOf:       c.RetryOf,
 		TaskKey:       c.TaskKey.Copy(),
@@ -182,14 +206,31 @@ func (c *taskCandidate) MakeTaskRequest(id, isolateServer, pubSubTopic string) (
 	}
 
 	var env []*swarming_api.SwarmingRpcsStringPair
-	if len(c.TaskSpec.Environment) > 0 {
-		env = make([]*swarming_api.SwarmingRpcsStringPair, 0, len(c.TaskSpec.Environment))
+	if len(c.TaskSpec.Environment)+len(c.InputEnv) > 0 {
+		env = make([]*swarming_api.SwarmingRpcsStringPair, 0, len(c.TaskSpec.Environment)+len(c.InputEnv))
 		for k, v := range c.TaskSpec.Environment {
 			env = append(env, &swarming_api.SwarmingRpcsStringPair{
 				Key:   k,
 				Value: v,
 			})
 		}
+		for k, v := range c.InputEnv {
+			env = append(env, &swarming_api.SwarmingRpcsStringPair{
+				Key:   k,
+				Value: v,
+			})
+		}
+	}
+
+	var caches []*swarming_api.SwarmingRpcsCacheEntry
+	if len(c.TaskSpec.Caches) > 0 {
+		caches = make([]*swarming_api.SwarmingRpcsCacheEntry, 0, len(c.TaskSpec.Caches))
+		for _, cache := range c.TaskSpec.Caches {
+			caches = append(caches, &swarming_api.SwarmingRpcsCacheEntry{
+				Name: cache.Name,
+				Path: cache.Path,
+			})
+		}
 	}
 
 	extraArgs := make([]string, 0, len(c.TaskSpec.ExtraArgs))
@@ -214,6 +255,7 @@ func (c *taskCandidate) MakeTaskRequest(id, isolateServer, pubSubTopic string) (
 		Name:           c.Name,
 		Priority:       int64(100.0 * c.TaskSpec.Priority),
 		Properties: &swarming_api.SwarmingRpcsTaskProperties{
+			Caches:               caches,
 			CipdInput:            cipdInput,
 			Dimensions:           dims,
 			Env:                  env,
@@ -234,10 +276,10 @@ func (c *taskCandidate) MakeTaskRequest(id, isolateServer, pubSubTopic string) (
 }
 
 // allDepsMet determines whether all dependencies for the given task candidate
-// have been satisfied, and if so, returns a map of whose keys are task IDs and
-// values are their isolated outputs.
-func (c *taskCandidate) allDepsMet(cache db.TaskCache) (bool, map[string]string, error) {
-	rv := make(map[string]string, len(c.TaskSpec.Dependencies))
+// have been satisfied, and if so, returns a map whose keys are dependency names
+// and values are the tasks which satisfied them.
+func (c *taskCandidate) allDepsMet(cache db.TaskCache) (bool, map[string]*db.Task, error) {
+	rv := make(map[string]*db.Task, len(c.TaskSpec.Dependencies))
 	for _, depName := range c.TaskSpec.Dependencies {
 		key := c.TaskKey.Copy()
 		key.Name = depName
@@ -248,7 +290,7 @@ func (c *taskCandidate) allDepsMet(cache db.TaskCache) (bool, map[string]string,
 		ok := false
 		for _, t := range byKey {
 			if t.Done() && t.Success() && t.IsolatedOutput != "" {
-				rv[t.Id] = t.IsolatedOutput
+				rv[depName] = t
 				ok = true
 				break
 			}
@@ -260,6 +302,28 @@ func (c *taskCandidate) allDepsMet(cache db.TaskCache) (bool, map[string]string,
 	return true, rv, nil
 }
 
+// inputEnv returns the environment variables which give the locations of the
+// named outputs consumed by the task candidate, given the tasks which
+// satisfied its dependencies, as returned by allDepsMet.
+func (c *taskCandidate) inputEnv(parents map[string]*db.Task) (map[string]string, error) {
+	if len(c.TaskSpec.Inputs) == 0 {
+		return nil, nil
+	}
+	rv := make(map[string]string, len(c.TaskSpec.Inputs))
+	for _, in := range c.TaskSpec.Inputs {
+		parent, ok := parents[in.Task]
+		if !ok {
+			return nil, fmt.Errorf("Input %q refers to task %q, which is not a dependency.", in.Output, in.Task)
+		}
+		p, err := parent.GetOutput(in.Output)
+		if err != nil {
+			return nil, err
+		}
+		rv[in.Env] = p
+	}
+	return rv, nil
+}
+
 // taskCandidateSlice is an alias used for sorting a slice of taskCandidates.
 type taskCandidateSlice []*taskCandidate
 
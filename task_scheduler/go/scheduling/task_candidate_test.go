@@ -15,7 +15,9 @@ func TestCopyTaskCandidate(t *testing.T) {
 	testutils.SmallTest(t)
 	v := &taskCandidate{
 		Attempt:        3,
+		AvoidBotId:     "bot1",
 		Commits:        []string{"a", "b"},
+		InputEnv:       map[string]string{"SKIA_BINARY": "out/dm"},
 		IsolatedInput:  "lonely-parameter",
 		IsolatedHashes: []string{"browns"},
 		JobCreated:     time.Now(),
@@ -89,3 +91,74 @@ func TestReplaceVar(t *testing.T) {
 	assert.Equal(t, "<(REVISION", replaceVars(c, "<(REVISION"))
 	assert.Equal(t, "my-repo_my-task_abc123", replaceVars(c, "<(REPO)_<(TASK_NAME)_<(REVISION)"))
 }
+
+func TestTaskCandidateOutputs(t *testing.T) {
+	testutils.SmallTest(t)
+	c := makeTaskCandidate("Test", []string{"k:v"})
+	c.TaskSpec.Dependencies = []string{"Build"}
+	c.TaskSpec.Inputs = []*specs.Input{
+		{
+			Task:   "Build",
+			Output: "binary",
+			Env:    "SKIA_BINARY",
+		},
+	}
+	c.TaskSpec.Outputs = []*specs.Output{
+		{
+			Name: "results",
+			Path: "dm.json",
+		},
+	}
+	c.TaskSpec.Caches = []*specs.Cache{
+		{
+			Name: "work",
+			Path: "cache/work",
+		},
+	}
+
+	// The Task records the named outputs.
+	task := c.MakeTask()
+	assert.Equal(t, map[string]string{"results": "dm.json"}, task.Outputs)
+
+	// The inputs are found in the outputs of the parent task.
+	parent := &db.Task{
+		Id: "parent",
+		Outputs: map[string]string{
+			"binary": "out/Release/dm",
+		},
+	}
+	env, err := c.inputEnv(map[string]*db.Task{"Build": parent})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"SKIA_BINARY": "out/Release/dm"}, env)
+
+	// The parent task didn't produce the output.
+	parent.Outputs = nil
+	_, err = c.inputEnv(map[string]*db.Task{"Build": parent})
+	assert.EqualError(t, err, "Task parent does not produce output \"binary\"")
+
+	// The input environment and caches are passed to Swarming.
+	c.InputEnv = env
+	req, err := c.MakeTaskRequest("id", "isolate-server", "topic")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(req.Properties.Env))
+	assert.Equal(t, "SKIA_BINARY", req.Properties.Env[0].Key)
+	assert.Equal(t, "out/Release/dm", req.Properties.Env[0].Value)
+	assert.Equal(t, 1, len(req.Properties.Caches))
+	assert.Equal(t, "work", req.Properties.Caches[0].Name)
+	assert.Equal(t, "cache/work", req.Properties.Caches[0].Path)
+}
+
+func TestTryJobScore(t *testing.T) {
+	testutils.SmallTest(t)
+
+	now := time.Now()
+	c := &taskCandidate{
+		JobCreated: now,
+	}
+	assert.Equal(t, CANDIDATE_SCORE_TRY_JOB, c.tryJobScore(now))
+	c.JobCreated = now.Add(-30 * time.Minute)
+	assert.Equal(t, CANDIDATE_SCORE_TRY_JOB+TRY_JOB_BOOST_PER_HOUR/2, c.tryJobScore(now))
+	c.JobCreated = now.Add(-48 * time.Hour)
+	assert.Equal(t, CANDIDATE_SCORE_TRY_JOB+MAX_TRY_JOB_BOOST, c.tryJobScore(now))
+	assert.True(t, c.tryJobScore(now) < CANDIDATE_SCORE_FORCE_RUN)
+}
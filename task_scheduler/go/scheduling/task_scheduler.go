@@ -40,6 +40,13 @@ const (
 	// 5 commits behind.
 	CANDIDATE_SCORE_TRY_JOB = 10.0
 
+	// A developer is waiting on each try job, so try job candidates are
+	// boosted by this amount for each hour since the Job was created, up
+	// to MAX_TRY_JOB_BOOST. The cap keeps try jobs below manually-forced
+	// jobs.
+	TRY_JOB_BOOST_PER_HOUR = 10.0
+	MAX_TRY_JOB_BOOST      = 80.0
+
 	// MAX_BLAMELIST_COMMITS is the maximum number of commits which are
 	// allowed in a task blamelist before we stop tracing commit history.
 	MAX_BLAMELIST_COMMITS = 500
@@ -76,6 +83,8 @@ type TaskScheduler struct {
 	busyBots      *busyBots
 	db            db.DB
 	depotToolsDir string
+	flakiness     map[string]*db.RepoFlakiness // protected by flakinessMtx.
+	flakinessMtx  sync.RWMutex
 	isolate       *isolate.Client
 	jCache        db.JobCache
 	lastScheduled time.Time // protected by queueMtx.
@@ -85,10 +94,14 @@ type TaskScheduler struct {
 	newTasksMtx sync.RWMutex
 
 	pools            []string
+	preemption       bool
+	preemptions      []*Preemption // protected by queueMtx. In-memory only.
 	pubsubTopic      string
 	queue            []*taskCandidate // protected by queueMtx.
 	queueMtx         sync.RWMutex
+	quotas           *QuotaConfig
 	repos            repograph.Map
+	shareUsage       []*ShareUsage // protected by queueMtx.
 	swarming         swarming.ApiClient
 	taskCfgCache     *specs.TaskCfgCache
 	tCache           db.TaskCache
@@ -99,7 +112,13 @@ type TaskScheduler struct {
 	workdir          string
 }
 
-func NewTaskScheduler(d db.DB, period time.Duration, numCommits int, workdir, host string, repos repograph.Map, isolateClient *isolate.Client, swarmingClient swarming.ApiClient, c *http.Client, timeDecayAmt24Hr float64, buildbucketApiUrl, trybotBucket string, projectRepoMapping map[string]string, pools []string, pubsubTopic, depotTools string, gerrit gerrit.GerritInterface) (*TaskScheduler, error) {
+func NewTaskScheduler(d db.DB, period time.Duration, numCommits int, workdir, host string, repos repograph.Map, isolateClient *isolate.Client, swarmingClient swarming.ApiClient, c *http.Client, timeDecayAmt24Hr float64, buildbucketApiUrl, trybotBucket string, projectRepoMapping map[string]string, pools []string, pubsubTopic, depotTools string, gerrit gerrit.GerritInterface, quotas *QuotaConfig, preemption bool) (*TaskScheduler, error) {
+	if quotas != nil {
+		if err := quotas.Validate(); err != nil {
+			return nil, fmt.Errorf("Invalid quota config: %s", err)
+		}
+	}
+
 	bl, err := blacklist.FromFile(path.Join(workdir, "blacklist.json"))
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create blacklist from file: %s", err)
@@ -135,19 +154,36 @@ func NewTaskScheduler(d db.DB, period time.Duration, numCommits int, workdir, ho
 		return nil, fmt.Errorf("Failed to create PeriodicTriggerMetrics: %s", err)
 	}
 
+	repoNames := make([]string, 0, len(repos))
+	for repo := range repos {
+		repoNames = append(repoNames, repo)
+	}
+	flakinessList, err := d.GetFlakinessForRepos(repoNames)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load flakiness stats: %s", err)
+	}
+	flakiness := make(map[string]*db.RepoFlakiness, len(flakinessList))
+	for _, f := range flakinessList {
+		flakiness[f.Repo] = f
+	}
+
 	s := &TaskScheduler{
 		bl:               bl,
 		busyBots:         newBusyBots(),
 		db:               d,
 		depotToolsDir:    depotTools,
+		flakiness:        flakiness,
 		isolate:          isolateClient,
 		jCache:           jCache,
 		newTasks:         map[db.RepoState]util.StringSet{},
 		newTasksMtx:      sync.RWMutex{},
 		pools:            pools,
+		preemption:       preemption,
+		preemptions:      []*Preemption{},
 		pubsubTopic:      pubsubTopic,
 		queue:            []*taskCandidate{},
 		queueMtx:         sync.RWMutex{},
+		quotas:           quotas,
 		repos:            repos,
 		swarming:         swarmingClient,
 		taskCfgCache:     taskCfgCache,
@@ -182,12 +218,22 @@ func (s *TaskScheduler) Start(ctx context.Context, beforeMainLoop func()) {
 			lvUpdate.Reset()
 		}
 	})
+	lvFlakiness := metrics2.NewLiveness("last-successful-flakiness-update")
+	go util.RepeatCtx(5*time.Minute, ctx, func() {
+		if err := s.updateFlakiness(time.Now()); err != nil {
+			sklog.Errorf("Failed to update flakiness stats: %s", err)
+		} else {
+			lvFlakiness.Reset()
+		}
+	})
 }
 
 // TaskSchedulerStatus is a struct which provides status information about the
 // TaskScheduler.
 type TaskSchedulerStatus struct {
 	LastScheduled time.Time        `json:"last_scheduled"`
+	Preemptions   []*Preemption    `json:"preemptions"`
+	ShareUsage    []*ShareUsage    `json:"share_usage"`
 	TopCandidates []*taskCandidate `json:"top_candidates"`
 }
 
@@ -203,8 +249,20 @@ func (s *TaskScheduler) Status() *TaskSchedulerStatus {
 	for _, c := range s.queue[:n] {
 		candidates = append(candidates, c.Copy())
 	}
+	usage := make([]*ShareUsage, 0, len(s.shareUsage))
+	for _, u := range s.shareUsage {
+		cpy := *u
+		usage = append(usage, &cpy)
+	}
+	preemptions := make([]*Preemption, 0, len(s.preemptions))
+	for _, p := range s.preemptions {
+		cpy := *p
+		preemptions = append(preemptions, &cpy)
+	}
 	return &TaskSchedulerStatus{
 		LastScheduled: s.lastScheduled,
+		Preemptions:   preemptions,
+		ShareUsage:    usage,
 		TopCandidates: candidates,
 	}
 }
@@ -379,9 +437,16 @@ func (s *TaskScheduler) findTaskCandidatesForJobs(unfinishedJobs []*db.Job) (map
 				return nil, err
 			}
 			c := &taskCandidate{
-				JobCreated: j.Created,
-				TaskKey:    key,
-				TaskSpec:   spec,
+				JobCreated:  j.Created,
+				TaskKey:     key,
+				TaskSpec:    spec,
+				TriggerType: triggerTypeForJob(j),
+			}
+			// A periodic Job may share task candidates with the
+			// regular Job for the same commit. In that case, the
+			// candidate counts against the commit share.
+			if prev, ok := candidates[key]; ok && prev.TriggerType == TRIGGER_TYPE_COMMIT {
+				c.TriggerType = TRIGGER_TYPE_COMMIT
 			}
 			candidates[key] = c
 		}
@@ -429,42 +494,61 @@ func (s *TaskScheduler) filterTaskCandidates(preFilterCandidates map[db.TaskKey]
 			if previous.Success() {
 				continue
 			}
-			// The attempt counts are only valid if the previous
-			// attempt we're looking at is the last attempt for this
-			// TaskSpec. Fortunately, TaskCache.GetTasksByKey sorts
-			// by creation time, and we've selected the last of the
-			// results.
-			maxAttempts := c.TaskSpec.MaxAttempts
-			if maxAttempts == 0 {
-				maxAttempts = specs.DEFAULT_TASK_SPEC_MAX_ATTEMPTS
-			}
-			// Special case for tasks created before arbitrary
-			// numbers of attempts were possible.
-			previousAttempt := previous.Attempt
-			if previousAttempt == 0 && previous.RetryOf != "" {
-				previousAttempt = 1
-			}
-			if previousAttempt >= maxAttempts-1 {
-				continue
+			if previous.Preempted {
+				// Preempted tasks are re-queued without counting
+				// as an attempt.
+				c.Attempt = previous.Attempt
+				c.RetryOf = previous.Id
+			} else {
+				// The attempt counts are only valid if the previous
+				// attempt we're looking at is the last attempt for this
+				// TaskSpec. Fortunately, TaskCache.GetTasksByKey sorts
+				// by creation time, and we've selected the last of the
+				// results.
+				maxAttempts := c.TaskSpec.MaxAttempts
+				if maxAttempts == 0 {
+					maxAttempts = specs.DEFAULT_TASK_SPEC_MAX_ATTEMPTS
+				}
+				// Special case for tasks created before arbitrary
+				// numbers of attempts were possible. Re-runs of
+				// preempted tasks keep the same attempt number.
+				previousAttempt := previous.Attempt
+				if previousAttempt == 0 && previous.RetryOf != "" && !isRerunOfPreempted(previous, prevTasks) {
+					previousAttempt = 1
+				}
+				if previousAttempt >= maxAttempts-1 {
+					continue
+				}
+				c.Attempt = previousAttempt + 1
+				c.RetryOf = previous.Id
+				if c.TaskSpec.Flakes != nil && c.TaskSpec.Flakes.RetryOnDifferentBot {
+					c.AvoidBotId = previous.SwarmingBotId
+				}
 			}
-			c.Attempt = previousAttempt + 1
-			c.RetryOf = previous.Id
 		}
 
 		// Don't consider candidates whose dependencies are not met.
-		depsMet, idsToHashes, err := c.allDepsMet(s.tCache)
+		depsMet, parents, err := c.allDepsMet(s.tCache)
 		if err != nil {
 			return nil, err
 		}
 		if !depsMet {
 			continue
 		}
-		hashes := make([]string, 0, len(idsToHashes))
-		parentTaskIds := make([]string, 0, len(idsToHashes))
-		for id, hash := range idsToHashes {
-			hashes = append(hashes, hash)
-			parentTaskIds = append(parentTaskIds, id)
+		hashes := make([]string, 0, len(parents))
+		parentTaskIds := make([]string, 0, len(parents))
+		for _, parent := range parents {
+			hashes = append(hashes, parent.IsolatedOutput)
+			parentTaskIds = append(parentTaskIds, parent.Id)
+		}
+		inputEnv, err := c.inputEnv(parents)
+		if err != nil {
+			// The parent task did not produce the outputs we need,
+			// probably because it ran with a different config.
+			sklog.Warningf("Skipping task candidate %s @ %s: %s", c.Name, c.Revision, err)
+			continue
 		}
+		c.InputEnv = inputEnv
 		c.IsolatedHashes = hashes
 		sort.Strings(parentTaskIds)
 		c.ParentTaskIds = parentTaskIds
@@ -485,7 +569,7 @@ func (s *TaskScheduler) filterTaskCandidates(preFilterCandidates map[db.TaskKey]
 // candidate, eg. blamelists and scoring.
 func (s *TaskScheduler) processTaskCandidate(c *taskCandidate, now time.Time, cache *cacheWrapper, commitsBuf []*repograph.Commit) error {
 	if c.IsTryJob() {
-		c.Score = CANDIDATE_SCORE_TRY_JOB + now.Sub(c.JobCreated).Hours()
+		c.Score = c.tryJobScore(now)
 		return nil
 	}
 
@@ -733,6 +817,20 @@ func (s *TaskScheduler) regenerateTaskQueue(now time.Time) ([]*taskCandidate, er
 		return nil, err
 	}
 
+	// Divide the bot capacity according to the quota config, if any.
+	if s.quotas != nil {
+		running, err := s.runningTasksByShare(unfinishedJobs)
+		if err != nil {
+			return nil, err
+		}
+		var usage []*ShareUsage
+		queue, usage = applyQuotas(s.quotas, queue, running)
+		recordShareUsageMetrics(usage)
+		s.queueMtx.Lock()
+		s.shareUsage = usage
+		s.queueMtx.Unlock()
+	}
+
 	return queue, nil
 }
 
@@ -776,6 +874,9 @@ func getCandidatesToSchedule(bots []*swarming_api.SwarmingRpcsBotInfo, tasks []*
 				matches = matches.Intersect(botsByDim[d])
 			}
 		}
+		if c.AvoidBotId != "" {
+			delete(matches, c.AvoidBotId)
+		}
 		if len(matches) > 0 {
 			// We're going to run this task. Choose a bot. Sort the
 			// bots by ID so that the choice is deterministic.
@@ -794,6 +895,14 @@ func getCandidatesToSchedule(bots []*swarming_api.SwarmingRpcsBotInfo, tasks []*
 				}
 			}
 
+			// If the task must avoid a particular bot, pin it to
+			// the bot we chose so that Swarming doesn't pick the
+			// bot we're avoiding.
+			if c.AvoidBotId != "" {
+				c = c.Copy()
+				c.TaskSpec.Dimensions = append(c.TaskSpec.Dimensions, fmt.Sprintf("id:%s", bot))
+			}
+
 			// Add the task to the scheduling list.
 			rv = append(rv, c)
 
@@ -924,6 +1033,13 @@ func (s *TaskScheduler) scheduleTasks(bots []*swarming_api.SwarmingRpcsBotInfo,
 	// Match free bots with tasks.
 	schedule := getCandidatesToSchedule(bots, queue)
 
+	// Make room for high-priority candidates which didn't get a bot.
+	if s.preemption {
+		if _, err := s.preemptBackfillTasks(queue, schedule, time.Now()); err != nil {
+			sklog.Errorf("Failed to preempt tasks: %s", err)
+		}
+	}
+
 	// Setup the error channel.
 	errs := []error{}
 	errCh := make(chan error)
@@ -1096,7 +1212,7 @@ func (s *TaskScheduler) gatherNewJobs() error {
 	}
 
 	// Also trigger any available periodic jobs.
-	if err := s.triggerPeriodicJobs(); err != nil {
+	if err := s.triggerPeriodicJobs(time.Now()); err != nil {
 		return err
 	}
 
@@ -1440,6 +1556,7 @@ func (s *TaskScheduler) updateUnfinishedJobs() error {
 	}
 
 	modified := make([]*db.Job, 0, len(jobs))
+	flaky := map[string]*db.Task{}
 	errs := []error{}
 	for _, j := range jobs {
 		tasks, err := s.getTasksForJob(j)
@@ -1448,14 +1565,27 @@ func (s *TaskScheduler) updateUnfinishedJobs() error {
 		}
 		summaries := make(map[string][]*db.TaskSummary, len(tasks))
 		for k, v := range tasks {
+			for _, t := range findFlakyTasks(v) {
+				flaky[t.Id] = t
+			}
 			cpy := make([]*db.TaskSummary, 0, len(v))
 			for _, t := range v {
-				cpy = append(cpy, t.MakeTaskSummary())
+				summary := t.MakeTaskSummary()
+				if _, ok := flaky[t.Id]; ok {
+					summary.Flaky = true
+				}
+				cpy = append(cpy, summary)
 			}
 			summaries[k] = cpy
 		}
-		if !reflect.DeepEqual(summaries, j.Tasks) {
+		quarantined, err := s.quarantinedTaskSpecs(j)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !reflect.DeepEqual(summaries, j.Tasks) || !util.SSliceEqual(quarantined, j.Quarantined) {
 			j.Tasks = summaries
+			j.Quarantined = quarantined
 			j.Status = j.DeriveStatus()
 			if j.Done() {
 				if err := s.jobFinished(j); err != nil {
@@ -1466,6 +1596,9 @@ func (s *TaskScheduler) updateUnfinishedJobs() error {
 			modified = append(modified, j)
 		}
 	}
+	if err := s.markTasksFlaky(flaky); err != nil {
+		errs = append(errs, err)
+	}
 	if len(modified) > 0 {
 		if err := s.db.PutJobs(modified); err != nil {
 			errs = append(errs, err)
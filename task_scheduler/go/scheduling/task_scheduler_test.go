@@ -200,7 +200,7 @@ func setup(t *testing.T) (*git_testutils.GitBuilder, db.DB, *swarming.TestClient
 	assert.NoError(t, ioutil.WriteFile(gitcookies, []byte(".googlesource.com\tTRUE\t/\tTRUE\t123\to\tgit-user.google.com=abc123"), os.ModePerm))
 	g, err := gerrit.NewGerrit(fakeGerritUrl, gitcookies, urlMock.Client())
 	assert.NoError(t, err)
-	s, err := NewTaskScheduler(d, time.Duration(math.MaxInt64), 0, tmp, "fake.server", repos, isolateClient, swarmingClient, urlMock.Client(), 1.0, tryjobs.API_URL_TESTING, tryjobs.BUCKET_TESTING, projectRepoMapping, swarming.POOLS_PUBLIC, "", depotTools, g)
+	s, err := NewTaskScheduler(d, time.Duration(math.MaxInt64), 0, tmp, "fake.server", repos, isolateClient, swarmingClient, urlMock.Client(), 1.0, tryjobs.API_URL_TESTING, tryjobs.BUCKET_TESTING, projectRepoMapping, swarming.POOLS_PUBLIC, "", depotTools, g, nil, false)
 	assert.NoError(t, err)
 	return gb, d, swarmingClient, s, urlMock, func() {
 		testutils.RemoveAll(t, tmp)
@@ -602,7 +602,7 @@ func TestProcessTaskCandidate(t *testing.T) {
 		},
 	}
 	assert.NoError(t, s.processTaskCandidate(c, now, cache, commitsBuf))
-	assert.Equal(t, CANDIDATE_SCORE_TRY_JOB+1.0, c.Score)
+	assert.Equal(t, CANDIDATE_SCORE_TRY_JOB+TRY_JOB_BOOST_PER_HOUR, c.Score)
 	assert.Nil(t, c.Commits)
 
 	// Manually forced candidates have a blamelist and a specific score.
@@ -1496,6 +1496,20 @@ func TestGetCandidatesToSchedule(t *testing.T) {
 	t3 = makeTaskCandidate("task3", dims)
 	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1, b2}, []*taskCandidate{t1, t2, t3})
 	testutils.AssertDeepEqual(t, []*taskCandidate{t1, t2}, rv)
+
+	// A retry which must avoid a bot gets pinned to a different bot.
+	t1 = makeTaskCandidate("task1", dims)
+	t1.AvoidBotId = "bot1"
+	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1, b2}, []*taskCandidate{t1})
+	expect := t1.Copy()
+	expect.TaskSpec.Dimensions = append(expect.TaskSpec.Dimensions, "id:bot2")
+	testutils.AssertDeepEqual(t, []*taskCandidate{expect}, rv)
+	testutils.AssertDeepEqual(t, dims, t1.TaskSpec.Dimensions)
+
+	// If the only matching bot is the one to avoid, the task isn't
+	// scheduled.
+	rv = getCandidatesToSchedule([]*swarming_api.SwarmingRpcsBotInfo{b1}, []*taskCandidate{t1})
+	assert.Equal(t, 0, len(rv))
 }
 
 func makeBot(id string, dims map[string]string) *swarming_api.SwarmingRpcsBotInfo {
@@ -1915,7 +1929,7 @@ func testMultipleCandidatesBackfillingEachOtherSetup(t *testing.T) (*git_testuti
 	g, err := gerrit.NewGerrit(fakeGerritUrl, gitcookies, urlMock.Client())
 	assert.NoError(t, err)
 
-	s, err := NewTaskScheduler(d, time.Duration(math.MaxInt64), 0, workdir, "fake.server", repos, isolateClient, swarmingClient, mockhttpclient.NewURLMock().Client(), 1.0, tryjobs.API_URL_TESTING, tryjobs.BUCKET_TESTING, projectRepoMapping, swarming.POOLS_PUBLIC, "", depotTools, g)
+	s, err := NewTaskScheduler(d, time.Duration(math.MaxInt64), 0, workdir, "fake.server", repos, isolateClient, swarmingClient, mockhttpclient.NewURLMock().Client(), 1.0, tryjobs.API_URL_TESTING, tryjobs.BUCKET_TESTING, projectRepoMapping, swarming.POOLS_PUBLIC, "", depotTools, g, nil, false)
 	assert.NoError(t, err)
 
 	mockTasks := []*swarming_api.SwarmingRpcsTaskRequestMetadata{}
@@ -2616,6 +2630,129 @@ func TestPeriodicJobs(t *testing.T) {
 	assert.Equal(t, s.triggerMetrics.LastTriggered["nightly"].Unix(), metrics.LastTriggered["nightly"].Unix())
 }
 
+func TestCronJobs(t *testing.T) {
+	gb, _, _, s, _, cleanup := setup(t)
+	defer cleanup()
+
+	// Rewrite tasks.json with some cron-triggered jobs.
+	name := "Periodic-Task"
+	cfg := &specs.TasksCfg{
+		Jobs: map[string]*specs.JobSpec{
+			"Cron-All": {
+				CatchUp:   specs.CATCH_UP_ALL,
+				Priority:  1.0,
+				TaskSpecs: []string{name},
+				Trigger:   "0 */6 * * *",
+			},
+			"Cron-Changed": {
+				OnlyIfChanged: true,
+				Priority:      1.0,
+				TaskSpecs:     []string{name},
+				Trigger:       "@daily",
+			},
+			"Cron-None": {
+				CatchUp:   specs.CATCH_UP_NONE,
+				Priority:  1.0,
+				TaskSpecs: []string{name},
+				Trigger:   "@hourly",
+			},
+		},
+		Tasks: map[string]*specs.TaskSpec{
+			name: {
+				CipdPackages: []*specs.CipdPackage{},
+				Dependencies: []string{},
+				Dimensions: []string{
+					"pool:Skia",
+					"os:Mac",
+					"gpu:my-gpu",
+				},
+				Isolate:  "compile_skia.isolate",
+				Priority: 1.0,
+			},
+		},
+	}
+	gb.Add(specs.TASKS_CFG_FILE, testutils.MarshalJSON(t, &cfg))
+	gb.Commit()
+
+	countJobs := func() map[string]int {
+		assert.NoError(t, s.jCache.Update())
+		unfinished, err := s.jCache.UnfinishedJobs()
+		assert.NoError(t, err)
+		rv := map[string]int{}
+		for _, j := range unfinished {
+			if j.Trigger != "" {
+				rv[j.Name]++
+			}
+		}
+		return rv
+	}
+
+	// Cycle. The cron jobs are recorded but not triggered, since they
+	// haven't been seen before.
+	assert.NoError(t, s.MainLoop())
+	assert.Equal(t, 0, len(countJobs()))
+	assert.Equal(t, 3, len(s.triggerMetrics.CronJobs))
+	assert.Equal(t, 3, len(s.triggerMetrics.NextRun))
+	assert.Equal(t, 0, len(s.triggerMetrics.LastTriggered))
+
+	// Pretend that the jobs were last run a day ago.
+	base := time.Date(2017, 3, 1, 0, 30, 0, 0, time.UTC)
+	for _, r := range s.triggerMetrics.CronJobs {
+		r.LastRun = base
+	}
+	cfgs, err := s.getPeriodicTasksCfgs()
+	assert.NoError(t, err)
+	now := base.Add(24 * time.Hour)
+	assert.NoError(t, s.triggerCronJobs(cfgs, now))
+	testutils.AssertDeepEqual(t, map[string]int{
+		"Cron-All":     4,
+		"Cron-Changed": 1,
+	}, countJobs())
+	for _, r := range s.triggerMetrics.CronJobs {
+		assert.Equal(t, now, r.LastRun)
+	}
+	assert.Equal(t, 2, len(s.triggerMetrics.LastTriggered))
+	assert.Equal(t, time.Date(2017, 3, 2, 1, 0, 0, 0, time.UTC), s.triggerMetrics.NextRun["@hourly"])
+	assert.Equal(t, time.Date(2017, 3, 2, 6, 0, 0, 0, time.UTC), s.triggerMetrics.NextRun["0 */6 * * *"])
+	assert.Equal(t, time.Date(2017, 3, 3, 0, 0, 0, 0, time.UTC), s.triggerMetrics.NextRun["@daily"])
+
+	// Nothing is due.
+	assert.NoError(t, s.triggerCronJobs(cfgs, now.Add(10*time.Minute)))
+	assert.Equal(t, 2, len(countJobs()))
+
+	// The hourly job is due and within the grace period.
+	assert.NoError(t, s.triggerCronJobs(cfgs, now.Add(35*time.Minute)))
+	testutils.AssertDeepEqual(t, map[string]int{
+		"Cron-All":     4,
+		"Cron-Changed": 1,
+		"Cron-None":    1,
+	}, countJobs())
+
+	// A day later, the daily job is skipped because HEAD has not changed.
+	now = now.Add(24 * time.Hour)
+	assert.NoError(t, s.triggerCronJobs(cfgs, now))
+	testutils.AssertDeepEqual(t, map[string]int{
+		"Cron-All":     8,
+		"Cron-Changed": 1,
+		"Cron-None":    1,
+	}, countJobs())
+	for _, r := range s.triggerMetrics.CronJobs {
+		assert.Equal(t, now, r.LastRun)
+	}
+
+	// Verify that the records persist.
+	assert.NoError(t, s.triggerMetrics.Write())
+	metrics, err := newPeriodicTriggerMetrics(s.workdir)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(metrics.CronJobs))
+	for key, r := range s.triggerMetrics.CronJobs {
+		assert.True(t, r.LastRun.Equal(metrics.CronJobs[key].LastRun))
+		assert.Equal(t, r.Revision, metrics.CronJobs[key].Revision)
+	}
+	assert.Equal(t, 3, len(metrics.NextRun))
+	assert.Equal(t, 3, len(metrics.nextRun))
+}
+
 func TestUpdateUnfinishedTasks(t *testing.T) {
 	_, _, swarmingClient, s, _, cleanup := setup(t)
 	defer cleanup()
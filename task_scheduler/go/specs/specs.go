@@ -9,10 +9,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
 
+	"go.skia.org/infra/go/cron"
 	"go.skia.org/infra/go/exec"
 	"go.skia.org/infra/go/git"
 	"go.skia.org/infra/go/git/repograph"
@@ -26,8 +28,24 @@ const (
 	DEFAULT_TASK_SPEC_MAX_ATTEMPTS = db.DEFAULT_MAX_TASK_ATTEMPTS
 	DEFAULT_NUM_WORKERS            = 10
 
+	// DEFAULT_QUARANTINE_THRESHOLD is the flakiness rate at which a
+	// TaskSpec whose FlakePolicy enables quarantine is quarantined.
+	DEFAULT_QUARANTINE_THRESHOLD = 0.1
+
 	TASKS_CFG_FILE = "infra/bots/tasks.json"
 
+	// Catch-up policies for cron-triggered JobSpecs, which determine what
+	// happens when the Task Scheduler was not running at one or more of the
+	// scheduled times. CATCH_UP_NONE skips missed runs entirely,
+	// CATCH_UP_ONCE triggers a single Job for any number of missed runs, and
+	// CATCH_UP_ALL triggers one Job for each missed run, up to
+	// scheduling.MAX_CRON_CATCH_UP_JOBS.
+	CATCH_UP_NONE = "none"
+	CATCH_UP_ONCE = "once"
+	CATCH_UP_ALL  = "all"
+
+	DEFAULT_CATCH_UP = CATCH_UP_ONCE
+
 	VARIABLE_SYNTAX = "<(%s)"
 
 	VARIABLE_CODEREVIEW_SERVER = "CODEREVIEW_SERVER"
@@ -42,6 +60,10 @@ const (
 )
 
 var (
+	// CACHE_NAME_REGEX describes valid names for named caches. This
+	// matches the restrictions imposed by Swarming.
+	CACHE_NAME_REGEX = regexp.MustCompile("^[a-z0-9_]{1,4096}$")
+
 	PLACEHOLDER_CODEREVIEW_SERVER = fmt.Sprintf(VARIABLE_SYNTAX, VARIABLE_CODEREVIEW_SERVER)
 	PLACEHOLDER_ISSUE             = fmt.Sprintf(VARIABLE_SYNTAX, VARIABLE_ISSUE)
 	PLACEHOLDER_ISSUE_SHORT       = fmt.Sprintf(VARIABLE_SYNTAX, VARIABLE_ISSUE_SHORT)
@@ -124,6 +146,22 @@ func (c *TasksCfg) Validate() error {
 		}
 	}
 
+	for name, j := range c.Jobs {
+		if err := j.Validate(); err != nil {
+			return fmt.Errorf("Invalid JobSpec %q: %s", name, err)
+		}
+	}
+
+	// Quarantined tasks may fail without failing their Jobs, so no other
+	// task may depend on them.
+	for name, t := range c.Tasks {
+		for _, d := range t.Dependencies {
+			if dep, ok := c.Tasks[d]; ok && dep.Flakes != nil && dep.Flakes.Quarantine {
+				return fmt.Errorf("Task %q depends on %q, which may be quarantined.", name, d)
+			}
+		}
+	}
+
 	if err := findCycles(c.Tasks, c.Jobs); err != nil {
 		return err
 	}
@@ -134,6 +172,10 @@ func (c *TasksCfg) Validate() error {
 // TaskSpec is a struct which describes a Swarming task to run.
 // Be sure to add any new fields to the Copy() method.
 type TaskSpec struct {
+	// Caches are named caches which should be mounted for the task. Named
+	// caches persist on the bot between tasks.
+	Caches []*Cache `json:"caches,omitempty"`
+
 	// CipdPackages are CIPD packages which should be installed for the task.
 	CipdPackages []*CipdPackage `json:"cipd_packages,omitempty"`
 
@@ -159,6 +201,15 @@ type TaskSpec struct {
 	// ExtraArgs are extra command-line arguments to pass to the task.
 	ExtraArgs []string `json:"extra_args,omitempty"`
 
+	// Flakes describes how the Task Scheduler handles flaky runs of the
+	// task. If nil, flaky tasks are recorded but otherwise treated like
+	// any other failure.
+	Flakes *FlakePolicy `json:"flakes,omitempty"`
+
+	// Inputs are named outputs of dependencies which are consumed by the
+	// task.
+	Inputs []*Input `json:"inputs,omitempty"`
+
 	// IoTimeout is the maximum amount of time which the task may take to
 	// communicate with the server.
 	IoTimeout time.Duration `json:"io_timeout_ns,omitempty"`
@@ -170,6 +221,9 @@ type TaskSpec struct {
 	// zero, DEFAULT_TASK_SPEC_MAX_ATTEMPTS is used.
 	MaxAttempts int `json:"max_attempts,omitempty"`
 
+	// Outputs are named artifacts produced by the task.
+	Outputs []*Output `json:"outputs,omitempty"`
+
 	// Priority indicates the relative priority of the task, with 0 < p <= 1
 	Priority float64 `json:"priority"`
 }
@@ -183,6 +237,59 @@ func (t *TaskSpec) Validate(cfg *TasksCfg) error {
 		}
 	}
 
+	// Ensure that caches are specified properly.
+	cacheNames := util.StringSet{}
+	cachePaths := util.StringSet{}
+	for _, c := range t.Caches {
+		if !CACHE_NAME_REGEX.MatchString(c.Name) {
+			return fmt.Errorf("Invalid cache name %q; must match %s", c.Name, CACHE_NAME_REGEX)
+		}
+		if err := validateRelativePath(c.Path); err != nil {
+			return fmt.Errorf("Invalid path for cache %q: %s", c.Name, err)
+		}
+		if cacheNames[c.Name] {
+			return fmt.Errorf("Cache %q is specified more than once.", c.Name)
+		}
+		if cachePaths[c.Path] {
+			return fmt.Errorf("Multiple caches use path %q.", c.Path)
+		}
+		cacheNames[c.Name] = true
+		cachePaths[c.Path] = true
+	}
+
+	// Ensure that outputs are specified properly.
+	outputNames := util.StringSet{}
+	for _, o := range t.Outputs {
+		if o.Name == "" {
+			return fmt.Errorf("Outputs must have a name.")
+		}
+		if err := validateRelativePath(o.Path); err != nil {
+			return fmt.Errorf("Invalid path for output %q: %s", o.Name, err)
+		}
+		if outputNames[o.Name] {
+			return fmt.Errorf("Output %q is specified more than once.", o.Name)
+		}
+		outputNames[o.Name] = true
+	}
+
+	// Ensure that inputs refer to outputs of dependencies.
+	inputEnv := util.StringSet{}
+	for _, in := range t.Inputs {
+		if !util.In(in.Task, t.Dependencies) {
+			return fmt.Errorf("Input %q refers to task %q, which is not a dependency.", in.Output, in.Task)
+		}
+		if dep, ok := cfg.Tasks[in.Task]; ok && dep.GetOutput(in.Output) == nil {
+			return fmt.Errorf("Input refers to output %q, which is not produced by task %q.", in.Output, in.Task)
+		}
+		if in.Env == "" {
+			return fmt.Errorf("Input %q from task %q must specify an environment variable.", in.Output, in.Task)
+		}
+		if _, ok := t.Environment[in.Env]; ok || inputEnv[in.Env] {
+			return fmt.Errorf("Environment variable %q is specified more than once.", in.Env)
+		}
+		inputEnv[in.Env] = true
+	}
+
 	// Ensure that the dimensions are specified properly.
 	for _, d := range t.Dimensions {
 		split := strings.SplitN(d, ":", 2)
@@ -196,6 +303,12 @@ func (t *TaskSpec) Validate(cfg *TasksCfg) error {
 		return fmt.Errorf("Isolate file is required.")
 	}
 
+	if t.Flakes != nil {
+		if err := t.Flakes.Validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -214,7 +327,36 @@ func (t *TaskSpec) Copy() *TaskSpec {
 	dims := util.CopyStringSlice(t.Dimensions)
 	environment := util.CopyStringMap(t.Environment)
 	extraArgs := util.CopyStringSlice(t.ExtraArgs)
+	var flakes *FlakePolicy
+	if t.Flakes != nil {
+		flakes = t.Flakes.Copy()
+	}
+	var caches []*Cache
+	if len(t.Caches) > 0 {
+		caches = make([]*Cache, 0, len(t.Caches))
+		for _, c := range t.Caches {
+			cpy := *c
+			caches = append(caches, &cpy)
+		}
+	}
+	var inputs []*Input
+	if len(t.Inputs) > 0 {
+		inputs = make([]*Input, 0, len(t.Inputs))
+		for _, in := range t.Inputs {
+			cpy := *in
+			inputs = append(inputs, &cpy)
+		}
+	}
+	var outputs []*Output
+	if len(t.Outputs) > 0 {
+		outputs = make([]*Output, 0, len(t.Outputs))
+		for _, o := range t.Outputs {
+			cpy := *o
+			outputs = append(outputs, &cpy)
+		}
+	}
 	return &TaskSpec{
+		Caches:           caches,
 		CipdPackages:     cipdPackages,
 		Dependencies:     deps,
 		Dimensions:       dims,
@@ -222,13 +364,131 @@ func (t *TaskSpec) Copy() *TaskSpec {
 		ExecutionTimeout: t.ExecutionTimeout,
 		Expiration:       t.Expiration,
 		ExtraArgs:        extraArgs,
+		Flakes:           flakes,
+		Inputs:           inputs,
 		IoTimeout:        t.IoTimeout,
 		Isolate:          t.Isolate,
 		MaxAttempts:      t.MaxAttempts,
+		Outputs:          outputs,
 		Priority:         t.Priority,
 	}
 }
 
+// GetOutput returns the Output with the given name, or nil if the TaskSpec
+// does not produce such an Output.
+func (t *TaskSpec) GetOutput(name string) *Output {
+	for _, o := range t.Outputs {
+		if o.Name == name {
+			return o
+		}
+	}
+	return nil
+}
+
+// validateRelativePath returns an error if the given path is not a clean,
+// non-empty relative path which stays within its parent directory.
+func validateRelativePath(p string) error {
+	if p == "" {
+		return fmt.Errorf("Path is required.")
+	}
+	if path.IsAbs(p) {
+		return fmt.Errorf("Path %q must be relative.", p)
+	}
+	if path.Clean(p) != p {
+		return fmt.Errorf("Path %q is not clean; expected %q", p, path.Clean(p))
+	}
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return fmt.Errorf("Path %q may not refer to a parent directory.", p)
+	}
+	return nil
+}
+
+// Cache is a struct representing a named cache which persists on a bot
+// between tasks, eg. a git checkout or build directory.
+type Cache struct {
+	// Name identifies the cache on the bot. Tasks which use the same name
+	// share the same cache.
+	Name string `json:"name"`
+
+	// Path is where the cache is mounted, relative to the task's working
+	// directory.
+	Path string `json:"path"`
+}
+
+// Output is a struct representing a named artifact which is produced by a
+// task.
+type Output struct {
+	// Name identifies the artifact among the outputs of the task.
+	Name string `json:"name"`
+
+	// Path is the location of the artifact, relative to
+	// PLACEHOLDER_ISOLATED_OUTDIR. Since the isolated outputs of
+	// dependencies are merged into the inputs of a task, this is also the
+	// location of the artifact relative to the dependent task's working
+	// directory.
+	Path string `json:"path"`
+}
+
+// Input is a struct representing a named Output of a dependency which is
+// consumed by a task.
+type Input struct {
+	// Task is the name of the TaskSpec which produces the Output. It must
+	// be one of the task's Dependencies.
+	Task string `json:"task"`
+
+	// Output is the name of the Output.
+	Output string `json:"output"`
+
+	// Env is the name of an environment variable which is set to the
+	// location of the artifact, relative to the task's working directory.
+	Env string `json:"env"`
+}
+
+// FlakePolicy describes how the Task Scheduler handles tasks which fail but
+// succeed when retried at the same commit.
+type FlakePolicy struct {
+	// Comment indicates that a TaskComment should be added to each flaky
+	// task.
+	Comment bool `json:"comment,omitempty"`
+
+	// Quarantine indicates that failures of this TaskSpec should not cause
+	// Jobs to fail once its flakiness rate reaches QuarantineThreshold. A
+	// quarantined TaskSpec may not be a dependency of any other TaskSpec.
+	Quarantine bool `json:"quarantine,omitempty"`
+
+	// QuarantineThreshold is the flakiness rate, with 0 < r <= 1, at which
+	// the TaskSpec is quarantined. If zero, DEFAULT_QUARANTINE_THRESHOLD
+	// is used.
+	QuarantineThreshold float64 `json:"quarantine_threshold,omitempty"`
+
+	// RetryOnDifferentBot indicates that retries of a failed task should
+	// not run on the same bot as the failed attempt.
+	RetryOnDifferentBot bool `json:"retry_on_different_bot,omitempty"`
+}
+
+// Validate returns an error if the FlakePolicy is not valid.
+func (p *FlakePolicy) Validate() error {
+	if p.QuarantineThreshold < 0.0 || p.QuarantineThreshold > 1.0 {
+		return fmt.Errorf("Quarantine threshold must be between 0 and 1; got %f", p.QuarantineThreshold)
+	}
+	return nil
+}
+
+// Copy returns a copy of the FlakePolicy.
+func (p *FlakePolicy) Copy() *FlakePolicy {
+	rv := *p
+	return &rv
+}
+
+// GetQuarantineThreshold returns the flakiness rate at which the TaskSpec is
+// quarantined.
+func (p *FlakePolicy) GetQuarantineThreshold() float64 {
+	if p.QuarantineThreshold == 0.0 {
+		return DEFAULT_QUARANTINE_THRESHOLD
+	}
+	return p.QuarantineThreshold
+}
+
 // CipdPackage is a struct representing a CIPD package which needs to be
 // installed on a bot for a particular task.
 type CipdPackage struct {
@@ -237,12 +497,65 @@ type CipdPackage struct {
 	Version string `json:"version"`
 }
 
+// IsCronTrigger returns true iff the given JobSpec trigger is a cron
+// expression, eg. "@nightly" or "0 */6 * * *", which the Task Scheduler
+// evaluates itself, as opposed to the name of a trigger file.
+func IsCronTrigger(trigger string) bool {
+	return strings.HasPrefix(trigger, "@") || len(strings.Fields(trigger)) == 5
+}
+
 // JobSpec is a struct which describes a set of TaskSpecs to run as part of a
 // larger effort.
+// Be sure to add any new fields to the Copy() method.
 type JobSpec struct {
+	// CatchUp is the catch-up policy for a cron-triggered JobSpec; one of
+	// the CATCH_UP_* constants. Defaults to DEFAULT_CATCH_UP.
+	CatchUp string `json:"catch_up,omitempty"`
+
+	// OnlyIfChanged indicates that a cron-triggered JobSpec should be
+	// skipped if HEAD has not changed since the last time it was triggered.
+	OnlyIfChanged bool `json:"only_if_changed,omitempty"`
+
 	Priority  float64  `json:"priority"`
 	TaskSpecs []string `json:"tasks"`
-	Trigger   string   `json:"trigger,omitempty"`
+
+	// Trigger indicates when Jobs are created for the JobSpec. If empty,
+	// Jobs are created for every commit. If it is a cron expression (see
+	// IsCronTrigger), Jobs are created at HEAD of the master branch
+	// according to the schedule. Otherwise, Jobs are created at HEAD of
+	// the master branch whenever a trigger file with this name appears.
+	Trigger string `json:"trigger,omitempty"`
+}
+
+// Validate returns an error if the JobSpec is not valid.
+func (j *JobSpec) Validate() error {
+	if IsCronTrigger(j.Trigger) {
+		if _, err := cron.Parse(j.Trigger); err != nil {
+			return err
+		}
+		switch j.CatchUp {
+		case "", CATCH_UP_NONE, CATCH_UP_ONCE, CATCH_UP_ALL:
+		default:
+			return fmt.Errorf("Invalid catch_up policy %q", j.CatchUp)
+		}
+	} else {
+		if j.CatchUp != "" {
+			return fmt.Errorf("catch_up is only valid for cron triggers.")
+		}
+		if j.OnlyIfChanged {
+			return fmt.Errorf("only_if_changed is only valid for cron triggers.")
+		}
+	}
+	return nil
+}
+
+// GetCatchUp returns the catch-up policy for the JobSpec, or the default if
+// none is specified.
+func (j *JobSpec) GetCatchUp() string {
+	if j.CatchUp == "" {
+		return DEFAULT_CATCH_UP
+	}
+	return j.CatchUp
 }
 
 // Copy returns a copy of the JobSpec.
@@ -253,9 +566,11 @@ func (j *JobSpec) Copy() *JobSpec {
 		copy(taskSpecs, j.TaskSpecs)
 	}
 	return &JobSpec{
-		Priority:  j.Priority,
-		TaskSpecs: taskSpecs,
-		Trigger:   j.Trigger,
+		CatchUp:       j.CatchUp,
+		OnlyIfChanged: j.OnlyIfChanged,
+		Priority:      j.Priority,
+		TaskSpecs:     taskSpecs,
+		Trigger:       j.Trigger,
 	}
 }
 
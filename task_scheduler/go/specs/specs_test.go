@@ -29,6 +29,12 @@ var (
 func TestCopyTaskSpec(t *testing.T) {
 	testutils.SmallTest(t)
 	v := &TaskSpec{
+		Caches: []*Cache{
+			{
+				Name: "git",
+				Path: "cache/git",
+			},
+		},
 		CipdPackages: []*CipdPackage{
 			{
 				Name:    "pkg",
@@ -44,10 +50,29 @@ func TestCopyTaskSpec(t *testing.T) {
 		ExecutionTimeout: 60 * time.Minute,
 		Expiration:       90 * time.Minute,
 		ExtraArgs:        []string{"--do-really-awesome-stuff"},
-		IoTimeout:        10 * time.Minute,
-		Isolate:          "abc123",
-		MaxAttempts:      5,
-		Priority:         19.0,
+		Flakes: &FlakePolicy{
+			Comment:             true,
+			Quarantine:          true,
+			QuarantineThreshold: 0.2,
+			RetryOnDifferentBot: true,
+		},
+		Inputs: []*Input{
+			{
+				Task:   "coffee",
+				Output: "beans",
+				Env:    "BEANS",
+			},
+		},
+		IoTimeout:   10 * time.Minute,
+		Isolate:     "abc123",
+		MaxAttempts: 5,
+		Outputs: []*Output{
+			{
+				Name: "mocha",
+				Path: "out/mocha",
+			},
+		},
+		Priority: 19.0,
 	}
 	testutils.AssertCopy(t, v, v.Copy())
 }
@@ -55,9 +80,11 @@ func TestCopyTaskSpec(t *testing.T) {
 func TestCopyJobSpec(t *testing.T) {
 	testutils.SmallTest(t)
 	v := &JobSpec{
-		TaskSpecs: []string{"Build", "Test"},
-		Trigger:   "trigger-name",
-		Priority:  753,
+		CatchUp:       CATCH_UP_ALL,
+		OnlyIfChanged: true,
+		TaskSpecs:     []string{"Build", "Test"},
+		Trigger:       "@nightly",
+		Priority:      753,
 	}
 	testutils.AssertCopy(t, v, v.Copy())
 }
@@ -311,6 +338,191 @@ func makeTasksCfg(t *testing.T, tasks, jobs map[string][]string) string {
 	return testutils.MarshalIndentJSON(t, &cfg)
 }
 
+func TestFlakePolicy(t *testing.T) {
+	testutils.SmallTest(t)
+
+	p := &FlakePolicy{}
+	assert.NoError(t, p.Validate())
+	assert.Equal(t, DEFAULT_QUARANTINE_THRESHOLD, p.GetQuarantineThreshold())
+	p.QuarantineThreshold = 0.5
+	assert.NoError(t, p.Validate())
+	assert.Equal(t, 0.5, p.GetQuarantineThreshold())
+	p.QuarantineThreshold = 1.5
+	assert.EqualError(t, p.Validate(), "Quarantine threshold must be between 0 and 1; got 1.500000")
+
+	// Quarantined tasks may not be dependencies of other tasks.
+	cfg := &TasksCfg{
+		Tasks: map[string]*TaskSpec{
+			"a": {
+				Isolate: "abc123",
+				Flakes: &FlakePolicy{
+					Quarantine: true,
+				},
+			},
+			"b": {
+				Isolate: "abc123",
+			},
+		},
+		Jobs: map[string]*JobSpec{
+			"j": {
+				TaskSpecs: []string{"a", "b"},
+			},
+		},
+	}
+	_, err := ParseTasksCfg(testutils.MarshalIndentJSON(t, cfg))
+	assert.NoError(t, err)
+	cfg.Tasks["b"].Dependencies = []string{"a"}
+	_, err = ParseTasksCfg(testutils.MarshalIndentJSON(t, cfg))
+	assert.EqualError(t, err, "Task \"b\" depends on \"a\", which may be quarantined.")
+
+	// Other flake policies are fine.
+	cfg.Tasks["a"].Flakes.Quarantine = false
+	cfg.Tasks["a"].Flakes.RetryOnDifferentBot = true
+	_, err = ParseTasksCfg(testutils.MarshalIndentJSON(t, cfg))
+	assert.NoError(t, err)
+}
+
+func TestJobSpecCronTrigger(t *testing.T) {
+	testutils.SmallTest(t)
+
+	assert.True(t, IsCronTrigger("@nightly"))
+	assert.True(t, IsCronTrigger("0 */6 * * *"))
+	assert.False(t, IsCronTrigger(""))
+	assert.False(t, IsCronTrigger("nightly"))
+
+	j := &JobSpec{Trigger: "nightly"}
+	assert.NoError(t, j.Validate())
+	j.OnlyIfChanged = true
+	assert.EqualError(t, j.Validate(), "only_if_changed is only valid for cron triggers.")
+	j.OnlyIfChanged = false
+	j.CatchUp = CATCH_UP_ALL
+	assert.EqualError(t, j.Validate(), "catch_up is only valid for cron triggers.")
+
+	j.Trigger = "0 */6 * * *"
+	j.OnlyIfChanged = true
+	assert.NoError(t, j.Validate())
+	assert.Equal(t, CATCH_UP_ALL, j.GetCatchUp())
+	j.CatchUp = ""
+	assert.Equal(t, DEFAULT_CATCH_UP, j.GetCatchUp())
+	j.CatchUp = "sometimes"
+	assert.EqualError(t, j.Validate(), "Invalid catch_up policy \"sometimes\"")
+	j.CatchUp = CATCH_UP_NONE
+	j.Trigger = "@fortnightly"
+	assert.Error(t, j.Validate())
+	j.Trigger = "0 25 * * *"
+	assert.Error(t, j.Validate())
+
+	// Invalid JobSpecs cause the TasksCfg to fail validation.
+	cfg := &TasksCfg{
+		Tasks: map[string]*TaskSpec{
+			"a": {
+				Isolate: "abc123",
+			},
+		},
+		Jobs: map[string]*JobSpec{
+			"j": j,
+		},
+	}
+	_, err := ParseTasksCfg(testutils.MarshalIndentJSON(t, cfg))
+	assert.Error(t, err)
+	j.Trigger = "@weekly"
+	_, err = ParseTasksCfg(testutils.MarshalIndentJSON(t, cfg))
+	assert.NoError(t, err)
+}
+
+func TestTaskSpecOutputsAndCaches(t *testing.T) {
+	testutils.SmallTest(t)
+
+	cfg := &TasksCfg{
+		Tasks: map[string]*TaskSpec{
+			"Build": {
+				Caches: []*Cache{
+					{
+						Name: "git",
+						Path: "cache/git",
+					},
+					{
+						Name: "work",
+						Path: "cache/work",
+					},
+				},
+				Isolate: "abc123",
+				Outputs: []*Output{
+					{
+						Name: "binary",
+						Path: "out/Release/dm",
+					},
+				},
+			},
+			"Test": {
+				Dependencies: []string{"Build"},
+				Inputs: []*Input{
+					{
+						Task:   "Build",
+						Output: "binary",
+						Env:    "SKIA_BINARY",
+					},
+				},
+				Isolate: "abc123",
+			},
+		},
+		Jobs: map[string]*JobSpec{
+			"j": {
+				TaskSpecs: []string{"Test"},
+			},
+		},
+	}
+	test := func(expectErr string) {
+		_, err := ParseTasksCfg(testutils.MarshalIndentJSON(t, cfg))
+		if expectErr == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, expectErr)
+		}
+	}
+	test("")
+
+	build := cfg.Tasks["Build"]
+	testTask := cfg.Tasks["Test"]
+
+	// Caches.
+	build.Caches[1].Name = "Bad Name"
+	test(fmt.Sprintf("Invalid cache name \"Bad Name\"; must match %s", CACHE_NAME_REGEX))
+	build.Caches[1].Name = "git"
+	test("Cache \"git\" is specified more than once.")
+	build.Caches[1].Name = "work"
+	build.Caches[1].Path = "cache/git"
+	test("Multiple caches use path \"cache/git\".")
+	build.Caches[1].Path = "/cache/work"
+	test("Invalid path for cache \"work\": Path \"/cache/work\" must be relative.")
+	build.Caches[1].Path = "../work"
+	test("Invalid path for cache \"work\": Path \"../work\" may not refer to a parent directory.")
+	build.Caches[1].Path = "cache/work"
+
+	// Outputs.
+	build.Outputs[0].Path = "out/../out/Release/dm"
+	test("Invalid path for output \"binary\": Path \"out/../out/Release/dm\" is not clean; expected \"out/Release/dm\"")
+	build.Outputs[0].Path = ""
+	test("Invalid path for output \"binary\": Path is required.")
+	build.Outputs[0].Path = "out/Release/dm"
+	build.Outputs = append(build.Outputs, &Output{Name: "binary", Path: "out/Debug/dm"})
+	test("Output \"binary\" is specified more than once.")
+	build.Outputs = build.Outputs[:1]
+
+	// Inputs.
+	testTask.Inputs[0].Output = "bogus"
+	test("Input refers to output \"bogus\", which is not produced by task \"Build\".")
+	testTask.Inputs[0].Output = "binary"
+	testTask.Inputs[0].Env = ""
+	test("Input \"binary\" from task \"Build\" must specify an environment variable.")
+	testTask.Inputs[0].Env = "SKIA_BINARY"
+	testTask.Environment = map[string]string{"SKIA_BINARY": "dm"}
+	test("Environment variable \"SKIA_BINARY\" is specified more than once.")
+	testTask.Environment = nil
+	testTask.Dependencies = nil
+	test("Input \"binary\" refers to task \"Build\", which is not a dependency.")
+}
+
 func TestTasksCircularDependency(t *testing.T) {
 	testutils.SmallTest(t)
 	// Bonus: Unknown dependency.
@@ -74,6 +74,7 @@ var (
 	local          = flag.Bool("local", false, "Whether we're running on a dev machine vs in production.")
 	repoUrls       = common.NewMultiStringFlag("repo", nil, "Repositories for which to schedule tasks.")
 	resourcesDir   = flag.String("resources_dir", "", "The directory to find templates, JS, and CSS files. If blank, assumes you're running inside a checkout and will attempt to find the resources relative to this source file.")
+	rolesConfig    = flag.String("roles_config", "", "JSON file which assigns roles to users and groups, see go/login/roles.go. If blank, only logged in Googlers may edit the blacklist.")
 	scoreDecay24Hr = flag.Float64("scoreDecay24Hr", 0.9, "Task candidate scores are penalized using linear time decay. This is the desired value after 24 hours. Setting it to 1.0 causes commits not to be prioritized according to commit time.")
 	swarmingPools  = common.NewMultiStringFlag("pool", swarming.POOLS_PUBLIC, "Which Swarming pools to use.")
 	swarmingServer = flag.String("swarming_server", swarming.SWARMING_SERVER, "Which Swarming server to use.")
@@ -83,6 +84,9 @@ var (
 	gsBucket       = flag.String("gsBucket", "skia-task-scheduler", "Name of Google Cloud Storage bucket to use for backups and recovery.")
 	workdir        = flag.String("workdir", "workdir", "Working directory to use.")
 	promPort       = flag.String("prom_port", ":20000", "Metrics service address (e.g., ':10110')")
+	quotaConfig    = flag.String("quota_config", "", "JSON file describing fair-share quotas of bot capacity for repos and trigger types. If not provided, no quotas are applied.")
+
+	preemptBackfill = flag.Bool("preempt_backfill", false, "If set, cancel running backfill tasks to make room for try jobs and forced tasks which can't otherwise get a bot.")
 
 	pubsubTopicName      = flag.String("pubsub_topic", swarming.PUBSUB_TOPIC_SWARMING_TASKS, "Pub/Sub topic to use for Swarming tasks.")
 	pubsubSubscriberName = flag.String("pubsub_subscriber", PUBSUB_SUBSCRIBER_TASK_SCHEDULER, "Pub/Sub subscriber name.")
@@ -189,12 +193,6 @@ func triggerHandler(w http.ResponseWriter, r *http.Request) {
 
 func jsonBlacklistHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	if !login.IsGoogler(r) {
-		errStr := "Cannot modify the blacklist; user is not a logged-in Googler."
-		httputils.ReportError(w, r, fmt.Errorf(errStr), errStr)
-		return
-	}
-
 	if r.Method == http.MethodDelete {
 		var msg struct {
 			Name string `json:"name"`
@@ -431,7 +429,7 @@ func runServer(serverURL string) {
 	r.HandleFunc("/blacklist", blacklistHandler)
 	r.HandleFunc("/job/{id}", jobHandler)
 	r.HandleFunc("/trigger", triggerHandler)
-	r.HandleFunc("/json/blacklist", jsonBlacklistHandler).Methods(http.MethodPost, http.MethodDelete)
+	r.HandleFunc("/json/blacklist", login.RequireRole(login.ROLE_EDITOR, jsonBlacklistHandler)).Methods(http.MethodPost, http.MethodDelete)
 	r.HandleFunc("/json/job/{id}", jsonJobHandler)
 	r.HandleFunc("/json/job/{id}/cancel", jsonCancelJobHandler).Methods(http.MethodPost)
 	r.HandleFunc("/json/jobs/search", jsonJobSearchHandler)
@@ -593,7 +591,14 @@ func main() {
 	if err := swarming.InitPubSub(serverURL, *pubsubTopicName, *pubsubSubscriberName); err != nil {
 		sklog.Fatal(err)
 	}
-	ts, err = scheduling.NewTaskScheduler(tsDb, period, *commitWindow, wdAbs, serverURL, repos, isolateClient, swarm, httpClient, *scoreDecay24Hr, tryjobs.API_URL_PROD, *tryJobBucket, common.PROJECT_REPO_MAPPING, *swarmingPools, *pubsubTopicName, depotTools, gerrit)
+	var quotas *scheduling.QuotaConfig
+	if *quotaConfig != "" {
+		quotas, err = scheduling.ReadQuotaConfig(*quotaConfig)
+		if err != nil {
+			sklog.Fatal(err)
+		}
+	}
+	ts, err = scheduling.NewTaskScheduler(tsDb, period, *commitWindow, wdAbs, serverURL, repos, isolateClient, swarm, httpClient, *scoreDecay24Hr, tryjobs.API_URL_PROD, *tryJobBucket, common.PROJECT_REPO_MAPPING, *swarmingPools, *pubsubTopicName, depotTools, gerrit, quotas, *preemptBackfill)
 	if err != nil {
 		sklog.Fatal(err)
 	}
@@ -603,6 +608,9 @@ func main() {
 
 	// Start up the web server.
 	login.SimpleInitMust(*port, *local)
+	if err := login.InitRoles(*rolesConfig, login.GOOGLER_ROLES); err != nil {
+		sklog.Fatal(err)
+	}
 
 	if *local {
 		webhook.InitRequestSaltForTesting()